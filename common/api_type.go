@@ -100,3 +100,17 @@ func IsResponsesCompactAPIType(apiType int) bool {
 		return false
 	}
 }
+
+// IsNativeResponsesAPIType 上游原生支持 Responses API 会话状态（store / previous_response_id）的 API 类型，
+// 其余类型的 Responses 请求由网关转换，状态需由网关保存
+func IsNativeResponsesAPIType(apiType int) bool {
+	switch apiType {
+	case constant.APITypeOpenAI,
+		constant.APITypeCodex,
+		constant.APITypeSub2API,
+		constant.APITypeNewAPI:
+		return true
+	default:
+		return false
+	}
+}
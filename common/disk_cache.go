@@ -30,6 +30,19 @@ func GetDiskCacheDir() string {
 	return filepath.Join(cachePath, diskCacheDir)
 }
 
+// 持久化文件存储目录名（Files API 本地存储），与缓存目录平级，不会被缓存清理任务删除
+const diskFileStoreDir = "new-api-files"
+
+// GetDiskFileStoreDir 获取本地文件存储目录
+// 与磁盘缓存共用 DiskCachePath 配置，未配置时使用系统临时目录
+func GetDiskFileStoreDir() string {
+	cachePath := GetDiskCachePath()
+	if cachePath == "" {
+		cachePath = os.TempDir()
+	}
+	return filepath.Join(cachePath, diskFileStoreDir)
+}
+
 // EnsureDiskCacheDir 确保缓存目录存在
 func EnsureDiskCacheDir() error {
 	dir := GetDiskCacheDir()
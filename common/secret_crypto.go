@@ -0,0 +1,406 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 敏感字段（渠道密钥、OAuth 密钥、支付密钥等）的信封加密：
+// 每次加密随机生成一个数据密钥（DEK），用 AES-256-GCM 加密明文，DEK 再由主密钥包装后与密文一起存储。
+// 轮换主密钥时只需用新主密钥重新包装 DEK，无需重新加密数据。
+// 密文格式：enc:v1:<主密钥ID>:<包装后的DEK>:<nonce+密文>，后两段为无填充的 base64url。
+// 未配置主密钥时不加密，不带前缀的值一律视为明文，因此已有的明文数据可以直接读取，再由轮换任务逐步加密。
+
+const (
+	secretCipherPrefix = "enc:v1:"
+	secretDataKeySize  = 32
+)
+
+var (
+	ErrSecretKeyUnavailable = errors.New("secret is encrypted but no master key is configured")
+	ErrSecretMalformed      = errors.New("malformed encrypted secret")
+)
+
+// SecretKeyProvider 主密钥提供方，负责包装和解包数据密钥，可替换为外部 KMS
+type SecretKeyProvider interface {
+	// PrimaryKeyId 当前用于包装新数据密钥的主密钥 ID
+	PrimaryKeyId() string
+	WrapKey(dataKey []byte) (keyId string, wrapped []byte, err error)
+	UnwrapKey(keyId string, wrapped []byte) ([]byte, error)
+}
+
+var (
+	secretKeyProvider   SecretKeyProvider
+	secretKeyProviderMu sync.RWMutex
+)
+
+// SetSecretKeyProvider 设置主密钥提供方，传入 nil 关闭加密
+func SetSecretKeyProvider(provider SecretKeyProvider) {
+	secretKeyProviderMu.Lock()
+	secretKeyProvider = provider
+	secretKeyProviderMu.Unlock()
+}
+
+func getSecretKeyProvider() SecretKeyProvider {
+	secretKeyProviderMu.RLock()
+	defer secretKeyProviderMu.RUnlock()
+	return secretKeyProvider
+}
+
+// SecretEncryptionEnabled 是否配置了主密钥
+func SecretEncryptionEnabled() bool {
+	return getSecretKeyProvider() != nil
+}
+
+// GetSecretPrimaryKeyId 当前主密钥 ID，未配置时为空
+func GetSecretPrimaryKeyId() string {
+	provider := getSecretKeyProvider()
+	if provider == nil {
+		return ""
+	}
+	return provider.PrimaryKeyId()
+}
+
+// localSecretKeyring 本地主密钥环，主密钥来自环境变量或密钥环文件，用作 KMS 的本地替代
+type localSecretKeyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewLocalSecretKeyring 创建本地主密钥环，keys 为主密钥 ID 到 32 字节密钥的映射，primary 为当前主密钥
+func NewLocalSecretKeyring(primary string, keys map[string][]byte) (SecretKeyProvider, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary master key %q not found in keyring", primary)
+	}
+	for keyId, key := range keys {
+		if keyId == "" || strings.Contains(keyId, ":") {
+			return nil, fmt.Errorf("invalid master key id %q", keyId)
+		}
+		if len(key) != secretDataKeySize {
+			return nil, fmt.Errorf("master key %q must be %d bytes", keyId, secretDataKeySize)
+		}
+	}
+	return &localSecretKeyring{primary: primary, keys: keys}, nil
+}
+
+func (k *localSecretKeyring) PrimaryKeyId() string {
+	return k.primary
+}
+
+func (k *localSecretKeyring) WrapKey(dataKey []byte) (string, []byte, error) {
+	wrapped, err := sealAESGCM(k.keys[k.primary], dataKey, []byte(k.primary))
+	return k.primary, wrapped, err
+}
+
+func (k *localSecretKeyring) UnwrapKey(keyId string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("master key %q is not available", keyId)
+	}
+	return openAESGCM(key, wrapped, []byte(keyId))
+}
+
+func sealAESGCM(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrSecretMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+type secretEnvelope struct {
+	keyId   string
+	wrapped []byte
+	sealed  []byte
+}
+
+func parseSecretEnvelope(value string) (*secretEnvelope, error) {
+	parts := strings.Split(strings.TrimPrefix(value, secretCipherPrefix), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, ErrSecretMalformed
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrSecretMalformed
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrSecretMalformed
+	}
+	return &secretEnvelope{keyId: parts[0], wrapped: wrapped, sealed: sealed}, nil
+}
+
+func (e *secretEnvelope) String() string {
+	return secretCipherPrefix + e.keyId + ":" +
+		base64.RawURLEncoding.EncodeToString(e.wrapped) + ":" +
+		base64.RawURLEncoding.EncodeToString(e.sealed)
+}
+
+// IsEncryptedSecret 值是否为信封加密后的密文
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretCipherPrefix)
+}
+
+// EncryptSecret 加密一个敏感值。未配置主密钥、空值或已加密的值原样返回
+func EncryptSecret(plaintext string) (string, error) {
+	provider := getSecretKeyProvider()
+	if provider == nil || plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, secretDataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	keyId, wrapped, err := provider.WrapKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealAESGCM(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return (&secretEnvelope{keyId: keyId, wrapped: wrapped, sealed: sealed}).String(), nil
+}
+
+// DecryptSecret 解密一个敏感值，不是密文的值视为明文原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	envelope, err := parseSecretEnvelope(value)
+	if err != nil {
+		return "", err
+	}
+	provider := getSecretKeyProvider()
+	if provider == nil {
+		return "", ErrSecretKeyUnavailable
+	}
+	dataKey, err := provider.UnwrapKey(envelope.keyId, envelope.wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openAESGCM(dataKey, envelope.sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// RotateSecret 加密明文值，或把旧主密钥包装的数据密钥改用当前主密钥包装，changed 表示值是否需要回写
+func RotateSecret(value string) (rotated string, changed bool, err error) {
+	provider := getSecretKeyProvider()
+	if provider == nil || value == "" {
+		return value, false, nil
+	}
+	if !IsEncryptedSecret(value) {
+		rotated, err = EncryptSecret(value)
+		return rotated, err == nil, err
+	}
+	envelope, err := parseSecretEnvelope(value)
+	if err != nil {
+		return "", false, err
+	}
+	if envelope.keyId == provider.PrimaryKeyId() {
+		return value, false, nil
+	}
+	dataKey, err := provider.UnwrapKey(envelope.keyId, envelope.wrapped)
+	if err != nil {
+		return "", false, err
+	}
+	envelope.keyId, envelope.wrapped, err = provider.WrapKey(dataKey)
+	if err != nil {
+		return "", false, err
+	}
+	return envelope.String(), true, nil
+}
+
+// isSecretDocument JSON 形式的密钥（如 Vertex 服务账号、多 key 的 JSON 数组）整体加密，其余按行加密
+func isSecretDocument(value string) bool {
+	trimmed := strings.TrimSpace(value)
+	return strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{")
+}
+
+// EncryptSecretLines 加密按行存放的多个密钥（多 key 渠道），每行使用各自的数据密钥，空行保留
+func EncryptSecretLines(value string) (string, error) {
+	if !SecretEncryptionEnabled() || value == "" || isSecretDocument(value) {
+		return EncryptSecret(value)
+	}
+	return mapSecretLines(value, func(line string) (string, bool, error) {
+		encrypted, err := EncryptSecret(line)
+		return encrypted, true, err
+	})
+}
+
+// DecryptSecretLines 解密 EncryptSecretLines 的结果，也兼容整体加密的值和明文
+func DecryptSecretLines(value string) (string, error) {
+	if !strings.Contains(value, secretCipherPrefix) {
+		return value, nil
+	}
+	return mapSecretLines(value, func(line string) (string, bool, error) {
+		decrypted, err := DecryptSecret(line)
+		return decrypted, true, err
+	})
+}
+
+// RotateSecretLines 逐行执行 RotateSecret，明文值按 EncryptSecretLines 的规则加密
+func RotateSecretLines(value string) (string, bool, error) {
+	if !SecretEncryptionEnabled() || value == "" {
+		return value, false, nil
+	}
+	if !strings.Contains(value, secretCipherPrefix) {
+		encrypted, err := EncryptSecretLines(value)
+		return encrypted, err == nil, err
+	}
+	changed := false
+	rotated, err := mapSecretLines(value, func(line string) (string, bool, error) {
+		rotatedLine, lineChanged, err := RotateSecret(line)
+		changed = changed || lineChanged
+		return rotatedLine, lineChanged, err
+	})
+	return rotated, changed, err
+}
+
+func mapSecretLines(value string, fn func(line string) (string, bool, error)) (string, error) {
+	lines := strings.Split(value, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		mapped, _, err := fn(line)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %w", i+1, err)
+		}
+		lines[i] = mapped
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// secretKeyringFile 本地密钥环文件格式，keys 的值为 base64 编码的 32 字节密钥
+type secretKeyringFile struct {
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// parseMasterKey 解析主密钥：32 字节的 base64/hex 直接使用，否则视为口令取 SHA-256
+func parseMasterKey(raw string) []byte {
+	raw = strings.TrimSpace(raw)
+	if key, err := base64.StdEncoding.DecodeString(raw); err == nil && len(key) == secretDataKeySize {
+		return key
+	}
+	if key, err := hex.DecodeString(raw); err == nil && len(key) == secretDataKeySize {
+		return key
+	}
+	sum := sha256.Sum256([]byte(raw))
+	return sum[:]
+}
+
+// masterKeyFingerprint 环境变量主密钥没有名字，用密钥指纹作为 ID
+func masterKeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// loadSecretKeyringFile 读取本地密钥环文件，文件不存在时生成一个只含随机主密钥的新文件
+func loadSecretKeyringFile(path string) (SecretKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key := make([]byte, secretDataKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		keyId := masterKeyFingerprint(key)
+		file := secretKeyringFile{Primary: keyId, Keys: map[string]string{keyId: base64.StdEncoding.EncodeToString(key)}}
+		data, err = Marshal(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+		SysLog(fmt.Sprintf("generated secret encryption keyring %s with master key %s", path, keyId))
+	} else if err != nil {
+		return nil, err
+	}
+	var file secretKeyringFile
+	if err := Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring file %s: %w", path, err)
+	}
+	keys := make(map[string][]byte, len(file.Keys))
+	for keyId, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q in %s is not valid base64", keyId, path)
+		}
+		keys[keyId] = key
+	}
+	return NewLocalSecretKeyring(file.Primary, keys)
+}
+
+// initSecretEncryption 按环境变量初始化主密钥：
+// SECRET_ENCRYPTION_KEY 为当前主密钥，SECRET_ENCRYPTION_PREVIOUS_KEYS 为逗号分隔的旧主密钥（轮换完成前用于解密）；
+// 未设置时可用 SECRET_ENCRYPTION_KEYRING_FILE 指定本地密钥环文件。多节点部署时所有节点必须使用相同的主密钥
+func initSecretEncryption() error {
+	if raw := os.Getenv("SECRET_ENCRYPTION_KEY"); raw != "" {
+		primaryKey := parseMasterKey(raw)
+		primary := masterKeyFingerprint(primaryKey)
+		keys := map[string][]byte{primary: primaryKey}
+		for _, previous := range strings.Split(os.Getenv("SECRET_ENCRYPTION_PREVIOUS_KEYS"), ",") {
+			if strings.TrimSpace(previous) == "" {
+				continue
+			}
+			key := parseMasterKey(previous)
+			keys[masterKeyFingerprint(key)] = key
+		}
+		provider, err := NewLocalSecretKeyring(primary, keys)
+		if err != nil {
+			return err
+		}
+		SetSecretKeyProvider(provider)
+		return nil
+	}
+	if path := os.Getenv("SECRET_ENCRYPTION_KEYRING_FILE"); path != "" {
+		provider, err := loadSecretKeyringFile(path)
+		if err != nil {
+			return err
+		}
+		SetSecretKeyProvider(provider)
+	}
+	return nil
+}
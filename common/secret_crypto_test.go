@@ -0,0 +1,95 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useTestSecretKeyring(t *testing.T, primary string, keys map[string][]byte) {
+	t.Helper()
+	provider, err := NewLocalSecretKeyring(primary, keys)
+	require.NoError(t, err)
+	SetSecretKeyProvider(provider)
+	t.Cleanup(func() { SetSecretKeyProvider(nil) })
+}
+
+func TestSecretEncryptionRoundTrip(t *testing.T) {
+	plaintext, err := EncryptSecret("sk-plain")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plain", plaintext, "without a master key values are stored as is")
+
+	useTestSecretKeyring(t, "k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+
+	encrypted, err := EncryptSecret("sk-plain")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "enc:v1:k1:"))
+	other, err := EncryptSecret("sk-plain")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, other, "every record gets its own data key")
+
+	decrypted, err := DecryptSecret(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plain", decrypted)
+
+	legacy, err := DecryptSecret("sk-legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-legacy", legacy)
+
+	_, err = DecryptSecret(encrypted[:len(encrypted)-4] + "AAAA")
+	assert.Error(t, err)
+}
+
+func TestSecretLines(t *testing.T) {
+	useTestSecretKeyring(t, "k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+
+	encrypted, err := EncryptSecretLines("sk-a\nsk-b\n")
+	require.NoError(t, err)
+	lines := strings.Split(encrypted, "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, IsEncryptedSecret(lines[0]))
+	assert.True(t, IsEncryptedSecret(lines[1]))
+	assert.Equal(t, "", lines[2])
+	decrypted, err := DecryptSecretLines(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-a\nsk-b\n", decrypted)
+
+	document := "{\n  \"type\": \"service_account\"\n}"
+	encrypted, err = EncryptSecretLines(document)
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "\n")
+	decrypted, err = DecryptSecretLines(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, document, decrypted)
+}
+
+func TestRotateSecret(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	useTestSecretKeyring(t, "k1", map[string][]byte{"k1": oldKey})
+	encrypted, err := EncryptSecretLines("sk-a\nsk-b")
+	require.NoError(t, err)
+
+	useTestSecretKeyring(t, "k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	rotated, changed, err := RotateSecretLines(encrypted)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotContains(t, rotated, "enc:v1:k1:")
+
+	_, changed, err = RotateSecretLines(rotated)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	useTestSecretKeyring(t, "k2", map[string][]byte{"k2": newKey})
+	decrypted, err := DecryptSecretLines(rotated)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-a\nsk-b", decrypted)
+
+	rotated, changed, err = RotateSecret("sk-legacy")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, strings.HasPrefix(rotated, "enc:v1:k2:"))
+}
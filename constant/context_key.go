@@ -19,6 +19,14 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenResponseCache     ContextKey = "token_response_cache"
+	ContextKeyTokenHedge             ContextKey = "token_hedge"
+	ContextKeyTokenTPMLimit          ContextKey = "token_tpm_limit"
+	ContextKeyTokenTPDLimit          ContextKey = "token_tpd_limit"
+	ContextKeyTokenConcurrencyLimit  ContextKey = "token_concurrency_limit"
+	ContextKeyTokenOrganizationId    ContextKey = "token_organization_id"
+	ContextKeyTokenModeration        ContextKey = "token_moderation"
+	ContextKeyTokenTaskCallbackUrl   ContextKey = "token_task_callback_url"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -54,6 +62,29 @@ const (
 
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
+	// ContextKeyBatchId marks a request executed by the batch runner (/v1/batches and
+	// /v1/messages/batches); it is only ever set internally and enables the per-model batch discount ratio.
+	ContextKeyBatchId ContextKey = "batch_id"
+
+	// ContextKeyResponseCacheHit marks a request answered from the response cache.
+	ContextKeyResponseCacheHit ContextKey = "response_cache_hit"
+
+	// ContextKeyHedgeAttempt holds the *service.HedgeAttempt of a relay attempt
+	// racing against a hedged request.
+	ContextKeyHedgeAttempt ContextKey = "hedge_attempt"
+	// ContextKeyHedgeChannelIds lists the channels raced by a hedged request.
+	ContextKeyHedgeChannelIds ContextKey = "hedge_channel_ids"
+
+	// ContextKeyModerationVerdicts holds the []service.ModerationVerdict of a
+	// request, written into the log Other field on settlement.
+	ContextKeyModerationVerdicts ContextKey = "moderation_verdicts"
+	// ContextKeyPIISession holds the *service.PIISession mapping the PII
+	// placeholders of a redacted request back to the original values.
+	ContextKeyPIISession ContextKey = "pii_session"
+	// ContextKeyPromptTemplate holds the *service.PromptTemplateUsage of a
+	// request that referenced a server-side prompt template.
+	ContextKeyPromptTemplate ContextKey = "prompt_template"
+
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
 
 	// ContextKeyFileSourcesToCleanup stores file sources that need cleanup when request ends
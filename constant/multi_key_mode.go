@@ -3,6 +3,14 @@ package constant
 type MultiKeyMode string
 
 const (
-	MultiKeyModeRandom  MultiKeyMode = "random"  // 随机
-	MultiKeyModePolling MultiKeyMode = "polling" // 轮询
+	MultiKeyModeRandom   MultiKeyMode = "random"   // 随机
+	MultiKeyModePolling  MultiKeyMode = "polling"  // 轮询
+	MultiKeyModeLRU      MultiKeyMode = "lru"      // 最久未使用
+	MultiKeyModeWeighted MultiKeyMode = "weighted" // 按每个key配置的 RPM/TPM 剩余额度加权
+	MultiKeyModeSticky   MultiKeyMode = "sticky"   // 固定使用一个key，直到上游返回 429 才切换
 )
+
+// IsRateLimitAware 判断该模式下上游 429 是否只让对应 key 冷却而不是禁用它
+func (m MultiKeyMode) IsRateLimitAware() bool {
+	return m == MultiKeyModeLRU || m == MultiKeyModeWeighted || m == MultiKeyModeSticky
+}
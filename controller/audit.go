@@ -49,6 +49,19 @@ var auditContentTemplates = map[string]string{
 
 	"subscription.plan_reset":      "Reset active subscriptions for plan ${plan_id}",
 	"subscription.user_plan_reset": "Reset active plan ${plan_id} subscriptions for user ${target_user_id}",
+
+	"authz.role_create": "Created authorization role ${key}",
+	"authz.role_update": "Updated authorization role ${key}",
+	"authz.role_delete": "Deleted authorization role ${key}",
+	"authz.user_roles":  "Set authorization roles of user ${target_user_id} to ${roles}",
+
+	"mcp_server.create": "Registered MCP server ${name} (ID: ${id})",
+	"mcp_server.update": "Updated MCP server ${name} (ID: ${id})",
+	"mcp_server.delete": "Deleted MCP server ${name} (ID: ${id})",
+
+	"prompt_template.delete": "Deleted prompt template ${name} (${prompt_id})",
+
+	"log.payload_view": "Viewed captured payload of request ${request_id}",
 }
 
 // auditContentEN 按 action 模板渲染英文兜底文本；未登记的 action 退回 action 本身。
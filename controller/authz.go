@@ -1,8 +1,14 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service/authz"
 
 	"github.com/gin-gonic/gin"
@@ -22,3 +28,120 @@ func GetPermissionCatalog(c *gin.Context) {
 		},
 	})
 }
+
+func GetAuthzRoles(c *gin.Context) {
+	common.ApiSuccess(c, authz.Roles())
+}
+
+func CreateAuthzRole(c *gin.Context) {
+	var input authz.RoleInput
+	if err := common.DecodeJson(c.Request.Body, &input); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := authz.CreateRole(input); err != nil {
+		respondAuthzRoleError(c, err)
+		return
+	}
+	recordManageAuditFor(c, 0, "authz.role_create", map[string]interface{}{
+		"key":         strings.TrimSpace(input.Key),
+		"permissions": input.Permissions,
+	})
+	common.ApiSuccess(c, nil)
+}
+
+func UpdateAuthzRole(c *gin.Context) {
+	var input authz.RoleInput
+	if err := common.DecodeJson(c.Request.Body, &input); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	key := c.Param("key")
+	if err := authz.UpdateRole(key, input); err != nil {
+		respondAuthzRoleError(c, err)
+		return
+	}
+	recordManageAuditFor(c, 0, "authz.role_update", map[string]interface{}{
+		"key":         key,
+		"permissions": input.Permissions,
+	})
+	common.ApiSuccess(c, nil)
+}
+
+func DeleteAuthzRole(c *gin.Context) {
+	key := c.Param("key")
+	if err := authz.DeleteRole(key); err != nil {
+		respondAuthzRoleError(c, err)
+		return
+	}
+	recordManageAuditFor(c, 0, "authz.role_delete", map[string]interface{}{
+		"key": key,
+	})
+	common.ApiSuccess(c, nil)
+}
+
+func GetUserAuthzRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgUserNotExists)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"roles":       authz.UserRoles(user.Id),
+		"permissions": authz.Capabilities(user.Id, user.Role),
+	})
+}
+
+type userAuthzRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// SetUserAuthzRoles replaces the custom roles of a user. Custom roles add to
+// the grants of the user's system role and take effect on the next request.
+func SetUserAuthzRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return
+	}
+	var req userAuthzRolesRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgUserNotExists)
+		return
+	}
+	if err := authz.SetUserRoles(user.Id, req.Roles); err != nil {
+		respondAuthzRoleError(c, err)
+		return
+	}
+	recordManageAuditFor(c, user.Id, "authz.user_roles", map[string]interface{}{
+		"roles": strings.Join(req.Roles, ","),
+	})
+	common.ApiSuccess(c, nil)
+}
+
+func respondAuthzRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, authz.ErrRoleNotFound):
+		common.ApiErrorI18n(c, i18n.MsgAuthzRoleNotFound)
+	case errors.Is(err, authz.ErrRoleKeyInvalid):
+		common.ApiErrorI18n(c, i18n.MsgAuthzRoleKeyInvalid)
+	case errors.Is(err, authz.ErrRoleKeyExists):
+		common.ApiErrorI18n(c, i18n.MsgAuthzRoleKeyExists)
+	case errors.Is(err, authz.ErrRoleBuiltIn):
+		common.ApiErrorI18n(c, i18n.MsgAuthzRoleBuiltIn)
+	case errors.Is(err, authz.ErrRoleNameEmpty):
+		common.ApiErrorI18n(c, i18n.MsgAuthzRoleNameEmpty)
+	default:
+		common.ApiError(c, err)
+	}
+}
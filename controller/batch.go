@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultBatchListLimit = 20
+	maxBatchListLimit     = 100
+)
+
+type createBatchRequest struct {
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+func checkBatchApiEnabled(c *gin.Context) bool {
+	if !operation_setting.IsBatchApiEnabled() {
+		RelayNotImplemented(c)
+		return false
+	}
+	return true
+}
+
+// getRequestUserBatch loads the batch referenced by :id and writes a 404 when
+// it does not belong to the caller.
+func getRequestUserBatch(c *gin.Context) (*model.Batch, bool) {
+	batch, err := model.GetUserBatchByBatchId(c.GetInt("id"), c.Param("id"))
+	if err == nil && batch.IsClaudeMessageBatch() {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No batch found with id '%s'.", c.Param("id")))
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to query batch")
+		}
+		return nil, false
+	}
+	return batch, true
+}
+
+// CreateBatch handles POST /v1/batches. The input file is validated and
+// executed asynchronously by the batch_execution system task.
+func CreateBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	var req createBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request body")
+		return
+	}
+	if req.InputFileId == "" {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Missing required parameter: 'input_file_id'.")
+		return
+	}
+	if !service.IsSupportedBatchEndpoint(req.Endpoint) {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid value for 'endpoint', expected one of: %s", strings.Join(service.SupportedBatchEndpoints, ", ")))
+		return
+	}
+	if req.CompletionWindow == "" {
+		req.CompletionWindow = service.BatchCompletionWindow
+	}
+	if req.CompletionWindow != service.BatchCompletionWindow {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid value for 'completion_window', expected '%s'.", service.BatchCompletionWindow))
+		return
+	}
+	if len(req.Metadata) > 16 {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid 'metadata': at most 16 key-value pairs are allowed.")
+		return
+	}
+
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileByFileId(userId, req.InputFileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("No such File object: %s", req.InputFileId))
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to query file")
+		}
+		return
+	}
+	if inputFile.Purpose != "batch" {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", "The input file must be uploaded with purpose 'batch'.")
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          service.NewBatchId(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Group:            common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		Endpoint:         req.Endpoint,
+		CompletionWindow: req.CompletionWindow,
+		InputFileId:      inputFile.FileId,
+		Status:           model.BatchStatusValidating,
+		Mode:             model.BatchModeLocal,
+		CreatedAt:        now,
+		ExpiresAt:        service.BatchCompletionDeadline(now),
+	}
+	if len(req.Metadata) > 0 {
+		metadata, err := common.Marshal(req.Metadata)
+		if err != nil {
+			fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid 'metadata'")
+			return
+		}
+		batch.Metadata = string(metadata)
+	}
+	if err := batch.Insert(); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to create batch: %s", err.Error()))
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to create batch")
+		return
+	}
+	if _, _, err := service.EnqueueSystemTask(model.SystemTaskTypeBatchExecution, nil); err != nil {
+		// 调度器会在下一轮补建执行任务
+		logger.LogWarn(c, fmt.Sprintf("failed to enqueue batch execution task: %s", err.Error()))
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIBatchObject(batch))
+}
+
+// RetrieveBatch handles GET /v1/batches/:id.
+func RetrieveBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	batch, ok := getRequestUserBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIBatchObject(batch))
+}
+
+// ListBatches handles GET /v1/batches.
+func ListBatches(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultBatchListLimit
+	}
+	if limit > maxBatchListLimit {
+		limit = maxBatchListLimit
+	}
+	batches, err := model.ListUserBatches(c.GetInt("id"), false, c.Query("after"), limit)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid 'after' cursor")
+			return
+		}
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to list batches")
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]service.OpenAIBatchObject, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, service.ToOpenAIBatchObject(batch))
+	}
+	resp := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	}
+	if len(data) > 0 {
+		resp["first_id"] = data[0].Id
+		resp["last_id"] = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CancelBatch handles POST /v1/batches/:id/cancel. The batch moves to
+// cancelling; the runner stops executing, writes partial results and marks it
+// cancelled (and cancels the upstream batch when forwarded).
+func CancelBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	batch, ok := getRequestUserBatch(c)
+	if !ok {
+		return
+	}
+	updated, err := model.MarkBatchCancelling(batch.Id)
+	if err != nil {
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to cancel batch")
+		return
+	}
+	if !updated && batch.Status != model.BatchStatusCancelling {
+		fileApiError(c, http.StatusConflict, "invalid_request_error", fmt.Sprintf("Cannot cancel a batch with status '%s'.", batch.Status))
+		return
+	}
+	if latest, err := model.GetBatchById(batch.Id); err == nil {
+		batch = latest
+	}
+	if _, _, err := service.EnqueueSystemTask(model.SystemTaskTypeBatchExecution, nil); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to enqueue batch execution task: %s", err.Error()))
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIBatchObject(batch))
+}
@@ -0,0 +1,515 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// batchRunnerActiveLimit caps how many active batches one pass advances.
+	batchRunnerActiveLimit = 20
+	// batchRunnerTimeSlice bounds how long one pass keeps executing a single
+	// local batch so a huge batch cannot starve the others; the next scheduled
+	// pass resumes it from the persisted progress.
+	batchRunnerTimeSlice = 2 * time.Minute
+)
+
+// batchRelayContextKey carries the batch id on requests replayed by the batch
+// runner. It lives on the request context.Context, which clients cannot set.
+type batchRelayContextKey struct{}
+
+var (
+	batchRelayEngineOnce sync.Once
+	batchRelayEngine     *gin.Engine
+)
+
+// getBatchRelayEngine returns a private engine carrying the normal relay
+// middleware chain (token auth, channel distribution, retry and billing inside
+// Relay) for the batch endpoints, so every batch line is executed exactly like
+// an online request of the batch's token. The moderation channel provider
+// reuses it to call /v1/moderations.
+func getBatchRelayEngine() *gin.Engine {
+	batchRelayEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(gin.Recovery())
+		engine.Use(middleware.RequestId())
+		engine.Use(middleware.I18n())
+		engine.Use(markBatchRelayRequest())
+		engine.Use(middleware.BodyStorageCleanup())
+		engine.Use(middleware.TokenAuth())
+		engine.Use(middleware.Distribute())
+		relayFormats := map[string]types.RelayFormat{
+			"/v1/chat/completions": types.RelayFormatOpenAI,
+			"/v1/completions":      types.RelayFormatOpenAI,
+			"/v1/moderations":      types.RelayFormatOpenAI,
+			"/v1/embeddings":       types.RelayFormatEmbedding,
+			"/v1/responses":        types.RelayFormatOpenAIResponses,
+			"/v1/messages":         types.RelayFormatClaude,
+		}
+		for endpoint, format := range relayFormats {
+			relayFormat := format
+			engine.POST(endpoint, func(c *gin.Context) {
+				Relay(c, relayFormat)
+			})
+		}
+		batchRelayEngine = engine
+	})
+	return batchRelayEngine
+}
+
+// markBatchRelayRequest moves the batch id from the request context into the
+// gin context so pricing applies the batch discount ratio.
+func markBatchRelayRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if batchId, ok := c.Request.Context().Value(batchRelayContextKey{}).(string); ok && batchId != "" {
+			common.SetContextKey(c, constant.ContextKeyBatchId, batchId)
+		}
+		c.Next()
+	}
+}
+
+// BatchExecutionSummary is the result of one batch_execution pass.
+type BatchExecutionSummary struct {
+	Batches   int `json:"batches"`
+	Executed  int `json:"executed"`
+	Finalized int `json:"finalized"`
+}
+
+// batchExecutionHandler advances every active /v1/batches batch: validates new
+// ones, executes local lines chunk by chunk and polls forwarded upstream ones.
+// It is scheduled while active batches exist and also enqueued on create/cancel.
+type batchExecutionHandler struct{}
+
+func (batchExecutionHandler) Type() string { return model.SystemTaskTypeBatchExecution }
+
+func (batchExecutionHandler) Enabled() bool {
+	return operation_setting.IsBatchApiEnabled() && model.HasActiveBatches()
+}
+
+func (batchExecutionHandler) Interval() time.Duration { return 15 * time.Second }
+
+func (batchExecutionHandler) NewPayload() any { return nil }
+
+func (batchExecutionHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary, err := runBatchExecutionOnce(ctx, service.NewSystemTaskProgressReporter(task, runnerID))
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+func runBatchExecutionOnce(ctx context.Context, progress func(processed, total int)) (BatchExecutionSummary, error) {
+	summary := BatchExecutionSummary{}
+	batches, err := model.GetActiveBatches(batchRunnerActiveLimit)
+	if err != nil {
+		return summary, err
+	}
+	summary.Batches = len(batches)
+	total, processed := 0, 0
+	for _, batch := range batches {
+		total += batch.TotalCount
+		processed += batch.ProcessedCount()
+	}
+	for _, batch := range batches {
+		if ctx.Err() != nil {
+			break
+		}
+		before := batch.ProcessedCount()
+		finalized, err := advanceBatch(ctx, batch)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s: %s", batch.BatchId, err.Error()))
+		}
+		if batch.Mode == model.BatchModeLocal && batch.ProcessedCount() > before {
+			summary.Executed += batch.ProcessedCount() - before
+			processed += batch.ProcessedCount() - before
+		}
+		if finalized {
+			summary.Finalized++
+		}
+		if progress != nil {
+			progress(processed, total)
+		}
+	}
+	if progress != nil {
+		progress(total, total)
+	}
+	return summary, nil
+}
+
+// advanceBatch moves one batch forward and reports whether it reached a
+// terminal status.
+func advanceBatch(ctx context.Context, batch *model.Batch) (bool, error) {
+	if batch.Status == model.BatchStatusValidating {
+		if err := validateBatch(ctx, batch); err != nil {
+			return false, err
+		}
+		if !batch.IsActive() {
+			return true, nil
+		}
+	}
+	if batch.Mode == model.BatchModeUpstream {
+		return advanceUpstreamBatch(ctx, batch)
+	}
+	lines, err := loadBatchLines(ctx, batch)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return true, failBatch(batch, service.BatchError{Code: "invalid_input_file", Message: fmt.Sprintf("The input file %s was deleted before the batch finished.", batch.InputFileId)})
+		}
+		return false, err
+	}
+	if batch.Status == model.BatchStatusInProgress {
+		return runLocalBatch(ctx, batch, lines, time.Now().Add(batchRunnerTimeSlice))
+	}
+	return finishLocalBatch(ctx, batch, lines)
+}
+
+func loadBatchLines(ctx context.Context, batch *model.Batch) ([]service.BatchRequestLine, error) {
+	inputFile, err := model.GetUserFileByFileId(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return nil, err
+	}
+	content, err := service.ReadUserFileContent(ctx, inputFile)
+	if err != nil {
+		return nil, err
+	}
+	lines, errs := service.ParseBatchInput(content, batch.Endpoint, 0)
+	if len(errs) > 0 {
+		return nil, errors.New(errs[0].Message)
+	}
+	return lines, nil
+}
+
+// failBatch moves a batch to failed with the given errors.
+func failBatch(batch *model.Batch, errs ...service.BatchError) error {
+	expected := batch.Status
+	batch.Status = model.BatchStatusFailed
+	batch.FailedAt = common.GetTimestamp()
+	service.SetBatchErrors(batch, errs)
+	_, err := batch.SaveIfStatus(expected)
+	return err
+}
+
+// validateBatch parses the input file and decides whether the batch is
+// forwarded to the upstream channel the input file was passed through to, or
+// executed locally.
+func validateBatch(ctx context.Context, batch *model.Batch) error {
+	inputFile, err := model.GetUserFileByFileId(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return failBatch(batch, service.BatchError{Code: "invalid_input_file", Message: fmt.Sprintf("The input file %s no longer exists.", batch.InputFileId)})
+	}
+	content, err := service.ReadUserFileContent(ctx, inputFile)
+	if err != nil {
+		return err
+	}
+	lines, errs := service.ParseBatchInput(content, batch.Endpoint, operation_setting.GetBatchSetting().MaxRequestsPerBatch)
+	if len(errs) > 0 {
+		return failBatch(batch, errs...)
+	}
+	batch.TotalCount = len(lines)
+
+	var channel *model.Channel
+	if operation_setting.GetBatchSetting().UpstreamEnabled && inputFile.ChannelId > 0 && inputFile.UpstreamFileId != "" {
+		channel, err = model.GetChannelById(inputFile.ChannelId, true)
+		if err == nil && channel.Status == common.ChannelStatusEnabled && service.ChannelSupportsBatchApi(channel) {
+			forwardUpstreamBatch(ctx, channel, batch, lines, inputFile.UpstreamFileId)
+		}
+	}
+
+	batch.Status = model.BatchStatusInProgress
+	batch.InProgressAt = common.GetTimestamp()
+	saved, err := batch.SaveIfStatus(model.BatchStatusValidating)
+	if err != nil {
+		return err
+	}
+	if !saved && batch.Mode == model.BatchModeUpstream {
+		// 校验期间被用户取消：撤回刚创建的上游批处理并退还预扣额度，下一轮按本地取消收尾
+		if err := service.CancelUpstreamBatch(ctx, channel, batch.UpstreamBatchId); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s: failed to cancel upstream batch: %s", batch.BatchId, err.Error()))
+		}
+		_ = service.RefundUpstreamBatchQuota(ctx, batch)
+	}
+	if !saved {
+		batch.Status = model.BatchStatusCancelling
+	}
+	return nil
+}
+
+// forwardUpstreamBatch pre-consumes the estimated quota of the requested
+// models and creates the upstream batch. When either step fails the quota is
+// refunded and the batch stays local, where every line is billed like an
+// online request.
+func forwardUpstreamBatch(ctx context.Context, channel *model.Channel, batch *model.Batch, lines []service.BatchRequestLine, upstreamInputFileId string) {
+	// a previous pass may have pre-consumed before the runner stopped
+	if batch.Quota == 0 {
+		if apiErr := service.PreConsumeUpstreamBatchQuota(newBatchBillingContext(ctx, batch), batch, lines); apiErr != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s: failed to pre-consume quota for the upstream batch, executing locally: %s", batch.BatchId, apiErr.Error()))
+			return
+		}
+	}
+	upstreamBatchId, err := service.CreateUpstreamBatch(ctx, channel, batch, upstreamInputFileId)
+	if err != nil {
+		// 上游不可用时退回本地执行
+		logger.LogWarn(ctx, fmt.Sprintf("batch %s: failed to create upstream batch on channel #%d, executing locally: %s", batch.BatchId, channel.Id, err.Error()))
+		_ = service.RefundUpstreamBatchQuota(ctx, batch)
+		return
+	}
+	batch.Mode = model.BatchModeUpstream
+	batch.ChannelId = channel.Id
+	batch.UpstreamBatchId = upstreamBatchId
+}
+
+// runLocalBatch executes the remaining lines chunk by chunk until the batch is
+// done, cancelled, expired or the time slice is used up. Each finished chunk is
+// persisted as a part object before progress is saved, so a crashed runner
+// re-executes at most one chunk.
+func runLocalBatch(ctx context.Context, batch *model.Batch, lines []service.BatchRequestLine, deadline time.Time) (bool, error) {
+	token, _ := model.GetTokenById(batch.TokenId)
+	tokenKey := ""
+	if token != nil {
+		tokenKey = token.Key
+	}
+	for batch.ProcessedCount() < len(lines) {
+		if ctx.Err() != nil || time.Now().After(deadline) {
+			return false, nil
+		}
+		status, err := model.GetBatchStatus(batch.Id)
+		if err != nil {
+			return false, err
+		}
+		if status == model.BatchStatusCancelling {
+			batch.Status = model.BatchStatusCancelling
+			if batch.CancellingAt == 0 {
+				batch.CancellingAt = common.GetTimestamp()
+			}
+			return finishLocalBatch(ctx, batch, lines)
+		}
+		if common.GetTimestamp() > batch.ExpiresAt {
+			return finishLocalBatch(ctx, batch, lines)
+		}
+
+		start := batch.ProcessedCount()
+		end := start + service.BatchChunkSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+		outputs, failures := executeBatchChunk(ctx, batch, tokenKey, lines[start:end])
+		if err := service.StoreBatchPart(context.Background(), batch, start/service.BatchChunkSize, outputs, failures); err != nil {
+			return false, err
+		}
+		batch.CompletedCount += len(outputs)
+		batch.FailedCount += len(failures)
+		if err := batch.UpdateProgress(); err != nil {
+			return false, err
+		}
+	}
+	return finishLocalBatch(ctx, batch, lines)
+}
+
+// executeBatchChunk runs the lines with the configured concurrency. Lines that
+// returned a 2xx response go to the output file, all others to the error file.
+func executeBatchChunk(ctx context.Context, batch *model.Batch, tokenKey string, lines []service.BatchRequestLine) ([][]byte, [][]byte) {
+	results := make([][]byte, len(lines))
+	succeeded := make([]bool, len(lines))
+	sem := make(chan struct{}, operation_setting.GetBatchConcurrency())
+	var wg sync.WaitGroup
+	for i := range lines {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], succeeded[i] = executeBatchLine(ctx, batch, tokenKey, lines[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var outputs, failures [][]byte
+	for i := range lines {
+		if succeeded[i] {
+			outputs = append(outputs, results[i])
+		} else {
+			failures = append(failures, results[i])
+		}
+	}
+	return outputs, failures
+}
+
+func executeBatchLine(ctx context.Context, batch *model.Batch, tokenKey string, line service.BatchRequestLine) ([]byte, bool) {
+	reqCtx := context.WithValue(ctx, batchRelayContextKey{}, batch.BatchId)
+	req := httptest.NewRequestWithContext(reqCtx, http.MethodPost, line.Url, bytes.NewReader(line.Body))
+	req.Header.Set("Authorization", "Bearer sk-"+tokenKey)
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	getBatchRelayEngine().ServeHTTP(recorder, req)
+	requestId := recorder.Header().Get(common.RequestIdKey)
+	return service.NewBatchOutputLine(line.CustomId, recorder.Code, requestId, recorder.Body.Bytes()), recorder.Code/100 == 2
+}
+
+// localBatchTerminalStatus derives the final status from persisted fields so a
+// finalize interrupted by a crash resumes with the same outcome.
+func localBatchTerminalStatus(batch *model.Batch) string {
+	if batch.CancellingAt > 0 {
+		return model.BatchStatusCancelled
+	}
+	if batch.ProcessedCount() < batch.TotalCount {
+		return model.BatchStatusExpired
+	}
+	return model.BatchStatusCompleted
+}
+
+// finishLocalBatch writes the output/error files and moves the batch to its
+// terminal status. Lines that were never executed are reported in the error
+// file.
+func finishLocalBatch(ctx context.Context, batch *model.Batch, lines []service.BatchRequestLine) (bool, error) {
+	terminal := localBatchTerminalStatus(batch)
+	if batch.Status != model.BatchStatusFinalizing {
+		expected := batch.Status
+		batch.Status = model.BatchStatusFinalizing
+		batch.FinalizingAt = common.GetTimestamp()
+		saved, err := batch.SaveIfStatus(expected)
+		if err != nil || !saved {
+			return false, err
+		}
+	}
+
+	var skipped [][]byte
+	if processed := batch.ProcessedCount(); processed < len(lines) {
+		code, message := "batch_expired", "This request could not be executed before the completion window expired."
+		if terminal == model.BatchStatusCancelled {
+			code, message = "batch_cancelled", "This request was not executed because the batch was cancelled."
+		}
+		for _, line := range lines[processed:] {
+			skipped = append(skipped, service.NewBatchErrorLine(line.CustomId, code, message))
+		}
+	}
+	if err := service.FinalizeLocalBatchFiles(ctx, batch, skipped); err != nil {
+		return false, err
+	}
+
+	now := common.GetTimestamp()
+	batch.Status = terminal
+	switch terminal {
+	case model.BatchStatusCancelled:
+		batch.CancelledAt = now
+	case model.BatchStatusExpired:
+		batch.ExpiredAt = now
+		// Message Batches report expired requests separately from errored ones
+		if !batch.IsClaudeMessageBatch() {
+			batch.FailedCount += len(skipped)
+		}
+	default:
+		batch.CompletedAt = now
+	}
+	saved, err := batch.SaveIfStatus(model.BatchStatusFinalizing)
+	if err != nil || !saved {
+		service.DiscardBatchResultFiles(ctx, batch)
+		return false, err
+	}
+	service.DeleteBatchParts(ctx, batch)
+	return true, nil
+}
+
+// advanceUpstreamBatch polls a forwarded batch, mirrors its status and counts,
+// and once it is terminal stores the result files locally and bills the usage.
+func advanceUpstreamBatch(ctx context.Context, batch *model.Batch) (bool, error) {
+	channel, err := model.GetChannelById(batch.ChannelId, true)
+	if err != nil {
+		if err := service.RefundUpstreamBatchQuota(ctx, batch); err != nil {
+			return false, err
+		}
+		return true, failBatch(batch, service.BatchError{Code: "upstream_unavailable", Message: "The upstream channel executing this batch is no longer available."})
+	}
+	if batch.Status == model.BatchStatusCancelling {
+		if err := service.CancelUpstreamBatch(ctx, channel, batch.UpstreamBatchId); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s: failed to cancel upstream batch: %s", batch.BatchId, err.Error()))
+		}
+	}
+	state, err := service.RetrieveUpstreamBatch(ctx, channel, batch.UpstreamBatchId)
+	if err != nil {
+		return false, err
+	}
+	if state.TotalCount > 0 {
+		batch.TotalCount = state.TotalCount
+	}
+	batch.CompletedCount = state.CompletedCount
+	batch.FailedCount = state.FailedCount
+
+	expected := batch.Status
+	now := common.GetTimestamp()
+	switch state.Status {
+	case model.BatchStatusFailed:
+		if err := service.RefundUpstreamBatchQuota(ctx, batch); err != nil {
+			return false, err
+		}
+		return true, failBatch(batch, state.Errors...)
+	case model.BatchStatusCompleted, model.BatchStatusExpired, model.BatchStatusCancelled:
+		lines, err := loadBatchLines(ctx, batch)
+		if err != nil {
+			return false, err
+		}
+		output, err := service.StoreUpstreamBatchResults(ctx, channel, batch, state)
+		if err != nil {
+			return false, err
+		}
+		// 落终态前按请求的模型结算，执行器在两步之间退出时下一轮重新结算的差额为 0
+		quota, err := service.SettleUpstreamBatchUsage(newBatchBillingContext(ctx, batch), batch, lines, output)
+		if err != nil {
+			service.DiscardBatchResultFiles(ctx, batch)
+			return false, err
+		}
+		batch.Status = state.Status
+		switch state.Status {
+		case model.BatchStatusCompleted:
+			batch.CompletedAt = now
+		case model.BatchStatusExpired:
+			batch.ExpiredAt = now
+		default:
+			batch.CancelledAt = now
+		}
+		saved, err := batch.SaveIfStatus(expected)
+		if err != nil || !saved {
+			service.DiscardBatchResultFiles(ctx, batch)
+			return false, err
+		}
+		logger.LogInfo(ctx, fmt.Sprintf("batch %s finished upstream with status %s, charged %s", batch.BatchId, batch.Status, logger.FormatQuota(quota)))
+		return true, nil
+	case model.BatchStatusFinalizing:
+		if batch.Status == model.BatchStatusInProgress {
+			batch.Status = model.BatchStatusFinalizing
+			batch.FinalizingAt = now
+			_, err := batch.SaveIfStatus(expected)
+			return false, err
+		}
+	}
+	return false, batch.UpdateProgress()
+}
+
+// newBatchBillingContext builds the gin context consume logs are recorded
+// with for usage billed outside of an HTTP request.
+func newBatchBillingContext(ctx context.Context, batch *model.Batch) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequestWithContext(ctx, http.MethodGet, "/v1/batches/"+batch.BatchId, nil)
+	c.Set(common.RequestIdKey, batch.BatchId)
+	return c
+}
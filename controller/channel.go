@@ -13,6 +13,8 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	keyusage "github.com/QuantumNous/new-api/pkg/key_usage"
 	relaychannel "github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/ollama"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
@@ -71,6 +73,16 @@ func clearChannelInfo(channel *model.Channel) {
 	}
 }
 
+// attachCircuitBreakerStatus fills the live circuit breaker state shown in the
+// channel list.
+func attachCircuitBreakerStatus(channel *model.Channel) {
+	keyCount := 0
+	if channel.ChannelInfo.IsMultiKey {
+		keyCount = channel.ChannelInfo.MultiKeySize
+	}
+	channel.CircuitBreaker = circuitbreaker.GetChannelStatus(channel.Id, keyCount)
+}
+
 func applyChannelStatusFilter(query *gorm.DB, statusFilter int) *gorm.DB {
 	if statusFilter == common.ChannelStatusEnabled {
 		return query.Where("status = ?", common.ChannelStatusEnabled)
@@ -167,6 +179,7 @@ func GetAllChannels(c *gin.Context) {
 
 	for _, datum := range channelData {
 		clearChannelInfo(datum)
+		attachCircuitBreakerStatus(datum)
 	}
 
 	countQuery := buildChannelListQuery(groupFilter, statusFilter, -1)
@@ -380,6 +393,7 @@ func SearchChannels(c *gin.Context) {
 
 	for _, datum := range pagedData {
 		clearChannelInfo(datum)
+		attachCircuitBreakerStatus(datum)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -1462,11 +1476,13 @@ func CopyChannel(c *gin.Context) {
 // MultiKeyManageRequest represents the request for multi-key management operations
 type MultiKeyManageRequest struct {
 	ChannelId int    `json:"channel_id"`
-	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status"
-	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, and delete_key actions
+	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status", "set_key_limit"
+	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, delete_key and set_key_limit actions
 	Page      int    `json:"page,omitempty"`      // for get_key_status pagination
 	PageSize  int    `json:"page_size,omitempty"` // for get_key_status pagination
 	Status    *int   `json:"status,omitempty"`    // for get_key_status filtering: 1=enabled, 2=manual_disabled, 3=auto_disabled, nil=all
+	RPM       int    `json:"rpm,omitempty"`       // for set_key_limit, 0 = unlimited
+	TPM       int    `json:"tpm,omitempty"`       // for set_key_limit, 0 = unlimited
 }
 
 // MultiKeyStatusResponse represents the response for key status query
@@ -1488,6 +1504,10 @@ type KeyStatus struct {
 	DisabledTime int64  `json:"disabled_time,omitempty"`
 	Reason       string `json:"reason,omitempty"`
 	KeyPreview   string `json:"key_preview"` // first 10 chars of key for identification
+	// Limit is the configured upstream rate limit of the key, used by the weighted mode
+	Limit *model.MultiKeyLimit `json:"limit,omitempty"`
+	// Usage holds the usage counters this node observed for the key
+	Usage keyusage.Usage `json:"usage"`
 }
 
 // ManageMultiKeys handles multi-key management operations
@@ -1590,13 +1610,18 @@ func ManageMultiKeys(c *gin.Context) {
 				keyPreview = key[:10] + "..."
 			}
 
-			allKeyStatusList = append(allKeyStatusList, KeyStatus{
+			keyStatus := KeyStatus{
 				Index:        i,
 				Status:       status,
 				DisabledTime: disabledTime,
 				Reason:       reason,
 				KeyPreview:   keyPreview,
-			})
+				Usage:        keyusage.Get(channel.Id, i),
+			}
+			if limit, ok := channel.ChannelInfo.MultiKeyLimits[i]; ok {
+				keyStatus.Limit = &limit
+			}
+			allKeyStatusList = append(allKeyStatusList, keyStatus)
 		}
 
 		// Apply status filter if specified
@@ -1735,6 +1760,53 @@ func ManageMultiKeys(c *gin.Context) {
 		})
 		return
 
+	case "set_key_limit":
+		if request.KeyIndex == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "未指定要设置限额的密钥索引",
+			})
+			return
+		}
+
+		keyIndex := *request.KeyIndex
+		if keyIndex < 0 || keyIndex >= channel.ChannelInfo.MultiKeySize {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥索引超出范围",
+			})
+			return
+		}
+		if request.RPM < 0 || request.TPM < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "限额不能为负数",
+			})
+			return
+		}
+
+		if request.RPM == 0 && request.TPM == 0 {
+			delete(channel.ChannelInfo.MultiKeyLimits, keyIndex)
+		} else {
+			if channel.ChannelInfo.MultiKeyLimits == nil {
+				channel.ChannelInfo.MultiKeyLimits = make(map[int]model.MultiKeyLimit)
+			}
+			channel.ChannelInfo.MultiKeyLimits[keyIndex] = model.MultiKeyLimit{RPM: request.RPM, TPM: request.TPM}
+		}
+
+		err = channel.Update()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		model.InitChannelCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "密钥限额已更新",
+		})
+		return
+
 	case "enable_all_keys":
 		// 清空所有禁用状态，使所有密钥回到默认启用状态
 		var enabledCount int
@@ -1829,6 +1901,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var newLimits = make(map[int]model.MultiKeyLimit)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1838,6 +1911,9 @@ func ManageMultiKeys(c *gin.Context) {
 			}
 
 			remainingKeys = append(remainingKeys, key)
+			if limit, exists := channel.ChannelInfo.MultiKeyLimits[i]; exists {
+				newLimits[newIndex] = limit
+			}
 
 			// 保留其他密钥的状态信息，重新索引
 			if channel.ChannelInfo.MultiKeyStatusList != nil {
@@ -1872,6 +1948,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.MultiKeyLimits = newLimits
 
 		err = channel.Update()
 		if err != nil {
@@ -1879,6 +1956,8 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
+		// 密钥已重新索引，旧的用量计数不再对应
+		keyusage.ResetChannel(channel.Id)
 		model.InitChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -1893,6 +1972,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var newLimits = make(map[int]model.MultiKeyLimit)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1908,6 +1988,9 @@ func ManageMultiKeys(c *gin.Context) {
 				deletedCount++
 			} else {
 				remainingKeys = append(remainingKeys, key)
+				if limit, exists := channel.ChannelInfo.MultiKeyLimits[i]; exists {
+					newLimits[newIndex] = limit
+				}
 				// 保留非自动禁用密钥的状态信息，重新索引
 				if status != 1 {
 					newStatusList[newIndex] = status
@@ -1940,6 +2023,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.MultiKeyLimits = newLimits
 
 		err = channel.Update()
 		if err != nil {
@@ -1947,6 +2031,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
+		keyusage.ResetChannel(channel.Id)
 		model.InitChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
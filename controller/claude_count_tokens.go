@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// claudeApiError writes an error in the Anthropic API error shape.
+func claudeApiError(c *gin.Context, status int, errType string, message string) {
+	c.JSON(status, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    errType,
+			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+		},
+	})
+}
+
+// ClaudeCountTokens handles POST /v1/messages/count_tokens. It is free of
+// charge, like the upstream endpoint.
+func ClaudeCountTokens(c *gin.Context) {
+	var request dto.ClaudeRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request body")
+		return
+	}
+	if request.Model == "" {
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", "model: Field required")
+		return
+	}
+	if len(request.Messages) == 0 {
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", "messages: Field required")
+		return
+	}
+	info := relaycommon.GenRelayInfoClaude(c, &request)
+	tokens, newAPIError := relay.ClaudeCountTokensHelper(c, info, &request)
+	if newAPIError != nil {
+		claudeApiError(c, newAPIError.StatusCode, "api_error", newAPIError.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"input_tokens": tokens})
+}
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultClaudeMessageBatchListLimit = 20
+	maxClaudeMessageBatchListLimit     = 1000
+)
+
+type createClaudeMessageBatchRequest struct {
+	Requests []service.ClaudeMessageBatchRequest `json:"requests"`
+}
+
+func checkClaudeMessageBatchEnabled(c *gin.Context) bool {
+	if !operation_setting.IsBatchApiEnabled() {
+		claudeApiError(c, http.StatusNotImplemented, "api_error", "Message Batches are not enabled")
+		return false
+	}
+	return true
+}
+
+// getRequestClaudeMessageBatch loads the message batch referenced by :id and
+// writes a 404 when it does not belong to the caller.
+func getRequestClaudeMessageBatch(c *gin.Context) (*model.Batch, bool) {
+	batch, err := model.GetUserBatchByBatchId(c.GetInt("id"), c.Param("id"))
+	if err == nil && !batch.IsClaudeMessageBatch() {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			claudeApiError(c, http.StatusNotFound, "not_found_error", fmt.Sprintf("No message batch found with id '%s'.", c.Param("id")))
+		} else {
+			claudeApiError(c, http.StatusInternalServerError, "api_error", "Failed to query message batch")
+		}
+		return nil, false
+	}
+	return batch, true
+}
+
+// CreateClaudeMessageBatch handles POST /v1/messages/batches. The requests are
+// stored as a batch input file and executed by the batch_execution system task.
+func CreateClaudeMessageBatch(c *gin.Context) {
+	if !checkClaudeMessageBatchEnabled(c) {
+		return
+	}
+	var req createClaudeMessageBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request body")
+		return
+	}
+	if len(req.Requests) == 0 {
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", "requests: Field required")
+		return
+	}
+	content, total, errs := service.BuildClaudeMessageBatchInput(req.Requests)
+	if len(errs) > 0 {
+		message := errs[0].Message
+		if errs[0].Line != nil {
+			message = fmt.Sprintf("requests.%d: %s", *errs[0].Line-1, message)
+		}
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", message)
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          service.NewClaudeMessageBatchId(),
+		UserId:           c.GetInt("id"),
+		TokenId:          c.GetInt("token_id"),
+		Group:            common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		Endpoint:         model.BatchEndpointClaudeMessages,
+		CompletionWindow: service.BatchCompletionWindow,
+		Status:           model.BatchStatusValidating,
+		Mode:             model.BatchModeLocal,
+		TotalCount:       total,
+		CreatedAt:        now,
+		ExpiresAt:        service.BatchCompletionDeadline(now),
+	}
+	if err := service.StoreClaudeMessageBatchInput(c.Request.Context(), batch, content); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to store message batch input: %s", err.Error()))
+		claudeApiError(c, http.StatusInternalServerError, "api_error", "Failed to create message batch")
+		return
+	}
+	if err := batch.Insert(); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to create message batch: %s", err.Error()))
+		claudeApiError(c, http.StatusInternalServerError, "api_error", "Failed to create message batch")
+		return
+	}
+	if _, _, err := service.EnqueueSystemTask(model.SystemTaskTypeBatchExecution, nil); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to enqueue batch execution task: %s", err.Error()))
+	}
+	c.JSON(http.StatusOK, service.ToClaudeMessageBatchObject(batch))
+}
+
+// RetrieveClaudeMessageBatch handles GET /v1/messages/batches/:id.
+func RetrieveClaudeMessageBatch(c *gin.Context) {
+	if !checkClaudeMessageBatchEnabled(c) {
+		return
+	}
+	batch, ok := getRequestClaudeMessageBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.ToClaudeMessageBatchObject(batch))
+}
+
+// ListClaudeMessageBatches handles GET /v1/messages/batches, newest first.
+func ListClaudeMessageBatches(c *gin.Context) {
+	if !checkClaudeMessageBatchEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultClaudeMessageBatchListLimit
+	}
+	if limit > maxClaudeMessageBatchListLimit {
+		limit = maxClaudeMessageBatchListLimit
+	}
+	batches, err := model.ListUserBatches(c.GetInt("id"), true, c.Query("after_id"), limit)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			claudeApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid 'after_id' cursor")
+			return
+		}
+		claudeApiError(c, http.StatusInternalServerError, "api_error", "Failed to list message batches")
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]service.ClaudeMessageBatchObject, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, service.ToClaudeMessageBatchObject(batch))
+	}
+	resp := gin.H{
+		"data":     data,
+		"has_more": hasMore,
+		"first_id": nil,
+		"last_id":  nil,
+	}
+	if len(data) > 0 {
+		resp["first_id"] = data[0].Id
+		resp["last_id"] = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CancelClaudeMessageBatch handles POST /v1/messages/batches/:id/cancel.
+// Requests that have not run yet end up as "canceled" in the results.
+func CancelClaudeMessageBatch(c *gin.Context) {
+	if !checkClaudeMessageBatchEnabled(c) {
+		return
+	}
+	batch, ok := getRequestClaudeMessageBatch(c)
+	if !ok {
+		return
+	}
+	updated, err := model.MarkBatchCancelling(batch.Id)
+	if err != nil {
+		claudeApiError(c, http.StatusInternalServerError, "api_error", "Failed to cancel message batch")
+		return
+	}
+	if !updated && batch.Status != model.BatchStatusCancelling {
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Message batch %s has already ended.", batch.BatchId))
+		return
+	}
+	if latest, err := model.GetBatchById(batch.Id); err == nil {
+		batch = latest
+	}
+	if _, _, err := service.EnqueueSystemTask(model.SystemTaskTypeBatchExecution, nil); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to enqueue batch execution task: %s", err.Error()))
+	}
+	c.JSON(http.StatusOK, service.ToClaudeMessageBatchObject(batch))
+}
+
+// DeleteClaudeMessageBatch handles DELETE /v1/messages/batches/:id. Only
+// ended batches can be deleted.
+func DeleteClaudeMessageBatch(c *gin.Context) {
+	if !checkClaudeMessageBatchEnabled(c) {
+		return
+	}
+	batch, ok := getRequestClaudeMessageBatch(c)
+	if !ok {
+		return
+	}
+	if !service.IsClaudeMessageBatchEnded(batch) {
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Message batch %s cannot be deleted while it is still processing.", batch.BatchId))
+		return
+	}
+	if err := service.DeleteClaudeMessageBatch(c.Request.Context(), batch); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to delete message batch %s: %s", batch.BatchId, err.Error()))
+		claudeApiError(c, http.StatusInternalServerError, "api_error", "Failed to delete message batch")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":   batch.BatchId,
+		"type": "message_batch_deleted",
+	})
+}
+
+// RetrieveClaudeMessageBatchResults handles GET /v1/messages/batches/:id/results
+// and streams one JSONL line per request once the batch has ended.
+func RetrieveClaudeMessageBatchResults(c *gin.Context) {
+	if !checkClaudeMessageBatchEnabled(c) {
+		return
+	}
+	batch, ok := getRequestClaudeMessageBatch(c)
+	if !ok {
+		return
+	}
+	if !service.IsClaudeMessageBatchEnded(batch) {
+		claudeApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Message batch %s has not ended yet; results are not available.", batch.BatchId))
+		return
+	}
+	results, err := service.ReadClaudeMessageBatchResults(c.Request.Context(), batch)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, service.ErrStoredObjectNotFound) {
+			claudeApiError(c, http.StatusNotFound, "not_found_error", "Message batch results are no longer available.")
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("failed to read message batch %s results: %s", batch.BatchId, err.Error()))
+		claudeApiError(c, http.StatusInternalServerError, "api_error", "Failed to read message batch results")
+		return
+	}
+	c.Data(http.StatusOK, "application/x-jsonl", results)
+}
@@ -0,0 +1,277 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultFileListLimit = 10000
+	maxFileListLimit     = 10000
+)
+
+// fileApiError returns an OpenAI-style error response for the Files API.
+func fileApiError(c *gin.Context, status int, errType string, message string) {
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			"type":    errType,
+			"param":   nil,
+			"code":    nil,
+		},
+	})
+}
+
+func checkFileApiEnabled(c *gin.Context) bool {
+	if !operation_setting.IsFileApiEnabled() {
+		RelayNotImplemented(c)
+		return false
+	}
+	return true
+}
+
+// getRequestUserFile loads the file referenced by :id and writes a 404 when
+// it does not belong to the caller.
+func getRequestUserFile(c *gin.Context) (*model.File, bool) {
+	file, err := model.GetUserFileByFileId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to query file")
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+// UploadFile handles POST /v1/files.
+func UploadFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	userId := c.GetInt("id")
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+
+	purpose := strings.TrimSpace(c.PostForm("purpose"))
+	if !service.IsSupportedFilePurpose(purpose) {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid purpose %q, expected one of: %s", purpose, strings.Join(service.SupportedFilePurposes, ", ")))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Missing required parameter: 'file'")
+		return
+	}
+	if err := service.CheckUserFileStorageLimit(userId, header.Size); err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	expiresAt := int64(0)
+	if seconds, _ := strconv.ParseInt(c.PostForm("expires_after[seconds]"), 10, 64); seconds > 0 {
+		expiresAt = common.GetTimestamp() + seconds
+	} else if days := operation_setting.GetFileSetting().DefaultExpireDays; days > 0 {
+		expiresAt = common.GetTimestamp() + int64(days)*24*3600
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Failed to read uploaded file")
+		return
+	}
+	defer src.Close()
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	file := &model.File{
+		UserId:      userId,
+		TokenId:     c.GetInt("token_id"),
+		Filename:    header.Filename,
+		Purpose:     purpose,
+		Bytes:       header.Size,
+		ContentType: contentType,
+		ExpiresAt:   expiresAt,
+	}
+	session, apiErr := service.PreConsumeFileStorageQuota(c, file, group)
+	if apiErr != nil {
+		fileApiError(c, http.StatusForbidden, "insufficient_quota", apiErr.Error())
+		return
+	}
+	if err := service.StoreUserFile(c.Request.Context(), file, src); err != nil {
+		service.RefundFileStorageQuota(c, session)
+		logger.LogError(c, fmt.Sprintf("failed to store file: %s", err.Error()))
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to store file")
+		return
+	}
+
+	// 可选：透传到将来消费该文件的模型所在渠道，后续引用该文件的请求会被固定到此渠道
+	if modelName := strings.TrimSpace(c.PostForm("model")); modelName != "" && operation_setting.GetFileSetting().PassThroughEnabled {
+		if err := passThroughUploadedFile(c, file, modelName, group); err != nil {
+			service.RefundFileStorageQuota(c, session)
+			_ = service.DeleteUserFile(c.Request.Context(), file)
+			fileApiError(c, http.StatusBadGateway, "upstream_error", fmt.Sprintf("Failed to upload file to upstream: %s", err.Error()))
+			return
+		}
+	}
+
+	if err := service.SettleFileStorageQuota(c, session, file, group); err != nil {
+		service.RefundFileStorageQuota(c, session)
+		_ = service.DeleteUserFile(c.Request.Context(), file)
+		fileApiError(c, http.StatusForbidden, "insufficient_quota", err.Error())
+		return
+	}
+	if file.Quota > 0 {
+		if err := file.Update(); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to update file quota: %s", err.Error()))
+		}
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIFileObject(file))
+}
+
+func passThroughUploadedFile(c *gin.Context, file *model.File, modelName string, group string) error {
+	var channel *model.Channel
+	if specificChannelId := c.GetString("specific_channel_id"); specificChannelId != "" {
+		id, err := strconv.Atoi(specificChannelId)
+		if err != nil {
+			return err
+		}
+		channel, err = model.CacheGetChannel(id)
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		channel, err = service.SelectFilePassThroughChannel(c, modelName, group)
+		if err != nil {
+			return err
+		}
+	}
+	upstreamId, err := service.PassThroughFileToChannel(c.Request.Context(), file, channel)
+	if err != nil {
+		return err
+	}
+	// 对外暴露上游文件 id，客户端在后续请求里引用它时无需改写请求体
+	file.FileId = upstreamId
+	file.UpstreamFileId = upstreamId
+	file.ChannelId = channel.Id
+	return file.Update()
+}
+
+// ListFiles handles GET /v1/files.
+func ListFiles(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultFileListLimit
+	}
+	if limit > maxFileListLimit {
+		limit = maxFileListLimit
+	}
+	files, err := model.ListUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit, c.Query("order") == "asc")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid 'after' cursor")
+			return
+		}
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to list files")
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	data := make([]service.OpenAIFileObject, 0, len(files))
+	for _, file := range files {
+		data = append(data, service.ToOpenAIFileObject(file))
+	}
+	resp := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	}
+	if len(data) > 0 {
+		resp["first_id"] = data[0].Id
+		resp["last_id"] = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RetrieveFile handles GET /v1/files/:id.
+func RetrieveFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file, ok := getRequestUserFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIFileObject(file))
+}
+
+// RetrieveFileContent handles GET /v1/files/:id/content.
+func RetrieveFileContent(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file, ok := getRequestUserFile(c)
+	if !ok {
+		return
+	}
+	reader, err := service.OpenUserFileContent(c.Request.Context(), file)
+	if err != nil {
+		if errors.Is(err, service.ErrStoredObjectNotFound) {
+			fileApiError(c, http.StatusNotFound, "invalid_request_error", "File content not found")
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("failed to open file %s: %s", file.FileId, err.Error()))
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to read file content")
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Type", file.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to write file content %s: %s", file.FileId, err.Error()))
+	}
+}
+
+// DeleteFile handles DELETE /v1/files/:id.
+func DeleteFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file, ok := getRequestUserFile(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteUserFile(c.Request.Context(), file); err != nil {
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to delete file")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.FileId,
+		"object":  "file",
+		"deleted": true,
+	})
+}
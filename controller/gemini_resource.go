@@ -0,0 +1,634 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultGeminiResourcePageSize = 10
+	maxGeminiResourcePageSize     = 100
+
+	// resumable upload sessions stay valid upstream for about a week
+	geminiUploadSessionTTL = 7 * 24 * 3600
+
+	maxGeminiResourceResponseBytes = 16 << 20
+)
+
+// geminiApiError returns a Google-style error response.
+func geminiApiError(c *gin.Context, status int, message string) {
+	var googleStatus string
+	switch status {
+	case http.StatusBadRequest:
+		googleStatus = "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		googleStatus = "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		googleStatus = "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		googleStatus = "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		googleStatus = "RESOURCE_EXHAUSTED"
+	case http.StatusNotImplemented:
+		googleStatus = "UNIMPLEMENTED"
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		googleStatus = "UNAVAILABLE"
+	default:
+		googleStatus = "INTERNAL"
+	}
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"code":    status,
+			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			"status":  googleStatus,
+		},
+	})
+}
+
+func checkGeminiFilesApiEnabled(c *gin.Context) bool {
+	if !model_setting.GetGeminiSettings().FilesApiEnabled {
+		geminiApiError(c, http.StatusNotImplemented, "Gemini Files API and cachedContents are not enabled")
+		return false
+	}
+	return true
+}
+
+// getRequestGeminiResource loads the caller's resource and writes a 404 when
+// it does not exist or belongs to someone else.
+func getRequestGeminiResource(c *gin.Context, kind string, name string) (*model.GeminiResource, bool) {
+	resource, err := service.GetUserGeminiResource(c.GetInt("id"), kind, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, service.ErrGeminiResourceNotFound) {
+			geminiApiError(c, http.StatusNotFound, "Requested entity was not found.")
+		} else {
+			geminiApiError(c, http.StatusInternalServerError, "Failed to query resource")
+		}
+		return nil, false
+	}
+	return resource, true
+}
+
+func getGeminiResourceTarget(c *gin.Context, resource *model.GeminiResource) (*relay.GeminiResourceTarget, bool) {
+	target, err := relay.GetGeminiResourceTarget(resource)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("channel of %s is unavailable: %s", resource.Name, err.Error()))
+		geminiApiError(c, http.StatusServiceUnavailable, "The channel holding this resource is unavailable")
+		return nil, false
+	}
+	return target, true
+}
+
+// doGeminiResourceRequest sends the request upstream and reads the whole
+// (small, JSON) response. It writes a 502 and returns false on failure.
+func doGeminiResourceRequest(c *gin.Context, target *relay.GeminiResourceTarget, method string, rawURL string, query url.Values, header http.Header, body io.Reader, contentLength int64) (*http.Response, []byte, bool) {
+	resp, err := target.Do(c.Request.Context(), method, rawURL, query, header, body, contentLength)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("gemini resource request to channel #%d failed: %s", target.Channel.Id, err.Error()))
+		geminiApiError(c, http.StatusBadGateway, "Failed to reach the upstream service")
+		return nil, nil, false
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxGeminiResourceResponseBytes))
+	if err != nil {
+		geminiApiError(c, http.StatusBadGateway, "Failed to read the upstream response")
+		return nil, nil, false
+	}
+	return resp, respBody, true
+}
+
+func writeGeminiUpstreamResponse(c *gin.Context, resp *http.Response, body []byte) {
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.Status(resp.StatusCode)
+	_, _ = c.Writer.Write(body)
+}
+
+func jsonRequestHeader() http.Header {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return header
+}
+
+func readGeminiRequestBody(c *gin.Context) ([]byte, bool) {
+	storage, err := common.GetBodyStorage(c)
+	if err == nil {
+		var body []byte
+		if body, err = storage.Bytes(); err == nil {
+			return body, true
+		}
+	}
+	if common.IsRequestBodyTooLargeError(err) {
+		geminiApiError(c, http.StatusRequestEntityTooLarge, "Request body is too large")
+	} else {
+		geminiApiError(c, http.StatusBadRequest, "Invalid request body")
+	}
+	return nil, false
+}
+
+// listGeminiResources serves the list endpoints from the gateway's own records,
+// so a caller only ever sees what it created.
+func listGeminiResources(c *gin.Context, kind string, field string) {
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+	if pageSize <= 0 {
+		pageSize = defaultGeminiResourcePageSize
+	}
+	if pageSize > maxGeminiResourcePageSize {
+		pageSize = maxGeminiResourcePageSize
+	}
+	afterId := 0
+	if pageToken := c.Query("pageToken"); pageToken != "" {
+		var err error
+		if afterId, err = strconv.Atoi(pageToken); err != nil || afterId <= 0 {
+			geminiApiError(c, http.StatusBadRequest, "Invalid page token")
+			return
+		}
+	}
+	resources, err := model.ListUserGeminiResources(c.GetInt("id"), kind, afterId, pageSize)
+	if err != nil {
+		geminiApiError(c, http.StatusInternalServerError, "Failed to list resources")
+		return
+	}
+	hasMore := len(resources) > pageSize
+	if hasMore {
+		resources = resources[:pageSize]
+	}
+	items := make([]json.RawMessage, 0, len(resources))
+	for _, resource := range resources {
+		if resource.Metadata != "" {
+			items = append(items, json.RawMessage(resource.Metadata))
+		}
+	}
+	resp := gin.H{field: items}
+	if hasMore {
+		resp["nextPageToken"] = strconv.Itoa(resources[len(resources)-1].Id)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// deleteGeminiResource deletes the resource upstream and drops the record once
+// the upstream no longer has it.
+func deleteGeminiResource(c *gin.Context, resource *model.GeminiResource) {
+	target, ok := getGeminiResourceTarget(c, resource)
+	if !ok {
+		return
+	}
+	resp, body, ok := doGeminiResourceRequest(c, target, http.MethodDelete, target.ResourceURL(resource.UpstreamName), nil, nil, nil, 0)
+	if !ok {
+		return
+	}
+	if resp.StatusCode/100 == 2 || resp.StatusCode == http.StatusNotFound {
+		if err := model.DeleteGeminiResourceById(resource.Id); err != nil {
+			logger.LogError(c, fmt.Sprintf("failed to delete record of %s: %s", resource.Name, err.Error()))
+		}
+	}
+	writeGeminiUpstreamResponse(c, resp, body)
+}
+
+// ---------------------------------------------------------------------------
+// Files API
+// ---------------------------------------------------------------------------
+
+// gatewayBaseURL is the address the client reached the gateway on, used to
+// point resumable upload URLs back at the gateway.
+func gatewayBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	host := c.GetHeader("X-Forwarded-Host")
+	if host == "" {
+		host = c.Request.Host
+	}
+	return scheme + "://" + host
+}
+
+func isGeminiUploadHeader(key string) bool {
+	return strings.HasPrefix(strings.ToLower(key), "x-goog-upload-")
+}
+
+// GeminiUploadFile handles POST /upload/v1beta/files: simple and multipart
+// uploads as well as both phases of a resumable upload. The resumable session
+// URL is rewritten to the gateway and remembered per user, so the chunks land
+// on the channel that started the session.
+func GeminiUploadFile(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	userId := c.GetInt("id")
+	var target *relay.GeminiResourceTarget
+	var upload *model.GeminiResource
+	if uploadId := c.Query("upload_id"); uploadId != "" {
+		var err error
+		upload, err = model.GetUserGeminiResource(userId, model.GeminiResourceKindUpload, uploadId)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				geminiApiError(c, http.StatusNotFound, "Upload session was not found.")
+			} else {
+				geminiApiError(c, http.StatusInternalServerError, "Failed to query upload session")
+			}
+			return
+		}
+		var ok bool
+		if target, ok = getGeminiResourceTarget(c, upload); !ok {
+			return
+		}
+	} else {
+		modelName := strings.TrimPrefix(c.Query("model"), "models/")
+		if modelName == "" {
+			modelName = model_setting.GetGeminiSettings().FilesUploadModel
+		}
+		var err error
+		target, err = relay.SelectGeminiResourceTarget(c, model.GeminiResourceKindFile, modelName, nil)
+		if err != nil {
+			geminiApiError(c, http.StatusServiceUnavailable, fmt.Sprintf("No Gemini channel is available for file uploads: %s", err.Error()))
+			return
+		}
+	}
+
+	header := http.Header{}
+	for key, values := range c.Request.Header {
+		if isGeminiUploadHeader(key) || strings.EqualFold(key, "Content-Type") {
+			header[key] = values
+		}
+	}
+	query := c.Request.URL.Query()
+	query.Del("model")
+	// the body is streamed so large media does not have to be buffered
+	resp, body, ok := doGeminiResourceRequest(c, target, http.MethodPost, target.ApiURL("upload/v1beta/files"), query, header, c.Request.Body, c.Request.ContentLength)
+	if !ok {
+		return
+	}
+	for key, values := range resp.Header {
+		if isGeminiUploadHeader(key) {
+			c.Writer.Header()[key] = values
+		}
+	}
+	if resp.StatusCode/100 == 2 {
+		if uploadURL := resp.Header.Get("X-Goog-Upload-URL"); uploadURL != "" {
+			rewritten, err := recordGeminiUploadSession(c, target, uploadURL)
+			if err != nil {
+				logger.LogError(c, fmt.Sprintf("failed to record upload session: %s", err.Error()))
+				geminiApiError(c, http.StatusInternalServerError, "Failed to start upload session")
+				return
+			}
+			c.Header("X-Goog-Upload-URL", rewritten)
+		}
+		if file := gjson.GetBytes(body, "file"); file.IsObject() && file.Get("name").String() != "" {
+			if err := recordGeminiFile(c, target, upload, []byte(file.Raw)); err != nil {
+				logger.LogError(c, fmt.Sprintf("failed to record uploaded file: %s", err.Error()))
+				geminiApiError(c, http.StatusInternalServerError, "Failed to record uploaded file")
+				return
+			}
+		}
+	}
+	writeGeminiUpstreamResponse(c, resp, body)
+}
+
+func recordGeminiUploadSession(c *gin.Context, target *relay.GeminiResourceTarget, uploadURL string) (string, error) {
+	parsed, err := url.Parse(uploadURL)
+	if err != nil {
+		return "", err
+	}
+	uploadId := parsed.Query().Get("upload_id")
+	if uploadId == "" {
+		return "", fmt.Errorf("upload url without upload_id: %s", uploadURL)
+	}
+	upload := &model.GeminiResource{
+		UserId:    c.GetInt("id"),
+		TokenId:   c.GetInt("token_id"),
+		Group:     target.Group,
+		Kind:      model.GeminiResourceKindUpload,
+		Name:      uploadId,
+		ChannelId: target.Channel.Id,
+		KeyIndex:  target.KeyIndex,
+		ExpiresAt: common.GetTimestamp() + geminiUploadSessionTTL,
+	}
+	if err := upload.Insert(); err != nil {
+		return "", err
+	}
+	return gatewayBaseURL(c) + "/upload/v1beta/files?" + parsed.RawQuery, nil
+}
+
+// recordGeminiFile records a finished upload; a resumable session record is
+// turned into the file record.
+func recordGeminiFile(c *gin.Context, target *relay.GeminiResourceTarget, upload *model.GeminiResource, object []byte) error {
+	if upload != nil {
+		upload.Kind = model.GeminiResourceKindFile
+		service.ApplyGeminiFileObject(upload, object)
+		return upload.Update()
+	}
+	file := &model.GeminiResource{
+		UserId:    c.GetInt("id"),
+		TokenId:   c.GetInt("token_id"),
+		Group:     target.Group,
+		Kind:      model.GeminiResourceKindFile,
+		ChannelId: target.Channel.Id,
+		KeyIndex:  target.KeyIndex,
+	}
+	service.ApplyGeminiFileObject(file, object)
+	return file.Insert()
+}
+
+// ListGeminiFiles handles GET /v1beta/files.
+func ListGeminiFiles(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	listGeminiResources(c, model.GeminiResourceKindFile, "files")
+}
+
+// GetGeminiFile handles GET /v1beta/files/:name and refreshes the stored
+// metadata (processing state, expiration) from upstream.
+func GetGeminiFile(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	resource, ok := getRequestGeminiResource(c, model.GeminiResourceKindFile, "files/"+c.Param("name"))
+	if !ok {
+		return
+	}
+	target, ok := getGeminiResourceTarget(c, resource)
+	if !ok {
+		return
+	}
+	resp, body, ok := doGeminiResourceRequest(c, target, http.MethodGet, target.ResourceURL(resource.UpstreamName), nil, nil, nil, 0)
+	if !ok {
+		return
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		service.ApplyGeminiFileObject(resource, body)
+		if err := resource.Update(); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to update record of %s: %s", resource.Name, err.Error()))
+		}
+	case resp.StatusCode == http.StatusNotFound:
+		_ = model.DeleteGeminiResourceById(resource.Id)
+	}
+	writeGeminiUpstreamResponse(c, resp, body)
+}
+
+// DeleteGeminiFile handles DELETE /v1beta/files/:name.
+func DeleteGeminiFile(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	resource, ok := getRequestGeminiResource(c, model.GeminiResourceKindFile, "files/"+c.Param("name"))
+	if !ok {
+		return
+	}
+	deleteGeminiResource(c, resource)
+}
+
+// ---------------------------------------------------------------------------
+// cachedContents
+// ---------------------------------------------------------------------------
+
+// checkGeminiTokenModelLimit applies the token's model whitelist, which the
+// distributor would enforce for generateContent.
+func checkGeminiTokenModelLimit(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	limit, _ := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	if limit[ratio_setting.FormatMatchingModelName(modelName)] {
+		return true
+	}
+	geminiApiError(c, http.StatusForbidden, fmt.Sprintf("This token has no access to model %s", modelName))
+	return false
+}
+
+// CreateGeminiCachedContent handles POST /v1beta/cachedContents. The cache is
+// created on the channel of any file it references and its storage until
+// expireTime is pre-consumed before the upstream call, then settled against the
+// token count the upstream reports.
+func CreateGeminiCachedContent(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	body, ok := readGeminiRequestBody(c)
+	if !ok {
+		return
+	}
+	modelName := strings.TrimPrefix(gjson.GetBytes(body, "model").String(), "models/")
+	if modelName == "" {
+		geminiApiError(c, http.StatusBadRequest, "model is required")
+		return
+	}
+	if !checkGeminiTokenModelLimit(c, modelName) {
+		return
+	}
+	pin, err := service.ResolveGeminiResourcePin(c.GetInt("id"), body)
+	if err != nil {
+		if errors.Is(err, service.ErrGeminiResourceNotFound) {
+			geminiApiError(c, http.StatusNotFound, "Requested entity was not found.")
+		} else {
+			geminiApiError(c, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	target, err := relay.SelectGeminiResourceTarget(c, model.GeminiResourceKindCachedContent, modelName, pin)
+	if err != nil {
+		geminiApiError(c, http.StatusServiceUnavailable, fmt.Sprintf("No channel is available for model %s: %s", modelName, err.Error()))
+		return
+	}
+
+	upstreamModel := relay.MapGeminiResourceModel(target.Channel, modelName)
+	createURL := target.ApiURL("v1beta/cachedContents")
+	modelPath := "models/" + upstreamModel
+	if target.IsVertex() {
+		if modelPath, createURL, err = target.VertexCachedContentModel(modelName, upstreamModel); err != nil {
+			logger.LogError(c, fmt.Sprintf("failed to build vertex cachedContents request: %s", err.Error()))
+			geminiApiError(c, http.StatusInternalServerError, "Failed to build upstream request")
+			return
+		}
+	}
+	if body, err = sjson.SetBytes(body, "model", modelPath); err != nil {
+		geminiApiError(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	resource := &model.GeminiResource{
+		UserId:    c.GetInt("id"),
+		TokenId:   c.GetInt("token_id"),
+		Group:     target.Group,
+		Kind:      model.GeminiResourceKindCachedContent,
+		ChannelId: target.Channel.Id,
+		KeyIndex:  target.KeyIndex,
+		Model:     modelName,
+	}
+	session, apiErr := service.PreConsumeGeminiCacheStorageQuota(c, resource, body)
+	if apiErr != nil {
+		geminiApiError(c, apiErr.StatusCode, apiErr.Error())
+		return
+	}
+	resp, respBody, ok := doGeminiResourceRequest(c, target, http.MethodPost, createURL, nil, jsonRequestHeader(), bytes.NewReader(body), int64(len(body)))
+	if !ok {
+		service.RefundGeminiCacheStorageQuota(c, session)
+		return
+	}
+	if resp.StatusCode/100 != 2 {
+		service.RefundGeminiCacheStorageQuota(c, session)
+		writeGeminiUpstreamResponse(c, resp, respBody)
+		return
+	}
+
+	service.ApplyGeminiCachedContentObject(resource, respBody)
+	if err := service.SettleGeminiCacheStorageQuota(c, session, resource); err != nil {
+		service.RefundGeminiCacheStorageQuota(c, session)
+		deleteUpstreamGeminiResource(c, target, resource)
+		geminiApiError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err := resource.Insert(); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to record cached content %s: %s", resource.Name, err.Error()))
+		deleteUpstreamGeminiResource(c, target, resource)
+		geminiApiError(c, http.StatusInternalServerError, "Failed to record cached content")
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(resource.Metadata))
+}
+
+// deleteUpstreamGeminiResource is a best-effort rollback of a resource that
+// could not be recorded or paid for.
+func deleteUpstreamGeminiResource(c *gin.Context, target *relay.GeminiResourceTarget, resource *model.GeminiResource) {
+	resp, err := target.Do(c.Request.Context(), http.MethodDelete, target.ResourceURL(resource.UpstreamName), nil, nil, nil, 0)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to roll back %s on channel #%d: %s", resource.UpstreamName, target.Channel.Id, err.Error()))
+		return
+	}
+	service.CloseResponseBodyGracefully(resp)
+}
+
+// ListGeminiCachedContents handles GET /v1beta/cachedContents.
+func ListGeminiCachedContents(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	listGeminiResources(c, model.GeminiResourceKindCachedContent, "cachedContents")
+}
+
+// GetGeminiCachedContent handles GET /v1beta/cachedContents/:name.
+func GetGeminiCachedContent(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	resource, ok := getRequestGeminiResource(c, model.GeminiResourceKindCachedContent, "cachedContents/"+c.Param("name"))
+	if !ok {
+		return
+	}
+	target, ok := getGeminiResourceTarget(c, resource)
+	if !ok {
+		return
+	}
+	resp, body, ok := doGeminiResourceRequest(c, target, http.MethodGet, target.ResourceURL(resource.UpstreamName), nil, nil, nil, 0)
+	if !ok {
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		service.ApplyGeminiCachedContentObject(resource, body)
+		if err := resource.Update(); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to update record of %s: %s", resource.Name, err.Error()))
+		}
+		c.Data(http.StatusOK, "application/json", []byte(resource.Metadata))
+		return
+	case http.StatusNotFound:
+		_ = model.DeleteGeminiResourceById(resource.Id)
+	}
+	writeGeminiUpstreamResponse(c, resp, body)
+}
+
+// UpdateGeminiCachedContent handles PATCH /v1beta/cachedContents/:name. Only
+// the TTL can change upstream; the added hours are pre-consumed before the
+// PATCH and the expiry is rolled back when settlement fails.
+func UpdateGeminiCachedContent(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	resource, ok := getRequestGeminiResource(c, model.GeminiResourceKindCachedContent, "cachedContents/"+c.Param("name"))
+	if !ok {
+		return
+	}
+	target, ok := getGeminiResourceTarget(c, resource)
+	if !ok {
+		return
+	}
+	body, ok := readGeminiRequestBody(c)
+	if !ok {
+		return
+	}
+	session, apiErr := service.PreConsumeGeminiCacheStorageQuota(c, resource, body)
+	if apiErr != nil {
+		geminiApiError(c, apiErr.StatusCode, apiErr.Error())
+		return
+	}
+	resourceURL := target.ResourceURL(resource.UpstreamName)
+	resp, respBody, ok := doGeminiResourceRequest(c, target, http.MethodPatch, resourceURL, c.Request.URL.Query(), jsonRequestHeader(), bytes.NewReader(body), int64(len(body)))
+	if !ok {
+		service.RefundGeminiCacheStorageQuota(c, session)
+		return
+	}
+	if resp.StatusCode/100 != 2 {
+		service.RefundGeminiCacheStorageQuota(c, session)
+		writeGeminiUpstreamResponse(c, resp, respBody)
+		return
+	}
+	previousExpiresAt := resource.ExpiresAt
+	service.ApplyGeminiCachedContentObject(resource, respBody)
+	if err := service.SettleGeminiCacheStorageQuota(c, session, resource); err != nil {
+		service.RefundGeminiCacheStorageQuota(c, session)
+		restoreGeminiCachedContentExpiry(c, target, resourceURL, previousExpiresAt)
+		geminiApiError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err := resource.Update(); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to update record of %s: %s", resource.Name, err.Error()))
+	}
+	c.Data(http.StatusOK, "application/json", []byte(resource.Metadata))
+}
+
+func restoreGeminiCachedContentExpiry(c *gin.Context, target *relay.GeminiResourceTarget, resourceURL string, expiresAt int64) {
+	body, _ := common.Marshal(gin.H{"expireTime": time.Unix(expiresAt, 0).UTC().Format(time.RFC3339)})
+	query := url.Values{"updateMask": []string{"expireTime"}}
+	resp, err := target.Do(c.Request.Context(), http.MethodPatch, resourceURL, query, jsonRequestHeader(), bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to restore expiry of %s: %s", resourceURL, err.Error()))
+		return
+	}
+	service.CloseResponseBodyGracefully(resp)
+}
+
+// DeleteGeminiCachedContent handles DELETE /v1beta/cachedContents/:name.
+// Storage already billed is not refunded.
+func DeleteGeminiCachedContent(c *gin.Context) {
+	if !checkGeminiFilesApiEnabled(c) {
+		return
+	}
+	resource, ok := getRequestGeminiResource(c, model.GeminiResourceKindCachedContent, "cachedContents/"+c.Param("name"))
+	if !ok {
+		return
+	}
+	deleteGeminiResource(c, resource)
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/mcp"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Client headers forwarded to the MCP server. Authorization is deliberately
+// not forwarded: it carries the gateway token, and the server's own
+// credentials come from the registry.
+var mcpForwardedRequestHeaders = []string{
+	"Accept",
+	"Content-Type",
+	"Last-Event-ID",
+	mcp.HeaderSessionId,
+	mcp.HeaderProtocolVersion,
+}
+
+var mcpForwardedResponseHeaders = []string{
+	"Content-Type",
+	"Cache-Control",
+	mcp.HeaderSessionId,
+	mcp.HeaderProtocolVersion,
+}
+
+func mcpProxyError(c *gin.Context, status int, id json.RawMessage, code int, message string) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	c.JSON(status, gin.H{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   gin.H{"code": code, "message": message},
+	})
+}
+
+// McpProxy proxies streamable HTTP MCP traffic for /mcp/:name to a registered
+// server. The token's group decides which servers are reachable; tools/call
+// for tools outside the group's allow list is rejected and tools/list
+// responses are filtered accordingly.
+func McpProxy(c *gin.Context) {
+	if !operation_setting.GetMcpSetting().GatewayEnabled {
+		mcpProxyError(c, http.StatusNotFound, nil, -32601, "mcp gateway is disabled")
+		return
+	}
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	server, err := model.GetMcpServerByName(c.Param("name"))
+	if err != nil || !server.AllowsGroup(group) {
+		mcpProxyError(c, http.StatusNotFound, nil, -32601, "mcp server not found")
+		return
+	}
+
+	var body []byte
+	filterToolsList := false
+	if c.Request.Method == http.MethodPost {
+		storage, err := common.GetBodyStorage(c)
+		if err == nil {
+			body, err = storage.Bytes()
+		}
+		if err != nil {
+			mcpProxyError(c, http.StatusBadRequest, nil, -32700, "failed to read request body")
+			return
+		}
+		messages, _, err := mcp.DecodeMessages(body)
+		if err != nil {
+			mcpProxyError(c, http.StatusBadRequest, nil, -32700, "parse error")
+			return
+		}
+		for _, message := range messages {
+			switch message.Method {
+			case mcp.MethodToolsCall:
+				var params mcp.CallToolParams
+				_ = common.Unmarshal(message.Params, &params)
+				if !server.AllowsTool(group, params.Name) {
+					mcpProxyError(c, http.StatusOK, message.ID, mcp.ErrorCodeInvalidParams, fmt.Sprintf("tool %q is not available", params.Name))
+					return
+				}
+			case mcp.MethodToolsList:
+				filterToolsList = true
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, server.ServerUrl, bytes.NewReader(body))
+	if err != nil {
+		mcpProxyError(c, http.StatusInternalServerError, nil, -32603, "failed to build upstream request")
+		return
+	}
+	for _, header := range mcpForwardedRequestHeaders {
+		if value := c.GetHeader(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	for key, value := range server.GetHeaders() {
+		req.Header.Set(key, value)
+	}
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("mcp proxy to %s failed: %s", server.Name, err.Error()))
+		mcpProxyError(c, http.StatusBadGateway, nil, -32603, "mcp server unavailable")
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range mcpForwardedResponseHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			c.Writer.Header().Set(header, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	streaming := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	if filterToolsList && resp.StatusCode == http.StatusOK {
+		writeFilteredMcpToolsList(c, resp.Body, streaming, server, group)
+		return
+	}
+	if !streaming {
+		_, _ = io.Copy(c.Writer, resp.Body)
+		return
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeFilteredMcpToolsList(c *gin.Context, body io.Reader, streaming bool, server *model.McpServer, group string) {
+	if !streaming {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return
+		}
+		_, _ = c.Writer.Write(filterMcpToolsListMessage(data, server, group))
+		return
+	}
+	_ = mcp.ReadSSE(body, func(event string, data []byte) bool {
+		var out strings.Builder
+		if event != "" {
+			out.WriteString("event: " + event + "\n")
+		}
+		out.WriteString("data: ")
+		out.Write(filterMcpToolsListMessage(data, server, group))
+		out.WriteString("\n\n")
+		if _, err := c.Writer.WriteString(out.String()); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	})
+}
+
+// filterMcpToolsListMessage removes tools the group may not call from every
+// tools/list result in a JSON-RPC message or batch. Other messages pass through.
+func filterMcpToolsListMessage(data []byte, server *model.McpServer, group string) []byte {
+	messages, batch, err := mcp.DecodeMessages(data)
+	if err != nil {
+		return data
+	}
+	changed := false
+	for i := range messages {
+		if len(messages[i].Result) == 0 {
+			continue
+		}
+		var result map[string]json.RawMessage
+		if err := common.Unmarshal(messages[i].Result, &result); err != nil {
+			continue
+		}
+		rawTools, ok := result["tools"]
+		if !ok {
+			continue
+		}
+		var tools []json.RawMessage
+		if err := common.Unmarshal(rawTools, &tools); err != nil {
+			continue
+		}
+		allowed := make([]json.RawMessage, 0, len(tools))
+		for _, tool := range tools {
+			var meta mcp.Tool
+			if err := common.Unmarshal(tool, &meta); err == nil && server.AllowsTool(group, meta.Name) {
+				allowed = append(allowed, tool)
+			}
+		}
+		if len(allowed) == len(tools) {
+			continue
+		}
+		if result["tools"], err = common.Marshal(allowed); err != nil {
+			continue
+		}
+		if messages[i].Result, err = common.Marshal(result); err != nil {
+			continue
+		}
+		changed = true
+	}
+	if !changed {
+		return data
+	}
+	var out []byte
+	if batch {
+		out, err = common.Marshal(messages)
+	} else {
+		out, err = common.Marshal(messages[0])
+	}
+	if err != nil {
+		return data
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// McpServerResponse omits header values, which usually carry credentials.
+type McpServerResponse struct {
+	*model.McpServer
+	HeaderNames []string `json:"header_names"`
+}
+
+func toMcpServerResponse(server *model.McpServer) *McpServerResponse {
+	return &McpServerResponse{McpServer: server, HeaderNames: server.HeaderNames()}
+}
+
+// McpServerRequest is shared by create and update. A nil Headers keeps the
+// stored headers on update so admins do not have to re-enter secrets.
+type McpServerRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	ServerUrl   string              `json:"server_url"`
+	Headers     *map[string]string  `json:"headers"`
+	GroupTools  map[string][]string `json:"group_tools"`
+	Status      int                 `json:"status"`
+}
+
+func (r *McpServerRequest) apply(server *model.McpServer) error {
+	server.Name = r.Name
+	server.Description = r.Description
+	server.ServerUrl = r.ServerUrl
+	server.Status = r.Status
+	if r.Headers != nil {
+		headers, err := common.Marshal(*r.Headers)
+		if err != nil {
+			return err
+		}
+		server.Headers = string(headers)
+	}
+	server.GroupTools = ""
+	if len(r.GroupTools) > 0 {
+		groupTools, err := common.Marshal(r.GroupTools)
+		if err != nil {
+			return err
+		}
+		server.GroupTools = string(groupTools)
+	}
+	return nil
+}
+
+func getMcpServerParam(c *gin.Context) (*model.McpServer, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return nil, false
+	}
+	server, err := model.GetMcpServerById(id)
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgMcpServerNotFound)
+		return nil, false
+	}
+	return server, true
+}
+
+func GetMcpServers(c *gin.Context) {
+	servers, err := model.GetAllMcpServers()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	response := make([]*McpServerResponse, len(servers))
+	for i, server := range servers {
+		response[i] = toMcpServerResponse(server)
+	}
+	common.ApiSuccess(c, response)
+}
+
+func GetMcpServer(c *gin.Context) {
+	server, ok := getMcpServerParam(c)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, toMcpServerResponse(server))
+}
+
+func CreateMcpServer(c *gin.Context) {
+	var req McpServerRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if model.IsMcpServerNameTaken(req.Name, 0) {
+		common.ApiErrorI18n(c, i18n.MsgMcpServerNameTaken)
+		return
+	}
+	server := &model.McpServer{}
+	if err := req.apply(server); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := server.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAuditFor(c, 0, "mcp_server.create", map[string]interface{}{
+		"id":   server.Id,
+		"name": server.Name,
+	})
+	common.ApiSuccess(c, toMcpServerResponse(server))
+}
+
+func UpdateMcpServer(c *gin.Context) {
+	server, ok := getMcpServerParam(c)
+	if !ok {
+		return
+	}
+	var req McpServerRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if model.IsMcpServerNameTaken(req.Name, server.Id) {
+		common.ApiErrorI18n(c, i18n.MsgMcpServerNameTaken)
+		return
+	}
+	if err := req.apply(server); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := server.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateMcpToolsCache(server.Id)
+	recordManageAuditFor(c, 0, "mcp_server.update", map[string]interface{}{
+		"id":   server.Id,
+		"name": server.Name,
+	})
+	common.ApiSuccess(c, toMcpServerResponse(server))
+}
+
+func DeleteMcpServer(c *gin.Context) {
+	server, ok := getMcpServerParam(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteMcpServerById(server.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateMcpToolsCache(server.Id)
+	recordManageAuditFor(c, 0, "mcp_server.delete", map[string]interface{}{
+		"id":   server.Id,
+		"name": server.Name,
+	})
+	common.ApiSuccess(c, nil)
+}
+
+// GetMcpServerTools connects to the server and lists its tools, bypassing the
+// cache, so admins can verify the URL and credentials.
+func GetMcpServerTools(c *gin.Context) {
+	server, ok := getMcpServerParam(c)
+	if !ok {
+		return
+	}
+	service.InvalidateMcpToolsCache(server.Id)
+	tools, err := service.ListMcpServerTools(c.Request.Context(), server)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, tools)
+}
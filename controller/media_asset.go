@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MediaAssetContent serves a stored generation result. The signed, expiring
+// URL issued by the gateway is the only credential, so it can be embedded
+// directly in pages or handed to other services.
+func MediaAssetContent(c *gin.Context) {
+	assetId := c.Param("asset_id")
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if !service.VerifyMediaAssetSign(assetId, expires, c.Query("sign")) {
+		videoProxyError(c, http.StatusForbidden, "invalid_request_error", "Invalid or expired asset url")
+		return
+	}
+	asset, exist, err := model.GetMediaAssetByAssetId(assetId)
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to query asset %s: %s", assetId, err.Error()))
+		videoProxyError(c, http.StatusInternalServerError, "server_error", "Failed to query asset")
+		return
+	}
+	if !exist {
+		videoProxyError(c, http.StatusNotFound, "invalid_request_error", "Asset not found")
+		return
+	}
+	if asset.IsPending() {
+		redirectPendingMediaAsset(c, asset)
+		return
+	}
+	if err := serveMediaAsset(c, asset, expires-common.GetTimestamp()); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to open asset %s: %s", assetId, err.Error()))
+		videoProxyError(c, http.StatusNotFound, "invalid_request_error", "Asset not found")
+	}
+}
+
+// redirectPendingMediaAsset sends the caller to the upstream result while a
+// task result reserved for gateway storage is still downloading, or when
+// storing it failed.
+func redirectPendingMediaAsset(c *gin.Context, asset *model.MediaAsset) {
+	if asset.Source == model.MediaAssetSourceTask {
+		task, exist, err := model.GetByTaskId(asset.UserId, asset.SourceId)
+		if err == nil && exist {
+			if resultURL := task.GetResultURL(); strings.HasPrefix(resultURL, "http://") || strings.HasPrefix(resultURL, "https://") {
+				c.Redirect(http.StatusFound, resultURL)
+				return
+			}
+		}
+	}
+	videoProxyError(c, http.StatusNotFound, "invalid_request_error", "Asset not found")
+}
+
+// serveMediaAsset writes the stored content of asset, supporting range
+// requests when the storage backend returns a seekable reader. It returns an
+// error without writing anything when the content cannot be opened.
+func serveMediaAsset(c *gin.Context, asset *model.MediaAsset, maxAgeSeconds int64) error {
+	reader, err := service.OpenMediaAssetContent(c.Request.Context(), asset)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if maxAgeSeconds < 0 {
+		maxAgeSeconds = 0
+	}
+	c.Writer.Header().Set("Content-Type", asset.ContentType)
+	c.Writer.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAgeSeconds))
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", time.Unix(asset.CreatedAt, 0), seeker)
+		return nil
+	}
+	c.Writer.Header().Set("Content-Length", strconv.FormatInt(asset.Bytes, 10))
+	c.Writer.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to stream asset %s: %s", asset.AssetId, err.Error()))
+	}
+	return nil
+}
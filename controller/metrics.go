@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
+	"github.com/QuantumNous/new-api/setting/perf_metrics_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrometheusMetrics serves GET /metrics in the Prometheus exposition format.
+// The endpoint is hidden unless enabled, and requires
+// "Authorization: Bearer <secret>" when a bearer secret is configured.
+func PrometheusMetrics(c *gin.Context) {
+	setting := perf_metrics_setting.GetPrometheusSetting()
+	if !setting.Enabled {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if setting.BearerSecret != "" {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(setting.BearerSecret)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+	}
+	prommetrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
@@ -90,13 +90,21 @@ func runMidjourneyTaskUpdateOnce(ctx context.Context, report func(processed, tot
 		midjourneyChannel, err := model.CacheGetChannel(channelId)
 		if err != nil {
 			logger.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
+			failReason := fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
 			err := model.MjBulkUpdate(taskIds, map[string]any{
-				"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
+				"fail_reason": failReason,
 				"status":      "FAILURE",
 				"progress":    "100%",
 			})
 			if err != nil {
 				logger.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
+			} else {
+				for _, mjId := range taskIds {
+					task := taskM[mjId]
+					preStatus, preProgress := task.Status, task.Progress
+					task.Status, task.Progress, task.FailReason = "FAILURE", "100%", failReason
+					service.NotifyMidjourneyTaskChanged(task, preStatus, preProgress)
+				}
 			}
 			continue
 		}
@@ -166,7 +174,7 @@ func runMidjourneyTaskUpdateOnce(ctx context.Context, report func(processed, tot
 			if !checkMjTaskNeedUpdate(task, responseItem) {
 				continue
 			}
-			preStatus := task.Status
+			preStatus, preProgress := task.Status, task.Progress
 			task.Code = 1
 			task.Progress = responseItem.Progress
 			task.PromptEn = responseItem.PromptEn
@@ -230,6 +238,9 @@ func runMidjourneyTaskUpdateOnce(ctx context.Context, report func(processed, tot
 					},
 				})
 			}
+			if won {
+				service.NotifyMidjourneyTaskChanged(task, preStatus, preProgress)
+			}
 		}
 	}
 	if report != nil && (ctx == nil || ctx.Err() == nil) {
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moderationTokenKeyTTL bounds how long the moderation token key is reused
+// before it is reloaded, so a rotated or disabled token takes effect quickly.
+const moderationTokenKeyTTL = time.Minute
+
+func init() {
+	service.RegisterModerationProvider(&moderationChannelProvider{})
+}
+
+// moderationChannelProvider sends the prompt to a /v1/moderations capable
+// channel through the relay itself, using the private engine of the batch
+// runner. The call is authenticated and billed as the configured token; a
+// configured channel id pins the channel, which requires an admin-owned token.
+type moderationChannelProvider struct {
+	mu       sync.Mutex
+	tokenId  int
+	tokenKey string
+	loadedAt time.Time
+}
+
+type moderationChannelResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+func (p *moderationChannelProvider) Name() string {
+	return operation_setting.ModerationProviderLLM
+}
+
+func (p *moderationChannelProvider) Local() bool {
+	return false
+}
+
+func (p *moderationChannelProvider) Check(c *gin.Context, text string) (*service.ModerationFinding, error) {
+	settings := operation_setting.GetModerationSetting()
+	if settings.LLMTokenId <= 0 || settings.LLMModel == "" {
+		return nil, errors.New("moderation channel is not configured")
+	}
+	tokenKey, err := p.loadTokenKey(settings.LLMTokenId)
+	if err != nil {
+		return nil, err
+	}
+	if settings.LLMMaxInputLength > 0 {
+		if runes := []rune(text); len(runes) > settings.LLMMaxInputLength {
+			text = string(runes[:settings.LLMMaxInputLength])
+		}
+	}
+	body, err := common.Marshal(map[string]any{
+		"model": settings.LLMModel,
+		"input": text,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(settings.LLMTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	authorization := "Bearer sk-" + tokenKey
+	if settings.LLMChannelId > 0 {
+		authorization = fmt.Sprintf("%s-%d", authorization, settings.LLMChannelId)
+	}
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/v1/moderations", bytes.NewReader(body))
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	getBatchRelayEngine().ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		return nil, fmt.Errorf("moderation channel returned status %d: %s", recorder.Code, common.LocalLogPreview(recorder.Body.String()))
+	}
+
+	var response moderationChannelResponse
+	if err := common.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("invalid moderation response: %w", err)
+	}
+	var finding *service.ModerationFinding
+	for _, result := range response.Results {
+		if !result.Flagged {
+			continue
+		}
+		if finding == nil {
+			finding = &service.ModerationFinding{Provider: operation_setting.ModerationProviderLLM}
+		}
+		for category, flagged := range result.Categories {
+			if flagged {
+				finding.Categories = append(finding.Categories, category)
+			}
+		}
+	}
+	if finding != nil {
+		sort.Strings(finding.Categories)
+	}
+	return finding, nil
+}
+
+func (p *moderationChannelProvider) loadTokenKey(tokenId int) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tokenId == tokenId && p.tokenKey != "" && time.Since(p.loadedAt) < moderationTokenKeyTTL {
+		return p.tokenKey, nil
+	}
+	token, err := model.GetTokenById(tokenId)
+	if err != nil {
+		return "", fmt.Errorf("failed to load moderation token: %w", err)
+	}
+	p.tokenId = tokenId
+	p.tokenKey = token.Key
+	p.loadedAt = time.Now()
+	return p.tokenKey, nil
+}
@@ -0,0 +1,505 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type organizationRequest struct {
+	Name string `json:"name"`
+}
+
+type organizationInvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type organizationAcceptRequest struct {
+	Code string `json:"code"`
+}
+
+type organizationMemberRequest struct {
+	Role          string `json:"role"`
+	MonthlyBudget int    `json:"monthly_budget"`
+}
+
+type organizationQuotaRequest struct {
+	Quota int `json:"quota"`
+}
+
+func validOrganizationName(name string) bool {
+	length := utf8.RuneCountInString(name)
+	return length > 0 && length <= 64
+}
+
+// getRequestOrganizationMember loads the organization referenced by :id and
+// the caller's membership, writing an error response when either is missing.
+func getRequestOrganizationMember(c *gin.Context) (*model.Organization, *model.OrganizationMember, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return nil, nil, false
+	}
+	organization, err := model.GetOrganizationById(id)
+	if err != nil {
+		if errors.Is(err, model.ErrOrganizationNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationNotFound)
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, nil, false
+	}
+	member, err := model.GetOrganizationMember(organization.Id, c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, model.ErrOrganizationMemberNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationNotMember)
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, nil, false
+	}
+	return organization, member, true
+}
+
+// requireOrganizationManager only lets owners and admins through.
+func requireOrganizationManager(c *gin.Context) (*model.Organization, *model.OrganizationMember, bool) {
+	organization, member, ok := getRequestOrganizationMember(c)
+	if !ok {
+		return nil, nil, false
+	}
+	if member.Role != model.OrganizationRoleOwner && member.Role != model.OrganizationRoleAdmin {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationPermissionDenied)
+		return nil, nil, false
+	}
+	return organization, member, true
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req organizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !validOrganizationName(req.Name) {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationNameInvalid)
+		return
+	}
+	organization, err := model.CreateOrganization(req.Name, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organization)
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	organizations, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organizations)
+}
+
+func GetOrganization(c *gin.Context) {
+	organization, member, ok := getRequestOrganizationMember(c)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization": organization,
+		"role":         member.Role,
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	organization, _, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	var req organizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !validOrganizationName(req.Name) {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationNameInvalid)
+		return
+	}
+	if err := organization.UpdateName(req.Name); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organization)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	organization, member, ok := getRequestOrganizationMember(c)
+	if !ok {
+		return
+	}
+	if member.Role != model.OrganizationRoleOwner {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationPermissionDenied)
+		return
+	}
+	if err := model.DeleteOrganization(organization.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	organization, _, ok := getRequestOrganizationMember(c)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(organization.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+// UpdateOrganizationMember changes the role and monthly budget of a member.
+// Ownership cannot be granted or taken away here.
+func UpdateOrganizationMember(c *gin.Context) {
+	organization, actor, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.MonthlyBudget < 0 {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationBudgetNegative)
+		return
+	}
+	target, err := model.GetOrganizationMember(organization.Id, userId)
+	if err != nil {
+		if errors.Is(err, model.ErrOrganizationMemberNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationMemberNotFound)
+		} else {
+			common.ApiError(c, err)
+		}
+		return
+	}
+	if target.Role == model.OrganizationRoleOwner && actor.Role == model.OrganizationRoleOwner {
+		// The owner may only change its own budget.
+		req.Role = model.OrganizationRoleOwner
+	} else {
+		if req.Role == "" {
+			req.Role = target.Role
+		}
+		if !model.IsValidOrganizationRole(req.Role) || req.Role == model.OrganizationRoleOwner {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationRoleInvalid)
+			return
+		}
+		if !model.CanManageOrganizationRole(actor.Role, target.Role) || !model.CanManageOrganizationRole(actor.Role, req.Role) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationPermissionDenied)
+			return
+		}
+	}
+	if err := model.UpdateOrganizationMember(organization.Id, userId, req.Role, req.MonthlyBudget); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// RemoveOrganizationMember removes a member, or lets a non-owner member leave
+// the organization when the target is the caller.
+func RemoveOrganizationMember(c *gin.Context) {
+	organization, actor, ok := getRequestOrganizationMember(c)
+	if !ok {
+		return
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if userId == actor.UserId {
+		if actor.Role == model.OrganizationRoleOwner {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationOwnerCannotLeave)
+			return
+		}
+	} else {
+		target, err := model.GetOrganizationMember(organization.Id, userId)
+		if err != nil {
+			if errors.Is(err, model.ErrOrganizationMemberNotFound) {
+				common.ApiErrorI18n(c, i18n.MsgOrganizationMemberNotFound)
+			} else {
+				common.ApiError(c, err)
+			}
+			return
+		}
+		if !model.CanManageOrganizationRole(actor.Role, target.Role) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationPermissionDenied)
+			return
+		}
+	}
+	if err := model.RemoveOrganizationMember(organization.Id, userId); err != nil {
+		if errors.Is(err, model.ErrOrganizationMemberNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationMemberNotFound)
+		} else {
+			common.ApiError(c, err)
+		}
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationInvitations(c *gin.Context) {
+	organization, _, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	invitations, err := model.GetPendingOrganizationInvitations(organization.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, invitations)
+}
+
+// InviteOrganizationMember emails an invitation link to join the organization.
+func InviteOrganizationMember(c *gin.Context) {
+	organization, actor, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	var req organizationInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	email := model.NormalizeEmail(req.Email)
+	if err := common.Validate.Var(email, "required,email"); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+	if !model.IsValidOrganizationRole(req.Role) || req.Role == model.OrganizationRoleOwner {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationRoleInvalid)
+		return
+	}
+	if !model.CanManageOrganizationRole(actor.Role, req.Role) {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationPermissionDenied)
+		return
+	}
+	invitation, err := model.CreateOrganizationInvitation(organization.Id, email, req.Role, actor.UserId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	link := fmt.Sprintf("%s/console/organization/accept?code=%s", system_setting.ServerAddress, url.QueryEscape(invitation.Code))
+	subject := fmt.Sprintf("%s 组织邀请", common.SystemName)
+	content := fmt.Sprintf("<p>您好，您被邀请加入 %s 上的组织「%s」。</p>"+
+		"<p>点击 <a href='%s'>此处</a> 接受邀请。</p>"+
+		"<p>如果链接无法点击，请尝试点击下面的链接或将其复制到浏览器中打开：<br> %s </p>"+
+		"<p>邀请 %d 天内有效，如果不认识邀请人，请忽略。</p>", common.SystemName, organization.Name, link, link, model.OrganizationInvitationValidDays)
+	if err := common.SendEmail(subject, email, content); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to send organization invitation email to %s: %s", email, err.Error()))
+		common.ApiErrorI18n(c, i18n.MsgOrganizationInvitationSendFailed)
+		return
+	}
+	common.ApiSuccess(c, invitation)
+}
+
+func RevokeOrganizationInvitation(c *gin.Context) {
+	organization, _, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	invitationId, err := strconv.Atoi(c.Param("invitation_id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := model.RevokeOrganizationInvitation(organization.Id, invitationId); err != nil {
+		if errors.Is(err, model.ErrOrganizationInvitationInvalid) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationInvitationInvalid)
+		} else {
+			common.ApiError(c, err)
+		}
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func AcceptOrganizationInvitation(c *gin.Context) {
+	var req organizationAcceptRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	member, err := model.AcceptOrganizationInvitation(req.Code, c.GetInt("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrOrganizationInvitationInvalid):
+			common.ApiErrorI18n(c, i18n.MsgOrganizationInvitationInvalid)
+		case errors.Is(err, model.ErrOrganizationInvitationEmailUnfit):
+			common.ApiErrorI18n(c, i18n.MsgOrganizationInvitationEmailMismatch)
+		case errors.Is(err, model.ErrOrganizationMemberExists):
+			common.ApiErrorI18n(c, i18n.MsgOrganizationMemberExists)
+		default:
+			common.ApiError(c, err)
+		}
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+// TransferOrganizationQuota moves quota from the caller's wallet into the
+// organization's shared pool.
+func TransferOrganizationQuota(c *gin.Context) {
+	organization, actor, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	var req organizationQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.Quota <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationQuotaInvalid)
+		return
+	}
+	if err := model.TransferQuotaToOrganization(organization.Id, actor.UserId, req.Quota); err != nil {
+		if errors.Is(err, model.ErrOrganizationWalletQuotaNotEnough) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationWalletInsufficient)
+		} else {
+			common.ApiError(c, err)
+		}
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationTokens(c *gin.Context) {
+	organization, _, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	tokens, err := model.GetOrganizationTokens(organization.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, buildMaskedTokenResponses(tokens))
+}
+
+// GetOrganizationQuotaDates returns usage of the organization's tokens.
+// Owners and admins see every member, members only see their own usage.
+func GetOrganizationQuotaDates(c *gin.Context) {
+	organization, member, ok := getRequestOrganizationMember(c)
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	// 判断时间跨度是否超过 1 个月
+	if endTimestamp-startTimestamp > 2592000 {
+		common.ApiErrorMsg(c, "时间跨度不能超过 1 个月")
+		return
+	}
+	userId := 0
+	if member.Role == model.OrganizationRoleMember {
+		userId = member.UserId
+	}
+	dates, err := model.GetQuotaDataByOrganization(organization.Id, userId, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, dates)
+}
+
+// ---- Admin APIs ----
+
+func AdminGetAllOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	organizations, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(organizations)
+	common.ApiSuccess(c, pageInfo)
+}
+
+type adminOrganizationRequest struct {
+	QuotaDelta int  `json:"quota_delta"`
+	Status     *int `json:"status"`
+}
+
+// AdminUpdateOrganization adjusts the shared pool and enables or disables an
+// organization.
+func AdminUpdateOrganization(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	var req adminOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	organization, err := model.GetOrganizationById(id)
+	if err != nil {
+		if errors.Is(err, model.ErrOrganizationNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationNotFound)
+		} else {
+			common.ApiError(c, err)
+		}
+		return
+	}
+	if req.Status != nil {
+		if *req.Status != model.OrganizationStatusEnabled && *req.Status != model.OrganizationStatusDisabled {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+		if err := model.UpdateOrganizationStatus(organization.Id, *req.Status); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if req.QuotaDelta != 0 {
+		if err := model.AdjustOrganizationQuota(organization.Id, req.QuotaDelta); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		model.RecordLogWithAdminInfo(organization.OwnerId, model.LogTypeManage,
+			fmt.Sprintf("管理员调整组织 %d 的共享额度 %s", organization.Id, logger.LogQuota(req.QuotaDelta)),
+			auditOperatorInfo(c))
+	}
+	common.ApiSuccess(c, nil)
+}
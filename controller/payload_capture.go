@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPayloadCaptures lists captured request/response records without their
+// bodies. Filter by request_id to find the capture behind a consume log.
+func GetPayloadCaptures(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	captures, total, err := model.GetPayloadCaptures(userId, tokenId, c.Query("model_name"), c.Query("request_id"), startTimestamp, endTimestamp, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(captures)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetPayloadCapture returns one capture with its decompressed (and decrypted)
+// request and response bodies. Every view is written to the audit log.
+func GetPayloadCapture(c *gin.Context) {
+	requestId := c.Param("request_id")
+	capture, exist, err := model.GetPayloadCaptureByRequestId(requestId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !exist {
+		common.ApiErrorMsg(c, "payload capture not found")
+		return
+	}
+	requestBody, err := service.DecodePayloadCaptureBody(capture.RequestBody)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	responseBody, err := service.DecodePayloadCaptureBody(capture.ResponseBody)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAuditFor(c, capture.UserId, "log.payload_view", map[string]interface{}{
+		"request_id": capture.RequestId,
+	})
+	common.ApiSuccess(c, gin.H{
+		"capture":       capture,
+		"request_body":  string(requestBody),
+		"response_body": string(responseBody),
+	})
+}
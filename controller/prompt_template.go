@@ -0,0 +1,364 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// promptTemplateRequest is shared by create and update. On update a nil
+// Content keeps the current version; otherwise a new version is added when
+// the content or variable defaults changed.
+type promptTemplateRequest struct {
+	OrganizationId int               `json:"organization_id"`
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	Content        *string           `json:"content"`
+	Variables      map[string]string `json:"variables"`
+	Note           string            `json:"note"`
+}
+
+func (r *promptTemplateRequest) version(userId int) (*model.PromptTemplateVersion, error) {
+	version := &model.PromptTemplateVersion{Note: r.Note, CreatedBy: userId}
+	if r.Content != nil {
+		version.Content = *r.Content
+	}
+	if len(r.Variables) > 0 {
+		variables, err := common.Marshal(r.Variables)
+		if err != nil {
+			return nil, err
+		}
+		version.Variables = string(variables)
+	}
+	return version, nil
+}
+
+type PromptTemplateResponse struct {
+	*model.PromptTemplate
+	Latest       *model.PromptTemplateVersion `json:"latest,omitempty"`
+	Placeholders []string                     `json:"placeholders"`
+}
+
+func toPromptTemplateResponse(template *model.PromptTemplate) (*PromptTemplateResponse, error) {
+	latest, err := model.GetPromptTemplateVersion(template.Id, template.LatestVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &PromptTemplateResponse{PromptTemplate: template, Latest: latest, Placeholders: latest.Placeholders()}, nil
+}
+
+// canManagePromptTemplate lets the creator manage personal templates and the
+// organization's owners and admins manage shared ones.
+func canManagePromptTemplate(template *model.PromptTemplate, userId int) bool {
+	if template.OrganizationId == 0 {
+		return template.UserId == userId
+	}
+	member, err := model.GetOrganizationMember(template.OrganizationId, userId)
+	if err != nil {
+		return false
+	}
+	return member.Role == model.OrganizationRoleOwner || member.Role == model.OrganizationRoleAdmin
+}
+
+// getPromptTemplateParam loads the template referenced by :id. Templates the
+// caller cannot use are reported as not found.
+func getPromptTemplateParam(c *gin.Context, manage bool) (*model.PromptTemplate, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return nil, false
+	}
+	template, err := model.GetPromptTemplateById(id)
+	if err != nil {
+		if errors.Is(err, model.ErrPromptTemplateNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgPromptTemplateNotFound)
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, false
+	}
+	userId := c.GetInt("id")
+	if !service.CanUsePromptTemplate(template, userId) {
+		common.ApiErrorI18n(c, i18n.MsgPromptTemplateNotFound)
+		return nil, false
+	}
+	if manage && !canManagePromptTemplate(template, userId) {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationPermissionDenied)
+		return nil, false
+	}
+	return template, true
+}
+
+func writePromptTemplateVersionError(c *gin.Context, err error) {
+	if errors.Is(err, model.ErrPromptTemplateVersionNotFound) {
+		common.ApiErrorI18n(c, i18n.MsgPromptTemplateVersionNotFound)
+		return
+	}
+	common.ApiError(c, err)
+}
+
+// GetPromptTemplates lists the caller's personal templates, or the shared
+// templates of an organization when organization_id is given.
+func GetPromptTemplates(c *gin.Context) {
+	userId := c.GetInt("id")
+	var templates []*model.PromptTemplate
+	var err error
+	if organizationId, _ := strconv.Atoi(c.Query("organization_id")); organizationId > 0 {
+		if _, memberErr := model.GetOrganizationMember(organizationId, userId); memberErr != nil {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationNotMember)
+			return
+		}
+		templates, err = model.GetOrganizationPromptTemplates(organizationId)
+	} else {
+		templates, err = model.GetUserPromptTemplates(userId)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, templates)
+}
+
+func GetPromptTemplate(c *gin.Context) {
+	template, ok := getPromptTemplateParam(c, false)
+	if !ok {
+		return
+	}
+	response, err := toPromptTemplateResponse(template)
+	if err != nil {
+		writePromptTemplateVersionError(c, err)
+		return
+	}
+	common.ApiSuccess(c, response)
+}
+
+func CreatePromptTemplate(c *gin.Context) {
+	var req promptTemplateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.Content == nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	userId := c.GetInt("id")
+	template := &model.PromptTemplate{
+		UserId:         userId,
+		OrganizationId: req.OrganizationId,
+		Name:           req.Name,
+		Description:    req.Description,
+	}
+	if req.OrganizationId != 0 && !canManagePromptTemplate(template, userId) {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationPermissionDenied)
+		return
+	}
+	version, err := req.version(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.CreatePromptTemplate(template, version); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &PromptTemplateResponse{PromptTemplate: template, Latest: version, Placeholders: version.Placeholders()})
+}
+
+func UpdatePromptTemplate(c *gin.Context) {
+	template, ok := getPromptTemplateParam(c, true)
+	if !ok {
+		return
+	}
+	var req promptTemplateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := template.UpdateInfo(req.Name, req.Description); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Content != nil {
+		version, err := req.version(c.GetInt("id"))
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		latest, err := model.GetPromptTemplateVersion(template.Id, template.LatestVersion)
+		if err != nil {
+			writePromptTemplateVersionError(c, err)
+			return
+		}
+		if !version.SameContent(latest) {
+			if err := model.AddPromptTemplateVersion(template, version); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+		}
+	}
+	response, err := toPromptTemplateResponse(template)
+	if err != nil {
+		writePromptTemplateVersionError(c, err)
+		return
+	}
+	common.ApiSuccess(c, response)
+}
+
+func DeletePromptTemplate(c *gin.Context) {
+	template, ok := getPromptTemplateParam(c, true)
+	if !ok {
+		return
+	}
+	if err := model.DeletePromptTemplate(template.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetPromptTemplateVersions lists every version with its usage stats.
+func GetPromptTemplateVersions(c *gin.Context) {
+	template, ok := getPromptTemplateParam(c, false)
+	if !ok {
+		return
+	}
+	versions, err := model.GetPromptTemplateVersions(template.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, versions)
+}
+
+func GetPromptTemplateVersion(c *gin.Context) {
+	template, ok := getPromptTemplateParam(c, false)
+	if !ok {
+		return
+	}
+	versionNumber, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	version, err := model.GetPromptTemplateVersion(template.Id, versionNumber)
+	if err != nil {
+		writePromptTemplateVersionError(c, err)
+		return
+	}
+	common.ApiSuccess(c, version)
+}
+
+// DiffPromptTemplateVersions compares two versions as a unified diff. "to"
+// defaults to the latest version and "from" to the one before it.
+func DiffPromptTemplateVersions(c *gin.Context) {
+	template, ok := getPromptTemplateParam(c, false)
+	if !ok {
+		return
+	}
+	to := template.LatestVersion
+	if value := c.Query("to"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+		to = parsed
+	}
+	from := to - 1
+	if value := c.Query("from"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+		from = parsed
+	}
+	fromVersion, err := model.GetPromptTemplateVersion(template.Id, from)
+	if err != nil {
+		writePromptTemplateVersionError(c, err)
+		return
+	}
+	toVersion, err := model.GetPromptTemplateVersion(template.Id, to)
+	if err != nil {
+		writePromptTemplateVersionError(c, err)
+		return
+	}
+	diff, err := service.DiffPromptTemplateVersions(fromVersion, toVersion)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"from":           from,
+		"to":             to,
+		"diff":           diff,
+		"from_variables": fromVersion.GetDefaults(),
+		"to_variables":   toVersion.GetDefaults(),
+	})
+}
+
+// ---- Admin APIs ----
+
+func AdminGetAllPromptTemplates(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	templates, total, err := model.GetAllPromptTemplates(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(templates)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func getAdminPromptTemplateParam(c *gin.Context) (*model.PromptTemplate, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return nil, false
+	}
+	template, err := model.GetPromptTemplateById(id)
+	if err != nil {
+		if errors.Is(err, model.ErrPromptTemplateNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgPromptTemplateNotFound)
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, false
+	}
+	return template, true
+}
+
+// AdminGetPromptTemplate returns a template with all of its versions.
+func AdminGetPromptTemplate(c *gin.Context) {
+	template, ok := getAdminPromptTemplateParam(c)
+	if !ok {
+		return
+	}
+	versions, err := model.GetPromptTemplateVersions(template.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"template": template, "versions": versions})
+}
+
+func AdminDeletePromptTemplate(c *gin.Context) {
+	template, ok := getAdminPromptTemplateParam(c)
+	if !ok {
+		return
+	}
+	if err := model.DeletePromptTemplate(template.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAuditFor(c, template.UserId, "prompt_template.delete", map[string]interface{}{
+		"id":        template.Id,
+		"prompt_id": template.PromptId,
+		"name":      template.Name,
+	})
+	common.ApiSuccess(c, nil)
+}
@@ -15,7 +15,11 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
+	channelhealth "github.com/QuantumNous/new-api/pkg/channel_health"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
@@ -23,7 +27,6 @@ import (
 	"github.com/QuantumNous/new-api/relaykit/dto"
 	"github.com/QuantumNous/new-api/relaykit/types"
 	"github.com/QuantumNous/new-api/service"
-	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -31,6 +34,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func relayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
@@ -87,6 +91,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			return
 		}
 		defer ws.Close()
+	} else {
+		// registered before the error responder so error bodies are captured too
+		payloadCapture := service.StartPayloadCapture(c)
+		defer payloadCapture.Finish(c)
 	}
 
 	defer func() {
@@ -126,25 +134,37 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
-	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
+	// expand server-side prompt templates first so moderation, PII redaction
+	// and token estimation all see the final prompt
+	newAPIError = service.ExpandPromptTemplate(c, relayInfo, request)
+	if newAPIError != nil {
+		return
+	}
+
+	// moderation requests are themselves the moderation provider's calls
+	needModeration := relayInfo.RelayMode != relayconstant.RelayModeModerations && service.ShouldModeratePrompt(c, relayInfo)
 	needCountToken := constant.CountToken
-	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
+	// Avoid building huge CombineText (strings.Join) when token counting and moderation are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needModeration || needCountToken {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
 	}
 
-	if needSensitiveCheck && meta != nil {
-		contains, words := service.CheckSensitiveText(meta.CombineText)
-		if contains {
-			logger.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
-			newAPIError = types.NewError(err, types.ErrorCodeSensitiveWordsDetected)
+	if needModeration && meta != nil {
+		newAPIError = service.ModeratePrompt(c, relayInfo, request, meta.CombineText)
+		if newAPIError != nil {
+			recordModerationBlockLog(c, relayInfo, newAPIError)
 			return
 		}
 	}
 
+	newAPIError = service.RedactRequestPII(c, relayInfo, request)
+	if newAPIError != nil {
+		return
+	}
+
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
@@ -193,12 +213,15 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
 		relayInfo.RetryIndex = retryParam.GetRetry()
+		attemptSpan := tracing.StartGinSpan(c, "relay.attempt", attribute.Int("retry.index", relayInfo.RetryIndex))
 		channel, channelErr := getChannel(c, relayInfo, retryParam)
 		if channelErr != nil {
 			logger.LogError(c, channelErr.Error())
 			newAPIError = channelErr
+			attemptSpan.End(channelErr)
 			break
 		}
+		attemptSpan.SetAttributes(attribute.Int("channel.id", channel.Id), attribute.Int("channel.type", channel.Type))
 
 		addUsedChannel(c, channel.Id)
 		bodyStorage, bodyErr := common.GetBodyStorage(c)
@@ -209,34 +232,34 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			} else {
 				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
 			}
+			attemptSpan.End(newAPIError)
 			break
 		}
 		c.Request.Body = io.NopCloser(bodyStorage)
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+		if shouldHedge(c, relayInfo, relayFormat) {
+			channel, newAPIError = relayHedged(c, relayInfo, relayFormat, retryParam, channel)
+		} else {
+			newAPIError = relayAttemptWithHealth(c, relayInfo, relayFormat, channel)
 		}
 
 		if newAPIError == nil {
 			relayInfo.LastError = nil
+			attemptSpan.End(nil)
 			return
 		}
 
 		newAPIError = service.NormalizeViolationFeeError(newAPIError)
 		relayInfo.LastError = newAPIError
+		attemptSpan.SetAttributes(attribute.Int("http.response.status_code", newAPIError.StatusCode))
+		attemptSpan.End(newAPIError)
 
 		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 
 		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
 			break
 		}
+		prommetrics.RecordRetry(relayInfo, newAPIError.StatusCode)
 	}
 
 	useChannel := c.GetStringSlice("use_channel")
@@ -245,8 +268,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		logger.LogInfo(c, retryLogStr)
 	}
 	if newAPIError != nil {
+		statusCode := newAPIError.StatusCode
 		gopool.Go(func() {
 			perfmetrics.RecordRelaySample(relayInfo, false, 0)
+			prommetrics.RecordRelay(relayInfo, prommetrics.RelayResult{StatusCode: statusCode})
 		})
 	}
 }
@@ -325,6 +350,72 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 	return channel, nil
 }
 
+func relayAttempt(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		return relay.WssHelper(c, info)
+	case types.RelayFormatClaude:
+		return relay.ClaudeHelper(c, info)
+	case types.RelayFormatGemini:
+		return geminiRelayHandler(c, info)
+	default:
+		return relayHandler(c, info)
+	}
+}
+
+// relayAttemptWithHealth runs one attempt on channel and records its outcome.
+func relayAttemptWithHealth(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat, channel *model.Channel) *types.NewAPIError {
+	attemptStart := time.Now()
+	releaseInFlight := channelhealth.Acquire(channel.Id)
+	err := relayAttempt(c, info, relayFormat)
+	releaseInFlight()
+	recordChannelHealth(c, info, channel.Id, attemptStart, err)
+	return err
+}
+
+// recordChannelHealth feeds the outcome of one attempt into the live channel
+// stats used by the routing strategies and into the circuit breakers of the
+// channel and of the key used. Streams are measured to first byte. Errors
+// caused by the request itself (bad input, quota, ...) are not counted against
+// the channel.
+func recordChannelHealth(c *gin.Context, info *relaycommon.RelayInfo, channelId int, attemptStart time.Time, err *types.NewAPIError) {
+	keyIndex := circuitbreaker.ChannelLevel
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	if err == nil {
+		latency := time.Since(attemptStart)
+		if info.IsStream && info.HasSendResponse() && info.FirstResponseTime.After(attemptStart) {
+			latency = info.FirstResponseTime.Sub(attemptStart)
+		}
+		channelhealth.RecordSuccess(channelId, info.OriginModelName, latency)
+		circuitbreaker.RecordSuccess(channelId, circuitbreaker.ChannelLevel)
+		if keyIndex != circuitbreaker.ChannelLevel {
+			circuitbreaker.RecordSuccess(channelId, keyIndex)
+		}
+		return
+	}
+	if isChannelHealthFailure(err) {
+		channelhealth.RecordFailure(channelId, info.OriginModelName)
+		circuitbreaker.RecordFailure(channelId, circuitbreaker.ChannelLevel)
+		if keyIndex != circuitbreaker.ChannelLevel {
+			circuitbreaker.RecordFailure(channelId, keyIndex)
+		}
+	}
+}
+
+func isChannelHealthFailure(err *types.NewAPIError) bool {
+	if types.IsChannelError(err) {
+		return true
+	}
+	if types.IsSkipRetryError(err) {
+		return false
+	}
+	code := err.StatusCode
+	return code < 100 || code >= 500 || code == http.StatusTooManyRequests ||
+		code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
 func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -361,7 +452,16 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, common.LocalLogPreview(err.Error())))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
-	if service.ShouldDisableChannel(err) && channelError.AutoBan {
+	// Rate-limit-aware multi-key modes cool the key down instead of disabling it.
+	cooledDown := false
+	if err.StatusCode == http.StatusTooManyRequests && channelError.IsMultiKey {
+		keyIndex := common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+		cooledDown = model.CoolDownChannelKey(channelError.ChannelId, keyIndex, err.RetryAfter)
+		if cooledDown {
+			logger.LogInfo(c, fmt.Sprintf("channel #%d key #%d rate limited, cooling down", channelError.ChannelId, keyIndex))
+		}
+	}
+	if !cooledDown && service.ShouldDisableChannel(err) && channelError.AutoBan {
 		gopool.Go(func() {
 			service.DisableChannel(channelError, err.ErrorWithStatusCode())
 		})
@@ -404,6 +504,28 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 
 }
 
+// recordModerationBlockLog keeps the verdicts of a blocked prompt in the error
+// log, since blocked requests never reach settlement.
+func recordModerationBlockLog(c *gin.Context, relayInfo *relaycommon.RelayInfo, err *types.NewAPIError) {
+	if !constant.ErrorLogEnabled {
+		return
+	}
+	verdicts, ok := common.GetContextKeyType[[]service.ModerationVerdict](c, constant.ContextKeyModerationVerdicts)
+	if !ok || len(verdicts) == 0 {
+		return
+	}
+	other := map[string]interface{}{
+		"error_type":  err.GetErrorType(),
+		"error_code":  err.GetErrorCode(),
+		"status_code": err.StatusCode,
+		"moderation":  verdicts,
+	}
+	if c.Request != nil && c.Request.URL != nil {
+		other["request_path"] = c.Request.URL.Path
+	}
+	model.RecordErrorLog(c, relayInfo.UserId, 0, relayInfo.OriginModelName, c.GetString("token_name"), err.MaskSensitiveErrorWithStatusCode(), relayInfo.TokenId, 0, relayInfo.IsStream, relayInfo.UsingGroup, other)
+}
+
 func RelayMidjourney(c *gin.Context) {
 	relayInfo, err := relaycommon.GenRelayInfo(c, types.RelayFormatMjProxy, nil, nil)
 
@@ -502,6 +624,12 @@ func RelayTask(c *gin.Context) {
 		return
 	}
 
+	callbackURL, callbackErr := service.ResolveTaskCallbackURL(c)
+	if callbackErr != nil {
+		respondTaskError(c, service.TaskErrorWrapperLocal(callbackErr, "invalid_callback_url", http.StatusBadRequest))
+		return
+	}
+
 	var result *relay.TaskSubmitResult
 	var taskErr *taskdto.TaskError
 	defer func() {
@@ -585,8 +713,13 @@ func RelayTask(c *gin.Context) {
 		task.PrivateData.UpstreamTaskID = result.UpstreamTaskID
 		task.PrivateData.BillingSource = relayInfo.BillingSource
 		task.PrivateData.SubscriptionId = relayInfo.SubscriptionId
+		task.PrivateData.OrganizationId = relayInfo.OrganizationId
 		task.PrivateData.TokenId = relayInfo.TokenId
 		task.PrivateData.NodeName = common.NodeName
+		task.PrivateData.CallbackURL = callbackURL
+		if callbackURL != "" && strings.HasPrefix(c.Request.URL.Path, "/v1/videos") {
+			task.PrivateData.CallbackFormat = service.TaskCallbackFormatOpenAIVideo
+		}
 		task.PrivateData.BillingContext = &model.TaskBillingContext{
 			ModelPrice:      relayInfo.PriceData.ModelPrice,
 			GroupRatio:      relayInfo.PriceData.GroupRatioInfo.GroupRatio,
@@ -598,6 +731,10 @@ func RelayTask(c *gin.Context) {
 		task.Quota = result.Quota
 		task.Data = result.TaskData
 		task.Action = relayInfo.Action
+		if relayInfo.UpstreamCallbackURL != "" {
+			// upstream pushes the result; polling only picks the task up if the callback never arrives
+			task.PollAfter = service.UpstreamTaskPollAfter()
+		}
 		if insertErr := task.Insert(); insertErr != nil {
 			common.SysError("insert task error: " + insertErr.Error())
 		}
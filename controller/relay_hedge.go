@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	channelhealth "github.com/QuantumNous/new-api/pkg/channel_health"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	hedgePrimaryId = 1
+	hedgeBackupId  = 2
+	// hedgeSelectAttempts bounds how often a second, different channel is
+	// drawn for the hedged request before giving up.
+	hedgeSelectAttempts = 3
+)
+
+// shouldHedge reports whether the attempt may race a second channel. Only the
+// first attempt of streaming chat completions and Claude messages is hedged:
+// that is where time to first byte matters and where a response can be
+// attributed to exactly one upstream.
+func shouldHedge(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat) bool {
+	if info.RetryIndex != 0 || !info.IsStream {
+		return false
+	}
+	switch {
+	case relayFormat == types.RelayFormatOpenAI && info.RelayMode == relayconstant.RelayModeChatCompletions:
+	case relayFormat == types.RelayFormatClaude:
+	default:
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	return operation_setting.IsHedgeEnabledFor(common.GetContextKeyBool(c, constant.ContextKeyTokenHedge), info.UsingGroup)
+}
+
+// hedgeRun is one side of a hedged request. It runs on a copy of the gin
+// context with its own request context, body and relay info, so the two sides
+// never share mutable state; its writer only reaches the client once it wins.
+type hedgeRun struct {
+	c       *gin.Context
+	info    *relaycommon.RelayInfo
+	channel *model.Channel
+	attempt *service.HedgeAttempt
+	cancel  context.CancelFunc
+	start   time.Time
+	err     *types.NewAPIError
+	// lost is set when the run ended after the other side had already won,
+	// i.e. it was cancelled rather than failing on its own.
+	lost bool
+	done chan struct{}
+}
+
+func newHedgeRun(c *gin.Context, info *relaycommon.RelayInfo, race *service.HedgeRace, id int) *hedgeRun {
+	runCtx := c.Copy()
+	runCtx.Writer = c.Writer
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	runCtx.Request = c.Request.WithContext(ctx)
+	attempt := service.StartHedgeAttempt(runCtx, race, id)
+	return &hedgeRun{c: runCtx, info: info, attempt: attempt, cancel: cancel, done: make(chan struct{})}
+}
+
+func (r *hedgeRun) run(relayFormat types.RelayFormat) {
+	defer close(r.done)
+	defer func() {
+		if p := recover(); p != nil {
+			logger.LogError(r.c, fmt.Sprintf("hedged request panic on channel #%d: %v", r.channel.Id, p))
+			r.err = types.NewError(fmt.Errorf("hedged request panic: %v", p), types.ErrorCodeDoRequestFailed)
+		}
+	}()
+	r.start = time.Now()
+	release := channelhealth.Acquire(r.channel.Id)
+	defer release()
+	r.err = relayAttempt(r.c, r.info, relayFormat)
+	r.lost = r.attempt.Lost()
+}
+
+// relayHedged runs the attempt on channel and, when it has not produced its
+// first byte within HedgeSetting.DelayMs, fires the same request at another
+// channel of the same priority. Whichever writes first is streamed to the
+// client and the other one is cancelled. On return the winning side's context
+// keys and relay info have been copied back into c and info, and the channel
+// the result came from is returned with it.
+func relayHedged(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat, retryParam *service.RetryParam, channel *model.Channel) (*model.Channel, *types.NewAPIError) {
+	setting := operation_setting.GetHedgeSetting()
+
+	// Everything the backup needs is prepared before the primary starts, since
+	// c and info are owned by the primary once it runs.
+	bodyStorage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return channel, relayAttemptWithHealth(c, info, relayFormat, channel)
+	}
+	body, err := bodyStorage.Bytes()
+	if err != nil {
+		return channel, relayAttemptWithHealth(c, info, relayFormat, channel)
+	}
+	backupBody, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return channel, relayAttemptWithHealth(c, info, relayFormat, channel)
+	}
+	defer backupBody.Close()
+
+	race := service.NewHedgeRace()
+	backupInfo := info.CloneForHedge()
+	primary := newHedgeRun(c, info, race, hedgePrimaryId)
+	primary.channel = channel
+	backup := newHedgeRun(c, backupInfo, race, hedgeBackupId)
+	backup.c.Set(common.KeyBodyStorage, backupBody)
+	backup.c.Request.Body = io.NopCloser(backupBody)
+	defer primary.cancel()
+	defer backup.cancel()
+
+	go primary.run(relayFormat)
+
+	timer := time.NewTimer(time.Duration(setting.DelayMs) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-primary.done:
+		return finishHedge(c, info, primary, nil)
+	case <-race.Won():
+		<-primary.done
+		return finishHedge(c, info, primary, nil)
+	case <-timer.C:
+	}
+
+	backup.channel = selectHedgeChannel(backup.c, retryParam, backupInfo, channel.Id)
+	if backup.channel == nil {
+		<-primary.done
+		return finishHedge(c, info, primary, nil)
+	}
+	channelIds := []int{channel.Id, backup.channel.Id}
+	common.SetContextKey(primary.c, constant.ContextKeyHedgeChannelIds, channelIds)
+	common.SetContextKey(backup.c, constant.ContextKeyHedgeChannelIds, channelIds)
+	logger.LogInfo(c, fmt.Sprintf("no first byte from channel #%d after %dms, hedging to channel #%d", channel.Id, setting.DelayMs, backup.channel.Id))
+	go backup.run(relayFormat)
+
+	var wg sync.WaitGroup
+	bothDone := make(chan struct{})
+	wg.Add(2)
+	go func() {
+		<-primary.done
+		wg.Done()
+	}()
+	go func() {
+		<-backup.done
+		wg.Done()
+	}()
+	go func() {
+		wg.Wait()
+		close(bothDone)
+	}()
+
+	select {
+	case <-race.Won():
+		if race.Winner() == hedgePrimaryId {
+			backup.cancel()
+		} else {
+			primary.cancel()
+		}
+	case <-bothDone:
+	}
+	<-bothDone
+
+	addUsedChannel(c, backup.channel.Id)
+	if race.Winner() == hedgeBackupId {
+		return finishHedge(c, info, backup, primary)
+	}
+	return finishHedge(c, info, primary, backup)
+}
+
+// finishHedge copies the result side back into c and info and records the
+// outcome of both sides. other is nil when no backup was started.
+func finishHedge(c *gin.Context, info *relaycommon.RelayInfo, result *hedgeRun, other *hedgeRun) (*model.Channel, *types.NewAPIError) {
+	for key, value := range result.c.Keys {
+		if key == common.KeyBodyStorage {
+			continue
+		}
+		c.Set(key, value)
+	}
+	if result.info != info {
+		*info = *result.info
+	}
+	recordChannelHealth(result.c, result.info, result.channel.Id, result.start, result.err)
+	if other == nil {
+		return result.channel, result.err
+	}
+
+	if other.lost {
+		// The loser was cancelled on purpose; its error says nothing about
+		// the health of its channel.
+		if operation_setting.GetHedgeSetting().BillingMode == operation_setting.HedgeBillingBoth {
+			service.ChargeHedgeLoser(c, info, other.channel.Id)
+		}
+	} else if other.err != nil {
+		recordChannelHealth(other.c, other.info, other.channel.Id, other.start, other.err)
+		processChannelError(other.c, *types.NewChannelError(other.channel.Id, other.channel.Type, other.channel.Name, other.channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(other.c, constant.ContextKeyChannelKey), other.channel.GetAutoBan()), other.err)
+	}
+	return result.channel, result.err
+}
+
+// selectHedgeChannel picks a channel other than excludeId for the backup side
+// and prepares c for it, or returns nil when there is none.
+func selectHedgeChannel(c *gin.Context, retryParam *service.RetryParam, info *relaycommon.RelayInfo, excludeId int) *model.Channel {
+	param := *retryParam
+	param.Ctx = c
+	param.Retry = common.GetPointer(retryParam.GetRetry())
+	for i := 0; i < hedgeSelectAttempts; i++ {
+		channel, _, err := service.CacheGetRandomSatisfiedChannel(&param)
+		if err != nil || channel == nil {
+			return nil
+		}
+		if channel.Id == excludeId {
+			continue
+		}
+		if apiErr := middleware.SetupContextForSelectedChannel(c, channel, info.OriginModelName); apiErr != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to set up hedged channel #%d: %s", channel.Id, apiErr.Error()))
+			return nil
+		}
+		return channel
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultResponseInputItemsLimit = 20
+	maxResponseInputItemsLimit     = 100
+)
+
+func checkResponsesStoreEnabled(c *gin.Context) bool {
+	if !operation_setting.IsResponsesStoreEnabled() {
+		RelayNotImplemented(c)
+		return false
+	}
+	return true
+}
+
+// getRequestStoredResponse loads the response referenced by :id and writes a
+// 404 when it does not belong to the caller or has expired.
+func getRequestStoredResponse(c *gin.Context) (*model.StoredResponse, bool) {
+	stored, err := model.GetUserStoredResponse(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such Response object: %s", c.Param("id")))
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to query response")
+		}
+		return nil, false
+	}
+	return stored, true
+}
+
+// RetrieveResponse handles GET /v1/responses/:id for responses stored by the gateway.
+func RetrieveResponse(c *gin.Context) {
+	if !checkResponsesStoreEnabled(c) {
+		return
+	}
+	stored, ok := getRequestStoredResponse(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(stored.Response))
+}
+
+// DeleteResponse handles DELETE /v1/responses/:id.
+func DeleteResponse(c *gin.Context) {
+	if !checkResponsesStoreEnabled(c) {
+		return
+	}
+	stored, ok := getRequestStoredResponse(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteStoredResponseById(stored.Id); err != nil {
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to delete response")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      stored.ResponseId,
+		"object":  "response",
+		"deleted": true,
+	})
+}
+
+// ListResponseInputItems handles GET /v1/responses/:id/input_items.
+func ListResponseInputItems(c *gin.Context) {
+	if !checkResponsesStoreEnabled(c) {
+		return
+	}
+	stored, ok := getRequestStoredResponse(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultResponseInputItemsLimit
+	}
+	if limit > maxResponseInputItemsLimit {
+		limit = maxResponseInputItemsLimit
+	}
+	items, hasMore, err := service.ListStoredResponseInputItems(stored, c.Query("after"), limit, c.Query("order") == "asc")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid 'after' cursor")
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("failed to list input items of response %s: %s", stored.ResponseId, err.Error()))
+		fileApiError(c, http.StatusInternalServerError, "server_error", "Failed to list input items")
+		return
+	}
+	resp := gin.H{
+		"object":   "list",
+		"data":     items,
+		"has_more": hasMore,
+		"first_id": nil,
+		"last_id":  nil,
+	}
+	if len(items) > 0 {
+		resp["first_id"] = items[0]["id"]
+		resp["last_id"] = items[len(items)-1]["id"]
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -34,6 +34,30 @@ func CreateLogCleanupSystemTask(c *gin.Context) {
 	})
 }
 
+// CreateSecretRotationSystemTask starts re-encrypting stored secrets with the
+// current master key. An already active rotation task is returned as is.
+func CreateSecretRotationSystemTask(c *gin.Context) {
+	if !common.SecretEncryptionEnabled() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "secret encryption is not configured",
+		})
+		return
+	}
+
+	task, _, err := service.EnqueueSystemTask(model.SystemTaskTypeSecretRotation, nil)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    task.ToResponse(),
+	})
+}
+
 func GetCurrentSystemTask(c *gin.Context) {
 	taskType := c.Query("type")
 	if taskType == "" {
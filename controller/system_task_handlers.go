@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 )
 
@@ -22,6 +23,14 @@ func RegisterScheduledSystemTasks() {
 	service.RegisterSystemTaskHandler(modelUpdateHandler{})
 	service.RegisterSystemTaskHandler(midjourneyPollHandler{})
 	service.RegisterSystemTaskHandler(asyncTaskPollHandler{})
+	service.RegisterSystemTaskHandler(fileCleanupHandler{})
+	service.RegisterSystemTaskHandler(batchExecutionHandler{})
+	service.RegisterSystemTaskHandler(responseCleanupHandler{})
+	service.RegisterSystemTaskHandler(geminiResourceCleanupHandler{})
+	service.RegisterSystemTaskHandler(secretRotationHandler{})
+	service.RegisterSystemTaskHandler(taskCallbackDeliveryHandler{})
+	service.RegisterSystemTaskHandler(mediaAssetCleanupHandler{})
+	service.RegisterSystemTaskHandler(payloadCaptureCleanupHandler{})
 }
 
 // channelTestHandler runs the scheduled "test all channels" job. Enablement and
@@ -152,6 +161,172 @@ func (asyncTaskPollHandler) Run(ctx context.Context, task *model.SystemTask, run
 	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
 }
 
+// fileCleanupHandler removes expired /v1/files uploads (record, stored content
+// and any upstream copy) once per hour while the Files API is enabled.
+type fileCleanupHandler struct{}
+
+func (fileCleanupHandler) Type() string { return model.SystemTaskTypeFileCleanup }
+
+func (fileCleanupHandler) Enabled() bool {
+	return operation_setting.IsFileApiEnabled()
+}
+
+func (fileCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (fileCleanupHandler) NewPayload() any { return nil }
+
+func (fileCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary, err := service.RunExpiredFileCleanupOnce(ctx)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+// responseCleanupHandler removes expired responses saved for channels without
+// native Responses state, once per hour while the store is enabled.
+type responseCleanupHandler struct{}
+
+func (responseCleanupHandler) Type() string { return model.SystemTaskTypeResponseCleanup }
+
+func (responseCleanupHandler) Enabled() bool {
+	return operation_setting.IsResponsesStoreEnabled()
+}
+
+func (responseCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (responseCleanupHandler) NewPayload() any { return nil }
+
+func (responseCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary, err := service.RunExpiredResponseCleanupOnce(ctx)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+// geminiResourceCleanupHandler drops records of Gemini files, cached contents
+// and upload sessions that have expired upstream, once per hour.
+type geminiResourceCleanupHandler struct{}
+
+func (geminiResourceCleanupHandler) Type() string { return model.SystemTaskTypeGeminiResourceCleanup }
+
+func (geminiResourceCleanupHandler) Enabled() bool {
+	return model_setting.GetGeminiSettings().FilesApiEnabled
+}
+
+func (geminiResourceCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (geminiResourceCleanupHandler) NewPayload() any { return nil }
+
+func (geminiResourceCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary, err := service.RunExpiredGeminiResourceCleanupOnce(ctx)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+// secretRotationHandler encrypts plaintext secrets and rewraps data keys of
+// rotated master keys. It runs daily while a master key is configured (so
+// existing plaintext rows are migrated soon after encryption is enabled) and
+// can be triggered manually after rotating the master key.
+type secretRotationHandler struct{}
+
+func (secretRotationHandler) Type() string { return model.SystemTaskTypeSecretRotation }
+
+func (secretRotationHandler) Enabled() bool {
+	return common.SecretEncryptionEnabled()
+}
+
+func (secretRotationHandler) Interval() time.Duration { return 24 * time.Hour }
+
+func (secretRotationHandler) NewPayload() any { return nil }
+
+func (secretRotationHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary, err := service.RunSecretRotationOnce(ctx, service.NewSystemTaskProgressReporter(task, runnerID))
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+// taskCallbackDeliveryHandler delivers due async task callbacks. New callbacks
+// enqueue a run immediately; the 15s schedule picks up retries whose backoff
+// has elapsed, and Enabled() skips scheduling while nothing is due.
+type taskCallbackDeliveryHandler struct{}
+
+func (taskCallbackDeliveryHandler) Type() string { return model.SystemTaskTypeTaskCallbackDelivery }
+
+func (taskCallbackDeliveryHandler) Enabled() bool {
+	return operation_setting.IsTaskCallbackEnabled() && model.HasDueTaskCallbacks(common.GetTimestamp())
+}
+
+func (taskCallbackDeliveryHandler) Interval() time.Duration { return 15 * time.Second }
+
+func (taskCallbackDeliveryHandler) NewPayload() any { return nil }
+
+func (taskCallbackDeliveryHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary, err := service.RunTaskCallbackDeliveryOnce(ctx)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+// mediaAssetCleanupHandler removes stored generation results past their
+// retention once per hour. It keeps running after the asset store is switched
+// off so that already stored assets still expire.
+type mediaAssetCleanupHandler struct{}
+
+func (mediaAssetCleanupHandler) Type() string { return model.SystemTaskTypeMediaAssetCleanup }
+
+func (mediaAssetCleanupHandler) Enabled() bool {
+	return model.HasExpiredMediaAssets()
+}
+
+func (mediaAssetCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (mediaAssetCleanupHandler) NewPayload() any { return nil }
+
+func (mediaAssetCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary, err := service.RunExpiredMediaAssetCleanupOnce(ctx)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+// payloadCaptureCleanupHandler removes captured request/response payloads past
+// the configured retention once per hour. Like the media asset cleanup it keeps
+// running after capture is switched off so old payloads still age out.
+type payloadCaptureCleanupHandler struct{}
+
+func (payloadCaptureCleanupHandler) Type() string { return model.SystemTaskTypePayloadCaptureCleanup }
+
+func (payloadCaptureCleanupHandler) Enabled() bool {
+	return service.HasExpiredPayloadCaptures()
+}
+
+func (payloadCaptureCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (payloadCaptureCleanupHandler) NewPayload() any { return nil }
+
+func (payloadCaptureCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary, err := service.RunPayloadCaptureCleanupOnce(ctx)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
 func finishSystemTaskHandler(task *model.SystemTask, runnerID string, status model.SystemTaskStatus, result any, runErr error) {
 	errorMessage := ""
 	if runErr != nil {
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserTaskCallbacks lists the delivery log of the caller's task callbacks.
+func GetUserTaskCallbacks(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	params := model.TaskCallbackQueryParams{
+		UserId: c.GetInt("id"),
+		TaskId: c.Query("task_id"),
+		Status: c.Query("status"),
+	}
+	callbacks, total, err := model.ListTaskCallbacks(params, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(callbacks)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetAllTaskCallbacks lists the delivery log of all users for administrators.
+func GetAllTaskCallbacks(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	params := model.TaskCallbackQueryParams{
+		UserId: userId,
+		TaskId: c.Query("task_id"),
+		Status: c.Query("status"),
+	}
+	callbacks, total, err := model.ListTaskCallbacks(params, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(callbacks)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RetryUserTaskCallback puts one of the caller's callbacks back into the
+// delivery queue with a fresh attempt budget.
+func RetryUserTaskCallback(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	callback, err := model.RetryTaskCallback(c.GetInt("id"), id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, _, err := service.EnqueueSystemTask(model.SystemTaskTypeTaskCallbackDelivery, nil); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, callback)
+}
+
+// maxUpstreamTaskCallbackBytes caps the body accepted from an upstream push.
+const maxUpstreamTaskCallbackBytes = 1 << 20
+
+// UpstreamTaskCallback receives task status pushed by a provider (Kling, Vidu,
+// Doubao, Hailuo) to the callback URL attached at submit time. The URL is
+// signed by the gateway, so the request needs no user auth.
+func UpstreamTaskCallback(c *gin.Context) {
+	if !operation_setting.IsUpstreamTaskCallbackEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "task callback is disabled"})
+		return
+	}
+	platform := c.Param("platform")
+	channelId, err := strconv.Atoi(c.Param("channel_id"))
+	taskId := c.Query("task_id")
+	if err != nil || !service.VerifyUpstreamTaskCallbackSign(platform, channelId, taskId, c.Query("sign")) {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "invalid callback signature"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxUpstreamTaskCallbackBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	reply, err := service.HandleUpstreamTaskCallback(c.Request.Context(), platform, channelId, taskId, c.Request.Header, body)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("upstream task callback for task %s failed: %v", taskId, err))
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrUpstreamTaskCallbackSignature) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if reply != nil {
+		c.Data(http.StatusOK, "application/json", reply)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
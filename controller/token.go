@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
@@ -187,6 +189,29 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	if token.TPMLimit < 0 || token.TPDLimit < 0 || token.ConcurrencyLimit < 0 {
+		common.ApiErrorI18n(c, i18n.MsgTokenRateLimitNegative)
+		return
+	}
+	if token.Moderation != "" && operation_setting.ModerationActionRank(token.Moderation) == 0 {
+		common.ApiErrorI18n(c, i18n.MsgTokenModerationInvalid)
+		return
+	}
+	if token.TaskCallbackUrl != "" && service.ValidateTaskCallbackURL(token.TaskCallbackUrl) != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenCallbackUrlInvalid)
+		return
+	}
+	// 组织令牌只能由组织成员创建，创建后不可更改所属组织
+	if token.OrganizationId != 0 {
+		if _, err := model.GetOrganizationMember(token.OrganizationId, c.GetInt("id")); err != nil {
+			if errors.Is(err, model.ErrOrganizationMemberNotFound) {
+				common.ApiErrorI18n(c, i18n.MsgOrganizationNotMember)
+				return
+			}
+			common.ApiError(c, err)
+			return
+		}
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -221,6 +246,14 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		ResponseCache:      token.ResponseCache,
+		Hedge:              token.Hedge,
+		TPMLimit:           token.TPMLimit,
+		TPDLimit:           token.TPDLimit,
+		ConcurrencyLimit:   token.ConcurrencyLimit,
+		OrganizationId:     token.OrganizationId,
+		Moderation:         token.Moderation,
+		TaskCallbackUrl:    token.TaskCallbackUrl,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -271,6 +304,18 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	if token.TPMLimit < 0 || token.TPDLimit < 0 || token.ConcurrencyLimit < 0 {
+		common.ApiErrorI18n(c, i18n.MsgTokenRateLimitNegative)
+		return
+	}
+	if token.Moderation != "" && operation_setting.ModerationActionRank(token.Moderation) == 0 {
+		common.ApiErrorI18n(c, i18n.MsgTokenModerationInvalid)
+		return
+	}
+	if token.TaskCallbackUrl != "" && service.ValidateTaskCallbackURL(token.TaskCallbackUrl) != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenCallbackUrlInvalid)
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -299,6 +344,13 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.Hedge = token.Hedge
+		cleanToken.TPMLimit = token.TPMLimit
+		cleanToken.TPDLimit = token.TPDLimit
+		cleanToken.ConcurrencyLimit = token.ConcurrencyLimit
+		cleanToken.Moderation = token.Moderation
+		cleanToken.TaskCallbackUrl = token.TaskCallbackUrl
 	}
 	err = cleanToken.Update()
 	if err != nil {
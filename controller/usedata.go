@@ -91,7 +91,7 @@ func GetAllFlowQuotaDates(c *gin.Context) {
 		return
 	}
 	username := c.Query("username")
-	dates, err := model.GetFlowQuotaData(startTimestamp, endTimestamp, username, 0, c.GetInt("role"))
+	dates, err := model.GetFlowQuotaData(startTimestamp, endTimestamp, username, 0, manageRoleLevel(c))
 	if err != nil {
 		common.ApiError(c, err)
 		return
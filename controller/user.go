@@ -372,6 +372,24 @@ func canManageTargetRole(myRole int, targetRole int) bool {
 	return myRole == common.RoleRootUser || myRole > targetRole
 }
 
+// manageRoleLevel returns the role level used for user management checks.
+// Callers reaching a management route through a custom authz role are common
+// users, so they are treated as admins: they manage common users only.
+func manageRoleLevel(c *gin.Context) int {
+	return max(c.GetInt("role"), common.RoleAdminUser)
+}
+
+// canManageTargetUser reports whether the caller may manage the target user.
+// Only root may manage its own account here; everyone else, including admins
+// and custom-role callers whose level is raised by manageRoleLevel, has to go
+// through the self-service endpoints.
+func canManageTargetUser(c *gin.Context, targetId int, targetRole int) bool {
+	if targetId == c.GetInt("id") && c.GetInt("role") != common.RoleRootUser {
+		return false
+	}
+	return canManageTargetRole(manageRoleLevel(c), targetRole)
+}
+
 func GetUser(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -383,8 +401,7 @@ func GetUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	myRole := c.GetInt("role")
-	if !canManageTargetRole(myRole, user.Role) {
+	if !canManageTargetUser(c, user.Id, user.Role) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionSameLevel)
 		return
 	}
@@ -698,8 +715,7 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 	updatedUser.Role = originUser.Role
-	myRole := c.GetInt("role")
-	if !canManageTargetRole(myRole, originUser.Role) {
+	if !canManageTargetUser(c, originUser.Id, originUser.Role) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
 		return
 	}
@@ -765,8 +781,7 @@ func AdminClearUserBinding(c *gin.Context) {
 		return
 	}
 
-	myRole := c.GetInt("role")
-	if !canManageTargetRole(myRole, user.Role) {
+	if !canManageTargetUser(c, user.Id, user.Role) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionSameLevel)
 		return
 	}
@@ -965,8 +980,8 @@ func DeleteUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role {
+	myRole := manageRoleLevel(c)
+	if myRole <= originUser.Role || !canManageTargetUser(c, originUser.Id, originUser.Role) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
 		return
 	}
@@ -975,6 +990,9 @@ func DeleteUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if err := authz.SetUserRoles(id, nil); err != nil {
+		common.SysLog(fmt.Sprintf("failed to clear authz roles for user %d: %s", id, err.Error()))
+	}
 	recordManageAuditFor(c, originUser.Id, "user.delete", map[string]interface{}{
 		"username": originUser.Username,
 		"id":       originUser.Id,
@@ -1022,7 +1040,7 @@ func CreateUser(c *gin.Context) {
 	if user.DisplayName == "" {
 		user.DisplayName = user.Username
 	}
-	myRole := c.GetInt("role")
+	myRole := manageRoleLevel(c)
 	if user.Role >= myRole {
 		common.ApiErrorI18n(c, i18n.MsgUserCannotCreateHigherLevel)
 		return
@@ -1106,8 +1124,8 @@ func ManageUser(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgUserNotExists)
 		return
 	}
-	myRole := c.GetInt("role")
-	if !canManageTargetRole(myRole, user.Role) {
+	myRole := manageRoleLevel(c)
+	if !canManageTargetUser(c, user.Id, user.Role) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
 		return
 	}
@@ -1125,6 +1143,10 @@ func ManageUser(c *gin.Context) {
 			common.ApiErrorI18n(c, i18n.MsgUserCannotDeleteRootUser)
 			return
 		}
+		if !authz.Can(c.GetInt("id"), c.GetInt("role"), authz.UserSensitiveWrite) {
+			common.ApiErrorI18n(c, i18n.MsgAuthInsufficientPrivilege)
+			return
+		}
 		if err := user.Delete(); err != nil {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
@@ -159,3 +159,29 @@ func TestManageUserDeleteReturnsImmediatelyAndUnknownActionFails(t *testing.T) {
 	assert.EqualValues(t, 1, unchanged.AuthVersion)
 	assert.Equal(t, common.UserStatusEnabled, unchanged.Status)
 }
+
+func TestManageUserRejectsCustomRoleCallerTargetingThemselves(t *testing.T) {
+	db := setupManageUserTestDB(t)
+	caller := model.User{
+		Username: "managed-self-user", Password: "password", Role: common.RoleCommonUser,
+		Status: common.UserStatusEnabled, Group: "default", AuthVersion: 1, AffCode: "self-aff",
+	}
+	require.NoError(t, db.Create(&caller).Error)
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/user/manage",
+		strings.NewReader(fmt.Sprintf(`{"id":%d,"action":"add_quota","value":1000,"mode":"add"}`, caller.Id)))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("id", caller.Id)
+	c.Set("role", common.RoleCommonUser)
+	c.Set("username", caller.Username)
+	ManageUser(c)
+
+	assert.Contains(t, recorder.Body.String(), `"success":false`)
+	var unchanged model.User
+	require.NoError(t, db.First(&unchanged, caller.Id).Error)
+	assert.Equal(t, caller.Quota, unchanged.Quota)
+	assert.Equal(t, common.UserStatusEnabled, unchanged.Status)
+}
@@ -55,6 +55,16 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
+	// Serve the copy kept in gateway storage; fall back to upstream when it
+	// was evicted or cannot be read.
+	if assetID := task.PrivateData.AssetId; assetID != "" {
+		if asset, exist, err := model.GetMediaAssetByAssetId(assetID); err == nil && exist && asset.UserId == task.UserId {
+			if err := serveMediaAsset(c, asset, 86400); err == nil {
+				return
+			}
+		}
+	}
+
 	channel, err := model.CacheGetChannel(task.ChannelId)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to get channel for task %s: %s", taskID, err.Error()))
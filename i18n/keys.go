@@ -45,6 +45,9 @@ const (
 	MsgTokenNameTooLong          = "token.name_too_long"
 	MsgTokenQuotaNegative        = "token.quota_negative"
 	MsgTokenQuotaExceedMax       = "token.quota_exceed_max"
+	MsgTokenRateLimitNegative    = "token.rate_limit_negative"
+	MsgTokenModerationInvalid    = "token.moderation_invalid"
+	MsgTokenCallbackUrlInvalid   = "token.task_callback_url_invalid"
 	MsgTokenGenerateFailed       = "token.generate_failed"
 	MsgTokenGetInfoFailed        = "token.get_info_failed"
 	MsgTokenExpiredCannotEnable  = "token.expired_cannot_enable"
@@ -333,3 +336,42 @@ const (
 	MsgCustomOAuthBindingNotFound   = "custom_oauth.binding_not_found"
 	MsgCustomOAuthProviderIdInvalid = "custom_oauth.provider_id_field_invalid"
 )
+
+// Organization related messages
+const (
+	MsgOrganizationNotFound                = "organization.not_found"
+	MsgOrganizationNameInvalid             = "organization.name_invalid"
+	MsgOrganizationNotMember               = "organization.not_member"
+	MsgOrganizationPermissionDenied        = "organization.permission_denied"
+	MsgOrganizationRoleInvalid             = "organization.role_invalid"
+	MsgOrganizationBudgetNegative          = "organization.budget_negative"
+	MsgOrganizationMemberExists            = "organization.member_exists"
+	MsgOrganizationMemberNotFound          = "organization.member_not_found"
+	MsgOrganizationOwnerCannotLeave        = "organization.owner_cannot_leave"
+	MsgOrganizationInvitationInvalid       = "organization.invitation_invalid"
+	MsgOrganizationInvitationEmailMismatch = "organization.invitation_email_mismatch"
+	MsgOrganizationInvitationSendFailed    = "organization.invitation_send_failed"
+	MsgOrganizationQuotaInvalid            = "organization.quota_invalid"
+	MsgOrganizationWalletInsufficient      = "organization.wallet_insufficient"
+)
+
+// Authorization role related messages
+const (
+	MsgAuthzRoleNotFound   = "authz_role.not_found"
+	MsgAuthzRoleKeyInvalid = "authz_role.key_invalid"
+	MsgAuthzRoleKeyExists  = "authz_role.key_exists"
+	MsgAuthzRoleBuiltIn    = "authz_role.built_in"
+	MsgAuthzRoleNameEmpty  = "authz_role.name_empty"
+)
+
+// MCP server related messages
+const (
+	MsgMcpServerNotFound  = "mcp_server.not_found"
+	MsgMcpServerNameTaken = "mcp_server.name_taken"
+)
+
+// Prompt template related messages
+const (
+	MsgPromptTemplateNotFound        = "prompt_template.not_found"
+	MsgPromptTemplateVersionNotFound = "prompt_template.version_not_found"
+)
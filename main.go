@@ -24,6 +24,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	kitutil "github.com/QuantumNous/new-api/relaykit/relayconvert/kitutil"
 	"github.com/QuantumNous/new-api/router"
@@ -142,6 +143,10 @@ func main() {
 		}
 		return a
 	}
+	// Task callbacks carry the same payload the fetch endpoints return, which
+	// are built in the relay package.
+	service.TaskCallbackPayloadFunc = relay.BuildTaskCallbackPayload
+	service.MidjourneyCallbackPayloadFunc = relay.BuildMidjourneyCallbackPayload
 
 	// Register the periodic channel test, upstream model update, and async task
 	// polling (Midjourney / Suno / video) jobs as scheduled system tasks
@@ -170,6 +175,15 @@ func main() {
 		common.SysError(fmt.Sprintf("start pyroscope error : %v", err))
 	}
 
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		common.FatalLog("failed to initialize tracing: " + err.Error())
+		return
+	}
+	if tracing.Enabled() {
+		common.SysLog("opentelemetry tracing enabled")
+	}
+
 	// Initialize HTTP server
 	server := gin.New()
 	if err := middleware.ConfigureTrustedProxies(server); err != nil {
@@ -188,6 +202,7 @@ func main() {
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Tracing())
 	server.Use(middleware.Version())
 	server.Use(middleware.I18n())
 	middleware.SetUpLogger(server)
@@ -231,6 +246,9 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		common.SysError(fmt.Sprintf("server forced to shutdown: %v", err))
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		common.SysError(fmt.Sprintf("failed to flush traces: %v", err))
+	}
 	// 内存中的看板数据保存入库，避免重启丢失未落库数据 (issue #5679)
 	if common.DataExportEnabled {
 		model.SaveQuotaDataCache()
@@ -12,12 +12,14 @@ import (
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relaykit/types"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/service/authz"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 )
 
@@ -42,7 +44,9 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+// authHelper authenticates the dashboard user and requires minRole plus every
+// given permission.
+func authHelper(c *gin.Context, minRole int, permissions ...authz.Permission) {
 	user, identity, useAccessToken, err := authenticateDashboardRequest(c)
 	if err != nil {
 		writeDashboardAuthError(c, err)
@@ -60,13 +64,19 @@ func authHelper(c *gin.Context, minRole int) {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "code": "AUTH_USER_INVALID", "message": common.TranslateMessage(c, i18n.MsgAuthUserInfoInvalid)})
 		return
 	}
+	for _, permission := range permissions {
+		if !authz.Can(user.Id, user.Role, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "code": "AUTH_INSUFFICIENT_PRIVILEGE", "message": common.TranslateMessage(c, i18n.MsgAuthInsufficientPrivilege)})
+			return
+		}
+	}
 	setDashboardAuthContext(c, user, identity, useAccessToken)
 
-	// 管理/root 写操作审计兜底：内聚在鉴权链路里，保证任何经过 AdminAuth/RootAuth
+	// 管理/root 写操作审计兜底：内聚在鉴权链路里，保证任何经过 AdminAuth/RootAuth/PermissionAuth
 	// 的写接口都会自动留痕（无需在路由上单独挂审计中间件，避免漏挂）。
 	// handler 内手动埋点者会设置 ContextKeyAuditLogged，finishAdminAudit 据此跳过。
 	var auditWriter *auditResponseWriter
-	if minRole >= common.RoleAdminUser {
+	if minRole >= common.RoleAdminUser || len(permissions) > 0 {
 		auditWriter = beginAdminAudit(c)
 	}
 
@@ -107,6 +117,15 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// PermissionAuth admits any dashboard user holding the permission, either via
+// the admin baseline or via an assigned custom role, so management routes no
+// longer require the admin system role.
+func PermissionAuth(permission authz.Permission) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, permission)
+	}
+}
+
 // GetAuthIdentity returns a dashboard session identity. PAT-authenticated
 // requests intentionally have no SessionID and cannot manage browser sessions.
 func GetAuthIdentity(c *gin.Context) (service.AuthIdentity, bool) {
@@ -223,22 +242,6 @@ func writeDashboardAuthError(c *gin.Context, err error) {
 	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "code": "AUTH_INTERNAL_ERROR", "message": common.TranslateMessage(c, i18n.MsgDatabaseError)})
 }
 
-func RequirePermission(permission authz.Permission) func(c *gin.Context) {
-	return func(c *gin.Context) {
-		role := c.GetInt("role")
-		userID := c.GetInt("id")
-		if authz.Can(userID, role, permission) {
-			c.Next()
-			return
-		}
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"message": common.TranslateMessage(c, i18n.MsgAuthInsufficientPrivilege),
-		})
-		c.Abort()
-	}
-}
-
 func WssAuth(c *gin.Context) {
 
 }
@@ -351,6 +354,8 @@ func TokenAuthReadOnly() func(c *gin.Context) {
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span := tracing.StartGinSpan(c, "auth.token")
+		defer span.End(nil)
 		// 先检测是否为ws
 		if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
 			// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
@@ -376,6 +381,9 @@ func TokenAuth() func(c *gin.Context) {
 		// gemini api 从query中获取key
 		if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models") ||
 			strings.HasPrefix(c.Request.URL.Path, "/v1beta/openai/models") ||
+			strings.HasPrefix(c.Request.URL.Path, "/v1beta/files") ||
+			strings.HasPrefix(c.Request.URL.Path, "/v1beta/cachedContents") ||
+			strings.HasPrefix(c.Request.URL.Path, "/upload/v1beta/files") ||
 			strings.HasPrefix(c.Request.URL.Path, "/v1/models/") {
 			skKey := c.Query("key")
 			if skKey != "" {
@@ -478,6 +486,8 @@ func TokenAuth() func(c *gin.Context) {
 		if err != nil {
 			return
 		}
+		span.SetAttributes(attribute.Int("user.id", token.UserId), attribute.Int("token.id", token.Id), attribute.String("group", userGroup))
+		span.End(nil)
 		c.Next()
 	}
 }
@@ -502,6 +512,14 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenResponseCache, token.ResponseCache)
+	common.SetContextKey(c, constant.ContextKeyTokenHedge, token.Hedge)
+	common.SetContextKey(c, constant.ContextKeyTokenTPMLimit, token.TPMLimit)
+	common.SetContextKey(c, constant.ContextKeyTokenTPDLimit, token.TPDLimit)
+	common.SetContextKey(c, constant.ContextKeyTokenConcurrencyLimit, token.ConcurrencyLimit)
+	common.SetContextKey(c, constant.ContextKeyTokenOrganizationId, token.OrganizationId)
+	common.SetContextKey(c, constant.ContextKeyTokenModeration, token.Moderation)
+	common.SetContextKey(c, constant.ContextKeyTokenTaskCallbackUrl, token.TaskCallbackUrl)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
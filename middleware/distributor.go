@@ -15,6 +15,7 @@ import (
 	taskdto "github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relaykit/dto"
 	"github.com/QuantumNous/new-api/relaykit/types"
@@ -39,6 +40,16 @@ func Distribute() func(c *gin.Context) {
 			abortWithOpenAiMessage(c, http.StatusBadRequest, i18n.T(c, i18n.MsgDistributorInvalidRequest, map[string]any{"Error": err.Error()}))
 			return
 		}
+		// Gemini files / cachedContents are checked for ownership even when the token is bound to a channel
+		geminiPin, err := getGeminiResourcePin(c)
+		if err != nil {
+			if errors.Is(err, service.ErrGeminiResourceNotFound) {
+				abortWithOpenAiMessage(c, http.StatusNotFound, err.Error())
+			} else {
+				abortWithOpenAiMessage(c, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
 			if err != nil {
@@ -102,10 +113,16 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+				if pinned, pinnedGroup := getFilePinnedChannel(c, modelRequest.Model, usingGroup, geminiPin); pinned != nil {
+					channel = pinned
+					selectGroup = pinnedGroup
+				} else if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
 					affinityUsable := false
 					preferred, err := model.CacheGetChannel(preferredChannelID)
+					// A preferred channel whose breaker is open is skipped like a disabled
+					// one, so the request falls back to normal selection.
 					if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled &&
+						circuitbreaker.Available(preferred.Id, circuitbreaker.ChannelLevel) &&
 						channelSupportsRequestPath(preferred, c.Request.URL.Path, modelRequest.Model) {
 						if usingGroup == "auto" {
 							userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
@@ -127,7 +144,10 @@ func Distribute() func(c *gin.Context) {
 							service.MarkChannelAffinityUsed(c, usingGroup, preferred.Id)
 						}
 					}
-					if !affinityUsable && !service.ShouldKeepChannelAffinityOnChannelDisabled() {
+					if affinityUsable {
+						// A half-open preferred channel uses up one of its probe requests.
+						circuitbreaker.Admit(preferred.Id, circuitbreaker.ChannelLevel)
+					} else if !service.ShouldKeepChannelAffinityOnChannelDisabled() {
 						service.ClearCurrentChannelAffinityCache(c)
 					}
 				}
@@ -163,6 +183,9 @@ func Distribute() func(c *gin.Context) {
 		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		if geminiPin != nil && channel != nil && channel.Id == geminiPin.ChannelId {
+			useGeminiResourceKey(c, channel, geminiPin.KeyIndex)
+		}
 		c.Next()
 		if channel != nil && c.Writer != nil && c.Writer.Status() < http.StatusBadRequest {
 			service.RecordChannelAffinity(c, channel.Id)
@@ -170,6 +193,86 @@ func Distribute() func(c *gin.Context) {
 	}
 }
 
+// readJSONRequestBody returns the body of a JSON request and rewinds it for
+// the handlers that follow.
+func readJSONRequestBody(c *gin.Context) ([]byte, bool) {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return nil, false
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil, false
+	}
+	requestBody, err := storage.Bytes()
+	if err != nil {
+		return nil, false
+	}
+	if _, seekErr := storage.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, false
+	}
+	c.Request.Body = io.NopCloser(storage)
+	return requestBody, true
+}
+
+// getGeminiResourcePin resolves the Gemini files and cached contents a request
+// references, failing when any of them belongs to another user.
+func getGeminiResourcePin(c *gin.Context) (*service.GeminiResourcePin, error) {
+	requestBody, ok := readJSONRequestBody(c)
+	if !ok {
+		return nil, nil
+	}
+	return service.ResolveGeminiResourcePin(c.GetInt("id"), requestBody)
+}
+
+// useGeminiResourceKey switches a multi-key channel to the key the referenced
+// Gemini resources were created with; other keys may belong to other projects.
+func useGeminiResourceKey(c *gin.Context, channel *model.Channel, keyIndex int) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return
+	}
+	keys := channel.GetKeys()
+	if keyIndex < 0 || keyIndex >= len(keys) {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, keyIndex)
+	common.SetContextKey(c, constant.ContextKeyChannelKey, keys[keyIndex])
+}
+
+// getFilePinnedChannel returns the channel that owns an upstream file referenced
+// by the request body. Files passed through to a channel via /v1/files, and
+// Gemini files or cached contents, are only visible on that channel, so the
+// request must be routed there.
+func getFilePinnedChannel(c *gin.Context, modelName string, usingGroup string, geminiPin *service.GeminiResourcePin) (*model.Channel, string) {
+	channelId, ok := 0, false
+	if requestBody, hasBody := readJSONRequestBody(c); hasBody {
+		channelId, ok = service.GetFilePinnedChannelId(c.GetInt("id"), requestBody)
+	}
+	if !ok && geminiPin != nil {
+		channelId, ok = geminiPin.ChannelId, true
+	}
+	if !ok {
+		return nil, ""
+	}
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil || channel == nil || channel.Status != common.ChannelStatusEnabled {
+		return nil, ""
+	}
+	if usingGroup == "auto" {
+		userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+		for _, g := range service.GetUserAutoGroup(userGroup) {
+			if model.IsChannelEnabledForGroupModel(g, modelName, channel.Id) {
+				common.SetContextKey(c, constant.ContextKeyAutoGroup, g)
+				return channel, g
+			}
+		}
+		return nil, ""
+	}
+	if !model.IsChannelEnabledForGroupModel(usingGroup, modelName, channel.Id) {
+		return nil, ""
+	}
+	return channel, usingGroup
+}
+
 // channelSupportsRequestPath reports whether a channel can serve the request path.
 // Only Advanced Custom (type 58) channels are path-checked; all other channel types
 // always pass. A type-58 channel is usable only when one of its routes matches.
@@ -471,6 +574,9 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		return newAPIError
 	}
 	if channel.ChannelInfo.IsMultiKey {
+		// A chosen half-open key uses up one of its probe requests; only relay
+		// selection admits so other users of the key do not consume probes.
+		circuitbreaker.Admit(channel.Id, index)
 		common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, true)
 		common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, index)
 	} else {
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	tokenlimiter "github.com/QuantumNous/new-api/pkg/token_limiter"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formatRateLimitReset formats a window reset the way OpenAI's
+// x-ratelimit-reset-* headers do, e.g. "6m0s" or "1.5s".
+func formatRateLimitReset(d time.Duration) string {
+	if d < time.Second {
+		d = d.Round(time.Millisecond)
+	} else {
+		d = d.Round(time.Second)
+	}
+	return d.String()
+}
+
+// abortWithRateLimitExceeded rejects the request with an OpenAI compatible
+// 429 body so client SDKs recognise it and back off for retryAfter.
+func abortWithRateLimitExceeded(c *gin.Context, errType string, message string, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": gin.H{
+			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			"type":    errType,
+			"param":   nil,
+			"code":    "rate_limit_exceeded",
+		},
+	})
+	c.Abort()
+	logger.LogWarn(c.Request.Context(), fmt.Sprintf("token %d | %s", c.GetInt("token_id"), message))
+}
+
+// TokenRateLimit enforces the tokens per minute/day and concurrent request
+// limits of the API token, falling back to the defaults of its group.
+func TokenRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !operation_setting.GetTokenRateLimitSetting().Enabled {
+			c.Next()
+			return
+		}
+		tokenId := c.GetInt("token_id")
+		if tokenId == 0 {
+			c.Next()
+			return
+		}
+		group := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
+		if group == "" {
+			group = common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+		}
+		tpd, _ := common.GetContextKeyType[int64](c, constant.ContextKeyTokenTPDLimit)
+		limits := operation_setting.ResolveTokenRateLimits(operation_setting.TokenRateLimits{
+			TPM:         common.GetContextKeyInt(c, constant.ContextKeyTokenTPMLimit),
+			TPD:         tpd,
+			Concurrency: common.GetContextKeyInt(c, constant.ContextKeyTokenConcurrencyLimit),
+		}, group)
+
+		if limits.TPM > 0 || limits.TPD > 0 {
+			usage, err := tokenlimiter.GetUsage(c.Request.Context(), tokenId)
+			if err != nil {
+				logger.LogError(c.Request.Context(), fmt.Sprintf("token rate limit check failed: %v", err))
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+				return
+			}
+			if limits.TPM > 0 {
+				remaining := max(int64(limits.TPM)-usage.MinuteTokens, 0)
+				c.Header("x-ratelimit-limit-tokens", strconv.Itoa(limits.TPM))
+				c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(remaining, 10))
+				c.Header("x-ratelimit-reset-tokens", formatRateLimitReset(usage.MinuteReset))
+				if remaining == 0 {
+					abortWithRateLimitExceeded(c, "tokens", fmt.Sprintf("Rate limit reached on tokens per min (TPM): Limit %d, Used %d. Please try again in %s.", limits.TPM, usage.MinuteTokens, formatRateLimitReset(usage.MinuteReset)), usage.MinuteReset)
+					return
+				}
+			}
+			if limits.TPD > 0 {
+				remaining := max(limits.TPD-usage.DayTokens, 0)
+				c.Header("x-ratelimit-limit-tokens-day", strconv.FormatInt(limits.TPD, 10))
+				c.Header("x-ratelimit-remaining-tokens-day", strconv.FormatInt(remaining, 10))
+				c.Header("x-ratelimit-reset-tokens-day", formatRateLimitReset(usage.DayReset))
+				if remaining == 0 {
+					abortWithRateLimitExceeded(c, "tokens", fmt.Sprintf("Rate limit reached on tokens per day (TPD): Limit %d, Used %d. Please try again in %s.", limits.TPD, usage.DayTokens, formatRateLimitReset(usage.DayReset)), usage.DayReset)
+					return
+				}
+			}
+		}
+
+		if limits.Concurrency > 0 {
+			ok, inFlight, release, err := tokenlimiter.Acquire(c.Request.Context(), tokenId, limits.Concurrency)
+			if err != nil {
+				logger.LogError(c.Request.Context(), fmt.Sprintf("token concurrency check failed: %v", err))
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+				return
+			}
+			c.Header("x-ratelimit-limit-concurrency", strconv.Itoa(limits.Concurrency))
+			if !ok {
+				c.Header("x-ratelimit-remaining-concurrency", "0")
+				abortWithRateLimitExceeded(c, "requests", fmt.Sprintf("Rate limit reached on concurrent requests: Limit %d, In flight %d. Please try again once a request finishes.", limits.Concurrency, inFlight), time.Second)
+				return
+			}
+			c.Header("x-ratelimit-remaining-concurrency", strconv.FormatInt(int64(limits.Concurrency)-inFlight, 10))
+			defer release()
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	tokenlimiter "github.com/QuantumNous/new-api/pkg/token_limiter"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useTokenRateLimit(t *testing.T, limits operation_setting.TokenRateLimits) {
+	t.Helper()
+	setting := operation_setting.GetTokenRateLimitSetting()
+	previous := *setting
+	setting.Enabled = true
+	setting.Default = limits
+	setting.Groups = map[string]operation_setting.TokenRateLimits{}
+	tokenlimiter.Reset()
+	t.Cleanup(func() {
+		*setting = previous
+		tokenlimiter.Reset()
+	})
+}
+
+func newTokenRateLimitRouter(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("token_id", 42)
+		common.SetContextKey(c, constant.ContextKeyTokenGroup, "default")
+	})
+	router.Use(TokenRateLimit())
+	router.GET("/", handler)
+	return router
+}
+
+func TestTokenRateLimitRejectsAfterTPMIsUsed(t *testing.T) {
+	previousRedisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = previousRedisEnabled })
+	useTokenRateLimit(t, operation_setting.TokenRateLimits{TPM: 100})
+	router := newTokenRateLimitRouter(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "100", recorder.Header().Get("x-ratelimit-limit-tokens"))
+	assert.Equal(t, "100", recorder.Header().Get("x-ratelimit-remaining-tokens"))
+
+	require.NoError(t, tokenlimiter.AddTokens(context.Background(), 42, 120))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "0", recorder.Header().Get("x-ratelimit-remaining-tokens"))
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+	assert.Contains(t, recorder.Body.String(), `"code":"rate_limit_exceeded"`)
+	assert.Contains(t, recorder.Body.String(), `"type":"tokens"`)
+}
+
+func TestTokenRateLimitCapsConcurrentRequests(t *testing.T) {
+	useRateLimitMiniRedis(t)
+	useTokenRateLimit(t, operation_setting.TokenRateLimits{Concurrency: 1})
+	inner := httptest.NewRecorder()
+	var router *gin.Engine
+	router = newTokenRateLimitRouter(func(c *gin.Context) {
+		// A second request while this one is in flight is rejected.
+		router.ServeHTTP(inner, httptest.NewRequest(http.MethodGet, "/", nil))
+		c.Status(http.StatusOK)
+	})
+
+	outer := httptest.NewRecorder()
+	router.ServeHTTP(outer, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, outer.Code)
+	assert.Equal(t, http.StatusTooManyRequests, inner.Code)
+	assert.Contains(t, inner.Body.String(), `"type":"requests"`)
+
+	// The slot is released once the request finished.
+	ok, _, release, err := tokenlimiter.Acquire(context.Background(), 42, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	release()
+}
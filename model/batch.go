@@ -0,0 +1,200 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+
+	// BatchModeLocal 由网关自己逐行走正常转发链路执行
+	BatchModeLocal = "local"
+	// BatchModeUpstream 整批转交给支持 Batch API 的上游渠道执行
+	BatchModeUpstream = "upstream"
+
+	// BatchEndpointClaudeMessages 通过 /v1/messages/batches 创建的 Anthropic Message Batches，
+	// 与 /v1/batches 共用执行器，但各自的接口互不可见
+	BatchEndpointClaudeMessages = "/v1/messages"
+)
+
+// Batch 是通过 /v1/batches 创建的批处理任务。BatchId 对外暴露（batch_xxx）。
+// 本地执行时 CompletedCount+FailedCount 即已处理的输入行数，执行器据此在重启后断点续跑。
+type Batch struct {
+	Id               int    `json:"id"`
+	BatchId          string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	Group            string `json:"group" gorm:"type:varchar(64)"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(128)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(128)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(128)"`
+	Status           string `json:"status" gorm:"type:varchar(16);index"`
+	Mode             string `json:"mode" gorm:"type:varchar(16)"`
+	ChannelId        int    `json:"channel_id" gorm:"index"`
+	UpstreamBatchId  string `json:"upstream_batch_id" gorm:"type:varchar(128)"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	Errors           string `json:"errors" gorm:"type:text"`
+	TotalCount       int    `json:"total_count" gorm:"default:0"`
+	CompletedCount   int    `json:"completed_count" gorm:"default:0"`
+	FailedCount      int    `json:"failed_count" gorm:"default:0"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+	// 上游执行的计费上下文：提交上游前按请求的模型预扣 Quota，落终态前按实际用量差额结算
+	Quota          int    `json:"quota" gorm:"default:0"`
+	BillingSource  string `json:"billing_source" gorm:"type:varchar(16);default:''"`
+	SubscriptionId int    `json:"subscription_id" gorm:"default:0"`
+	OrganizationId int    `json:"organization_id" gorm:"default:0"`
+	QuotaSettled   bool   `json:"quota_settled" gorm:"default:false"`
+}
+
+func activeBatchStatuses() []string {
+	return []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}
+}
+
+func (batch *Batch) Insert() error {
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(batch).Error
+}
+
+// SaveIfStatus 仅当数据库中的状态仍为 expected 时保存全部字段，避免覆盖并发写入的取消请求
+func (batch *Batch) SaveIfStatus(expected string) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? AND status = ?", batch.Id, expected).Select("*").Updates(batch)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateBilling 保存计费上下文，预扣成功后立即落库，执行器崩溃重启后仍可结算或退款
+func (batch *Batch) UpdateBilling() error {
+	return DB.Model(batch).Select("quota", "billing_source", "subscription_id", "organization_id", "quota_settled").Updates(batch).Error
+}
+
+// SettleQuota 仅当批处理尚未结算且额度仍为 expected 时把额度改写为最终值并标记已结算，
+// 差额结算与退款都以此认领，保证多个执行器或重试只执行一次
+func (batch *Batch) SettleQuota(expected int, quota int) (bool, error) {
+	result := DB.Model(&Batch{}).
+		Where("id = ? AND quota = ? AND quota_settled = ?", batch.Id, expected, false).
+		Updates(map[string]any{"quota": quota, "quota_settled": true})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	batch.Quota = quota
+	batch.QuotaSettled = true
+	return true, nil
+}
+
+// UpdateProgress 只更新请求计数
+func (batch *Batch) UpdateProgress() error {
+	return DB.Model(batch).Select("total_count", "completed_count", "failed_count").Updates(batch).Error
+}
+
+func (batch *Batch) IsActive() bool {
+	for _, status := range activeBatchStatuses() {
+		if batch.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsClaudeMessageBatch 是否为 Anthropic Message Batches 创建的批处理
+func (batch *Batch) IsClaudeMessageBatch() bool {
+	return batch.Endpoint == BatchEndpointClaudeMessages
+}
+
+// ProcessedCount 已处理（成功或失败）的输入行数
+func (batch *Batch) ProcessedCount() int {
+	return batch.CompletedCount + batch.FailedCount
+}
+
+func GetUserBatchByBatchId(userId int, batchId string) (*Batch, error) {
+	var batch Batch
+	err := DB.Where("user_id = ? AND batch_id = ?", userId, batchId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetBatchById(id int) (*Batch, error) {
+	var batch Batch
+	err := DB.First(&batch, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// ListUserBatches 按创建时间倒序的游标分页，返回 limit+1 条以便调用方判断 has_more；
+// claudeMessages 区分 Message Batches 与 /v1/batches 的批处理
+func ListUserBatches(userId int, claudeMessages bool, after string, limit int) ([]*Batch, error) {
+	query := DB.Where("user_id = ?", userId)
+	if claudeMessages {
+		query = query.Where("endpoint = ?", BatchEndpointClaudeMessages)
+	} else {
+		query = query.Where("endpoint <> ?", BatchEndpointClaudeMessages)
+	}
+	if after != "" {
+		var cursor Batch
+		if err := DB.Select("id").Where("user_id = ? AND batch_id = ?", userId, after).First(&cursor).Error; err != nil {
+			return nil, err
+		}
+		query = query.Where("id < ?", cursor.Id)
+	}
+	var batches []*Batch
+	err := query.Order("id desc").Limit(limit + 1).Find(&batches).Error
+	return batches, err
+}
+
+func DeleteBatchById(id int) error {
+	return DB.Delete(&Batch{}, "id = ?", id).Error
+}
+
+// MarkBatchCancelling 仅在批处理仍处于活动状态时将其标记为取消中，返回是否更新成功
+func MarkBatchCancelling(id int) (bool, error) {
+	result := DB.Model(&Batch{}).
+		Where("id = ? AND status IN ?", id, []string{BatchStatusValidating, BatchStatusInProgress}).
+		Updates(map[string]any{
+			"status":        BatchStatusCancelling,
+			"cancelling_at": common.GetTimestamp(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetBatchStatus 读取最新状态，执行器据此感知用户取消
+func GetBatchStatus(id int) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Select("status").Where("id = ?", id).Scan(&status).Error
+	return status, err
+}
+
+func HasActiveBatches() bool {
+	var count int64
+	if err := DB.Model(&Batch{}).Where("status IN ?", activeBatchStatuses()).Limit(1).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// GetActiveBatches 获取需要执行器推进的批处理，按创建顺序
+func GetActiveBatches(limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status IN ?", activeBatchStatuses()).Order("id asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
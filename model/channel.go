@@ -12,6 +12,8 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	keyusage "github.com/QuantumNous/new-api/pkg/key_usage"
 	"github.com/QuantumNous/new-api/relaykit/dto"
 	"github.com/QuantumNous/new-api/relaykit/types"
 
@@ -23,7 +25,7 @@ import (
 type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"not null"`
+	Key                string  `json:"key" gorm:"not null;serializer:secret_lines"` // 加密存储，见 secret.go
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -57,6 +59,8 @@ type Channel struct {
 
 	// cache info
 	Keys []string `json:"-" gorm:"-"`
+	// 熔断状态，仅在渠道列表中填充
+	CircuitBreaker *circuitbreaker.ChannelStatus `json:"circuit_breaker,omitempty" gorm:"-"`
 }
 
 type ChannelInfo struct {
@@ -67,6 +71,13 @@ type ChannelInfo struct {
 	MultiKeyDisabledTime   map[int]int64         `json:"multi_key_disabled_time,omitempty"`   // key禁用时间列表，key index -> time
 	MultiKeyPollingIndex   int                   `json:"multi_key_polling_index"`             // 多Key模式下轮询的key索引
 	MultiKeyMode           constant.MultiKeyMode `json:"multi_key_mode"`
+	MultiKeyLimits         map[int]MultiKeyLimit `json:"multi_key_limits,omitempty"` // key限额列表，key index -> limit，weighted 模式按此加权
+}
+
+// MultiKeyLimit 是单个key在上游的速率限额，0 表示不限
+type MultiKeyLimit struct {
+	RPM int `json:"rpm"`
+	TPM int `json:"tpm"`
 }
 
 type ChannelSortOptions struct {
@@ -196,11 +207,16 @@ func (channel *Channel) GetKeys() []string {
 	return keys
 }
 
-func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+func (channel *Channel) GetNextEnabledKey() (key string, keyIndex int, apiErr *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
 	}
+	defer func() {
+		if apiErr == nil {
+			keyusage.RecordRequest(channel.Id, keyIndex)
+		}
+	}()
 
 	// Obtain all keys (split by \n)
 	keys := channel.GetKeys()
@@ -238,6 +254,20 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	if len(enabledIdx) == 0 {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	// Skip keys whose circuit breaker is open and, in rate-limit-aware modes,
+	// keys cooling down after a 429, unless that would leave nothing to pick.
+	enabledIdx = filterKeyIndexes(enabledIdx, func(idx int) bool {
+		return circuitbreaker.Available(channel.Id, idx)
+	})
+	if channel.ChannelInfo.MultiKeyMode.IsRateLimitAware() {
+		enabledIdx = filterKeyIndexes(enabledIdx, func(idx int) bool {
+			return !keyusage.CoolingDown(channel.Id, idx)
+		})
+	}
+	selectable := make(map[int]bool, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		selectable[idx] = true
+	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
@@ -268,7 +298,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if selectable[idx] {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -276,6 +306,36 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		// Fallback – should not happen, but return first enabled key
 		return keys[enabledIdx[0]], enabledIdx[0], nil
+	case constant.MultiKeyModeLRU:
+		selectedIdx := pickLeastRecentlyUsedKey(channel.Id, enabledIdx)
+		return keys[selectedIdx], selectedIdx, nil
+	case constant.MultiKeyModeWeighted:
+		selectedIdx := pickWeightedKey(channel.Id, enabledIdx, channel.ChannelInfo.MultiKeyLimits)
+		return keys[selectedIdx], selectedIdx, nil
+	case constant.MultiKeyModeSticky:
+		channelInfo, err := CacheGetChannelInfo(channel.Id)
+		if err != nil {
+			return "", 0, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+		}
+		// Stay on the current key while it is selectable; a 429 takes it out of
+		// the selectable set and moves on to the next one.
+		start := channelInfo.MultiKeyPollingIndex
+		if start < 0 || start >= len(keys) {
+			start = 0
+		}
+		for i := 0; i < len(keys); i++ {
+			idx := (start + i) % len(keys)
+			if selectable[idx] {
+				if idx != channel.ChannelInfo.MultiKeyPollingIndex {
+					channel.ChannelInfo.MultiKeyPollingIndex = idx
+					if !common.MemoryCacheEnabled {
+						_ = channel.SaveChannelInfo()
+					}
+				}
+				return keys[idx], idx, nil
+			}
+		}
+		return keys[enabledIdx[0]], enabledIdx[0], nil
 	default:
 		// Unknown mode, default to first enabled key (or original key string)
 		return keys[enabledIdx[0]], enabledIdx[0], nil
@@ -397,8 +457,7 @@ func SearchChannels(keyword string, group string, model string, idSort bool, sor
 	baseQuery := DB.Model(&Channel{}).Omit("key")
 
 	// 构造WHERE子句
-	whereClause := "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-	args := []any{common.String2Int(keyword), "%" + keyword + "%", keyword, "%" + keyword + "%", "%" + model + "%"}
+	whereClause, args := channelSearchCondition(keyword, model, baseURLCol, modelsCol)
 	baseQuery = ApplyChannelGroupFilter(baseQuery.Where(whereClause, args...), group)
 
 	// 执行查询
@@ -409,6 +468,17 @@ func SearchChannels(keyword string, group string, model string, idSort bool, sor
 	return channels, nil
 }
 
+// channelSearchCondition 构造渠道搜索的 WHERE 子句。
+// 启用密钥加密后 key 列保存的是密文，明文等值匹配永远不会命中，此时不再按 key 搜索。
+func channelSearchCondition(keyword string, model string, baseURLCol string, modelsCol string) (string, []any) {
+	if common.SecretEncryptionEnabled() {
+		return "(id = ? OR name LIKE ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?",
+			[]any{common.String2Int(keyword), "%" + keyword + "%", "%" + keyword + "%", "%" + model + "%"}
+	}
+	return "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?",
+		[]any{common.String2Int(keyword), "%" + keyword + "%", keyword, "%" + keyword + "%", "%" + model + "%"}
+}
+
 func GetChannelById(id int, selectAll bool) (*Channel, error) {
 	channel := &Channel{Id: id}
 	var err error = nil
@@ -567,6 +637,11 @@ func (channel *Channel) Update() error {
 				}
 			}
 		}
+		for idx := range channel.ChannelInfo.MultiKeyLimits {
+			if idx >= channel.ChannelInfo.MultiKeySize {
+				delete(channel.ChannelInfo.MultiKeyLimits, idx)
+			}
+		}
 	}
 	var err error
 	err = DB.Model(channel).Updates(channel).Error
@@ -923,8 +998,7 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 	baseQuery := DB.Model(&Channel{}).Omit("key")
 
 	// 构造WHERE子句
-	whereClause := "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-	args := []any{common.String2Int(keyword), "%" + keyword + "%", keyword, "%" + keyword + "%", "%" + model + "%"}
+	whereClause, args := channelSearchCondition(keyword, model, baseURLCol, modelsCol)
 	baseQuery = ApplyChannelGroupFilter(baseQuery.Where(whereClause, args...), group)
 
 	subQuery := baseQuery.
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	keyusage "github.com/QuantumNous/new-api/pkg/key_usage"
+)
+
+const (
+	// defaultKeyCooldown 是上游 429 未携带 Retry-After 时 key 的冷却时长
+	defaultKeyCooldown = time.Minute
+	// maxKeyCooldown 限制 Retry-After 的最长冷却时长，避免异常值让 key 长期不可用
+	maxKeyCooldown = time.Hour
+)
+
+// filterKeyIndexes 保留满足 keep 的 key，若一个都不满足则原样返回，宁可继续尝试也不让渠道无 key 可用
+func filterKeyIndexes(indexes []int, keep func(idx int) bool) []int {
+	kept := make([]int, 0, len(indexes))
+	for _, idx := range indexes {
+		if keep(idx) {
+			kept = append(kept, idx)
+		}
+	}
+	if len(kept) == 0 {
+		return indexes
+	}
+	return kept
+}
+
+// usesPollingIndex 判断该模式是否使用 MultiKeyPollingIndex 记录位置
+func usesPollingIndex(mode constant.MultiKeyMode) bool {
+	return mode == constant.MultiKeyModePolling || mode == constant.MultiKeyModeSticky
+}
+
+// pickLeastRecentlyUsedKey 选择最久未被使用的 key，从未使用过的 key 优先
+func pickLeastRecentlyUsedKey(channelId int, indexes []int) int {
+	selected := indexes[0]
+	selectedAt := keyusage.LastUsed(channelId, selected)
+	for _, idx := range indexes[1:] {
+		lastUsed := keyusage.LastUsed(channelId, idx)
+		if lastUsed.Before(selectedAt) {
+			selected, selectedAt = idx, lastUsed
+		}
+	}
+	return selected
+}
+
+// pickWeightedKey 按 key 在当前分钟内剩余的限额加权随机选择。
+// 权重为配置的 RPM（未配置 RPM 时为 TPM）乘以 RPM、TPM 中剩余比例较小者；
+// 未配置限额的 key 取已配置 key 的平均权重，都未配置时等概率选择。
+func pickWeightedKey(channelId int, indexes []int, limits map[int]MultiKeyLimit) int {
+	weights := make([]float64, len(indexes))
+	var configuredSum float64
+	configured := 0
+	for i, idx := range indexes {
+		limit, ok := limits[idx]
+		if !ok || (limit.RPM <= 0 && limit.TPM <= 0) {
+			weights[i] = -1
+			continue
+		}
+		usage := keyusage.Get(channelId, idx)
+		capacity := float64(limit.RPM)
+		if limit.RPM <= 0 {
+			capacity = float64(limit.TPM)
+		}
+		headroom := 1.0
+		if limit.RPM > 0 {
+			headroom = math.Min(headroom, 1-float64(usage.RequestsThisMinute)/float64(limit.RPM))
+		}
+		if limit.TPM > 0 {
+			headroom = math.Min(headroom, 1-float64(usage.TokensThisMinute)/float64(limit.TPM))
+		}
+		weights[i] = capacity * math.Max(headroom, 0)
+		configuredSum += capacity
+		configured++
+	}
+
+	defaultWeight := 1.0
+	if configured > 0 {
+		defaultWeight = configuredSum / float64(configured)
+	}
+	var sum float64
+	for i := range weights {
+		if weights[i] < 0 {
+			weights[i] = defaultWeight
+		}
+		sum += weights[i]
+	}
+	// 所有 key 的额度都已用尽时等概率选择，交给上游限流决定
+	if sum <= 0 {
+		return indexes[rand.Intn(len(indexes))]
+	}
+	r := rand.Float64() * sum
+	for i, w := range weights {
+		r -= w
+		if r < 0 {
+			return indexes[i]
+		}
+	}
+	return indexes[len(indexes)-1]
+}
+
+// CoolDownChannelKey 在上游对多key渠道返回 429 时让该 key 冷却 retryAfter（为 0 时使用默认时长）。
+// 仅对感知限流的多key模式生效，返回 false 时调用方按原有逻辑处理（例如自动禁用该 key）。
+func CoolDownChannelKey(channelId int, keyIndex int, retryAfter time.Duration) bool {
+	channelInfo, err := CacheGetChannelInfo(channelId)
+	if err != nil || !channelInfo.IsMultiKey || !channelInfo.MultiKeyMode.IsRateLimitAware() {
+		return false
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultKeyCooldown
+	}
+	keyusage.CoolDown(channelId, keyIndex, min(retryAfter, maxKeyCooldown))
+	return true
+}
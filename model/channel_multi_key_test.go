@@ -0,0 +1,104 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	keyusage "github.com/QuantumNous/new-api/pkg/key_usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useCachedMultiKeyChannel(t *testing.T, mode constant.MultiKeyMode) *Channel {
+	t.Helper()
+	channel := &Channel{
+		Id:  9001,
+		Key: "k0\nk1\nk2",
+		ChannelInfo: ChannelInfo{
+			IsMultiKey:   true,
+			MultiKeySize: 3,
+			MultiKeyMode: mode,
+		},
+	}
+	channel.Keys = channel.GetKeys()
+
+	previousEnabled := common.MemoryCacheEnabled
+	channelSyncLock.Lock()
+	previousChannels := channelsIDM
+	channelsIDM = map[int]*Channel{channel.Id: channel}
+	channelSyncLock.Unlock()
+	common.MemoryCacheEnabled = true
+	keyusage.Reset()
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled = previousEnabled
+		channelSyncLock.Lock()
+		channelsIDM = previousChannels
+		channelSyncLock.Unlock()
+		keyusage.Reset()
+	})
+	return channel
+}
+
+func TestStickyKeyRotatesOnlyAfterRateLimit(t *testing.T) {
+	channel := useCachedMultiKeyChannel(t, constant.MultiKeyModeSticky)
+
+	for i := 0; i < 5; i++ {
+		_, idx, err := channel.GetNextEnabledKey()
+		require.Nil(t, err)
+		assert.Equal(t, 0, idx)
+	}
+
+	require.True(t, CoolDownChannelKey(channel.Id, 0, 30*time.Second))
+	for i := 0; i < 5; i++ {
+		_, idx, err := channel.GetNextEnabledKey()
+		require.Nil(t, err)
+		assert.Equal(t, 1, idx)
+	}
+	assert.Equal(t, int64(1), keyusage.Get(channel.Id, 0).RateLimited)
+	assert.NotZero(t, keyusage.Get(channel.Id, 0).CooldownUntil)
+	assert.Empty(t, channel.ChannelInfo.MultiKeyStatusList, "a rate limited key is not disabled")
+}
+
+func TestLeastRecentlyUsedKeyCyclesThroughKeys(t *testing.T) {
+	channel := useCachedMultiKeyChannel(t, constant.MultiKeyModeLRU)
+
+	seen := map[int]bool{}
+	for i := 0; i < 3; i++ {
+		_, idx, err := channel.GetNextEnabledKey()
+		require.Nil(t, err)
+		seen[idx] = true
+		// LastUsed has a monotonic clock reading, but keep picks clearly ordered.
+		time.Sleep(time.Millisecond)
+	}
+	assert.Len(t, seen, 3)
+}
+
+func TestWeightedKeyFollowsRemainingLimits(t *testing.T) {
+	keyusage.Reset()
+	t.Cleanup(keyusage.Reset)
+
+	limits := map[int]MultiKeyLimit{
+		0: {RPM: 900},
+		1: {RPM: 100},
+		2: {RPM: 100},
+	}
+	// Key 2 has used up its requests for this minute.
+	for i := 0; i < 100; i++ {
+		keyusage.RecordRequest(1, 2)
+	}
+
+	picks := map[int]int{}
+	for i := 0; i < 1000; i++ {
+		picks[pickWeightedKey(1, []int{0, 1, 2}, limits)]++
+	}
+	assert.Greater(t, picks[0], 800)
+	assert.Greater(t, picks[1], 0)
+	assert.Zero(t, picks[2])
+}
+
+func TestCoolDownIgnoredForNonRateLimitAwareModes(t *testing.T) {
+	channel := useCachedMultiKeyChannel(t, constant.MultiKeyModeRandom)
+	assert.False(t, CoolDownChannelKey(channel.Id, 0, time.Minute))
+}
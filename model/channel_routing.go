@@ -0,0 +1,143 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+
+	channelhealth "github.com/QuantumNous/new-api/pkg/channel_health"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// pickChannelByStrategy 在同一优先级的候选渠道中按路由策略选出一个渠道。
+// 渠道权重作为基础，再按 channelhealth 中的实时统计缩放；没有足够样本的渠道不做调整。
+func pickChannelByStrategy(strategy string, modelName string, channels []*Channel) *Channel {
+	if len(channels) == 0 {
+		return nil
+	}
+	weights := baseChannelWeights(channels)
+	stats := make([]channelhealth.Stats, len(channels))
+	for i, channel := range channels {
+		stats[i] = channelhealth.Get(channel.Id, modelName)
+	}
+
+	switch strategy {
+	case operation_setting.ChannelRoutingLeastLatency:
+		applyLatencyFactors(weights, stats)
+	case operation_setting.ChannelRoutingLeastError:
+		applyErrorFactors(weights, stats)
+	case operation_setting.ChannelRoutingPowerOfTwo:
+		return channels[pickLessLoaded(weights, stats)]
+	}
+	return channels[weightedIndex(weights)]
+}
+
+// filterCircuitOpenChannels 过滤掉熔断中的渠道；全部处于熔断时原样返回，不因熔断直接拒绝请求
+func filterCircuitOpenChannels(channels []*Channel) []*Channel {
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if circuitbreaker.Available(channel.Id, circuitbreaker.ChannelLevel) {
+			available = append(available, channel)
+		}
+	}
+	if len(available) == 0 {
+		return channels
+	}
+	return available
+}
+
+// baseChannelWeights 与按权重随机保持一致：权重全为 0 时视为等权
+func baseChannelWeights(channels []*Channel) []float64 {
+	weights := make([]float64, len(channels))
+	sum := 0.0
+	for i, channel := range channels {
+		weights[i] = float64(channel.GetWeight())
+		sum += weights[i]
+	}
+	if sum == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	return weights
+}
+
+func minWeightFactor() float64 {
+	factor := operation_setting.GetChannelRoutingSetting().MinWeightFactor
+	if factor <= 0 || factor > 1 {
+		return 0.05
+	}
+	return factor
+}
+
+func applyLatencyFactors(weights []float64, stats []channelhealth.Stats) {
+	best := math.Inf(1)
+	for _, stat := range stats {
+		if stat.Known && stat.HasLatency && stat.LatencyMs < best {
+			best = stat.LatencyMs
+		}
+	}
+	if math.IsInf(best, 1) {
+		return
+	}
+	floor := minWeightFactor()
+	for i, stat := range stats {
+		if !stat.Known || !stat.HasLatency {
+			continue
+		}
+		factor := 1.0
+		if stat.LatencyMs > 0 {
+			factor = math.Max(best, 1) / math.Max(stat.LatencyMs, 1)
+		}
+		weights[i] *= math.Max(factor, floor)
+	}
+}
+
+func applyErrorFactors(weights []float64, stats []channelhealth.Stats) {
+	floor := minWeightFactor()
+	for i, stat := range stats {
+		if !stat.Known {
+			continue
+		}
+		successRate := 1 - stat.ErrorRate
+		weights[i] *= math.Max(successRate*successRate, floor)
+	}
+}
+
+// pickLessLoaded 按权重随机抽取两个不同的渠道，返回在途请求更少的一个，持平时取错误率更低者
+func pickLessLoaded(weights []float64, stats []channelhealth.Stats) int {
+	first := weightedIndex(weights)
+	if len(weights) < 2 {
+		return first
+	}
+	rest := make([]float64, len(weights))
+	copy(rest, weights)
+	rest[first] = 0
+	second := weightedIndex(rest)
+	if second == first {
+		return first
+	}
+	a, b := stats[first], stats[second]
+	if b.InFlight < a.InFlight || (b.InFlight == a.InFlight && b.ErrorRate < a.ErrorRate) {
+		return second
+	}
+	return first
+}
+
+func weightedIndex(weights []float64) int {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return rand.Intn(len(weights))
+	}
+	target := rand.Float64() * total
+	for i, weight := range weights {
+		target -= weight
+		if target < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
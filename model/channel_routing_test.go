@@ -0,0 +1,53 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	channelhealth "github.com/QuantumNous/new-api/pkg/channel_health"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPickChannelByStrategyFavoursHealthyChannels(t *testing.T) {
+	channelhealth.Reset()
+	t.Cleanup(channelhealth.Reset)
+
+	const modelName = "gpt-4o"
+	fast, slow := &Channel{Id: 1}, &Channel{Id: 2}
+	for i := 0; i < 10; i++ {
+		channelhealth.RecordSuccess(fast.Id, modelName, 100*time.Millisecond)
+		channelhealth.RecordSuccess(slow.Id, modelName, 2*time.Second)
+		channelhealth.RecordFailure(slow.Id, modelName)
+		channelhealth.RecordFailure(slow.Id, modelName)
+	}
+	channels := []*Channel{fast, slow}
+
+	for _, strategy := range []string{
+		operation_setting.ChannelRoutingLeastLatency,
+		operation_setting.ChannelRoutingLeastError,
+	} {
+		t.Run(strategy, func(t *testing.T) {
+			picks := map[int]int{}
+			for i := 0; i < 1000; i++ {
+				picks[pickChannelByStrategy(strategy, modelName, channels).Id]++
+			}
+			assert.Greater(t, picks[fast.Id], 800)
+			assert.Greater(t, picks[slow.Id], 0, "degraded channel keeps a trickle of traffic")
+		})
+	}
+}
+
+func TestPickChannelByStrategyPowerOfTwoPrefersLessLoaded(t *testing.T) {
+	channelhealth.Reset()
+	t.Cleanup(channelhealth.Reset)
+
+	idle, busy := &Channel{Id: 1}, &Channel{Id: 2}
+	release := channelhealth.Acquire(busy.Id)
+	defer release()
+
+	for i := 0; i < 100; i++ {
+		picked := pickChannelByStrategy(operation_setting.ChannelRoutingPowerOfTwo, "gpt-4o", []*Channel{idle, busy})
+		assert.Equal(t, idle.Id, picked.Id)
+	}
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+// File 是通过 /v1/files 上传的用户文件。FileId 对外暴露（file-xxx），
+// 文件内容保存在 StorageType 指定的存储后端中，StorageKey 为后端内的对象路径。
+// 若上传时透传到了上游渠道，ChannelId/UpstreamFileId 记录上游文件，后续引用该文件的请求会被固定到该渠道。
+type File struct {
+	Id             int            `json:"id"`
+	FileId         string         `json:"file_id" gorm:"type:varchar(128);uniqueIndex"`
+	UserId         int            `json:"user_id" gorm:"index"`
+	TokenId        int            `json:"token_id" gorm:"index"`
+	Filename       string         `json:"filename" gorm:"type:varchar(255)"`
+	Purpose        string         `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes          int64          `json:"bytes" gorm:"bigint"`
+	ContentType    string         `json:"content_type" gorm:"type:varchar(128)"`
+	StorageType    string         `json:"storage_type" gorm:"type:varchar(16)"`
+	StorageKey     string         `json:"-" gorm:"type:varchar(512)"`
+	ChannelId      int            `json:"channel_id" gorm:"index"`
+	UpstreamFileId string         `json:"upstream_file_id" gorm:"type:varchar(128)"`
+	Status         string         `json:"status" gorm:"type:varchar(16)"`
+	Quota          int            `json:"quota" gorm:"default:0"`
+	CreatedAt      int64          `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt      int64          `json:"expires_at" gorm:"bigint;index"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (file *File) Insert() error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(file).Error
+}
+
+func (file *File) Update() error {
+	return DB.Model(file).Select("file_id", "status", "channel_id", "upstream_file_id", "quota").Updates(file).Error
+}
+
+func (file *File) IsExpired() bool {
+	return file.ExpiresAt > 0 && file.ExpiresAt < common.GetTimestamp()
+}
+
+// GetUserFileByFileId 获取用户自己的文件，已过期的文件视为不存在
+func GetUserFileByFileId(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id 为空")
+	}
+	var file File
+	err := DB.Where("user_id = ? AND file_id = ?", userId, fileId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	if file.IsExpired() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &file, nil
+}
+
+// GetUserFilesByFileIds 批量获取用户的文件，不存在或已过期的 id 会被忽略
+func GetUserFilesByFileIds(userId int, fileIds []string) ([]*File, error) {
+	var files []*File
+	if len(fileIds) == 0 {
+		return files, nil
+	}
+	err := DB.Where("user_id = ? AND file_id IN ?", userId, fileIds).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	valid := files[:0]
+	for _, file := range files {
+		if !file.IsExpired() {
+			valid = append(valid, file)
+		}
+	}
+	return valid, nil
+}
+
+// ListUserFiles 按 OpenAI 的游标分页语义列出文件：after 为上一页最后一个 file id，
+// 返回 limit+1 条以便调用方判断 has_more。
+func ListUserFiles(userId int, purpose string, after string, limit int, ascending bool) ([]*File, error) {
+	query := DB.Where("user_id = ?", userId).
+		Where("expires_at = 0 OR expires_at >= ?", common.GetTimestamp())
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	order := "id desc"
+	if ascending {
+		order = "id asc"
+	}
+	if after != "" {
+		var cursor File
+		if err := DB.Select("id").Where("user_id = ? AND file_id = ?", userId, after).First(&cursor).Error; err != nil {
+			return nil, err
+		}
+		if ascending {
+			query = query.Where("id > ?", cursor.Id)
+		} else {
+			query = query.Where("id < ?", cursor.Id)
+		}
+	}
+	var files []*File
+	err := query.Order(order).Limit(limit + 1).Find(&files).Error
+	return files, err
+}
+
+// SumUserFileBytes 统计用户当前占用的文件存储字节数（不含已过期文件）
+func SumUserFileBytes(userId int) (int64, error) {
+	var total int64
+	err := DB.Model(&File{}).
+		Where("user_id = ?", userId).
+		Where("expires_at = 0 OR expires_at >= ?", common.GetTimestamp()).
+		Select("COALESCE(SUM(bytes), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+func DeleteFileById(id int) error {
+	return DB.Delete(&File{}, "id = ?", id).Error
+}
+
+// GetExpiredFiles 获取一批已过期但尚未删除的文件，供清理任务使用
+func GetExpiredFiles(limit int) ([]*File, error) {
+	var files []*File
+	err := DB.Where("expires_at > 0 AND expires_at < ?", common.GetTimestamp()).
+		Order("id asc").Limit(limit).Find(&files).Error
+	return files, err
+}
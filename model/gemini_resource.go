@@ -0,0 +1,104 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	GeminiResourceKindFile          = "file"
+	GeminiResourceKindCachedContent = "cached_content"
+	GeminiResourceKindUpload        = "upload" // 进行中的可续传上传，Name 为 upload_id
+)
+
+// GeminiResource 是经网关创建的 Gemini Files API 文件或 cachedContents 缓存。
+// 上游资源只在创建它的渠道（多 key 渠道还包括具体的 key）可见，因此记录 ChannelId/KeyIndex，
+// 后续引用该资源的请求会被固定到同一渠道；UserId 用于隔离不同用户的资源。
+// Name 为返回给客户端的资源名（files/xxx、cachedContents/xxx），UpstreamName 为上游完整名称（Vertex 带项目前缀）。
+type GeminiResource struct {
+	Id           int            `json:"id"`
+	UserId       int            `json:"user_id" gorm:"index"`
+	TokenId      int            `json:"token_id"`
+	Group        string         `json:"group" gorm:"type:varchar(64)"`
+	Kind         string         `json:"kind" gorm:"type:varchar(32);index"`
+	Name         string         `json:"name" gorm:"type:varchar(255);index"`
+	UpstreamName string         `json:"upstream_name" gorm:"type:varchar(512)"`
+	ChannelId    int            `json:"channel_id" gorm:"index"`
+	KeyIndex     int            `json:"key_index"`
+	Model        string         `json:"model" gorm:"type:varchar(255)"`
+	TokenCount   int            `json:"token_count"`
+	Metadata     string         `json:"metadata"` // 最近一次上游返回的资源对象 JSON，列表接口直接使用
+	Quota        int            `json:"quota" gorm:"default:0"`
+	BilledUntil  int64          `json:"billed_until" gorm:"bigint"` // 存储费已结算到的时间
+	CreatedAt    int64          `json:"created_at" gorm:"bigint"`
+	ExpiresAt    int64          `json:"expires_at" gorm:"bigint;index"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (resource *GeminiResource) Insert() error {
+	if resource.CreatedAt == 0 {
+		resource.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(resource).Error
+}
+
+func (resource *GeminiResource) Update() error {
+	return DB.Model(resource).Select("kind", "name", "upstream_name", "model", "token_count", "metadata", "quota", "billed_until", "expires_at").Updates(resource).Error
+}
+
+func (resource *GeminiResource) IsExpired() bool {
+	return resource.ExpiresAt > 0 && resource.ExpiresAt < common.GetTimestamp()
+}
+
+// GetUserGeminiResource 获取用户自己的资源，已过期的资源视为不存在
+func GetUserGeminiResource(userId int, kind string, name string) (*GeminiResource, error) {
+	var resource GeminiResource
+	err := DB.Where("user_id = ? AND kind = ? AND name = ?", userId, kind, name).Order("id desc").First(&resource).Error
+	if err != nil {
+		return nil, err
+	}
+	if resource.IsExpired() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &resource, nil
+}
+
+// GetGeminiResourcesByNames 按资源名查询所有用户的资源，用于校验请求引用的资源归属
+func GetGeminiResourcesByNames(names []string) ([]*GeminiResource, error) {
+	var resources []*GeminiResource
+	if len(names) == 0 {
+		return resources, nil
+	}
+	err := DB.Where("kind IN ? AND name IN ?", []string{GeminiResourceKindFile, GeminiResourceKindCachedContent}, names).Find(&resources).Error
+	return resources, err
+}
+
+// ListUserGeminiResources 按创建时间倒序分页列出用户未过期的资源，afterId 为上一页最后一条的 id，多取一条用于判断是否还有下一页
+func ListUserGeminiResources(userId int, kind string, afterId int, limit int) ([]*GeminiResource, error) {
+	var resources []*GeminiResource
+	query := DB.Where("user_id = ? AND kind = ?", userId, kind).
+		Where("expires_at = 0 OR expires_at >= ?", common.GetTimestamp())
+	if afterId > 0 {
+		query = query.Where("id < ?", afterId)
+	}
+	err := query.Order("id desc").Limit(limit + 1).Find(&resources).Error
+	return resources, err
+}
+
+func DeleteGeminiResourceById(id int) error {
+	return DB.Delete(&GeminiResource{}, "id = ?", id).Error
+}
+
+// DeleteExpiredGeminiResources 删除一批已过期的资源记录，返回删除条数。上游资源到期后会被自动删除，这里只清理本地记录
+func DeleteExpiredGeminiResources(limit int) (int64, error) {
+	var ids []int
+	err := DB.Model(&GeminiResource{}).
+		Where("expires_at > 0 AND expires_at < ?", common.GetTimestamp()).
+		Order("id asc").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := DB.Delete(&GeminiResource{}, "id IN ?", ids)
+	return result.RowsAffected, result.Error
+}
@@ -292,6 +292,19 @@ func migrateDB() error {
 		&SystemTaskLock{},
 		&CasbinRule{},
 		&AuthzRole{},
+		&File{},
+		&Batch{},
+		&Organization{},
+		&OrganizationMember{},
+		&OrganizationInvitation{},
+		&McpServer{},
+		&PromptTemplate{},
+		&PromptTemplateVersion{},
+		&StoredResponse{},
+		&GeminiResource{},
+		&TaskCallback{},
+		&MediaAsset{},
+		&PayloadCapture{},
 	)
 	if err != nil {
 		return err
@@ -353,6 +366,19 @@ func migrateDBFast() error {
 		{&SystemInstance{}, "SystemInstance"},
 		{&SystemTask{}, "SystemTask"},
 		{&SystemTaskLock{}, "SystemTaskLock"},
+		{&File{}, "File"},
+		{&Batch{}, "Batch"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&OrganizationInvitation{}, "OrganizationInvitation"},
+		{&McpServer{}, "McpServer"},
+		{&PromptTemplate{}, "PromptTemplate"},
+		{&PromptTemplateVersion{}, "PromptTemplateVersion"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&GeminiResource{}, "GeminiResource"},
+		{&TaskCallback{}, "TaskCallback"},
+		{&MediaAsset{}, "MediaAsset"},
+		{&PayloadCapture{}, "PayloadCapture"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -400,7 +426,7 @@ func migrateLOGDB() error {
 	if common.UsingLogDatabase(common.DatabaseTypeClickHouse) {
 		return migrateClickHouseLogDB()
 	}
-	return LOG_DB.AutoMigrate(&Log{})
+	return LOG_DB.AutoMigrate(&Log{}, &PayloadCapture{})
 }
 
 func migrateClickHouseLogDB() error {
@@ -408,6 +434,9 @@ func migrateClickHouseLogDB() error {
 	if err := LOG_DB.Exec(clickHouseLogCreateTableSQL(ttlDays)).Error; err != nil {
 		return err
 	}
+	if err := LOG_DB.Exec(clickHousePayloadCaptureCreateTableSQL()).Error; err != nil {
+		return err
+	}
 	return syncClickHouseLogTTL(ttlDays)
 }
 
@@ -0,0 +1,201 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	McpServerStatusEnabled  = 1
+	McpServerStatusDisabled = 2
+)
+
+// McpAllTools 在 GroupTools 中表示所有分组或所有工具
+const McpAllTools = "*"
+
+var (
+	ErrMcpServerNotFound = errors.New("mcp server not found")
+	mcpServerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+)
+
+// McpServer 由管理员登记的 MCP 服务，网关通过 /mcp/:name 代理访问，
+// 也可在中继时代替不支持远程 MCP 的上游执行工具调用
+type McpServer struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"` // 服务标识，用于 /mcp/:name 和工具名前缀
+	Description string `json:"description" gorm:"type:varchar(255);default:''"`
+	ServerUrl   string `json:"server_url" gorm:"type:varchar(512)"` // streamable HTTP 端点
+	Headers     string `json:"-" gorm:"type:text"`                  // JSON 对象，转发时附加的认证头，不返回前端
+	GroupTools  string `json:"group_tools" gorm:"type:text"`        // JSON 对象，分组 -> 允许的工具列表；"*" 表示全部，为空时不限制
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// GetHeaders 解析转发时附加的请求头
+func (s *McpServer) GetHeaders() map[string]string {
+	headers := make(map[string]string)
+	if strings.TrimSpace(s.Headers) == "" {
+		return headers
+	}
+	if err := common.UnmarshalJsonStr(s.Headers, &headers); err != nil {
+		common.SysError(fmt.Sprintf("failed to parse headers of mcp server %s: %s", s.Name, err.Error()))
+	}
+	return headers
+}
+
+// HeaderNames 返回已配置的请求头名称，用于在管理界面展示而不泄露取值
+func (s *McpServer) HeaderNames() []string {
+	headers := s.GetHeaders()
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetGroupTools 解析分组可用的工具配置
+func (s *McpServer) GetGroupTools() map[string][]string {
+	groupTools := make(map[string][]string)
+	if strings.TrimSpace(s.GroupTools) == "" {
+		return groupTools
+	}
+	if err := common.UnmarshalJsonStr(s.GroupTools, &groupTools); err != nil {
+		common.SysError(fmt.Sprintf("failed to parse group tools of mcp server %s: %s", s.Name, err.Error()))
+	}
+	return groupTools
+}
+
+// allowedTools 返回分组可用的工具列表，ok 为 false 表示该分组无权访问
+func (s *McpServer) allowedTools(group string) (tools []string, ok bool) {
+	groupTools := s.GetGroupTools()
+	if len(groupTools) == 0 {
+		return []string{McpAllTools}, true
+	}
+	if tools, ok = groupTools[group]; ok {
+		return tools, true
+	}
+	tools, ok = groupTools[McpAllTools]
+	return tools, ok
+}
+
+// AllowsGroup 判断分组是否可以访问该服务
+func (s *McpServer) AllowsGroup(group string) bool {
+	if s.Status != McpServerStatusEnabled {
+		return false
+	}
+	tools, ok := s.allowedTools(group)
+	return ok && len(tools) > 0
+}
+
+// AllowsTool 判断分组是否可以调用指定工具
+func (s *McpServer) AllowsTool(group string, tool string) bool {
+	if s.Status != McpServerStatusEnabled {
+		return false
+	}
+	tools, ok := s.allowedTools(group)
+	if !ok {
+		return false
+	}
+	for _, allowed := range tools {
+		if allowed == McpAllTools || allowed == tool {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *McpServer) normalize() error {
+	s.Name = strings.TrimSpace(s.Name)
+	s.ServerUrl = strings.TrimSpace(s.ServerUrl)
+	if !mcpServerNamePattern.MatchString(s.Name) {
+		return errors.New("server name must contain only letters, numbers, underscores and hyphens (max 64)")
+	}
+	if strings.Contains(s.Name, "__") {
+		return errors.New("server name must not contain consecutive underscores")
+	}
+	parsed, err := url.Parse(s.ServerUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("server url must be a valid http(s) URL")
+	}
+	if strings.TrimSpace(s.Headers) != "" {
+		var headers map[string]string
+		if err := common.UnmarshalJsonStr(s.Headers, &headers); err != nil {
+			return errors.New("headers must be a JSON object of strings")
+		}
+	}
+	if strings.TrimSpace(s.GroupTools) != "" {
+		var groupTools map[string][]string
+		if err := common.UnmarshalJsonStr(s.GroupTools, &groupTools); err != nil {
+			return errors.New("group tools must be a JSON object mapping groups to tool lists")
+		}
+	}
+	if s.Status != McpServerStatusDisabled {
+		s.Status = McpServerStatusEnabled
+	}
+	return nil
+}
+
+func GetAllMcpServers() ([]*McpServer, error) {
+	var servers []*McpServer
+	err := DB.Order("id asc").Find(&servers).Error
+	return servers, err
+}
+
+func GetMcpServerById(id int) (*McpServer, error) {
+	var server McpServer
+	if err := DB.First(&server, id).Error; err != nil {
+		return nil, ErrMcpServerNotFound
+	}
+	return &server, nil
+}
+
+func GetMcpServerByName(name string) (*McpServer, error) {
+	var server McpServer
+	if err := DB.Where("name = ?", name).First(&server).Error; err != nil {
+		return nil, ErrMcpServerNotFound
+	}
+	return &server, nil
+}
+
+// IsMcpServerNameTaken 检查名称是否已被其他服务使用，数据库错误时视为已占用
+func IsMcpServerNameTaken(name string, excludeId int) bool {
+	var count int64
+	query := DB.Model(&McpServer{}).Where("name = ?", name)
+	if excludeId > 0 {
+		query = query.Where("id != ?", excludeId)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return true
+	}
+	return count > 0
+}
+
+func (s *McpServer) Insert() error {
+	if err := s.normalize(); err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	s.CreatedTime = now
+	s.UpdatedTime = now
+	return DB.Create(s).Error
+}
+
+func (s *McpServer) Update() error {
+	if err := s.normalize(); err != nil {
+		return err
+	}
+	s.UpdatedTime = common.GetTimestamp()
+	return DB.Save(s).Error
+}
+
+func DeleteMcpServerById(id int) error {
+	return DB.Delete(&McpServer{}, id).Error
+}
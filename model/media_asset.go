@@ -0,0 +1,121 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	MediaAssetSourceTask  = "task"
+	MediaAssetSourceImage = "image"
+)
+
+// MediaAsset 保存在网关存储中的生成结果（视频任务或图片生成）。AssetId 对外暴露（asset-xxx），
+// 只能通过带签名、会过期的网关地址访问；内容保存在 StorageType 指定的存储后端，StorageKey 为后端内的对象路径。
+type MediaAsset struct {
+	Id          int    `json:"id"`
+	AssetId     string `json:"asset_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id"`
+	Source      string `json:"source" gorm:"type:varchar(16)"`           // task / image
+	SourceId    string `json:"source_id" gorm:"type:varchar(191);index"` // 任务 ID 或请求 ID
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	Bytes       int64  `json:"bytes" gorm:"bigint"`
+	StorageType string `json:"storage_type" gorm:"type:varchar(16)"`
+	StorageKey  string `json:"-" gorm:"type:varchar(512)"`
+	Quota       int    `json:"quota" gorm:"default:0"` // 存储计费扣除的额度
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index"` // 0 表示不过期
+}
+
+func (asset *MediaAsset) Insert() error {
+	if asset.CreatedAt == 0 {
+		asset.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(asset).Error
+}
+
+func (asset *MediaAsset) IsExpired() bool {
+	return asset.ExpiresAt > 0 && asset.ExpiresAt < common.GetTimestamp()
+}
+
+// IsPending 资源 id 已预留但内容尚未写入存储（任务结果仍在后台保存，或保存失败）
+func (asset *MediaAsset) IsPending() bool {
+	return asset.StorageKey == ""
+}
+
+// Complete 把内容写入存储后的信息回填到预留的资源记录，预留记录已被删除时返回 false
+func (asset *MediaAsset) Complete() (bool, error) {
+	result := DB.Model(&MediaAsset{}).
+		Where("id = ? AND storage_key = ?", asset.Id, "").
+		Updates(map[string]interface{}{
+			"content_type": asset.ContentType,
+			"bytes":        asset.Bytes,
+			"storage_type": asset.StorageType,
+			"storage_key":  asset.StorageKey,
+			"quota":        asset.Quota,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ResetToPending 内容被撤回（如存储费用扣除失败）后把资源记录恢复为预留状态
+func (asset *MediaAsset) ResetToPending() error {
+	return DB.Model(&MediaAsset{}).Where("id = ?", asset.Id).
+		Updates(map[string]interface{}{"bytes": 0, "storage_type": "", "storage_key": "", "quota": 0}).Error
+}
+
+// GetMediaAssetByAssetId 按对外 id 获取资源，已过期的资源视为不存在
+func GetMediaAssetByAssetId(assetId string) (*MediaAsset, bool, error) {
+	if assetId == "" {
+		return nil, false, nil
+	}
+	var asset *MediaAsset
+	err := DB.Where("asset_id = ?", assetId).First(&asset).Error
+	exist, err := RecordExist(err)
+	if err != nil || !exist {
+		return nil, false, err
+	}
+	if asset.IsExpired() {
+		return nil, false, nil
+	}
+	return asset, true, nil
+}
+
+// SumUserMediaAssetBytes 统计用户当前占用的资源存储字节数（不含已过期资源）
+func SumUserMediaAssetBytes(userId int) (int64, error) {
+	var total int64
+	err := DB.Model(&MediaAsset{}).
+		Where("user_id = ?", userId).
+		Where("expires_at = 0 OR expires_at >= ?", common.GetTimestamp()).
+		Select("COALESCE(SUM(bytes), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// GetOldestUserMediaAssets 按创建顺序获取用户最早的一批已写入存储的资源，用于超出存储上限时淘汰
+func GetOldestUserMediaAssets(userId int, limit int) ([]*MediaAsset, error) {
+	var assets []*MediaAsset
+	err := DB.Where("user_id = ? AND storage_key <> ?", userId, "").Order("id asc").Limit(limit).Find(&assets).Error
+	return assets, err
+}
+
+// GetExpiredMediaAssets 获取一批已过期的资源，供清理任务使用
+func GetExpiredMediaAssets(limit int) ([]*MediaAsset, error) {
+	var assets []*MediaAsset
+	err := DB.Where("expires_at > 0 AND expires_at < ?", common.GetTimestamp()).
+		Order("id asc").Limit(limit).Find(&assets).Error
+	return assets, err
+}
+
+// HasExpiredMediaAssets 是否存在已过期的资源，用于决定清理系统任务是否需要运行
+func HasExpiredMediaAssets() bool {
+	var id int
+	err := DB.Model(&MediaAsset{}).
+		Where("expires_at > 0 AND expires_at < ?", common.GetTimestamp()).
+		Limit(1).
+		Pluck("id", &id).Error
+	return err == nil && id != 0
+}
+
+func DeleteMediaAssetById(id int) error {
+	return DB.Delete(&MediaAsset{}, "id = ?", id).Error
+}
@@ -23,6 +23,7 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	CallbackUrl string `json:"-" gorm:"type:varchar(512)"` // 任务状态变化时的回调地址，来自提交请求的 notifyHook 或令牌配置
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -0,0 +1,545 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+const (
+	OrganizationStatusEnabled  = 1
+	OrganizationStatusDisabled = 2
+)
+
+const (
+	OrganizationInvitationPending  = "pending"
+	OrganizationInvitationAccepted = "accepted"
+	OrganizationInvitationRevoked  = "revoked"
+)
+
+// OrganizationInvitationValidDays 邀请链接有效期
+const OrganizationInvitationValidDays = 7
+
+var (
+	ErrOrganizationNotFound             = errors.New("organization not found")
+	ErrOrganizationDisabled             = errors.New("organization disabled")
+	ErrOrganizationMemberNotFound       = errors.New("organization member not found")
+	ErrOrganizationMemberExists         = errors.New("organization member already exists")
+	ErrOrganizationQuotaInsufficient    = errors.New("organization quota insufficient")
+	ErrOrganizationMemberBudgetExceeded = errors.New("organization member monthly budget exceeded")
+	ErrOrganizationInvitationInvalid    = errors.New("organization invitation invalid")
+	ErrOrganizationInvitationEmailUnfit = errors.New("organization invitation email mismatch")
+	ErrOrganizationWalletQuotaNotEnough = errors.New("user quota not enough")
+)
+
+// Organization 组织（团队），成员共享同一个额度池
+type Organization struct {
+	Id          int            `json:"id"`
+	Name        string         `json:"name" gorm:"type:varchar(128);index"`
+	OwnerId     int            `json:"owner_id" gorm:"index"`
+	Quota       int            `json:"quota" gorm:"default:0"`      // 共享额度池剩余额度
+	UsedQuota   int            `json:"used_quota" gorm:"default:0"` // 共享额度池已用额度
+	Status      int            `json:"status" gorm:"default:1"`
+	CreatedTime int64          `json:"created_time" gorm:"bigint"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// OrganizationMember 组织成员及其月度预算
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_org_member,priority:1"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_org_member,priority:2;index"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	MonthlyBudget  int    `json:"monthly_budget" gorm:"default:0"`               // 每月可用额度上限，0 表示不限
+	MonthlySpent   int    `json:"monthly_spent" gorm:"default:0"`                // SpentMonth 当月已用额度
+	SpentMonth     string `json:"spent_month" gorm:"type:varchar(6);default:''"` // 形如 200601，跨月后 MonthlySpent 归零
+	Contributed    int    `json:"contributed" gorm:"default:0"`                  // 从本人钱包划入额度池的累计额度，删除组织时最多退还这么多
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	// 以下字段仅用于展示
+	Username string `json:"username" gorm:"-"`
+	Email    string `json:"email" gorm:"-"`
+}
+
+// OrganizationInvitation 通过邮箱发出的组织邀请
+type OrganizationInvitation struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"index"`
+	Email          string `json:"email" gorm:"type:varchar(255);index"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	Code           string `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	InvitedBy      int    `json:"invited_by"`
+	Status         string `json:"status" gorm:"type:varchar(16);default:'pending'"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	ExpiredTime    int64  `json:"expired_time" gorm:"bigint"`
+}
+
+// OrganizationWithRole 用户所在的组织及其角色
+type OrganizationWithRole struct {
+	Organization
+	Role          string `json:"role"`
+	MonthlyBudget int    `json:"monthly_budget"`
+	MonthlySpent  int    `json:"monthly_spent"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	switch role {
+	case OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember:
+		return true
+	}
+	return false
+}
+
+// CanManageOrganizationRole 判断 actor 角色能否管理（邀请、修改、移除）target 角色的成员。
+// 所有者可以管理管理员和普通成员，管理员只能管理普通成员，所有者本身不可被管理。
+func CanManageOrganizationRole(actor string, target string) bool {
+	switch actor {
+	case OrganizationRoleOwner:
+		return target == OrganizationRoleAdmin || target == OrganizationRoleMember
+	case OrganizationRoleAdmin:
+		return target == OrganizationRoleMember
+	}
+	return false
+}
+
+func currentSpentMonth() string {
+	return time.Now().Format("200601")
+}
+
+// currentMonthlySpent 返回成员当月已用额度，跨月后视为 0
+func (member *OrganizationMember) currentMonthlySpent() int {
+	if member.SpentMonth != currentSpentMonth() {
+		return 0
+	}
+	return member.MonthlySpent
+}
+
+// CreateOrganization 创建组织，创建者成为所有者
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	now := common.GetTimestamp()
+	organization := &Organization{
+		Name:        name,
+		OwnerId:     ownerId,
+		Status:      OrganizationStatusEnabled,
+		CreatedTime: now,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: organization.Id,
+			UserId:         ownerId,
+			Role:           OrganizationRoleOwner,
+			CreatedTime:    now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	var organization Organization
+	if err := DB.First(&organization, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func GetAllOrganizations(startIdx int, num int) (organizations []*Organization, total int64, err error) {
+	if err = DB.Model(&Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&organizations).Error
+	return organizations, total, err
+}
+
+// GetUserOrganizations 获取用户加入的所有组织
+func GetUserOrganizations(userId int) ([]*OrganizationWithRole, error) {
+	var members []OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return []*OrganizationWithRole{}, nil
+	}
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.OrganizationId)
+	}
+	var organizations []Organization
+	if err := DB.Where("id IN ?", ids).Order("id desc").Find(&organizations).Error; err != nil {
+		return nil, err
+	}
+	byOrg := make(map[int]OrganizationMember, len(members))
+	for _, member := range members {
+		byOrg[member.OrganizationId] = member
+	}
+	result := make([]*OrganizationWithRole, 0, len(organizations))
+	for _, organization := range organizations {
+		member := byOrg[organization.Id]
+		result = append(result, &OrganizationWithRole{
+			Organization:  organization,
+			Role:          member.Role,
+			MonthlyBudget: member.MonthlyBudget,
+			MonthlySpent:  member.currentMonthlySpent(),
+		})
+	}
+	return result, nil
+}
+
+func (organization *Organization) UpdateName(name string) error {
+	organization.Name = name
+	return DB.Model(organization).Update("name", name).Error
+}
+
+// DeleteOrganization 删除组织。剩余的共享额度只退还成员从钱包划入的部分：按成员加入顺序，
+// 每人最多退回本人累计划入的额度；管理员直接发放的额度不会进入任何人的钱包
+func DeleteOrganization(id int) error {
+	refunds := make(map[int]int)
+	var order []int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var organization Organization
+		if err := lockForUpdate(tx).First(&organization, "id = ?", id).Error; err != nil {
+			return err
+		}
+		var contributors []*OrganizationMember
+		if err := tx.Where("organization_id = ? AND contributed > 0", id).Order("id asc").Find(&contributors).Error; err != nil {
+			return err
+		}
+		remaining := max(organization.Quota, 0)
+		for _, member := range contributors {
+			refund := min(remaining, member.Contributed)
+			if refund <= 0 {
+				break
+			}
+			if err := tx.Model(&User{}).Where("id = ?", member.UserId).Update("quota", gorm.Expr("quota + ?", refund)).Error; err != nil {
+				return err
+			}
+			refunds[member.UserId] = refund
+			order = append(order, member.UserId)
+			remaining -= refund
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&OrganizationInvitation{}).Where("organization_id = ? AND status = ?", id, OrganizationInvitationPending).
+			Update("status", OrganizationInvitationRevoked).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&organization).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, userId := range order {
+		refreshUserQuotaCache(userId, int64(refunds[userId]))
+		RecordLog(userId, LogTypeSystem, fmt.Sprintf("删除组织 %d，本人划入的共享额度 %s 退回钱包", id, logger.LogQuota(refunds[userId])))
+	}
+	return nil
+}
+
+func GetOrganizationMember(organizationId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.Where("organization_id = ? AND user_id = ?", organizationId, userId).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationMemberNotFound
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetOrganizationMembers(organizationId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("organization_id = ?", organizationId).Order("id asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return members, nil
+	}
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+	var users []User
+	if err := DB.Select("id", "username", "email").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byId := make(map[int]User, len(users))
+	for _, user := range users {
+		byId[user.Id] = user
+	}
+	for _, member := range members {
+		member.Username = byId[member.UserId].Username
+		member.Email = byId[member.UserId].Email
+		member.MonthlySpent = member.currentMonthlySpent()
+	}
+	return members, nil
+}
+
+// UpdateOrganizationMember 修改成员角色与月度预算
+func UpdateOrganizationMember(organizationId int, userId int, role string, monthlyBudget int) error {
+	return DB.Model(&OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", organizationId, userId).
+		Updates(map[string]interface{}{
+			"role":           role,
+			"monthly_budget": monthlyBudget,
+		}).Error
+}
+
+func RemoveOrganizationMember(organizationId int, userId int) error {
+	result := DB.Where("organization_id = ? AND user_id = ? AND role <> ?", organizationId, userId, OrganizationRoleOwner).
+		Delete(&OrganizationMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrganizationMemberNotFound
+	}
+	return nil
+}
+
+// CreateOrganizationInvitation 创建邀请，同一邮箱未处理的旧邀请会被撤销
+func CreateOrganizationInvitation(organizationId int, email string, role string, invitedBy int) (*OrganizationInvitation, error) {
+	now := common.GetTimestamp()
+	invitation := &OrganizationInvitation{
+		OrganizationId: organizationId,
+		Email:          NormalizeEmail(email),
+		Role:           role,
+		Code:           common.GetRandomString(32),
+		InvitedBy:      invitedBy,
+		Status:         OrganizationInvitationPending,
+		CreatedTime:    now,
+		ExpiredTime:    now + OrganizationInvitationValidDays*24*3600,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&OrganizationInvitation{}).
+			Where("organization_id = ? AND email = ? AND status = ?", organizationId, invitation.Email, OrganizationInvitationPending).
+			Update("status", OrganizationInvitationRevoked).Error; err != nil {
+			return err
+		}
+		return tx.Create(invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func GetPendingOrganizationInvitations(organizationId int) ([]*OrganizationInvitation, error) {
+	var invitations []*OrganizationInvitation
+	err := DB.Where("organization_id = ? AND status = ? AND expired_time > ?", organizationId, OrganizationInvitationPending, common.GetTimestamp()).
+		Order("id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+func RevokeOrganizationInvitation(organizationId int, invitationId int) error {
+	result := DB.Model(&OrganizationInvitation{}).
+		Where("id = ? AND organization_id = ? AND status = ?", invitationId, organizationId, OrganizationInvitationPending).
+		Update("status", OrganizationInvitationRevoked)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrganizationInvitationInvalid
+	}
+	return nil
+}
+
+// AcceptOrganizationInvitation 接受邀请，邀请邮箱必须与用户绑定的邮箱一致
+func AcceptOrganizationInvitation(code string, userId int) (*OrganizationMember, error) {
+	email, err := GetUserEmail(userId)
+	if err != nil {
+		return nil, err
+	}
+	member := &OrganizationMember{UserId: userId}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var invitation OrganizationInvitation
+		if err := lockForUpdate(tx).Where("code = ?", code).First(&invitation).Error; err != nil {
+			return ErrOrganizationInvitationInvalid
+		}
+		if invitation.Status != OrganizationInvitationPending || invitation.ExpiredTime < common.GetTimestamp() {
+			return ErrOrganizationInvitationInvalid
+		}
+		if email == "" || NormalizeEmail(email) != invitation.Email {
+			return ErrOrganizationInvitationEmailUnfit
+		}
+		var organization Organization
+		if err := tx.First(&organization, "id = ?", invitation.OrganizationId).Error; err != nil {
+			return ErrOrganizationInvitationInvalid
+		}
+		var count int64
+		if err := tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", invitation.OrganizationId, userId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrganizationMemberExists
+		}
+		// 与兑换码相同，用状态 CAS 保证同一邀请只能被接受一次
+		result := tx.Model(&OrganizationInvitation{}).
+			Where("id = ? AND status = ?", invitation.Id, OrganizationInvitationPending).
+			Update("status", OrganizationInvitationAccepted)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationInvitationInvalid
+		}
+		member.OrganizationId = invitation.OrganizationId
+		member.Role = invitation.Role
+		member.CreatedTime = common.GetTimestamp()
+		return tx.Create(member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// ConsumeOrganizationQuota 从组织额度池扣减 quota（负数为退还），并计入成员当月用量。
+// enforce 为 true 时校验额度池余额与成员月度预算，用于预扣费；结算补扣时不校验，
+// 与钱包一样允许少量透支。成员被移除或组织被禁用后，扣费（包括 quota 为 0 的资格校验）直接失败，只有退还不受影响。
+func ConsumeOrganizationQuota(organizationId int, userId int, quota int, enforce bool) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var organization Organization
+		if err := lockForUpdate(tx).First(&organization, "id = ?", organizationId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrganizationNotFound
+			}
+			return err
+		}
+		if quota >= 0 && organization.Status != OrganizationStatusEnabled {
+			return ErrOrganizationDisabled
+		}
+		var member OrganizationMember
+		if err := lockForUpdate(tx).Where("organization_id = ? AND user_id = ?", organizationId, userId).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				if quota < 0 {
+					// 成员已被移除，额度仍退回额度池
+					return tx.Model(&Organization{}).Where("id = ?", organizationId).Updates(map[string]interface{}{
+						"quota":      gorm.Expr("quota - ?", quota),
+						"used_quota": gorm.Expr("used_quota + ?", quota),
+					}).Error
+				}
+				return ErrOrganizationMemberNotFound
+			}
+			return err
+		}
+		if quota == 0 {
+			return nil
+		}
+		spent := member.currentMonthlySpent()
+		if enforce && quota > 0 {
+			if organization.Quota < quota {
+				return ErrOrganizationQuotaInsufficient
+			}
+			if member.MonthlyBudget > 0 && spent+quota > member.MonthlyBudget {
+				return ErrOrganizationMemberBudgetExceeded
+			}
+		}
+		if err := tx.Model(&Organization{}).Where("id = ?", organizationId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", quota),
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&OrganizationMember{}).Where("id = ?", member.Id).Updates(map[string]interface{}{
+			"monthly_spent": max(spent+quota, 0),
+			"spent_month":   currentSpentMonth(),
+		}).Error
+	})
+}
+
+// TransferQuotaToOrganization 从用户钱包划转额度到组织额度池
+func TransferQuotaToOrganization(organizationId int, userId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("quota must be positive")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationWalletQuotaNotEnough
+		}
+		result = tx.Model(&Organization{}).Where("id = ?", organizationId).Update("quota", gorm.Expr("quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationNotFound
+		}
+		// 记录本人划入的额度，删除组织时据此退还
+		result = tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", organizationId, userId).
+			Update("contributed", gorm.Expr("contributed + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationMemberNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	refreshUserQuotaCache(userId, -int64(quota))
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("向组织 %d 划转额度 %s", organizationId, logger.LogQuota(quota)))
+	return nil
+}
+
+// AdjustOrganizationQuota 管理员直接增减组织额度池
+func AdjustOrganizationQuota(organizationId int, delta int) error {
+	result := DB.Model(&Organization{}).Where("id = ?", organizationId).Update("quota", gorm.Expr("quota + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrganizationNotFound
+	}
+	return nil
+}
+
+func UpdateOrganizationStatus(organizationId int, status int) error {
+	return DB.Model(&Organization{}).Where("id = ?", organizationId).Update("status", status).Error
+}
+
+// GetOrganizationTokens 获取绑定到组织的令牌
+func GetOrganizationTokens(organizationId int) ([]*Token, error) {
+	var tokens []*Token
+	err := DB.Where("organization_id = ?", organizationId).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// refreshUserQuotaCache 事务外同步用户额度缓存
+func refreshUserQuotaCache(userId int, delta int64) {
+	gopool.Go(func() {
+		var err error
+		if delta > 0 {
+			err = cacheIncrUserQuota(userId, delta)
+		} else {
+			err = cacheDecrUserQuota(userId, -delta)
+		}
+		if err != nil {
+			common.SysLog("failed to update user quota cache: " + err.Error())
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedOrganization(t *testing.T, quota int) (*Organization, *User) {
+	t.Helper()
+	owner := &User{Username: "org-owner", Password: "password123", Email: "owner@example.com", AffCode: "org-owner", Quota: 1000}
+	require.NoError(t, DB.Create(owner).Error)
+	organization, err := CreateOrganization("acme", owner.Id)
+	require.NoError(t, err)
+	require.NoError(t, AdjustOrganizationQuota(organization.Id, quota))
+	return organization, owner
+}
+
+func TestConsumeOrganizationQuotaEnforcesPoolAndMonthlyBudget(t *testing.T) {
+	truncateTables(t)
+	organization, owner := seedOrganization(t, 500)
+	require.NoError(t, UpdateOrganizationMember(organization.Id, owner.Id, OrganizationRoleOwner, 300))
+
+	require.NoError(t, ConsumeOrganizationQuota(organization.Id, owner.Id, 200, true))
+	assert.ErrorIs(t, ConsumeOrganizationQuota(organization.Id, owner.Id, 200, true), ErrOrganizationMemberBudgetExceeded)
+
+	// 结算补扣不校验预算，退还会同时减少当月用量
+	require.NoError(t, ConsumeOrganizationQuota(organization.Id, owner.Id, 150, false))
+	require.NoError(t, ConsumeOrganizationQuota(organization.Id, owner.Id, -250, false))
+
+	member, err := GetOrganizationMember(organization.Id, owner.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 100, member.currentMonthlySpent())
+
+	require.NoError(t, UpdateOrganizationMember(organization.Id, owner.Id, OrganizationRoleOwner, 0))
+	assert.ErrorIs(t, ConsumeOrganizationQuota(organization.Id, owner.Id, 401, true), ErrOrganizationQuotaInsufficient)
+
+	got, err := GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 400, got.Quota)
+	assert.Equal(t, 100, got.UsedQuota)
+}
+
+func TestConsumeOrganizationQuotaRejectsRemovedMember(t *testing.T) {
+	truncateTables(t)
+	organization, _ := seedOrganization(t, 500)
+	member := &User{Username: "org-member", Password: "password123", Email: "member@example.com", AffCode: "org-member"}
+	require.NoError(t, DB.Create(member).Error)
+	invitation, err := CreateOrganizationInvitation(organization.Id, "Member@Example.com", OrganizationRoleMember, organization.OwnerId)
+	require.NoError(t, err)
+
+	_, err = AcceptOrganizationInvitation(invitation.Code, member.Id)
+	require.NoError(t, err)
+	_, err = AcceptOrganizationInvitation(invitation.Code, member.Id)
+	assert.ErrorIs(t, err, ErrOrganizationInvitationInvalid)
+
+	require.NoError(t, ConsumeOrganizationQuota(organization.Id, member.Id, 100, true))
+	require.NoError(t, RemoveOrganizationMember(organization.Id, member.Id))
+	assert.ErrorIs(t, ConsumeOrganizationQuota(organization.Id, member.Id, 10, true), ErrOrganizationMemberNotFound)
+
+	// 成员移除后，进行中请求的退款仍回到额度池
+	require.NoError(t, ConsumeOrganizationQuota(organization.Id, member.Id, -100, false))
+	got, err := GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 500, got.Quota)
+}
+
+func TestDisabledOrganizationRejectsZeroQuotaCheck(t *testing.T) {
+	truncateTables(t)
+	organization, owner := seedOrganization(t, 500)
+	require.NoError(t, UpdateOrganizationStatus(organization.Id, OrganizationStatusDisabled))
+
+	assert.ErrorIs(t, ConsumeOrganizationQuota(organization.Id, owner.Id, 0, true), ErrOrganizationDisabled)
+	require.NoError(t, ConsumeOrganizationQuota(organization.Id, owner.Id, -10, false), "refunds still reach a disabled pool")
+}
+
+func TestDeleteOrganizationRefundsOnlyContributedQuota(t *testing.T) {
+	truncateTables(t)
+	// 管理员发放 500，所有者从钱包划入 300
+	organization, owner := seedOrganization(t, 500)
+	require.NoError(t, TransferQuotaToOrganization(organization.Id, owner.Id, 300))
+	require.NoError(t, ConsumeOrganizationQuota(organization.Id, owner.Id, 600, true))
+
+	require.NoError(t, DeleteOrganization(organization.Id))
+	quota, err := GetUserQuota(owner.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 900, quota, "the 200 left in the pool come back, never more than was transferred")
+
+	granted, err := CreateOrganization("granted", owner.Id)
+	require.NoError(t, err)
+	require.NoError(t, AdjustOrganizationQuota(granted.Id, 500))
+	require.NoError(t, DeleteOrganization(granted.Id))
+	quota, err = GetUserQuota(owner.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 900, quota, "granted quota is not refunded to the owner's wallet")
+}
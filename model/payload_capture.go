@@ -0,0 +1,143 @@
+package model
+
+import (
+	"context"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// PayloadCapture 抽样保存的请求/响应原文，与 logs 一样写入日志库，通过 RequestId 与消费日志关联。
+// RequestBody / ResponseBody 为 gzip 压缩后 base64 编码的内容，开启加密时再经主密钥信封加密；
+// 流式响应保存的是由 SSE 事件还原出的最终响应。
+type PayloadCapture struct {
+	Id            int    `json:"id"`
+	RequestId     string `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	TokenId       int    `json:"token_id" gorm:"default:0"`
+	Group         string `json:"group" gorm:"type:varchar(64);default:''"`
+	ModelName     string `json:"model_name" gorm:"type:varchar(255);default:''"`
+	ChannelId     int    `json:"channel_id" gorm:"default:0"`
+	Path          string `json:"path" gorm:"type:varchar(255);default:''"`
+	StatusCode    int    `json:"status_code" gorm:"default:0"`
+	IsStream      bool   `json:"is_stream"`
+	RequestBytes  int    `json:"request_bytes" gorm:"default:0"`  // 原始请求体大小
+	ResponseBytes int    `json:"response_bytes" gorm:"default:0"` // 原始响应体大小（流式为 SSE 总字节数）
+	Truncated     bool   `json:"truncated"`
+	Redacted      bool   `json:"redacted"`
+	Encrypted     bool   `json:"encrypted"`
+	RequestBody   string `json:"-"`
+	ResponseBody  string `json:"-"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (capture *PayloadCapture) Insert() error {
+	if capture.CreatedAt == 0 {
+		capture.CreatedAt = common.GetTimestamp()
+	}
+	return LOG_DB.Create(capture).Error
+}
+
+// GetPayloadCaptureByRequestId 按请求 ID 获取采集记录，重试产生的多条记录取最新一条
+func GetPayloadCaptureByRequestId(requestId string) (*PayloadCapture, bool, error) {
+	if requestId == "" {
+		return nil, false, nil
+	}
+	var capture *PayloadCapture
+	err := LOG_DB.Where("request_id = ?", requestId).Order("created_at desc").First(&capture).Error
+	exist, err := RecordExist(err)
+	if err != nil || !exist {
+		return nil, false, err
+	}
+	return capture, true, nil
+}
+
+// GetPayloadCaptures 分页查询采集记录（不含原文）
+func GetPayloadCaptures(userId int, tokenId int, modelName string, requestId string, startTimestamp int64, endTimestamp int64, startIdx int, num int) (captures []*PayloadCapture, total int64, err error) {
+	tx := LOG_DB.Model(&PayloadCapture{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if tokenId != 0 {
+		tx = tx.Where("token_id = ?", tokenId)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if requestId != "" {
+		tx = tx.Where("request_id = ?", requestId)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("request_body", "response_body").
+		Order("created_at desc").
+		Limit(num).Offset(startIdx).
+		Find(&captures).Error
+	return captures, total, err
+}
+
+// HasPayloadCapturesBefore 是否存在早于指定时间的采集记录，用于决定清理系统任务是否需要运行
+func HasPayloadCapturesBefore(targetTimestamp int64) bool {
+	var capture PayloadCapture
+	err := LOG_DB.Select("created_at").Where("created_at < ?", targetTimestamp).Limit(1).Find(&capture).Error
+	return err == nil && capture.CreatedAt != 0
+}
+
+// DeletePayloadCapturesBefore 删除早于指定时间的采集记录，ClickHouse 与 logs 清理一样一次性删除
+func DeletePayloadCapturesBefore(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if common.UsingLogDatabase(common.DatabaseTypeClickHouse) {
+		var total int64
+		if err := LOG_DB.WithContext(ctx).Model(&PayloadCapture{}).Where("created_at < ?", targetTimestamp).Count(&total).Error; err != nil {
+			return 0, err
+		}
+		if total == 0 {
+			return 0, nil
+		}
+		if err := LOG_DB.WithContext(ctx).Exec(
+			"ALTER TABLE payload_captures DELETE WHERE created_at < ? SETTINGS mutations_sync = 1",
+			targetTimestamp,
+		).Error; err != nil {
+			return 0, err
+		}
+		return total, nil
+	}
+
+	result := LOG_DB.WithContext(ctx).Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&PayloadCapture{})
+	return result.RowsAffected, result.Error
+}
+
+func clickHousePayloadCaptureCreateTableSQL() string {
+	return `
+CREATE TABLE IF NOT EXISTS payload_captures (
+	id Int64 DEFAULT 0,
+	request_id String DEFAULT '',
+	user_id Int32 DEFAULT 0,
+	token_id Int32 DEFAULT 0,
+	` + "`group`" + ` String DEFAULT '',
+	model_name String DEFAULT '',
+	channel_id Int32 DEFAULT 0,
+	path String DEFAULT '',
+	status_code Int32 DEFAULT 0,
+	is_stream UInt8 DEFAULT 0,
+	request_bytes Int32 DEFAULT 0,
+	response_bytes Int32 DEFAULT 0,
+	truncated UInt8 DEFAULT 0,
+	redacted UInt8 DEFAULT 0,
+	encrypted UInt8 DEFAULT 0,
+	request_body String DEFAULT '',
+	response_body String DEFAULT '',
+	created_at Int64 DEFAULT 0
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(toDateTime(created_at))
+ORDER BY (created_at, request_id)`
+}
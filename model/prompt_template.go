@@ -0,0 +1,293 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// PromptTemplateIdPrefix 模板对外 id 的前缀，用于和上游原生的 prompt id 区分
+const PromptTemplateIdPrefix = "pt_"
+
+var (
+	ErrPromptTemplateNotFound        = errors.New("prompt template not found")
+	ErrPromptTemplateVersionNotFound = errors.New("prompt template version not found")
+)
+
+// promptTemplatePlaceholderPattern 匹配 {{ name }} 形式的变量占位符
+var promptTemplatePlaceholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+// PromptTemplate 服务端提示词模板，请求通过 prompt.id 引用。
+// 内容按版本保存，已发布的版本不可修改，修改内容会产生新版本。
+type PromptTemplate struct {
+	Id             int    `json:"id"`
+	PromptId       string `json:"prompt_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	OrganizationId int    `json:"organization_id" gorm:"index;default:0"` // 非 0 时为组织共享模板，成员均可引用
+	Name           string `json:"name" gorm:"type:varchar(128)"`
+	Description    string `json:"description" gorm:"type:text"`
+	LatestVersion  int    `json:"latest_version" gorm:"default:1"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime    int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// PromptTemplateVersion 模板的一个版本及其使用统计
+type PromptTemplateVersion struct {
+	Id           int    `json:"id"`
+	TemplateId   int    `json:"template_id" gorm:"uniqueIndex:idx_prompt_template_version,priority:1"`
+	Version      int    `json:"version" gorm:"uniqueIndex:idx_prompt_template_version,priority:2"`
+	Content      string `json:"content" gorm:"type:text"`
+	Variables    string `json:"variables" gorm:"type:text"` // 变量默认值 JSON {"name":"default"}，未给出默认值的占位符为必填
+	Note         string `json:"note" gorm:"type:varchar(255)"`
+	CreatedBy    int    `json:"created_by"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	RequestCount int64  `json:"request_count" gorm:"default:0"`
+	UsedQuota    int64  `json:"used_quota" gorm:"default:0"`
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint;default:0"`
+}
+
+func (template *PromptTemplate) normalize() error {
+	template.Name = strings.TrimSpace(template.Name)
+	if length := utf8.RuneCountInString(template.Name); length == 0 || length > 128 {
+		return errors.New("name must be 1-128 characters")
+	}
+	return nil
+}
+
+// GetDefaults 返回变量默认值
+func (version *PromptTemplateVersion) GetDefaults() map[string]string {
+	defaults := map[string]string{}
+	if version.Variables != "" {
+		_ = common.UnmarshalJsonStr(version.Variables, &defaults)
+	}
+	return defaults
+}
+
+// Placeholders 返回内容中出现的变量名（去重、排序）
+func (version *PromptTemplateVersion) Placeholders() []string {
+	return PromptTemplatePlaceholders(version.Content)
+}
+
+// PromptTemplatePlaceholders 返回文本中出现的变量名（去重、排序）
+func PromptTemplatePlaceholders(content string) []string {
+	seen := map[string]struct{}{}
+	var names []string
+	for _, match := range promptTemplatePlaceholderPattern.FindAllStringSubmatch(content, -1) {
+		if _, ok := seen[match[1]]; ok {
+			continue
+		}
+		seen[match[1]] = struct{}{}
+		names = append(names, match[1])
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderPromptTemplate 用变量值替换占位符，请求未提供的变量使用默认值，两者都没有时返回错误
+func RenderPromptTemplate(content string, defaults map[string]string, values map[string]string) (string, error) {
+	var missing []string
+	for _, name := range PromptTemplatePlaceholders(content) {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if _, ok := defaults[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing prompt variables: %s", strings.Join(missing, ", "))
+	}
+	return promptTemplatePlaceholderPattern.ReplaceAllStringFunc(content, func(placeholder string) string {
+		name := promptTemplatePlaceholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return defaults[name]
+	}), nil
+}
+
+func (version *PromptTemplateVersion) normalize() error {
+	if strings.TrimSpace(version.Content) == "" {
+		return errors.New("content is required")
+	}
+	if version.Variables != "" {
+		var defaults map[string]string
+		if err := common.UnmarshalJsonStr(version.Variables, &defaults); err != nil {
+			return errors.New("variables must be a JSON object of string defaults")
+		}
+	}
+	if utf8.RuneCountInString(version.Note) > 255 {
+		return errors.New("note must be at most 255 characters")
+	}
+	return nil
+}
+
+// SameContent 判断两个版本的内容和默认值是否一致
+func (version *PromptTemplateVersion) SameContent(other *PromptTemplateVersion) bool {
+	if version.Content != other.Content {
+		return false
+	}
+	a, b := version.GetDefaults(), other.GetDefaults()
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if current, ok := b[key]; !ok || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+// CreatePromptTemplate 创建模板及其第一个版本
+func CreatePromptTemplate(template *PromptTemplate, version *PromptTemplateVersion) error {
+	if err := template.normalize(); err != nil {
+		return err
+	}
+	if err := version.normalize(); err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	template.PromptId = PromptTemplateIdPrefix + strings.ToLower(common.GetRandomString(24))
+	template.LatestVersion = 1
+	template.CreatedTime = now
+	template.UpdatedTime = now
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(template).Error; err != nil {
+			return err
+		}
+		version.TemplateId = template.Id
+		version.Version = 1
+		version.CreatedBy = template.UserId
+		version.CreatedTime = now
+		return tx.Create(version).Error
+	})
+}
+
+func GetPromptTemplateById(id int) (*PromptTemplate, error) {
+	var template PromptTemplate
+	if err := DB.First(&template, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+func GetPromptTemplateByPromptId(promptId string) (*PromptTemplate, error) {
+	var template PromptTemplate
+	if err := DB.First(&template, "prompt_id = ?", promptId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+// GetUserPromptTemplates 获取用户的个人模板
+func GetUserPromptTemplates(userId int) ([]*PromptTemplate, error) {
+	var templates []*PromptTemplate
+	err := DB.Where("user_id = ? AND organization_id = 0", userId).Order("id desc").Find(&templates).Error
+	return templates, err
+}
+
+// GetOrganizationPromptTemplates 获取组织共享的模板
+func GetOrganizationPromptTemplates(organizationId int) ([]*PromptTemplate, error) {
+	var templates []*PromptTemplate
+	err := DB.Where("organization_id = ?", organizationId).Order("id desc").Find(&templates).Error
+	return templates, err
+}
+
+func GetAllPromptTemplates(startIdx int, num int) (templates []*PromptTemplate, total int64, err error) {
+	if err = DB.Model(&PromptTemplate{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&templates).Error
+	return templates, total, err
+}
+
+// UpdateInfo 更新模板名称和描述，不产生新版本
+func (template *PromptTemplate) UpdateInfo(name string, description string) error {
+	template.Name = name
+	template.Description = description
+	if err := template.normalize(); err != nil {
+		return err
+	}
+	template.UpdatedTime = common.GetTimestamp()
+	return DB.Model(template).Select("name", "description", "updated_time").Updates(template).Error
+}
+
+// AddPromptTemplateVersion 为模板追加新版本，版本号在事务内递增
+func AddPromptTemplateVersion(template *PromptTemplate, version *PromptTemplateVersion) error {
+	if err := version.normalize(); err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&PromptTemplate{}).Where("id = ?", template.Id).Updates(map[string]interface{}{
+			"latest_version": gorm.Expr("latest_version + 1"),
+			"updated_time":   now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPromptTemplateNotFound
+		}
+		if err := tx.First(template, "id = ?", template.Id).Error; err != nil {
+			return err
+		}
+		version.TemplateId = template.Id
+		version.Version = template.LatestVersion
+		version.CreatedTime = now
+		return tx.Create(version).Error
+	})
+}
+
+// GetPromptTemplateVersions 获取模板的全部版本，新版本在前
+func GetPromptTemplateVersions(templateId int) ([]*PromptTemplateVersion, error) {
+	var versions []*PromptTemplateVersion
+	err := DB.Where("template_id = ?", templateId).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+func GetPromptTemplateVersion(templateId int, version int) (*PromptTemplateVersion, error) {
+	var templateVersion PromptTemplateVersion
+	if err := DB.First(&templateVersion, "template_id = ? AND version = ?", templateId, version).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromptTemplateVersionNotFound
+		}
+		return nil, err
+	}
+	return &templateVersion, nil
+}
+
+// DeletePromptTemplate 删除模板及其全部版本
+func DeletePromptTemplate(id int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", id).Delete(&PromptTemplateVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&PromptTemplate{}, "id = ?", id).Error
+	})
+}
+
+// RecordPromptTemplateUsage 累加版本的请求次数和消耗额度
+func RecordPromptTemplateUsage(templateId int, version int, quota int) error {
+	return DB.Model(&PromptTemplateVersion{}).
+		Where("template_id = ? AND version = ?", templateId, version).
+		Updates(map[string]interface{}{
+			"request_count":  gorm.Expr("request_count + 1"),
+			"used_quota":     gorm.Expr("used_quota + ?", quota),
+			"last_used_time": common.GetTimestamp(),
+		}).Error
+}
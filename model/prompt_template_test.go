@@ -0,0 +1,46 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptTemplateVersionsAndUsage(t *testing.T) {
+	truncateTables(t)
+	template := &PromptTemplate{UserId: 7, Name: "support"}
+	require.NoError(t, CreatePromptTemplate(template, &PromptTemplateVersion{Content: "You are {{role}}.", Variables: `{"role":"helpful"}`}))
+	assert.True(t, strings.HasPrefix(template.PromptId, PromptTemplateIdPrefix))
+
+	require.NoError(t, AddPromptTemplateVersion(template, &PromptTemplateVersion{Content: "You are {{ role }} for {{product}}.", CreatedBy: 7}))
+	assert.Equal(t, 2, template.LatestVersion)
+
+	require.NoError(t, RecordPromptTemplateUsage(template.Id, 2, 30))
+	require.NoError(t, RecordPromptTemplateUsage(template.Id, 2, 12))
+	versions, err := GetPromptTemplateVersions(template.Id)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Equal(t, int64(2), versions[0].RequestCount)
+	assert.Equal(t, int64(42), versions[0].UsedQuota)
+	assert.Equal(t, []string{"product", "role"}, versions[0].Placeholders())
+
+	_, err = GetPromptTemplateVersion(template.Id, 3)
+	assert.ErrorIs(t, err, ErrPromptTemplateVersionNotFound)
+
+	require.NoError(t, DeletePromptTemplate(template.Id))
+	_, err = GetPromptTemplateByPromptId(template.PromptId)
+	assert.ErrorIs(t, err, ErrPromptTemplateNotFound)
+}
+
+func TestRenderPromptTemplate(t *testing.T) {
+	content := "Hi {{name}}, welcome to {{ product }}. {{name}}!"
+	rendered, err := RenderPromptTemplate(content, map[string]string{"product": "Acme"}, map[string]string{"name": "Bo"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hi Bo, welcome to Acme. Bo!", rendered)
+
+	_, err = RenderPromptTemplate(content, nil, map[string]string{"product": "x"})
+	assert.EqualError(t, err, "missing prompt variables: name")
+}
@@ -0,0 +1,195 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/schema"
+)
+
+// 敏感字段通过 gorm 序列化器透明加解密：写入时加密，读出时解密，业务代码始终看到明文。
+// 注意按列更新（Update("key", ...) / Updates(map)）不会经过序列化器，需要先自行加密，见 UpdateChannelKey。
+func init() {
+	schema.RegisterSerializer("secret", secretSerializer{})
+	schema.RegisterSerializer("secret_lines", secretSerializer{perLine: true})
+}
+
+// secretSerializer perLine 为 true 时多行值逐行加密（多 key 渠道每个 key 一个数据密钥）
+type secretSerializer struct {
+	perLine bool
+}
+
+func (s secretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var raw string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unsupported secret column value %T", dbValue)
+	}
+	var plaintext string
+	var err error
+	if s.perLine {
+		plaintext, err = common.DecryptSecretLines(raw)
+	} else {
+		plaintext, err = common.DecryptSecret(raw)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s.%s: %w", field.Schema.Table, field.DBName, err)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (s secretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, _ := fieldValue.(string)
+	if s.perLine {
+		return common.EncryptSecretLines(plaintext)
+	}
+	return common.EncryptSecret(plaintext)
+}
+
+// UpdateChannelKey 只更新渠道密钥
+func UpdateChannelKey(id int, key string) error {
+	encrypted, err := common.EncryptSecretLines(key)
+	if err != nil {
+		return err
+	}
+	return DB.Model(&Channel{}).Where("id = ?", id).Update("key", encrypted).Error
+}
+
+// secretOptionKeys 存入 options 表前需要加密的配置项
+var secretOptionKeys = map[string]struct{}{
+	"EpayKey":                {},
+	"StripeApiSecret":        {},
+	"StripeWebhookSecret":    {},
+	"CreemApiKey":            {},
+	"CreemWebhookSecret":     {},
+	"WaffoApiKey":            {},
+	"WaffoPrivateKey":        {},
+	"WaffoSandboxApiKey":     {},
+	"WaffoSandboxPrivateKey": {},
+	"WaffoPancakePrivateKey": {},
+}
+
+func isSecretOption(key string) bool {
+	_, ok := secretOptionKeys[key]
+	return ok
+}
+
+func encryptOptionValue(key string, value string) (string, error) {
+	if !isSecretOption(key) {
+		return value, nil
+	}
+	return common.EncryptSecret(value)
+}
+
+func decryptOptionValue(key string, value string) (string, error) {
+	if !isSecretOption(key) {
+		return value, nil
+	}
+	return common.DecryptSecret(value)
+}
+
+// SecretRotationBatch 一批密钥轮换的结果，LastId 为本批最后一条记录的 id，Scanned 为 0 表示已处理完
+type SecretRotationBatch struct {
+	LastId  int
+	Scanned int
+	Rotated int
+	Failed  int
+}
+
+type secretColumnRow struct {
+	Id    int
+	Value string
+}
+
+// rotateSecretColumn 按 id 顺序读取一批原始列值（不经过序列化器），加密明文或重新包装旧主密钥的数据密钥后回写。
+// 回写时以原值为条件，避免覆盖并发修改；解密失败（如旧主密钥已移除）的记录计入 Failed 并跳过
+func rotateSecretColumn(table string, column string, quotedColumn string, afterId int, limit int, rotate func(string) (string, bool, error)) (SecretRotationBatch, error) {
+	batch := SecretRotationBatch{LastId: afterId}
+	var rows []secretColumnRow
+	err := DB.Table(table).Select("id, "+quotedColumn+" AS value").
+		Where("id > ?", afterId).Order("id asc").Limit(limit).Scan(&rows).Error
+	if err != nil {
+		return batch, err
+	}
+	for _, row := range rows {
+		batch.LastId = row.Id
+		batch.Scanned++
+		rotated, changed, err := rotate(row.Value)
+		if err != nil {
+			batch.Failed++
+			common.SysError(fmt.Sprintf("failed to rotate secret %s.%s #%d: %v", table, column, row.Id, err))
+			continue
+		}
+		if !changed {
+			continue
+		}
+		err = DB.Table(table).Where("id = ? AND "+quotedColumn+" = ?", row.Id, row.Value).Update(column, rotated).Error
+		if err != nil {
+			return batch, err
+		}
+		batch.Rotated++
+	}
+	return batch, nil
+}
+
+// RotateChannelKeySecrets 轮换一批渠道密钥
+func RotateChannelKeySecrets(afterId int, limit int) (SecretRotationBatch, error) {
+	return rotateSecretColumn("channels", "key", commonKeyCol, afterId, limit, common.RotateSecretLines)
+}
+
+// RotateCustomOAuthProviderSecrets 轮换一批自定义 OAuth 提供商的 client secret
+func RotateCustomOAuthProviderSecrets(afterId int, limit int) (SecretRotationBatch, error) {
+	return rotateSecretColumn("custom_oauth_providers", "client_secret", "client_secret", afterId, limit, common.RotateSecret)
+}
+
+// RotateOptionSecrets 轮换 options 表中的支付密钥
+func RotateOptionSecrets() (SecretRotationBatch, error) {
+	batch := SecretRotationBatch{}
+	keys := make([]string, 0, len(secretOptionKeys))
+	for key := range secretOptionKeys {
+		keys = append(keys, key)
+	}
+	var options []*Option
+	if err := DB.Where(commonKeyCol+" IN ?", keys).Find(&options).Error; err != nil {
+		return batch, err
+	}
+	for _, option := range options {
+		batch.Scanned++
+		rotated, changed, err := common.RotateSecret(option.Value)
+		if err != nil {
+			batch.Failed++
+			common.SysError(fmt.Sprintf("failed to rotate secret option %s: %v", option.Key, err))
+			continue
+		}
+		if !changed {
+			continue
+		}
+		err = DB.Model(&Option{}).Where(commonKeyCol+" = ? AND value = ?", option.Key, option.Value).Update("value", rotated).Error
+		if err != nil {
+			return batch, err
+		}
+		batch.Rotated++
+	}
+	return batch, nil
+}
+
+// CountSecretRotationRows 需要扫描的记录总数，用于进度展示
+func CountSecretRotationRows() (int64, error) {
+	var channels, providers int64
+	if err := DB.Model(&Channel{}).Count(&channels).Error; err != nil {
+		return 0, err
+	}
+	if err := DB.Model(&CustomOAuthProvider{}).Count(&providers).Error; err != nil {
+		return 0, err
+	}
+	return channels + providers + int64(len(secretOptionKeys)), nil
+}
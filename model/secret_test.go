@@ -0,0 +1,83 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useTestSecretKeyring(t *testing.T, primary string, keys map[string][]byte) {
+	t.Helper()
+	provider, err := common.NewLocalSecretKeyring(primary, keys)
+	require.NoError(t, err)
+	common.SetSecretKeyProvider(provider)
+	t.Cleanup(func() { common.SetSecretKeyProvider(nil) })
+}
+
+func rawChannelKey(t *testing.T, id int) string {
+	t.Helper()
+	var row secretColumnRow
+	require.NoError(t, DB.Table("channels").Select("id, "+commonKeyCol+" AS value").Where("id = ?", id).Scan(&row).Error)
+	return row.Value
+}
+
+func TestChannelKeyEncryptedAtRest(t *testing.T) {
+	truncateTables(t)
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	legacy := &Channel{Name: "legacy", Key: "sk-legacy"}
+	require.NoError(t, DB.Create(legacy).Error)
+
+	useTestSecretKeyring(t, "k1", map[string][]byte{"k1": oldKey})
+	channel := &Channel{Name: "multi", Key: "sk-a\nsk-b"}
+	require.NoError(t, DB.Create(channel).Error)
+	assert.NotContains(t, rawChannelKey(t, channel.Id), "sk-a")
+
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-a\nsk-b", loaded.Key)
+
+	require.NoError(t, UpdateChannelKey(channel.Id, "sk-c"))
+	assert.True(t, common.IsEncryptedSecret(rawChannelKey(t, channel.Id)))
+
+	useTestSecretKeyring(t, "k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	batch, err := RotateChannelKeySecrets(0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, batch.Scanned)
+	assert.Equal(t, 2, batch.Rotated)
+	assert.Zero(t, batch.Failed)
+
+	useTestSecretKeyring(t, "k2", map[string][]byte{"k2": newKey})
+	for id, want := range map[int]string{legacy.Id: "sk-legacy", channel.Id: "sk-c"} {
+		assert.True(t, common.IsEncryptedSecret(rawChannelKey(t, id)))
+		loaded, err := GetChannelById(id, true)
+		require.NoError(t, err)
+		assert.Equal(t, want, loaded.Key)
+	}
+}
+
+func TestSearchChannelsSkipsKeyMatchWhenEncrypted(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.Create(&Channel{Name: "plain", Key: "sk-search", Models: "gpt-4o"}).Error)
+
+	channels, err := SearchChannels("sk-search", "", "", false)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, "plain", channels[0].Name)
+
+	useTestSecretKeyring(t, "k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, DB.Create(&Channel{Name: "encrypted", Key: "sk-search", Models: "gpt-4o"}).Error)
+	channels, err = SearchChannels("sk-search", "", "", false)
+	require.NoError(t, err)
+	assert.Empty(t, channels)
+
+	channels, err = SearchChannels("encrypted", "", "gpt-4o", false)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, "encrypted", channels[0].Name)
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"encoding/json"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// StoredResponse 网关代为保存的 Responses API 响应。ResponseId 为返回给客户端的响应 id，
+// InputItems 为本轮请求的输入项（JSON 数组，不含历史），Response 为完整的响应对象 JSON。
+// 通过 PreviousResponseId 串联成会话链，解析 previous_response_id 时逐级向前追溯。
+type StoredResponse struct {
+	Id                 int    `json:"id"`
+	ResponseId         string `json:"response_id" gorm:"type:varchar(128);uniqueIndex"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	TokenId            int    `json:"token_id"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(128)"`
+	Model              string `json:"model" gorm:"type:varchar(255)"`
+	Status             string `json:"status" gorm:"type:varchar(32)"`
+	InputItems         string `json:"input_items"`
+	Response           string `json:"response"`
+	CreatedAt          int64  `json:"created_at" gorm:"bigint"`
+	ExpiresAt          int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (response *StoredResponse) Insert() error {
+	if response.CreatedAt == 0 {
+		response.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(response).Error
+}
+
+func (response *StoredResponse) IsExpired() bool {
+	return response.ExpiresAt > 0 && response.ExpiresAt < common.GetTimestamp()
+}
+
+// GetInputItems 返回本轮请求的输入项
+func (response *StoredResponse) GetInputItems() ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	if response.InputItems == "" {
+		return items, nil
+	}
+	err := common.UnmarshalJsonStr(response.InputItems, &items)
+	return items, err
+}
+
+// GetUserStoredResponse 获取用户自己保存的响应，已过期的响应视为不存在
+func GetUserStoredResponse(userId int, responseId string) (*StoredResponse, error) {
+	var response StoredResponse
+	err := DB.Where("user_id = ? AND response_id = ?", userId, responseId).First(&response).Error
+	if err != nil {
+		return nil, err
+	}
+	if response.IsExpired() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &response, nil
+}
+
+func DeleteStoredResponseById(id int) error {
+	return DB.Delete(&StoredResponse{}, "id = ?", id).Error
+}
+
+// DeleteExpiredStoredResponses 删除一批已过期的响应，返回删除条数，供清理任务分批调用
+func DeleteExpiredStoredResponses(limit int) (int64, error) {
+	var ids []int
+	err := DB.Model(&StoredResponse{}).
+		Where("expires_at > 0 AND expires_at < ?", common.GetTimestamp()).
+		Order("id asc").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := DB.Delete(&StoredResponse{}, "id IN ?", ids)
+	return result.RowsAffected, result.Error
+}
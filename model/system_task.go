@@ -16,11 +16,19 @@ const (
 	SystemTaskStatusSucceeded SystemTaskStatus = "succeeded"
 	SystemTaskStatusFailed    SystemTaskStatus = "failed"
 
-	SystemTaskTypeLogCleanup     = "log_cleanup"
-	SystemTaskTypeChannelTest    = "channel_test"
-	SystemTaskTypeModelUpdate    = "model_update"
-	SystemTaskTypeMidjourneyPoll = "midjourney_poll"
-	SystemTaskTypeAsyncTaskPoll  = "async_task_poll"
+	SystemTaskTypeLogCleanup            = "log_cleanup"
+	SystemTaskTypeChannelTest           = "channel_test"
+	SystemTaskTypeModelUpdate           = "model_update"
+	SystemTaskTypeMidjourneyPoll        = "midjourney_poll"
+	SystemTaskTypeAsyncTaskPoll         = "async_task_poll"
+	SystemTaskTypeFileCleanup           = "file_cleanup"
+	SystemTaskTypeBatchExecution        = "batch_execution"
+	SystemTaskTypeResponseCleanup       = "response_cleanup"
+	SystemTaskTypeGeminiResourceCleanup = "gemini_resource_cleanup"
+	SystemTaskTypeSecretRotation        = "secret_rotation"
+	SystemTaskTypeTaskCallbackDelivery  = "task_callback_delivery"
+	SystemTaskTypeMediaAssetCleanup     = "media_asset_cleanup"
+	SystemTaskTypePayloadCaptureCleanup = "payload_capture_cleanup"
 )
 
 var ErrSystemTaskLockLost = errors.New("system task lock lost")
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TaskCallbackEventProgress  = "task.progress"
+	TaskCallbackEventSucceeded = "task.succeeded"
+	TaskCallbackEventFailed    = "task.failed"
+)
+
+const (
+	TaskCallbackStatusPending    = "pending"
+	TaskCallbackStatusSucceeded  = "succeeded"
+	TaskCallbackStatusFailed     = "failed"     // 重试次数用尽
+	TaskCallbackStatusSuperseded = "superseded" // 未投递成功的进度通知被同一任务的终态通知取代
+)
+
+// TaskCallback 一次任务回调通知及其投递记录。Payload 在事件发生时生成，与查询接口返回的内容一致，
+// 重试时原样重发；投递由 task_callback_delivery 系统任务按 NextAttemptAt 分批完成。
+type TaskCallback struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	TaskId         string `json:"task_id" gorm:"type:varchar(191);index"` // 对外任务 ID（task_xxx 或 Midjourney 任务 ID）
+	Platform       string `json:"platform" gorm:"type:varchar(30)"`
+	Event          string `json:"event" gorm:"type:varchar(32)"`
+	Progress       string `json:"progress" gorm:"type:varchar(20)"`
+	CallbackUrl    string `json:"callback_url" gorm:"type:varchar(1024)"`
+	Payload        string `json:"payload" gorm:"type:text"`
+	Status         string `json:"status" gorm:"type:varchar(16);index"`
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  int64  `json:"next_attempt_at" gorm:"bigint;index"`
+	LastStatusCode int    `json:"last_status_code"`
+	LastError      string `json:"last_error" gorm:"type:text"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt      int64  `json:"updated_at" gorm:"bigint"`
+	DeliveredAt    int64  `json:"delivered_at" gorm:"bigint"`
+}
+
+func (callback *TaskCallback) Insert() error {
+	now := common.GetTimestamp()
+	if callback.CreatedAt == 0 {
+		callback.CreatedAt = now
+	}
+	callback.UpdatedAt = now
+	if callback.Status == "" {
+		callback.Status = TaskCallbackStatusPending
+	}
+	if callback.NextAttemptAt == 0 {
+		callback.NextAttemptAt = now
+	}
+	return DB.Create(callback).Error
+}
+
+// UpdateDeliveryResult 保存一次投递的结果，仅在记录仍为待投递时生效，避免覆盖已被取代的记录
+func (callback *TaskCallback) UpdateDeliveryResult() (bool, error) {
+	callback.UpdatedAt = common.GetTimestamp()
+	result := DB.Model(callback).Where("status = ?", TaskCallbackStatusPending).
+		Select("status", "attempts", "next_attempt_at", "last_status_code", "last_error", "updated_at", "delivered_at").
+		Updates(callback)
+	return result.RowsAffected > 0, result.Error
+}
+
+// SupersedeTaskCallbacks 任务进入终态时，把该任务尚未投递成功的进度通知标记为已取代
+func SupersedeTaskCallbacks(taskId string) error {
+	return DB.Model(&TaskCallback{}).
+		Where("task_id = ? AND status = ? AND event = ?", taskId, TaskCallbackStatusPending, TaskCallbackEventProgress).
+		Updates(map[string]any{"status": TaskCallbackStatusSuperseded, "updated_at": common.GetTimestamp()}).Error
+}
+
+// GetDueTaskCallbacks 按创建顺序获取一批到期待投递的通知
+func GetDueTaskCallbacks(now int64, limit int) ([]*TaskCallback, error) {
+	var callbacks []*TaskCallback
+	err := DB.Where("status = ? AND next_attempt_at <= ?", TaskCallbackStatusPending, now).
+		Order("id asc").Limit(limit).Find(&callbacks).Error
+	return callbacks, err
+}
+
+// HasDueTaskCallbacks 是否存在到期待投递的通知，用于决定投递系统任务是否需要运行
+func HasDueTaskCallbacks(now int64) bool {
+	var id int
+	err := DB.Model(&TaskCallback{}).
+		Where("status = ? AND next_attempt_at <= ?", TaskCallbackStatusPending, now).
+		Limit(1).
+		Pluck("id", &id).Error
+	return err == nil && id != 0
+}
+
+// RetryTaskCallback 把用户自己的一条通知重新放回投递队列，并重置投递次数
+func RetryTaskCallback(userId int, id int) (*TaskCallback, error) {
+	var callback TaskCallback
+	if err := DB.Where("id = ? AND user_id = ?", id, userId).First(&callback).Error; err != nil {
+		return nil, err
+	}
+	now := common.GetTimestamp()
+	callback.Status = TaskCallbackStatusPending
+	callback.Attempts = 0
+	callback.NextAttemptAt = now
+	callback.UpdatedAt = now
+	err := DB.Model(&callback).Select("status", "attempts", "next_attempt_at", "updated_at").Updates(&callback).Error
+	return &callback, err
+}
+
+// TaskCallbackQueryParams 投递记录查询条件
+type TaskCallbackQueryParams struct {
+	UserId int
+	TaskId string
+	Status string
+}
+
+func (params TaskCallbackQueryParams) apply() *gorm.DB {
+	query := DB.Model(&TaskCallback{})
+	if params.UserId != 0 {
+		query = query.Where("user_id = ?", params.UserId)
+	}
+	if params.TaskId != "" {
+		query = query.Where("task_id = ?", params.TaskId)
+	}
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+	return query
+}
+
+// ListTaskCallbacks 按时间倒序分页列出投递记录
+func ListTaskCallbacks(params TaskCallbackQueryParams, startIdx int, num int) ([]*TaskCallback, int64, error) {
+	var callbacks []*TaskCallback
+	var total int64
+	if err := params.apply().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := params.apply().Order("id desc").Limit(num).Offset(startIdx).Find(&callbacks).Error
+	return callbacks, total, err
+}
+
+// DeleteTaskCallbacksBefore 删除一批在 before 之前创建且已结束的投递记录，返回删除条数
+func DeleteTaskCallbacksBefore(before int64, limit int) (int64, error) {
+	var ids []int
+	err := DB.Model(&TaskCallback{}).
+		Where("created_at < ? AND status <> ?", before, TaskCallbackStatusPending).
+		Order("id asc").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := DB.Delete(&TaskCallback{}, "id IN ?", ids)
+	return result.RowsAffected, result.Error
+}
@@ -57,6 +57,17 @@ func TestMain(m *testing.M) {
 		&SystemInstance{},
 		&SystemTask{},
 		&SystemTaskLock{},
+		&Organization{},
+		&OrganizationMember{},
+		&OrganizationInvitation{},
+		&McpServer{},
+		&PromptTemplate{},
+		&PromptTemplateVersion{},
+		&StoredResponse{},
+		&GeminiResource{},
+		&TaskCallback{},
+		&MediaAsset{},
+		&PayloadCapture{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -89,6 +100,17 @@ func truncateTables(t *testing.T) {
 		DB.Exec("DELETE FROM system_instances")
 		DB.Exec("DELETE FROM system_task_locks")
 		DB.Exec("DELETE FROM system_tasks")
+		DB.Exec("DELETE FROM organizations")
+		DB.Exec("DELETE FROM organization_members")
+		DB.Exec("DELETE FROM organization_invitations")
+		DB.Exec("DELETE FROM mcp_servers")
+		DB.Exec("DELETE FROM prompt_templates")
+		DB.Exec("DELETE FROM prompt_template_versions")
+		DB.Exec("DELETE FROM stored_responses")
+		DB.Exec("DELETE FROM gemini_resources")
+		DB.Exec("DELETE FROM task_callbacks")
+		DB.Exec("DELETE FROM media_assets")
+		DB.Exec("DELETE FROM payload_captures")
 	})
 }
 
@@ -27,7 +27,15 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`                             // 跨分组重试，仅auto分组有效
+	ResponseCache      bool           `json:"response_cache"`                                // 启用响应缓存，需同时开启全局响应缓存
+	Hedge              bool           `json:"hedge"`                                         // 启用对冲请求，需同时开启全局对冲设置
+	TPMLimit           int            `json:"tpm_limit" gorm:"default:0"`                    // 每分钟 tokens 上限，0 使用分组默认值
+	TPDLimit           int64          `json:"tpd_limit" gorm:"bigint;default:0"`             // 每天 tokens 上限，0 使用分组默认值
+	ConcurrencyLimit   int            `json:"concurrency_limit" gorm:"default:0"`            // 并发请求上限，0 使用分组默认值
+	OrganizationId     int            `json:"organization_id" gorm:"index;default:0"`        // 所属组织，非 0 时从组织额度池扣费
+	Moderation         string         `json:"moderation" gorm:"type:varchar(16);default:''"` // 内容审核处理方式，为空沿用分组策略，只能比分组更严格
+	TaskCallbackUrl    string         `json:"task_callback_url" gorm:"type:varchar(512)"`    // 异步任务默认回调地址，请求未指定 callback_url 时使用
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -302,7 +310,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "response_cache", "hedge",
+		"tpm_limit", "tpd_limit", "concurrency_limit", "moderation", "task_callback_url").Updates(token).Error
 	return err
 }
 
@@ -181,3 +181,18 @@ func GetAllQuotaDates(startTime int64, endTime int64, username string) (quotaDat
 	err = DB.Table("quota_data").Select("model_name, sum(count) as count, sum(quota) as quota, sum(token_used) as token_used, created_at").Where("created_at >= ? and created_at <= ?", startTime, endTime).Group("model_name, created_at").Find(&quotaDatas).Error
 	return quotaDatas, err
 }
+
+// GetQuotaDataByOrganization 按组织令牌聚合用量，userId 为 0 时返回全部成员
+func GetQuotaDataByOrganization(organizationId int, userId int, startTime int64, endTime int64) (quotaData []*QuotaData, err error) {
+	var quotaDatas []*QuotaData
+	query := DB.Table("quota_data").
+		Joins("JOIN tokens ON tokens.id = quota_data.token_id").
+		Select("quota_data.user_id, quota_data.username, quota_data.model_name, quota_data.created_at, sum(quota_data.count) as count, sum(quota_data.quota) as quota, sum(quota_data.token_used) as token_used").
+		Where("tokens.organization_id = ? and quota_data.created_at >= ? and quota_data.created_at <= ?", organizationId, startTime, endTime)
+	if userId != 0 {
+		query = query.Where("quota_data.user_id = ?", userId)
+	}
+	err = query.Group("quota_data.user_id, quota_data.username, quota_data.model_name, quota_data.created_at").
+		Find(&quotaDatas).Error
+	return quotaDatas, err
+}
@@ -917,6 +917,34 @@ func TestImageAudioZero(t *testing.T) {
 	}
 }
 
+func TestCacheStorageVariable(t *testing.T) {
+	exprStr := `tier("base", p * 1.25 + c * 10 + cr * 0.31 + csh * 4.5)`
+	// storage-only evaluation: 100k cached tokens kept for 2 hours
+	cost, trace, err := billingexpr.RunExpr(exprStr, billingexpr.TokenParams{CSH: 200000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 200000*4.5 = 900000 → $0.90
+	if math.Abs(cost-900000) > 1e-6 {
+		t.Errorf("cost = %f, want 900000", cost)
+	}
+	if trace.MatchedTier != "base" {
+		t.Errorf("tier = %q, want base", trace.MatchedTier)
+	}
+
+	// csh defaults to 0 for normal requests
+	cost, _, err = billingexpr.RunExpr(exprStr, billingexpr.TokenParams{P: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(cost-1250) > 1e-6 {
+		t.Errorf("cost = %f, want 1250", cost)
+	}
+	if !billingexpr.UsedVars(exprStr)["csh"] {
+		t.Error("expected csh to be reported as used")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // len variable tests — tier conditions based on context length
 // ---------------------------------------------------------------------------
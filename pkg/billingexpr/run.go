@@ -16,6 +16,7 @@ import (
 //   - p, c             — prompt / completion tokens (auto-excluding separately-priced sub-categories)
 //   - len              — total input context length for tier conditions (never reduced by sub-category exclusion)
 //   - cr, cc, cc1h     — cache read / creation / creation-1h tokens
+//   - csh              — cached content storage token-hours (only set when billing cache storage)
 //   - tier(name, value) — trace callback that records which tier matched
 //   - max, min, abs, ceil, floor — standard math helpers
 //
@@ -63,6 +64,7 @@ func runProgram(prog *vm.Program, params TokenParams, request RequestInput) (flo
 		"img_o": params.ImgO,
 		"ai":    params.AI,
 		"ao":    params.AO,
+		"csh":   params.CSH,
 		"tier": func(name string, value float64) float64 {
 			trace.MatchedTier = name
 			trace.Cost = value
@@ -26,6 +26,7 @@ type TokenParams struct {
 	ImgO float64 // image output tokens
 	AI   float64 // audio input tokens
 	AO   float64 // audio output tokens
+	CSH  float64 // cached content storage token-hours (Gemini cachedContents: cached tokens × hours stored)
 }
 
 // TraceResult holds side-channel info captured by the tier() function
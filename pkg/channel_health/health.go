@@ -0,0 +1,156 @@
+// Package channelhealth keeps live, in-process per-channel statistics used by
+// the channel routing strategies: EWMA latency and error rate per
+// (channel, model) and the number of in-flight requests per channel.
+//
+// Unlike pkg/perf_metrics, which aggregates per model/group into time buckets
+// for reporting, these stats are never persisted; every node routes on what it
+// observed itself.
+package channelhealth
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ewmaAlpha is the weight of the newest sample.
+	ewmaAlpha = 0.2
+	// staleAfter drops stats that have not been updated recently so a channel
+	// that was penalised and then starved of traffic gets a fresh start.
+	staleAfter = 10 * time.Minute
+	// minSamples is the number of samples before stats are trusted.
+	minSamples = 5
+)
+
+type statKey struct {
+	channelId int
+	model     string
+}
+
+type channelStat struct {
+	mu         sync.Mutex
+	latencyMs  float64
+	errorRate  float64
+	samples    int
+	hasLatency bool
+	updatedAt  time.Time
+}
+
+var (
+	stats    sync.Map // statKey -> *channelStat
+	inFlight sync.Map // channelId -> *atomic.Int64
+	nowFunc  = time.Now
+)
+
+// Stats is a snapshot of the live stats of a channel for one model.
+type Stats struct {
+	LatencyMs float64
+	ErrorRate float64
+	Samples   int
+	InFlight  int64
+	// Known is false when there are too few or only stale samples.
+	Known bool
+	// HasLatency is false until at least one successful request was observed.
+	HasLatency bool
+}
+
+func getStat(channelId int, model string) *channelStat {
+	actual, _ := stats.LoadOrStore(statKey{channelId: channelId, model: model}, &channelStat{})
+	return actual.(*channelStat)
+}
+
+func (s *channelStat) record(success bool, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := nowFunc()
+	if s.samples > 0 && now.Sub(s.updatedAt) > staleAfter {
+		*s = channelStat{}
+	}
+	errorSample := 1.0
+	if success {
+		errorSample = 0
+	}
+	if s.samples == 0 {
+		s.errorRate = errorSample
+	} else {
+		s.errorRate += ewmaAlpha * (errorSample - s.errorRate)
+	}
+	if success {
+		ms := float64(latency.Milliseconds())
+		if !s.hasLatency {
+			s.latencyMs = ms
+			s.hasLatency = true
+		} else {
+			s.latencyMs += ewmaAlpha * (ms - s.latencyMs)
+		}
+	}
+	s.samples++
+	s.updatedAt = now
+}
+
+// RecordSuccess records a successful attempt. latency should be the time to
+// first byte for streams and the full response time otherwise.
+func RecordSuccess(channelId int, model string, latency time.Duration) {
+	if channelId <= 0 {
+		return
+	}
+	getStat(channelId, model).record(true, latency)
+}
+
+// RecordFailure records an attempt that failed because of the channel.
+func RecordFailure(channelId int, model string) {
+	if channelId <= 0 {
+		return
+	}
+	getStat(channelId, model).record(false, 0)
+}
+
+func inFlightCounter(channelId int) *atomic.Int64 {
+	actual, _ := inFlight.LoadOrStore(channelId, &atomic.Int64{})
+	return actual.(*atomic.Int64)
+}
+
+// Acquire marks a request to channelId as in flight; call the returned
+// function once the request has finished.
+func Acquire(channelId int) func() {
+	counter := inFlightCounter(channelId)
+	counter.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { counter.Add(-1) })
+	}
+}
+
+// Get returns the live stats of channelId for model.
+func Get(channelId int, model string) Stats {
+	result := Stats{InFlight: inFlightCounter(channelId).Load()}
+	value, ok := stats.Load(statKey{channelId: channelId, model: model})
+	if !ok {
+		return result
+	}
+	s := value.(*channelStat)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.samples == 0 || nowFunc().Sub(s.updatedAt) > staleAfter {
+		return result
+	}
+	result.LatencyMs = s.latencyMs
+	result.ErrorRate = s.errorRate
+	result.Samples = s.samples
+	result.HasLatency = s.hasLatency
+	result.Known = s.samples >= minSamples
+	return result
+}
+
+// Reset clears all stats, used by tests.
+func Reset() {
+	stats.Range(func(key, _ any) bool {
+		stats.Delete(key)
+		return true
+	})
+	inFlight.Range(func(key, _ any) bool {
+		inFlight.Delete(key)
+		return true
+	})
+}
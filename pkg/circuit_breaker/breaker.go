@@ -0,0 +1,326 @@
+// Package circuitbreaker implements the per channel and per channel key
+// circuit breaker used by channel selection.
+//
+// A breaker opens after operation_setting.CircuitBreakerSetting.ConsecutiveFailures
+// consecutive failures or when the error rate within the window reaches
+// ErrorRateThreshold. While open the channel (or key) is skipped. Once
+// OpenSeconds have passed it becomes half-open and lets HalfOpenRequests real
+// requests through; it closes when all of them succeed and opens again on the
+// first failure.
+//
+// When Redis is enabled the state is stored there so every node sees the same
+// breakers; otherwise it lives in process memory.
+package circuitbreaker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// ChannelLevel is the key index of the breaker guarding a whole channel.
+const ChannelLevel = -1
+
+// entry is the persisted breaker state.
+type entry struct {
+	State          State `json:"state,omitempty"`
+	Failures       int   `json:"failures,omitempty"`
+	WindowStart    int64 `json:"window_start,omitempty"`
+	WindowTotal    int   `json:"window_total,omitempty"`
+	WindowFailures int   `json:"window_failures,omitempty"`
+	// OpenUntil is the end of the open period, or the probe deadline while
+	// half-open, in unix milliseconds.
+	OpenUntil      int64 `json:"open_until,omitempty"`
+	Probes         int   `json:"probes,omitempty"`
+	ProbeSuccesses int   `json:"probe_successes,omitempty"`
+}
+
+type config struct {
+	consecutiveFailures int
+	errorRateThreshold  float64
+	minRequests         int
+	window              time.Duration
+	open                time.Duration
+	halfOpenRequests    int
+}
+
+var nowFunc = time.Now
+
+func currentConfig() (config, bool) {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	cfg := config{
+		consecutiveFailures: setting.ConsecutiveFailures,
+		errorRateThreshold:  setting.ErrorRateThreshold,
+		minRequests:         setting.MinRequests,
+		window:              time.Duration(setting.WindowSeconds) * time.Second,
+		open:                time.Duration(setting.OpenSeconds) * time.Second,
+		halfOpenRequests:    setting.HalfOpenRequests,
+	}
+	if cfg.window <= 0 {
+		cfg.window = time.Minute
+	}
+	if cfg.open <= 0 {
+		cfg.open = 30 * time.Second
+	}
+	if cfg.halfOpenRequests <= 0 {
+		cfg.halfOpenRequests = 1
+	}
+	return cfg, setting.Enabled
+}
+
+func (cfg config) ttl() time.Duration {
+	return cfg.window + cfg.open + time.Minute
+}
+
+// effective resolves the time based transitions: an expired open breaker is
+// half-open, and a half-open breaker whose probes never reported back gets a
+// fresh set of probes after the deadline.
+func (e entry) effective(now time.Time, cfg config) entry {
+	nowMs := now.UnixMilli()
+	switch e.State {
+	case StateOpen:
+		if nowMs >= e.OpenUntil {
+			e.State = StateHalfOpen
+			e.Probes = 0
+			e.ProbeSuccesses = 0
+			e.OpenUntil = nowMs + cfg.open.Milliseconds()
+		}
+	case StateHalfOpen:
+		if e.Probes >= cfg.halfOpenRequests && nowMs >= e.OpenUntil {
+			e.Probes = e.ProbeSuccesses
+			e.OpenUntil = nowMs + cfg.open.Milliseconds()
+		}
+	case "":
+		e.State = StateClosed
+	}
+	return e
+}
+
+func (e entry) available(now time.Time, cfg config) bool {
+	e = e.effective(now, cfg)
+	switch e.State {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		return e.Probes < cfg.halfOpenRequests
+	default:
+		return true
+	}
+}
+
+func (e *entry) admit(now time.Time, cfg config) bool {
+	*e = e.effective(now, cfg)
+	if e.State != StateHalfOpen {
+		return false
+	}
+	e.Probes++
+	return true
+}
+
+func (e *entry) trip(now time.Time, cfg config) {
+	*e = entry{State: StateOpen, OpenUntil: now.Add(cfg.open).UnixMilli()}
+}
+
+// record applies the outcome of a request and reports whether the breaker
+// changed between closed and open.
+func (e *entry) record(success bool, now time.Time, cfg config) (opened bool, closed bool) {
+	*e = e.effective(now, cfg)
+	switch e.State {
+	case StateOpen:
+		// 熔断前已发出的请求，结果不再计入
+		return false, false
+	case StateHalfOpen:
+		if !success {
+			e.trip(now, cfg)
+			return true, false
+		}
+		e.ProbeSuccesses++
+		if e.ProbeSuccesses >= cfg.halfOpenRequests {
+			*e = entry{State: StateClosed}
+			return false, true
+		}
+		return false, false
+	}
+
+	if now.Unix()-e.WindowStart >= int64(cfg.window/time.Second) {
+		e.WindowStart = now.Unix()
+		e.WindowTotal = 0
+		e.WindowFailures = 0
+	}
+	e.WindowTotal++
+	if success {
+		e.Failures = 0
+		return false, false
+	}
+	e.Failures++
+	e.WindowFailures++
+	if cfg.consecutiveFailures > 0 && e.Failures >= cfg.consecutiveFailures {
+		e.trip(now, cfg)
+		return true, false
+	}
+	if cfg.errorRateThreshold > 0 && e.WindowTotal >= cfg.minRequests &&
+		float64(e.WindowFailures)/float64(e.WindowTotal) >= cfg.errorRateThreshold {
+		e.trip(now, cfg)
+		return true, false
+	}
+	return false, false
+}
+
+func breakerKey(channelId int, keyIndex int) string {
+	return fmt.Sprintf("%d:%d", channelId, keyIndex)
+}
+
+// Available reports whether a request may be sent to the channel (keyIndex
+// ChannelLevel) or to one key of a multi-key channel. It does not consume a
+// half-open probe; call Admit once the target has actually been chosen.
+func Available(channelId int, keyIndex int) bool {
+	cfg, enabled := currentConfig()
+	if !enabled {
+		return true
+	}
+	e, err := getStore().load(breakerKey(channelId, keyIndex))
+	if err != nil {
+		return true
+	}
+	return e.available(nowFunc(), cfg)
+}
+
+// Admit counts a request chosen for the target as a probe when its breaker
+// is half-open. Only the relay selection path calls it, so other users of a
+// channel key do not use up probes. The state is first checked with the same
+// cached read as Available; the store is only written, which under Redis is a
+// WATCH/MULTI transaction, when the breaker is (or has just become) half-open.
+func Admit(channelId int, keyIndex int) {
+	cfg, enabled := currentConfig()
+	if !enabled {
+		return
+	}
+	now := nowFunc()
+	key := breakerKey(channelId, keyIndex)
+	if e, err := getStore().load(key); err == nil && e.effective(now, cfg).State != StateHalfOpen {
+		return
+	}
+	_, _ = getStore().update(key, cfg.ttl(), func(e *entry) bool {
+		return e.admit(now, cfg)
+	})
+}
+
+// RecordSuccess records a successful request to the target.
+func RecordSuccess(channelId int, keyIndex int) {
+	record(channelId, keyIndex, true)
+}
+
+// RecordFailure records a request to the target that failed because of the
+// channel.
+func RecordFailure(channelId int, keyIndex int) {
+	record(channelId, keyIndex, false)
+}
+
+func record(channelId int, keyIndex int, success bool) {
+	cfg, enabled := currentConfig()
+	if !enabled || channelId <= 0 {
+		return
+	}
+	now := nowFunc()
+	var opened, closed bool
+	_, err := getStore().update(breakerKey(channelId, keyIndex), cfg.ttl(), func(e *entry) bool {
+		before := *e
+		opened, closed = e.record(success, now, cfg)
+		return *e != before
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update circuit breaker of channel #%d: %s", channelId, err.Error()))
+		return
+	}
+	target := fmt.Sprintf("channel #%d", channelId)
+	if keyIndex != ChannelLevel {
+		target = fmt.Sprintf("channel #%d key #%d", channelId, keyIndex)
+	}
+	if opened {
+		common.SysLog(fmt.Sprintf("circuit breaker opened for %s", target))
+	} else if closed {
+		common.SysLog(fmt.Sprintf("circuit breaker closed for %s", target))
+	}
+}
+
+// TargetStatus is the breaker state of a channel or key as shown to admins.
+type TargetStatus struct {
+	State               State `json:"state"`
+	ConsecutiveFailures int   `json:"consecutive_failures,omitempty"`
+	// OpenUntil is when an open breaker turns half-open, in unix seconds.
+	OpenUntil int64 `json:"open_until,omitempty"`
+}
+
+// ChannelStatus is the breaker state of a channel and of its keys. Keys whose
+// breaker is closed are omitted.
+type ChannelStatus struct {
+	TargetStatus
+	Keys map[int]TargetStatus `json:"keys,omitempty"`
+}
+
+func (e entry) status(now time.Time, cfg config) TargetStatus {
+	e = e.effective(now, cfg)
+	status := TargetStatus{State: e.State, ConsecutiveFailures: e.Failures}
+	if e.State == StateOpen {
+		status.OpenUntil = e.OpenUntil / 1000
+	}
+	return status
+}
+
+// GetChannelStatus returns the breaker state of a channel with keyCount keys,
+// or nil when the circuit breaker is disabled.
+func GetChannelStatus(channelId int, keyCount int) *ChannelStatus {
+	cfg, enabled := currentConfig()
+	if !enabled {
+		return nil
+	}
+	keys := []string{breakerKey(channelId, ChannelLevel)}
+	for i := 0; i < keyCount; i++ {
+		keys = append(keys, breakerKey(channelId, i))
+	}
+	entries, err := getStore().loadMany(keys)
+	if err != nil {
+		return nil
+	}
+	now := nowFunc()
+	result := &ChannelStatus{TargetStatus: entries[0].status(now, cfg)}
+	for i, e := range entries[1:] {
+		status := e.status(now, cfg)
+		if status.State == StateClosed {
+			continue
+		}
+		if result.Keys == nil {
+			result.Keys = make(map[int]TargetStatus)
+		}
+		result.Keys[i] = status
+	}
+	return result
+}
+
+var memoryStore = newMemoryStore()
+
+func getStore() store {
+	if common.RedisEnabled && common.RDB != nil {
+		return redisStore{}
+	}
+	return memoryStore
+}
+
+// Reset clears the in-memory state, used by tests.
+func Reset() {
+	memoryStore.reset()
+	peekCache.Range(func(key, _ any) bool {
+		peekCache.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,136 @@
+package circuitbreaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useTestBreaker(t *testing.T) *time.Time {
+	t.Helper()
+	setting := operation_setting.GetCircuitBreakerSetting()
+	previous := *setting
+	setting.Enabled = true
+	setting.ConsecutiveFailures = 3
+	setting.ErrorRateThreshold = 0.5
+	setting.MinRequests = 10
+	setting.WindowSeconds = 60
+	setting.OpenSeconds = 30
+	setting.HalfOpenRequests = 2
+
+	now := time.Unix(1_700_000_000, 0)
+	nowFunc = func() time.Time { return now }
+	Reset()
+	t.Cleanup(func() {
+		*setting = previous
+		nowFunc = time.Now
+		Reset()
+	})
+	return &now
+}
+
+func TestBreakerOpensHalfOpensAndCloses(t *testing.T) {
+	now := useTestBreaker(t)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, Available(1, ChannelLevel))
+		RecordFailure(1, ChannelLevel)
+	}
+	assert.False(t, Available(1, ChannelLevel))
+	assert.True(t, Available(2, ChannelLevel), "other channels are unaffected")
+	assert.Equal(t, StateOpen, GetChannelStatus(1, 0).State)
+
+	*now = now.Add(31 * time.Second)
+	assert.True(t, Available(1, ChannelLevel))
+	Admit(1, ChannelLevel)
+	Admit(1, ChannelLevel)
+	assert.False(t, Available(1, ChannelLevel), "half-open admits a limited number of probes")
+
+	RecordSuccess(1, ChannelLevel)
+	RecordSuccess(1, ChannelLevel)
+	assert.True(t, Available(1, ChannelLevel))
+	assert.Equal(t, StateClosed, GetChannelStatus(1, 0).State)
+}
+
+func TestBreakerReopensOnHalfOpenFailure(t *testing.T) {
+	now := useTestBreaker(t)
+
+	for i := 0; i < 3; i++ {
+		RecordFailure(1, 0)
+	}
+	*now = now.Add(31 * time.Second)
+	Admit(1, 0)
+	RecordFailure(1, 0)
+	assert.False(t, Available(1, 0))
+	assert.True(t, Available(1, 1), "keys have independent breakers")
+
+	status := GetChannelStatus(1, 2)
+	assert.Equal(t, StateClosed, status.State)
+	assert.Equal(t, StateOpen, status.Keys[0].State)
+	assert.NotContains(t, status.Keys, 1)
+}
+
+func TestBreakerOpensOnErrorRate(t *testing.T) {
+	useTestBreaker(t)
+
+	for i := 0; i < 5; i++ {
+		RecordSuccess(1, ChannelLevel)
+		RecordFailure(1, ChannelLevel)
+	}
+	assert.False(t, Available(1, ChannelLevel))
+}
+
+func TestBreakerStateIsSharedThroughRedis(t *testing.T) {
+	useTestBreaker(t)
+	previousEnabled, previousClient := common.RedisEnabled, common.RDB
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	require.NoError(t, client.Ping(context.Background()).Err())
+	common.RedisEnabled, common.RDB = true, client
+	t.Cleanup(func() {
+		_ = client.Close()
+		common.RedisEnabled, common.RDB = previousEnabled, previousClient
+	})
+
+	for i := 0; i < 3; i++ {
+		RecordFailure(7, ChannelLevel)
+	}
+	// Forget what this node has seen, as if another node were asking.
+	Reset()
+	assert.False(t, Available(7, ChannelLevel))
+	assert.True(t, server.Exists(redisKeyPrefix+breakerKey(7, ChannelLevel)))
+}
+
+func TestAdmitOnlyTouchesRedisWhenHalfOpen(t *testing.T) {
+	now := useTestBreaker(t)
+	previousEnabled, previousClient := common.RedisEnabled, common.RDB
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	common.RedisEnabled, common.RDB = true, client
+	t.Cleanup(func() {
+		_ = client.Close()
+		common.RedisEnabled, common.RDB = previousEnabled, previousClient
+	})
+
+	assert.True(t, Available(9, ChannelLevel))
+	commands := server.CommandCount()
+	Admit(9, ChannelLevel)
+	assert.Equal(t, commands, server.CommandCount(), "a closed breaker is admitted from the cached state")
+
+	for i := 0; i < 3; i++ {
+		RecordFailure(9, ChannelLevel)
+	}
+	*now = now.Add(31 * time.Second)
+	Admit(9, ChannelLevel)
+	Admit(9, ChannelLevel)
+	Reset()
+	assert.False(t, Available(9, ChannelLevel), "half-open probes are counted in Redis")
+}
@@ -0,0 +1,167 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisKeyPrefix = "new-api:circuit_breaker:v1:"
+	// redisUpdateRetries bounds optimistic transaction retries under contention.
+	redisUpdateRetries = 5
+)
+
+// peekTTL is how long a node reuses a breaker state read from Redis before
+// reading it again; selection checks every candidate so this keeps Redis
+// round trips off the hot path.
+var peekTTL = time.Second
+
+type store interface {
+	load(key string) (entry, error)
+	loadMany(keys []string) ([]entry, error)
+	// update applies fn to the stored entry and persists it when fn reports a
+	// change.
+	update(key string, ttl time.Duration, fn func(e *entry) bool) (entry, error)
+}
+
+type memStore struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+func newMemoryStore() *memStore {
+	return &memStore{entries: make(map[string]entry)}
+}
+
+func (s *memStore) load(key string) (entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *memStore) loadMany(keys []string) ([]entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]entry, len(keys))
+	for i, key := range keys {
+		result[i] = s.entries[key]
+	}
+	return result, nil
+}
+
+func (s *memStore) update(key string, _ time.Duration, fn func(e *entry) bool) (entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[key]
+	if fn(&e) {
+		if e == (entry{State: StateClosed}) {
+			delete(s.entries, key)
+		} else {
+			s.entries[key] = e
+		}
+	}
+	return e, nil
+}
+
+func (s *memStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]entry)
+}
+
+type cachedEntry struct {
+	entry     entry
+	fetchedAt time.Time
+}
+
+var peekCache sync.Map // key -> cachedEntry
+
+type redisStore struct{}
+
+func decodeEntry(raw string) entry {
+	var e entry
+	if raw == "" {
+		return e
+	}
+	if err := common.UnmarshalJsonStr(raw, &e); err != nil {
+		return entry{}
+	}
+	return e
+}
+
+func (redisStore) load(key string) (entry, error) {
+	if cached, ok := peekCache.Load(key); ok {
+		c := cached.(cachedEntry)
+		if time.Since(c.fetchedAt) < peekTTL {
+			return c.entry, nil
+		}
+	}
+	raw, err := common.RDB.Get(context.Background(), redisKeyPrefix+key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return entry{}, err
+	}
+	e := decodeEntry(raw)
+	peekCache.Store(key, cachedEntry{entry: e, fetchedAt: time.Now()})
+	return e, nil
+}
+
+func (redisStore) loadMany(keys []string) ([]entry, error) {
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = redisKeyPrefix + key
+	}
+	values, err := common.RDB.MGet(context.Background(), redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]entry, len(keys))
+	for i, value := range values {
+		if raw, ok := value.(string); ok {
+			result[i] = decodeEntry(raw)
+		}
+	}
+	return result, nil
+}
+
+func (redisStore) update(key string, ttl time.Duration, fn func(e *entry) bool) (entry, error) {
+	ctx := context.Background()
+	redisKey := redisKeyPrefix + key
+	var result entry
+	txf := func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, redisKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		result = decodeEntry(raw)
+		if !fn(&result) {
+			return nil
+		}
+		data, err := common.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, redisKey, string(data), ttl)
+			return nil
+		})
+		return err
+	}
+	var err error
+	for i := 0; i < redisUpdateRetries; i++ {
+		err = common.RDB.Watch(ctx, txf, redisKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return entry{}, err
+	}
+	peekCache.Store(key, cachedEntry{entry: result, fetchedAt: time.Now()})
+	return result, nil
+}
@@ -0,0 +1,296 @@
+package keyusage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisKeyPrefix = "new-api:key_usage:v1:"
+	// redisStatTTL drops the counters of keys that have not been used for a
+	// while, e.g. keys of deleted channels.
+	redisStatTTL = 7 * 24 * time.Hour
+	// redisWindowTTL keeps a minute window a little longer than the minute.
+	redisWindowTTL = 2 * time.Minute
+)
+
+type store interface {
+	recordRequest(key usageKey, now time.Time) error
+	recordTokens(key usageKey, tokens int64, now time.Time) error
+	coolDown(key usageKey, until time.Time) error
+	get(key usageKey, now time.Time) (Usage, error)
+	lastUsed(key usageKey) (time.Time, error)
+	cooldownUntil(key usageKey) (time.Time, error)
+	resetChannel(channelId int) error
+}
+
+type keyStat struct {
+	windowStart   time.Time
+	windowReqs    int64
+	windowTokens  int64
+	totalReqs     int64
+	totalTokens   int64
+	rateLimited   int64
+	lastUsed      time.Time
+	cooldownUntil time.Time
+}
+
+// roll starts a new window when the current one is over.
+func (s *keyStat) roll(now time.Time) {
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now.Truncate(time.Minute)
+		s.windowReqs = 0
+		s.windowTokens = 0
+	}
+}
+
+type memStore struct {
+	mu    sync.Mutex
+	stats map[usageKey]*keyStat
+}
+
+func newMemoryStore() *memStore {
+	return &memStore{stats: make(map[usageKey]*keyStat)}
+}
+
+// stat returns the counters of the key, creating them when create is set.
+// Callers hold s.mu.
+func (s *memStore) stat(key usageKey, create bool) *keyStat {
+	stat, ok := s.stats[key]
+	if !ok && create {
+		stat = &keyStat{}
+		s.stats[key] = stat
+	}
+	return stat
+}
+
+func (s *memStore) recordRequest(key usageKey, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := s.stat(key, true)
+	stat.roll(now)
+	stat.windowReqs++
+	stat.totalReqs++
+	stat.lastUsed = now
+	return nil
+}
+
+func (s *memStore) recordTokens(key usageKey, tokens int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := s.stat(key, true)
+	stat.roll(now)
+	stat.windowTokens += tokens
+	stat.totalTokens += tokens
+	return nil
+}
+
+func (s *memStore) coolDown(key usageKey, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := s.stat(key, true)
+	stat.rateLimited++
+	if until.After(stat.cooldownUntil) {
+		stat.cooldownUntil = until
+	}
+	return nil
+}
+
+func (s *memStore) get(key usageKey, now time.Time) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := s.stat(key, false)
+	if stat == nil {
+		return Usage{}, nil
+	}
+	stat.roll(now)
+	usage := Usage{
+		RequestsThisMinute: stat.windowReqs,
+		TokensThisMinute:   stat.windowTokens,
+		TotalRequests:      stat.totalReqs,
+		TotalTokens:        stat.totalTokens,
+		RateLimited:        stat.rateLimited,
+	}
+	if !stat.lastUsed.IsZero() {
+		usage.LastUsed = stat.lastUsed.Unix()
+	}
+	if now.Before(stat.cooldownUntil) {
+		usage.CooldownUntil = stat.cooldownUntil.Unix()
+	}
+	return usage, nil
+}
+
+func (s *memStore) lastUsed(key usageKey) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stat := s.stat(key, false); stat != nil {
+		return stat.lastUsed, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *memStore) cooldownUntil(key usageKey) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stat := s.stat(key, false); stat != nil {
+		return stat.cooldownUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *memStore) resetChannel(channelId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.stats {
+		if key.channelId == channelId {
+			delete(s.stats, key)
+		}
+	}
+	return nil
+}
+
+func (s *memStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = make(map[usageKey]*keyStat)
+}
+
+// redisStore keeps the lifetime counters, last use and cooldown of a key in
+// one hash and the requests and tokens of each minute in a short lived hash
+// named after the minute, so windows roll over without a read.
+type redisStore struct{}
+
+func redisStatKey(key usageKey) string {
+	return fmt.Sprintf("%s%d:%d", redisKeyPrefix, key.channelId, key.keyIndex)
+}
+
+func redisWindowKey(key usageKey, now time.Time) string {
+	return fmt.Sprintf("%s:w:%d", redisStatKey(key), now.Unix()/60)
+}
+
+// coolDownScript counts the rate limit and only ever extends the cooldown.
+var coolDownScript = redis.NewScript(`
+redis.call('HINCRBY', KEYS[1], 'rate_limited', 1)
+local current = tonumber(redis.call('HGET', KEYS[1], 'cooldown_until') or '0')
+if tonumber(ARGV[1]) > current then
+	redis.call('HSET', KEYS[1], 'cooldown_until', ARGV[1])
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+func (redisStore) recordRequest(key usageKey, now time.Time) error {
+	ctx := context.Background()
+	statKey, windowKey := redisStatKey(key), redisWindowKey(key, now)
+	_, err := common.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, statKey, "total_reqs", 1)
+		pipe.HSet(ctx, statKey, "last_used", now.UnixMilli())
+		pipe.Expire(ctx, statKey, redisStatTTL)
+		pipe.HIncrBy(ctx, windowKey, "reqs", 1)
+		pipe.Expire(ctx, windowKey, redisWindowTTL)
+		return nil
+	})
+	return err
+}
+
+func (redisStore) recordTokens(key usageKey, tokens int64, now time.Time) error {
+	ctx := context.Background()
+	statKey, windowKey := redisStatKey(key), redisWindowKey(key, now)
+	_, err := common.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, statKey, "total_tokens", tokens)
+		pipe.Expire(ctx, statKey, redisStatTTL)
+		pipe.HIncrBy(ctx, windowKey, "tokens", tokens)
+		pipe.Expire(ctx, windowKey, redisWindowTTL)
+		return nil
+	})
+	return err
+}
+
+func (redisStore) coolDown(key usageKey, until time.Time) error {
+	return coolDownScript.Run(context.Background(), common.RDB, []string{redisStatKey(key)},
+		until.UnixMilli(), redisStatTTL.Milliseconds()).Err()
+}
+
+func parseRedisInt(value any) int64 {
+	raw, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(raw, 10, 64)
+	return n
+}
+
+func (redisStore) get(key usageKey, now time.Time) (Usage, error) {
+	ctx := context.Background()
+	var stat, window *redis.SliceCmd
+	_, err := common.RDB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		stat = pipe.HMGet(ctx, redisStatKey(key), "total_reqs", "total_tokens", "rate_limited", "last_used", "cooldown_until")
+		window = pipe.HMGet(ctx, redisWindowKey(key, now), "reqs", "tokens")
+		return nil
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+	values, windowValues := stat.Val(), window.Val()
+	usage := Usage{
+		RequestsThisMinute: parseRedisInt(windowValues[0]),
+		TokensThisMinute:   parseRedisInt(windowValues[1]),
+		TotalRequests:      parseRedisInt(values[0]),
+		TotalTokens:        parseRedisInt(values[1]),
+		RateLimited:        parseRedisInt(values[2]),
+	}
+	if lastUsed := parseRedisInt(values[3]); lastUsed > 0 {
+		usage.LastUsed = time.UnixMilli(lastUsed).Unix()
+	}
+	if cooldownUntil := time.UnixMilli(parseRedisInt(values[4])); now.Before(cooldownUntil) {
+		usage.CooldownUntil = cooldownUntil.Unix()
+	}
+	return usage, nil
+}
+
+func (redisStore) loadTime(key usageKey, field string) (time.Time, error) {
+	raw, err := common.RDB.HGet(context.Background(), redisStatKey(key), field).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, _ := strconv.ParseInt(raw, 10, 64)
+	if ms <= 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (s redisStore) lastUsed(key usageKey) (time.Time, error) {
+	return s.loadTime(key, "last_used")
+}
+
+func (s redisStore) cooldownUntil(key usageKey) (time.Time, error) {
+	return s.loadTime(key, "cooldown_until")
+}
+
+func (redisStore) resetChannel(channelId int) error {
+	ctx := context.Background()
+	iter := common.RDB.Scan(ctx, 0, fmt.Sprintf("%s%d:*", redisKeyPrefix, channelId), 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return common.RDB.Del(ctx, keys...).Err()
+}
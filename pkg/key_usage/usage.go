@@ -0,0 +1,117 @@
+// Package keyusage keeps usage counters for the keys of multi-key channels:
+// requests and tokens in the current minute, lifetime totals, the last time a
+// key was picked and rate limit cooldowns.
+//
+// When Redis is enabled the counters are stored there so every node rotates
+// keys on the same usage and honours the cooldowns other nodes started;
+// otherwise they live in process memory.
+package keyusage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+type usageKey struct {
+	channelId int
+	keyIndex  int
+}
+
+var (
+	memoryStore = newMemoryStore()
+	nowFunc     = time.Now
+)
+
+func getStore() store {
+	if common.RedisEnabled && common.RDB != nil {
+		return redisStore{}
+	}
+	return memoryStore
+}
+
+// Usage is a snapshot of the counters of one key.
+type Usage struct {
+	// RequestsThisMinute and TokensThisMinute count the current fixed
+	// one-minute window.
+	RequestsThisMinute int64 `json:"requests_this_minute"`
+	TokensThisMinute   int64 `json:"tokens_this_minute"`
+	TotalRequests      int64 `json:"total_requests"`
+	TotalTokens        int64 `json:"total_tokens"`
+	RateLimited        int64 `json:"rate_limited"`
+	// LastUsed is a unix timestamp, 0 when the key was never picked.
+	LastUsed int64 `json:"last_used"`
+	// CooldownUntil is a unix timestamp, 0 when the key is not cooling down.
+	CooldownUntil int64 `json:"cooldown_until"`
+}
+
+func logStoreError(action string, channelId, keyIndex int, err error) {
+	common.SysError(fmt.Sprintf("failed to %s usage of channel #%d key #%d: %s", action, channelId, keyIndex, err.Error()))
+}
+
+// RecordRequest counts a request sent with the key.
+func RecordRequest(channelId, keyIndex int) {
+	if err := getStore().recordRequest(usageKey{channelId: channelId, keyIndex: keyIndex}, nowFunc()); err != nil {
+		logStoreError("record", channelId, keyIndex, err)
+	}
+}
+
+// RecordTokens counts the tokens a request sent with the key consumed.
+func RecordTokens(channelId, keyIndex, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	if err := getStore().recordTokens(usageKey{channelId: channelId, keyIndex: keyIndex}, int64(tokens), nowFunc()); err != nil {
+		logStoreError("record", channelId, keyIndex, err)
+	}
+}
+
+// CoolDown keeps the key out of rotation for d after the upstream rate limited
+// it.
+func CoolDown(channelId, keyIndex int, d time.Duration) {
+	if err := getStore().coolDown(usageKey{channelId: channelId, keyIndex: keyIndex}, nowFunc().Add(d)); err != nil {
+		logStoreError("cool down", channelId, keyIndex, err)
+	}
+}
+
+// CoolingDown reports whether the key is still cooling down. A key whose
+// state cannot be read is treated as available.
+func CoolingDown(channelId, keyIndex int) bool {
+	until, err := getStore().cooldownUntil(usageKey{channelId: channelId, keyIndex: keyIndex})
+	if err != nil {
+		return false
+	}
+	return nowFunc().Before(until)
+}
+
+// Get returns the counters of the key.
+func Get(channelId, keyIndex int) Usage {
+	usage, err := getStore().get(usageKey{channelId: channelId, keyIndex: keyIndex}, nowFunc())
+	if err != nil {
+		return Usage{}
+	}
+	return usage
+}
+
+// LastUsed returns when the key was last picked, the zero time if never.
+func LastUsed(channelId, keyIndex int) time.Time {
+	lastUsed, err := getStore().lastUsed(usageKey{channelId: channelId, keyIndex: keyIndex})
+	if err != nil {
+		return time.Time{}
+	}
+	return lastUsed
+}
+
+// ResetChannel drops the counters of every key of the channel, e.g. after its
+// keys were deleted and the remaining ones re-indexed.
+func ResetChannel(channelId int) {
+	if err := getStore().resetChannel(channelId); err != nil {
+		common.SysError(fmt.Sprintf("failed to reset key usage of channel #%d: %s", channelId, err.Error()))
+	}
+}
+
+// Reset clears the in-memory counters, used by tests.
+func Reset() {
+	memoryStore.reset()
+}
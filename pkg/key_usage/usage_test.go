@@ -0,0 +1,87 @@
+package keyusage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useTestClock(t *testing.T) *time.Time {
+	t.Helper()
+	now := time.Unix(1_700_000_040, 0)
+	nowFunc = func() time.Time { return now }
+	Reset()
+	t.Cleanup(func() {
+		nowFunc = time.Now
+		Reset()
+	})
+	return &now
+}
+
+func useTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	previousEnabled, previousClient := common.RedisEnabled, common.RDB
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	require.NoError(t, client.Ping(context.Background()).Err())
+	common.RedisEnabled, common.RDB = true, client
+	t.Cleanup(func() {
+		_ = client.Close()
+		common.RedisEnabled, common.RDB = previousEnabled, previousClient
+	})
+	return server
+}
+
+func TestUsageCountsWindowAndCooldown(t *testing.T) {
+	for _, withRedis := range []bool{false, true} {
+		now := useTestClock(t)
+		if withRedis {
+			useTestRedis(t)
+		}
+
+		RecordRequest(3, 1)
+		RecordRequest(3, 1)
+		RecordTokens(3, 1, 120)
+		CoolDown(3, 1, 30*time.Second)
+		CoolDown(3, 1, 10*time.Second)
+
+		usage := Get(3, 1)
+		assert.Equal(t, int64(2), usage.RequestsThisMinute)
+		assert.Equal(t, int64(120), usage.TokensThisMinute)
+		assert.Equal(t, int64(2), usage.TotalRequests)
+		assert.Equal(t, int64(2), usage.RateLimited)
+		assert.Equal(t, now.Unix(), usage.LastUsed)
+		assert.Equal(t, now.Add(30*time.Second).Unix(), usage.CooldownUntil, "a shorter cooldown does not cut the current one")
+		assert.True(t, CoolingDown(3, 1))
+		assert.False(t, CoolingDown(3, 2))
+
+		*now = now.Add(time.Minute)
+		usage = Get(3, 1)
+		assert.Zero(t, usage.RequestsThisMinute, "the window rolls over every minute")
+		assert.Equal(t, int64(120), usage.TotalTokens)
+		assert.False(t, CoolingDown(3, 1))
+
+		ResetChannel(3)
+		assert.Equal(t, Usage{}, Get(3, 1))
+	}
+}
+
+func TestUsageIsSharedThroughRedis(t *testing.T) {
+	now := useTestClock(t)
+	server := useTestRedis(t)
+
+	RecordRequest(5, 0)
+	CoolDown(5, 0, time.Minute)
+	// Forget what this node has seen, as if another node were asking.
+	Reset()
+	assert.True(t, CoolingDown(5, 0))
+	assert.Equal(t, *now, LastUsed(5, 0))
+	assert.True(t, server.Exists(redisStatKey(usageKey{channelId: 5, keyIndex: 0})))
+}
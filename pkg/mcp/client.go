@@ -0,0 +1,360 @@
+// Package mcp implements the subset of the Model Context Protocol used by the
+// gateway: a client for the streamable HTTP transport (initialize, tools/list,
+// tools/call) and the JSON-RPC message helpers the /mcp proxy needs to inspect
+// and rewrite traffic.
+//
+// Servers may answer a POST either with a single JSON body or with an SSE
+// stream carrying the response; both are handled transparently.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	ProtocolVersion       = "2025-06-18"
+	HeaderSessionId       = "Mcp-Session-Id"
+	HeaderProtocolVersion = "Mcp-Protocol-Version"
+
+	MethodInitialize  = "initialize"
+	MethodInitialized = "notifications/initialized"
+	MethodToolsList   = "tools/list"
+	MethodToolsCall   = "tools/call"
+
+	// ErrorCodeInvalidParams is the JSON-RPC code for rejected parameters.
+	ErrorCodeInvalidParams = -32602
+
+	maxResponseSize = 16 << 20
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type Tool struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Data     string `json:"data,omitempty"`
+}
+
+type CallToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type CallToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// Text flattens the result into the string handed back to the model.
+// Non-text content is summarized by type since models cannot consume it here.
+func (r *CallToolResult) Text() string {
+	if r == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(r.Content))
+	for _, content := range r.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("[%s content omitted]", content.Type))
+	}
+	if len(parts) == 0 && len(r.StructuredContent) > 0 {
+		return string(r.StructuredContent)
+	}
+	return strings.Join(parts, "\n")
+}
+
+type listToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Client talks to one MCP server over streamable HTTP. It is safe for
+// concurrent use once initialized.
+type Client struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+
+	nextId    atomic.Int64
+	mu        sync.Mutex
+	sessionId string
+}
+
+func NewClient(serverURL string, headers map[string]string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{url: serverURL, headers: headers, httpClient: httpClient}
+}
+
+// Initialize performs the protocol handshake and remembers the session id.
+func (c *Client) Initialize(ctx context.Context) error {
+	params := map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "new-api", "version": common.Version},
+	}
+	if err := c.call(ctx, MethodInitialize, params, nil); err != nil {
+		return err
+	}
+	return c.notify(ctx, MethodInitialized)
+}
+
+// ListTools returns every tool the server exposes, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		var params any
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var result listToolsResult
+		if err := c.call(ctx, MethodToolsList, params, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" || result.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	if len(bytes.TrimSpace(arguments)) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	if err := c.call(ctx, MethodToolsCall, CallToolParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close terminates the server-side session, if one was established.
+func (c *Client) Close(ctx context.Context) {
+	c.mu.Lock()
+	sessionId := c.sessionId
+	c.sessionId = ""
+	c.mu.Unlock()
+	if sessionId == "" {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url, nil)
+	if err != nil {
+		return
+	}
+	c.setHeaders(req, sessionId)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	_ = resp.Body.Close()
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	id := c.nextId.Add(1)
+	resp, err := c.post(ctx, map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("mcp %s failed with status %d: %s", method, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if sessionId := resp.Header.Get(HeaderSessionId); sessionId != "" {
+		c.mu.Lock()
+		c.sessionId = sessionId
+		c.mu.Unlock()
+	}
+	message, err := readResponse(resp, strconv.FormatInt(id, 10))
+	if err != nil {
+		return fmt.Errorf("mcp %s: %w", method, err)
+	}
+	if message.Error != nil {
+		return message.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return common.Unmarshal(message.Result, result)
+}
+
+func (c *Client) notify(ctx context.Context, method string) error {
+	resp, err := c.post(ctx, map[string]any{"jsonrpc": "2.0", "method": method})
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("mcp %s failed with status %d", method, resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, payload any) (*http.Response, error) {
+	body, err := common.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	sessionId := c.sessionId
+	c.mu.Unlock()
+	c.setHeaders(req, sessionId)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	return c.httpClient.Do(req)
+}
+
+func (c *Client) setHeaders(req *http.Request, sessionId string) {
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set(HeaderProtocolVersion, ProtocolVersion)
+	if sessionId != "" {
+		req.Header.Set(HeaderSessionId, sessionId)
+	}
+}
+
+// readResponse extracts the response with the given id from a JSON or SSE body.
+func readResponse(resp *http.Response, id string) (*Message, error) {
+	body := io.LimitReader(resp.Body, maxResponseSize)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return findResponse(data, id)
+	}
+	var found *Message
+	err := ReadSSE(body, func(event string, data []byte) bool {
+		if message, err := findResponse(data, id); err == nil {
+			found = message
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.New("stream ended without a response")
+	}
+	return found, nil
+}
+
+func findResponse(data []byte, id string) (*Message, error) {
+	messages, _, err := DecodeMessages(data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		if messages[i].Method == "" && string(messages[i].ID) == id {
+			return &messages[i], nil
+		}
+	}
+	return nil, errors.New("response not found")
+}
+
+// DecodeMessages parses a single JSON-RPC message or a batch.
+func DecodeMessages(data []byte) (messages []Message, batch bool, err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err = common.Unmarshal(data, &messages)
+		return messages, true, err
+	}
+	var message Message
+	if err = common.Unmarshal(data, &message); err != nil {
+		return nil, false, err
+	}
+	return []Message{message}, false, nil
+}
+
+// ReadSSE calls handle for each event in an SSE stream until it returns false
+// or the stream ends. Multi-line data fields are joined with newlines.
+func ReadSSE(r io.Reader, handle func(event string, data []byte) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxResponseSize)
+	var event string
+	var data bytes.Buffer
+	dispatch := func() bool {
+		defer func() {
+			event = ""
+			data.Reset()
+		}()
+		if data.Len() == 0 {
+			return true
+		}
+		return handle(event, bytes.Clone(data.Bytes()))
+	}
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			if !dispatch() {
+				return nil
+			}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	dispatch()
+	return nil
+}
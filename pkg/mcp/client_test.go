@@ -0,0 +1,92 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		if r.Method == http.MethodDelete {
+			assert.Equal(t, "session-1", r.Header.Get(HeaderSessionId))
+			methods = append(methods, "DELETE")
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var message Message
+		require.NoError(t, common.Unmarshal(body, &message))
+		methods = append(methods, message.Method)
+		if message.Method != MethodInitialize {
+			assert.Equal(t, "session-1", r.Header.Get(HeaderSessionId))
+		}
+		switch message.Method {
+		case MethodInitialize:
+			w.Header().Set(HeaderSessionId, "session-1")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(message.ID) + `,"result":{"protocolVersion":"2025-06-18"}}`))
+		case MethodInitialized:
+			w.WriteHeader(http.StatusAccepted)
+		case MethodToolsList:
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n"))
+			_, _ = w.Write([]byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":" + string(message.ID) +
+				",\"result\":{\"tools\":[{\"name\":\"search\",\"inputSchema\":{\"type\":\"object\"}}]}}\n\n"))
+		case MethodToolsCall:
+			var params CallToolParams
+			require.NoError(t, common.Unmarshal(message.Params, &params))
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(message.ID) + `,"result":{"content":[{"type":"text","text":"called ` +
+				params.Name + ` with ` + string(params.Arguments) + `"},{"type":"image","data":"x"}]}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &methods
+}
+
+func TestClientListsAndCallsToolsWithSession(t *testing.T) {
+	server, methods := newTestServer(t)
+	client := NewClient(server.URL, map[string]string{"X-Api-Key": "secret"}, server.Client())
+	ctx := context.Background()
+
+	require.NoError(t, client.Initialize(ctx))
+	tools, err := client.ListTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools, 1)
+	assert.Equal(t, "search", tools[0].Name)
+	assert.JSONEq(t, `{"type":"object"}`, string(tools[0].InputSchema))
+
+	result, err := client.CallTool(ctx, "search", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "called search with {}\n[image content omitted]", result.Text())
+
+	client.Close(ctx)
+	assert.Equal(t, []string{MethodInitialize, MethodInitialized, MethodToolsList, MethodToolsCall, "DELETE"}, *methods)
+}
+
+func TestDecodeMessagesAndReadSSE(t *testing.T) {
+	messages, batch, err := DecodeMessages([]byte(` [{"jsonrpc":"2.0","id":1,"method":"tools/list"},{"jsonrpc":"2.0","method":"ping"}]`))
+	require.NoError(t, err)
+	assert.True(t, batch)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "1", string(messages[0].ID))
+
+	var events []string
+	stream := "event: message\ndata: line1\ndata: line2\n\n: comment\ndata: tail"
+	require.NoError(t, ReadSSE(strings.NewReader(stream), func(event string, data []byte) bool {
+		events = append(events, event+"|"+string(data))
+		return true
+	}))
+	assert.Equal(t, []string{"message|line1\nline2", "|tail"}, events)
+}
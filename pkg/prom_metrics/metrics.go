@@ -0,0 +1,187 @@
+// Package prommetrics exposes relay, billing and channel health metrics in the
+// Prometheus text format. It complements pkg/perf_metrics (bucketed stats kept
+// in DB/Redis for the pricing page) and is fed from the same relay hooks.
+package prommetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "newapi"
+
+var (
+	relayLabels   = []string{"model", "channel_id", "channel_type", "group", "status_class"}
+	channelLabels = []string{"model", "channel_id", "channel_type", "group"}
+
+	registry = prometheus.NewRegistry()
+
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_requests_total",
+		Help:      "Relay requests by final outcome.",
+	}, relayLabels)
+	relayLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_upstream_latency_seconds",
+		Help:      "Time from request start until the upstream response finished.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, relayLabels)
+	relayFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_first_token_latency_seconds",
+		Help:      "Time to the first streamed response chunk.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, channelLabels)
+	relayTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_tokens_total",
+		Help:      "Billed tokens, direction is input or output.",
+	}, append(append([]string{}, channelLabels...), "direction"))
+	quotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "billing_quota_consumed_total",
+		Help:      "Quota charged for successful relay requests.",
+	}, channelLabels)
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_retries_total",
+		Help:      "Retries triggered by a failed attempt, labelled with the failed channel.",
+	}, relayLabels)
+	channelAutoDisabled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "channel_auto_disabled_total",
+		Help:      "Channels (or multi-key channel keys) automatically disabled after errors.",
+	}, []string{"channel_id", "channel_type"})
+	preConsumeRefunds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "billing_pre_consume_refunds_total",
+		Help:      "Pre-consumed quota refunds after failed requests.",
+	}, channelLabels)
+	preConsumeRefundQuota = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "billing_pre_consume_refund_quota_total",
+		Help:      "Pre-consumed quota returned after failed requests.",
+	}, channelLabels)
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayLatency,
+		relayFirstToken,
+		relayTokens,
+		quotaConsumed,
+		relayRetries,
+		channelAutoDisabled,
+		preConsumeRefunds,
+		preConsumeRefundQuota,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// RelayResult is the outcome of one relay request as seen by the billing and
+// error hooks.
+type RelayResult struct {
+	Success      bool
+	StatusCode   int
+	InputTokens  int64
+	OutputTokens int64
+	Quota        int
+}
+
+// StatusClass maps an HTTP status code to 2xx/4xx/5xx; 0 means the request
+// failed before any status was known.
+func StatusClass(success bool, statusCode int) string {
+	if success {
+		return "2xx"
+	}
+	if statusCode >= 100 && statusCode < 600 {
+		return strconv.Itoa(statusCode/100) + "xx"
+	}
+	return "error"
+}
+
+func channelLabelValues(info *relaycommon.RelayInfo) []string {
+	channelId, channelType := "", ""
+	if info.ChannelMeta != nil {
+		channelId = strconv.Itoa(info.ChannelId)
+		channelType = constant.GetChannelTypeName(info.ChannelType)
+	}
+	group := info.UsingGroup
+	if group == "" {
+		group = "default"
+	}
+	return []string{info.OriginModelName, channelId, channelType, group}
+}
+
+func withLabel(values []string, value string) []string {
+	return append(append(make([]string, 0, len(values)+1), values...), value)
+}
+
+// RecordRelay records request count, latency, first-token latency, tokens and
+// quota. It is called from the same places as perfmetrics.RecordRelaySample.
+func RecordRelay(info *relaycommon.RelayInfo, result RelayResult) {
+	if info == nil {
+		return
+	}
+	now := time.Now()
+	labels := channelLabelValues(info)
+	statusLabels := withLabel(labels, StatusClass(result.Success, result.StatusCode))
+
+	relayRequests.WithLabelValues(statusLabels...).Inc()
+	if !info.StartTime.IsZero() {
+		relayLatency.WithLabelValues(statusLabels...).Observe(now.Sub(info.StartTime).Seconds())
+	}
+	if info.IsStream && info.HasSendResponse() && !info.StartTime.IsZero() {
+		relayFirstToken.WithLabelValues(labels...).Observe(info.FirstResponseTime.Sub(info.StartTime).Seconds())
+	}
+	if result.InputTokens > 0 {
+		relayTokens.WithLabelValues(withLabel(labels, "input")...).Add(float64(result.InputTokens))
+	}
+	if result.OutputTokens > 0 {
+		relayTokens.WithLabelValues(withLabel(labels, "output")...).Add(float64(result.OutputTokens))
+	}
+	if result.Quota > 0 {
+		quotaConsumed.WithLabelValues(labels...).Add(float64(result.Quota))
+	}
+}
+
+// RecordRetry counts a retry caused by a failed attempt on the current channel.
+func RecordRetry(info *relaycommon.RelayInfo, statusCode int) {
+	if info == nil {
+		return
+	}
+	relayRetries.WithLabelValues(withLabel(channelLabelValues(info), StatusClass(false, statusCode))...).Inc()
+}
+
+// RecordChannelAutoDisabled counts an automatic channel (or key) disable.
+func RecordChannelAutoDisabled(channelId int, channelType int) {
+	channelAutoDisabled.WithLabelValues(strconv.Itoa(channelId), constant.GetChannelTypeName(channelType)).Inc()
+}
+
+// RecordPreConsumeRefund counts a refund of pre-consumed quota.
+func RecordPreConsumeRefund(info *relaycommon.RelayInfo, quota int) {
+	if info == nil {
+		return
+	}
+	labels := channelLabelValues(info)
+	preConsumeRefunds.WithLabelValues(labels...).Inc()
+	if quota > 0 {
+		preConsumeRefundQuota.WithLabelValues(labels...).Add(float64(quota))
+	}
+}
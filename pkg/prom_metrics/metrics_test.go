@@ -0,0 +1,47 @@
+package prommetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", StatusClass(true, 0))
+	assert.Equal(t, "4xx", StatusClass(false, http.StatusTooManyRequests))
+	assert.Equal(t, "5xx", StatusClass(false, http.StatusBadGateway))
+	assert.Equal(t, "error", StatusClass(false, 0))
+}
+
+func TestRecordRelay(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		OriginModelName: "prom-test-model",
+		StartTime:       time.Now().Add(-time.Second),
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelId:   7,
+			ChannelType: constant.ChannelTypeOpenAI,
+		},
+	}
+	RecordRelay(info, RelayResult{Success: true, StatusCode: http.StatusOK, InputTokens: 10, OutputTokens: 4, Quota: 100})
+	RecordRetry(info, http.StatusBadGateway)
+
+	labels := []string{"prom-test-model", "7", constant.GetChannelTypeName(constant.ChannelTypeOpenAI), "default"}
+	assert.Equal(t, 1.0, testutil.ToFloat64(relayRequests.WithLabelValues(withLabel(labels, "2xx")...)))
+	assert.Equal(t, 10.0, testutil.ToFloat64(relayTokens.WithLabelValues(withLabel(labels, "input")...)))
+	assert.Equal(t, 4.0, testutil.ToFloat64(relayTokens.WithLabelValues(withLabel(labels, "output")...)))
+	assert.Equal(t, 100.0, testutil.ToFloat64(quotaConsumed.WithLabelValues(labels...)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(relayRetries.WithLabelValues(withLabel(labels, "5xx")...)))
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `newapi_relay_requests_total{channel_id="7"`)
+}
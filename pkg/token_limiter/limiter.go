@@ -0,0 +1,244 @@
+// Package tokenlimiter tracks per API token usage for rate limiting: tokens
+// consumed in the current minute and day, and requests in flight.
+//
+// Counters live in Redis when it is enabled so every node enforces the same
+// limits, and in process memory otherwise.
+package tokenlimiter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	redisKeyPrefix = "new-api:token_limit:v1:"
+	// concurrencyTTL expires in-flight counters of a token that stopped
+	// sending requests, so a node that crashed mid-request cannot leak slots
+	// forever.
+	concurrencyTTL = 10 * time.Minute
+)
+
+// acquireScript increments the in-flight counter unless the limit is reached.
+const acquireScript = `
+local count = redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+if count > tonumber(ARGV[1]) then
+  redis.call('DECR', KEYS[1])
+  return {0, count - 1}
+end
+return {1, count}
+`
+
+// releaseScript decrements the in-flight counter without going below zero.
+const releaseScript = `
+local count = redis.call('DECR', KEYS[1])
+if count < 0 then
+  redis.call('SET', KEYS[1], 0, 'KEEPTTL')
+end
+return count
+`
+
+var nowFunc = time.Now
+
+// Usage is the token usage of an API token in the current windows.
+type Usage struct {
+	MinuteTokens int64
+	DayTokens    int64
+	// MinuteReset and DayReset are the times until the windows roll over.
+	MinuteReset time.Duration
+	DayReset    time.Duration
+}
+
+func windows(now time.Time) (minute string, day string, minuteReset, dayReset time.Duration) {
+	now = now.UTC()
+	minuteStart := now.Truncate(time.Minute)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	minute = minuteStart.Format("200601021504")
+	day = dayStart.Format("20060102")
+	return minute, day, minuteStart.Add(time.Minute).Sub(now), dayStart.AddDate(0, 0, 1).Sub(now)
+}
+
+func minuteKey(tokenId int, window string) string {
+	return fmt.Sprintf("tpm:%d:%s", tokenId, window)
+}
+
+func dayKey(tokenId int, window string) string {
+	return fmt.Sprintf("tpd:%d:%s", tokenId, window)
+}
+
+func concurrencyKey(tokenId int) string {
+	return fmt.Sprintf("conc:%d", tokenId)
+}
+
+// GetUsage returns the tokens the API token consumed in the current minute
+// and day.
+func GetUsage(ctx context.Context, tokenId int) (Usage, error) {
+	minute, day, minuteReset, dayReset := windows(nowFunc())
+	usage := Usage{MinuteReset: minuteReset, DayReset: dayReset}
+	keys := []string{minuteKey(tokenId, minute), dayKey(tokenId, day)}
+	if !common.RedisEnabled {
+		usage.MinuteTokens = memory.get(keys[0])
+		usage.DayTokens = memory.get(keys[1])
+		return usage, nil
+	}
+	values, err := common.RDB.MGet(ctx, redisKeyPrefix+keys[0], redisKeyPrefix+keys[1]).Result()
+	if err != nil {
+		return usage, err
+	}
+	counts := make([]int64, len(values))
+	for i, value := range values {
+		if raw, ok := value.(string); ok {
+			counts[i], _ = strconv.ParseInt(raw, 10, 64)
+		}
+	}
+	usage.MinuteTokens, usage.DayTokens = counts[0], counts[1]
+	return usage, nil
+}
+
+// AddTokens adds tokens consumed by a finished request of the API token.
+func AddTokens(ctx context.Context, tokenId int, tokens int) error {
+	if tokens <= 0 {
+		return nil
+	}
+	minute, day, minuteReset, dayReset := windows(nowFunc())
+	if !common.RedisEnabled {
+		memory.add(minuteKey(tokenId, minute), int64(tokens), minuteReset)
+		memory.add(dayKey(tokenId, day), int64(tokens), dayReset)
+		return nil
+	}
+	pipe := common.RDB.TxPipeline()
+	for _, item := range []struct {
+		key string
+		ttl time.Duration
+	}{
+		{minuteKey(tokenId, minute), minuteReset},
+		{dayKey(tokenId, day), dayReset},
+	} {
+		pipe.IncrBy(ctx, redisKeyPrefix+item.key, int64(tokens))
+		pipe.Expire(ctx, redisKeyPrefix+item.key, item.ttl+time.Minute)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Acquire takes one of limit in-flight slots of the API token. When ok is
+// false the limit is reached and inFlight is the number of requests in
+// flight; otherwise release must be called once the request is done.
+func Acquire(ctx context.Context, tokenId int, limit int) (ok bool, inFlight int64, release func(), err error) {
+	key := concurrencyKey(tokenId)
+	if !common.RedisEnabled {
+		ok, inFlight = memory.acquire(key, int64(limit))
+		if !ok {
+			return false, inFlight, nil, nil
+		}
+		var once sync.Once
+		return true, inFlight, func() { once.Do(func() { memory.release(key) }) }, nil
+	}
+	values, err := common.RDB.Eval(ctx, acquireScript, []string{redisKeyPrefix + key}, limit, int64(concurrencyTTL.Seconds())).Slice()
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if len(values) != 2 {
+		return false, 0, nil, fmt.Errorf("unexpected Redis reply length %d", len(values))
+	}
+	allowed, _ := values[0].(int64)
+	inFlight, _ = values[1].(int64)
+	if allowed != 1 {
+		return false, inFlight, nil, nil
+	}
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			// The request context may already be cancelled when the request ends.
+			if err := common.RDB.Eval(context.Background(), releaseScript, []string{redisKeyPrefix + key}).Err(); err != nil {
+				common.SysError(fmt.Sprintf("failed to release token concurrency slot: %v", err))
+			}
+		})
+	}
+	return true, inFlight, release, nil
+}
+
+type memoryCounter struct {
+	value    int64
+	expireAt time.Time
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+	lastGC   time.Time
+}
+
+var memory = &memoryStore{counters: make(map[string]*memoryCounter)}
+
+// gc drops expired counters at most once a minute. Callers hold s.mu.
+func (s *memoryStore) gc(now time.Time) {
+	if now.Sub(s.lastGC) < time.Minute {
+		return
+	}
+	s.lastGC = now
+	for key, counter := range s.counters {
+		if !counter.expireAt.IsZero() && now.After(counter.expireAt) {
+			delete(s.counters, key)
+		}
+	}
+}
+
+func (s *memoryStore) get(key string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter, ok := s.counters[key]
+	if !ok || (!counter.expireAt.IsZero() && nowFunc().After(counter.expireAt)) {
+		return 0
+	}
+	return counter.value
+}
+
+func (s *memoryStore) add(key string, delta int64, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := nowFunc()
+	s.gc(now)
+	counter, ok := s.counters[key]
+	if !ok {
+		counter = &memoryCounter{}
+		s.counters[key] = counter
+	}
+	counter.value += delta
+	counter.expireAt = now.Add(ttl + time.Minute)
+}
+
+func (s *memoryStore) acquire(key string, limit int64) (bool, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter, ok := s.counters[key]
+	if !ok {
+		counter = &memoryCounter{}
+		s.counters[key] = counter
+	}
+	if counter.value >= limit {
+		return false, counter.value
+	}
+	counter.value++
+	return true, counter.value
+}
+
+func (s *memoryStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if counter, ok := s.counters[key]; ok && counter.value > 0 {
+		counter.value--
+	}
+}
+
+// Reset drops all in-memory counters.
+func Reset() {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	memory.counters = make(map[string]*memoryCounter)
+}
@@ -0,0 +1,178 @@
+// Package tracing wires OpenTelemetry tracing for the relay pipeline.
+//
+// Tracing is configured from the standard OTLP environment variables:
+// OTEL_EXPORTER_OTLP_ENDPOINT / OTEL_EXPORTER_OTLP_TRACES_ENDPOINT enable the
+// OTLP/HTTP exporter, OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES describe
+// the resource and OTEL_TRACES_SAMPLER(_ARG) select the sampler. Incoming W3C
+// traceparent headers are always honoured; set OTEL_PROPAGATE_UPSTREAM=true to
+// also inject them into upstream provider requests.
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/QuantumNous/new-api"
+
+var propagateUpstream atomic.Bool
+
+// Enabled reports whether an OTLP exporter endpoint is configured.
+func Enabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Init installs the W3C propagator and, when an exporter endpoint is
+// configured, a batching tracer provider. The returned function flushes and
+// stops the exporter; it is a no-op when tracing is disabled.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	propagateUpstream.Store(common.GetEnvOrDefaultBool("OTEL_PROPAGATE_UPSTREAM", false))
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(
+		resource.NewSchemaless(
+			semconv.ServiceName("new-api"),
+			semconv.ServiceVersion(common.Version),
+		),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Start starts a span as a child of ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, opts...)
+}
+
+// GinContext returns the request context of c, or Background when c has no
+// request (e.g. contexts built by background jobs).
+func GinContext(c *gin.Context) context.Context {
+	if c == nil || c.Request == nil {
+		return context.Background()
+	}
+	return c.Request.Context()
+}
+
+// End records err on span (if any) and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InjectUpstream writes the current trace context into an outgoing upstream
+// request when OTEL_PROPAGATE_UPSTREAM is enabled.
+func InjectUpstream(ctx context.Context, header http.Header) {
+	if !propagateUpstream.Load() {
+		return
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// ExtractRequest returns ctx enriched with the trace context carried by the
+// incoming request headers.
+func ExtractRequest(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// GinSpan is a span whose context is installed on the gin request while it is
+// open, so spans started further down the handler chain become its children.
+type GinSpan struct {
+	trace.Span
+	c      *gin.Context
+	parent context.Context
+	once   sync.Once
+}
+
+// StartGinSpan starts a child span of the gin request context and installs it
+// on c.Request until End is called. c may be nil.
+func StartGinSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) *GinSpan {
+	parent := GinContext(c)
+	ctx, span := Start(parent, name, trace.WithAttributes(attrs...))
+	if c != nil && c.Request != nil {
+		c.Request = c.Request.WithContext(ctx)
+	}
+	return &GinSpan{Span: span, c: c, parent: parent}
+}
+
+// End ends the span once, restoring the parent context on the gin request.
+// When err is nil but the handler chain was aborted, the span is marked as
+// failed with the response status.
+func (s *GinSpan) End(err error) {
+	s.once.Do(func() {
+		if s.c != nil && s.c.Request != nil {
+			s.c.Request = s.c.Request.WithContext(s.parent)
+			if err == nil && s.c.IsAborted() {
+				s.SetStatus(codes.Error, http.StatusText(s.c.Writer.Status()))
+			}
+		}
+		End(s.Span, err)
+	})
+}
+
+type firstByteBody struct {
+	io.ReadCloser
+	ctx   context.Context
+	start time.Time
+	once  sync.Once
+}
+
+func (b *firstByteBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.once.Do(func() {
+			_, span := Start(b.ctx, "upstream.first_byte", trace.WithTimestamp(b.start))
+			span.End()
+		})
+	}
+	return n, err
+}
+
+// TraceFirstByte wraps a streaming upstream body so that an
+// "upstream.first_byte" span covering request start to the first body byte is
+// recorded under ctx. The body is returned unchanged when ctx is not sampled.
+func TraceFirstByte(ctx context.Context, start time.Time, body io.ReadCloser) io.ReadCloser {
+	if body == nil || !trace.SpanFromContext(ctx).IsRecording() {
+		return body
+	}
+	return &firstByteBody{ReadCloser: body, ctx: ctx, start: start}
+}
@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace/noop"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeCollector is an in-process stand-in for an OTLP/HTTP trace collector.
+type fakeCollector struct {
+	mu    sync.Mutex
+	spans map[string]string // span name -> hex trace id
+}
+
+func (f *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				f.spans[span.Name] = hex.EncodeToString(span.TraceId)
+			}
+		}
+	}
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	resp, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	_, _ = w.Write(resp)
+}
+
+func TestTracingExportsSpansAndPropagatesTraceparent(t *testing.T) {
+	collector := &fakeCollector{spans: map[string]string{}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", server.URL+"/v1/traces")
+	t.Setenv("OTEL_PROPAGATE_UPSTREAM", "true")
+	shutdown, err := Init(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+		propagateUpstream.Store(false)
+	})
+
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incoming := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	incoming.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = incoming
+	ctx, root := Start(ExtractRequest(incoming.Context(), incoming.Header), "POST /v1/chat/completions")
+	c.Request = c.Request.WithContext(ctx)
+
+	attempt := StartGinSpan(c, "relay.attempt")
+	upstream := http.Header{}
+	InjectUpstream(GinContext(c), upstream)
+	attempt.End(nil)
+	root.End()
+
+	assert.True(t, strings.HasPrefix(upstream.Get("traceparent"), "00-"+traceId+"-"))
+	assert.Equal(t, ctx, c.Request.Context(), "ending a gin span restores the parent context")
+
+	require.NoError(t, shutdown(context.Background()))
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	assert.Equal(t, traceId, collector.spans["POST /v1/chat/completions"])
+	assert.Equal(t, traceId, collector.spans["relay.attempt"])
+}
+
+func TestInjectUpstreamDisabledByDefault(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	incoming := http.Header{}
+	incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	upstream := http.Header{}
+	InjectUpstream(ExtractRequest(context.Background(), incoming), upstream)
+	assert.Empty(t, upstream.Get("traceparent"))
+}
@@ -82,3 +82,20 @@ type TaskAdaptor interface {
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
+
+// TaskCallbackReceiver is implemented by task adaptors whose upstream can push
+// task status to the gateway. When info.UpstreamCallbackURL is set the adaptor
+// puts it into the upstream request, and ParseTaskCallback maps the pushed body
+// into the shape ParseTaskResult understands.
+type TaskCallbackReceiver interface {
+	ParseTaskCallback(body []byte) (*relaycommon.TaskCallbackData, error)
+}
+
+// TaskCallbackVerifier is implemented by task adaptors whose upstream signs its
+// callbacks. VerifyTaskCallback checks that signature against the channel key
+// on top of the gateway's own URL token. Kling, Vidu, Doubao and Hailuo do not
+// sign their callbacks (Hailuo only sends a one-off challenge to prove the URL
+// is reachable), so they rely on the URL token alone.
+type TaskCallbackVerifier interface {
+	VerifyTaskCallback(header http.Header, body []byte, apiKey string) error
+}
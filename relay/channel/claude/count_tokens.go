@@ -0,0 +1,26 @@
+package claude
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countTokensAdaptor 与 Adaptor 的请求头、代理等处理完全一致，只是请求 /v1/messages/count_tokens
+type countTokensAdaptor struct {
+	Adaptor
+}
+
+func (a *countTokensAdaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	return fmt.Sprintf("%s/v1/messages/count_tokens", info.ChannelBaseUrl), nil
+}
+
+// DoCountTokensRequest 将 count_tokens 请求转发到 Anthropic 渠道
+func DoCountTokensRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoApiRequest(&countTokensAdaptor{}, c, info, requestBody)
+}
@@ -0,0 +1,126 @@
+package claude
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertOpenAIResponsesRequestToClaude(t *testing.T) {
+	info := newClaudeResponsesRelayInfo(false)
+	input, err := common.Marshal([]map[string]any{
+		{"role": "user", "content": "hi"},
+		{"role": "assistant", "content": []map[string]any{{"type": "output_text", "text": "hello"}}},
+		{"role": "user", "content": "how are you"},
+	})
+	require.NoError(t, err)
+	instructions, err := common.Marshal("be brief")
+	require.NoError(t, err)
+
+	got, err := (&Adaptor{}).ConvertOpenAIResponsesRequest(nil, info, dto.OpenAIResponsesRequest{
+		Model:        "claude-test",
+		Instructions: instructions,
+		Input:        input,
+	})
+	require.NoError(t, err)
+	claudeReq, ok := got.(*dto.ClaudeRequest)
+	require.True(t, ok)
+	require.Len(t, claudeReq.Messages, 3)
+	assert.Equal(t, "user", claudeReq.Messages[0].Role)
+	assert.Equal(t, "assistant", claudeReq.Messages[1].Role)
+	assert.Equal(t, "user", claudeReq.Messages[2].Role)
+	assert.NotNil(t, claudeReq.System)
+}
+
+func TestClaudeResponsesHandlerReturnsOpenAIResponsesJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	c.Set(common.RequestIdKey, "claude-responses-test")
+
+	body := `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":2,"output_tokens":3}}`
+	usage, newAPIError := ClaudeResponsesHandler(c, newClaudeResponsesRelayInfo(false), &http.Response{
+		Body: io.NopCloser(bytes.NewReader([]byte(body))),
+	})
+	require.Nil(t, newAPIError)
+	require.NotNil(t, usage)
+	assert.Equal(t, 2, usage.PromptTokens)
+	assert.Equal(t, 3, usage.CompletionTokens)
+
+	got := recorder.Body.String()
+	assert.Contains(t, got, `"object":"response"`)
+	assert.Contains(t, got, `"status":"completed"`)
+	assert.Contains(t, got, `"text":"hello"`)
+	assert.Contains(t, got, `"input_tokens":2`)
+	assert.NotContains(t, got, `"choices"`)
+}
+
+func TestClaudeResponsesStreamHandlerReturnsOpenAIResponsesSSE(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	c.Set(common.RequestIdKey, "claude-responses-stream-test")
+
+	oldStreamingTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 300
+	t.Cleanup(func() { constant.StreamingTimeout = oldStreamingTimeout })
+
+	streamBody := strings.Join([]string{
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-test","usage":{"input_tokens":2,"output_tokens":1}}}`,
+		"",
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		"",
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hello"}}`,
+		"",
+		`data: {"type":"content_block_stop","index":0}`,
+		"",
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}`,
+		"",
+		`data: {"type":"message_stop"}`,
+		"",
+	}, "\n")
+
+	usage, newAPIError := ClaudeResponsesStreamHandler(c, newClaudeResponsesRelayInfo(true), &http.Response{
+		Body: io.NopCloser(strings.NewReader(streamBody)),
+	})
+	require.Nil(t, newAPIError)
+	require.NotNil(t, usage)
+	assert.Equal(t, 2, usage.PromptTokens)
+	assert.Equal(t, 3, usage.CompletionTokens)
+
+	got := recorder.Body.String()
+	assert.Contains(t, got, `event: response.created`)
+	assert.Contains(t, got, `"delta":"hello"`)
+	assert.Contains(t, got, `event: response.completed`)
+	assert.Contains(t, got, `"output_tokens":3`)
+	assert.NotContains(t, got, `"choices"`)
+}
+
+func newClaudeResponsesRelayInfo(isStream bool) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		IsStream:        isStream,
+		RelayMode:       relayconstant.RelayModeResponses,
+		RelayFormat:     types.RelayFormatOpenAIResponses,
+		RequestURLPath:  "/v1/responses",
+		DisablePing:     true,
+		OriginModelName: "claude-test",
+		ChannelMeta: &relaycommon.ChannelMeta{
+			UpstreamModelName: "claude-test",
+		},
+	}
+}
@@ -195,6 +195,9 @@ func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayIn
 	} else {
 		info.UpstreamModelName = body.Model
 	}
+	if info.UpstreamCallbackURL != "" {
+		body.CallbackURL = info.UpstreamCallbackURL
+	}
 	data, err := common.Marshal(body)
 	if err != nil {
 		return nil, err
@@ -345,6 +348,19 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	return &taskResult, nil
 }
 
+// ParseTaskCallback reads the pushed task object, which has the same shape as
+// the query response.
+func (a *TaskAdaptor) ParseTaskCallback(body []byte) (*relaycommon.TaskCallbackData, error) {
+	resTask := responseTask{}
+	if err := common.Unmarshal(body, &resTask); err != nil {
+		return nil, errors.Wrap(err, "unmarshal callback body failed")
+	}
+	if resTask.ID == "" {
+		return nil, fmt.Errorf("callback body missing id")
+	}
+	return &relaycommon.TaskCallbackData{UpstreamTaskID: resTask.ID, ResultBody: body}, nil
+}
+
 func (a *TaskAdaptor) ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error) {
 	var dResp responseTask
 	if err := common.Unmarshal(originTask.Data, &dResp); err != nil {
@@ -163,6 +163,9 @@ func (a *TaskAdaptor) convertToRequestPayload(req *relaycommon.TaskSubmitReq, in
 	if err := req.UnmarshalMetadata(&videoRequest); err != nil {
 		return nil, errors.Wrap(err, "unmarshal metadata to video request failed")
 	}
+	if info.UpstreamCallbackURL != "" {
+		videoRequest.CallbackURL = info.UpstreamCallbackURL
+	}
 
 	return videoRequest, nil
 }
@@ -224,6 +227,38 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	return &taskResult, nil
 }
 
+// ParseTaskCallback answers the challenge handshake and otherwise maps the
+// pushed status, which may be lower-cased, onto the query response.
+func (a *TaskAdaptor) ParseTaskCallback(body []byte) (*relaycommon.TaskCallbackData, error) {
+	callback := CallbackRequest{}
+	if err := common.Unmarshal(body, &callback); err != nil {
+		return nil, errors.Wrap(err, "unmarshal callback body failed")
+	}
+	if callback.Challenge != "" {
+		reply, err := common.Marshal(map[string]string{"challenge": callback.Challenge})
+		if err != nil {
+			return nil, err
+		}
+		return &relaycommon.TaskCallbackData{Reply: reply}, nil
+	}
+	if callback.TaskID == "" {
+		return nil, fmt.Errorf("callback body missing task_id")
+	}
+	for _, status := range []string{TaskStatusPreparing, TaskStatusQueueing, TaskStatusProcessing, TaskStatusSuccess, TaskStatusFailed} {
+		if strings.EqualFold(callback.Status, status) {
+			callback.Status = status
+		}
+	}
+	if strings.EqualFold(callback.Status, "failed") {
+		callback.Status = TaskStatusFailed
+	}
+	resultBody, err := common.Marshal(callback.QueryTaskResponse)
+	if err != nil {
+		return nil, err
+	}
+	return &relaycommon.TaskCallbackData{UpstreamTaskID: callback.TaskID, ResultBody: resultBody}, nil
+}
+
 func (a *TaskAdaptor) ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error) {
 	var hailuoResp QueryTaskResponse
 	if err := common.Unmarshal(originTask.Data, &hailuoResp); err != nil {
@@ -42,6 +42,13 @@ type QueryTaskResponse struct {
 	BaseResp    BaseResp `json:"base_resp"`
 }
 
+// CallbackRequest is what MiniMax posts to callback_url. The first request after
+// a callback URL is used only carries challenge, which must be echoed back.
+type CallbackRequest struct {
+	Challenge string `json:"challenge,omitempty"`
+	QueryTaskResponse
+}
+
 type ErrorInfo struct {
 	StatusCode int    `json:"status_code"`
 	StatusMsg  string `json:"status_msg"`
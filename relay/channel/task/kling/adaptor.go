@@ -287,6 +287,9 @@ func (a *TaskAdaptor) convertToRequestPayload(req *relaycommon.TaskSubmitReq, in
 	if err := taskcommon.UnmarshalMetadata(req.Metadata, &r); err != nil {
 		return nil, errors.Wrap(err, "unmarshal metadata failed")
 	}
+	if info.UpstreamCallbackURL != "" {
+		r.CallbackUrl = info.UpstreamCallbackURL
+	}
 	return &r, nil
 }
 
@@ -374,6 +377,24 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	return taskInfo, nil
 }
 
+// ParseTaskCallback wraps the pushed task object in the query response
+// envelope so ParseTaskResult can read it.
+func (a *TaskAdaptor) ParseTaskCallback(body []byte) (*relaycommon.TaskCallbackData, error) {
+	var data map[string]any
+	if err := common.Unmarshal(body, &data); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal callback body")
+	}
+	taskID, _ := data["task_id"].(string)
+	if taskID == "" {
+		return nil, fmt.Errorf("callback body missing task_id")
+	}
+	resultBody, err := common.Marshal(map[string]any{"code": 0, "data": data})
+	if err != nil {
+		return nil, err
+	}
+	return &relaycommon.TaskCallbackData{UpstreamTaskID: taskID, ResultBody: resultBody}, nil
+}
+
 func isNewAPIRelay(apiKey string) bool {
 	return strings.HasPrefix(apiKey, "sk-")
 }
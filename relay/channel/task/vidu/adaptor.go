@@ -56,6 +56,7 @@ type responsePayload struct {
 }
 
 type taskResultResponse struct {
+	Id        string     `json:"id"`
 	State     string     `json:"state"`
 	ErrCode   string     `json:"err_code"`
 	Credits   int        `json:"credits"`
@@ -238,6 +239,9 @@ func (a *TaskAdaptor) convertToRequestPayload(req *relaycommon.TaskSubmitReq, in
 	if err := taskcommon.UnmarshalMetadata(req.Metadata, &r); err != nil {
 		return nil, errors.Wrap(err, "unmarshal metadata failed")
 	}
+	if info.UpstreamCallbackURL != "" {
+		r.CallbackUrl = info.UpstreamCallbackURL
+	}
 	return &r, nil
 }
 
@@ -273,6 +277,19 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	return taskInfo, nil
 }
 
+// ParseTaskCallback reads the pushed task, which carries the same fields as
+// the query response plus the task id.
+func (a *TaskAdaptor) ParseTaskCallback(body []byte) (*relaycommon.TaskCallbackData, error) {
+	var taskResp taskResultResponse
+	if err := common.Unmarshal(body, &taskResp); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal callback body")
+	}
+	if taskResp.Id == "" {
+		return nil, fmt.Errorf("callback body missing id")
+	}
+	return &relaycommon.TaskCallbackData{UpstreamTaskID: taskResp.Id, ResultBody: body}, nil
+}
+
 func (a *TaskAdaptor) ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error) {
 	var viduResp taskResultResponse
 	if err := common.Unmarshal(originTask.Data, &viduResp); err != nil {
@@ -60,10 +60,29 @@ func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayIn
 	if model_setting.GetGeminiSettings().RemoveFunctionResponseIdEnabled {
 		removeFunctionResponseID(request)
 	}
+	if err := expandCachedContentName(info, request); err != nil {
+		return nil, err
+	}
 	geminiAdaptor := gemini.Adaptor{}
 	return geminiAdaptor.ConvertGeminiRequest(c, info, request)
 }
 
+// expandCachedContentName turns the short cachedContents/{id} name returned by
+// the gateway into the full resource name Vertex expects.
+func expandCachedContentName(info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) error {
+	if request == nil || !strings.HasPrefix(request.CachedContent, "cachedContents/") ||
+		info.ChannelOtherSettings.VertexKeyType == dto.VertexKeyTypeAPIKey {
+		return nil
+	}
+	adc := &Credentials{}
+	if err := common.Unmarshal([]byte(info.ApiKey), adc); err != nil {
+		return fmt.Errorf("failed to decode credentials file: %w", err)
+	}
+	region := GetModelRegion(info.ApiVersion, info.OriginModelName)
+	request.CachedContent = BuildCachedContentName(adc.ProjectID, region, strings.TrimPrefix(request.CachedContent, "cachedContents/"))
+	return nil
+}
+
 func removeFunctionResponseID(request *dto.GeminiChatRequest) {
 	if request == nil {
 		return
@@ -134,6 +134,25 @@ func exchangeJwtForAccessToken(signedJWT string, info *relaycommon.RelayInfo) (s
 	return "", fmt.Errorf("failed to get access token: %v", result)
 }
 
+// GetChannelAccessToken 获取渠道服务账号的 access token，与转发请求共用缓存，供不经过 RelayInfo 的请求（如 cachedContents）使用
+func GetChannelAccessToken(channelId int, isMultiKey bool, keyIndex int, creds Credentials, proxy string) (string, error) {
+	var cacheKey string
+	if isMultiKey {
+		cacheKey = fmt.Sprintf("access-token-%d-%d", channelId, keyIndex)
+	} else {
+		cacheKey = fmt.Sprintf("access-token-%d", channelId)
+	}
+	if val, err := Cache.Get(cacheKey); err == nil {
+		return val.(string), nil
+	}
+	newToken, err := AcquireAccessToken(creds, proxy)
+	if err != nil {
+		return "", err
+	}
+	Cache.SetDefault(cacheKey, newToken)
+	return newToken, nil
+}
+
 func AcquireAccessToken(creds Credentials, proxy string) (string, error) {
 	signedJWT, err := createSignedJWT(creds.ClientEmail, creds.PrivateKey)
 	if err != nil {
@@ -84,3 +84,27 @@ func BuildOpenSourceChatCompletionsURL(baseURL, projectID, region string) string
 		BuildAPIBaseURL(baseURL, OpenSourceAPIVersion, projectID, region),
 	)
 }
+
+// BuildCachedContentName returns the full Vertex resource name of a context cache.
+func BuildCachedContentName(projectID, region, cacheID string) string {
+	return fmt.Sprintf("projects/%s/locations/%s/cachedContents/%s", projectID, normalizeVertexRegion(region), cacheID)
+}
+
+// BuildCachedContentsURL returns the collection URL used to create context caches.
+func BuildCachedContentsURL(baseURL, projectID, region string) string {
+	return BuildAPIBaseURL(baseURL, DefaultAPIVersion, projectID, region) + "/cachedContents"
+}
+
+// BuildResourceURL returns the URL of a full resource name such as
+// projects/{p}/locations/{r}/cachedContents/{id}, on the endpoint of its region.
+func BuildResourceURL(baseURL, resourceName string) string {
+	region := ""
+	parts := strings.Split(resourceName, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "locations" {
+			region = parts[i+1]
+			break
+		}
+	}
+	return BuildAPIBaseURL(baseURL, DefaultAPIVersion, "", region) + "/" + resourceName
+}
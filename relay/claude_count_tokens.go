@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel/claude"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ClaudeCountTokensHelper answers /v1/messages/count_tokens. Anthropic
+// channels are asked for the exact count; every other channel, or an upstream
+// failure, falls back to the local estimate used for pre-consumption.
+func ClaudeCountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (int, *types.NewAPIError) {
+	info.InitChannelMeta(c)
+	if info.ApiType == constant.APITypeAnthropic && model_setting.GetClaudeSettings().CountTokensForwardEnabled {
+		tokens, err := forwardClaudeCountTokens(c, info, request)
+		if err == nil {
+			return tokens, nil
+		}
+		logger.LogWarn(c, fmt.Sprintf("count_tokens on channel #%d failed, estimating locally: %s", info.ChannelId, err.Error()))
+	}
+
+	meta := request.GetTokenCountMeta()
+	if !constant.CountToken {
+		// EstimateRequestToken is a no-op when token counting is disabled, but
+		// this endpoint exists to return a count.
+		return service.CountTextToken(meta.CombineText, request.Model), nil
+	}
+	tokens, err := service.EstimateRequestToken(c, meta, info)
+	if err != nil {
+		return 0, types.NewError(err, types.ErrorCodeCountTokenFailed, types.ErrOptionWithSkipRetry())
+	}
+	return tokens, nil
+}
+
+func forwardClaudeCountTokens(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (int, error) {
+	countRequest, err := common.DeepCopy(request)
+	if err != nil {
+		return 0, err
+	}
+	if err := helper.ModelMappedHelper(c, info, countRequest); err != nil {
+		return 0, err
+	}
+	// Forward the client's body untouched apart from the mapped model, so
+	// fields the gateway does not model (mcp_servers, new betas) still count.
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return 0, err
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	body, err = sjson.SetBytes(body, "model", countRequest.Model)
+	if err != nil {
+		return 0, err
+	}
+	info.UpstreamRequestBodySize = int64(len(body))
+
+	resp, err := claude.DoCountTokensRequest(c, info, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %d: %s", resp.StatusCode, common.LocalLogPreview(string(respBody)))
+	}
+	inputTokens := gjson.GetBytes(respBody, "input_tokens")
+	if !inputTokens.Exists() {
+		return 0, fmt.Errorf("response missing input_tokens: %s", common.LocalLogPreview(string(respBody)))
+	}
+	return int(inputTokens.Int()), nil
+}
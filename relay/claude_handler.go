@@ -132,6 +132,31 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 	}
 
+	// 在响应中还原 PII 占位符，须早于响应缓存的回放和捕获
+	rehydrator := service.StartPIIRehydration(c, info)
+	defer rehydrator.Finish()
+
+	var cacheUsage *dto.Usage
+	cacheKey, served := serveResponseCache(c, info, request)
+	if served {
+		return nil
+	}
+	if cacheKey != "" {
+		capture := service.StartResponseCapture(c)
+		defer func() {
+			capture.Finish(c, cacheKey, info, cacheUsage)
+		}()
+	}
+	// 输出审核包在缓存捕获外层，先于捕获结束；被截断的响应不写入缓存
+	if moderation := service.StartModerationStream(c, info); moderation != nil {
+		defer func() {
+			moderation.Finish()
+			if moderation.Blocked() {
+				cacheKey = ""
+			}
+		}()
+	}
+
 	if !model_setting.GetGlobalSettings().PassThroughRequestEnabled &&
 		!info.ChannelSetting.PassThroughBodyEnabled &&
 		service.ShouldChatCompletionsUseResponsesGlobal(info.ChannelId, info.ChannelType, info.OriginModelName) {
@@ -148,6 +173,7 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		if newApiErr != nil {
 			return newApiErr
 		}
+		cacheUsage = usage
 
 		service.PostTextConsumeQuota(c, info, usage, nil)
 		return nil
@@ -221,7 +247,8 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
 		return newAPIError
 	}
+	cacheUsage = usage.(*dto.Usage)
 
-	service.PostTextConsumeQuota(c, info, usage.(*dto.Usage), nil)
+	service.PostTextConsumeQuota(c, info, cacheUsage, nil)
 	return nil
 }
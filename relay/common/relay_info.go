@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -84,6 +85,7 @@ type RelayInfo struct {
 	TokenId           int
 	TokenKey          string
 	TokenGroup        string
+	OrganizationId    int // 令牌所属组织，非 0 时从组织额度池扣费
 	UserId            int
 	UsingGroup        string // 使用的分组，当auto跨分组重试时，会变动
 	UserGroup         string // 用户所在分组
@@ -124,8 +126,8 @@ type RelayInfo struct {
 	// Billing 是计费会话，封装了预扣费/结算/退款的统一生命周期。
 	// 免费模型时为 nil。
 	Billing BillingSettler
-	// BillingSource indicates whether this request is billed from wallet quota or subscription.
-	// "" or "wallet" => wallet; "subscription" => subscription
+	// BillingSource indicates whether this request is billed from wallet quota, subscription or organization pool.
+	// "" or "wallet" => wallet; "subscription" => subscription; "organization" => organization
 	BillingSource string
 	// SubscriptionId is the user_subscriptions.id used when BillingSource == "subscription"
 	SubscriptionId int
@@ -487,6 +489,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
+		OrganizationId: common.GetContextKeyInt(c, constant.ContextKeyTokenOrganizationId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -676,6 +679,35 @@ func GenRelayInfoAlphaSearch(c *gin.Context, request *dto.AlphaSearchRequest) *R
 	return info
 }
 
+// CloneForHedge returns a copy of info for a hedged attempt that runs
+// concurrently with the original one. Per-attempt conversion and stream state
+// is copied so the attempts never share mutable data; the billing session is
+// shared on purpose, only the winning attempt settles it.
+func (info *RelayInfo) CloneForHedge() *RelayInfo {
+	clone := *info
+	clone.PriceData.ReplaceOtherRatios(info.PriceData.OtherRatios())
+	clone.RequestConversionChain = slices.Clone(info.RequestConversionChain)
+	clone.ParamOverrideAudit = slices.Clone(info.ParamOverrideAudit)
+	clone.StreamStatus = nil
+	clone.LastError = nil
+	if info.ClaudeConvertInfo != nil {
+		claudeInfo := *info.ClaudeConvertInfo
+		clone.ClaudeConvertInfo = &claudeInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		tools := make(map[string]*BuildInToolInfo, len(info.ResponsesUsageInfo.BuiltInTools))
+		for name, tool := range info.ResponsesUsageInfo.BuiltInTools {
+			if tool == nil {
+				continue
+			}
+			toolCopy := *tool
+			tools[name] = &toolCopy
+		}
+		clone.ResponsesUsageInfo = &ResponsesUsageInfo{BuiltInTools: tools}
+	}
+	return &clone
+}
+
 //func (info *RelayInfo) SetPromptTokens(promptTokens int) {
 //	info.promptTokens = promptTokens
 //}
@@ -825,6 +857,9 @@ type TaskRelayInfo struct {
 	// PublicTaskID 是提交时预生成的 task_xxxx 格式公开 ID，
 	// 供 DoResponse 在返回给客户端时使用（避免暴露上游真实 ID）。
 	PublicTaskID string
+	// UpstreamCallbackURL 非空时，支持推送的适配器把它写入上游请求的回调字段，
+	// 上游在任务状态变化时直接回调网关。
+	UpstreamCallbackURL string
 
 	ConsumeQuota bool
 
@@ -928,6 +963,13 @@ type TaskInfo struct {
 	TotalTokens      int    `json:"total_tokens,omitempty"`      // 用于按倍率计费
 }
 
+// TaskCallbackData 适配器从上游推送的回调请求中解析出的内容
+type TaskCallbackData struct {
+	UpstreamTaskID string // 回调对应的上游任务 ID，为空时不校验
+	ResultBody     []byte // 与查询接口返回格式一致，可直接交给 ParseTaskResult
+	Reply          []byte // 非空表示握手请求，原样作为响应体返回给上游，不更新任务
+}
+
 func FailTaskInfo(reason string) *TaskInfo {
 	return &TaskInfo{
 		Status: "FAILURE",
@@ -276,6 +276,7 @@ func isKnownTaskField(field string) bool {
 		"size":            true,
 		"duration":        true,
 		"input_reference": true, // Sora 特有字段
+		"callback_url":    true, // 网关任务回调地址，不透传上游
 	}
 	return knownFields[field]
 }
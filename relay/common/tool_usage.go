@@ -17,6 +17,7 @@ var reservedBillableToolNames = map[string]struct{}{
 	dto.BuildInToolFileSearch:       {},
 	dto.BuildInToolGoogleSearch:     {},
 	dto.BuildInToolImageGeneration:  {},
+	dto.BuildInToolCodeInterpreter:  {},
 }
 
 // CountBillableToolCall is the single entry point for per-call tool billing counts.
@@ -39,6 +40,8 @@ func (info *RelayInfo) CountBillableToolCall(itemType string, functionName strin
 		info.incrementBillableToolCall(resolveWebSearchToolName(info.ResponsesUsageInfo.BuiltInTools))
 	case dto.BuildInCallFileSearchCall:
 		info.incrementBillableToolCall(dto.BuildInToolFileSearch)
+	case dto.BuildInCallCodeInterpreterCall:
+		info.incrementBillableToolCall(dto.BuildInToolCodeInterpreter)
 	case dto.BuildInCallFunctionCall, dto.BuildInCallToolUse:
 		if functionName == "" {
 			return
@@ -46,10 +49,59 @@ func (info *RelayInfo) CountBillableToolCall(itemType string, functionName strin
 		if _, reserved := reservedBillableToolNames[functionName]; reserved {
 			return
 		}
+		// gateway-executed MCP tools are billed when the call succeeds, not when the model requests it
+		if strings.HasPrefix(functionName, "mcp__") {
+			return
+		}
 		if operation_setting.GetToolPriceForModel(functionName, info.OriginModelName) <= 0 {
 			return
 		}
 		info.incrementBillableToolCall(functionName)
+	case dto.BuildInCallMcpCall:
+		if name := resolveMcpToolPriceName(functionName, info.OriginModelName); name != "" {
+			info.incrementBillableToolCall(name)
+		}
+	}
+}
+
+// resolveMcpToolPriceName picks the priced name for an MCP tool call: the
+// per-tool name (mcp__<server>__<tool>) first, then the server-wide name
+// (mcp__<server>). Unpriced calls are not counted.
+func resolveMcpToolPriceName(functionName string, modelName string) string {
+	if functionName == "" {
+		return ""
+	}
+	if operation_setting.GetToolPriceForModel(functionName, modelName) > 0 {
+		return functionName
+	}
+	// server names never contain "__", so the first separator after the prefix ends it
+	if rest, ok := strings.CutPrefix(functionName, "mcp__"); ok {
+		if idx := strings.Index(rest, "__"); idx > 0 {
+			serverName := "mcp__" + rest[:idx]
+			if operation_setting.GetToolPriceForModel(serverName, modelName) > 0 {
+				return serverName
+			}
+		}
+	}
+	return ""
+}
+
+// DeclareBuiltInTool records a built-in tool declared by the request without
+// counting a call, so later web_search_call counts resolve to the declared name.
+func (info *RelayInfo) DeclareBuiltInTool(name string) {
+	if info == nil || name == "" {
+		return
+	}
+	if info.ResponsesUsageInfo == nil {
+		info.ResponsesUsageInfo = &ResponsesUsageInfo{
+			BuiltInTools: make(map[string]*BuildInToolInfo),
+		}
+	}
+	if info.ResponsesUsageInfo.BuiltInTools == nil {
+		info.ResponsesUsageInfo.BuiltInTools = make(map[string]*BuildInToolInfo)
+	}
+	if _, ok := info.ResponsesUsageInfo.BuiltInTools[name]; !ok {
+		info.ResponsesUsageInfo.BuiltInTools[name] = &BuildInToolInfo{ToolName: name}
 	}
 }
 
@@ -66,6 +66,39 @@ func TestCountBillableToolCallFunctionCallSkipsReservedNames(t *testing.T) {
 	}
 }
 
+func TestCountBillableToolCallMcpFallsBackToServerPrice(t *testing.T) {
+	operation_setting.SetToolPriceForTest("mcp__search__fetch", 3.0)
+	operation_setting.SetToolPriceForTest("mcp__search", 1.0)
+	t.Cleanup(func() {
+		operation_setting.DeleteToolPriceForTest("mcp__search__fetch")
+		operation_setting.DeleteToolPriceForTest("mcp__search")
+	})
+
+	info := &RelayInfo{OriginModelName: "gpt-5.1"}
+	// the model requesting the function is not billed; the gateway bills the executed call
+	info.CountBillableToolCall(dto.BuildInCallFunctionCall, "mcp__search__fetch")
+	info.CountBillableToolCall(dto.BuildInCallMcpCall, "mcp__search__fetch")
+	info.CountBillableToolCall(dto.BuildInCallMcpCall, "mcp__search__query__v2")
+	info.CountBillableToolCall(dto.BuildInCallMcpCall, "mcp__search__query__v2")
+	info.CountBillableToolCall(dto.BuildInCallMcpCall, "mcp__docs__read")
+
+	require.Contains(t, info.ResponsesUsageInfo.BuiltInTools, "mcp__search__fetch")
+	assert.Equal(t, 1, info.ResponsesUsageInfo.BuiltInTools["mcp__search__fetch"].CallCount)
+	require.Contains(t, info.ResponsesUsageInfo.BuiltInTools, "mcp__search")
+	assert.Equal(t, 2, info.ResponsesUsageInfo.BuiltInTools["mcp__search"].CallCount)
+	assert.NotContains(t, info.ResponsesUsageInfo.BuiltInTools, "mcp__docs__read")
+	assert.NotContains(t, info.ResponsesUsageInfo.BuiltInTools, "mcp__docs")
+}
+
+func TestCountBillableToolCallCodeInterpreter(t *testing.T) {
+	info := &RelayInfo{OriginModelName: "gpt-5.1"}
+	info.CountBillableToolCall(dto.BuildInCallFunctionCall, dto.BuildInToolCodeInterpreter)
+	info.CountBillableToolCall(dto.BuildInCallCodeInterpreterCall, "")
+
+	require.Contains(t, info.ResponsesUsageInfo.BuiltInTools, dto.BuildInToolCodeInterpreter)
+	assert.Equal(t, 1, info.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolCodeInterpreter].CallCount)
+}
+
 func TestImageGenerationCallCounterCompletedOutputs(t *testing.T) {
 	t.Parallel()
 
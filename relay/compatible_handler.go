@@ -64,6 +64,35 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 
 	info.ShouldIncludeUsage = includeUsage
 
+	// 在响应中还原 PII 占位符，须早于响应缓存的回放和捕获
+	rehydrator := service.StartPIIRehydration(c, info)
+	defer rehydrator.Finish()
+
+	var cacheKey string
+	var cacheUsage *dto.Usage
+	if info.RelayMode == relayconstant.RelayModeChatCompletions {
+		var served bool
+		if cacheKey, served = serveResponseCache(c, info, request); served {
+			return nil
+		}
+		if cacheKey != "" {
+			capture := service.StartResponseCapture(c)
+			defer func() {
+				capture.Finish(c, cacheKey, info, cacheUsage)
+			}()
+		}
+	}
+
+	// 输出审核包在缓存捕获外层，先于捕获结束；被截断的响应不写入缓存
+	if moderation := service.StartModerationStream(c, info); moderation != nil {
+		defer func() {
+			moderation.Finish()
+			if moderation.Blocked() {
+				cacheKey = ""
+			}
+		}()
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
@@ -71,6 +100,24 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	adaptor.Init(info)
 
 	passThroughGlobal := model_setting.GetGlobalSettings().PassThroughRequestEnabled
+	if info.RelayMode == relayconstant.RelayModeChatCompletions &&
+		!passThroughGlobal &&
+		!info.ChannelSetting.PassThroughBodyEnabled {
+		toolset, otherTools, err := service.ResolveChatServerTools(c.Request.Context(), info, request)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		if toolset.Len() > 0 {
+			// 工具调用结果随时间变化，代执行的响应不写入缓存
+			cacheKey = ""
+			usage, newApiErr := chatCompletionsViaServerToolLoop(c, info, adaptor, request, toolset, otherTools)
+			if newApiErr != nil {
+				return newApiErr
+			}
+			service.PostTextConsumeQuota(c, info, usage, nil)
+			return nil
+		}
+	}
 	if info.RelayMode == relayconstant.RelayModeChatCompletions &&
 		!passThroughGlobal &&
 		!info.ChannelSetting.PassThroughBodyEnabled &&
@@ -80,6 +127,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		if newApiErr != nil {
 			return newApiErr
 		}
+		cacheUsage = usage
 
 		var containAudioTokens = usage.CompletionTokenDetails.AudioTokens > 0 || usage.PromptTokensDetails.AudioTokens > 0
 		var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
@@ -210,6 +258,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
 		return newApiErr
 	}
+	cacheUsage = usage.(*dto.Usage)
 
 	var containAudioTokens = usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0
 	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
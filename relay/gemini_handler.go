@@ -174,6 +174,14 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		requestBody = body
 	}
 
+	// 在响应中还原 PII 占位符
+	rehydrator := service.StartPIIRehydration(c, info)
+	defer rehydrator.Finish()
+
+	// 流式输出审核，截断时以对应格式的结束事件收尾
+	moderation := service.StartModerationStream(c, info)
+	defer moderation.Finish()
+
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
 		logger.LogError(c, "Do gemini request failed: "+err.Error())
@@ -0,0 +1,245 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel/vertex"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GeminiResourceTarget is the channel and key a Gemini file or cached content
+// lives on. Upstream resources are scoped to the project behind the key, so
+// every follow-up call must use the same pair.
+type GeminiResourceTarget struct {
+	Channel  *model.Channel
+	KeyIndex int
+	Group    string
+}
+
+// geminiResourceChannelSupported reports whether a channel can host the kind of
+// resource. Vertex has no Files API and its express API keys cannot manage
+// context caches, so only service-account Vertex channels host cachedContents.
+func geminiResourceChannelSupported(channel *model.Channel, kind string) bool {
+	switch channel.Type {
+	case constant.ChannelTypeGemini:
+		return true
+	case constant.ChannelTypeVertexAi:
+		return kind == model.GeminiResourceKindCachedContent &&
+			channel.GetOtherSettings().VertexKeyType != dto.VertexKeyTypeAPIKey
+	}
+	return false
+}
+
+// GetGeminiResourceTarget returns the target of an existing resource.
+func GetGeminiResourceTarget(resource *model.GeminiResource) (*GeminiResourceTarget, error) {
+	channel, err := model.CacheGetChannel(resource.ChannelId)
+	if err != nil {
+		return nil, err
+	}
+	if channel.Status != common.ChannelStatusEnabled {
+		return nil, fmt.Errorf("channel #%d of %s is disabled", channel.Id, resource.Name)
+	}
+	return &GeminiResourceTarget{Channel: channel, KeyIndex: resource.KeyIndex, Group: resource.Group}, nil
+}
+
+// SelectGeminiResourceTarget picks the channel a new resource is created on:
+// the pinned channel of resources the request references, then the token's
+// specific channel, then a random channel serving modelName in the group.
+func SelectGeminiResourceTarget(c *gin.Context, kind string, modelName string, pin *service.GeminiResourcePin) (*GeminiResourceTarget, error) {
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	if pin != nil {
+		channel, err := model.CacheGetChannel(pin.ChannelId)
+		if err != nil {
+			return nil, err
+		}
+		if channel.Status != common.ChannelStatusEnabled || !geminiResourceChannelSupported(channel, kind) {
+			return nil, fmt.Errorf("channel #%d of the referenced resources is not available", channel.Id)
+		}
+		return &GeminiResourceTarget{Channel: channel, KeyIndex: pin.KeyIndex, Group: group}, nil
+	}
+
+	var channel *model.Channel
+	if specificChannelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId); ok {
+		id, err := strconv.Atoi(specificChannelId.(string))
+		if err != nil {
+			return nil, err
+		}
+		channel, err = model.CacheGetChannel(id)
+		if err != nil {
+			return nil, err
+		}
+		if channel.Status != common.ChannelStatusEnabled {
+			return nil, fmt.Errorf("channel #%d is disabled", channel.Id)
+		}
+	} else {
+		var err error
+		var selectGroup string
+		channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+			Ctx:         c,
+			ModelName:   modelName,
+			TokenGroup:  group,
+			RequestPath: c.Request.URL.Path,
+			Retry:       common.GetPointer(0),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, fmt.Errorf("no available channel for model %s under group %s", modelName, group)
+		}
+		group = selectGroup
+	}
+	if !geminiResourceChannelSupported(channel, kind) {
+		return nil, fmt.Errorf("channel #%d does not support Gemini %s", channel.Id, strings.ReplaceAll(kind, "_", " "))
+	}
+	_, keyIndex, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		return nil, apiErr.Err
+	}
+	return &GeminiResourceTarget{Channel: channel, KeyIndex: keyIndex, Group: group}, nil
+}
+
+// MapGeminiResourceModel applies the channel's model mapping to a model name.
+func MapGeminiResourceModel(channel *model.Channel, modelName string) string {
+	mapping := channel.GetModelMapping()
+	if mapping == "" || mapping == "{}" {
+		return modelName
+	}
+	modelMap := make(map[string]string)
+	if err := common.UnmarshalJsonStr(mapping, &modelMap); err != nil {
+		return modelName
+	}
+	if mapped := modelMap[modelName]; mapped != "" {
+		return mapped
+	}
+	return modelName
+}
+
+func (t *GeminiResourceTarget) key() (string, error) {
+	keys := t.Channel.GetKeys()
+	if !t.Channel.ChannelInfo.IsMultiKey {
+		return t.Channel.Key, nil
+	}
+	if t.KeyIndex < 0 || t.KeyIndex >= len(keys) {
+		return "", fmt.Errorf("key #%d of channel #%d no longer exists", t.KeyIndex, t.Channel.Id)
+	}
+	return keys[t.KeyIndex], nil
+}
+
+func (t *GeminiResourceTarget) vertexCredentials() (vertex.Credentials, error) {
+	creds := vertex.Credentials{}
+	key, err := t.key()
+	if err != nil {
+		return creds, err
+	}
+	if err := common.Unmarshal([]byte(key), &creds); err != nil {
+		return creds, fmt.Errorf("failed to decode credentials file: %w", err)
+	}
+	return creds, nil
+}
+
+// VertexCachedContentModel returns the publisher model path and the collection
+// URL used to create a context cache for modelName on a Vertex channel.
+func (t *GeminiResourceTarget) VertexCachedContentModel(originModel string, upstreamModel string) (modelPath string, collectionURL string, err error) {
+	creds, err := t.vertexCredentials()
+	if err != nil {
+		return "", "", err
+	}
+	region := vertex.GetModelRegion(t.Channel.Other, originModel)
+	modelPath = fmt.Sprintf("projects/%s/locations/%s/publishers/%s/models/%s", creds.ProjectID, region, vertex.PublisherGoogle, upstreamModel)
+	return modelPath, vertex.BuildCachedContentsURL(t.Channel.GetBaseURL(), creds.ProjectID, region), nil
+}
+
+// ApiURL returns the upstream URL of a Gemini API path such as
+// upload/v1beta/files or v1beta/cachedContents.
+func (t *GeminiResourceTarget) ApiURL(path string) string {
+	return strings.TrimRight(t.Channel.GetBaseURL(), "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// ResourceURL returns the upstream URL of an existing resource by its upstream
+// name (files/{id}, cachedContents/{id}, or a full Vertex resource name).
+func (t *GeminiResourceTarget) ResourceURL(upstreamName string) string {
+	if t.IsVertex() {
+		return vertex.BuildResourceURL(t.Channel.GetBaseURL(), upstreamName)
+	}
+	return t.ApiURL("v1beta/" + upstreamName)
+}
+
+// IsVertex reports whether the target is a Vertex AI channel.
+func (t *GeminiResourceTarget) IsVertex() bool {
+	return t.Channel.Type == constant.ChannelTypeVertexAi
+}
+
+// Do sends a request to the target channel with its credentials. Query
+// parameters of the client request (other than its gateway key) are kept.
+func (t *GeminiResourceTarget) Do(ctx context.Context, method string, rawURL string, query url.Values, header http.Header, body io.Reader, contentLength int64) (*http.Response, error) {
+	if query != nil {
+		query = cloneGeminiResourceQuery(query)
+		query.Del("key")
+		if encoded := query.Encode(); encoded != "" {
+			if strings.Contains(rawURL, "?") {
+				rawURL += "&" + encoded
+			} else {
+				rawURL += "?" + encoded
+			}
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	if contentLength > 0 {
+		req.ContentLength = contentLength
+	}
+	if t.IsVertex() {
+		creds, err := t.vertexCredentials()
+		if err != nil {
+			return nil, err
+		}
+		accessToken, err := vertex.GetChannelAccessToken(t.Channel.Id, t.Channel.ChannelInfo.IsMultiKey, t.KeyIndex, creds, t.Channel.GetSetting().Proxy)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		if creds.ProjectID != "" {
+			req.Header.Set("x-goog-user-project", creds.ProjectID)
+		}
+	} else {
+		key, err := t.key()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-goog-api-key", key)
+	}
+	setting := t.Channel.GetSetting()
+	client, err := service.GetHttpClientWithProxySettings(setting.Proxy, setting)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+func cloneGeminiResourceQuery(query url.Values) url.Values {
+	cloned := make(url.Values, len(query))
+	for k, v := range query {
+		cloned[k] = append([]string(nil), v...)
+	}
+	return cloned
+}
@@ -2,9 +2,11 @@ package helper
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
@@ -175,6 +177,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		}
 		priceData.QuotaToPreConsume = quota
 	}
+	applyBatchRatio(c, info, &priceData)
 
 	if common.DebugEnabled {
 		logger.LogDebug(c, "model_price_helper result: %s", priceData.ToSetting())
@@ -183,6 +186,23 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	return priceData, nil
 }
 
+// applyBatchRatio 对 /v1/batches 中由网关自行执行的请求应用按模型配置的批处理折扣，
+// 折扣作为 other ratio 参与预扣与结算。批处理标记只能由内部执行器写入上下文，客户端无法伪造。
+func applyBatchRatio(c *gin.Context, info *relaycommon.RelayInfo, priceData *hosttypes.PriceData) {
+	if common.GetContextKeyString(c, constant.ContextKeyBatchId) == "" {
+		return
+	}
+	batchRatio := ratio_setting.GetBatchRatio(info.OriginModelName)
+	if batchRatio == 1 {
+		return
+	}
+	priceData.AddOtherRatio("batch", batchRatio)
+	if !priceData.HasOtherRatio("batch") {
+		return
+	}
+	priceData.QuotaToPreConsume = int(math.Ceil(float64(priceData.QuotaToPreConsume) * batchRatio))
+}
+
 // ModelPriceHelperPerCall 按次/按量计费的 PriceHelper (MJ、Task)
 func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) (hosttypes.PriceData, error) {
 	groupRatioInfo := HandleGroupRatio(c, info)
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relaykit/types"
@@ -272,3 +273,42 @@ func TestModelPriceHelperRequestBillingRatiosOnlyApplyToFixedPrice(t *testing.T)
 	require.Equal(t, common.QuotaClampOverflow, clamp.Kind)
 	require.Nil(t, info.Billing)
 }
+
+func TestModelPriceHelperAppliesBatchRatioOnlyToBatchRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	savedPrice := ratio_setting.ModelPrice2JSONString()
+	savedBatch := ratio_setting.BatchRatio2JSONString()
+	t.Cleanup(func() {
+		require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(savedPrice))
+		require.NoError(t, ratio_setting.UpdateBatchRatioByJSONString(savedBatch))
+	})
+	require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(`{"batch-test-model":0.02}`))
+	require.NoError(t, ratio_setting.UpdateBatchRatioByJSONString(`{"batch-test-model":0.5}`))
+
+	newInfo := func() *relaycommon.RelayInfo {
+		return &relaycommon.RelayInfo{
+			OriginModelName: "batch-test-model",
+			UserGroup:       "default",
+			UsingGroup:      "default",
+		}
+	}
+	newCtx := func() *gin.Context {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		ctx.Set("group", "default")
+		return ctx
+	}
+
+	online, err := ModelPriceHelper(newCtx(), newInfo(), 10, &types.TokenCountMeta{})
+	require.NoError(t, err)
+	require.False(t, online.HasOtherRatio("batch"))
+
+	batchCtx := newCtx()
+	common.SetContextKey(batchCtx, constant.ContextKeyBatchId, "batch_test")
+	batch, err := ModelPriceHelper(batchCtx, newInfo(), 10, &types.TokenCountMeta{})
+	require.NoError(t, err)
+	require.True(t, batch.HasOtherRatio("batch"))
+	require.Equal(t, 0.5, batch.OtherRatioMultiplier())
+	require.Equal(t, online.QuotaToPreConsume/2, batch.QuotaToPreConsume)
+}
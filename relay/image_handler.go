@@ -16,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/relaykit/types"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -111,7 +112,19 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 		}
 	}
 
+	// 开启图片结果持久化时先缓冲转换后的响应，保存图片后再改写 url 写回客户端
+	var assetBuffer *serverToolBufferedWriter
+	if operation_setting.IsImageAssetStoreEnabled() && !info.IsStream {
+		assetBuffer = &serverToolBufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = assetBuffer
+	}
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if assetBuffer != nil {
+		c.Writer = assetBuffer.ResponseWriter
+		if newAPIError == nil {
+			writeImageResponseWithAssets(c, info, assetBuffer)
+		}
+	}
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
@@ -150,3 +163,26 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 	service.PostTextConsumeQuota(c, info, usage.(*dto.Usage), logContent)
 	return nil
 }
+
+// writeImageResponseWithAssets 把缓冲的图片响应中的结果保存到网关存储，改写为签名地址后写回客户端
+func writeImageResponseWithAssets(c *gin.Context, info *relaycommon.RelayInfo, buffer *serverToolBufferedWriter) {
+	body := buffer.body.Bytes()
+	status := buffer.Status()
+	if status == http.StatusOK {
+		owner := service.MediaAssetOwner{
+			UserId:         info.UserId,
+			TokenId:        info.TokenId,
+			Group:          info.UsingGroup,
+			BillingSource:  info.BillingSource,
+			SubscriptionId: info.SubscriptionId,
+			OrganizationId: info.OrganizationId,
+		}
+		body = service.PersistImageResponseAssets(c.Request.Context(), owner, c.GetString(common.RequestIdKey), body)
+	}
+	// 响应体已改写，适配器设置的长度不再准确
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.WriteHeader(status)
+	if _, err := c.Writer.Write(body); err != nil {
+		logger.LogError(c, "failed to write image response: "+err.Error())
+	}
+}
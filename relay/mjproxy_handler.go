@@ -117,6 +117,7 @@ func RelayMidjourneyNotify(c *gin.Context) *dto.MidjourneyResponse {
 			Result:      "",
 		}
 	}
+	prevStatus, prevProgress := midjourneyTask.Status, midjourneyTask.Progress
 	midjourneyTask.Progress = midjRequest.Progress
 	midjourneyTask.PromptEn = midjRequest.PromptEn
 	midjourneyTask.State = midjRequest.State
@@ -136,6 +137,7 @@ func RelayMidjourneyNotify(c *gin.Context) *dto.MidjourneyResponse {
 			Description: "update_midjourney_task_failed",
 		}
 	}
+	service.NotifyMidjourneyTaskChanged(midjourneyTask, prevStatus, prevProgress)
 
 	return nil
 }
@@ -189,12 +191,21 @@ func coverMidjourneyTaskDto(c *gin.Context, originTask *model.Midjourney) (midjo
 	return
 }
 
+// BuildMidjourneyCallbackPayload 按 /mj/task/{id}/fetch 的返回格式生成回调负载
+func BuildMidjourneyCallbackPayload(task *model.Midjourney) ([]byte, error) {
+	return json.Marshal(coverMidjourneyTaskDto(nil, task))
+}
+
 func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyResponse {
 	var swapFaceRequest dto.SwapFaceRequest
 	err := common.UnmarshalBodyReusable(c, &swapFaceRequest)
 	if err != nil {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "bind_request_body_failed")
 	}
+	callbackURL, err := service.ResolveTaskCallbackURL(c)
+	if err != nil {
+		return service.MidjourneyErrorWrapper(constant.MjRequestError, "invalid_callback_url")
+	}
 
 	info.InitChannelMeta(c)
 
@@ -275,6 +286,7 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		FailReason:  "",
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
+		CallbackUrl: callbackURL,
 	}
 	err = midjourneyTask.Insert()
 	if err != nil {
@@ -397,6 +409,10 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 	if err != nil {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "bind_request_body_failed")
 	}
+	callbackURL, err := service.ResolveTaskCallbackURL(c)
+	if err != nil {
+		return service.MidjourneyErrorWrapper(constant.MjRequestError, "invalid_callback_url")
+	}
 
 	relayInfo.InitChannelMeta(c)
 
@@ -588,6 +604,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		FailReason:  "",
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
+		CallbackUrl: callbackURL,
 	}
 	if midjResponse.Code == 3 {
 		//无实例账号自动禁用渠道（No available account instance）
@@ -639,6 +656,8 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			Description: "insert_midjourney_task_failed",
 		}
 	}
+	// UPLOAD 或任务已存在时插入即为终态，同样需要通知
+	service.NotifyMidjourneyTaskChanged(midjourneyTask, "", "")
 
 	if midjResponse.Code == 22 { //22-排队中，说明任务已存在
 		//修改返回值
@@ -210,7 +210,11 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (*TaskSubmitRe
 		}
 	}
 
-	// 8. 构建请求体
+	// 8. 构建请求体；适配器支持上游推送时附带网关回调地址（重试换渠道时按当前渠道重新生成）
+	info.UpstreamCallbackURL = ""
+	if _, ok := adaptor.(channel.TaskCallbackReceiver); ok {
+		info.UpstreamCallbackURL = service.BuildUpstreamTaskCallbackURL(platform, info.ChannelId, info.PublicTaskID)
+	}
 	requestBody, err := adaptor.BuildRequestBody(c, info)
 	if err != nil {
 		return nil, service.TaskErrorWrapper(err, "build_request_failed", http.StatusInternalServerError)
@@ -483,7 +487,10 @@ func tryRealtimeFetch(task *model.Task, isOpenAIVideoAPI bool) []byte {
 	}
 
 	if !snap.Equal(task.Snapshot()) {
-		_, _ = task.UpdateWithStatus(snap.Status)
+		if won, _ := task.UpdateWithStatus(snap.Status); won {
+			service.PersistTaskResultAsset(task)
+			service.NotifyTaskChanged(task, snap.Status, snap.Progress)
+		}
 	}
 
 	// OpenAI Video API 由调用者的 ConvertToOpenAIVideo 分支处理
@@ -499,7 +506,7 @@ func tryRealtimeFetch(task *model.Task, isOpenAIVideoAPI bool) []byte {
 		"metadata": nil,
 		"status":   mapTaskStatusToSimple(task.Status),
 		"task_id":  task.TaskID,
-		"url":      task.GetResultURL(),
+		"url":      taskResultURL(task),
 	}
 	respBody, _ := common.Marshal(dto.TaskResponse[any]{
 		Code: "success",
@@ -547,6 +554,28 @@ func mapTaskStatusToSimple(status model.TaskStatus) string {
 	}
 }
 
+// BuildTaskCallbackPayload 按任务查询接口的返回格式生成回调负载：
+// 通过 /v1/videos 提交的任务与 /v1/videos/{id} 一致，其余与通用 TaskDto 查询结果一致
+func BuildTaskCallbackPayload(task *model.Task) ([]byte, error) {
+	if task.PrivateData.CallbackFormat == service.TaskCallbackFormatOpenAIVideo {
+		if converter, ok := GetTaskAdaptor(task.Platform).(channel.OpenAIVideoConverter); ok {
+			return converter.ConvertToOpenAIVideo(task)
+		}
+	}
+	return common.Marshal(dto.TaskResponse[any]{
+		Code: "success",
+		Data: TaskModel2Dto(task),
+	})
+}
+
+// taskResultURL 结果已保存到网关存储时返回签名地址，否则返回上游结果地址
+func taskResultURL(task *model.Task) string {
+	if task.PrivateData.AssetId != "" {
+		return service.BuildMediaAssetURL(task.PrivateData.AssetId)
+	}
+	return task.GetResultURL()
+}
+
 func TaskModel2Dto(task *model.Task) *dto.TaskDto {
 	return &dto.TaskDto{
 		ID:         task.ID,
@@ -561,7 +590,7 @@ func TaskModel2Dto(task *model.Task) *dto.TaskDto {
 		Action:     task.Action,
 		Status:     string(task.Status),
 		FailReason: task.FailReason,
-		ResultURL:  task.GetResultURL(),
+		ResultURL:  taskResultURL(task),
 		SubmitTime: task.SubmitTime,
 		StartTime:  task.StartTime,
 		FinishTime: task.FinishTime,
@@ -0,0 +1,57 @@
+package relay
+
+import (
+	"bytes"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveResponseCache answers the request from the response cache when caching
+// is enabled for the token or group. It returns the key the upstream response
+// should be stored under on a miss ("" when the request is not cacheable) and
+// whether the request was already served and billed.
+func serveResponseCache(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (string, bool) {
+	key := service.ResponseCacheKey(c, info, request)
+	if key == "" {
+		return "", false
+	}
+	entry, ok := service.GetResponseCache(key)
+	if !ok || entry.Stream != info.IsStream {
+		c.Header(service.ResponseCacheHeader, "miss")
+		return key, false
+	}
+
+	logger.LogInfo(c, "response cache hit")
+	c.Header(service.ResponseCacheHeader, "hit")
+	info.SetFirstResponseTime()
+	if entry.Stream {
+		helper.SetEventStreamHeaders(c)
+		c.Status(entry.StatusCode)
+		for _, event := range bytes.SplitAfter(entry.Body, []byte("\n\n")) {
+			if len(bytes.TrimSpace(event)) == 0 {
+				continue
+			}
+			if _, err := c.Writer.Write(event); err != nil {
+				break
+			}
+			_ = helper.FlushWriter(c)
+		}
+	} else {
+		c.Data(entry.StatusCode, entry.ContentType, entry.Body)
+	}
+
+	common.SetContextKey(c, constant.ContextKeyResponseCacheHit, true)
+	info.PriceData.AddOtherRatio("response_cache", operation_setting.GetResponseCacheSetting().HitPriceRatio)
+	usage := entry.Usage
+	service.PostTextConsumeQuota(c, info, &usage, nil)
+	return key, true
+}
@@ -76,8 +76,47 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
 	}
 	adaptor.Init(info)
+
+	// 在响应中还原 PII 占位符
+	rehydrator := service.StartPIIRehydration(c, info)
+	defer rehydrator.Finish()
+
+	// 流式输出审核，截断时以对应格式的结束事件收尾
+	moderation := service.StartModerationStream(c, info)
+	defer moderation.Finish()
+
+	passThrough := model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled
+
+	// The upstream has no Responses state of its own: expand previous_response_id
+	// from the gateway store and save this turn once it succeeds.
+	if !passThrough && service.ShouldManageResponsesState(info) {
+		stateTurn, stateErr := service.PrepareResponsesState(info, request)
+		if stateErr != nil {
+			return stateErr
+		}
+		stateTurn.StartCapture(c, info)
+		defer func() {
+			stateTurn.Finish(c, info, newAPIError == nil)
+		}()
+	}
+
+	if !passThrough && info.RelayMode == relayconstant.RelayModeResponses {
+		toolset, otherTools, err := service.ResolveResponsesServerTools(c.Request.Context(), info, request)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		if toolset.Len() > 0 {
+			usage, newApiErr := responsesViaServerToolLoop(c, info, adaptor, request, toolset, otherTools)
+			if newApiErr != nil {
+				return newApiErr
+			}
+			service.PostTextConsumeQuota(c, info, usage, nil)
+			return nil
+		}
+	}
+
 	var requestBody io.Reader
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+	if passThrough {
 		storage, err := common.GetBodyStorage(c)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
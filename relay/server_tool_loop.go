@@ -0,0 +1,564 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 网关代执行工具（远程 MCP 工具、模拟的 web_search / code_interpreter）：请求中的这些工具被替换为
+// 同名函数工具，每一轮以非流式请求上游，上游返回的函数调用全部属于代执行工具时由网关执行并把结果
+// 追加到下一轮请求，直到上游给出最终回复或达到轮数上限。多轮用量与工具费用累加后统一结算。
+// 客户端请求流式时，工具执行过程以事件实时推送，最终响应改写为事件流。
+
+// serverToolBufferedWriter 缓冲单轮上游响应，使适配器的响应转换可以原样复用
+type serverToolBufferedWriter struct {
+	gin.ResponseWriter
+	mu     sync.Mutex
+	status int
+	body   bytes.Buffer
+}
+
+func (w *serverToolBufferedWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status = code
+}
+
+func (w *serverToolBufferedWriter) WriteHeaderNow() {}
+
+func (w *serverToolBufferedWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *serverToolBufferedWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status != 0 || w.body.Len() > 0
+}
+
+func (w *serverToolBufferedWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.Len()
+}
+
+func (w *serverToolBufferedWriter) Flush() {}
+
+func (w *serverToolBufferedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.Write(p)
+}
+
+func (w *serverToolBufferedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// doServerToolRound 执行一轮非流式上游请求，返回转换为客户端格式的响应体
+func doServerToolRound(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, convert func() (any, error)) ([]byte, *dto.Usage, *types.NewAPIError) {
+	convertedRequest, err := convert()
+	if err != nil {
+		return nil, nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled)
+	if err != nil {
+		return nil, nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
+		if err != nil {
+			return nil, nil, newAPIErrorFromParamOverride(err)
+		}
+	}
+	logger.LogDebug(c, "server tool round request body: %s", jsonData)
+
+	body, size, closer, err := relaycommon.NewOutboundJSONBody(jsonData)
+	if err != nil {
+		return nil, nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	defer closer.Close()
+	info.UpstreamRequestBodySize = size
+
+	resp, err := adaptor.DoRequest(c, info, body)
+	if err != nil {
+		return nil, nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	if resp == nil {
+		return nil, nil, types.NewOpenAIError(nil, types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	httpResp := resp.(*http.Response)
+	if httpResp.StatusCode != http.StatusOK {
+		newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return nil, nil, newAPIError
+	}
+
+	buffer := &serverToolBufferedWriter{ResponseWriter: c.Writer}
+	c.Writer = buffer
+	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	c.Writer = buffer.ResponseWriter
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return nil, nil, newAPIError
+	}
+	roundUsage, _ := usage.(*dto.Usage)
+	if roundUsage == nil {
+		roundUsage = &dto.Usage{}
+	}
+	return buffer.body.Bytes(), roundUsage, nil
+}
+
+func addServerToolRoundUsage(total *dto.Usage, usage *dto.Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.PromptTokensDetails.CachedTokens += usage.PromptTokensDetails.CachedTokens
+	total.PromptTokensDetails.CachedCreationTokens += usage.PromptTokensDetails.CachedCreationTokens
+	total.CompletionTokenDetails.ReasoningTokens += usage.CompletionTokenDetails.ReasoningTokens
+}
+
+// patchServerToolUsage 将响应体中的 usage 改写为多轮累计用量
+func patchServerToolUsage(body map[string]json.RawMessage, total *dto.Usage, promptKey string, completionKey string) {
+	usage := map[string]any{}
+	if raw, ok := body["usage"]; ok {
+		_ = common.Unmarshal(raw, &usage)
+	}
+	usage[promptKey] = total.PromptTokens
+	usage[completionKey] = total.CompletionTokens
+	usage["total_tokens"] = total.PromptTokens + total.CompletionTokens
+	if data, err := common.Marshal(usage); err == nil {
+		body["usage"] = data
+	}
+}
+
+func writeServerToolFinalJSON(c *gin.Context, body map[string]json.RawMessage) {
+	data, err := common.Marshal(body)
+	if err != nil {
+		common.SysError("failed to marshal server tool loop response: " + err.Error())
+		return
+	}
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = c.Writer.Write(data)
+}
+
+// responsesViaServerToolLoop 以 Responses API 代执行工具
+func responsesViaServerToolLoop(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.OpenAIResponsesRequest, toolset *service.ServerToolset, otherTools []json.RawMessage) (*dto.Usage, *types.NewAPIError) {
+	clientStream := info.IsStream
+	info.IsStream = false
+	defer func() { info.IsStream = clientStream }()
+	request.Stream = common.GetPointer(false)
+
+	tools, err := common.Marshal(append(otherTools, toolset.ResponsesTools()...))
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	request.Tools = tools
+	input, err := responsesInputItems(request.Input)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	total := &dto.Usage{}
+	stream := &responsesToolStream{c: c}
+	var calls []*service.ServerToolCall
+	maxRounds := toolset.MaxRounds()
+	for round := 1; ; round++ {
+		data, usage, newAPIError := doServerToolRound(c, info, adaptor, func() (any, error) {
+			return adaptor.ConvertOpenAIResponsesRequest(c, info, *request)
+		})
+		if newAPIError != nil {
+			// 事件流已开始时无法再返回错误响应，改为推送失败事件并结算已完成的轮次
+			if !stream.started {
+				return nil, newAPIError
+			}
+			logger.LogError(c, fmt.Sprintf("server tool loop failed at round %d: %s", round, newAPIError.Error()))
+			stream.fail(calls, newAPIError)
+			break
+		}
+		addServerToolRoundUsage(total, usage)
+
+		var body map[string]json.RawMessage
+		if err := common.Unmarshal(data, &body); err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		var output []json.RawMessage
+		_ = common.Unmarshal(body["output"], &output)
+
+		pending := pendingResponsesServerToolCalls(output, toolset)
+		if len(pending) == 0 || round >= maxRounds {
+			if len(pending) > 0 {
+				logger.LogWarn(c, fmt.Sprintf("server tool loop stopped after %d rounds", round))
+			}
+			body["output"] = prependServerToolCallItems(output, calls)
+			patchServerToolUsage(body, total, "input_tokens", "output_tokens")
+			if clientStream {
+				stream.finish(body, output)
+			} else {
+				writeServerToolFinalJSON(c, body)
+			}
+			break
+		}
+
+		if clientStream {
+			stream.start(body)
+		}
+		input = append(input, output...)
+		for _, p := range pending {
+			call := p.tool.NewCall(p.CallId, p.ArgumentsString())
+			if clientStream {
+				stream.toolStarted(call)
+			}
+			p.tool.Execute(c.Request.Context(), info, call)
+			if clientStream {
+				stream.toolDone(call)
+			}
+			calls = append(calls, call)
+			item, _ := common.Marshal(map[string]any{
+				"type":    "function_call_output",
+				"call_id": p.CallId,
+				"output":  call.Output,
+			})
+			input = append(input, item)
+		}
+		if request.Input, err = common.Marshal(input); err != nil {
+			return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+		}
+	}
+
+	total.TotalTokens = total.PromptTokens + total.CompletionTokens
+	return total, nil
+}
+
+// responsesInputItems 将 input 统一为条目数组，字符串输入视为一条用户消息
+func responsesInputItems(raw json.RawMessage) ([]json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := common.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{"role": "user", "content": text})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	}
+	var items []json.RawMessage
+	if err := common.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	return items, nil
+}
+
+type pendingServerToolCall struct {
+	dto.ResponsesOutput
+	tool *service.ServerTool
+}
+
+// pendingResponsesServerToolCalls 返回需要代执行的函数调用；若存在客户端自有的函数调用则交还客户端处理
+func pendingResponsesServerToolCalls(output []json.RawMessage, toolset *service.ServerToolset) []pendingServerToolCall {
+	var calls []pendingServerToolCall
+	for _, raw := range output {
+		var item dto.ResponsesOutput
+		if err := common.Unmarshal(raw, &item); err != nil || item.Type != dto.BuildInCallFunctionCall {
+			continue
+		}
+		tool := toolset.Lookup(item.Name)
+		if tool == nil {
+			return nil
+		}
+		calls = append(calls, pendingServerToolCall{ResponsesOutput: item, tool: tool})
+	}
+	return calls
+}
+
+// prependServerToolCallItems 以 mcp_call / web_search_call / code_interpreter_call 条目回显已代执行的工具调用，
+// 与上游原生工具的输出保持一致
+func prependServerToolCallItems(output []json.RawMessage, calls []*service.ServerToolCall) json.RawMessage {
+	items := make([]json.RawMessage, 0, len(calls)+len(output))
+	for _, call := range calls {
+		if data, err := common.Marshal(call.ResponsesItem()); err == nil {
+			items = append(items, data)
+		}
+	}
+	items = append(items, output...)
+	data, _ := common.Marshal(items)
+	return data
+}
+
+// responsesToolStream 向请求流式的客户端推送 Responses 事件。首轮出现代执行的工具调用后才开始推送，
+// 首轮失败仍按普通错误返回，可以重试其他渠道。
+type responsesToolStream struct {
+	c           *gin.Context
+	started     bool
+	sequence    int
+	outputIndex int
+	response    map[string]json.RawMessage
+}
+
+func (s *responsesToolStream) emit(eventType string, payload map[string]any) {
+	payload["type"] = eventType
+	payload["sequence_number"] = s.sequence
+	s.sequence++
+	data, err := common.Marshal(payload)
+	if err != nil {
+		return
+	}
+	_ = helper.ResponseChunkData(s.c, dto.ResponsesStreamResponse{Type: eventType}, string(data))
+}
+
+// start 以首轮响应的元数据推送 response.created / response.in_progress
+func (s *responsesToolStream) start(body map[string]json.RawMessage) {
+	if s.started {
+		return
+	}
+	s.started = true
+	helper.SetEventStreamHeaders(s.c)
+	s.response = make(map[string]json.RawMessage, len(body))
+	for key, value := range body {
+		if key == "usage" {
+			continue
+		}
+		s.response[key] = value
+	}
+	s.response["status"] = json.RawMessage(`"in_progress"`)
+	s.response["output"] = json.RawMessage(`[]`)
+	s.emit("response.created", map[string]any{"response": s.response})
+	s.emit("response.in_progress", map[string]any{"response": s.response})
+}
+
+// toolEventPrefix 返回工具调用事件的前缀，如 response.web_search_call
+func toolEventPrefix(call *service.ServerToolCall) string {
+	return "response." + call.ItemType
+}
+
+func (s *responsesToolStream) toolStarted(call *service.ServerToolCall) {
+	s.emit(dto.ResponsesOutputTypeItemAdded, map[string]any{"output_index": s.outputIndex, "item": call.ResponsesItem()})
+	s.emit(toolEventPrefix(call)+".in_progress", map[string]any{"output_index": s.outputIndex, "item_id": call.ItemId()})
+	switch call.ItemType {
+	case dto.BuildInCallWebSearchCall:
+		s.emit(toolEventPrefix(call)+".searching", map[string]any{"output_index": s.outputIndex, "item_id": call.ItemId()})
+	case dto.BuildInCallCodeInterpreterCall:
+		s.emit(toolEventPrefix(call)+".interpreting", map[string]any{"output_index": s.outputIndex, "item_id": call.ItemId()})
+	}
+}
+
+func (s *responsesToolStream) toolDone(call *service.ServerToolCall) {
+	status := "completed"
+	if call.ItemType == dto.BuildInCallMcpCall && call.Error != "" {
+		status = "failed"
+	}
+	s.emit(toolEventPrefix(call)+"."+status, map[string]any{"output_index": s.outputIndex, "item_id": call.ItemId()})
+	s.emit(dto.ResponsesOutputTypeItemDone, map[string]any{"output_index": s.outputIndex, "item": call.ResponsesItem()})
+	s.outputIndex++
+}
+
+// finish 推送最终轮次的输出条目和 response.completed；已代执行的调用在执行时已推送
+func (s *responsesToolStream) finish(body map[string]json.RawMessage, output []json.RawMessage) {
+	s.start(body)
+	for _, raw := range output {
+		s.emit(dto.ResponsesOutputTypeItemAdded, map[string]any{"output_index": s.outputIndex, "item": raw})
+		var item dto.ResponsesOutput
+		if err := common.Unmarshal(raw, &item); err == nil && item.Type == "message" {
+			for j, content := range item.Content {
+				if content.Type != "output_text" {
+					continue
+				}
+				s.emit("response.output_text.delta", map[string]any{"item_id": item.ID, "output_index": s.outputIndex, "content_index": j, "delta": content.Text})
+				s.emit("response.output_text.done", map[string]any{"item_id": item.ID, "output_index": s.outputIndex, "content_index": j, "text": content.Text})
+			}
+		}
+		s.emit(dto.ResponsesOutputTypeItemDone, map[string]any{"output_index": s.outputIndex, "item": raw})
+		s.outputIndex++
+	}
+	s.emit("response.completed", map[string]any{"response": body})
+}
+
+// fail 推送 response.failed，输出中保留已执行的工具调用
+func (s *responsesToolStream) fail(calls []*service.ServerToolCall, newAPIError *types.NewAPIError) {
+	response := make(map[string]any, len(s.response)+1)
+	for key, value := range s.response {
+		response[key] = value
+	}
+	response["status"] = "failed"
+	response["output"] = prependServerToolCallItems(nil, calls)
+	response["error"] = map[string]any{
+		"code":    newAPIError.GetErrorCode(),
+		"message": newAPIError.MaskSensitiveError(),
+	}
+	s.emit("response.failed", map[string]any{"response": response})
+}
+
+// chatCompletionsViaServerToolLoop 以 Chat Completions 代执行工具
+func chatCompletionsViaServerToolLoop(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.GeneralOpenAIRequest, toolset *service.ServerToolset, otherTools []dto.ToolCallRequest) (*dto.Usage, *types.NewAPIError) {
+	clientStream := info.IsStream
+	info.IsStream = false
+	defer func() { info.IsStream = clientStream }()
+	request.Stream = common.GetPointer(false)
+	request.StreamOptions = nil
+	request.Tools = append(otherTools, toolset.ChatTools()...)
+	applySystemPromptIfNeeded(c, info, request)
+
+	total := &dto.Usage{}
+	streamStarted := false
+	maxRounds := toolset.MaxRounds()
+	for round := 1; ; round++ {
+		data, usage, newAPIError := doServerToolRound(c, info, adaptor, func() (any, error) {
+			return adaptor.ConvertOpenAIRequest(c, info, request)
+		})
+		if newAPIError != nil {
+			if !streamStarted {
+				return nil, newAPIError
+			}
+			logger.LogError(c, fmt.Sprintf("server tool loop failed at round %d: %s", round, newAPIError.Error()))
+			_ = helper.ObjectData(c, gin.H{"error": newAPIError.ToOpenAIError()})
+			helper.Done(c)
+			break
+		}
+		addServerToolRoundUsage(total, usage)
+
+		var response dto.OpenAITextResponse
+		if err := common.Unmarshal(data, &response); err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		var toolCalls []dto.ToolCallRequest
+		if len(response.Choices) > 0 {
+			toolCalls = response.Choices[0].Message.ParseToolCalls()
+		}
+		tools := make([]*service.ServerTool, 0, len(toolCalls))
+		for _, call := range toolCalls {
+			if tool := toolset.Lookup(call.Function.Name); tool != nil {
+				tools = append(tools, tool)
+			}
+		}
+		if len(toolCalls) == 0 || len(tools) != len(toolCalls) || round >= maxRounds {
+			if len(toolCalls) > 0 && len(tools) == len(toolCalls) {
+				logger.LogWarn(c, fmt.Sprintf("server tool loop stopped after %d rounds", round))
+			}
+			if clientStream {
+				writeChatAsStream(c, info, &response, total)
+			} else {
+				var body map[string]json.RawMessage
+				if err := common.Unmarshal(data, &body); err != nil {
+					return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+				}
+				patchServerToolUsage(body, total, "prompt_tokens", "completion_tokens")
+				writeServerToolFinalJSON(c, body)
+			}
+			break
+		}
+
+		if clientStream {
+			helper.SetEventStreamHeaders(c)
+			streamStarted = true
+		}
+		request.Messages = append(request.Messages, response.Choices[0].Message)
+		for i, toolCall := range toolCalls {
+			call := tools[i].NewCall(toolCall.ID, toolCall.Function.Arguments)
+			if clientStream {
+				writeChatToolProgress(c, call)
+			}
+			tools[i].Execute(c.Request.Context(), info, call)
+			if clientStream {
+				writeChatToolProgress(c, call)
+			}
+			request.Messages = append(request.Messages, dto.Message{
+				Role:       "tool",
+				ToolCallId: toolCall.ID,
+				Content:    call.Output,
+			})
+		}
+	}
+	total.TotalTokens = total.PromptTokens + total.CompletionTokens
+	return total, nil
+}
+
+// writeChatToolProgress 以 SSE 注释推送工具执行进度。Chat Completions 没有工具进度事件，
+// 注释行会被标准客户端忽略，同时避免长时间执行工具时连接空闲。
+func writeChatToolProgress(c *gin.Context, call *service.ServerToolCall) {
+	line := fmt.Sprintf(": %s %s %s\n\n", call.ItemType, call.Name, call.Status())
+	if _, err := c.Writer.Write([]byte(line)); err != nil {
+		return
+	}
+	_ = helper.FlushWriter(c)
+}
+
+// writeChatAsStream 将完整的 Chat Completions 响应改写为事件流
+func writeChatAsStream(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse, total *dto.Usage) {
+	helper.SetEventStreamHeaders(c)
+	created := common.GetTimestamp()
+	if value, ok := response.Created.(float64); ok {
+		created = int64(value)
+	}
+	chunk := func(choices []dto.ChatCompletionsStreamResponseChoice) *dto.ChatCompletionsStreamResponse {
+		return &dto.ChatCompletionsStreamResponse{
+			Id:      response.Id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   response.Model,
+			Choices: choices,
+		}
+	}
+	for _, choice := range response.Choices {
+		delta := dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"}
+		if content := choice.Message.StringContent(); content != "" {
+			delta.SetContentString(content)
+		}
+		if reasoning := choice.Message.GetReasoningContent(); reasoning != "" {
+			delta.ReasoningContent = &reasoning
+		}
+		for i, call := range choice.Message.ParseToolCalls() {
+			delta.ToolCalls = append(delta.ToolCalls, dto.ToolCallResponse{
+				Index: common.GetPointer(i),
+				ID:    call.ID,
+				Type:  call.Type,
+				Function: dto.FunctionResponse{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				},
+			})
+		}
+		_ = helper.ObjectData(c, chunk([]dto.ChatCompletionsStreamResponseChoice{{Index: choice.Index, Delta: delta}}))
+		finishReason := choice.FinishReason
+		_ = helper.ObjectData(c, chunk([]dto.ChatCompletionsStreamResponseChoice{{Index: choice.Index, FinishReason: &finishReason}}))
+	}
+	if info.ShouldIncludeUsage {
+		usage := *total
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		final := chunk([]dto.ChatCompletionsStreamResponseChoice{})
+		final.Usage = &usage
+		_ = helper.ObjectData(c, final)
+	}
+	helper.Done(c)
+}
@@ -0,0 +1,201 @@
+package relay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestChatCompletionsViaServerToolLoopExecutesMcpTools(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	savedDB := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = savedDB })
+	require.NoError(t, db.AutoMigrate(&model.McpServer{}))
+	service.InitHttpClient()
+
+	mcpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(string(body), `"initialize"`):
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+		case strings.Contains(string(body), `"tools/list"`):
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":2,"result":{"tools":[{"name":"weather","description":"get weather"}]}}`))
+		case strings.Contains(string(body), `"tools/call"`):
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":2,"result":{"content":[{"type":"text","text":"sunny"}]}}`))
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer mcpServer.Close()
+	require.NoError(t, (&model.McpServer{Name: "wx", ServerUrl: mcpServer.URL}).Insert())
+
+	var upstreamBodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		upstreamBodies = append(upstreamBodies, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		if len(upstreamBodies) == 1 {
+			_, _ = w.Write([]byte(`{"id":"c1","object":"chat.completion","model":"gpt","choices":[{"index":0,"message":{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"mcp__wx__weather","arguments":"{}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"c2","object":"chat.completion","model":"gpt","choices":[{"index":0,"message":{"role":"assistant","content":"It is sunny"},"finish_reason":"stop"}],"usage":{"prompt_tokens":20,"completion_tokens":3,"total_tokens":23}}`))
+	}))
+	defer upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	request := &dto.GeneralOpenAIRequest{
+		Model:    "gpt",
+		Messages: []dto.Message{{Role: "user", Content: "weather?"}},
+		Tools:    []dto.ToolCallRequest{{Type: "mcp", ServerLabel: "wx"}},
+	}
+	specs, rest := service.SplitChatMcpTools(request.Tools)
+	toolset := service.NewServerToolset()
+	require.NoError(t, service.AddMcpTools(c.Request.Context(), toolset, "default", specs))
+
+	info := &relaycommon.RelayInfo{
+		RelayMode:       relayconstant.RelayModeChatCompletions,
+		RelayFormat:     types.RelayFormatOpenAI,
+		OriginModelName: "gpt",
+		RequestURLPath:  "/v1/chat/completions",
+		IsStream:        true,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:       constant.ChannelTypeOpenAI,
+			ChannelBaseUrl:    upstream.URL,
+			ApiKey:            "sk-test",
+			UpstreamModelName: "gpt",
+			ApiType:           constant.APITypeOpenAI,
+		},
+		ShouldIncludeUsage: true,
+	}
+	adaptor := GetAdaptor(constant.APITypeOpenAI)
+	adaptor.Init(info)
+	usage, apiErr := chatCompletionsViaServerToolLoop(c, info, adaptor, request, toolset, rest)
+	require.Nil(t, apiErr)
+	assert.Equal(t, 30, usage.PromptTokens)
+	assert.Equal(t, 8, usage.CompletionTokens)
+	require.Len(t, upstreamBodies, 2)
+	assert.Contains(t, upstreamBodies[0], `"name":"mcp__wx__weather"`)
+	assert.Contains(t, upstreamBodies[1], `"tool_call_id":"call_1"`)
+	assert.Contains(t, upstreamBodies[1], `"content":"sunny"`)
+	assert.Contains(t, recorder.Body.String(), `"content":"It is sunny"`)
+	assert.Contains(t, recorder.Body.String(), "data: [DONE]")
+	assert.True(t, info.IsStream)
+}
+
+func TestResponsesViaServerToolLoopEmulatesWebSearchAsStream(t *testing.T) {
+	service.InitHttpClient()
+	setting := operation_setting.GetBuiltinToolEmulationSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+
+	var queries []string
+	search := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("q"))
+		assert.Equal(t, "json", r.URL.Query().Get("format"))
+		assert.Equal(t, "general", r.URL.Query().Get("categories"))
+		_, _ = w.Write([]byte(`{"results":[{"title":"Go","url":"https://go.dev","content":"The Go language"}]}`))
+	}))
+	defer search.Close()
+	setting.WebSearchEnabled = true
+	setting.SearchURL = search.URL + "/search?categories=general"
+
+	var upstreamBodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		upstreamBodies = append(upstreamBodies, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		if len(upstreamBodies) == 1 {
+			_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","model":"gpt","status":"completed","output":[{"type":"function_call","id":"fc_1","call_id":"call_1","name":"web_search","arguments":"{\"query\":\"golang\"}"}],"usage":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"resp_2","object":"response","model":"gpt","status":"completed","output":[{"type":"message","id":"msg_1","role":"assistant","content":[{"type":"output_text","text":"Go is a language"}]}],"usage":{"input_tokens":20,"output_tokens":4,"total_tokens":24}}`))
+	}))
+	defer upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+
+	request := &dto.OpenAIResponsesRequest{
+		Model:      "gpt",
+		Input:      []byte(`"what is go?"`),
+		Tools:      []byte(`[{"type":"web_search_preview"}]`),
+		ToolChoice: []byte(`{"type":"web_search_preview"}`),
+	}
+	info := &relaycommon.RelayInfo{
+		RelayMode:       relayconstant.RelayModeResponses,
+		RelayFormat:     types.RelayFormatOpenAIResponses,
+		OriginModelName: "gpt",
+		RequestURLPath:  "/v1/responses",
+		IsStream:        true,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:          constant.ChannelTypeOpenAI,
+			ChannelBaseUrl:       upstream.URL,
+			ApiKey:               "sk-test",
+			UpstreamModelName:    "gpt",
+			ApiType:              constant.APITypeOpenAI,
+			ChannelOtherSettings: dto.ChannelOtherSettings{BuiltinToolEmulation: true},
+		},
+		ResponsesUsageInfo: &relaycommon.ResponsesUsageInfo{BuiltInTools: map[string]*relaycommon.BuildInToolInfo{
+			dto.BuildInToolWebSearchPreview: {ToolName: dto.BuildInToolWebSearchPreview},
+		}},
+	}
+	toolset, rest, err := service.ResolveResponsesServerTools(c.Request.Context(), info, request)
+	require.NoError(t, err)
+	require.Equal(t, 1, toolset.Len())
+	assert.Empty(t, rest)
+	assert.JSONEq(t, `"required"`, string(request.ToolChoice))
+
+	adaptor := GetAdaptor(constant.APITypeOpenAI)
+	adaptor.Init(info)
+	usage, apiErr := responsesViaServerToolLoop(c, info, adaptor, request, toolset, rest)
+	require.Nil(t, apiErr)
+	assert.Equal(t, 30, usage.PromptTokens)
+	assert.Equal(t, 9, usage.CompletionTokens)
+	assert.Equal(t, []string{"golang"}, queries)
+	assert.Equal(t, 1, info.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview].CallCount)
+
+	require.Len(t, upstreamBodies, 2)
+	assert.Contains(t, upstreamBodies[0], `"name":"web_search"`)
+	assert.NotContains(t, upstreamBodies[0], `web_search_preview`)
+	assert.Contains(t, upstreamBodies[1], `"type":"function_call_output"`)
+	assert.Contains(t, upstreamBodies[1], `https://go.dev`)
+
+	events := recorder.Body.String()
+	for _, event := range []string{
+		"event: response.created",
+		"event: response.web_search_call.searching",
+		"event: response.web_search_call.completed",
+		"event: response.output_text.delta",
+		"event: response.completed",
+	} {
+		assert.Contains(t, events, event)
+	}
+	assert.Less(t, strings.Index(events, "response.web_search_call.completed"), strings.Index(events, "response.output_text.delta"))
+	assert.Contains(t, events, `"action":{"query":"golang","type":"search"}`)
+}
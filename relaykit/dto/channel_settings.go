@@ -77,6 +77,8 @@ type ChannelOtherSettings struct {
 	DisableStore                          bool                  `json:"disable_store,omitempty"`              // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
 	AllowIncludeObfuscation               bool                  `json:"allow_include_obfuscation,omitempty"`  // 是否允许 stream_options.include_obfuscation 透传（默认过滤以避免关闭流混淆保护）
 	DisableTaskPollingSleep               bool                  `json:"disable_task_polling_sleep,omitempty"` // 是否跳过异步任务轮询间隔
+	McpServerSideExecution                bool                  `json:"mcp_server_side_execution,omitempty"`  // 上游不支持远程 MCP 时由网关执行已登记服务的 MCP 工具调用
+	BuiltinToolEmulation                  bool                  `json:"builtin_tool_emulation,omitempty"`     // 上游不支持内置工具时由网关模拟 web_search / code_interpreter
 	AwsKeyType                            AwsKeyType            `json:"aws_key_type,omitempty"`
 	UpstreamModelUpdateCheckEnabled       bool                  `json:"upstream_model_update_check_enabled,omitempty"`        // 是否检测上游模型更新
 	UpstreamModelUpdateAutoSyncEnabled    bool                  `json:"upstream_model_update_auto_sync_enabled,omitempty"`    // 是否自动同步上游模型更新
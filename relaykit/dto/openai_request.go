@@ -240,6 +240,10 @@ type ToolCallRequest struct {
 	Type     string          `json:"type"`
 	Function FunctionRequest `json:"function,omitempty"`
 	Custom   json.RawMessage `json:"custom,omitempty"`
+	// type 为 mcp 时的远程 MCP 服务参数，与 Responses API 保持一致
+	ServerLabel  string          `json:"server_label,omitempty"`
+	ServerUrl    string          `json:"server_url,omitempty"`
+	AllowedTools json.RawMessage `json:"allowed_tools,omitempty"`
 }
 
 type FunctionRequest struct {
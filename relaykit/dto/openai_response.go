@@ -368,6 +368,7 @@ const (
 	BuildInToolFileSearch       = "file_search"
 	BuildInToolGoogleSearch     = "google_search"
 	BuildInToolImageGeneration  = "image_generation"
+	BuildInToolCodeInterpreter  = "code_interpreter"
 )
 
 const (
@@ -375,6 +376,9 @@ const (
 	BuildInCallFileSearchCall = "file_search_call"
 	BuildInCallFunctionCall   = "function_call"
 	BuildInCallToolUse        = "tool_use"
+	BuildInCallMcpCall        = "mcp_call"
+
+	BuildInCallCodeInterpreterCall = "code_interpreter_call"
 )
 
 const (
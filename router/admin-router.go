@@ -0,0 +1,196 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/service/authz"
+	"github.com/gin-gonic/gin"
+)
+
+// permissionRoute binds a management route to the authz permission it needs.
+// Routes are authenticated per route by PermissionAuth, so users holding a
+// custom role reach them without the admin system role.
+type permissionRoute struct {
+	method     string
+	path       string
+	permission authz.Permission
+	handler    gin.HandlerFunc
+}
+
+func registerPermissionRoutes(group *gin.RouterGroup, routes []permissionRoute) {
+	for _, route := range routes {
+		group.Handle(route.method, route.path,
+			middleware.PermissionAuth(route.permission),
+			route.handler,
+		)
+	}
+}
+
+var userPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.UserRead, handler: controller.GetAllUsers},
+	{method: http.MethodGet, path: "/topup", permission: authz.PaymentRead, handler: controller.GetAllTopUps},
+	{method: http.MethodPost, path: "/topup/complete", permission: authz.PaymentWrite, handler: controller.AdminCompleteTopUp},
+	{method: http.MethodGet, path: "/search", permission: authz.UserRead, handler: controller.SearchUsers},
+	{method: http.MethodGet, path: "/:id/oauth/bindings", permission: authz.UserRead, handler: controller.GetUserOAuthBindingsByAdmin},
+	{method: http.MethodDelete, path: "/:id/oauth/bindings/:provider_id", permission: authz.UserSensitiveWrite, handler: controller.UnbindCustomOAuthByAdmin},
+	{method: http.MethodDelete, path: "/:id/bindings/:binding_type", permission: authz.UserSensitiveWrite, handler: controller.AdminClearUserBinding},
+	{method: http.MethodGet, path: "/:id", permission: authz.UserRead, handler: controller.GetUser},
+	{method: http.MethodPost, path: "/", permission: authz.UserWrite, handler: controller.CreateUser},
+	{method: http.MethodPost, path: "/manage", permission: authz.UserWrite, handler: controller.ManageUser},
+	{method: http.MethodPut, path: "/", permission: authz.UserWrite, handler: controller.UpdateUser},
+	{method: http.MethodDelete, path: "/:id", permission: authz.UserSensitiveWrite, handler: controller.DeleteUser},
+	{method: http.MethodDelete, path: "/:id/reset_passkey", permission: authz.UserSensitiveWrite, handler: controller.AdminResetPasskey},
+	{method: http.MethodGet, path: "/2fa/stats", permission: authz.UserRead, handler: controller.Admin2FAStats},
+	{method: http.MethodDelete, path: "/:id/2fa", permission: authz.UserSensitiveWrite, handler: controller.AdminDisable2FA},
+}
+
+var subscriptionPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/plans", permission: authz.SubscriptionRead, handler: controller.AdminListSubscriptionPlans},
+	{method: http.MethodPost, path: "/plans", permission: authz.SubscriptionWrite, handler: controller.AdminCreateSubscriptionPlan},
+	{method: http.MethodPut, path: "/plans/:id", permission: authz.SubscriptionWrite, handler: controller.AdminUpdateSubscriptionPlan},
+	{method: http.MethodPatch, path: "/plans/:id", permission: authz.SubscriptionWrite, handler: controller.AdminUpdateSubscriptionPlanStatus},
+	{method: http.MethodPost, path: "/bind", permission: authz.SubscriptionWrite, handler: controller.AdminBindSubscription},
+	{method: http.MethodPost, path: "/plans/:id/subscriptions/reset", permission: authz.SubscriptionSensitiveWrite, handler: controller.AdminResetPlanSubscriptions},
+	{method: http.MethodGet, path: "/users/:id/subscriptions", permission: authz.SubscriptionRead, handler: controller.AdminListUserSubscriptions},
+	{method: http.MethodPost, path: "/users/:id/subscriptions", permission: authz.SubscriptionWrite, handler: controller.AdminCreateUserSubscription},
+	{method: http.MethodPost, path: "/users/:id/subscriptions/reset", permission: authz.SubscriptionSensitiveWrite, handler: controller.AdminResetUserSubscriptionsByPlan},
+	{method: http.MethodPost, path: "/user_subscriptions/:id/invalidate", permission: authz.SubscriptionSensitiveWrite, handler: controller.AdminInvalidateUserSubscription},
+	{method: http.MethodDelete, path: "/user_subscriptions/:id", permission: authz.SubscriptionSensitiveWrite, handler: controller.AdminDeleteUserSubscription},
+}
+
+var organizationPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.OrganizationRead, handler: controller.AdminGetAllOrganizations},
+	{method: http.MethodPut, path: "/:id", permission: authz.OrganizationWrite, handler: controller.AdminUpdateOrganization},
+}
+
+var optionPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.OptionRead, handler: controller.GetOptions},
+	{method: http.MethodPut, path: "/", permission: authz.OptionWrite, handler: controller.UpdateOption},
+	{method: http.MethodPost, path: "/payment_compliance", permission: authz.OptionSensitiveWrite, handler: controller.ConfirmPaymentCompliance},
+	{method: http.MethodGet, path: "/channel_affinity_cache", permission: authz.OptionRead, handler: controller.GetChannelAffinityCacheStats},
+	{method: http.MethodDelete, path: "/channel_affinity_cache", permission: authz.OptionWrite, handler: controller.ClearChannelAffinityCache},
+	{method: http.MethodPost, path: "/rest_model_ratio", permission: authz.OptionWrite, handler: controller.ResetModelRatio},
+	{method: http.MethodGet, path: "/waffo-pancake/catalog", permission: authz.OptionSensitiveWrite, handler: controller.ListWaffoPancakeCatalog},
+	{method: http.MethodPost, path: "/waffo-pancake/pair", permission: authz.OptionSensitiveWrite, handler: controller.CreateWaffoPancakePair},
+	{method: http.MethodPost, path: "/waffo-pancake/save", permission: authz.OptionSensitiveWrite, handler: controller.SaveWaffoPancake},
+	{method: http.MethodPost, path: "/waffo-pancake/subscription-product", permission: authz.OptionSensitiveWrite, handler: controller.CreateWaffoPancakeSubscriptionProduct},
+	{method: http.MethodGet, path: "/waffo-pancake/subscription-product-options", permission: authz.OptionSensitiveWrite, handler: controller.ListWaffoPancakeSubscriptionProductOptions},
+}
+
+var customOAuthPermissionRoutes = []permissionRoute{
+	{method: http.MethodPost, path: "/discovery", permission: authz.OptionSensitiveWrite, handler: controller.FetchCustomOAuthDiscovery},
+	{method: http.MethodGet, path: "/", permission: authz.OptionSensitiveWrite, handler: controller.GetCustomOAuthProviders},
+	{method: http.MethodGet, path: "/:id", permission: authz.OptionSensitiveWrite, handler: controller.GetCustomOAuthProvider},
+	{method: http.MethodPost, path: "/", permission: authz.OptionSensitiveWrite, handler: controller.CreateCustomOAuthProvider},
+	{method: http.MethodPut, path: "/:id", permission: authz.OptionSensitiveWrite, handler: controller.UpdateCustomOAuthProvider},
+	{method: http.MethodDelete, path: "/:id", permission: authz.OptionSensitiveWrite, handler: controller.DeleteCustomOAuthProvider},
+}
+
+var mcpServerPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.McpServerRead, handler: controller.GetMcpServers},
+	{method: http.MethodGet, path: "/:id", permission: authz.McpServerRead, handler: controller.GetMcpServer},
+	{method: http.MethodGet, path: "/:id/tools", permission: authz.McpServerRead, handler: controller.GetMcpServerTools},
+	{method: http.MethodPost, path: "/", permission: authz.McpServerWrite, handler: controller.CreateMcpServer},
+	{method: http.MethodPut, path: "/:id", permission: authz.McpServerWrite, handler: controller.UpdateMcpServer},
+	{method: http.MethodDelete, path: "/:id", permission: authz.McpServerWrite, handler: controller.DeleteMcpServer},
+}
+
+var promptTemplatePermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.PromptTemplateRead, handler: controller.AdminGetAllPromptTemplates},
+	{method: http.MethodGet, path: "/:id", permission: authz.PromptTemplateRead, handler: controller.AdminGetPromptTemplate},
+	{method: http.MethodDelete, path: "/:id", permission: authz.PromptTemplateWrite, handler: controller.AdminDeletePromptTemplate},
+}
+
+var performancePermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/stats", permission: authz.SystemRead, handler: controller.GetPerformanceStats},
+	{method: http.MethodDelete, path: "/disk_cache", permission: authz.SystemOperate, handler: controller.ClearDiskCache},
+	{method: http.MethodPost, path: "/reset_stats", permission: authz.SystemOperate, handler: controller.ResetPerformanceStats},
+	{method: http.MethodPost, path: "/gc", permission: authz.SystemOperate, handler: controller.ForceGC},
+	{method: http.MethodGet, path: "/logs", permission: authz.SystemRead, handler: controller.GetLogFiles},
+	{method: http.MethodDelete, path: "/logs", permission: authz.SystemOperate, handler: controller.CleanupLogFiles},
+}
+
+var ratioSyncPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/channels", permission: authz.SystemRead, handler: controller.GetSyncableChannels},
+	{method: http.MethodPost, path: "/fetch", permission: authz.SystemOperate, handler: controller.FetchUpstreamRatios},
+}
+
+var systemTaskPermissionRoutes = []permissionRoute{
+	{method: http.MethodPost, path: "/log-cleanup", permission: authz.SystemOperate, handler: controller.CreateLogCleanupSystemTask},
+	{method: http.MethodPost, path: "/secret-rotation", permission: authz.SystemOperate, handler: controller.CreateSecretRotationSystemTask},
+	{method: http.MethodGet, path: "/list", permission: authz.SystemRead, handler: controller.ListSystemTasks},
+	{method: http.MethodGet, path: "/current", permission: authz.SystemRead, handler: controller.GetCurrentSystemTask},
+	{method: http.MethodGet, path: "/:task_id", permission: authz.SystemRead, handler: controller.GetSystemTask},
+}
+
+var systemInfoPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/instances", permission: authz.SystemRead, handler: controller.ListSystemInstances},
+	{method: http.MethodDelete, path: "/stale-instances", permission: authz.SystemOperate, handler: controller.DeleteStaleSystemInstances},
+	{method: http.MethodDelete, path: "/instances/:node_name", permission: authz.SystemOperate, handler: controller.DeleteStaleSystemInstance},
+}
+
+var redemptionPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.RedemptionRead, handler: controller.GetAllRedemptions},
+	{method: http.MethodGet, path: "/search", permission: authz.RedemptionRead, handler: controller.SearchRedemptions},
+	{method: http.MethodGet, path: "/:id", permission: authz.RedemptionRead, handler: controller.GetRedemption},
+	{method: http.MethodPost, path: "/", permission: authz.RedemptionWrite, handler: controller.AddRedemption},
+	{method: http.MethodPut, path: "/", permission: authz.RedemptionWrite, handler: controller.UpdateRedemption},
+	{method: http.MethodDelete, path: "/invalid", permission: authz.RedemptionSensitiveWrite, handler: controller.DeleteInvalidRedemption},
+	{method: http.MethodDelete, path: "/:id", permission: authz.RedemptionSensitiveWrite, handler: controller.DeleteRedemption},
+}
+
+var groupPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.ModelRead, handler: controller.GetGroups},
+}
+
+var prefillGroupPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.ModelRead, handler: controller.GetPrefillGroups},
+	{method: http.MethodPost, path: "/", permission: authz.ModelWrite, handler: controller.CreatePrefillGroup},
+	{method: http.MethodPut, path: "/", permission: authz.ModelWrite, handler: controller.UpdatePrefillGroup},
+	{method: http.MethodDelete, path: "/:id", permission: authz.ModelWrite, handler: controller.DeletePrefillGroup},
+}
+
+var vendorPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.ModelRead, handler: controller.GetAllVendors},
+	{method: http.MethodGet, path: "/search", permission: authz.ModelRead, handler: controller.SearchVendors},
+	{method: http.MethodGet, path: "/:id", permission: authz.ModelRead, handler: controller.GetVendorMeta},
+	{method: http.MethodPost, path: "/", permission: authz.ModelWrite, handler: controller.CreateVendorMeta},
+	{method: http.MethodPut, path: "/", permission: authz.ModelWrite, handler: controller.UpdateVendorMeta},
+	{method: http.MethodDelete, path: "/:id", permission: authz.ModelWrite, handler: controller.DeleteVendorMeta},
+}
+
+var modelPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/sync_upstream/preview", permission: authz.ModelRead, handler: controller.SyncUpstreamPreview},
+	{method: http.MethodPost, path: "/sync_upstream", permission: authz.ModelWrite, handler: controller.SyncUpstreamModels},
+	{method: http.MethodGet, path: "/missing", permission: authz.ModelRead, handler: controller.GetMissingModels},
+	{method: http.MethodGet, path: "/", permission: authz.ModelRead, handler: controller.GetAllModelsMeta},
+	{method: http.MethodGet, path: "/search", permission: authz.ModelRead, handler: controller.SearchModelsMeta},
+	{method: http.MethodGet, path: "/:id", permission: authz.ModelRead, handler: controller.GetModelMeta},
+	{method: http.MethodPost, path: "/", permission: authz.ModelWrite, handler: controller.CreateModelMeta},
+	{method: http.MethodPut, path: "/", permission: authz.ModelWrite, handler: controller.UpdateModelMeta},
+	{method: http.MethodDelete, path: "/:id", permission: authz.ModelWrite, handler: controller.DeleteModelMeta},
+}
+
+var deploymentPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/settings", permission: authz.DeploymentRead, handler: controller.GetModelDeploymentSettings},
+	{method: http.MethodPost, path: "/settings/test-connection", permission: authz.DeploymentSensitiveWrite, handler: controller.TestIoNetConnection},
+	{method: http.MethodGet, path: "/", permission: authz.DeploymentRead, handler: controller.GetAllDeployments},
+	{method: http.MethodGet, path: "/search", permission: authz.DeploymentRead, handler: controller.SearchDeployments},
+	{method: http.MethodPost, path: "/test-connection", permission: authz.DeploymentSensitiveWrite, handler: controller.TestIoNetConnection},
+	{method: http.MethodGet, path: "/hardware-types", permission: authz.DeploymentRead, handler: controller.GetHardwareTypes},
+	{method: http.MethodGet, path: "/locations", permission: authz.DeploymentRead, handler: controller.GetLocations},
+	{method: http.MethodGet, path: "/available-replicas", permission: authz.DeploymentRead, handler: controller.GetAvailableReplicas},
+	{method: http.MethodPost, path: "/price-estimation", permission: authz.DeploymentRead, handler: controller.GetPriceEstimation},
+	{method: http.MethodGet, path: "/check-name", permission: authz.DeploymentRead, handler: controller.CheckClusterNameAvailability},
+	{method: http.MethodPost, path: "/", permission: authz.DeploymentWrite, handler: controller.CreateDeployment},
+	{method: http.MethodGet, path: "/:id", permission: authz.DeploymentRead, handler: controller.GetDeployment},
+	{method: http.MethodGet, path: "/:id/logs", permission: authz.DeploymentRead, handler: controller.GetDeploymentLogs},
+	{method: http.MethodGet, path: "/:id/containers", permission: authz.DeploymentRead, handler: controller.ListDeploymentContainers},
+	{method: http.MethodGet, path: "/:id/containers/:container_id", permission: authz.DeploymentRead, handler: controller.GetContainerDetails},
+	{method: http.MethodPut, path: "/:id", permission: authz.DeploymentWrite, handler: controller.UpdateDeployment},
+	{method: http.MethodPut, path: "/:id/name", permission: authz.DeploymentWrite, handler: controller.UpdateDeploymentName},
+	{method: http.MethodPost, path: "/:id/extend", permission: authz.DeploymentWrite, handler: controller.ExtendDeployment},
+	{method: http.MethodDelete, path: "/:id", permission: authz.DeploymentSensitiveWrite, handler: controller.DeleteDeployment},
+}
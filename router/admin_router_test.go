@@ -0,0 +1,43 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/service/authz"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportRoutesUseFineGrainedPermissions(t *testing.T) {
+	assertRoutePermission(t, userPermissionRoutes, http.MethodGet, "/:id", authz.UserRead, controller.GetUser)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodDelete, "/:id", authz.UserSensitiveWrite, controller.DeleteUser)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodGet, "/topup", authz.PaymentRead, controller.GetAllTopUps)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodPost, "/topup/complete", authz.PaymentWrite, controller.AdminCompleteTopUp)
+	assertRoutePermission(t, redemptionPermissionRoutes, http.MethodDelete, "/:id", authz.RedemptionSensitiveWrite, controller.DeleteRedemption)
+	assertRoutePermission(t, optionPermissionRoutes, http.MethodPut, "/", authz.OptionWrite, controller.UpdateOption)
+}
+
+func TestApiRoutesRegisterWithoutConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+
+	require.NotPanics(t, func() {
+		SetApiRouter(engine)
+	})
+}
+
+func assertRoutePermission(t *testing.T, routes []permissionRoute, method string, path string, permission authz.Permission, handler any) {
+	t.Helper()
+	for _, route := range routes {
+		if route.method == method && route.path == path {
+			assert.Equal(t, permission, route.permission)
+			assert.Equal(t, reflect.ValueOf(handler).Pointer(), reflect.ValueOf(route.handler).Pointer())
+			return
+		}
+	}
+	t.Fatalf("route %s %s not found", method, path)
+}
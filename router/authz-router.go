@@ -9,11 +9,20 @@ import (
 
 // registerAuthzRoutes mounts the authorization API under its own /authz
 // namespace. GET /authz/catalog returns the permission schema (resources,
-// actions, and role baselines) used by the client permission editor.
+// actions, and role baselines) used by the client permission editor. Custom
+// roles and their assignments are managed by root only.
 func registerAuthzRoutes(apiRouter *gin.RouterGroup) {
 	authzRoute := apiRouter.Group("/authz")
-	authzRoute.Use(middleware.AdminAuth())
+	authzRoute.GET("/catalog", middleware.AdminAuth(), controller.GetPermissionCatalog)
+
+	roleRoute := authzRoute.Group("/")
+	roleRoute.Use(middleware.RootAuth())
 	{
-		authzRoute.GET("/catalog", controller.GetPermissionCatalog)
+		roleRoute.GET("/roles", controller.GetAuthzRoles)
+		roleRoute.POST("/roles", controller.CreateAuthzRole)
+		roleRoute.PUT("/roles/:key", controller.UpdateAuthzRole)
+		roleRoute.DELETE("/roles/:key", controller.DeleteAuthzRole)
+		roleRoute.GET("/users/:id/roles", controller.GetUserAuthzRoles)
+		roleRoute.PUT("/users/:id/roles", controller.SetUserAuthzRoles)
 	}
 }
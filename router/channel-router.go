@@ -9,16 +9,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-type permissionRoute struct {
-	method     string
-	path       string
-	permission authz.Permission
-	handler    gin.HandlerFunc
-}
-
 func registerChannelRoutes(apiRouter *gin.RouterGroup) {
 	channelRoute := apiRouter.Group("/channel")
-	channelRoute.Use(middleware.AdminAuth())
 
 	channelRoute.POST("/:id/key",
 		middleware.RootAuth(),
@@ -28,12 +20,7 @@ func registerChannelRoutes(apiRouter *gin.RouterGroup) {
 		controller.GetChannelKey,
 	)
 
-	for _, route := range channelPermissionRoutes {
-		channelRoute.Handle(route.method, route.path,
-			middleware.RequirePermission(route.permission),
-			route.handler,
-		)
-	}
+	registerPermissionRoutes(channelRoute, channelPermissionRoutes)
 }
 
 var channelPermissionRoutes = []permissionRoute{
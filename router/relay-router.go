@@ -19,6 +19,7 @@ func SetRelayRouter(router *gin.Engine) {
 	modelsRouter := router.Group("/v1/models")
 	modelsRouter.Use(middleware.RouteTag("relay"))
 	modelsRouter.Use(middleware.TokenAuth())
+	modelsRouter.Use(middleware.TokenRateLimit())
 	{
 		modelsRouter.GET("", func(c *gin.Context) {
 			switch {
@@ -44,6 +45,7 @@ func SetRelayRouter(router *gin.Engine) {
 	geminiRouter := router.Group("/v1beta/models")
 	geminiRouter.Use(middleware.RouteTag("relay"))
 	geminiRouter.Use(middleware.TokenAuth())
+	geminiRouter.Use(middleware.TokenRateLimit())
 	{
 		geminiRouter.GET("", func(c *gin.Context) {
 			controller.ListModels(c, constant.ChannelTypeGemini)
@@ -53,6 +55,7 @@ func SetRelayRouter(router *gin.Engine) {
 	geminiCompatibleRouter := router.Group("/v1beta/openai/models")
 	geminiCompatibleRouter.Use(middleware.RouteTag("relay"))
 	geminiCompatibleRouter.Use(middleware.TokenAuth())
+	geminiCompatibleRouter.Use(middleware.TokenRateLimit())
 	{
 		geminiCompatibleRouter.GET("", func(c *gin.Context) {
 			controller.ListModels(c, constant.ChannelTypeOpenAI)
@@ -71,6 +74,7 @@ func SetRelayRouter(router *gin.Engine) {
 	relayV1Router.Use(middleware.SystemPerformanceCheck())
 	relayV1Router.Use(middleware.TokenAuth())
 	relayV1Router.Use(middleware.ModelRequestRateLimit())
+	relayV1Router.Use(middleware.TokenRateLimit())
 	{
 		// WebSocket 路由（统一到 Relay）
 		wsRouter := relayV1Router.Group("")
@@ -79,6 +83,33 @@ func SetRelayRouter(router *gin.Engine) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
 	}
+	{
+		// files routes (no model, no channel distribution)
+		relayV1Router.GET("/files", controller.ListFiles)
+		relayV1Router.POST("/files", controller.UploadFile)
+		relayV1Router.GET("/files/:id", controller.RetrieveFile)
+		relayV1Router.GET("/files/:id/content", controller.RetrieveFileContent)
+		relayV1Router.DELETE("/files/:id", controller.DeleteFile)
+
+		// batch routes, lines are executed asynchronously by the batch runner
+		relayV1Router.POST("/batches", controller.CreateBatch)
+		relayV1Router.GET("/batches", controller.ListBatches)
+		relayV1Router.GET("/batches/:id", controller.RetrieveBatch)
+		relayV1Router.POST("/batches/:id/cancel", controller.CancelBatch)
+
+		// Anthropic Message Batches, executed by the same runner as /v1/batches
+		relayV1Router.POST("/messages/batches", controller.CreateClaudeMessageBatch)
+		relayV1Router.GET("/messages/batches", controller.ListClaudeMessageBatches)
+		relayV1Router.GET("/messages/batches/:id", controller.RetrieveClaudeMessageBatch)
+		relayV1Router.DELETE("/messages/batches/:id", controller.DeleteClaudeMessageBatch)
+		relayV1Router.POST("/messages/batches/:id/cancel", controller.CancelClaudeMessageBatch)
+		relayV1Router.GET("/messages/batches/:id/results", controller.RetrieveClaudeMessageBatchResults)
+
+		// stored responses of channels without native Responses state
+		relayV1Router.GET("/responses/:id", controller.RetrieveResponse)
+		relayV1Router.DELETE("/responses/:id", controller.DeleteResponse)
+		relayV1Router.GET("/responses/:id/input_items", controller.ListResponseInputItems)
+	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
@@ -88,6 +119,7 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/messages", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatClaude)
 		})
+		httpRouter.POST("/messages/count_tokens", controller.ClaudeCountTokens)
 
 		// chat related routes
 		httpRouter.POST("/completions", func(c *gin.Context) {
@@ -157,11 +189,6 @@ func SetRelayRouter(router *gin.Engine) {
 
 		// not implemented
 		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -184,7 +211,7 @@ func SetRelayRouter(router *gin.Engine) {
 	relaySunoRouter := router.Group("/suno")
 	relaySunoRouter.Use(middleware.RouteTag("relay"))
 	relaySunoRouter.Use(middleware.SystemPerformanceCheck())
-	relaySunoRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	relaySunoRouter.Use(middleware.TokenAuth(), middleware.TokenRateLimit(), middleware.Distribute())
 	{
 		relaySunoRouter.POST("/submit/:action", controller.RelayTask)
 		relaySunoRouter.POST("/fetch", controller.RelayTaskFetch)
@@ -196,6 +223,7 @@ func SetRelayRouter(router *gin.Engine) {
 	relayGeminiRouter.Use(middleware.SystemPerformanceCheck())
 	relayGeminiRouter.Use(middleware.TokenAuth())
 	relayGeminiRouter.Use(middleware.ModelRequestRateLimit())
+	relayGeminiRouter.Use(middleware.TokenRateLimit())
 	relayGeminiRouter.Use(middleware.Distribute())
 	{
 		// Gemini API 路径格式: /v1beta/models/{model_name}:{action}
@@ -203,11 +231,41 @@ func SetRelayRouter(router *gin.Engine) {
 			controller.Relay(c, types.RelayFormatGemini)
 		})
 	}
+
+	// Gemini Files API 与 cachedContents：不按模型分发，资源固定在创建它的渠道上
+	geminiResourceRouter := router.Group("")
+	geminiResourceRouter.Use(middleware.RouteTag("relay"))
+	geminiResourceRouter.Use(middleware.SystemPerformanceCheck())
+	geminiResourceRouter.Use(middleware.TokenAuth())
+	geminiResourceRouter.Use(middleware.TokenRateLimit())
+	{
+		geminiResourceRouter.POST("/upload/v1beta/files", controller.GeminiUploadFile)
+		geminiResourceRouter.GET("/v1beta/files", controller.ListGeminiFiles)
+		geminiResourceRouter.GET("/v1beta/files/:name", controller.GetGeminiFile)
+		geminiResourceRouter.DELETE("/v1beta/files/:name", controller.DeleteGeminiFile)
+
+		geminiResourceRouter.POST("/v1beta/cachedContents", controller.CreateGeminiCachedContent)
+		geminiResourceRouter.GET("/v1beta/cachedContents", controller.ListGeminiCachedContents)
+		geminiResourceRouter.GET("/v1beta/cachedContents/:name", controller.GetGeminiCachedContent)
+		geminiResourceRouter.PATCH("/v1beta/cachedContents/:name", controller.UpdateGeminiCachedContent)
+		geminiResourceRouter.DELETE("/v1beta/cachedContents/:name", controller.DeleteGeminiCachedContent)
+	}
+
+	// MCP 网关：按令牌分组代理已登记的 streamable HTTP MCP 服务
+	mcpRouter := router.Group("/mcp")
+	mcpRouter.Use(middleware.RouteTag("relay"))
+	mcpRouter.Use(middleware.TokenAuth())
+	mcpRouter.Use(middleware.TokenRateLimit())
+	{
+		mcpRouter.POST("/:name", controller.McpProxy)
+		mcpRouter.GET("/:name", controller.McpProxy)
+		mcpRouter.DELETE("/:name", controller.McpProxy)
+	}
 }
 
 func registerMjRouterGroup(relayMjRouter *gin.RouterGroup) {
 	relayMjRouter.GET("/image/:id", relay.RelayMidjourneyImage)
-	relayMjRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	relayMjRouter.Use(middleware.TokenAuth(), middleware.TokenRateLimit(), middleware.Distribute())
 	{
 		relayMjRouter.POST("/submit/action", controller.RelayMidjourney)
 		relayMjRouter.POST("/submit/shorten", controller.RelayMidjourney)
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var routeParamPattern = regexp.MustCompile(`[:*][^/]+`)
+
+func TestTokenAuthRelayRoutesApplyTokenRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	var chain []string
+	// Record the matched route's handler chain and stop before any middleware runs.
+	engine.Use(func(c *gin.Context) {
+		chain = c.HandlerNames()
+		c.AbortWithStatus(http.StatusNoContent)
+	})
+	SetRelayRouter(engine)
+	SetVideoRouter(engine)
+
+	checked := 0
+	for _, route := range engine.Routes() {
+		path := routeParamPattern.ReplaceAllString(route.Path, "x")
+		chain = nil
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(route.Method, path, nil))
+		require.NotEmpty(t, chain, "%s %s", route.Method, route.Path)
+
+		authIndex := slices.IndexFunc(chain, func(name string) bool {
+			return strings.Contains(name, "middleware.TokenAuth.")
+		})
+		if authIndex < 0 {
+			continue
+		}
+		limitIndex := slices.IndexFunc(chain, func(name string) bool {
+			return strings.Contains(name, "middleware.TokenRateLimit.")
+		})
+		assert.Greater(t, limitIndex, authIndex, "%s %s runs TokenAuth without TokenRateLimit", route.Method, route.Path)
+		checked++
+	}
+	assert.NotZero(t, checked)
+}
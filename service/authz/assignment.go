@@ -1,20 +1,96 @@
 package authz
 
-import "github.com/QuantumNous/new-api/common"
+import (
+	"errors"
+	"sort"
+	"strings"
 
-// resolveSubjectRoles returns the role keys assigned to a subject. The mapping
-// is derived from the caller's system role.
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// resolveSubjectRoles returns the role keys assigned to a subject: the built-in
+// role derived from the caller's system role, plus any enabled custom roles
+// assigned to the user.
 var resolveSubjectRoles = func(userID int, systemRole int) []string {
+	var roles []string
 	switch {
 	case systemRole >= common.RoleRootUser:
 		return []string{BuiltInRoleRoot}
 	case systemRole >= common.RoleAdminUser:
-		return []string{BuiltInRoleAdmin}
-	default:
-		return nil
+		roles = append(roles, BuiltInRoleAdmin)
+	}
+	for _, roleKey := range UserRoles(userID) {
+		if role, ok := customRole(roleKey); ok && role.Enabled {
+			roles = append(roles, roleKey)
+		}
 	}
+	return roles
 }
 
 // managedRoleKey is the role whose baseline per-user overrides are expressed
 // relative to.
 const managedRoleKey = BuiltInRoleAdmin
+
+// UserRoles returns the custom role keys assigned to a user, including disabled
+// ones.
+func UserRoles(userID int) []string {
+	e := currentEnforcer()
+	if e == nil || userID <= 0 {
+		return nil
+	}
+	links, err := e.GetFilteredGroupingPolicy(0, UserSubject(userID))
+	if err != nil {
+		return nil
+	}
+	roles := make([]string, 0, len(links))
+	for _, link := range links {
+		if len(link) < 2 || !strings.HasPrefix(link[1], "role:") {
+			continue
+		}
+		roles = append(roles, strings.TrimPrefix(link[1], "role:"))
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// SetUserRoles replaces the custom roles assigned to a user. Built-in roles
+// follow the system role and cannot be assigned here.
+func SetUserRoles(userID int, roleKeys []string) error {
+	if roleStore == nil {
+		return errors.New("authz enforcer is not initialized")
+	}
+	seen := make(map[string]bool, len(roleKeys))
+	rules := make([]model.CasbinRule, 0, len(roleKeys))
+	for _, roleKey := range roleKeys {
+		if seen[roleKey] {
+			continue
+		}
+		seen[roleKey] = true
+		if _, ok := customRole(roleKey); !ok {
+			return ErrRoleNotFound
+		}
+		rules = append(rules, newRule("g", []string{UserSubject(userID), RoleSubject(roleKey)}))
+	}
+	err := roleStore.Transaction(func(tx *gorm.DB) error {
+		if err := ClearUserRolesInTx(tx, userID); err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rules).Error
+	})
+	if err != nil {
+		return err
+	}
+	return ReloadPolicy()
+}
+
+// ClearUserRolesInTx removes every custom role assignment of a user. Callers
+// reload the policy after the transaction commits.
+func ClearUserRolesInTx(tx *gorm.DB, userID int) error {
+	return tx.Where("ptype = ? AND v0 = ?", "g", UserSubject(userID)).Delete(&model.CasbinRule{}).Error
+}
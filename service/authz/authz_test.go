@@ -97,15 +97,13 @@ func TestSetUserPermissionsStoresOnlyOverrides(t *testing.T) {
 
 	assert.True(t, Can(42, common.RoleAdminUser, ChannelSensitiveWrite))
 	assert.False(t, Can(42, common.RoleAdminUser, ChannelWrite))
-	assert.Equal(t, PermissionsMap{
-		ResourceChannel: {
-			ActionRead:           true,
-			ActionOperate:        true,
-			ActionWrite:          false,
-			ActionSensitiveWrite: true,
-			ActionSecretView:     false,
-		},
-	}, ExplicitUserPermissions(42))
+	assert.Equal(t, map[string]bool{
+		ActionRead:           true,
+		ActionOperate:        true,
+		ActionWrite:          false,
+		ActionSensitiveWrite: true,
+		ActionSecretView:     false,
+	}, ExplicitUserPermissions(42)[ResourceChannel])
 	assert.Equal(t, PermissionsMap{
 		ResourceChannel: {
 			ActionSensitiveWrite: true,
@@ -125,15 +123,13 @@ func TestSetUserPermissionsStoresOnlyOverrides(t *testing.T) {
 		ActionSecretView:     false,
 	}}))
 	assert.False(t, Can(42, common.RoleAdminUser, ChannelSensitiveWrite))
-	assert.Equal(t, PermissionsMap{
-		ResourceChannel: {
-			ActionRead:           true,
-			ActionOperate:        true,
-			ActionWrite:          true,
-			ActionSensitiveWrite: false,
-			ActionSecretView:     false,
-		},
-	}, ExplicitUserPermissions(42))
+	assert.Equal(t, map[string]bool{
+		ActionRead:           true,
+		ActionOperate:        true,
+		ActionWrite:          true,
+		ActionSensitiveWrite: false,
+		ActionSecretView:     false,
+	}, ExplicitUserPermissions(42)[ResourceChannel])
 	assert.Empty(t, ExplicitUserOverrides(42))
 }
 
@@ -227,3 +223,42 @@ func TestCapabilitiesUseCatalogShape(t *testing.T) {
 	assert.False(t, capabilities[ResourceChannel][ActionSensitiveWrite])
 	assert.False(t, capabilities[ResourceChannel][ActionSecretView])
 }
+
+func TestCustomRoleGrantsAssignedUsers(t *testing.T) {
+	db := newAuthzTestDB(t)
+	require.NoError(t, Init(db))
+
+	require.NoError(t, CreateRole(RoleInput{
+		Key:  "support",
+		Name: "Support agent",
+		Permissions: PermissionsMap{
+			ResourceUser:    {ActionRead: true, ActionWrite: false},
+			ResourceLog:     {ActionRead: true},
+			ResourcePayment: {ActionWrite: true},
+			"unknown":       {ActionRead: true},
+		},
+	}))
+	assert.ErrorIs(t, CreateRole(RoleInput{Key: "support", Name: "Again"}), ErrRoleKeyExists)
+	assert.ErrorIs(t, CreateRole(RoleInput{Key: BuiltInRoleAdmin, Name: "Admin"}), ErrRoleKeyInvalid)
+	assert.ErrorIs(t, SetUserRoles(5, []string{"missing"}), ErrRoleNotFound)
+
+	assert.False(t, Can(5, common.RoleCommonUser, UserRead))
+	require.NoError(t, SetUserRoles(5, []string{"support"}))
+	assert.Equal(t, []string{"support"}, UserRoles(5))
+	assert.True(t, Can(5, common.RoleCommonUser, UserRead))
+	assert.True(t, Can(5, common.RoleCommonUser, LogRead))
+	assert.True(t, Can(5, common.RoleCommonUser, PaymentWrite))
+	assert.False(t, Can(5, common.RoleCommonUser, UserWrite))
+	assert.False(t, Can(5, common.RoleCommonUser, ChannelRead))
+	assert.False(t, Can(6, common.RoleCommonUser, UserRead))
+
+	disabled := false
+	require.NoError(t, UpdateRole("support", RoleInput{Enabled: &disabled}))
+	assert.False(t, Can(5, common.RoleCommonUser, UserRead))
+
+	require.NoError(t, DeleteRole("support"))
+	assert.Empty(t, UserRoles(5))
+	var count int64
+	require.NoError(t, db.Model(&model.CasbinRule{}).Where("v0 = ? OR v1 = ?", RoleSubject("support"), RoleSubject("support")).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
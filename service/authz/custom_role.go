@@ -0,0 +1,224 @@
+package authz
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRoleNotFound   = errors.New("authz role not found")
+	ErrRoleKeyInvalid = errors.New("authz role key is invalid")
+	ErrRoleKeyExists  = errors.New("authz role key already exists")
+	ErrRoleBuiltIn    = errors.New("built-in authz roles cannot be modified")
+	ErrRoleNameEmpty  = errors.New("authz role name is empty")
+)
+
+var roleKeyPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// customRoleSortBase keeps admin-defined roles listed after the built-in ones.
+const customRoleSortBase = 100
+
+var (
+	roleStore     *gorm.DB
+	customRolesMu sync.RWMutex
+	customRoles   map[string]model.AuthzRole
+)
+
+// RoleInput carries the editable fields of a custom role. Permissions replaces
+// the whole grant matrix when non-nil; only allowed entries are stored.
+type RoleInput struct {
+	Key         string         `json:"key"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Enabled     *bool          `json:"enabled"`
+	Permissions PermissionsMap `json:"permissions"`
+}
+
+func loadCustomRoles() error {
+	if roleStore == nil {
+		return nil
+	}
+	var roles []model.AuthzRole
+	if err := roleStore.Where("built_in = ?", false).Find(&roles).Error; err != nil {
+		return err
+	}
+	loaded := make(map[string]model.AuthzRole, len(roles))
+	for _, role := range roles {
+		loaded[role.Key] = role
+	}
+	customRolesMu.Lock()
+	customRoles = loaded
+	customRolesMu.Unlock()
+	return nil
+}
+
+func customRole(roleKey string) (model.AuthzRole, bool) {
+	customRolesMu.RLock()
+	defer customRolesMu.RUnlock()
+	role, ok := customRoles[roleKey]
+	return role, ok
+}
+
+func sortedCustomRoles() []model.AuthzRole {
+	customRolesMu.RLock()
+	roles := make([]model.AuthzRole, 0, len(customRoles))
+	for _, role := range customRoles {
+		roles = append(roles, role)
+	}
+	customRolesMu.RUnlock()
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].Sort != roles[j].Sort {
+			return roles[i].Sort < roles[j].Sort
+		}
+		return roles[i].Key < roles[j].Key
+	})
+	return roles
+}
+
+// customRoleCondition uses a map so gorm quotes the reserved "key" column for
+// every dialect.
+func customRoleCondition(roleKey string) map[string]interface{} {
+	return map[string]interface{}{"key": roleKey, "built_in": false}
+}
+
+func isBuiltInRoleKey(roleKey string) bool {
+	_, ok := roleSpec(roleKey)
+	return ok
+}
+
+// CreateRole stores a new custom role together with its grants.
+func CreateRole(input RoleInput) error {
+	if roleStore == nil {
+		return errors.New("authz enforcer is not initialized")
+	}
+	key := strings.TrimSpace(input.Key)
+	if !roleKeyPattern.MatchString(key) || isBuiltInRoleKey(key) {
+		return ErrRoleKeyInvalid
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return ErrRoleNameEmpty
+	}
+	enabled := true
+	if input.Enabled != nil {
+		enabled = *input.Enabled
+	}
+	role := model.AuthzRole{
+		Key:         key,
+		Name:        name,
+		Description: input.Description,
+		Enabled:     enabled,
+		Sort:        customRoleSortBase,
+	}
+	err := roleStore.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.AuthzRole{}).Where(map[string]interface{}{"key": key}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRoleKeyExists
+		}
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return replaceRolePoliciesInTx(tx, key, input.Permissions)
+	})
+	if err != nil {
+		return err
+	}
+	return ReloadPolicy()
+}
+
+// UpdateRole edits a custom role. Empty name keeps the current one and a nil
+// Permissions keeps the current grants.
+func UpdateRole(roleKey string, input RoleInput) error {
+	if roleStore == nil {
+		return errors.New("authz enforcer is not initialized")
+	}
+	if isBuiltInRoleKey(roleKey) {
+		return ErrRoleBuiltIn
+	}
+	err := roleStore.Transaction(func(tx *gorm.DB) error {
+		var role model.AuthzRole
+		if err := tx.Where(customRoleCondition(roleKey)).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return err
+		}
+		updates := map[string]interface{}{
+			"description": input.Description,
+		}
+		if name := strings.TrimSpace(input.Name); name != "" {
+			updates["name"] = name
+		}
+		if input.Enabled != nil {
+			updates["enabled"] = *input.Enabled
+		}
+		if err := tx.Model(&role).Updates(updates).Error; err != nil {
+			return err
+		}
+		if input.Permissions == nil {
+			return nil
+		}
+		return replaceRolePoliciesInTx(tx, roleKey, input.Permissions)
+	})
+	if err != nil {
+		return err
+	}
+	return ReloadPolicy()
+}
+
+// DeleteRole removes a custom role, its grants and every assignment of it.
+func DeleteRole(roleKey string) error {
+	if roleStore == nil {
+		return errors.New("authz enforcer is not initialized")
+	}
+	if isBuiltInRoleKey(roleKey) {
+		return ErrRoleBuiltIn
+	}
+	err := roleStore.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(customRoleCondition(roleKey)).Delete(&model.AuthzRole{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRoleNotFound
+		}
+		if err := tx.Where("ptype = ? AND v0 = ?", "p", RoleSubject(roleKey)).Delete(&model.CasbinRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("ptype = ? AND v1 = ?", "g", RoleSubject(roleKey)).Delete(&model.CasbinRule{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return ReloadPolicy()
+}
+
+// replaceRolePoliciesInTx rewrites the allow entries of a custom role. Unknown
+// resources and actions are dropped so a stale client cannot plant policies.
+func replaceRolePoliciesInTx(tx *gorm.DB, roleKey string, permissions PermissionsMap) error {
+	subject := RoleSubject(roleKey)
+	if err := tx.Where("ptype = ? AND v0 = ?", "p", subject).Delete(&model.CasbinRule{}).Error; err != nil {
+		return err
+	}
+	rules := make([]model.CasbinRule, 0)
+	for _, permission := range AllPermissions() {
+		if !permissions[permission.Resource][permission.Action] {
+			continue
+		}
+		rules = append(rules, newRule("p", []string{subject, permission.Resource, permission.Action, EffectAllow}))
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rules).Error
+}
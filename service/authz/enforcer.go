@@ -23,6 +23,9 @@ r = sub, obj, act
 [policy_definition]
 p = sub, obj, act, eft
 
+[role_definition]
+g = _, _
+
 [policy_effect]
 e = some(where (p.eft == allow))
 
@@ -54,6 +57,11 @@ func Init(db *gorm.DB) error {
 	enforcer = e
 	enforcerMu.Unlock()
 
+	roleStore = db
+	if err := loadCustomRoles(); err != nil {
+		return err
+	}
+
 	if !common.IsMasterNode {
 		return nil
 	}
@@ -67,6 +75,13 @@ func currentEnforcer() *casbin.SyncedEnforcer {
 }
 
 func ReloadPolicy() error {
+	if err := reloadEnforcerPolicy(); err != nil {
+		return err
+	}
+	return loadCustomRoles()
+}
+
+func reloadEnforcerPolicy() error {
 	enforcerMu.Lock()
 	defer enforcerMu.Unlock()
 	if enforcer == nil {
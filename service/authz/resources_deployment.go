@@ -0,0 +1,36 @@
+package authz
+
+const ResourceDeployment = "deployment"
+
+var (
+	DeploymentRead           = Permission{Resource: ResourceDeployment, Action: ActionRead}
+	DeploymentWrite          = Permission{Resource: ResourceDeployment, Action: ActionWrite}
+	DeploymentSensitiveWrite = Permission{Resource: ResourceDeployment, Action: ActionSensitiveWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceDeployment,
+		LabelKey: "Deployment Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read deployments",
+				DescriptionKey: "View deployments, containers, logs, hardware, and price estimates.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit deployments",
+				DescriptionKey: "Create, rename, update, and extend deployments.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionSensitiveWrite,
+				LabelKey:       "Delete deployments",
+				DescriptionKey: "Delete deployments and test provider connections.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
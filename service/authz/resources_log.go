@@ -0,0 +1,29 @@
+package authz
+
+const ResourceLog = "log"
+
+var (
+	LogRead        = Permission{Resource: ResourceLog, Action: ActionRead}
+	LogPayloadView = Permission{Resource: ResourceLog, Action: ActionSecretView}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceLog,
+		LabelKey: "Logs and Usage",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read logs",
+				DescriptionKey: "View usage logs, dashboards, and drawing or task records of all users.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				// captured payloads hold full prompts and answers, so no admin default
+				Action:         ActionSecretView,
+				LabelKey:       "View captured payloads",
+				DescriptionKey: "View sampled request and response bodies captured for disputes.",
+			},
+		},
+	})
+}
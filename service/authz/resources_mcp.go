@@ -0,0 +1,29 @@
+package authz
+
+const ResourceMcpServer = "mcp_server"
+
+var (
+	McpServerRead  = Permission{Resource: ResourceMcpServer, Action: ActionRead}
+	McpServerWrite = Permission{Resource: ResourceMcpServer, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceMcpServer,
+		LabelKey: "MCP Server Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read MCP servers",
+				DescriptionKey: "View registered MCP servers and the tools they expose.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit MCP servers",
+				DescriptionKey: "Register, update and remove MCP servers, including their auth headers and per-group tool access.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
@@ -0,0 +1,29 @@
+package authz
+
+const ResourceModel = "model"
+
+var (
+	ModelRead  = Permission{Resource: ResourceModel, Action: ActionRead}
+	ModelWrite = Permission{Resource: ResourceModel, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceModel,
+		LabelKey: "Model Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read models",
+				DescriptionKey: "View model metadata, vendors, groups, and prefill groups.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit models",
+				DescriptionKey: "Edit model metadata, vendors, and prefill groups, and sync models from upstream.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
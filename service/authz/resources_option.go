@@ -0,0 +1,34 @@
+package authz
+
+const ResourceOption = "option"
+
+var (
+	OptionRead           = Permission{Resource: ResourceOption, Action: ActionRead}
+	OptionWrite          = Permission{Resource: ResourceOption, Action: ActionWrite}
+	OptionSensitiveWrite = Permission{Resource: ResourceOption, Action: ActionSensitiveWrite}
+)
+
+// Options have no admin defaults: they stay root-only unless granted.
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceOption,
+		LabelKey: "System Settings",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read settings",
+				DescriptionKey: "View system settings and cache statistics.",
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit settings",
+				DescriptionKey: "Edit system settings, reset model ratios, and clear caches.",
+			},
+			{
+				Action:         ActionSensitiveWrite,
+				LabelKey:       "Edit payment and login providers",
+				DescriptionKey: "Configure payment integrations, payment compliance, and custom OAuth providers.",
+			},
+		},
+	})
+}
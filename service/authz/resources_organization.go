@@ -0,0 +1,29 @@
+package authz
+
+const ResourceOrganization = "organization"
+
+var (
+	OrganizationRead  = Permission{Resource: ResourceOrganization, Action: ActionRead}
+	OrganizationWrite = Permission{Resource: ResourceOrganization, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceOrganization,
+		LabelKey: "Organization Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read organizations",
+				DescriptionKey: "View all organizations and their shared quota.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit organizations",
+				DescriptionKey: "Adjust the shared quota and enable or disable organizations.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
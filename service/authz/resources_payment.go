@@ -0,0 +1,29 @@
+package authz
+
+const ResourcePayment = "payment"
+
+var (
+	PaymentRead  = Permission{Resource: ResourcePayment, Action: ActionRead}
+	PaymentWrite = Permission{Resource: ResourcePayment, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourcePayment,
+		LabelKey: "Payment Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read top-ups",
+				DescriptionKey: "View top-up orders of all users.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Settle top-ups",
+				DescriptionKey: "Manually complete pending top-up orders.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
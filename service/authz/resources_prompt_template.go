@@ -0,0 +1,29 @@
+package authz
+
+const ResourcePromptTemplate = "prompt_template"
+
+var (
+	PromptTemplateRead  = Permission{Resource: ResourcePromptTemplate, Action: ActionRead}
+	PromptTemplateWrite = Permission{Resource: ResourcePromptTemplate, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourcePromptTemplate,
+		LabelKey: "Prompt Template Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read prompt templates",
+				DescriptionKey: "View all users' prompt templates, their versions and usage stats.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit prompt templates",
+				DescriptionKey: "Remove prompt templates owned by any user or organization.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
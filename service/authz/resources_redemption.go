@@ -0,0 +1,36 @@
+package authz
+
+const ResourceRedemption = "redemption"
+
+var (
+	RedemptionRead           = Permission{Resource: ResourceRedemption, Action: ActionRead}
+	RedemptionWrite          = Permission{Resource: ResourceRedemption, Action: ActionWrite}
+	RedemptionSensitiveWrite = Permission{Resource: ResourceRedemption, Action: ActionSensitiveWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceRedemption,
+		LabelKey: "Redemption Code Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read redemption codes",
+				DescriptionKey: "View and search redemption codes.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit redemption codes",
+				DescriptionKey: "Generate redemption codes and edit their quota, expiry, and status.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionSensitiveWrite,
+				LabelKey:       "Delete redemption codes",
+				DescriptionKey: "Delete individual or all invalid redemption codes.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
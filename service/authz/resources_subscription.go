@@ -0,0 +1,36 @@
+package authz
+
+const ResourceSubscription = "subscription"
+
+var (
+	SubscriptionRead           = Permission{Resource: ResourceSubscription, Action: ActionRead}
+	SubscriptionWrite          = Permission{Resource: ResourceSubscription, Action: ActionWrite}
+	SubscriptionSensitiveWrite = Permission{Resource: ResourceSubscription, Action: ActionSensitiveWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceSubscription,
+		LabelKey: "Subscription Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read subscriptions",
+				DescriptionKey: "View subscription plans and the subscriptions of users.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit subscriptions",
+				DescriptionKey: "Create and edit plans, and grant subscriptions to users.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionSensitiveWrite,
+				LabelKey:       "Reset or revoke subscriptions",
+				DescriptionKey: "Reset subscription quota, and invalidate or delete user subscriptions.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
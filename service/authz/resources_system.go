@@ -0,0 +1,28 @@
+package authz
+
+const ResourceSystem = "system"
+
+var (
+	SystemRead    = Permission{Resource: ResourceSystem, Action: ActionRead}
+	SystemOperate = Permission{Resource: ResourceSystem, Action: ActionOperate}
+)
+
+// System maintenance has no admin defaults: it stays root-only unless granted.
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceSystem,
+		LabelKey: "System Maintenance",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read system status",
+				DescriptionKey: "View performance statistics, log files, instances, and system tasks.",
+			},
+			{
+				Action:         ActionOperate,
+				LabelKey:       "Operate the system",
+				DescriptionKey: "Run garbage collection, clean caches and logs, start system tasks, and sync ratios.",
+			},
+		},
+	})
+}
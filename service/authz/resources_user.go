@@ -0,0 +1,36 @@
+package authz
+
+const ResourceUser = "user"
+
+var (
+	UserRead           = Permission{Resource: ResourceUser, Action: ActionRead}
+	UserWrite          = Permission{Resource: ResourceUser, Action: ActionWrite}
+	UserSensitiveWrite = Permission{Resource: ResourceUser, Action: ActionSensitiveWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceUser,
+		LabelKey: "User Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read users",
+				DescriptionKey: "View user lists, details, bindings, and 2FA statistics.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit users",
+				DescriptionKey: "Create and edit users, adjust quota, and enable or disable accounts.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionSensitiveWrite,
+				LabelKey:       "Edit sensitive user settings",
+				DescriptionKey: "Delete users, reset passkeys and 2FA, and clear login bindings.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
@@ -37,28 +37,61 @@ var builtInRoles = []RoleSpec{
 
 // RoleDescriptor exposes a role together with its baseline grant matrix.
 type RoleDescriptor struct {
-	Key       string         `json:"key"`
-	Name      string         `json:"name"`
-	BuiltIn   bool           `json:"built_in"`
-	Superuser bool           `json:"superuser"`
-	Grants    PermissionsMap `json:"grants"`
+	Key         string         `json:"key"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	BuiltIn     bool           `json:"built_in"`
+	Superuser   bool           `json:"superuser"`
+	Enabled     bool           `json:"enabled"`
+	Grants      PermissionsMap `json:"grants"`
 }
 
-// Roles returns the role descriptors with their baseline grants.
+// Roles returns the built-in role descriptors followed by the custom roles,
+// each with its baseline grants.
 func Roles() []RoleDescriptor {
-	result := make([]RoleDescriptor, 0, len(builtInRoles))
+	custom := sortedCustomRoles()
+	result := make([]RoleDescriptor, 0, len(builtInRoles)+len(custom))
 	for _, spec := range builtInRoles {
 		result = append(result, RoleDescriptor{
-			Key:       spec.Key,
-			Name:      spec.Name,
-			BuiltIn:   spec.BuiltIn,
-			Superuser: spec.Superuser,
-			Grants:    roleGrants(spec),
+			Key:         spec.Key,
+			Name:        spec.Name,
+			Description: spec.Description,
+			BuiltIn:     spec.BuiltIn,
+			Superuser:   spec.Superuser,
+			Enabled:     true,
+			Grants:      roleGrants(spec),
+		})
+	}
+	for _, role := range custom {
+		result = append(result, RoleDescriptor{
+			Key:         role.Key,
+			Name:        role.Name,
+			Description: role.Description,
+			Enabled:     role.Enabled,
+			Grants:      customRoleGrants(role.Key),
 		})
 	}
 	return result
 }
 
+// customRoleGrants reads a custom role's grants from the loaded policy, since
+// they are not declared in the registry.
+func customRoleGrants(roleKey string) PermissionsMap {
+	e := currentEnforcer()
+	grants := make(PermissionsMap, len(registry))
+	for _, resource := range registry {
+		actions := make(map[string]bool, len(resource.Actions))
+		for _, action := range resource.Actions {
+			actions[action.Action] = e != nil && roleBaselineAllows(e, roleKey, Permission{
+				Resource: resource.Resource,
+				Action:   action.Action,
+			})
+		}
+		grants[resource.Resource] = actions
+	}
+	return grants
+}
+
 func roleGrants(spec RoleSpec) PermissionsMap {
 	grants := make(PermissionsMap, len(registry))
 	for _, resource := range registry {
@@ -0,0 +1,815 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// BatchCompletionWindow 目前 OpenAI 仅支持 24h
+	BatchCompletionWindow = "24h"
+	// BatchChunkSize 本地执行时每处理这么多行落盘一次结果分片并保存进度
+	BatchChunkSize = 50
+
+	batchCompletionWindowSeconds = int64(24 * 3600)
+	batchOutputPurpose           = "batch_output"
+)
+
+// SupportedBatchEndpoints /v1/batches 支持的 endpoint
+var SupportedBatchEndpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings", "/v1/responses", "/v1/moderations"}
+
+func IsSupportedBatchEndpoint(endpoint string) bool {
+	for _, supported := range SupportedBatchEndpoints {
+		if endpoint == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// NewBatchId 生成批处理 id
+func NewBatchId() string {
+	return "batch_" + common.GetRandomString(24)
+}
+
+// BatchCompletionDeadline 批处理过期时间
+func BatchCompletionDeadline(createdAt int64) int64 {
+	return createdAt + batchCompletionWindowSeconds
+}
+
+// BatchError 对应 OpenAI batch 对象 errors.data 的元素
+type BatchError struct {
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Param   *string `json:"param"`
+	Line    *int    `json:"line"`
+}
+
+type OpenAIBatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// OpenAIBatchObject 是 /v1/batches 返回给客户端的批处理对象
+type OpenAIBatchObject struct {
+	Id               string                   `json:"id"`
+	Object           string                   `json:"object"`
+	Endpoint         string                   `json:"endpoint"`
+	Errors           any                      `json:"errors"`
+	InputFileId      string                   `json:"input_file_id"`
+	CompletionWindow string                   `json:"completion_window"`
+	Status           string                   `json:"status"`
+	OutputFileId     *string                  `json:"output_file_id"`
+	ErrorFileId      *string                  `json:"error_file_id"`
+	CreatedAt        int64                    `json:"created_at"`
+	InProgressAt     *int64                   `json:"in_progress_at"`
+	ExpiresAt        *int64                   `json:"expires_at"`
+	FinalizingAt     *int64                   `json:"finalizing_at"`
+	CompletedAt      *int64                   `json:"completed_at"`
+	FailedAt         *int64                   `json:"failed_at"`
+	ExpiredAt        *int64                   `json:"expired_at"`
+	CancellingAt     *int64                   `json:"cancelling_at"`
+	CancelledAt      *int64                   `json:"cancelled_at"`
+	RequestCounts    OpenAIBatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string        `json:"metadata"`
+}
+
+func optionalTimestamp(value int64) *int64 {
+	if value == 0 {
+		return nil
+	}
+	return common.GetPointer(value)
+}
+
+func ToOpenAIBatchObject(batch *model.Batch) OpenAIBatchObject {
+	obj := OpenAIBatchObject{
+		Id:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalString(batch.OutputFileId),
+		ErrorFileId:      optionalString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalTimestamp(batch.InProgressAt),
+		ExpiresAt:        optionalTimestamp(batch.ExpiresAt),
+		FinalizingAt:     optionalTimestamp(batch.FinalizingAt),
+		CompletedAt:      optionalTimestamp(batch.CompletedAt),
+		FailedAt:         optionalTimestamp(batch.FailedAt),
+		ExpiredAt:        optionalTimestamp(batch.ExpiredAt),
+		CancellingAt:     optionalTimestamp(batch.CancellingAt),
+		CancelledAt:      optionalTimestamp(batch.CancelledAt),
+		RequestCounts: OpenAIBatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &obj.Metadata)
+	}
+	if errs := GetBatchErrors(batch); len(errs) > 0 {
+		obj.Errors = gin.H{"object": "list", "data": errs}
+	}
+	return obj
+}
+
+func GetBatchErrors(batch *model.Batch) []BatchError {
+	if batch.Errors == "" {
+		return nil
+	}
+	var errs []BatchError
+	if err := common.UnmarshalJsonStr(batch.Errors, &errs); err != nil {
+		return nil
+	}
+	return errs
+}
+
+func SetBatchErrors(batch *model.Batch, errs []BatchError) {
+	if len(errs) == 0 {
+		batch.Errors = ""
+		return
+	}
+	data, err := common.Marshal(errs)
+	if err != nil {
+		return
+	}
+	batch.Errors = string(data)
+}
+
+// ---------------------------------------------------------------------------
+// 输入文件解析
+// ---------------------------------------------------------------------------
+
+// BatchRequestLine 输入 JSONL 的一行
+type BatchRequestLine struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// maxBatchValidationErrors 校验失败时最多返回的错误条数
+const maxBatchValidationErrors = 10
+
+// ParseBatchInput 解析并校验批处理输入文件。任意一行不合法则整个批处理校验失败，
+// 与 OpenAI 一致返回带行号的错误列表。
+func ParseBatchInput(content []byte, endpoint string, maxRequests int) ([]BatchRequestLine, []BatchError) {
+	var (
+		lines    []BatchRequestLine
+		errs     []BatchError
+		seenIds  = map[string]struct{}{}
+		lineNo   = 0
+		addError = func(line int, code string, message string) {
+			if len(errs) < maxBatchValidationErrors {
+				errs = append(errs, BatchError{Code: code, Message: message, Line: common.GetPointer(line)})
+			}
+		}
+	)
+	for _, raw := range bytes.Split(content, []byte("\n")) {
+		lineNo++
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+		var line BatchRequestLine
+		if err := common.Unmarshal(raw, &line); err != nil {
+			addError(lineNo, "invalid_json_line", "This line is not parseable as valid JSON.")
+			continue
+		}
+		switch {
+		case line.CustomId == "":
+			addError(lineNo, "missing_required_parameter", "Missing required parameter: 'custom_id'.")
+			continue
+		case !strings.EqualFold(line.Method, http.MethodPost):
+			addError(lineNo, "invalid_value", "Invalid value for 'method': only POST is supported.")
+			continue
+		case line.Url != endpoint:
+			addError(lineNo, "mismatched_endpoint", fmt.Sprintf("The provided URL '%s' does not match the batch endpoint '%s'.", line.Url, endpoint))
+			continue
+		case !gjson.ValidBytes(line.Body) || !gjson.ParseBytes(line.Body).IsObject():
+			addError(lineNo, "invalid_request", "The request 'body' must be a JSON object.")
+			continue
+		case gjson.GetBytes(line.Body, "model").String() == "":
+			addError(lineNo, "missing_required_parameter", "Missing required parameter: 'body.model'.")
+			continue
+		case gjson.GetBytes(line.Body, "stream").Bool():
+			addError(lineNo, "invalid_value", "Streaming is not supported in batch requests.")
+			continue
+		}
+		if _, ok := seenIds[line.CustomId]; ok {
+			addError(lineNo, "duplicate_custom_id", fmt.Sprintf("The custom_id '%s' is duplicated.", line.CustomId))
+			continue
+		}
+		seenIds[line.CustomId] = struct{}{}
+		lines = append(lines, line)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(lines) == 0 {
+		return nil, []BatchError{{Code: "empty_file", Message: "The input file contains no requests."}}
+	}
+	if maxRequests > 0 && len(lines) > maxRequests {
+		return nil, []BatchError{{Code: "too_many_requests", Message: fmt.Sprintf("The batch contains %d requests, exceeding the limit of %d.", len(lines), maxRequests)}}
+	}
+	return lines, nil
+}
+
+// ---------------------------------------------------------------------------
+// 结果行与结果文件
+// ---------------------------------------------------------------------------
+
+func newBatchRequestId() string {
+	return "batch_req_" + common.GetRandomString(24)
+}
+
+// NewBatchOutputLine 生成结果文件中的一行，body 为上游（或网关）返回的原始响应
+func NewBatchOutputLine(customId string, statusCode int, requestId string, body []byte) []byte {
+	var responseBody any = string(body)
+	if gjson.ValidBytes(body) {
+		responseBody = json.RawMessage(body)
+	}
+	line, _ := common.Marshal(gin.H{
+		"id":        newBatchRequestId(),
+		"custom_id": customId,
+		"response": gin.H{
+			"status_code": statusCode,
+			"request_id":  requestId,
+			"body":        responseBody,
+		},
+		"error": nil,
+	})
+	return line
+}
+
+// NewBatchErrorLine 生成未能得到响应的请求（如批处理过期、被取消）的错误行
+func NewBatchErrorLine(customId string, code string, message string) []byte {
+	line, _ := common.Marshal(gin.H{
+		"id":        newBatchRequestId(),
+		"custom_id": customId,
+		"response":  nil,
+		"error": gin.H{
+			"code":    code,
+			"message": message,
+		},
+	})
+	return line
+}
+
+func batchPartKey(batch *model.Batch, index int, kind string) string {
+	return path.Join("batches", fmt.Sprintf("%d", batch.UserId), batch.BatchId, fmt.Sprintf("part-%06d.%s.jsonl", index, kind))
+}
+
+func joinJsonLines(lines [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// StoreBatchPart 持久化一个分片的成功/失败结果，分片序号 = 起始行 / BatchChunkSize
+func StoreBatchPart(ctx context.Context, batch *model.Batch, index int, outputs [][]byte, failures [][]byte) error {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return err
+	}
+	for kind, lines := range map[string][][]byte{"output": outputs, "error": failures} {
+		if len(lines) == 0 {
+			continue
+		}
+		content := joinJsonLines(lines)
+		if err := storage.Put(ctx, batchPartKey(batch, index, kind), bytes.NewReader(content), int64(len(content)), "application/jsonl"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func batchPartCount(batch *model.Batch) int {
+	return (batch.ProcessedCount() + BatchChunkSize - 1) / BatchChunkSize
+}
+
+// collectBatchParts 按顺序拼接全部分片
+func collectBatchParts(ctx context.Context, batch *model.Batch, partCount int, kind string) ([]byte, error) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for i := 0; i < partCount; i++ {
+		key := batchPartKey(batch, i, kind)
+		reader, err := storage.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, ErrStoredObjectNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		_, err = io.Copy(&buf, reader)
+		_ = reader.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DeleteBatchParts 在批处理进入终态后删除中间分片
+func DeleteBatchParts(ctx context.Context, batch *model.Batch) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return
+	}
+	for i := 0; i < batchPartCount(batch); i++ {
+		for _, kind := range []string{"output", "error"} {
+			_ = storage.Delete(ctx, batchPartKey(batch, i, kind))
+		}
+	}
+}
+
+// storeBatchResultFile 将结果保存为用户可通过 /v1/files 下载的文件
+func storeBatchResultFile(ctx context.Context, batch *model.Batch, kind string, content []byte) (string, error) {
+	if len(content) == 0 {
+		return "", nil
+	}
+	file := &model.File{
+		UserId:      batch.UserId,
+		TokenId:     batch.TokenId,
+		Filename:    fmt.Sprintf("%s_%s.jsonl", batch.BatchId, kind),
+		Purpose:     batchOutputPurpose,
+		Bytes:       int64(len(content)),
+		ContentType: "application/jsonl",
+	}
+	if days := operation_setting.GetFileSetting().DefaultExpireDays; days > 0 {
+		file.ExpiresAt = common.GetTimestamp() + int64(days)*24*3600
+	}
+	if err := StoreUserFile(ctx, file, bytes.NewReader(content)); err != nil {
+		return "", err
+	}
+	return file.FileId, nil
+}
+
+// FinalizeLocalBatchFiles 合并本地执行产生的分片，写出 output/error 文件；
+// extraFailures 为未执行的剩余行（过期或取消）对应的错误行。分片在批处理进入终态后由 DeleteBatchParts 删除，
+// 以便中途失败时可以重试。
+func FinalizeLocalBatchFiles(ctx context.Context, batch *model.Batch, extraFailures [][]byte) error {
+	partCount := batchPartCount(batch)
+	output, err := collectBatchParts(ctx, batch, partCount, "output")
+	if err != nil {
+		return err
+	}
+	failures, err := collectBatchParts(ctx, batch, partCount, "error")
+	if err != nil {
+		return err
+	}
+	failures = append(failures, joinJsonLines(extraFailures)...)
+	return storeBatchResults(ctx, batch, output, failures)
+}
+
+func storeBatchResults(ctx context.Context, batch *model.Batch, output []byte, failures []byte) error {
+	outputFileId, err := storeBatchResultFile(ctx, batch, "output", output)
+	if err != nil {
+		return err
+	}
+	errorFileId, err := storeBatchResultFile(ctx, batch, "error", failures)
+	if err != nil {
+		deleteBatchResultFile(ctx, batch, outputFileId)
+		return err
+	}
+	batch.OutputFileId = outputFileId
+	batch.ErrorFileId = errorFileId
+	return nil
+}
+
+func deleteBatchResultFile(ctx context.Context, batch *model.Batch, fileId string) {
+	if fileId == "" {
+		return
+	}
+	file, err := model.GetUserFileByFileId(batch.UserId, fileId)
+	if err == nil {
+		err = DeleteUserFile(ctx, file)
+	}
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("batch %s: failed to delete result file %s: %v", batch.BatchId, fileId, err))
+	}
+}
+
+// DiscardBatchResultFiles 删除本轮写出、但批处理未能落终态的 output/error 文件；
+// 下一轮从数据库重新读取批处理时会重新写出，避免每轮都留下一份无人引用的结果文件
+func DiscardBatchResultFiles(ctx context.Context, batch *model.Batch) {
+	deleteBatchResultFile(ctx, batch, batch.OutputFileId)
+	deleteBatchResultFile(ctx, batch, batch.ErrorFileId)
+	batch.OutputFileId = ""
+	batch.ErrorFileId = ""
+}
+
+// ---------------------------------------------------------------------------
+// 上游 Batch API
+// ---------------------------------------------------------------------------
+
+// ChannelSupportsBatchApi 支持 Files API 的 OpenAI 兼容渠道同样支持 Batch API
+func ChannelSupportsBatchApi(channel *model.Channel) bool {
+	return channelSupportsFileApi(channel)
+}
+
+// UpstreamBatchState 上游批处理的最新状态
+type UpstreamBatchState struct {
+	Status         string
+	OutputFileId   string
+	ErrorFileId    string
+	TotalCount     int
+	CompletedCount int
+	FailedCount    int
+	Errors         []BatchError
+}
+
+func readUpstreamBatchResponse(resp *http.Response) ([]byte, error) {
+	defer CloseResponseBodyGracefully(resp)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, common.LocalLogPreview(string(body)))
+	}
+	return body, nil
+}
+
+// CreateUpstreamBatch 使用已透传到上游的输入文件在上游创建批处理，返回上游批处理 id
+func CreateUpstreamBatch(ctx context.Context, channel *model.Channel, batch *model.Batch, upstreamInputFileId string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	payload := gin.H{
+		"input_file_id":     upstreamInputFileId,
+		"endpoint":          batch.Endpoint,
+		"completion_window": batch.CompletionWindow,
+	}
+	if batch.Metadata != "" {
+		payload["metadata"] = json.RawMessage(batch.Metadata)
+	}
+	data, err := common.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	resp, err := upstreamFileRequest(ctx, channel, http.MethodPost, "/v1/batches", bytes.NewReader(data), "application/json")
+	if err != nil {
+		return "", err
+	}
+	body, err := readUpstreamBatchResponse(resp)
+	if err != nil {
+		return "", err
+	}
+	upstreamId := gjson.GetBytes(body, "id").String()
+	if upstreamId == "" {
+		return "", errors.New("upstream batch response missing id")
+	}
+	return upstreamId, nil
+}
+
+func RetrieveUpstreamBatch(ctx context.Context, channel *model.Channel, upstreamBatchId string) (*UpstreamBatchState, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	resp, err := upstreamFileRequest(ctx, channel, http.MethodGet, "/v1/batches/"+upstreamBatchId, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	body, err := readUpstreamBatchResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	state := &UpstreamBatchState{
+		Status:         gjson.GetBytes(body, "status").String(),
+		OutputFileId:   gjson.GetBytes(body, "output_file_id").String(),
+		ErrorFileId:    gjson.GetBytes(body, "error_file_id").String(),
+		TotalCount:     int(gjson.GetBytes(body, "request_counts.total").Int()),
+		CompletedCount: int(gjson.GetBytes(body, "request_counts.completed").Int()),
+		FailedCount:    int(gjson.GetBytes(body, "request_counts.failed").Int()),
+	}
+	if data := gjson.GetBytes(body, "errors.data"); data.IsArray() {
+		_ = common.UnmarshalJsonStr(data.Raw, &state.Errors)
+	}
+	return state, nil
+}
+
+func CancelUpstreamBatch(ctx context.Context, channel *model.Channel, upstreamBatchId string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	resp, err := upstreamFileRequest(ctx, channel, http.MethodPost, "/v1/batches/"+upstreamBatchId+"/cancel", nil, "")
+	if err != nil {
+		return err
+	}
+	_, err = readUpstreamBatchResponse(resp)
+	return err
+}
+
+func downloadUpstreamFile(ctx context.Context, channel *model.Channel, upstreamFileId string) ([]byte, error) {
+	if upstreamFileId == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, fileUpstreamTimeout)
+	defer cancel()
+	resp, err := upstreamFileRequest(ctx, channel, http.MethodGet, "/v1/files/"+upstreamFileId+"/content", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return readUpstreamBatchResponse(resp)
+}
+
+// StoreUpstreamBatchResults 下载上游批处理的结果文件并保存为本地文件，返回 output 内容供计费使用
+func StoreUpstreamBatchResults(ctx context.Context, channel *model.Channel, batch *model.Batch, state *UpstreamBatchState) ([]byte, error) {
+	output, err := downloadUpstreamFile(ctx, channel, state.OutputFileId)
+	if err != nil {
+		return nil, fmt.Errorf("download upstream output file: %w", err)
+	}
+	failures, err := downloadUpstreamFile(ctx, channel, state.ErrorFileId)
+	if err != nil {
+		return nil, fmt.Errorf("download upstream error file: %w", err)
+	}
+	if err := storeBatchResults(ctx, batch, output, failures); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// ---------------------------------------------------------------------------
+// 上游批处理计费
+// ---------------------------------------------------------------------------
+
+// BatchModelUsage 上游批处理中某个模型的用量汇总
+type BatchModelUsage struct {
+	ModelName        string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Quota            int
+}
+
+// CalcBatchLineQuota 按模型价格/倍率、分组倍率与批处理折扣计算单个请求的额度
+func CalcBatchLineQuota(modelName string, group string, promptTokens int, completionTokens int) int {
+	groupRatio := ratio_setting.GetGroupRatio(group)
+	batchRatio := ratio_setting.GetBatchRatio(modelName)
+	var quota float64
+	if modelPrice, usePrice := ratio_setting.GetModelPrice(modelName, false); usePrice {
+		quota = modelPrice * common.QuotaPerUnit * groupRatio
+	} else {
+		modelRatio, _, _ := ratio_setting.GetModelRatio(modelName)
+		completionRatio := ratio_setting.GetCompletionRatio(modelName)
+		quota = (float64(promptTokens) + float64(completionTokens)*completionRatio) * modelRatio * groupRatio
+	}
+	quota *= batchRatio
+	if quota <= 0 {
+		return 0
+	}
+	return int(math.Ceil(quota))
+}
+
+// batchRequestedModels 输入行 custom_id 到用户请求模型的映射，计费以请求的模型为准，不信任上游响应中的模型名
+func batchRequestedModels(lines []BatchRequestLine) map[string]string {
+	models := make(map[string]string, len(lines))
+	for _, line := range lines {
+		models[line.CustomId] = gjson.GetBytes(line.Body, "model").String()
+	}
+	return models
+}
+
+// EstimateBatchQuota 按用户请求的模型估算整批额度：输入按请求体文本估算 token，输出按 max_tokens 类参数计
+func EstimateBatchQuota(lines []BatchRequestLine, group string) int {
+	total := 0
+	for _, line := range lines {
+		body := gjson.ParseBytes(line.Body)
+		modelName := body.Get("model").String()
+		promptTokens := EstimateTokenByModel(modelName, string(line.Body))
+		completionTokens := 0
+		for _, key := range []string{"max_completion_tokens", "max_tokens", "max_output_tokens"} {
+			if value := int(body.Get(key).Int()); value > 0 {
+				completionTokens = value
+				break
+			}
+		}
+		total += CalcBatchLineQuota(modelName, group, promptTokens, completionTokens)
+	}
+	return total
+}
+
+// SummarizeBatchOutputUsage 汇总上游结果文件中每个成功请求的用量，按输入行请求的模型聚合
+func SummarizeBatchOutputUsage(output []byte, lines []BatchRequestLine, group string) []*BatchModelUsage {
+	requestedModels := batchRequestedModels(lines)
+	usages := make(map[string]*BatchModelUsage)
+	var order []string
+	for _, raw := range bytes.Split(output, []byte("\n")) {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+		if gjson.GetBytes(raw, "response.status_code").Int()/100 != 2 {
+			continue
+		}
+		modelName := requestedModels[gjson.GetBytes(raw, "custom_id").String()]
+		if modelName == "" {
+			continue
+		}
+		body := gjson.GetBytes(raw, "response.body")
+		promptTokens := int(body.Get("usage.prompt_tokens").Int())
+		if promptTokens == 0 {
+			promptTokens = int(body.Get("usage.input_tokens").Int())
+		}
+		completionTokens := int(body.Get("usage.completion_tokens").Int())
+		if completionTokens == 0 {
+			completionTokens = int(body.Get("usage.output_tokens").Int())
+		}
+		usage, ok := usages[modelName]
+		if !ok {
+			usage = &BatchModelUsage{ModelName: modelName}
+			usages[modelName] = usage
+			order = append(order, modelName)
+		}
+		usage.Requests++
+		usage.PromptTokens += promptTokens
+		usage.CompletionTokens += completionTokens
+		usage.Quota += CalcBatchLineQuota(modelName, group, promptTokens, completionTokens)
+	}
+	result := make([]*BatchModelUsage, 0, len(order))
+	for _, name := range order {
+		result = append(result, usages[name])
+	}
+	return result
+}
+
+// PreConsumeUpstreamBatchQuota 提交上游前通过 BillingSession 按请求的模型预扣整批的估算额度，
+// 与在线请求一样按计费偏好选择钱包、订阅或令牌所属组织的额度池，并把资金来源记录到批处理上
+func PreConsumeUpstreamBatchQuota(c *gin.Context, batch *model.Batch, lines []BatchRequestLine) *types.NewAPIError {
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	userSetting, err := model.GetUserSetting(batch.UserId, false)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	relayInfo := &relaycommon.RelayInfo{
+		TokenId:         token.Id,
+		TokenKey:        token.Key,
+		TokenUnlimited:  token.UnlimitedQuota,
+		OrganizationId:  token.OrganizationId,
+		UserId:          batch.UserId,
+		UsingGroup:      batch.Group,
+		OriginModelName: gjson.GetBytes(lines[0].Body, "model").String(),
+		RequestId:       batch.BatchId,
+		UserSetting:     userSetting,
+		// 批处理提交后在上游长时间运行，与异步任务一样必须预扣全额
+		ForcePreConsume: true,
+	}
+	session, apiErr := NewBillingSession(c, relayInfo, EstimateBatchQuota(lines, batch.Group))
+	if apiErr != nil {
+		return apiErr
+	}
+	batch.Quota = session.GetPreConsumedQuota()
+	batch.BillingSource = relayInfo.BillingSource
+	batch.SubscriptionId = relayInfo.SubscriptionId
+	batch.OrganizationId = relayInfo.OrganizationId
+	batch.QuotaSettled = false
+	if err := batch.UpdateBilling(); err != nil {
+		session.Refund(c)
+		batch.Quota, batch.BillingSource, batch.SubscriptionId, batch.OrganizationId = 0, "", 0, 0
+		return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+	}
+	return nil
+}
+
+// batchAdjustFunding 调整批处理的资金来源与令牌额度，delta > 0 表示补扣，delta < 0 表示退还
+func batchAdjustFunding(ctx context.Context, batch *model.Batch, delta int) error {
+	var err error
+	switch {
+	case batch.BillingSource == BillingSourceOrganization && batch.OrganizationId > 0:
+		err = model.ConsumeOrganizationQuota(batch.OrganizationId, batch.UserId, delta, false)
+	case batch.BillingSource == BillingSourceSubscription && batch.SubscriptionId > 0:
+		err = model.PostConsumeUserSubscriptionDelta(batch.SubscriptionId, int64(delta))
+	case delta > 0:
+		err = model.DecreaseUserQuota(batch.UserId, delta, false)
+	default:
+		err = model.IncreaseUserQuota(batch.UserId, -delta, false)
+	}
+	if err != nil {
+		return err
+	}
+	if token, err := model.GetTokenById(batch.TokenId); err == nil {
+		if delta > 0 {
+			err = model.DecreaseTokenQuota(token.Id, token.Key, delta)
+		} else {
+			err = model.IncreaseTokenQuota(token.Id, token.Key, -delta)
+		}
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s: failed to adjust token quota (delta=%d): %s", batch.BatchId, delta, err.Error()))
+		}
+	}
+	return nil
+}
+
+// RefundUpstreamBatchQuota 上游批处理未产生结果（创建失败、失败或校验期间被取消）时退还预扣额度。
+// 先原子清零预扣额度再退款，保证多个执行器或重试只退一次
+func RefundUpstreamBatchQuota(ctx context.Context, batch *model.Batch) error {
+	quota := batch.Quota
+	if quota <= 0 || batch.QuotaSettled {
+		return nil
+	}
+	claimed, err := batch.SettleQuota(quota, 0)
+	if err != nil || !claimed {
+		return err
+	}
+	if err := batchAdjustFunding(ctx, batch, -quota); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("batch %s: failed to refund pre-consumed quota %d: %s", batch.BatchId, quota, err.Error()))
+		return err
+	}
+	model.RecordTaskBillingLog(model.RecordTaskBillingLogParams{
+		UserId:    batch.UserId,
+		LogType:   model.LogTypeRefund,
+		Content:   fmt.Sprintf("批处理 %s 未在上游完成，退还预扣额度", batch.BatchId),
+		ChannelId: batch.ChannelId,
+		Quota:     quota,
+		TokenId:   batch.TokenId,
+		Group:     batch.Group,
+		Other:     map[string]interface{}{"batch_id": batch.BatchId},
+	})
+	return nil
+}
+
+// SettleUpstreamBatchUsage 上游批处理进入终态前按实际用量与预扣额度做差额结算，每个请求模型记录一条消费日志。
+// 先原子认领结算再调整资金，执行器在结算后、落终态前退出时下一轮不会重复扣费
+func SettleUpstreamBatchUsage(c *gin.Context, batch *model.Batch, lines []BatchRequestLine, output []byte) (int, error) {
+	usages := SummarizeBatchOutputUsage(output, lines, batch.Group)
+	actual := 0
+	for _, usage := range usages {
+		actual += usage.Quota
+	}
+	if batch.QuotaSettled {
+		return batch.Quota, nil
+	}
+	preConsumed := batch.Quota
+	claimed, err := batch.SettleQuota(preConsumed, actual)
+	if err != nil || !claimed {
+		// 未认领成功说明其他执行器已结算
+		return actual, err
+	}
+	if delta := actual - preConsumed; delta != 0 {
+		if err := batchAdjustFunding(c, batch, delta); err != nil {
+			logger.LogError(c, fmt.Sprintf("batch %s: failed to settle quota delta %d: %s", batch.BatchId, delta, err.Error()))
+		}
+	}
+
+	tokenName := ""
+	if token, err := model.GetTokenById(batch.TokenId); err == nil {
+		tokenName = token.Name
+	}
+	for _, usage := range usages {
+		if usage.Quota <= 0 {
+			continue
+		}
+		model.UpdateUserUsedQuotaAndRequestCount(batch.UserId, usage.Quota)
+		model.UpdateChannelUsedQuota(batch.ChannelId, usage.Quota)
+		model.RecordConsumeLog(c, batch.UserId, model.RecordConsumeLogParams{
+			ChannelId:        batch.ChannelId,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			ModelName:        usage.ModelName,
+			TokenName:        tokenName,
+			Quota:            usage.Quota,
+			Content:          fmt.Sprintf("批处理 %s（上游执行，%d 个请求）", batch.BatchId, usage.Requests),
+			TokenId:          batch.TokenId,
+			Group:            batch.Group,
+			Other: map[string]interface{}{
+				"batch_id":           batch.BatchId,
+				"batch_ratio":        ratio_setting.GetBatchRatio(usage.ModelName),
+				"group_ratio":        ratio_setting.GetGroupRatio(batch.Group),
+				"requests":           usage.Requests,
+				"billing_source":     batch.BillingSource,
+				"pre_consumed_quota": preConsumed,
+			},
+		})
+	}
+	return actual, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestParseBatchInput(t *testing.T) {
+	content := []byte(`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}
+
+{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}
+`)
+	lines, errs := ParseBatchInput(content, "/v1/chat/completions", 0)
+	require.Empty(t, errs)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "b", lines[1].CustomId)
+	assert.Equal(t, "gpt-4o", gjson.GetBytes(lines[0].Body, "model").String())
+
+	_, errs = ParseBatchInput(content, "/v1/chat/completions", 1)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "too_many_requests", errs[0].Code)
+}
+
+func TestParseBatchInputReportsLineErrors(t *testing.T) {
+	content := []byte(`{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{"model":"m"}}
+not json
+{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"m"}}
+{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"m"}}
+{"custom_id":"c","method":"POST","url":"/v1/chat/completions","body":{"model":"m","stream":true}}`)
+	lines, errs := ParseBatchInput(content, "/v1/chat/completions", 0)
+	assert.Nil(t, lines)
+	require.Len(t, errs, 4)
+	codes := make([]string, 0, len(errs))
+	for _, e := range errs {
+		codes = append(codes, e.Code)
+	}
+	assert.Equal(t, []string{"mismatched_endpoint", "invalid_json_line", "duplicate_custom_id", "invalid_value"}, codes)
+	assert.Equal(t, 2, *errs[1].Line)
+	assert.Equal(t, 4, *errs[2].Line)
+}
+
+func TestSummarizeBatchOutputUsageAppliesBatchRatio(t *testing.T) {
+	savedPrice := ratio_setting.ModelPrice2JSONString()
+	savedBatch := ratio_setting.BatchRatio2JSONString()
+	t.Cleanup(func() {
+		require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(savedPrice))
+		require.NoError(t, ratio_setting.UpdateBatchRatioByJSONString(savedBatch))
+	})
+	require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(`{"batch-usage-model":0.01}`))
+	require.NoError(t, ratio_setting.UpdateBatchRatioByJSONString(`{"*":0.5}`))
+
+	lines := []BatchRequestLine{
+		{CustomId: "a", Body: []byte(`{"model":"batch-usage-model"}`)},
+		{CustomId: "b", Body: []byte(`{"model":"batch-usage-model"}`)},
+		{CustomId: "c", Body: []byte(`{"model":"batch-usage-model"}`)},
+	}
+	// 上游响应中的模型名不参与计费，按输入行请求的模型计价
+	output := []byte(`{"custom_id":"a","response":{"status_code":200,"body":{"model":"batch-usage-model","usage":{"prompt_tokens":10,"completion_tokens":5}}}}
+{"custom_id":"b","response":{"status_code":400,"body":{"error":{"message":"bad"}}}}
+{"custom_id":"c","response":{"status_code":200,"body":{"model":"cheap-upstream-alias","usage":{"input_tokens":3,"output_tokens":4}}}}`)
+	usages := SummarizeBatchOutputUsage(output, lines, "default")
+	require.Len(t, usages, 1)
+	usage := usages[0]
+	assert.Equal(t, 2, usage.Requests)
+	assert.Equal(t, 13, usage.PromptTokens)
+	assert.Equal(t, 9, usage.CompletionTokens)
+	perRequest := int(0.01 * common.QuotaPerUnit * ratio_setting.GetGroupRatio("default") * 0.5)
+	assert.Equal(t, 2*perRequest, usage.Quota)
+}
+
+func TestSettleUpstreamBatchUsageChargesDeltaOnce(t *testing.T) {
+	truncate(t)
+	savedPrice := ratio_setting.ModelPrice2JSONString()
+	t.Cleanup(func() {
+		require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(savedPrice))
+	})
+	require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(`{"batch-settle-model":0.01}`))
+	perRequest := CalcBatchLineQuota("batch-settle-model", "default", 0, 0)
+
+	seedUser(t, 1, 10*perRequest)
+	seedToken(t, 1, 1, "batch-settle-key", 10*perRequest)
+	batch := &model.Batch{BatchId: "batch_settle", UserId: 1, TokenId: 1, Group: "default", Status: model.BatchStatusInProgress, Mode: model.BatchModeUpstream, Quota: 3 * perRequest, BillingSource: BillingSourceWallet}
+	require.NoError(t, batch.Insert())
+
+	lines := []BatchRequestLine{
+		{CustomId: "a", Body: []byte(`{"model":"batch-settle-model"}`)},
+		{CustomId: "b", Body: []byte(`{"model":"batch-settle-model"}`)},
+		{CustomId: "c", Body: []byte(`{"model":"batch-settle-model"}`)},
+	}
+	output := []byte(`{"custom_id":"a","response":{"status_code":200,"body":{}}}
+{"custom_id":"b","response":{"status_code":500,"body":{}}}`)
+	c, _ := gin.CreateTestContext(nil)
+	quota, err := SettleUpstreamBatchUsage(c, batch, lines, output)
+	require.NoError(t, err)
+	assert.Equal(t, perRequest, quota)
+	assert.Equal(t, 12*perRequest, getUserQuota(t, 1), "the unused pre-consumed quota is returned")
+	assert.Equal(t, 12*perRequest, getTokenRemainQuota(t, 1))
+
+	// 落终态前执行器退出，下一轮从数据库重新读取批处理再次结算
+	reloaded, err := model.GetBatchById(batch.Id)
+	require.NoError(t, err)
+	_, err = SettleUpstreamBatchUsage(c, reloaded, lines, output)
+	require.NoError(t, err)
+	assert.Equal(t, 12*perRequest, getUserQuota(t, 1))
+	assert.EqualValues(t, 1, countLogs(t))
+}
+
+func TestDiscardBatchResultFilesDeletesUnsavedResults(t *testing.T) {
+	truncate(t)
+	useLocalMediaAssetStorage(t, 0)
+	ctx := context.Background()
+	batch := &model.Batch{BatchId: "batch_discard", UserId: 1, Status: model.BatchStatusFinalizing, Mode: model.BatchModeUpstream}
+
+	require.NoError(t, storeBatchResults(ctx, batch, []byte(`{"custom_id":"a"}`), []byte(`{"custom_id":"b"}`)))
+	require.NotEmpty(t, batch.OutputFileId)
+	require.NotEmpty(t, batch.ErrorFileId)
+	outputFile, err := model.GetUserFileByFileId(1, batch.OutputFileId)
+	require.NoError(t, err)
+
+	// 批处理未能落终态时删除本轮写出的结果文件，下一轮重新写出不会累积
+	DiscardBatchResultFiles(ctx, batch)
+	assert.Empty(t, batch.OutputFileId)
+	assert.Empty(t, batch.ErrorFileId)
+	var count int64
+	require.NoError(t, model.DB.Model(&model.File{}).Count(&count).Error)
+	assert.Zero(t, count)
+	_, err = OpenUserFileContent(ctx, outputFile)
+	assert.ErrorIs(t, err, ErrStoredObjectNotFound)
+}
+
+func TestNewBatchOutputLineKeepsJsonBody(t *testing.T) {
+	line := NewBatchOutputLine("a", 200, "req-1", []byte(`{"id":"chatcmpl-1"}`))
+	assert.Equal(t, "chatcmpl-1", gjson.GetBytes(line, "response.body.id").String())
+	assert.Equal(t, int64(200), gjson.GetBytes(line, "response.status_code").Int())
+	assert.True(t, gjson.GetBytes(line, "error").Type == gjson.Null)
+
+	line = NewBatchOutputLine("b", 502, "", []byte("bad gateway"))
+	assert.Equal(t, "bad gateway", gjson.GetBytes(line, "response.body").String())
+}
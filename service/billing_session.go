@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relaykit/types"
 
@@ -87,6 +89,7 @@ func (s *BillingSession) Refund(c *gin.Context) {
 	}
 	s.refunded = true
 	s.mu.Unlock()
+	prommetrics.RecordPreConsumeRefund(s.relayInfo, s.preConsumedQuota)
 
 	logger.LogInfo(c, fmt.Sprintf("用户 %d 请求失败, 返还预扣费（token_quota=%s, funding=%s）",
 		s.relayInfo.UserId,
@@ -213,6 +216,9 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 			}
 			s.tokenConsumed = 0
 		}
+		if isOrganizationQuotaError(err) {
+			return newOrganizationQuotaError(err)
+		}
 		// TODO: model 层应定义哨兵错误（如 ErrNoActiveSubscription），用 errors.Is 替代字符串匹配
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "no active subscription") || strings.Contains(errMsg, "subscription quota insufficient") {
@@ -248,6 +254,15 @@ func (s *BillingSession) reserveFunding(delta int) error {
 			)
 		}
 		return nil
+	case *OrganizationFunding:
+		if err := model.ConsumeOrganizationQuota(funding.organizationId, funding.userId, delta, true); err != nil {
+			if isOrganizationQuotaError(err) {
+				return newOrganizationQuotaError(err)
+			}
+			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+		}
+		funding.consumed += delta
+		return nil
 	default:
 		return types.NewError(fmt.Errorf("unsupported funding source: %s", s.funding.Source()), types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
 	}
@@ -265,6 +280,12 @@ func (s *BillingSession) rollbackFundingReserve(delta int) {
 		if err := model.PostConsumeUserSubscriptionDelta(funding.subscriptionId, -int64(delta)); err != nil {
 			common.SysLog("error rolling back subscription funding reserve: " + err.Error())
 		}
+	case *OrganizationFunding:
+		if err := model.ConsumeOrganizationQuota(funding.organizationId, funding.userId, -delta, false); err != nil {
+			common.SysLog("error rolling back organization funding reserve: " + err.Error())
+		} else {
+			funding.consumed -= delta
+		}
 	}
 }
 
@@ -309,6 +330,9 @@ func (s *BillingSession) shouldTrust(c *gin.Context) bool {
 		// 2. SubscriptionFunding.PreConsume 忽略参数，始终用 s.amount 预扣
 		// 3. 若信任旁路将 effectiveQuota 设为 0，会导致 preConsumedQuota 与实际订阅预扣不一致
 		return false
+	case BillingSourceOrganization:
+		// 组织额度池不能启用信任旁路，否则成员月度预算只能在结算后才生效
+		return false
 	default:
 		return false
 	}
@@ -344,6 +368,18 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return nil, types.NewError(fmt.Errorf("relayInfo is nil"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	// 组织令牌只从组织额度池扣费，不受个人计费偏好影响
+	if relayInfo.OrganizationId > 0 {
+		session := &BillingSession{
+			relayInfo: relayInfo,
+			funding:   &OrganizationFunding{organizationId: relayInfo.OrganizationId, userId: relayInfo.UserId},
+		}
+		if apiErr := session.preConsume(c, preConsumedQuota); apiErr != nil {
+			return nil, apiErr
+		}
+		return session, nil
+	}
+
 	pref := common.NormalizeBillingPreference(relayInfo.UserSetting.BillingPreference)
 
 	// 钱包路径需要先检查用户额度
@@ -440,3 +476,28 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return session, nil
 	}
 }
+
+// isOrganizationQuotaError 判断是否为组织额度池、成员预算或成员资格导致的扣费失败
+func isOrganizationQuotaError(err error) bool {
+	return errors.Is(err, model.ErrOrganizationQuotaInsufficient) ||
+		errors.Is(err, model.ErrOrganizationMemberBudgetExceeded) ||
+		errors.Is(err, model.ErrOrganizationMemberNotFound) ||
+		errors.Is(err, model.ErrOrganizationNotFound) ||
+		errors.Is(err, model.ErrOrganizationDisabled)
+}
+
+func newOrganizationQuotaError(err error) *types.NewAPIError {
+	var msg string
+	switch {
+	case errors.Is(err, model.ErrOrganizationQuotaInsufficient):
+		msg = "组织额度不足"
+	case errors.Is(err, model.ErrOrganizationMemberBudgetExceeded):
+		msg = "已超出本月组织预算"
+	case errors.Is(err, model.ErrOrganizationDisabled):
+		msg = "组织已被禁用"
+	default:
+		msg = "令牌所属组织不存在或您已不是该组织成员"
+	}
+	return types.NewErrorWithStatusCode(fmt.Errorf("%s: %w", msg, err), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+		types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 内置工具模拟：上游不支持 web_search / code_interpreter 时，网关以同名函数工具交给上游，
+// 搜索由兼容 SearXNG 的接口完成，代码在外部沙箱中执行。
+
+// 工具后端响应体读取上限
+const builtinToolMaxResponseBytes = 4 << 20
+
+var webSearchParameters = json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"The search query."}},"required":["query"]}`)
+
+var codeInterpreterParameters = json.RawMessage(`{"type":"object","properties":{"code":{"type":"string","description":"The source code to execute."}},"required":["code"]}`)
+
+// builtinToolKind 将工具 type 归一为可模拟的内置工具，兼容带日期后缀的版本，不可模拟时返回空
+func builtinToolKind(toolType string) string {
+	switch {
+	case strings.HasPrefix(toolType, dto.BuildInToolWebSearchPreview):
+		return dto.BuildInToolWebSearchPreview
+	case strings.HasPrefix(toolType, dto.BuildInToolWebSearch):
+		return dto.BuildInToolWebSearch
+	case toolType == dto.BuildInToolCodeInterpreter:
+		return dto.BuildInToolCodeInterpreter
+	}
+	return ""
+}
+
+// isBuiltinToolEmulated 判断内置工具是否已开启并配置了后端
+func isBuiltinToolEmulated(kind string) bool {
+	setting := operation_setting.GetBuiltinToolEmulationSetting()
+	switch kind {
+	case dto.BuildInToolWebSearch, dto.BuildInToolWebSearchPreview:
+		return setting.IsWebSearchAvailable()
+	case dto.BuildInToolCodeInterpreter:
+		return setting.IsCodeInterpreterAvailable()
+	}
+	return false
+}
+
+// ShouldEmulateBuiltinTools 判断当前渠道是否由网关模拟内置工具
+func ShouldEmulateBuiltinTools(info *relaycommon.RelayInfo) bool {
+	if !info.ChannelOtherSettings.BuiltinToolEmulation {
+		return false
+	}
+	setting := operation_setting.GetBuiltinToolEmulationSetting()
+	return setting.IsWebSearchAvailable() || setting.IsCodeInterpreterAvailable()
+}
+
+// SplitResponsesBuiltinTools 将 Responses 请求的 tools 拆分为可模拟的内置工具和其余工具
+func SplitResponsesBuiltinTools(items []json.RawMessage) ([]string, []json.RawMessage) {
+	var kinds []string
+	rest := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		var tool struct {
+			Type string `json:"type"`
+		}
+		if err := common.Unmarshal(item, &tool); err == nil {
+			if kind := builtinToolKind(tool.Type); kind != "" && isBuiltinToolEmulated(kind) {
+				kinds = append(kinds, kind)
+				continue
+			}
+		}
+		rest = append(rest, item)
+	}
+	return kinds, rest
+}
+
+// SplitChatBuiltinTools 将 Chat Completions 请求的 tools 拆分为可模拟的内置工具和其余工具
+func SplitChatBuiltinTools(tools []dto.ToolCallRequest) ([]string, []dto.ToolCallRequest) {
+	var kinds []string
+	rest := make([]dto.ToolCallRequest, 0, len(tools))
+	for _, tool := range tools {
+		if kind := builtinToolKind(tool.Type); kind != "" && isBuiltinToolEmulated(kind) {
+			kinds = append(kinds, kind)
+			continue
+		}
+		rest = append(rest, tool)
+	}
+	return kinds, rest
+}
+
+// AddEmulatedBuiltinTools 将模拟的内置工具加入工具集，web_search 与 web_search_preview 共用同一个函数
+func AddEmulatedBuiltinTools(toolset *ServerToolset, kinds []string) {
+	setting := operation_setting.GetBuiltinToolEmulationSetting()
+	maxRounds := setting.GetMaxToolRounds()
+	for _, kind := range kinds {
+		switch kind {
+		case dto.BuildInToolWebSearch, dto.BuildInToolWebSearchPreview:
+			toolset.Add(&ServerTool{
+				FunctionName: dto.BuildInToolWebSearch,
+				Description:  "Search the web for up-to-date information. Returns the top results with title, URL and snippet.",
+				Parameters:   webSearchParameters,
+				ItemType:     dto.BuildInCallWebSearchCall,
+				Name:         dto.BuildInToolWebSearch,
+				maxRounds:    maxRounds,
+				execute:      executeWebSearch,
+			})
+		case dto.BuildInToolCodeInterpreter:
+			toolset.Add(&ServerTool{
+				FunctionName: dto.BuildInToolCodeInterpreter,
+				Description: fmt.Sprintf("Execute %s code in a sandbox and return its stdout and stderr. "+
+					"Print the values you need; state is not kept between calls.", setting.GetSandboxLanguage()),
+				Parameters: codeInterpreterParameters,
+				ItemType:   dto.BuildInCallCodeInterpreterCall,
+				Name:       dto.BuildInToolCodeInterpreter,
+				maxRounds:  maxRounds,
+				execute:    executeCodeInterpreter,
+			})
+		}
+	}
+}
+
+type webSearchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Content string `json:"content"`
+}
+
+// executeWebSearch 调用搜索接口，成功时按 web_search_call 计费
+func executeWebSearch(ctx context.Context, info *relaycommon.RelayInfo, call *ServerToolCall) {
+	setting := operation_setting.GetBuiltinToolEmulationSetting()
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := common.UnmarshalJsonStr(call.Arguments, &args); err != nil || strings.TrimSpace(args.Query) == "" {
+		call.fail(fmt.Errorf("query is required"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, setting.GetToolTimeout())
+	defer cancel()
+
+	results, err := searchWeb(ctx, setting, args.Query)
+	if err != nil {
+		common.SysError("emulated web search failed: " + err.Error())
+		call.fail(err)
+		return
+	}
+	info.CountBillableToolCall(dto.BuildInCallWebSearchCall, "")
+	call.Output = truncateToolOutput(formatWebSearchResults(results), setting.MaxToolOutputLength)
+}
+
+func searchWeb(ctx context.Context, setting *operation_setting.BuiltinToolEmulationSetting, query string) ([]webSearchResult, error) {
+	endpoint, err := url.Parse(setting.SearchURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search url: %w", err)
+	}
+	values := endpoint.Query()
+	values.Set("q", query)
+	values.Set("format", "json")
+	endpoint.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range setting.SearchHeaders {
+		req.Header.Set(key, value)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search backend returned status %d", resp.StatusCode)
+	}
+	var body struct {
+		Results []webSearchResult `json:"results"`
+	}
+	if err := common.DecodeJson(io.LimitReader(resp.Body, builtinToolMaxResponseBytes), &body); err != nil {
+		return nil, fmt.Errorf("invalid search response: %w", err)
+	}
+	if limit := setting.GetSearchMaxResults(); len(body.Results) > limit {
+		body.Results = body.Results[:limit]
+	}
+	return body.Results, nil
+}
+
+func formatWebSearchResults(results []webSearchResult) string {
+	if len(results) == 0 {
+		return "No results found."
+	}
+	var sb strings.Builder
+	for i, result := range results {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s\nURL: %s", i+1, result.Title, result.URL))
+		if content := strings.TrimSpace(result.Content); content != "" {
+			sb.WriteString("\n" + content)
+		}
+	}
+	return sb.String()
+}
+
+// executeCodeInterpreter 在外部沙箱中执行代码，沙箱正常返回时按 code_interpreter 计费；
+// 代码本身的非零退出码作为输出交给模型，不视为工具失败
+func executeCodeInterpreter(ctx context.Context, info *relaycommon.RelayInfo, call *ServerToolCall) {
+	setting := operation_setting.GetBuiltinToolEmulationSetting()
+	var args struct {
+		Code string `json:"code"`
+	}
+	if err := common.UnmarshalJsonStr(call.Arguments, &args); err != nil || strings.TrimSpace(args.Code) == "" {
+		call.fail(fmt.Errorf("code is required"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, setting.GetToolTimeout())
+	defer cancel()
+
+	output, err := runSandboxCode(ctx, setting, args.Code)
+	if err != nil {
+		common.SysError("emulated code interpreter failed: " + err.Error())
+		call.fail(err)
+		return
+	}
+	info.CountBillableToolCall(dto.BuildInCallCodeInterpreterCall, "")
+	call.Output = truncateToolOutput(output, setting.MaxToolOutputLength)
+}
+
+func runSandboxCode(ctx context.Context, setting *operation_setting.BuiltinToolEmulationSetting, code string) (string, error) {
+	payload, err := common.Marshal(map[string]string{
+		"language": setting.GetSandboxLanguage(),
+		"code":     code,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, setting.SandboxURL, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range setting.SandboxHeaders {
+		req.Header.Set(key, value)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("sandbox returned status %d", resp.StatusCode)
+	}
+	var result struct {
+		Stdout   string `json:"stdout"`
+		Stderr   string `json:"stderr"`
+		ExitCode int    `json:"exit_code"`
+	}
+	if err := common.DecodeJson(io.LimitReader(resp.Body, builtinToolMaxResponseBytes), &result); err != nil {
+		return "", fmt.Errorf("invalid sandbox response: %w", err)
+	}
+	var sb strings.Builder
+	sb.WriteString(result.Stdout)
+	if result.Stderr != "" {
+		sb.WriteString("\n[stderr]\n" + result.Stderr)
+	}
+	if result.ExitCode != 0 {
+		sb.WriteString(fmt.Sprintf("\n[exit code %d]", result.ExitCode))
+	}
+	if strings.TrimSpace(sb.String()) == "" {
+		return "(no output)", nil
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmulatedCodeInterpreterRunsInSandbox(t *testing.T) {
+	InitHttpClient()
+	setting := operation_setting.GetBuiltinToolEmulationSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+
+	sandbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		require.NoError(t, common.DecodeJson(r.Body, &payload))
+		assert.Equal(t, "python", payload["language"])
+		assert.Equal(t, "token", r.Header.Get("X-Sandbox-Key"))
+		_, _ = w.Write([]byte(`{"stdout":"2\n","stderr":"warning","exit_code":1}`))
+	}))
+	defer sandbox.Close()
+	setting.CodeInterpreterEnabled = true
+	setting.SandboxURL = sandbox.URL
+	setting.SandboxHeaders = map[string]string{"X-Sandbox-Key": "token"}
+
+	kinds, rest := SplitChatBuiltinTools([]dto.ToolCallRequest{
+		{Type: "function", Function: dto.FunctionRequest{Name: "local"}},
+		{Type: dto.BuildInToolCodeInterpreter},
+		{Type: dto.BuildInToolWebSearch},
+	})
+	assert.Equal(t, []string{dto.BuildInToolCodeInterpreter}, kinds)
+	require.Len(t, rest, 2, "web_search stays with the upstream while its backend is not configured")
+
+	toolset := NewServerToolset()
+	AddEmulatedBuiltinTools(toolset, kinds)
+	tool := toolset.Lookup(dto.BuildInToolCodeInterpreter)
+	require.NotNil(t, tool)
+
+	info := &relaycommon.RelayInfo{}
+	call := tool.NewCall("call_1", `{"code":"print(1+1)"}`)
+	assert.Equal(t, "in_progress", call.Status())
+	tool.Execute(context.Background(), info, call)
+	assert.Equal(t, "2\n\n[stderr]\nwarning\n[exit code 1]", call.Output)
+	assert.Equal(t, "completed", call.Status())
+	assert.Equal(t, 1, info.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolCodeInterpreter].CallCount)
+
+	failed := tool.NewCall("call_2", `{}`)
+	tool.Execute(context.Background(), info, failed)
+	assert.Equal(t, "failed", failed.Status())
+	assert.Equal(t, 1, info.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolCodeInterpreter].CallCount)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ssePing 是流式保活写入的注释行，不属于响应内容
+var ssePing = []byte(": PING\n\n")
+
+// captureWriter 在转发响应的同时复制响应体，是响应缓存、响应存储与报文采集共用的底层写入器。
+// 响应体只保留前 limit 字节（<=0 表示不限），超出时标记 truncated；
+// 设置了 onLine 时，流式响应按行（不含换行符）回调，超过 limit 的行整行丢弃。
+// 保活 goroutine 与主流程会并发写入，回调在持有 mu 时执行，使用方读取回调结果时也须持有 mu
+type captureWriter struct {
+	gin.ResponseWriter
+	mu        sync.Mutex
+	limit     int
+	onLine    func(line []byte)
+	started   bool
+	stream    bool
+	total     int
+	truncated bool
+	body      bytes.Buffer
+	line      bytes.Buffer // 流式响应中尚未结束的一行
+	skipLine  bool         // 当前行超出上限，丢弃到行尾
+}
+
+// newCaptureWriter stream 为 false 时按首次写入时的 Content-Type 判断是否为 SSE 流
+func newCaptureWriter(w gin.ResponseWriter, limit int, stream bool, onLine func(line []byte)) *captureWriter {
+	return &captureWriter{ResponseWriter: w, limit: limit, stream: stream, onLine: onLine}
+}
+
+func (w *captureWriter) record(p []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if bytes.Equal(p, ssePing) {
+		return
+	}
+	if !w.started {
+		w.started = true
+		w.stream = w.stream || strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	w.total += len(p)
+	w.buffer(p)
+	if w.stream && w.onLine != nil {
+		w.splitLines(p)
+	}
+}
+
+func (w *captureWriter) buffer(p []byte) {
+	if w.limit <= 0 {
+		w.body.Write(p)
+		return
+	}
+	remain := w.limit - w.body.Len()
+	if remain >= len(p) {
+		w.body.Write(p)
+		return
+	}
+	if remain > 0 {
+		w.body.Write(p[:remain])
+	}
+	w.truncated = true
+}
+
+func (w *captureWriter) splitLines(p []byte) {
+	for len(p) > 0 {
+		idx := bytes.IndexByte(p, '\n')
+		chunk := p
+		if idx >= 0 {
+			chunk = p[:idx]
+		}
+		if !w.skipLine {
+			if w.limit > 0 && w.line.Len()+len(chunk) > w.limit {
+				w.skipLine = true
+				w.line.Reset()
+			} else {
+				w.line.Write(chunk)
+			}
+		}
+		if idx < 0 {
+			return
+		}
+		if !w.skipLine {
+			w.onLine(w.line.Bytes())
+		}
+		w.line.Reset()
+		w.skipLine = false
+		p = p[idx+1:]
+	}
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.record(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
@@ -7,8 +7,11 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type RetryParam struct {
@@ -82,6 +85,23 @@ func (p *RetryParam) ResetRetryNextTry() {
 //	Retry=3: GroupB, priority1 (startRetryIndex=2, priorityRetry=1)
 //	         分组B, 优先级1
 func CacheGetRandomSatisfiedChannel(param *RetryParam) (*model.Channel, string, error) {
+	span := tracing.StartGinSpan(param.Ctx, "channel.select",
+		attribute.String("model", param.ModelName),
+		attribute.String("token_group", param.TokenGroup),
+		attribute.Int("retry.index", param.GetRetry()),
+	)
+	channel, selectGroup, err := cacheGetRandomSatisfiedChannel(param)
+	if channel != nil {
+		// Channels with an open breaker were already skipped by the selection;
+		// a chosen half-open channel uses up one of its probe requests.
+		circuitbreaker.Admit(channel.Id, circuitbreaker.ChannelLevel)
+		span.SetAttributes(attribute.Int("channel.id", channel.Id), attribute.Int("channel.type", channel.Type), attribute.String("group", selectGroup))
+	}
+	span.End(err)
+	return channel, selectGroup, err
+}
+
+func cacheGetRandomSatisfiedChannel(param *RetryParam) (*model.Channel, string, error) {
 	var channel *model.Channel
 	var err error
 	selectGroup := param.TokenGroup
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// Anthropic Message Batches：请求内联在创建请求中，网关将其写成 /v1/messages 的批处理输入文件，
+// 之后与 /v1/batches 共用执行器逐条走正常转发链路（含批处理折扣），结果按 Anthropic 的 JSONL 格式返回。
+
+// NewClaudeMessageBatchId 生成 Message Batch id
+func NewClaudeMessageBatchId() string {
+	return "msgbatch_" + common.GetRandomString(24)
+}
+
+// ClaudeMessageBatchRequest 创建 Message Batch 时 requests 的元素
+type ClaudeMessageBatchRequest struct {
+	CustomId string          `json:"custom_id"`
+	Params   json.RawMessage `json:"params"`
+}
+
+// BuildClaudeMessageBatchInput 将内联请求转换为批处理输入 JSONL，并按批处理输入规则校验
+func BuildClaudeMessageBatchInput(requests []ClaudeMessageBatchRequest) ([]byte, int, []BatchError) {
+	lines := make([][]byte, 0, len(requests))
+	for _, request := range requests {
+		line, err := common.Marshal(BatchRequestLine{
+			CustomId: request.CustomId,
+			Method:   http.MethodPost,
+			Url:      model.BatchEndpointClaudeMessages,
+			Body:     request.Params,
+		})
+		if err != nil {
+			return nil, 0, []BatchError{{Code: "invalid_request", Message: fmt.Sprintf("requests.%d: %s", len(lines), err.Error())}}
+		}
+		lines = append(lines, line)
+	}
+	content := joinJsonLines(lines)
+	parsed, errs := ParseBatchInput(content, model.BatchEndpointClaudeMessages, operation_setting.GetBatchSetting().MaxRequestsPerBatch)
+	if len(errs) > 0 {
+		return nil, 0, errs
+	}
+	return content, len(parsed), nil
+}
+
+// StoreClaudeMessageBatchInput 保存批处理输入文件，执行器从该文件读取请求
+func StoreClaudeMessageBatchInput(ctx context.Context, batch *model.Batch, content []byte) error {
+	file := &model.File{
+		UserId:      batch.UserId,
+		TokenId:     batch.TokenId,
+		Filename:    fmt.Sprintf("%s_input.jsonl", batch.BatchId),
+		Purpose:     "batch",
+		Bytes:       int64(len(content)),
+		ContentType: "application/jsonl",
+	}
+	if days := operation_setting.GetFileSetting().DefaultExpireDays; days > 0 {
+		file.ExpiresAt = common.GetTimestamp() + int64(days)*24*3600
+	}
+	if err := StoreUserFile(ctx, file, bytes.NewReader(content)); err != nil {
+		return err
+	}
+	batch.InputFileId = file.FileId
+	return nil
+}
+
+type ClaudeMessageBatchRequestCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+// ClaudeMessageBatchObject 是 /v1/messages/batches 返回给客户端的批处理对象
+type ClaudeMessageBatchObject struct {
+	Id                string                          `json:"id"`
+	Type              string                          `json:"type"`
+	ProcessingStatus  string                          `json:"processing_status"`
+	RequestCounts     ClaudeMessageBatchRequestCounts `json:"request_counts"`
+	EndedAt           *string                         `json:"ended_at"`
+	CreatedAt         string                          `json:"created_at"`
+	ExpiresAt         string                          `json:"expires_at"`
+	ArchivedAt        *string                         `json:"archived_at"`
+	CancelInitiatedAt *string                         `json:"cancel_initiated_at"`
+	ResultsUrl        *string                         `json:"results_url"`
+}
+
+func claudeBatchTime(value int64) string {
+	return time.Unix(value, 0).UTC().Format(time.RFC3339)
+}
+
+func optionalClaudeBatchTime(value int64) *string {
+	if value == 0 {
+		return nil
+	}
+	return common.GetPointer(claudeBatchTime(value))
+}
+
+// claudeMessageBatchEndedAt 批处理进入终态的时间，未结束时为 0
+func claudeMessageBatchEndedAt(batch *model.Batch) int64 {
+	switch batch.Status {
+	case model.BatchStatusCompleted:
+		return batch.CompletedAt
+	case model.BatchStatusFailed:
+		return batch.FailedAt
+	case model.BatchStatusExpired:
+		return batch.ExpiredAt
+	case model.BatchStatusCancelled:
+		return batch.CancelledAt
+	}
+	return 0
+}
+
+func ToClaudeMessageBatchObject(batch *model.Batch) ClaudeMessageBatchObject {
+	obj := ClaudeMessageBatchObject{
+		Id:                batch.BatchId,
+		Type:              "message_batch",
+		CreatedAt:         claudeBatchTime(batch.CreatedAt),
+		ExpiresAt:         claudeBatchTime(batch.ExpiresAt),
+		CancelInitiatedAt: optionalClaudeBatchTime(batch.CancellingAt),
+		RequestCounts: ClaudeMessageBatchRequestCounts{
+			Succeeded: batch.CompletedCount,
+			Errored:   batch.FailedCount,
+		},
+	}
+	remaining := batch.TotalCount - batch.ProcessedCount()
+	if remaining < 0 {
+		remaining = 0
+	}
+	switch batch.Status {
+	case model.BatchStatusCancelling:
+		obj.ProcessingStatus = "canceling"
+		obj.RequestCounts.Processing = remaining
+	case model.BatchStatusCompleted, model.BatchStatusFailed, model.BatchStatusExpired, model.BatchStatusCancelled:
+		obj.ProcessingStatus = "ended"
+		obj.EndedAt = optionalClaudeBatchTime(claudeMessageBatchEndedAt(batch))
+		switch batch.Status {
+		case model.BatchStatusCancelled:
+			obj.RequestCounts.Canceled = remaining
+		case model.BatchStatusExpired:
+			obj.RequestCounts.Expired = remaining
+		case model.BatchStatusFailed:
+			obj.RequestCounts.Errored += remaining
+		}
+		obj.ResultsUrl = common.GetPointer(fmt.Sprintf("/v1/messages/batches/%s/results", batch.BatchId))
+	default:
+		obj.ProcessingStatus = "in_progress"
+		obj.RequestCounts.Processing = remaining
+	}
+	return obj
+}
+
+// IsClaudeMessageBatchEnded 批处理是否已结束（结果可下载、可删除）
+func IsClaudeMessageBatchEnded(batch *model.Batch) bool {
+	return claudeMessageBatchEndedAt(batch) > 0
+}
+
+// ConvertBatchResultLineToClaude 将执行器写出的结果行（OpenAI batch 格式）转换为 Anthropic 结果行
+func ConvertBatchResultLineToClaude(line []byte) ([]byte, error) {
+	if !gjson.ValidBytes(line) {
+		return nil, errors.New("invalid batch result line")
+	}
+	result := gjson.ParseBytes(line)
+	var claudeResult gin.H
+	response := result.Get("response")
+	switch {
+	case response.IsObject() && response.Get("status_code").Int()/100 == 2:
+		claudeResult = gin.H{"type": "succeeded", "message": json.RawMessage(response.Get("body").Raw)}
+	case response.IsObject():
+		body := response.Get("body")
+		errorBody := gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    "api_error",
+				"message": body.String(),
+			},
+		}
+		if body.Get("error.type").Exists() {
+			errorBody["error"] = json.RawMessage(body.Get("error").Raw)
+		}
+		claudeResult = gin.H{"type": "errored", "error": errorBody}
+	case result.Get("error.code").String() == "batch_cancelled":
+		claudeResult = gin.H{"type": "canceled"}
+	case result.Get("error.code").String() == "batch_expired":
+		claudeResult = gin.H{"type": "expired"}
+	default:
+		claudeResult = gin.H{
+			"type": "errored",
+			"error": gin.H{
+				"type": "error",
+				"error": gin.H{
+					"type":    "api_error",
+					"message": result.Get("error.message").String(),
+				},
+			},
+		}
+	}
+	return common.Marshal(gin.H{
+		"custom_id": result.Get("custom_id").String(),
+		"result":    claudeResult,
+	})
+}
+
+// ReadClaudeMessageBatchResults 读取已结束批处理的 output/error 文件并转换为 Anthropic 结果 JSONL
+func ReadClaudeMessageBatchResults(ctx context.Context, batch *model.Batch) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, fileId := range []string{batch.OutputFileId, batch.ErrorFileId} {
+		if fileId == "" {
+			continue
+		}
+		file, err := model.GetUserFileByFileId(batch.UserId, fileId)
+		if err != nil {
+			return nil, err
+		}
+		content, err := ReadUserFileContent(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range bytes.Split(content, []byte("\n")) {
+			raw = bytes.TrimSpace(raw)
+			if len(raw) == 0 {
+				continue
+			}
+			line, err := ConvertBatchResultLineToClaude(raw)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DeleteClaudeMessageBatch 删除已结束的批处理及其输入、结果文件
+func DeleteClaudeMessageBatch(ctx context.Context, batch *model.Batch) error {
+	for _, fileId := range []string{batch.InputFileId, batch.OutputFileId, batch.ErrorFileId} {
+		if fileId == "" {
+			continue
+		}
+		if file, err := model.GetUserFileByFileId(batch.UserId, fileId); err == nil {
+			if err := DeleteUserFile(ctx, file); err != nil {
+				return err
+			}
+		}
+	}
+	return model.DeleteBatchById(batch.Id)
+}
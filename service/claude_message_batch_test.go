@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestBuildClaudeMessageBatchInput(t *testing.T) {
+	content, total, errs := BuildClaudeMessageBatchInput([]ClaudeMessageBatchRequest{
+		{CustomId: "a", Params: []byte(`{"model":"claude-test","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)},
+		{CustomId: "b", Params: []byte(`{"model":"claude-test","max_tokens":16,"messages":[{"role":"user","content":"yo"}]}`)},
+	})
+	require.Empty(t, errs)
+	assert.Equal(t, 2, total)
+	lines, errs := ParseBatchInput(content, model.BatchEndpointClaudeMessages, 0)
+	require.Empty(t, errs)
+	assert.Equal(t, "/v1/messages", lines[1].Url)
+
+	_, _, errs = BuildClaudeMessageBatchInput([]ClaudeMessageBatchRequest{
+		{CustomId: "a", Params: []byte(`{"model":"claude-test"}`)},
+		{CustomId: "a", Params: []byte(`{"model":"claude-test"}`)},
+	})
+	require.Len(t, errs, 1)
+	assert.Equal(t, "duplicate_custom_id", errs[0].Code)
+	assert.Equal(t, 2, *errs[0].Line)
+}
+
+func TestConvertBatchResultLineToClaude(t *testing.T) {
+	line, err := ConvertBatchResultLineToClaude(NewBatchOutputLine("a", 200, "req", []byte(`{"id":"msg_1","type":"message"}`)))
+	require.NoError(t, err)
+	assert.Equal(t, "a", gjson.GetBytes(line, "custom_id").String())
+	assert.Equal(t, "succeeded", gjson.GetBytes(line, "result.type").String())
+	assert.Equal(t, "msg_1", gjson.GetBytes(line, "result.message.id").String())
+
+	line, err = ConvertBatchResultLineToClaude(NewBatchOutputLine("b", 400, "req", []byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`)))
+	require.NoError(t, err)
+	assert.Equal(t, "errored", gjson.GetBytes(line, "result.type").String())
+	assert.Equal(t, "invalid_request_error", gjson.GetBytes(line, "result.error.error.type").String())
+
+	line, err = ConvertBatchResultLineToClaude(NewBatchErrorLine("c", "batch_cancelled", "cancelled"))
+	require.NoError(t, err)
+	assert.Equal(t, "canceled", gjson.GetBytes(line, "result.type").String())
+
+	line, err = ConvertBatchResultLineToClaude(NewBatchErrorLine("d", "batch_expired", "expired"))
+	require.NoError(t, err)
+	assert.Equal(t, "expired", gjson.GetBytes(line, "result.type").String())
+}
+
+func TestToClaudeMessageBatchObject(t *testing.T) {
+	batch := &model.Batch{
+		BatchId:        "msgbatch_1",
+		Endpoint:       model.BatchEndpointClaudeMessages,
+		Status:         model.BatchStatusInProgress,
+		TotalCount:     5,
+		CompletedCount: 2,
+		FailedCount:    1,
+		CreatedAt:      1700000000,
+		ExpiresAt:      1700086400,
+	}
+	obj := ToClaudeMessageBatchObject(batch)
+	assert.Equal(t, "in_progress", obj.ProcessingStatus)
+	assert.Equal(t, ClaudeMessageBatchRequestCounts{Processing: 2, Succeeded: 2, Errored: 1}, obj.RequestCounts)
+	assert.Equal(t, "2023-11-14T22:13:20Z", obj.CreatedAt)
+	assert.Nil(t, obj.ResultsUrl)
+
+	batch.Status = model.BatchStatusCancelled
+	batch.CancellingAt = 1700000100
+	batch.CancelledAt = 1700000200
+	obj = ToClaudeMessageBatchObject(batch)
+	assert.Equal(t, "ended", obj.ProcessingStatus)
+	assert.Equal(t, ClaudeMessageBatchRequestCounts{Succeeded: 2, Errored: 1, Canceled: 2}, obj.RequestCounts)
+	require.NotNil(t, obj.ResultsUrl)
+	assert.Equal(t, "/v1/messages/batches/msgbatch_1/results", *obj.ResultsUrl)
+	assert.NotNil(t, obj.EndedAt)
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// ErrStoredObjectNotFound 存储后端中不存在该对象
+var ErrStoredObjectNotFound = errors.New("stored object not found")
+
+// FileStorage 是 Files API 的存储后端抽象。key 为后端内的相对路径（使用 / 分隔）。
+type FileStorage interface {
+	Type() string
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// GetFileStorage 根据当前 file_setting 构造存储后端
+func GetFileStorage() (FileStorage, error) {
+	return NewFileStorageByType(operation_setting.GetFileSetting().StorageType)
+}
+
+// NewFileStorageByType 按存储类型构造后端，用于读取历史文件时使用其上传时的存储类型
+func NewFileStorageByType(storageType string) (FileStorage, error) {
+	setting := operation_setting.GetFileSetting()
+	switch storageType {
+	case "", operation_setting.FileStorageTypeLocal:
+		dir := strings.TrimSpace(setting.LocalPath)
+		if dir == "" {
+			dir = common.GetDiskFileStoreDir()
+		}
+		return NewLocalFileStorage(dir), nil
+	case operation_setting.FileStorageTypeS3:
+		return NewS3FileStorage(S3FileStorageConfig{
+			Endpoint:        setting.S3Endpoint,
+			Region:          setting.S3Region,
+			Bucket:          setting.S3Bucket,
+			AccessKeyId:     setting.S3AccessKeyId,
+			SecretAccessKey: setting.S3AccessSecret,
+			PathPrefix:      setting.S3PathPrefix,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported file storage type: %s", storageType)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// LocalFileStorage — 本地磁盘存储
+// ---------------------------------------------------------------------------
+
+type LocalFileStorage struct {
+	root string
+}
+
+func NewLocalFileStorage(root string) *LocalFileStorage {
+	return &LocalFileStorage{root: root}
+}
+
+func (s *LocalFileStorage) Type() string { return operation_setting.FileStorageTypeLocal }
+
+// resolve 将 key 映射为 root 下的绝对路径，拒绝跳出 root 的路径
+func (s *LocalFileStorage) resolve(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" {
+		return "", errors.New("empty storage key")
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *LocalFileStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	fullPath, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	// 先写临时文件再重命名，避免读到写了一半的文件
+	tmpPath := fullPath + ".part"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create storage file: %w", err)
+	}
+	if _, err = io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write storage file: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close storage file: %w", err)
+	}
+	if err = os.Rename(tmpPath, fullPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to commit storage file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalFileStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	fullPath, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrStoredObjectNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *LocalFileStorage) Delete(ctx context.Context, key string) error {
+	fullPath, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// S3FileStorage — S3 兼容存储（AWS S3 / MinIO / R2 等），使用 path-style 访问
+// ---------------------------------------------------------------------------
+
+type S3FileStorageConfig struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyId     string
+	SecretAccessKey string
+	PathPrefix      string
+	HTTPClient      *http.Client
+}
+
+type S3FileStorage struct {
+	endpoint *url.URL
+	config   S3FileStorageConfig
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+func NewS3FileStorage(config S3FileStorageConfig) (*S3FileStorage, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %s", config.Endpoint)
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = GetHttpClient()
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3FileStorage{
+		endpoint: endpoint,
+		config:   config,
+		signer:   v4.NewSigner(),
+		client:   client,
+	}, nil
+}
+
+func (s *S3FileStorage) Type() string { return operation_setting.FileStorageTypeS3 }
+
+func (s *S3FileStorage) objectURL(key string) string {
+	objectKey := strings.TrimPrefix(path.Join(s.config.PathPrefix, key), "/")
+	u := *s.endpoint
+	u.Path = path.Join(u.Path, s.config.Bucket, objectKey)
+	return u.String()
+}
+
+func (s *S3FileStorage) do(req *http.Request) (*http.Response, error) {
+	credentials := aws.Credentials{
+		AccessKeyID:     s.config.AccessKeyId,
+		SecretAccessKey: s.config.SecretAccessKey,
+	}
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	if err := s.signer.SignHTTP(req.Context(), credentials, req, "UNSIGNED-PAYLOAD", "s3", s.config.Region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign s3 request: %w", err)
+	}
+	return s.client.Do(req)
+}
+
+func s3ResponseError(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s failed: status %d: %s", op, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func (s *S3FileStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), body)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	if resp.StatusCode/100 != 2 {
+		return s3ResponseError("put", resp)
+	}
+	return nil
+}
+
+func (s *S3FileStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		CloseResponseBodyGracefully(resp)
+		return nil, ErrStoredObjectNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		defer CloseResponseBodyGracefully(resp)
+		return nil, s3ResponseError("get", resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3FileStorage) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s3ResponseError("delete", resp)
+	}
+	return nil
+}
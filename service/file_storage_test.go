@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFileStorageRoundTrip(t *testing.T) {
+	storage := NewLocalFileStorage(t.TempDir())
+	ctx := context.Background()
+
+	require.NoError(t, storage.Put(ctx, "files/1/file-abc", strings.NewReader("hello"), 5, "text/plain"))
+	reader, err := storage.Get(ctx, "files/1/file-abc")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, reader.Close())
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	require.NoError(t, storage.Delete(ctx, "files/1/file-abc"))
+	_, err = storage.Get(ctx, "files/1/file-abc")
+	assert.ErrorIs(t, err, ErrStoredObjectNotFound)
+	// deleting a missing object is not an error
+	assert.NoError(t, storage.Delete(ctx, "files/1/file-abc"))
+}
+
+func TestLocalFileStorageRejectsTraversal(t *testing.T) {
+	root := t.TempDir()
+	storage := NewLocalFileStorage(root)
+	fullPath, err := storage.resolve("../../etc/passwd")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(fullPath, root))
+
+	_, err = storage.resolve("")
+	assert.Error(t, err)
+}
+
+// fakeS3Server is a minimal in-memory MinIO stand-in supporting path-style
+// PUT/GET/DELETE object calls.
+func fakeS3Server(t *testing.T) (*httptest.Server, map[string]string) {
+	objects := map[string]string{}
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = io.WriteString(w, body)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, objects
+}
+
+func TestS3FileStorageRoundTrip(t *testing.T) {
+	server, objects := fakeS3Server(t)
+	storage, err := NewS3FileStorage(S3FileStorageConfig{
+		Endpoint:        server.URL,
+		Bucket:          "new-api",
+		AccessKeyId:     "test-key",
+		SecretAccessKey: "test-secret",
+		PathPrefix:      "prod",
+		HTTPClient:      server.Client(),
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, storage.Put(ctx, "files/1/file-abc", strings.NewReader("{\"a\":1}"), 7, "application/jsonl"))
+	assert.Equal(t, "{\"a\":1}", objects["/new-api/prod/files/1/file-abc"])
+
+	reader, err := storage.Get(ctx, "files/1/file-abc")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	assert.Equal(t, "{\"a\":1}", string(data))
+
+	require.NoError(t, storage.Delete(ctx, "files/1/file-abc"))
+	_, err = storage.Get(ctx, "files/1/file-abc")
+	assert.ErrorIs(t, err, ErrStoredObjectNotFound)
+}
+
+func TestExtractReferencedFileIds(t *testing.T) {
+	body := []byte(`{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "summarize"},
+				{"type": "file", "file": {"file_id": "file-a"}},
+				{"type": "file", "file": {"file_id": "file-b"}}
+			]},
+			{"role": "user", "content": "plain"}
+		],
+		"input_file_id": "file-a"
+	}`)
+	assert.ElementsMatch(t, []string{"file-a", "file-b"}, ExtractReferencedFileIds(body))
+	assert.Empty(t, ExtractReferencedFileIds([]byte(`{"model":"gpt-4o","messages":[]}`)))
+}
+
+func TestFileStorageQuotaChargesOrganizationFunding(t *testing.T) {
+	truncate(t)
+	fileSetting := operation_setting.GetFileSetting()
+	previousFileSetting := *fileSetting
+	fileSetting.PricePerGB = 1024
+	t.Cleanup(func() { *fileSetting = previousFileSetting })
+
+	seedUser(t, 1, 0)
+	seedToken(t, 1, 1, "sk-files", 1000000)
+	organization, err := model.CreateOrganization("files-org", 1)
+	require.NoError(t, err)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/files", nil)
+	c.Set(string(constant.ContextKeyTokenKey), "sk-files")
+	c.Set(string(constant.ContextKeyTokenOrganizationId), organization.Id)
+
+	file := &model.File{FileId: "file-org", UserId: 1, TokenId: 1, Purpose: "batch", Bytes: 1 << 20}
+	quota := CalcFileStorageQuota(file.Bytes, "default")
+	require.Greater(t, quota, 0)
+
+	// 组织额度池不足时在写入存储之前拒绝
+	_, apiErr := PreConsumeFileStorageQuota(c, file, "default")
+	require.NotNil(t, apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+
+	require.NoError(t, model.AdjustOrganizationQuota(organization.Id, quota))
+	session, apiErr := PreConsumeFileStorageQuota(c, file, "default")
+	require.Nil(t, apiErr)
+	require.NoError(t, SettleFileStorageQuota(c, session, file, "default"))
+	assert.Equal(t, quota, file.Quota)
+	assert.Zero(t, getUserQuota(t, 1), "the wallet is not charged for an organization token")
+	assert.Equal(t, 1000000-quota, getTokenRemainQuota(t, 1))
+	reloaded, err := model.GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Zero(t, reloaded.Quota)
+	assert.EqualValues(t, 1, countLogs(t))
+}
@@ -7,12 +7,12 @@ import (
 )
 
 // ---------------------------------------------------------------------------
-// FundingSource — 资金来源接口（钱包 or 订阅）
+// FundingSource — 资金来源接口（钱包 / 订阅 / 组织）
 // ---------------------------------------------------------------------------
 
 // FundingSource 抽象了预扣费的资金来源。
 type FundingSource interface {
-	// Source 返回资金来源标识："wallet" 或 "subscription"
+	// Source 返回资金来源标识："wallet"、"subscription" 或 "organization"
 	Source() string
 	// PreConsume 从该资金来源预扣 amount 额度
 	PreConsume(amount int) error
@@ -63,6 +63,43 @@ func (w *WalletFunding) Refund() error {
 	return model.IncreaseUserQuota(w.userId, w.consumed, false)
 }
 
+// ---------------------------------------------------------------------------
+// OrganizationFunding — 组织额度池资金来源实现
+// ---------------------------------------------------------------------------
+
+// OrganizationFunding 从组织共享额度池扣费，同时计入成员当月用量。
+type OrganizationFunding struct {
+	organizationId int
+	userId         int
+	consumed       int // 实际预扣的组织额度
+}
+
+func (o *OrganizationFunding) Source() string { return BillingSourceOrganization }
+
+func (o *OrganizationFunding) PreConsume(amount int) error {
+	// amount 为 0 时也要执行，用于校验成员资格与组织状态
+	if err := model.ConsumeOrganizationQuota(o.organizationId, o.userId, max(amount, 0), true); err != nil {
+		return err
+	}
+	o.consumed = max(amount, 0)
+	return nil
+}
+
+func (o *OrganizationFunding) Settle(delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return model.ConsumeOrganizationQuota(o.organizationId, o.userId, delta, false)
+}
+
+func (o *OrganizationFunding) Refund() error {
+	if o.consumed <= 0 {
+		return nil
+	}
+	// 与钱包相同，退还是非幂等的增量操作，不能重试
+	return model.ConsumeOrganizationQuota(o.organizationId, o.userId, -o.consumed, false)
+}
+
 // ---------------------------------------------------------------------------
 // SubscriptionFunding — 订阅资金来源实现
 // ---------------------------------------------------------------------------
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/billingexpr"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/billing_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Gemini Files API 与 cachedContents：资源在上游按渠道（项目/key）隔离，网关记录每个资源的归属用户与所在渠道，
+// 引用资源的 generateContent / cachedContents 请求会被固定到同一渠道，并拒绝引用其他用户的资源。
+
+// ErrGeminiResourceNotFound 资源不存在或不属于当前用户
+var ErrGeminiResourceNotFound = errors.New("gemini resource not found")
+
+var (
+	geminiResourceNamePattern = regexp.MustCompile(`(?:^|/)(files|cachedContents)/([A-Za-z0-9_-]+)`)
+
+	// geminiResourceReferencePaths 请求体中可能引用文件 / 缓存的位置（camelCase 与 snake_case 均可）
+	geminiResourceReferencePaths = []string{
+		"cachedContent",
+		"cached_content",
+		"contents.#.parts.#.fileData.fileUri",
+		"contents.#.parts.#.file_data.file_uri",
+		"systemInstruction.parts.#.fileData.fileUri",
+		"system_instruction.parts.#.file_data.file_uri",
+	}
+)
+
+// NormalizeGeminiResourceName 将 files/xxx、cachedContents/xxx、文件 uri 或 Vertex 完整资源名统一为短名称，无法识别时返回空串。
+// gs:// 等外部 uri 不属于 Files API，忽略。
+func NormalizeGeminiResourceName(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	if strings.Contains(ref, "://") && !strings.Contains(ref, "generativelanguage.googleapis.com/") {
+		return ""
+	}
+	if idx := strings.IndexAny(ref, "?#"); idx >= 0 {
+		ref = ref[:idx]
+	}
+	match := geminiResourceNamePattern.FindStringSubmatch(ref)
+	if match == nil {
+		return ""
+	}
+	return match[1] + "/" + match[2]
+}
+
+// ExtractGeminiResourceNames 从 Gemini 请求体中提取引用的文件与缓存名称
+func ExtractGeminiResourceNames(body []byte) []string {
+	if len(body) == 0 || (!bytes.Contains(body, []byte("files/")) && !bytes.Contains(body, []byte("cachedContents/"))) {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	names := make([]string, 0)
+	var collect func(result gjson.Result)
+	collect = func(result gjson.Result) {
+		if result.IsArray() {
+			for _, item := range result.Array() {
+				collect(item)
+			}
+			return
+		}
+		if result.Type != gjson.String {
+			return
+		}
+		name := NormalizeGeminiResourceName(result.String())
+		if name == "" {
+			return
+		}
+		if _, ok := seen[name]; ok {
+			return
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	for _, p := range geminiResourceReferencePaths {
+		collect(gjson.GetBytes(body, p))
+	}
+	return names
+}
+
+// GeminiResourcePin 请求引用的资源所在的渠道与 key
+type GeminiResourcePin struct {
+	ChannelId int
+	KeyIndex  int
+}
+
+// ResolveGeminiResourcePin 校验请求引用的 Gemini 资源归属并返回其所在渠道。
+// 引用了其他用户的资源返回 ErrGeminiResourceNotFound；未经网关创建的资源名不做限制，也不固定渠道。
+func ResolveGeminiResourcePin(userId int, body []byte) (*GeminiResourcePin, error) {
+	names := ExtractGeminiResourceNames(body)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	resources, err := model.GetGeminiResourcesByNames(names)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]*model.GeminiResource, len(resources))
+	foreign := make(map[string]bool)
+	for _, resource := range resources {
+		if resource.UserId == userId && !resource.IsExpired() {
+			owned[resource.Name] = resource
+		} else {
+			foreign[resource.Name] = true
+		}
+	}
+	var pin *GeminiResourcePin
+	for _, name := range names {
+		resource, ok := owned[name]
+		if !ok {
+			if foreign[name] {
+				return nil, fmt.Errorf("%w: %s", ErrGeminiResourceNotFound, name)
+			}
+			continue
+		}
+		if pin == nil {
+			pin = &GeminiResourcePin{ChannelId: resource.ChannelId, KeyIndex: resource.KeyIndex}
+		} else if pin.ChannelId != resource.ChannelId || pin.KeyIndex != resource.KeyIndex {
+			return nil, fmt.Errorf("referenced resources %s live on different channels and cannot be used together", strings.Join(names, ", "))
+		}
+	}
+	return pin, nil
+}
+
+// GetUserGeminiResource 获取用户自己的资源，name 可以是短名称、文件 uri 或完整资源名
+func GetUserGeminiResource(userId int, kind string, name string) (*model.GeminiResource, error) {
+	normalized := NormalizeGeminiResourceName(name)
+	if normalized == "" {
+		return nil, ErrGeminiResourceNotFound
+	}
+	resource, err := model.GetUserGeminiResource(userId, kind, normalized)
+	if err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// ---------------------------------------------------------------------------
+// cachedContents 存储计费
+// ---------------------------------------------------------------------------
+
+// parseGeminiTime 解析上游返回的 RFC3339 时间（expireTime 等），失败返回 0
+func parseGeminiTime(value string) int64 {
+	if value == "" {
+		return 0
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// ApplyGeminiCachedContentObject 用上游返回的 cachedContent 对象更新资源记录（名称、token 数、过期时间、快照）
+func ApplyGeminiCachedContentObject(resource *model.GeminiResource, object []byte) {
+	result := gjson.ParseBytes(object)
+	if name := result.Get("name").String(); name != "" {
+		resource.UpstreamName = name
+		resource.Name = NormalizeGeminiResourceName(name)
+	}
+	if tokens := result.Get("usageMetadata.totalTokenCount"); tokens.Exists() {
+		resource.TokenCount = int(tokens.Int())
+	}
+	if expiresAt := parseGeminiTime(result.Get("expireTime").String()); expiresAt > 0 {
+		resource.ExpiresAt = expiresAt
+	}
+	setGeminiResourceMetadata(resource, object)
+}
+
+// ApplyGeminiFileObject 用上游返回的 file 对象更新资源记录
+func ApplyGeminiFileObject(resource *model.GeminiResource, object []byte) {
+	result := gjson.ParseBytes(object)
+	if name := result.Get("name").String(); name != "" {
+		resource.UpstreamName = name
+		resource.Name = NormalizeGeminiResourceName(name)
+	}
+	if expiresAt := parseGeminiTime(result.Get("expirationTime").String()); expiresAt > 0 {
+		resource.ExpiresAt = expiresAt
+	}
+	setGeminiResourceMetadata(resource, object)
+}
+
+// setGeminiResourceMetadata 保存返回给客户端的资源对象，name 统一为短名称（Vertex 返回带项目前缀的完整名称）
+func setGeminiResourceMetadata(resource *model.GeminiResource, object []byte) {
+	if resource.Name != "" && gjson.GetBytes(object, "name").String() != resource.Name {
+		if rewritten, err := sjson.SetBytes(object, "name", resource.Name); err == nil {
+			object = rewritten
+		}
+	}
+	resource.Metadata = string(object)
+}
+
+// CalcGeminiCacheStorageQuota 计算缓存从 BilledUntil（或当前时间）保存到 ExpiresAt 的存储费用。
+// 仅当模型使用阶梯表达式计费且表达式引用了 csh 时收费，返回额度与计费的 token·小时。
+func CalcGeminiCacheStorageQuota(resource *model.GeminiResource) (int, float64, error) {
+	start := resource.BilledUntil
+	if now := common.GetTimestamp(); start < now {
+		start = now
+	}
+	if resource.TokenCount <= 0 || resource.ExpiresAt <= start {
+		return 0, 0, nil
+	}
+	if billing_setting.GetBillingMode(resource.Model) != billing_setting.BillingModeTieredExpr {
+		return 0, 0, nil
+	}
+	exprStr, ok := billing_setting.GetBillingExpr(resource.Model)
+	if !ok || !billingexpr.UsedVars(exprStr)["csh"] {
+		return 0, 0, nil
+	}
+	tokenHours := float64(resource.TokenCount) * float64(resource.ExpiresAt-start) / 3600
+	snapshot := &billingexpr.BillingSnapshot{
+		BillingMode:  billing_setting.BillingModeTieredExpr,
+		ModelName:    resource.Model,
+		ExprString:   exprStr,
+		ExprHash:     billingexpr.ExprHashString(exprStr),
+		GroupRatio:   ratio_setting.GetGroupRatio(resource.Group),
+		QuotaPerUnit: common.QuotaPerUnit,
+		ExprVersion:  billingexpr.ExprVersion(exprStr),
+	}
+	result, err := billingexpr.ComputeTieredQuota(snapshot, billingexpr.TokenParams{CSH: tokenHours})
+	if err != nil {
+		return 0, 0, err
+	}
+	return result.ActualQuotaAfterGroup, tokenHours, nil
+}
+
+// geminiCacheDefaultTTL 未指定 expireTime / ttl 时上游的默认缓存时长
+const geminiCacheDefaultTTL = int64(3600)
+
+// geminiCacheRequestedExpiry 解析请求体中的 expireTime 或 ttl，均未指定时返回 fallback
+func geminiCacheRequestedExpiry(body []byte, fallback int64) int64 {
+	result := gjson.ParseBytes(body)
+	if expiresAt := parseGeminiTime(result.Get("expireTime").String()); expiresAt > 0 {
+		return expiresAt
+	}
+	if ttl, err := time.ParseDuration(result.Get("ttl").String()); err == nil && ttl > 0 {
+		return common.GetTimestamp() + int64(ttl/time.Second)
+	}
+	return fallback
+}
+
+// newGeminiCacheBillingSession 按当前令牌的资金来源（组织、订阅或钱包）为缓存存储创建计费会话
+func newGeminiCacheBillingSession(c *gin.Context, resource *model.GeminiResource, quota int) (*BillingSession, *types.NewAPIError) {
+	userSetting, _ := common.GetContextKeyType[dto.UserSetting](c, constant.ContextKeyUserSetting)
+	relayInfo := &relaycommon.RelayInfo{
+		TokenId:         resource.TokenId,
+		TokenKey:        common.GetContextKeyString(c, constant.ContextKeyTokenKey),
+		TokenUnlimited:  common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		OrganizationId:  common.GetContextKeyInt(c, constant.ContextKeyTokenOrganizationId),
+		UserId:          resource.UserId,
+		UsingGroup:      resource.Group,
+		OriginModelName: resource.Model,
+		RequestId:       common.GetContextKeyString(c, common.RequestIdKey),
+		UserSetting:     userSetting,
+		// 存储费用在上游创建或延长缓存前预扣全额，不允许信任旁路
+		ForcePreConsume: true,
+	}
+	return NewBillingSession(c, relayInfo, quota)
+}
+
+// PreConsumeGeminiCacheStorageQuota 在上游创建或延长缓存之前，按请求的过期时间预扣存储费用。
+// 创建时 token 数未知，按请求体估算；不产生存储费用时返回 nil 会话。
+func PreConsumeGeminiCacheStorageQuota(c *gin.Context, resource *model.GeminiResource, body []byte) (*BillingSession, *types.NewAPIError) {
+	estimate := *resource
+	fallback := resource.ExpiresAt
+	if fallback == 0 {
+		fallback = common.GetTimestamp() + geminiCacheDefaultTTL
+	}
+	estimate.ExpiresAt = geminiCacheRequestedExpiry(body, fallback)
+	if estimate.TokenCount <= 0 {
+		estimate.TokenCount = EstimateTokenByModel(resource.Model, string(body))
+	}
+	quota, _, err := CalcGeminiCacheStorageQuota(&estimate)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeModelPriceError, types.ErrOptionWithSkipRetry())
+	}
+	if quota <= 0 {
+		return nil, nil
+	}
+	return newGeminiCacheBillingSession(c, resource, quota)
+}
+
+// RefundGeminiCacheStorageQuota 上游请求失败或缓存被回滚时退还预扣的存储费用
+func RefundGeminiCacheStorageQuota(c *gin.Context, session *BillingSession) {
+	if session != nil {
+		session.Refund(c)
+	}
+}
+
+// SettleGeminiCacheStorageQuota 按上游返回的 token 数与过期时间结算存储费用，并记录消费日志。
+// 缩短或提前删除缓存不退费。
+func SettleGeminiCacheStorageQuota(c *gin.Context, session *BillingSession, resource *model.GeminiResource) error {
+	quota, tokenHours, err := CalcGeminiCacheStorageQuota(resource)
+	if err != nil {
+		return err
+	}
+	if quota > 0 && session == nil {
+		// 预估不产生费用但上游实际产生了费用，补建会话按实际额度结算
+		var apiErr *types.NewAPIError
+		if session, apiErr = newGeminiCacheBillingSession(c, resource, 0); apiErr != nil {
+			return apiErr
+		}
+	}
+	if session != nil {
+		if err := session.Settle(quota); err != nil {
+			return err
+		}
+	}
+	advanceGeminiCacheBilledUntil(resource)
+	if quota <= 0 {
+		return nil
+	}
+	resource.Quota += quota
+	model.UpdateUserUsedQuotaAndRequestCount(resource.UserId, quota)
+	model.RecordConsumeLog(c, resource.UserId, model.RecordConsumeLogParams{
+		ChannelId: resource.ChannelId,
+		ModelName: resource.Model,
+		TokenName: c.GetString("token_name"),
+		Quota:     quota,
+		Content:   fmt.Sprintf("上下文缓存存储 %s（%d tokens，%.2f 小时）", resource.Name, resource.TokenCount, tokenHours/float64(resource.TokenCount)),
+		TokenId:   resource.TokenId,
+		Group:     resource.Group,
+		Other: map[string]interface{}{
+			"cached_content":     resource.Name,
+			"cached_tokens":      resource.TokenCount,
+			"storage_token_hour": tokenHours,
+			"billing_mode":       billing_setting.BillingModeTieredExpr,
+			"billing_source":     session.relayInfo.BillingSource,
+			"group_ratio":        ratio_setting.GetGroupRatio(resource.Group),
+		},
+	})
+	return nil
+}
+
+func advanceGeminiCacheBilledUntil(resource *model.GeminiResource) {
+	if resource.ExpiresAt > resource.BilledUntil {
+		resource.BilledUntil = resource.ExpiresAt
+	}
+}
+
+// ---------------------------------------------------------------------------
+// 清理
+// ---------------------------------------------------------------------------
+
+const expiredGeminiResourceCleanupBatchSize = 500
+
+// GeminiResourceCleanupSummary 过期资源记录清理结果
+type GeminiResourceCleanupSummary struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// RunExpiredGeminiResourceCleanupOnce 分批删除已过期的资源记录（上游在过期后自行删除资源）
+func RunExpiredGeminiResourceCleanupOnce(ctx context.Context) (GeminiResourceCleanupSummary, error) {
+	summary := GeminiResourceCleanupSummary{}
+	for {
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+		deleted, err := model.DeleteExpiredGeminiResources(expiredGeminiResourceCleanupBatchSize)
+		if err != nil {
+			return summary, err
+		}
+		summary.Deleted += deleted
+		if deleted < expiredGeminiResourceCleanupBatchSize {
+			return summary, nil
+		}
+	}
+}
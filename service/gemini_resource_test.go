@@ -0,0 +1,111 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeGeminiResourceName(t *testing.T) {
+	assert.Equal(t, "files/abc-123", NormalizeGeminiResourceName("files/abc-123"))
+	assert.Equal(t, "files/abc", NormalizeGeminiResourceName("https://generativelanguage.googleapis.com/v1beta/files/abc?alt=media"))
+	assert.Equal(t, "cachedContents/xyz", NormalizeGeminiResourceName("cachedContents/xyz"))
+	assert.Equal(t, "cachedContents/42", NormalizeGeminiResourceName("projects/p/locations/us-central1/cachedContents/42"))
+	assert.Empty(t, NormalizeGeminiResourceName("gs://bucket/files/abc.pdf"))
+	assert.Empty(t, NormalizeGeminiResourceName("https://example.com/files/abc"))
+	assert.Empty(t, NormalizeGeminiResourceName("models/gemini-2.5-flash"))
+}
+
+func TestExtractGeminiResourceNames(t *testing.T) {
+	body := []byte(`{
+		"cachedContent": "cachedContents/c1",
+		"contents": [
+			{"parts": [{"text": "hi"}, {"fileData": {"fileUri": "https://generativelanguage.googleapis.com/v1beta/files/f1", "mimeType": "application/pdf"}}]},
+			{"parts": [{"file_data": {"file_uri": "files/f2"}}, {"fileData": {"fileUri": "files/f1"}}]}
+		],
+		"systemInstruction": {"parts": [{"fileData": {"fileUri": "gs://bucket/files/x"}}]}
+	}`)
+	assert.Equal(t, []string{"cachedContents/c1", "files/f1", "files/f2"}, ExtractGeminiResourceNames(body))
+	assert.Empty(t, ExtractGeminiResourceNames([]byte(`{"contents":[{"parts":[{"text":"files/ are mentioned"}]}]}`)))
+}
+
+func TestResolveGeminiResourcePin(t *testing.T) {
+	t.Cleanup(func() { model.DB.Exec("DELETE FROM gemini_resources") })
+
+	future := common.GetTimestamp() + 3600
+	for _, resource := range []*model.GeminiResource{
+		{UserId: 1, Kind: model.GeminiResourceKindFile, Name: "files/mine", ChannelId: 7, KeyIndex: 2, ExpiresAt: future},
+		{UserId: 1, Kind: model.GeminiResourceKindCachedContent, Name: "cachedContents/other-key", ChannelId: 7, KeyIndex: 0, ExpiresAt: future},
+		{UserId: 2, Kind: model.GeminiResourceKindFile, Name: "files/theirs", ChannelId: 8, ExpiresAt: future},
+	} {
+		require.NoError(t, resource.Insert())
+	}
+
+	pin, err := ResolveGeminiResourcePin(1, []byte(`{"contents":[{"parts":[{"fileData":{"fileUri":"files/mine"}}]}]}`))
+	require.NoError(t, err)
+	require.NotNil(t, pin)
+	assert.Equal(t, GeminiResourcePin{ChannelId: 7, KeyIndex: 2}, *pin)
+
+	// resources the gateway does not know about are neither pinned nor rejected
+	pin, err = ResolveGeminiResourcePin(1, []byte(`{"cachedContent":"cachedContents/unknown"}`))
+	require.NoError(t, err)
+	assert.Nil(t, pin)
+
+	_, err = ResolveGeminiResourcePin(1, []byte(`{"contents":[{"parts":[{"fileData":{"fileUri":"files/theirs"}}]}]}`))
+	assert.ErrorIs(t, err, ErrGeminiResourceNotFound)
+
+	_, err = ResolveGeminiResourcePin(1, []byte(`{"cachedContent":"cachedContents/other-key","contents":[{"parts":[{"fileData":{"fileUri":"files/mine"}}]}]}`))
+	assert.Error(t, err)
+}
+
+func TestGeminiCacheStorageQuotaChargesFundingSource(t *testing.T) {
+	truncate(t)
+	require.NoError(t, config.GlobalConfig.LoadFromDB(map[string]string{
+		"billing_setting.billing_mode": `{"gemini-cache-test":"tiered_expr"}`,
+		"billing_setting.billing_expr": `{"gemini-cache-test":"tier(\"base\", p * 1 + csh * 50)"}`,
+	}))
+	t.Cleanup(func() {
+		_ = config.GlobalConfig.LoadFromDB(map[string]string{
+			"billing_setting.billing_mode": `{}`,
+			"billing_setting.billing_expr": `{}`,
+		})
+	})
+
+	seedUser(t, 1, 10)
+	seedToken(t, 1, 1, "sk-cache", 1000000)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1beta/cachedContents", nil)
+	c.Set(string(constant.ContextKeyTokenKey), "sk-cache")
+
+	resource := &model.GeminiResource{UserId: 1, TokenId: 1, Group: "default", Kind: model.GeminiResourceKindCachedContent, Model: "gemini-cache-test", TokenCount: 10000}
+	body := []byte(`{"ttl":"7200s"}`)
+
+	// 余额不足时在请求上游之前拒绝
+	_, apiErr := PreConsumeGeminiCacheStorageQuota(c, resource, body)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, 10, getUserQuota(t, 1))
+
+	require.NoError(t, model.DB.Model(&model.User{}).Where("id = ?", 1).Update("quota", 1000000).Error)
+	// 请求的过期时间已过不产生预扣，上游实际返回的过期时间仍按资金来源结算
+	session, apiErr := PreConsumeGeminiCacheStorageQuota(c, resource, []byte(`{"expireTime":"2000-01-01T00:00:00Z"}`))
+	require.Nil(t, apiErr)
+	require.Nil(t, session)
+
+	resource.ExpiresAt = common.GetTimestamp() + 3600
+	require.NoError(t, SettleGeminiCacheStorageQuota(c, session, resource))
+	assert.Greater(t, resource.Quota, 0)
+	assert.Equal(t, 1000000-resource.Quota, getUserQuota(t, 1))
+	assert.Equal(t, 1000000-resource.Quota, getTokenRemainQuota(t, 1))
+	assert.Equal(t, resource.ExpiresAt, resource.BilledUntil)
+	assert.EqualValues(t, 1, countLogs(t))
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// ErrHedgeLost 是对冲竞争中落败的尝试写响应时返回的错误
+var ErrHedgeLost = errors.New("hedged request lost the race")
+
+// HedgeRace 是对冲请求中多个尝试之间的竞争：最先向客户端写出响应体的尝试获胜，
+// 其余尝试的输出被丢弃
+type HedgeRace struct {
+	winner atomic.Int32 // 获胜尝试的 id，0 表示尚未决出
+	won    chan struct{}
+}
+
+func NewHedgeRace() *HedgeRace {
+	return &HedgeRace{won: make(chan struct{})}
+}
+
+func (r *HedgeRace) claim(id int) bool {
+	if r.winner.CompareAndSwap(0, int32(id)) {
+		close(r.won)
+		return true
+	}
+	return r.winner.Load() == int32(id)
+}
+
+// Won 在决出获胜者后关闭
+func (r *HedgeRace) Won() <-chan struct{} {
+	return r.won
+}
+
+// Winner 返回获胜尝试的 id，尚未决出时为 0
+func (r *HedgeRace) Winner() int {
+	return int(r.winner.Load())
+}
+
+// HedgeAttempt 是参与对冲竞争的一次尝试
+type HedgeAttempt struct {
+	race *HedgeRace
+	id   int
+}
+
+// Lost 判断该尝试是否已落败
+func (a *HedgeAttempt) Lost() bool {
+	winner := a.race.Winner()
+	return winner != 0 && winner != a.id
+}
+
+// StartHedgeAttempt 让 c 上的尝试参与竞争：替换 c.Writer，在获胜前暂存响应头，获胜后才向客户端输出。
+// id 须大于 0 且在同一竞争中唯一。
+func StartHedgeAttempt(c *gin.Context, race *HedgeRace, id int) *HedgeAttempt {
+	attempt := &HedgeAttempt{race: race, id: id}
+	c.Writer = &hedgeWriter{
+		ResponseWriter: c.Writer,
+		attempt:        attempt,
+		header:         http.Header{},
+		status:         http.StatusOK,
+	}
+	common.SetContextKey(c, constant.ContextKeyHedgeAttempt, attempt)
+	return attempt
+}
+
+// HedgeAttemptLost 判断 c 上的尝试是否在对冲竞争中落败，落败的尝试不计费
+func HedgeAttemptLost(c *gin.Context) bool {
+	value, ok := common.GetContextKey(c, constant.ContextKeyHedgeAttempt)
+	if !ok {
+		return false
+	}
+	attempt, ok := value.(*HedgeAttempt)
+	return ok && attempt.Lost()
+}
+
+type hedgeWriter struct {
+	gin.ResponseWriter
+	attempt *HedgeAttempt
+	mu      sync.Mutex
+	header  http.Header
+	status  int
+	won     bool
+}
+
+// claim 在写出响应体前决定该尝试能否输出：保活注释不参与竞争，获胜前直接丢弃
+func (w *hedgeWriter) claim(p []byte) (write bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won {
+		return true, nil
+	}
+	if w.attempt.Lost() {
+		return false, ErrHedgeLost
+	}
+	if bytes.Equal(p, ssePing) {
+		return false, nil
+	}
+	if !w.attempt.race.claim(w.attempt.id) {
+		return false, ErrHedgeLost
+	}
+	w.won = true
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	return true, nil
+}
+
+func (w *hedgeWriter) Write(p []byte) (int, error) {
+	write, err := w.claim(p)
+	if err != nil {
+		return 0, err
+	}
+	if !write {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *hedgeWriter) isWon() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.won
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.isWon() {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.isWon() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.isWon() {
+		return w.ResponseWriter.Status()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.isWon() && w.ResponseWriter.Written()
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.isWon() {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.isWon() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// ChargeHedgeLoser 在 both 计费模式下对被取消的对冲渠道按预估输入 tokens 计费，并单独记录一条消费日志
+func ChargeHedgeLoser(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, channelId int) {
+	priceData := relayInfo.PriceData
+	if priceData.FreeModel {
+		return
+	}
+	groupRatio := decimal.NewFromFloat(priceData.GroupRatioInfo.GroupRatio)
+	var quotaDecimal decimal.Decimal
+	if priceData.UsePrice {
+		quotaDecimal = decimal.NewFromFloat(priceData.ModelPrice).Mul(decimal.NewFromFloat(common.QuotaPerUnit)).Mul(groupRatio)
+	} else {
+		quotaDecimal = decimal.NewFromInt(int64(relayInfo.GetEstimatePromptTokens())).Mul(decimal.NewFromFloat(priceData.ModelRatio)).Mul(groupRatio)
+	}
+	quota := int(quotaDecimal.Round(0).IntPart())
+	if quota <= 0 {
+		return
+	}
+	if err := PostConsumeQuota(relayInfo, quota, 0, false); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to charge hedged request: %s", err.Error()))
+		return
+	}
+	model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+	model.UpdateChannelUsedQuota(channelId, quota)
+
+	other := map[string]any{
+		"hedge_loser": true,
+		"model_ratio": priceData.ModelRatio,
+		"group_ratio": priceData.GroupRatioInfo.GroupRatio,
+		"model_price": priceData.ModelPrice,
+	}
+	if channelIds, ok := common.GetContextKeyType[[]int](ctx, constant.ContextKeyHedgeChannelIds); ok {
+		other["hedge_channel_ids"] = channelIds
+	}
+	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+		ChannelId:      channelId,
+		PromptTokens:   relayInfo.GetEstimatePromptTokens(),
+		ModelName:      relayInfo.OriginModelName,
+		TokenName:      ctx.GetString("token_name"),
+		Quota:          quota,
+		Content:        "Hedged request charged for the cancelled channel",
+		TokenId:        relayInfo.TokenId,
+		UseTimeSeconds: int(time.Since(relayInfo.StartTime).Seconds()),
+		IsStream:       relayInfo.IsStream,
+		Group:          relayInfo.UsingGroup,
+		Other:          other,
+	})
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedgeWriterFirstBodyWins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	base, _ := gin.CreateTestContext(recorder)
+
+	race := NewHedgeRace()
+	primary := base.Copy()
+	primary.Writer = base.Writer
+	backup := base.Copy()
+	backup.Writer = base.Writer
+	primaryAttempt := StartHedgeAttempt(primary, race, 1)
+	backupAttempt := StartHedgeAttempt(backup, race, 2)
+
+	primary.Writer.Header().Set("X-Side", "primary")
+	primary.Writer.WriteHeader(http.StatusTeapot)
+	backup.Writer.Header().Set("X-Side", "backup")
+	backup.Writer.WriteHeader(http.StatusOK)
+
+	_, err := primary.Writer.Write(ssePing)
+	require.NoError(t, err)
+	assert.Equal(t, 0, race.Winner(), "keep-alive pings do not claim the race")
+
+	_, err = backup.Writer.Write([]byte("data: backup\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, race.Winner())
+	assert.True(t, primaryAttempt.Lost())
+	assert.False(t, backupAttempt.Lost())
+	assert.True(t, HedgeAttemptLost(primary))
+
+	_, err = primary.Writer.Write([]byte("data: primary\n\n"))
+	assert.ErrorIs(t, err, ErrHedgeLost)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "backup", recorder.Header().Get("X-Side"))
+	assert.Equal(t, "data: backup\n\n", recorder.Body.String())
+}
@@ -88,6 +88,36 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if batchId := common.GetContextKeyString(ctx, constant.ContextKeyBatchId); batchId != "" {
+		other["batch_id"] = batchId
+		if relayInfo.PriceData.HasOtherRatio("batch") {
+			other["batch_ratio"] = relayInfo.PriceData.OtherRatios()["batch"]
+		}
+	}
+
+	if common.GetContextKeyBool(ctx, constant.ContextKeyResponseCacheHit) {
+		other["response_cache_hit"] = true
+		if relayInfo.PriceData.HasOtherRatio("response_cache") {
+			other["response_cache_ratio"] = relayInfo.PriceData.OtherRatios()["response_cache"]
+		}
+	}
+
+	if verdicts, ok := common.GetContextKeyType[[]ModerationVerdict](ctx, constant.ContextKeyModerationVerdicts); ok && len(verdicts) > 0 {
+		other["moderation"] = verdicts
+	}
+
+	if session := GetPIISession(ctx); session != nil {
+		other["pii_redactions"] = session.Counts()
+	}
+
+	if usage := GetPromptTemplateUsage(ctx); usage != nil {
+		other["prompt_template"] = usage
+	}
+
+	if channelIds, ok := common.GetContextKeyType[[]int](ctx, constant.ContextKeyHedgeChannelIds); ok {
+		other["hedge_channel_ids"] = channelIds
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
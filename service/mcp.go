@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/mcp"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// McpToolType 请求中远程 MCP 工具的 type
+const McpToolType = "mcp"
+
+// mcpFunctionPrefix 网关代执行时暴露给上游的函数名前缀：mcp__<server>__<tool>。
+// 同时作为工具计价名称，与 relay/common/tool_usage.go 保持一致。
+const mcpFunctionPrefix = "mcp__"
+
+// McpFunctionName 返回 MCP 工具对应的函数名
+func McpFunctionName(serverName string, toolName string) string {
+	return mcpFunctionPrefix + serverName + "__" + toolName
+}
+
+// NewMcpClient 创建访问已登记服务的客户端，附加管理员配置的认证头
+func NewMcpClient(server *model.McpServer) *mcp.Client {
+	return mcp.NewClient(server.ServerUrl, server.GetHeaders(), GetHttpClient())
+}
+
+type mcpToolsCacheEntry struct {
+	updatedTime int64
+	expiresAt   time.Time
+	tools       []mcp.Tool
+}
+
+var (
+	mcpToolsCacheMu sync.Mutex
+	mcpToolsCache   = map[int]mcpToolsCacheEntry{}
+)
+
+// ListMcpServerTools 获取服务的全部工具，按 ToolsCacheSeconds 缓存；服务配置更新后缓存失效
+func ListMcpServerTools(ctx context.Context, server *model.McpServer) ([]mcp.Tool, error) {
+	ttl := operation_setting.GetMcpSetting().GetToolsCacheTTL()
+	mcpToolsCacheMu.Lock()
+	entry, ok := mcpToolsCache[server.Id]
+	mcpToolsCacheMu.Unlock()
+	if ok && entry.updatedTime == server.UpdatedTime && time.Now().Before(entry.expiresAt) {
+		return entry.tools, nil
+	}
+
+	client := NewMcpClient(server)
+	if err := client.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	defer client.Close(context.WithoutCancel(ctx))
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		mcpToolsCacheMu.Lock()
+		mcpToolsCache[server.Id] = mcpToolsCacheEntry{updatedTime: server.UpdatedTime, expiresAt: time.Now().Add(ttl), tools: tools}
+		mcpToolsCacheMu.Unlock()
+	}
+	return tools, nil
+}
+
+// InvalidateMcpToolsCache 在服务被修改或删除后清除工具缓存
+func InvalidateMcpToolsCache(serverId int) {
+	mcpToolsCacheMu.Lock()
+	delete(mcpToolsCache, serverId)
+	mcpToolsCacheMu.Unlock()
+}
+
+// FilterMcpTools 按分组可用的工具过滤
+func FilterMcpTools(server *model.McpServer, group string, tools []mcp.Tool) []mcp.Tool {
+	filtered := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if server.AllowsTool(group, tool.Name) {
+			filtered = append(filtered, tool)
+		}
+	}
+	return filtered
+}
+
+// McpToolSpec 请求中声明的远程 MCP 工具
+type McpToolSpec struct {
+	ServerLabel  string
+	ServerUrl    string
+	AllowedTools []string
+}
+
+// parseMcpAllowedTools 解析 allowed_tools，支持字符串数组和 {"tool_names": [...]} 两种写法
+func parseMcpAllowedTools(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var names []string
+	if err := common.Unmarshal(raw, &names); err == nil {
+		return names
+	}
+	var filter struct {
+		ToolNames []string `json:"tool_names"`
+	}
+	if err := common.Unmarshal(raw, &filter); err == nil {
+		return filter.ToolNames
+	}
+	return nil
+}
+
+// SplitResponsesMcpTools 将 Responses 请求的 tools 拆分为 MCP 工具声明和其余工具
+func SplitResponsesMcpTools(tools json.RawMessage) ([]McpToolSpec, []json.RawMessage) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	var items []json.RawMessage
+	if err := common.Unmarshal(tools, &items); err != nil {
+		return nil, nil
+	}
+	var specs []McpToolSpec
+	rest := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		var tool struct {
+			Type         string          `json:"type"`
+			ServerLabel  string          `json:"server_label"`
+			ServerUrl    string          `json:"server_url"`
+			AllowedTools json.RawMessage `json:"allowed_tools"`
+		}
+		if err := common.Unmarshal(item, &tool); err != nil || tool.Type != McpToolType {
+			rest = append(rest, item)
+			continue
+		}
+		specs = append(specs, McpToolSpec{
+			ServerLabel:  tool.ServerLabel,
+			ServerUrl:    tool.ServerUrl,
+			AllowedTools: parseMcpAllowedTools(tool.AllowedTools),
+		})
+	}
+	return specs, rest
+}
+
+// SplitChatMcpTools 将 Chat Completions 请求的 tools 拆分为 MCP 工具声明和其余工具
+func SplitChatMcpTools(tools []dto.ToolCallRequest) ([]McpToolSpec, []dto.ToolCallRequest) {
+	var specs []McpToolSpec
+	rest := make([]dto.ToolCallRequest, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != McpToolType {
+			rest = append(rest, tool)
+			continue
+		}
+		specs = append(specs, McpToolSpec{
+			ServerLabel:  tool.ServerLabel,
+			ServerUrl:    tool.ServerUrl,
+			AllowedTools: parseMcpAllowedTools(tool.AllowedTools),
+		})
+	}
+	return specs, rest
+}
+
+// ShouldExecuteMcpServerSide 判断当前渠道是否由网关代执行 MCP 工具调用
+func ShouldExecuteMcpServerSide(info *relaycommon.RelayInfo) bool {
+	if !operation_setting.GetMcpSetting().ServerSideEnabled {
+		return false
+	}
+	return info.ChannelOtherSettings.McpServerSideExecution
+}
+
+// matchMcpServer 按 server_label、网关 /mcp/:name 地址或服务原始地址匹配已登记的服务
+func matchMcpServer(servers []*model.McpServer, spec McpToolSpec) *model.McpServer {
+	for _, server := range servers {
+		if spec.ServerLabel != "" && server.Name == spec.ServerLabel {
+			return server
+		}
+	}
+	if spec.ServerUrl == "" {
+		return nil
+	}
+	var path string
+	if parsed, err := url.Parse(spec.ServerUrl); err == nil {
+		path = strings.TrimSuffix(parsed.Path, "/")
+	}
+	for _, server := range servers {
+		if strings.TrimSuffix(server.ServerUrl, "/") == strings.TrimSuffix(spec.ServerUrl, "/") ||
+			strings.HasSuffix(path, "/mcp/"+server.Name) {
+			return server
+		}
+	}
+	return nil
+}
+
+// AddMcpTools 将请求中的 MCP 工具声明解析为已登记服务的工具并加入工具集；
+// 未登记或分组无权访问的服务返回错误，避免把上游无法处理的工具原样转发
+func AddMcpTools(ctx context.Context, toolset *ServerToolset, group string, specs []McpToolSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	servers, err := model.GetAllMcpServers()
+	if err != nil {
+		return err
+	}
+	maxRounds := operation_setting.GetMcpSetting().GetMaxToolRounds()
+	for _, spec := range specs {
+		server := matchMcpServer(servers, spec)
+		if server == nil {
+			return fmt.Errorf("mcp server %q is not registered", common.GetStringIfEmpty(spec.ServerLabel, spec.ServerUrl))
+		}
+		if !server.AllowsGroup(group) {
+			return fmt.Errorf("mcp server %q is not available for group %s", server.Name, group)
+		}
+		tools, err := ListMcpServerTools(ctx, server)
+		if err != nil {
+			return fmt.Errorf("failed to list tools of mcp server %q: %w", server.Name, err)
+		}
+		label := common.GetStringIfEmpty(spec.ServerLabel, server.Name)
+		for _, tool := range FilterMcpTools(server, group, tools) {
+			if len(spec.AllowedTools) > 0 && !common.StringsContains(spec.AllowedTools, tool.Name) {
+				continue
+			}
+			toolset.Add(newMcpServerTool(server, label, tool, maxRounds))
+		}
+	}
+	return nil
+}
+
+func newMcpServerTool(server *model.McpServer, label string, tool mcp.Tool, maxRounds int) *ServerTool {
+	functionName := McpFunctionName(server.Name, tool.Name)
+	return &ServerTool{
+		FunctionName: functionName,
+		Description:  tool.Description,
+		Parameters:   tool.InputSchema,
+		ItemType:     dto.BuildInCallMcpCall,
+		ServerLabel:  label,
+		Name:         tool.Name,
+		maxRounds:    maxRounds,
+		execute: func(ctx context.Context, info *relaycommon.RelayInfo, call *ServerToolCall) {
+			callMcpTool(ctx, info, server, functionName, tool.Name, call)
+		},
+	}
+}
+
+// callMcpTool 代执行一次 MCP 工具调用，服务端成功返回结果时计入工具计费
+func callMcpTool(ctx context.Context, info *relaycommon.RelayInfo, server *model.McpServer, functionName string, toolName string, call *ServerToolCall) {
+	setting := operation_setting.GetMcpSetting()
+	ctx, cancel := context.WithTimeout(ctx, setting.GetToolTimeout())
+	defer cancel()
+
+	client := NewMcpClient(server)
+	result, err := func() (*mcp.CallToolResult, error) {
+		if err := client.Initialize(ctx); err != nil {
+			return nil, err
+		}
+		defer client.Close(context.WithoutCancel(ctx))
+		return client.CallTool(ctx, toolName, json.RawMessage(call.Arguments))
+	}()
+	if err != nil {
+		var rpcErr *mcp.Error
+		if !errors.As(err, &rpcErr) {
+			common.SysError(fmt.Sprintf("mcp tool call %s failed: %s", functionName, err.Error()))
+		}
+		call.fail(err)
+		return
+	}
+	info.CountBillableToolCall(dto.BuildInCallMcpCall, functionName)
+	call.Output = truncateToolOutput(result.Text(), setting.MaxToolOutputLength)
+	if result.IsError {
+		call.Error = call.Output
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitResponsesMcpToolsAndMatchServers(t *testing.T) {
+	specs, rest := SplitResponsesMcpTools(json.RawMessage(`[
+		{"type":"function","name":"local"},
+		{"type":"mcp","server_label":"docs","allowed_tools":["read"]},
+		{"type":"mcp","server_label":"anything","server_url":"https://gw.example.com/mcp/search/","allowed_tools":{"tool_names":["query"]}}
+	]`))
+	require.Len(t, rest, 1)
+	require.Len(t, specs, 2)
+	assert.Equal(t, []string{"read"}, specs[0].AllowedTools)
+	assert.Equal(t, []string{"query"}, specs[1].AllowedTools)
+
+	servers := []*model.McpServer{
+		{Id: 1, Name: "docs", ServerUrl: "https://docs.internal/mcp"},
+		{Id: 2, Name: "search", ServerUrl: "https://search.internal/mcp"},
+	}
+	assert.Equal(t, 1, matchMcpServer(servers, specs[0]).Id)
+	assert.Equal(t, 2, matchMcpServer(servers, specs[1]).Id, "gateway /mcp/:name urls resolve to the registered server")
+	assert.Equal(t, 2, matchMcpServer(servers, McpToolSpec{ServerUrl: "https://search.internal/mcp/"}).Id)
+	assert.Nil(t, matchMcpServer(servers, McpToolSpec{ServerLabel: "other", ServerUrl: "https://other.example.com/mcp"}))
+}
+
+func TestMcpServerGroupToolAccess(t *testing.T) {
+	server := &model.McpServer{Status: model.McpServerStatusEnabled, GroupTools: `{"vip":["*"],"*":["read"],"blocked":[]}`}
+	assert.True(t, server.AllowsTool("vip", "write"))
+	assert.True(t, server.AllowsTool("default", "read"))
+	assert.False(t, server.AllowsTool("default", "write"))
+	assert.False(t, server.AllowsGroup("blocked"))
+
+	open := &model.McpServer{Status: model.McpServerStatusEnabled}
+	assert.True(t, open.AllowsTool("default", "write"), "servers without group config are open to every group")
+	open.Status = model.McpServerStatusDisabled
+	assert.False(t, open.AllowsGroup("default"))
+}
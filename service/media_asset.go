@@ -0,0 +1,468 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel/task/taskcommon"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	mediaAssetCleanupBatchSize  = 100
+	mediaAssetEvictionBatchSize = 20
+)
+
+// MediaAssetOwner 资源归属：存储上限按用户计算，存储费用从生成请求的资金来源（组织、订阅或钱包）与令牌额度扣除
+type MediaAssetOwner struct {
+	UserId         int
+	TokenId        int
+	Group          string
+	BillingSource  string // 为空时按钱包扣费
+	SubscriptionId int
+	OrganizationId int
+}
+
+// MediaAssetOwnerFromTask 按任务的归属与计费来源构造资源归属
+func MediaAssetOwnerFromTask(task *model.Task) MediaAssetOwner {
+	return MediaAssetOwner{
+		UserId:         task.UserId,
+		TokenId:        task.PrivateData.TokenId,
+		Group:          task.Group,
+		BillingSource:  task.PrivateData.BillingSource,
+		SubscriptionId: task.PrivateData.SubscriptionId,
+		OrganizationId: task.PrivateData.OrganizationId,
+	}
+}
+
+// NewMediaAssetId 生成网关资源 id
+func NewMediaAssetId() string {
+	return "asset-" + common.GetRandomString(24)
+}
+
+func mediaAssetStorageKey(userId int, assetId string) string {
+	return path.Join("assets", fmt.Sprintf("%d", userId), assetId)
+}
+
+func mediaAssetSign(assetId string, expires int64) string {
+	return common.GenerateHMAC(fmt.Sprintf("media_asset:%s:%d", assetId, expires))
+}
+
+// BuildMediaAssetURL 生成资源的网关签名地址，有效期由 url_expire_seconds 决定
+func BuildMediaAssetURL(assetId string) string {
+	expires := common.GetTimestamp() + int64(operation_setting.GetMediaAssetSetting().GetURLExpireSeconds())
+	return fmt.Sprintf("%s/v1/assets/%s?expires=%d&sign=%s", strings.TrimRight(system_setting.ServerAddress, "/"), assetId, expires, mediaAssetSign(assetId, expires))
+}
+
+// VerifyMediaAssetSign 校验签名地址，已过期或签名不符时返回 false
+func VerifyMediaAssetSign(assetId string, expires int64, sign string) bool {
+	if assetId == "" || sign == "" || expires < common.GetTimestamp() {
+		return false
+	}
+	return hmac.Equal([]byte(mediaAssetSign(assetId, expires)), []byte(sign))
+}
+
+// CalcMediaAssetStorageQuota 计算保存资源应扣除的额度：按 GB 单价 × 分组倍率，不足 1 的额度向上取整
+func CalcMediaAssetStorageQuota(size int64, group string) int {
+	price := operation_setting.GetMediaAssetSetting().PricePerGB
+	if price <= 0 || size <= 0 {
+		return 0
+	}
+	gb := float64(size) / float64(1<<30)
+	quota := gb * price * common.QuotaPerUnit * ratio_setting.GetGroupRatio(group)
+	return int(math.Ceil(quota))
+}
+
+// checkMediaAssetCapacity 单个资源超过用户存储上限时拒绝保存
+func checkMediaAssetCapacity(size int64) error {
+	limit := operation_setting.GetMediaAssetSetting().GetUserStorageLimitBytes()
+	if limit > 0 && size > limit {
+		return fmt.Errorf("asset size %s exceeds user storage limit %s", common.Bytes2Size(size), common.Bytes2Size(limit))
+	}
+	return nil
+}
+
+// evictMediaAssetsOverLimit 新资源扣费成功后，若用户存储超出上限，按创建顺序淘汰该用户最早的其他资源。
+// 淘汰放在扣费之后，扣费失败时不会删除用户已有的资源
+func evictMediaAssetsOverLimit(ctx context.Context, keep *model.MediaAsset) error {
+	limit := operation_setting.GetMediaAssetSetting().GetUserStorageLimitBytes()
+	if limit <= 0 {
+		return nil
+	}
+	used, err := model.SumUserMediaAssetBytes(keep.UserId)
+	if err != nil {
+		return err
+	}
+	for used > limit {
+		assets, err := model.GetOldestUserMediaAssets(keep.UserId, mediaAssetEvictionBatchSize)
+		if err != nil {
+			return err
+		}
+		evicted := 0
+		for _, asset := range assets {
+			if asset.Id == keep.Id {
+				continue
+			}
+			if err := DeleteMediaAsset(ctx, asset); err != nil {
+				return err
+			}
+			evicted++
+			used -= asset.Bytes
+			if used <= limit {
+				break
+			}
+		}
+		if evicted == 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// StoreMediaAsset 把内容写入存储后端并落库。超出单个资源大小上限或资金来源不足以支付存储费用时返回错误
+// （已写入的内容会被删除），调用方应保留上游原始地址
+func StoreMediaAsset(ctx context.Context, owner MediaAssetOwner, source string, sourceId string, contentType string, body io.Reader) (*model.MediaAsset, error) {
+	return storeMediaAsset(ctx, owner, nil, source, sourceId, contentType, body)
+}
+
+// storeMediaAsset reserved 非空时把内容写入已预留的资源记录，失败时记录保持预留状态
+func storeMediaAsset(ctx context.Context, owner MediaAssetOwner, reserved *model.MediaAsset, source string, sourceId string, contentType string, body io.Reader) (*model.MediaAsset, error) {
+	setting := operation_setting.GetMediaAssetSetting()
+	maxSize := setting.GetMaxAssetSizeBytes()
+
+	// 先落到临时文件得到准确大小，S3 上传需要 Content-Length
+	tmp, err := os.CreateTemp("", "new-api-asset-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	size, err := io.Copy(tmp, io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset content: %w", err)
+	}
+	if size > maxSize {
+		return nil, fmt.Errorf("asset size exceeds limit %s", common.Bytes2Size(maxSize))
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("asset content is empty")
+	}
+	if contentType == "" || contentType == "application/octet-stream" {
+		head := make([]byte, 512)
+		n, _ := tmp.ReadAt(head, 0)
+		contentType = http.DetectContentType(head[:n])
+	}
+
+	quota := CalcMediaAssetStorageQuota(size, owner.Group)
+	if quota > 0 && owner.isWallet() {
+		userQuota, err := model.GetUserQuota(owner.UserId, false)
+		if err != nil {
+			return nil, err
+		}
+		if userQuota < quota {
+			return nil, fmt.Errorf("user quota is not enough, need %s", logger.FormatQuota(quota))
+		}
+	}
+	if err := checkMediaAssetCapacity(size); err != nil {
+		return nil, err
+	}
+
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	asset := reserved
+	if asset == nil {
+		asset = newMediaAsset(owner, source, sourceId)
+	}
+	asset.ContentType = contentType
+	asset.Bytes = size
+	asset.StorageType = storage.Type()
+	asset.Quota = quota
+	asset.StorageKey = mediaAssetStorageKey(asset.UserId, asset.AssetId)
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := storage.Put(ctx, asset.StorageKey, tmp, size, contentType); err != nil {
+		return nil, err
+	}
+	if reserved == nil {
+		err = asset.Insert()
+	} else if completed, completeErr := asset.Complete(); completeErr != nil {
+		err = completeErr
+	} else if !completed {
+		err = fmt.Errorf("reserved asset %s no longer exists", asset.AssetId)
+	}
+	if err != nil {
+		_ = storage.Delete(ctx, asset.StorageKey)
+		return nil, err
+	}
+	if err := chargeMediaAssetQuota(ctx, owner, asset); err != nil {
+		if reserved == nil {
+			_ = DeleteMediaAsset(ctx, asset)
+		} else {
+			_ = storage.Delete(ctx, asset.StorageKey)
+			if resetErr := asset.ResetToPending(); resetErr != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("failed to reset asset %s: %v", asset.AssetId, resetErr))
+			}
+		}
+		return nil, fmt.Errorf("failed to charge asset storage: %w", err)
+	}
+	if err := evictMediaAssetsOverLimit(ctx, asset); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to evict assets of user %d: %v", asset.UserId, err))
+	}
+	return asset, nil
+}
+
+// newMediaAsset 生成新的资源记录，过期时间按 retention_days 计算
+func newMediaAsset(owner MediaAssetOwner, source string, sourceId string) *model.MediaAsset {
+	asset := &model.MediaAsset{
+		AssetId:  NewMediaAssetId(),
+		UserId:   owner.UserId,
+		TokenId:  owner.TokenId,
+		Source:   source,
+		SourceId: sourceId,
+	}
+	if retentionDays := operation_setting.GetMediaAssetSetting().RetentionDays; retentionDays > 0 {
+		asset.ExpiresAt = common.GetTimestamp() + int64(retentionDays)*24*3600
+	}
+	return asset
+}
+
+func (owner MediaAssetOwner) isWallet() bool {
+	return !owner.isOrganization() && !owner.isSubscription()
+}
+
+func (owner MediaAssetOwner) isOrganization() bool {
+	return owner.BillingSource == BillingSourceOrganization && owner.OrganizationId > 0
+}
+
+func (owner MediaAssetOwner) isSubscription() bool {
+	return owner.BillingSource == BillingSourceSubscription && owner.SubscriptionId > 0
+}
+
+// chargeMediaAssetFunding 从资源归属的资金来源扣除存储费用，组织额度或订阅额度不足时返回错误
+func chargeMediaAssetFunding(owner MediaAssetOwner, quota int) error {
+	switch {
+	case owner.isOrganization():
+		return model.ConsumeOrganizationQuota(owner.OrganizationId, owner.UserId, quota, false)
+	case owner.isSubscription():
+		return model.PostConsumeUserSubscriptionDelta(owner.SubscriptionId, int64(quota))
+	default:
+		return model.DecreaseUserQuota(owner.UserId, quota, false)
+	}
+}
+
+// chargeMediaAssetQuota 按资源大小扣除资金来源与令牌额度，并记录消费日志
+func chargeMediaAssetQuota(ctx context.Context, owner MediaAssetOwner, asset *model.MediaAsset) error {
+	if asset.Quota <= 0 {
+		return nil
+	}
+	if err := chargeMediaAssetFunding(owner, asset.Quota); err != nil {
+		return err
+	}
+	if owner.TokenId > 0 {
+		if tokenKey := resolveTokenKey(ctx, owner.TokenId, asset.SourceId); tokenKey != "" {
+			if err := model.DecreaseTokenQuota(owner.TokenId, tokenKey, asset.Quota); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("failed to decrease token quota for asset %s: %s", asset.AssetId, err.Error()))
+			}
+		}
+	}
+	model.UpdateUserUsedQuotaAndRequestCount(owner.UserId, asset.Quota)
+	model.RecordTaskBillingLog(model.RecordTaskBillingLogParams{
+		UserId:    owner.UserId,
+		LogType:   model.LogTypeConsume,
+		Content:   fmt.Sprintf("生成结果存储 %s（%s）", asset.AssetId, common.Bytes2Size(asset.Bytes)),
+		ModelName: "media_assets",
+		Quota:     asset.Quota,
+		TokenId:   owner.TokenId,
+		Group:     owner.Group,
+		Other: map[string]interface{}{
+			"asset_id":       asset.AssetId,
+			"asset_bytes":    asset.Bytes,
+			"asset_source":   asset.Source,
+			"source_id":      asset.SourceId,
+			"billing_source": owner.BillingSource,
+			"price_per_gb":   operation_setting.GetMediaAssetSetting().PricePerGB,
+			"group_ratio":    ratio_setting.GetGroupRatio(owner.Group),
+		},
+	})
+	return nil
+}
+
+// OpenMediaAssetContent 打开资源内容
+func OpenMediaAssetContent(ctx context.Context, asset *model.MediaAsset) (io.ReadCloser, error) {
+	if asset.IsPending() {
+		return nil, fmt.Errorf("asset %s is not stored yet", asset.AssetId)
+	}
+	storage, err := NewFileStorageByType(asset.StorageType)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Get(ctx, asset.StorageKey)
+}
+
+// DeleteMediaAsset 删除资源记录与存储内容
+func DeleteMediaAsset(ctx context.Context, asset *model.MediaAsset) error {
+	if err := model.DeleteMediaAssetById(asset.Id); err != nil {
+		return err
+	}
+	if asset.IsPending() {
+		return nil
+	}
+	storage, err := NewFileStorageByType(asset.StorageType)
+	if err == nil {
+		err = storage.Delete(ctx, asset.StorageKey)
+	}
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to delete stored asset %s: %v", asset.AssetId, err))
+	}
+	return nil
+}
+
+// downloadMediaAsset 通过 DoDownloadRequest 下载上游结果（遵循 Worker 与 SSRF 配置）
+func downloadMediaAsset(sourceURL string) (*http.Response, error) {
+	resp, err := DoDownloadRequest(sourceURL, "media asset")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		CloseResponseBodyGracefully(resp)
+		return nil, fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func isDownloadableMediaURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "https://")
+}
+
+// PersistTaskResultAsset 任务成功后把结果保存到网关存储。资源 id 在调用时同步预留并记录到任务上，
+// 因此随后发出的成功回调已携带网关地址；内容在后台下载，保存完成前或失败时网关地址回退到上游结果地址。
+// 需在 NotifyTaskChanged 之前调用。只处理上游直链；需要经网关代理取内容的任务（OpenAI、Sora、Gemini、Vertex 等）
+// 仍由 VideoProxy 实时转发
+func PersistTaskResultAsset(task *model.Task) {
+	if task == nil || !operation_setting.IsVideoAssetStoreEnabled() || task.Status != model.TaskStatusSuccess || task.PrivateData.AssetId != "" {
+		return
+	}
+	resultURL := task.PrivateData.ResultURL
+	if !isDownloadableMediaURL(resultURL) || resultURL == taskcommon.BuildProxyURL(task.TaskID) {
+		return
+	}
+	owner := MediaAssetOwnerFromTask(task)
+	reserved := newMediaAsset(owner, model.MediaAssetSourceTask, task.TaskID)
+	if err := reserved.Insert(); err != nil {
+		common.SysError(fmt.Sprintf("failed to reserve asset for task %s: %v", task.TaskID, err))
+		return
+	}
+	task.PrivateData.AssetId = reserved.AssetId
+	if err := task.UpdatePrivateData(); err != nil {
+		common.SysError(fmt.Sprintf("failed to record asset %s on task %s: %v", reserved.AssetId, task.TaskID, err))
+		task.PrivateData.AssetId = ""
+		_ = model.DeleteMediaAssetById(reserved.Id)
+		return
+	}
+	gopool.Go(func() {
+		ctx := context.Background()
+		resp, err := downloadMediaAsset(resultURL)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to download result of task %s: %v", reserved.SourceId, err))
+			return
+		}
+		defer CloseResponseBodyGracefully(resp)
+		if _, err := storeMediaAsset(ctx, owner, reserved, model.MediaAssetSourceTask, reserved.SourceId, resp.Header.Get("Content-Type"), resp.Body); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to store result of task %s: %v", reserved.SourceId, err))
+		}
+	})
+}
+
+// PersistImageResponseAssets 把图片生成响应 data[] 中的 url / b64_json 结果保存到网关存储，
+// 并把每张图片的 url 改写为网关签名地址（b64_json 原样保留）。保存失败的图片保留上游内容
+func PersistImageResponseAssets(ctx context.Context, owner MediaAssetOwner, requestId string, body []byte) []byte {
+	items := gjson.GetBytes(body, "data")
+	if !items.IsArray() {
+		return body
+	}
+	for i, item := range items.Array() {
+		asset, err := storeImageResponseItem(ctx, owner, requestId, item)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to store generated image %d: %v", i, err))
+			continue
+		}
+		if asset == nil {
+			continue
+		}
+		if updated, err := sjson.SetBytes(body, fmt.Sprintf("data.%d.url", i), BuildMediaAssetURL(asset.AssetId)); err == nil {
+			body = updated
+		}
+	}
+	return body
+}
+
+func storeImageResponseItem(ctx context.Context, owner MediaAssetOwner, requestId string, item gjson.Result) (*model.MediaAsset, error) {
+	if b64 := item.Get("b64_json").String(); b64 != "" {
+		data, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, err
+		}
+		return StoreMediaAsset(ctx, owner, model.MediaAssetSourceImage, requestId, "", bytes.NewReader(data))
+	}
+	imageURL := item.Get("url").String()
+	if !isDownloadableMediaURL(imageURL) {
+		return nil, nil
+	}
+	resp, err := downloadMediaAsset(imageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	return StoreMediaAsset(ctx, owner, model.MediaAssetSourceImage, requestId, resp.Header.Get("Content-Type"), resp.Body)
+}
+
+// MediaAssetCleanupSummary 过期资源清理结果
+type MediaAssetCleanupSummary struct {
+	Deleted int `json:"deleted"`
+}
+
+// RunExpiredMediaAssetCleanupOnce 分批删除已过期的资源
+func RunExpiredMediaAssetCleanupOnce(ctx context.Context) (MediaAssetCleanupSummary, error) {
+	summary := MediaAssetCleanupSummary{}
+	for {
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+		assets, err := model.GetExpiredMediaAssets(mediaAssetCleanupBatchSize)
+		if err != nil {
+			return summary, err
+		}
+		for _, asset := range assets {
+			if err := DeleteMediaAsset(ctx, asset); err != nil {
+				return summary, err
+			}
+			summary.Deleted++
+		}
+		if len(assets) < mediaAssetCleanupBatchSize {
+			return summary, nil
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func useLocalMediaAssetStorage(t *testing.T, userLimitMB int) {
+	t.Helper()
+	fileSetting := operation_setting.GetFileSetting()
+	previousFileSetting := *fileSetting
+	fileSetting.StorageType = operation_setting.FileStorageTypeLocal
+	fileSetting.LocalPath = t.TempDir()
+	assetSetting := operation_setting.GetMediaAssetSetting()
+	previousAssetSetting := *assetSetting
+	assetSetting.Enabled = true
+	assetSetting.UserStorageLimitMB = userLimitMB
+	t.Cleanup(func() {
+		*fileSetting = previousFileSetting
+		*assetSetting = previousAssetSetting
+	})
+}
+
+func TestMediaAssetSign(t *testing.T) {
+	url := BuildMediaAssetURL("asset-abc")
+	assert.Contains(t, url, "/v1/assets/asset-abc?expires=")
+
+	expires := int64(4102444800) // 2100-01-01
+	sign := mediaAssetSign("asset-abc", expires)
+	assert.True(t, VerifyMediaAssetSign("asset-abc", expires, sign))
+	assert.False(t, VerifyMediaAssetSign("asset-other", expires, sign))
+	assert.False(t, VerifyMediaAssetSign("asset-abc", expires+1, sign))
+	assert.False(t, VerifyMediaAssetSign("asset-abc", 1, mediaAssetSign("asset-abc", 1)), "expired urls are rejected")
+}
+
+func TestStoreMediaAssetEvictsOldestOverUserLimit(t *testing.T) {
+	truncate(t)
+	useLocalMediaAssetStorage(t, 1)
+	ctx := context.Background()
+	owner := MediaAssetOwner{UserId: 1}
+	chunk := strings.Repeat("a", 400<<10)
+
+	first, err := StoreMediaAsset(ctx, owner, model.MediaAssetSourceImage, "req-1", "image/png", strings.NewReader(chunk))
+	require.NoError(t, err)
+	second, err := StoreMediaAsset(ctx, owner, model.MediaAssetSourceImage, "req-2", "image/png", strings.NewReader(chunk))
+	require.NoError(t, err)
+	third, err := StoreMediaAsset(ctx, owner, model.MediaAssetSourceImage, "req-3", "image/png", strings.NewReader(chunk))
+	require.NoError(t, err)
+
+	_, exist, err := model.GetMediaAssetByAssetId(first.AssetId)
+	require.NoError(t, err)
+	assert.False(t, exist, "oldest asset is evicted to stay under the limit")
+	for _, asset := range []*model.MediaAsset{second, third} {
+		stored, exist, err := model.GetMediaAssetByAssetId(asset.AssetId)
+		require.NoError(t, err)
+		require.True(t, exist)
+		reader, err := OpenMediaAssetContent(ctx, stored)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		assert.Len(t, data, len(chunk))
+	}
+
+	_, err = StoreMediaAsset(ctx, owner, model.MediaAssetSourceImage, "req-4", "image/png", strings.NewReader(strings.Repeat("a", 2<<20)))
+	assert.Error(t, err, "a single asset larger than the user limit is rejected")
+}
+
+func TestPersistImageResponseAssets(t *testing.T) {
+	truncate(t)
+	useLocalMediaAssetStorage(t, 0)
+	png := []byte("\x89PNG\r\n\x1a\nfake image")
+	body := []byte(`{"created":1,"data":[{"b64_json":"` + base64.StdEncoding.EncodeToString(png) + `"},{"revised_prompt":"no image"}]}`)
+
+	rewritten := PersistImageResponseAssets(context.Background(), MediaAssetOwner{UserId: 1}, "req-img", body)
+
+	assetURL := gjson.GetBytes(rewritten, "data.0.url").String()
+	assert.Contains(t, assetURL, "/v1/assets/asset-")
+	assert.NotEmpty(t, gjson.GetBytes(rewritten, "data.0.b64_json").String(), "b64_json is kept for the client")
+	assert.False(t, gjson.GetBytes(rewritten, "data.1.url").Exists())
+
+	var asset model.MediaAsset
+	require.NoError(t, model.DB.Where("source_id = ?", "req-img").First(&asset).Error)
+	assert.Equal(t, "image/png", asset.ContentType)
+	assert.Equal(t, int64(len(png)), asset.Bytes)
+}
+
+func TestStoreMediaAssetChargesTaskFundingSource(t *testing.T) {
+	truncate(t)
+	useLocalMediaAssetStorage(t, 0)
+	operation_setting.GetMediaAssetSetting().PricePerGB = 1024
+	ctx := context.Background()
+	seedUser(t, 1, 0)
+	chunk := strings.Repeat("a", 1<<20)
+	quota := CalcMediaAssetStorageQuota(int64(len(chunk)), "default")
+	require.Greater(t, quota, 0)
+	seedSubscription(t, 1, 1, int64(quota)+1, 0)
+
+	task := &model.Task{TaskID: "task_asset", UserId: 1, Group: "default"}
+	task.PrivateData.BillingSource = BillingSourceSubscription
+	task.PrivateData.SubscriptionId = 1
+	owner := MediaAssetOwnerFromTask(task)
+
+	asset, err := StoreMediaAsset(ctx, owner, model.MediaAssetSourceTask, task.TaskID, "video/mp4", strings.NewReader(chunk))
+	require.NoError(t, err)
+	assert.Equal(t, quota, asset.Quota)
+	assert.Equal(t, int64(quota), getSubscriptionUsed(t, 1))
+	assert.Zero(t, getUserQuota(t, 1), "the wallet is not charged for a subscription-funded task")
+
+	_, err = StoreMediaAsset(ctx, owner, model.MediaAssetSourceTask, task.TaskID, "video/mp4", strings.NewReader(chunk))
+	require.Error(t, err, "an exhausted subscription cannot pay for another asset")
+	var count int64
+	require.NoError(t, model.DB.Model(&model.MediaAsset{}).Count(&count).Error)
+	assert.EqualValues(t, 1, count, "the unpaid asset is deleted")
+	assert.Equal(t, int64(quota), getSubscriptionUsed(t, 1))
+}
+
+func TestStoreMediaAssetKeepsExistingAssetsWhenChargeFails(t *testing.T) {
+	truncate(t)
+	useLocalMediaAssetStorage(t, 1)
+	operation_setting.GetMediaAssetSetting().PricePerGB = 1024
+	ctx := context.Background()
+	seedUser(t, 1, 0)
+	chunk := strings.Repeat("a", 600<<10)
+	quota := CalcMediaAssetStorageQuota(int64(len(chunk)), "default")
+	seedSubscription(t, 1, 1, int64(quota)+1, 0)
+
+	task := &model.Task{TaskID: "task_evict", UserId: 1, Group: "default"}
+	task.PrivateData.BillingSource = BillingSourceSubscription
+	task.PrivateData.SubscriptionId = 1
+	owner := MediaAssetOwnerFromTask(task)
+	first, err := StoreMediaAsset(ctx, owner, model.MediaAssetSourceTask, task.TaskID, "video/mp4", strings.NewReader(chunk))
+	require.NoError(t, err)
+
+	// 第二个资源超出存储上限且订阅额度不足，扣费失败时不淘汰已有资源
+	_, err = StoreMediaAsset(ctx, owner, model.MediaAssetSourceTask, task.TaskID, "video/mp4", strings.NewReader(chunk))
+	require.Error(t, err)
+	stored, exist, err := model.GetMediaAssetByAssetId(first.AssetId)
+	require.NoError(t, err)
+	require.True(t, exist, "an unpaid asset does not evict existing ones")
+	reader, err := OpenMediaAssetContent(ctx, stored)
+	require.NoError(t, err)
+	reader.Close()
+}
+
+func TestPersistTaskResultAssetReservesIdBeforeDownload(t *testing.T) {
+	truncate(t)
+	useLocalMediaAssetStorage(t, 0)
+	operation_setting.GetMediaAssetSetting().StoreVideos = true
+	ctx := context.Background()
+
+	task := seedPollingTask(t, 1, "task_asset_reserve", "upstream_reserve")
+	task.Status = model.TaskStatusSuccess
+	task.PrivateData.ResultURL = "https://cdn.example.invalid/video.mp4"
+	PersistTaskResultAsset(task)
+
+	// 资源 id 在返回前已记录到任务上，随后发出的成功回调可直接携带网关地址
+	require.NotEmpty(t, task.PrivateData.AssetId)
+	var reloaded model.Task
+	require.NoError(t, model.DB.First(&reloaded, task.ID).Error)
+	assert.Equal(t, task.PrivateData.AssetId, reloaded.PrivateData.AssetId)
+	reserved, exist, err := model.GetMediaAssetByAssetId(task.PrivateData.AssetId)
+	require.NoError(t, err)
+	require.True(t, exist)
+	assert.True(t, reserved.IsPending())
+	_, err = OpenMediaAssetContent(ctx, reserved)
+	assert.Error(t, err, "a pending asset has no content yet")
+
+	stored, err := storeMediaAsset(ctx, MediaAssetOwnerFromTask(task), reserved, model.MediaAssetSourceTask, task.TaskID, "video/mp4", strings.NewReader("video"))
+	require.NoError(t, err)
+	assert.Equal(t, task.PrivateData.AssetId, stored.AssetId)
+	completed, exist, err := model.GetMediaAssetByAssetId(stored.AssetId)
+	require.NoError(t, err)
+	require.True(t, exist)
+	assert.False(t, completed.IsPending())
+	assert.EqualValues(t, len("video"), completed.Bytes)
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审核阶段
+const (
+	ModerationStagePrompt     = "prompt"
+	ModerationStageCompletion = "completion"
+)
+
+// moderationMaxRecordedMatches 限制写入日志的命中内容数量
+const moderationMaxRecordedMatches = 10
+
+// ModerationFinding 是审核提供者的一次命中结果。Matches 为原文中命中的片段，
+// 为空表示提供者无法定位命中位置（例如审核渠道），此时 redact 退化为 block。
+type ModerationFinding struct {
+	Provider   string
+	Categories []string
+	Matches    []string
+}
+
+// ModerationProvider 内容审核提供者
+type ModerationProvider interface {
+	Name() string
+	// Local 表示不依赖外部服务，可以在流式输出时逐段调用
+	Local() bool
+	// Check 未命中时返回 nil
+	Check(c *gin.Context, text string) (*ModerationFinding, error)
+}
+
+// ModerationVerdict 记录在日志 Other 字段中的审核结果
+type ModerationVerdict struct {
+	Stage      string   `json:"stage"`
+	Action     string   `json:"action"`
+	Provider   string   `json:"provider"`
+	Categories []string `json:"categories,omitempty"`
+	Matches    []string `json:"matches,omitempty"`
+}
+
+var (
+	moderationProvidersMu sync.RWMutex
+	moderationProviders   = map[string]ModerationProvider{}
+)
+
+// RegisterModerationProvider 注册审核提供者，同名提供者会被覆盖
+func RegisterModerationProvider(provider ModerationProvider) {
+	moderationProvidersMu.Lock()
+	defer moderationProvidersMu.Unlock()
+	moderationProviders[provider.Name()] = provider
+}
+
+func getModerationProvider(name string) (ModerationProvider, bool) {
+	moderationProvidersMu.RLock()
+	defer moderationProvidersMu.RUnlock()
+	provider, ok := moderationProviders[name]
+	return provider, ok
+}
+
+func init() {
+	RegisterModerationProvider(keywordModerationProvider{})
+	RegisterModerationProvider(regexModerationProvider{})
+}
+
+// keywordModerationProvider 使用系统设置中的敏感词列表
+type keywordModerationProvider struct{}
+
+func (keywordModerationProvider) Name() string {
+	return operation_setting.ModerationProviderKeyword
+}
+
+func (keywordModerationProvider) Local() bool {
+	return true
+}
+
+func (keywordModerationProvider) Check(_ *gin.Context, text string) (*ModerationFinding, error) {
+	if len(setting.SensitiveWords) == 0 || text == "" {
+		return nil, nil
+	}
+	found, words := AcSearch(strings.ToLower(text), setting.SensitiveWords, false)
+	if !found {
+		return nil, nil
+	}
+	return &ModerationFinding{
+		Provider:   operation_setting.ModerationProviderKeyword,
+		Categories: []string{"keyword"},
+		Matches:    uniqueStrings(words),
+	}, nil
+}
+
+// regexModerationProvider 使用审核设置中的正则规则
+type regexModerationProvider struct{}
+
+func (regexModerationProvider) Name() string {
+	return operation_setting.ModerationProviderRegex
+}
+
+func (regexModerationProvider) Local() bool {
+	return true
+}
+
+func (regexModerationProvider) Check(_ *gin.Context, text string) (*ModerationFinding, error) {
+	if text == "" {
+		return nil, nil
+	}
+	var finding *ModerationFinding
+	for _, rule := range operation_setting.GetModerationSetting().RegexRules {
+		re := compileSettingRegex(rule.Pattern)
+		if re == nil {
+			continue
+		}
+		matches := re.FindAllString(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if finding == nil {
+			finding = &ModerationFinding{Provider: operation_setting.ModerationProviderRegex}
+		}
+		category := rule.Category
+		if category == "" {
+			category = rule.Name
+		}
+		if category != "" {
+			finding.Categories = append(finding.Categories, category)
+		}
+		finding.Matches = append(finding.Matches, matches...)
+	}
+	if finding != nil {
+		finding.Categories = uniqueStrings(finding.Categories)
+		finding.Matches = uniqueStrings(finding.Matches)
+	}
+	return finding, nil
+}
+
+var settingRegexCache sync.Map // pattern -> *regexp.Regexp，无效规则缓存为 nil
+
+func compileSettingRegex(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	if cached, ok := settingRegexCache.Load(pattern); ok {
+		re, _ := cached.(*regexp.Regexp)
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		common.SysError(fmt.Sprintf("invalid regex %q: %s", pattern, err.Error()))
+		settingRegexCache.Store(pattern, (*regexp.Regexp)(nil))
+		return nil
+	}
+	settingRegexCache.Store(pattern, re)
+	return re
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
+
+// ResolveModerationPolicy 返回当前请求生效的审核策略。未开启审核时沿用旧的敏感词检查：
+// 仅检查请求，命中即拒绝。
+func ResolveModerationPolicy(c *gin.Context, group string) (operation_setting.ModerationPolicy, bool) {
+	tokenAction := common.GetContextKeyString(c, constant.ContextKeyTokenModeration)
+	if policy, ok := operation_setting.ResolveModerationPolicy(group, tokenAction); ok || operation_setting.GetModerationSetting().Enabled {
+		return policy, ok
+	}
+	if !setting.ShouldCheckPromptSensitive() {
+		return operation_setting.ModerationPolicy{}, false
+	}
+	return operation_setting.ModerationPolicy{
+		Action:    operation_setting.ModerationActionBlock,
+		Prompt:    true,
+		Providers: []string{operation_setting.ModerationProviderKeyword},
+	}, true
+}
+
+// ShouldModeratePrompt 判断请求内容是否需要审核
+func ShouldModeratePrompt(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	policy, ok := ResolveModerationPolicy(c, info.UsingGroup)
+	return ok && policy.Prompt
+}
+
+// runModerationProviders 依次调用策略中的提供者，localOnly 时跳过依赖外部服务的提供者
+func runModerationProviders(c *gin.Context, policy operation_setting.ModerationPolicy, text string, localOnly bool) ([]*ModerationFinding, error) {
+	var findings []*ModerationFinding
+	for _, name := range policy.Providers {
+		provider, ok := getModerationProvider(name)
+		if !ok || (localOnly && !provider.Local()) {
+			continue
+		}
+		finding, err := provider.Check(c, text)
+		if err != nil {
+			if provider.Local() || !operation_setting.GetModerationSetting().LLMFailOpen {
+				return findings, fmt.Errorf("moderation provider %s failed: %w", name, err)
+			}
+			logger.LogWarn(c, fmt.Sprintf("moderation provider %s failed, skipped: %s", name, err.Error()))
+			continue
+		}
+		if finding != nil {
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// recordModerationVerdicts 将审核结果追加到上下文，结算时写入日志
+func recordModerationVerdicts(c *gin.Context, stage string, action string, findings []*ModerationFinding) {
+	verdicts, _ := common.GetContextKeyType[[]ModerationVerdict](c, constant.ContextKeyModerationVerdicts)
+	for _, finding := range findings {
+		matches := finding.Matches
+		if len(matches) > moderationMaxRecordedMatches {
+			matches = matches[:moderationMaxRecordedMatches]
+		}
+		verdicts = append(verdicts, ModerationVerdict{
+			Stage:      stage,
+			Action:     action,
+			Provider:   finding.Provider,
+			Categories: finding.Categories,
+			Matches:    matches,
+		})
+	}
+	common.SetContextKey(c, constant.ContextKeyModerationVerdicts, verdicts)
+}
+
+func moderationMatches(findings []*ModerationFinding) ([]string, bool) {
+	var matches []string
+	for _, finding := range findings {
+		if len(finding.Matches) == 0 {
+			return nil, false
+		}
+		matches = append(matches, finding.Matches...)
+	}
+	return uniqueStrings(matches), true
+}
+
+func moderationBlockedError(findings []*ModerationFinding) *types.NewAPIError {
+	var categories []string
+	for _, finding := range findings {
+		categories = append(categories, finding.Categories...)
+	}
+	err := errors.New("content blocked by moderation")
+	if categories = uniqueStrings(categories); len(categories) > 0 {
+		err = fmt.Errorf("content blocked by moderation: %s", strings.Join(categories, ", "))
+	}
+	return types.NewErrorWithStatusCode(err, types.ErrorCodeSensitiveWordsDetected, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+// ModeratePrompt 审核请求内容。block 返回错误；redact 改写请求体并重新解析到 request；
+// flag 只记录结果。text 为请求中的全部文本。
+func ModeratePrompt(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request, text string) *types.NewAPIError {
+	policy, ok := ResolveModerationPolicy(c, info.UsingGroup)
+	if !ok || !policy.Prompt || text == "" {
+		return nil
+	}
+	findings, err := runModerationProviders(c, policy, text, false)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeSensitiveWordsDetected, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	action := policy.Action
+	if action == operation_setting.ModerationActionRedact {
+		matches, ok := moderationMatches(findings)
+		if !ok {
+			action = operation_setting.ModerationActionBlock
+		} else if err := redactRequestBody(c, request, matches); err != nil {
+			logger.LogWarn(c, "moderation redact failed, request blocked: "+err.Error())
+			action = operation_setting.ModerationActionBlock
+		}
+	}
+	recordModerationVerdicts(c, ModerationStagePrompt, action, findings)
+	if action == operation_setting.ModerationActionBlock {
+		logger.LogWarn(c, fmt.Sprintf("prompt blocked by moderation, user %d", info.UserId))
+		return moderationBlockedError(findings)
+	}
+	return nil
+}
+
+// moderationMask 返回替换命中内容使用的文本
+func moderationMask() string {
+	if mask := operation_setting.GetModerationSetting().RedactMask; mask != "" {
+		return mask
+	}
+	return "**###**"
+}
+
+// buildRedactRegexp 将命中片段组合成忽略大小写的正则，较长的片段优先匹配
+func buildRedactRegexp(matches []string) *regexp.Regexp {
+	sorted := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if match != "" {
+			sorted = append(sorted, regexp.QuoteMeta(match))
+		}
+	}
+	if len(sorted) == 0 {
+		return nil
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	return regexp.MustCompile("(?i)" + strings.Join(sorted, "|"))
+}
+
+// RedactModerationText 将文本中的命中片段替换为掩码
+func RedactModerationText(text string, matches []string) string {
+	re := buildRedactRegexp(matches)
+	if re == nil {
+		return text
+	}
+	return re.ReplaceAllLiteralString(text, moderationMask())
+}
+
+func jsonEscapedString(value string) string {
+	encoded, err := common.Marshal(value)
+	if err != nil || len(encoded) < 2 {
+		return ""
+	}
+	return string(encoded[1 : len(encoded)-1])
+}
+
+// moderationRedactor 将命中片段替换为掩码，实现 textRedactor
+type moderationRedactor struct {
+	re    *regexp.Regexp
+	mask  string
+	count int
+}
+
+func (r *moderationRedactor) Redact(text string) string {
+	return r.re.ReplaceAllStringFunc(text, func(string) string {
+		r.count++
+		return r.mask
+	})
+}
+
+func (r *moderationRedactor) total() int {
+	return r.count
+}
+
+// redactRequestBody 只替换解析后请求中文本字段的命中片段（与 PII 脱敏相同的遍历），再用替换后的请求重写请求体，
+// 模型名、工具定义、图片地址等其他字段保持不变
+func redactRequestBody(c *gin.Context, request dto.Request, matches []string) error {
+	re := buildRedactRegexp(matches)
+	if re == nil {
+		return errors.New("no redactable content")
+	}
+	redactor := &moderationRedactor{re: re, mask: moderationMask()}
+	if err := redactRequestDTO(redactor, request); err != nil {
+		return err
+	}
+	if redactor.total() == 0 {
+		return errors.New("no redactable content")
+	}
+	if apiErr := replaceRequestBodyStorage(c, request); apiErr != nil {
+		return apiErr.Err
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moderationStreamTailRunes 已输出文本保留的长度，用于发现跨越输出边界的命中
+const moderationStreamTailRunes = 128
+
+// ModerationStreamGuard 审核流式输出：替换 c.Writer，将 SSE 事件暂存在长度为
+// setting.StreamCacheQueueLength 的回看队列中，每收到一段文本就审核已输出的尾部与队列中的文本，
+// 按策略截断输出、替换命中内容或只记录结果。
+type ModerationStreamGuard struct {
+	gin.ResponseWriter
+	c          *gin.Context
+	policy     operation_setting.ModerationPolicy
+	format     types.RelayFormat
+	lookBehind int
+
+	mu       sync.Mutex
+	pending  []byte
+	queue    []*sseTextEvent
+	tail     string
+	chunk    map[string]any
+	recorded map[string]bool
+	blocked  bool
+	finished bool
+	err      error
+}
+
+// StartModerationStream 为流式请求开启输出审核，策略未要求审核输出时返回 nil。
+// 返回值为 nil 时 Finish 和 Blocked 依然可以调用。
+func StartModerationStream(c *gin.Context, info *relaycommon.RelayInfo) *ModerationStreamGuard {
+	if !info.IsStream {
+		return nil
+	}
+	policy, ok := ResolveModerationPolicy(c, info.UsingGroup)
+	if !ok || !policy.Completion {
+		return nil
+	}
+	lookBehind := setting.StreamCacheQueueLength
+	if lookBehind < 0 {
+		lookBehind = 0
+	}
+	guard := &ModerationStreamGuard{
+		ResponseWriter: c.Writer,
+		c:              c,
+		policy:         policy,
+		format:         info.RelayFormat,
+		lookBehind:     lookBehind,
+		recorded:       map[string]bool{},
+	}
+	c.Writer = guard
+	return guard
+}
+
+// Blocked 判断输出是否已被审核截断
+func (g *ModerationStreamGuard) Blocked() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.blocked
+}
+
+// Finish 输出队列中剩余的事件并恢复原始 Writer，可重复调用
+func (g *ModerationStreamGuard) Finish() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.finished {
+		return
+	}
+	g.finished = true
+	if !g.blocked {
+		for len(g.queue) > 0 {
+			g.flushOne()
+		}
+		if len(g.pending) > 0 {
+			g.writeThrough(g.pending)
+		}
+	}
+	g.pending = nil
+	g.c.Writer = g.ResponseWriter
+}
+
+func (g *ModerationStreamGuard) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// 保活注释不经过审核，也不会被截断
+	if g.finished || bytes.Equal(p, ssePing) {
+		return g.ResponseWriter.Write(p)
+	}
+	if g.blocked {
+		return len(p), nil
+	}
+	g.pending = splitSSEEvents(append(g.pending, p...), g.handleEvent)
+	if g.err != nil {
+		return 0, g.err
+	}
+	return len(p), nil
+}
+
+func (g *ModerationStreamGuard) WriteString(s string) (int, error) {
+	return g.Write([]byte(s))
+}
+
+func (g *ModerationStreamGuard) handleEvent(raw []byte) {
+	if g.blocked {
+		return
+	}
+	event := parseSSETextEvent(raw, g.format)
+	if event.payload != nil && g.chunk == nil && g.format != types.RelayFormatClaude {
+		g.chunk = event.payload
+	}
+	g.queue = append(g.queue, event)
+	if event.hasText {
+		g.check()
+	}
+	if g.blocked {
+		return
+	}
+	for len(g.queue) > g.lookBehind {
+		g.flushOne()
+	}
+}
+
+// check 审核已输出的尾部与队列中的文本
+func (g *ModerationStreamGuard) check() {
+	var builder strings.Builder
+	builder.WriteString(g.tail)
+	for _, event := range g.queue {
+		builder.WriteString(event.text)
+	}
+	findings, err := runModerationProviders(g.c, g.policy, builder.String(), true)
+	if err != nil {
+		logger.LogWarn(g.c, "completion moderation failed: "+err.Error())
+		return
+	}
+	if len(findings) == 0 {
+		return
+	}
+	fresh := make([]*ModerationFinding, 0, len(findings))
+	for _, finding := range findings {
+		key := finding.Provider + "|" + strings.Join(finding.Matches, "|")
+		if !g.recorded[key] {
+			g.recorded[key] = true
+			fresh = append(fresh, finding)
+		}
+	}
+	if len(fresh) > 0 {
+		recordModerationVerdicts(g.c, ModerationStageCompletion, g.policy.Action, fresh)
+	}
+
+	switch g.policy.Action {
+	case operation_setting.ModerationActionBlock:
+		g.blocked = true
+		g.queue = nil
+		g.pending = nil
+		g.writeThrough(g.stopEvents())
+	case operation_setting.ModerationActionRedact:
+		if matches, ok := moderationMatches(findings); ok {
+			g.redactQueue(matches)
+		}
+	}
+}
+
+// redactQueue 替换队列中的命中内容：合并后的文本写入第一个文本事件，其余文本事件置空
+func (g *ModerationStreamGuard) redactQueue(matches []string) {
+	var builder strings.Builder
+	for _, event := range g.queue {
+		builder.WriteString(event.text)
+	}
+	text := builder.String()
+	redacted := RedactModerationText(text, matches)
+	if redacted == text {
+		return
+	}
+	first := true
+	for _, event := range g.queue {
+		if !event.hasText {
+			continue
+		}
+		if first {
+			event.setText(redacted)
+			first = false
+		} else {
+			event.setText("")
+		}
+	}
+}
+
+func (g *ModerationStreamGuard) flushOne() {
+	event := g.queue[0]
+	g.queue = g.queue[1:]
+	g.writeThrough(event.raw)
+	if event.hasText {
+		tail := []rune(g.tail + event.text)
+		if len(tail) > moderationStreamTailRunes {
+			tail = tail[len(tail)-moderationStreamTailRunes:]
+		}
+		g.tail = string(tail)
+	}
+}
+
+func (g *ModerationStreamGuard) writeThrough(p []byte) {
+	if g.err != nil {
+		return
+	}
+	if _, err := g.ResponseWriter.Write(p); err != nil {
+		g.err = err
+		return
+	}
+	g.ResponseWriter.Flush()
+}
+
+// stopEvents 构造截断输出时的结束事件
+func (g *ModerationStreamGuard) stopEvents() []byte {
+	switch g.format {
+	case types.RelayFormatClaude:
+		delta, _ := common.Marshal(map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]any{"stop_reason": "refusal", "stop_sequence": nil},
+		})
+		return []byte("event: message_delta\ndata: " + string(delta) + "\n\n" +
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	case types.RelayFormatOpenAIResponses:
+		// 与上游内容过滤一致，以 response.incomplete 结束
+		response := map[string]any{
+			"object":             "response",
+			"status":             "incomplete",
+			"incomplete_details": map[string]any{"reason": "content_filter"},
+		}
+		if created, ok := g.chunk["response"].(map[string]any); ok {
+			for _, key := range []string{"id", "created_at", "model"} {
+				if value, ok := created[key]; ok {
+					response[key] = value
+				}
+			}
+		}
+		data, _ := common.Marshal(map[string]any{"type": "response.incomplete", "response": response})
+		return []byte("event: response.incomplete\ndata: " + string(data) + "\n\n")
+	case types.RelayFormatGemini:
+		chunk := map[string]any{
+			"candidates": []any{map[string]any{
+				"index":        0,
+				"content":      map[string]any{"role": "model", "parts": []any{}},
+				"finishReason": "SAFETY",
+			}},
+		}
+		for _, key := range []string{"modelVersion", "responseId"} {
+			if value, ok := g.chunk[key]; ok {
+				chunk[key] = value
+			}
+		}
+		data, _ := common.Marshal(chunk)
+		return []byte("data: " + string(data) + "\n\n")
+	}
+	chunk := map[string]any{
+		"object":  "chat.completion.chunk",
+		"choices": []any{map[string]any{"index": 0, "delta": map[string]any{}, "finish_reason": "content_filter"}},
+	}
+	for _, key := range []string{"id", "created", "model"} {
+		if value, ok := g.chunk[key]; ok {
+			chunk[key] = value
+		}
+	}
+	data, _ := common.Marshal(chunk)
+	return []byte("data: " + string(data) + "\n\ndata: [DONE]\n\n")
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withModerationSetting(t *testing.T, moderation operation_setting.ModerationSetting, words []string, lookBehind int) {
+	t.Helper()
+	current := operation_setting.GetModerationSetting()
+	saved, savedWords, savedLookBehind := *current, setting.SensitiveWords, setting.StreamCacheQueueLength
+	*current = moderation
+	setting.SensitiveWords = words
+	setting.StreamCacheQueueLength = lookBehind
+	t.Cleanup(func() {
+		*current = saved
+		setting.SensitiveWords = savedWords
+		setting.StreamCacheQueueLength = savedLookBehind
+	})
+}
+
+func newModerationTestContext(body string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c, recorder
+}
+
+func moderationVerdicts(c *gin.Context) []ModerationVerdict {
+	verdicts, _ := common.GetContextKeyType[[]ModerationVerdict](c, constant.ContextKeyModerationVerdicts)
+	return verdicts
+}
+
+func TestResolveModerationPolicyTokenOnlyTightens(t *testing.T) {
+	withModerationSetting(t, operation_setting.ModerationSetting{
+		Enabled: true,
+		Default: operation_setting.ModerationPolicy{Action: operation_setting.ModerationActionBlock, Prompt: true, Providers: []string{"keyword"}},
+		Groups: map[string]operation_setting.ModerationPolicy{
+			"vip": {Action: operation_setting.ModerationActionFlag, Prompt: true, Providers: []string{"keyword"}},
+		},
+	}, nil, 0)
+
+	policy, ok := operation_setting.ResolveModerationPolicy("vip", operation_setting.ModerationActionRedact)
+	require.True(t, ok)
+	assert.Equal(t, operation_setting.ModerationActionRedact, policy.Action)
+
+	policy, ok = operation_setting.ResolveModerationPolicy("default", operation_setting.ModerationActionFlag)
+	require.True(t, ok)
+	assert.Equal(t, operation_setting.ModerationActionBlock, policy.Action, "token cannot loosen the group policy")
+}
+
+func TestModeratePromptLegacyKeywordBlock(t *testing.T) {
+	withModerationSetting(t, operation_setting.ModerationSetting{}, []string{"forbidden"}, 0)
+	c, _ := newModerationTestContext(`{}`)
+	info := &relaycommon.RelayInfo{UsingGroup: "default"}
+
+	err := ModeratePrompt(c, info, &dto.GeneralOpenAIRequest{}, "this is FORBIDDEN text")
+	require.NotNil(t, err)
+	assert.Equal(t, types.ErrorCodeSensitiveWordsDetected, err.GetErrorCode())
+	verdicts := moderationVerdicts(c)
+	require.Len(t, verdicts, 1)
+	assert.Equal(t, ModerationVerdict{Stage: ModerationStagePrompt, Action: "block", Provider: "keyword", Categories: []string{"keyword"}, Matches: []string{"forbidden"}}, verdicts[0])
+}
+
+func TestModeratePromptRedactsRequestBody(t *testing.T) {
+	withModerationSetting(t, operation_setting.ModerationSetting{
+		Enabled:    true,
+		Default:    operation_setting.ModerationPolicy{Action: operation_setting.ModerationActionRedact, Prompt: true, Providers: []string{"regex"}},
+		RegexRules: []operation_setting.ModerationRegexRule{{Name: "phone", Pattern: `\d{3}-\d{4}`}},
+		RedactMask: "[removed]",
+	}, nil, 0)
+	body := `{"model":"gpt-4o","user":"ext-555-1234","messages":[{"role":"user","content":"call me at 555-1234"}]}`
+	c, _ := newModerationTestContext(body)
+	request := &dto.GeneralOpenAIRequest{}
+	require.NoError(t, common.UnmarshalBodyReusable(c, request))
+
+	err := ModeratePrompt(c, &relaycommon.RelayInfo{UsingGroup: "default"}, request, "call me at 555-1234")
+	require.Nil(t, err)
+	assert.Equal(t, "call me at [removed]", request.Messages[0].StringContent())
+	storage, storageErr := common.GetBodyStorage(c)
+	require.NoError(t, storageErr)
+	redacted, _ := storage.Bytes()
+	assert.Contains(t, string(redacted), "call me at [removed]")
+	assert.Contains(t, string(redacted), `"user":"ext-555-1234"`, "only text fields are redacted")
+	assert.Equal(t, "phone", moderationVerdicts(c)[0].Categories[0])
+}
+
+func TestModerationStreamGuardRedactsAcrossChunks(t *testing.T) {
+	withModerationSetting(t, operation_setting.ModerationSetting{
+		Enabled: true,
+		Default: operation_setting.ModerationPolicy{Action: operation_setting.ModerationActionRedact, Completion: true, Providers: []string{"keyword"}},
+	}, []string{"secret"}, 2)
+	c, recorder := newModerationTestContext(`{}`)
+	guard := StartModerationStream(c, &relaycommon.RelayInfo{IsStream: true, UsingGroup: "default", RelayFormat: types.RelayFormatOpenAI})
+	require.NotNil(t, guard)
+
+	for _, chunk := range []string{"the ", "sec", "ret is out"} {
+		_, _ = c.Writer.WriteString(`data: {"choices":[{"index":0,"delta":{"content":"` + chunk + `"}}]}` + "\n\n")
+	}
+	_, _ = c.Writer.WriteString("data: [DONE]\n\n")
+	guard.Finish()
+
+	output := recorder.Body.String()
+	assert.NotContains(t, output, "sec")
+	assert.Contains(t, output, "**###**")
+	assert.Contains(t, output, "data: [DONE]")
+	assert.False(t, guard.Blocked())
+	assert.Equal(t, ModerationStageCompletion, moderationVerdicts(c)[0].Stage)
+}
+
+func TestModerationStreamGuardBlocksClaudeStream(t *testing.T) {
+	withModerationSetting(t, operation_setting.ModerationSetting{
+		Enabled: true,
+		Default: operation_setting.ModerationPolicy{Action: operation_setting.ModerationActionBlock, Completion: true, Providers: []string{"keyword"}},
+	}, []string{"secret"}, 0)
+	c, recorder := newModerationTestContext(`{}`)
+	guard := StartModerationStream(c, &relaycommon.RelayInfo{IsStream: true, UsingGroup: "default", RelayFormat: types.RelayFormatClaude})
+	require.NotNil(t, guard)
+
+	writeDelta := func(text string) {
+		_, _ = c.Writer.WriteString("event: content_block_delta\n")
+		_, _ = c.Writer.WriteString(`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"` + text + `"}}` + "\n\n\n")
+	}
+	writeDelta("hello ")
+	writeDelta("secret")
+	writeDelta("more")
+	guard.Finish()
+
+	output := recorder.Body.String()
+	assert.Contains(t, output, "hello ")
+	assert.NotContains(t, output, "secret")
+	assert.NotContains(t, output, "more")
+	assert.Contains(t, output, `"stop_reason":"refusal"`)
+	assert.True(t, guard.Blocked())
+	assert.Equal(t, c.Writer, gin.ResponseWriter(guard.ResponseWriter), "finish restores the writer")
+}
+
+func TestModerationStreamGuardBlocksResponsesAndGeminiStreams(t *testing.T) {
+	withModerationSetting(t, operation_setting.ModerationSetting{
+		Enabled: true,
+		Default: operation_setting.ModerationPolicy{Action: operation_setting.ModerationActionBlock, Completion: true, Providers: []string{"keyword"}},
+	}, []string{"secret"}, 0)
+
+	c, recorder := newModerationTestContext(`{}`)
+	guard := StartModerationStream(c, &relaycommon.RelayInfo{IsStream: true, UsingGroup: "default", RelayFormat: types.RelayFormatOpenAIResponses})
+	require.NotNil(t, guard)
+	_, _ = c.Writer.WriteString("event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\",\"model\":\"gpt-4o\"}}\n\n")
+	_, _ = c.Writer.WriteString("event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"the secret\"}\n\n")
+	guard.Finish()
+	output := recorder.Body.String()
+	assert.NotContains(t, output, "secret")
+	assert.Contains(t, output, "event: response.incomplete")
+	assert.Contains(t, output, `"reason":"content_filter"`)
+	assert.Contains(t, output, `"id":"resp_1"`)
+
+	c, recorder = newModerationTestContext(`{}`)
+	guard = StartModerationStream(c, &relaycommon.RelayInfo{IsStream: true, UsingGroup: "default", RelayFormat: types.RelayFormatGemini})
+	require.NotNil(t, guard)
+	_, _ = c.Writer.WriteString(`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"the secret"}]}}],"modelVersion":"gemini-2.5-flash"}` + "\n\n")
+	guard.Finish()
+	output = recorder.Body.String()
+	assert.NotContains(t, output, "secret")
+	assert.Contains(t, output, `"finishReason":"SAFETY"`)
+	assert.Contains(t, output, `"modelVersion":"gemini-2.5-flash"`)
+}
@@ -0,0 +1,702 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const payloadCaptureCleanupBatchSize = 1000
+
+// PayloadCaptureWriter 在转发响应的同时复制响应体，请求结束后连同请求体一起保存。
+// 非流式响应按原样保存；流式响应逐行解析 SSE，还原为与非流式一致的最终响应，
+// 无法识别的流式格式保存原始 SSE 文本。
+type PayloadCaptureWriter struct {
+	*captureWriter
+	assembler sseResponseAssembler
+}
+
+// StartPayloadCapture 请求命中采集范围且被抽中时替换 c.Writer，未命中返回 nil；结束后须调用 Finish
+func StartPayloadCapture(c *gin.Context) *PayloadCaptureWriter {
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	if !operation_setting.IsPayloadCaptureTarget(userId, tokenId, group) {
+		return nil
+	}
+	settings := operation_setting.GetPayloadCaptureSetting()
+	if settings.SampleRate < 1 && rand.Float64() >= settings.SampleRate {
+		return nil
+	}
+	limit := settings.GetMaxBodyBytes()
+	capture := &PayloadCaptureWriter{}
+	capture.assembler.limit = limit
+	capture.captureWriter = newCaptureWriter(c.Writer, limit, false, capture.assembler.feedLine)
+	c.Writer = capture
+	return capture
+}
+
+// response 返回要保存的响应体以及是否被截断
+func (w *PayloadCaptureWriter) response() ([]byte, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stream {
+		if assembled := w.assembler.result(); assembled != nil {
+			if len(assembled) > w.limit {
+				return assembled[:w.limit], true
+			}
+			return assembled, w.assembler.full
+		}
+	}
+	return bytes.Clone(w.body.Bytes()), w.truncated
+}
+
+// Finish 恢复原始 Writer，并异步压缩、加密后写入日志库，保存失败只记录日志
+func (w *PayloadCaptureWriter) Finish(c *gin.Context) {
+	if w == nil {
+		return
+	}
+	c.Writer = w.ResponseWriter
+	settings := operation_setting.GetPayloadCaptureSetting()
+	requestBody, requestBytes, requestTruncated := readCapturedRequestBody(c, w.limit)
+	responseBody, responseTruncated := w.response()
+	capture := &model.PayloadCapture{
+		RequestId:     c.GetString(common.RequestIdKey),
+		UserId:        common.GetContextKeyInt(c, constant.ContextKeyUserId),
+		TokenId:       common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		Group:         common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		ModelName:     common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		ChannelId:     common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		Path:          c.Request.URL.Path,
+		StatusCode:    w.Status(),
+		IsStream:      w.stream,
+		RequestBytes:  requestBytes,
+		ResponseBytes: w.total,
+		Truncated:     requestTruncated || responseTruncated,
+	}
+	redact, encrypt := settings.Redact, settings.Encrypt
+	gopool.Go(func() {
+		if err := savePayloadCapture(capture, requestBody, responseBody, redact, encrypt); err != nil {
+			common.SysError("failed to save payload capture: " + err.Error())
+		}
+	})
+}
+
+// readCapturedRequestBody 读取客户端原始请求体的前 limit 字节
+func readCapturedRequestBody(c *gin.Context, limit int) ([]byte, int, bool) {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil, 0, false
+	}
+	if _, err := storage.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, false
+	}
+	body, err := io.ReadAll(io.LimitReader(storage, int64(limit)))
+	_, _ = storage.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, 0, false
+	}
+	size := int(storage.Size())
+	return body, size, size > len(body)
+}
+
+func savePayloadCapture(capture *model.PayloadCapture, requestBody []byte, responseBody []byte, redact bool, encrypt bool) error {
+	if redact {
+		// 请求与响应共用一个会话，同一内容在两侧替换为同一个占位符
+		session := newPIISession()
+		requestBody = redactPayload(session, requestBody)
+		responseBody = redactPayload(session, responseBody)
+		capture.Redacted = true
+	}
+	var err error
+	if capture.RequestBody, err = encodePayload(requestBody, encrypt); err != nil {
+		return err
+	}
+	if capture.ResponseBody, err = encodePayload(responseBody, encrypt); err != nil {
+		return err
+	}
+	capture.Encrypted = encrypt && common.SecretEncryptionEnabled()
+	return capture.Insert()
+}
+
+// redactPayload 只处理文本内容，二进制内容（如上传的音频、图片）原样保存
+func redactPayload(session *PIISession, body []byte) []byte {
+	if len(body) == 0 || !utf8.Valid(body) {
+		return body
+	}
+	return []byte(session.Redact(string(body)))
+}
+
+// encodePayload gzip 压缩后 base64 编码，encrypt 为 true 且配置了主密钥时再信封加密
+func encodePayload(body []byte, encrypt bool) (string, error) {
+	if len(body) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+	if !encrypt {
+		return encoded, nil
+	}
+	return common.EncryptSecret(encoded)
+}
+
+// DecodePayloadCaptureBody 还原保存的请求体或响应体
+func DecodePayloadCaptureBody(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+	encoded, err := common.DecryptSecret(value)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// PayloadCaptureCleanupSummary 采集记录清理结果
+type PayloadCaptureCleanupSummary struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// payloadCaptureRetentionCutoff 早于该时间的采集记录需要清理，0 表示不清理
+func payloadCaptureRetentionCutoff() int64 {
+	days := operation_setting.GetPayloadCaptureSetting().RetentionDays
+	if days <= 0 {
+		return 0
+	}
+	return time.Now().Add(-time.Duration(days) * 24 * time.Hour).Unix()
+}
+
+// HasExpiredPayloadCaptures 是否存在超出保留期的采集记录
+func HasExpiredPayloadCaptures() bool {
+	cutoff := payloadCaptureRetentionCutoff()
+	return cutoff > 0 && model.HasPayloadCapturesBefore(cutoff)
+}
+
+// RunPayloadCaptureCleanupOnce 分批删除超出保留期的采集记录
+func RunPayloadCaptureCleanupOnce(ctx context.Context) (PayloadCaptureCleanupSummary, error) {
+	summary := PayloadCaptureCleanupSummary{}
+	cutoff := payloadCaptureRetentionCutoff()
+	if cutoff == 0 {
+		return summary, nil
+	}
+	for {
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+		deleted, err := model.DeletePayloadCapturesBefore(ctx, cutoff, payloadCaptureCleanupBatchSize)
+		if err != nil {
+			return summary, err
+		}
+		summary.Deleted += deleted
+		if deleted < payloadCaptureCleanupBatchSize {
+			return summary, nil
+		}
+	}
+}
+
+// sseResponseAssembler 将流式事件还原为最终响应，支持 OpenAI Chat Completions、
+// Claude Messages、Responses API 与 Gemini；其余格式 result 返回 nil。
+// 拼接的文本累计超过 limit 后不再追加，只继续更新结束原因与用量
+type sseResponseAssembler struct {
+	format    string
+	chat      *chatStreamAssembly
+	claude    *claudeStreamAssembly
+	gemini    *geminiStreamAssembly
+	responses json.RawMessage
+	limit     int
+	size      int
+	full      bool // 文本已达到 limit，结果被截断
+}
+
+const (
+	sseFormatChat      = "chat"
+	sseFormatClaude    = "claude"
+	sseFormatResponses = "responses"
+	sseFormatGemini    = "gemini"
+)
+
+// grow 为即将追加的 n 字节内容预留空间，超出 limit 时返回 false，此后不再追加任何内容
+func (a *sseResponseAssembler) grow(n int) bool {
+	if a.full || a.size+n > a.limit {
+		a.full = true
+		return false
+	}
+	a.size += n
+	return true
+}
+
+func (a *sseResponseAssembler) feedLine(line []byte) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	var probe struct {
+		Object        string          `json:"object"`
+		Type          string          `json:"type"`
+		Candidates    json.RawMessage `json:"candidates"`
+		UsageMetadata json.RawMessage `json:"usageMetadata"`
+	}
+	if common.Unmarshal(data, &probe) != nil {
+		return
+	}
+	switch {
+	case probe.Object == "chat.completion.chunk":
+		a.feedChat(data)
+	case strings.HasPrefix(probe.Type, "message_") || strings.HasPrefix(probe.Type, "content_block_"):
+		a.feedClaude(probe.Type, data)
+	case probe.Type == "response.completed" || probe.Type == "response.incomplete" || probe.Type == "response.failed":
+		var event struct {
+			Response json.RawMessage `json:"response"`
+		}
+		if common.Unmarshal(data, &event) == nil && len(event.Response) > 0 {
+			a.format = sseFormatResponses
+			a.responses = bytes.Clone(event.Response)
+		}
+	case len(probe.Candidates) > 0 || len(probe.UsageMetadata) > 0:
+		a.feedGemini(data)
+	}
+}
+
+func (a *sseResponseAssembler) result() []byte {
+	var (
+		body []byte
+		err  error
+	)
+	switch a.format {
+	case sseFormatChat:
+		body, err = common.Marshal(a.chat.response())
+	case sseFormatClaude:
+		body, err = common.Marshal(a.claude.response())
+	case sseFormatGemini:
+		body, err = common.Marshal(a.gemini.response())
+	case sseFormatResponses:
+		body = a.responses
+	}
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+type chatChoiceAssembly struct {
+	role         string
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    []dto.ToolCallResponse
+	finishReason *string
+}
+
+type chatStreamAssembly struct {
+	id                string
+	created           int64
+	model             string
+	systemFingerprint *string
+	choices           map[int]*chatChoiceAssembly
+	usage             *dto.Usage
+}
+
+func (a *sseResponseAssembler) feedChat(data []byte) {
+	var chunk dto.ChatCompletionsStreamResponse
+	if common.Unmarshal(data, &chunk) != nil {
+		return
+	}
+	if a.chat == nil {
+		a.format = sseFormatChat
+		a.chat = &chatStreamAssembly{choices: map[int]*chatChoiceAssembly{}}
+	}
+	chat := a.chat
+	if chat.id == "" {
+		chat.id, chat.created, chat.model = chunk.Id, chunk.Created, chunk.Model
+	}
+	if chunk.SystemFingerprint != nil {
+		chat.systemFingerprint = chunk.SystemFingerprint
+	}
+	if chunk.Usage != nil {
+		chat.usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		assembly := chat.choices[choice.Index]
+		if assembly == nil {
+			assembly = &chatChoiceAssembly{role: "assistant"}
+			chat.choices[choice.Index] = assembly
+		}
+		delta := choice.Delta
+		if delta.Role != "" {
+			assembly.role = delta.Role
+		}
+		if content := delta.GetContentString(); a.grow(len(content)) {
+			assembly.content.WriteString(content)
+		}
+		if delta.ReasoningContent != nil {
+			if a.grow(len(*delta.ReasoningContent)) {
+				assembly.reasoning.WriteString(*delta.ReasoningContent)
+			}
+		} else if delta.Reasoning != nil {
+			if a.grow(len(*delta.Reasoning)) {
+				assembly.reasoning.WriteString(*delta.Reasoning)
+			}
+		}
+		for _, toolCall := range delta.ToolCalls {
+			if a.grow(len(toolCall.Function.Arguments)) {
+				assembly.mergeToolCall(toolCall)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			assembly.finishReason = choice.FinishReason
+		}
+	}
+}
+
+// mergeToolCall 按 index 拼接工具调用的参数片段
+func (c *chatChoiceAssembly) mergeToolCall(delta dto.ToolCallResponse) {
+	index := len(c.toolCalls)
+	if delta.Index != nil {
+		index = *delta.Index
+	}
+	for i := range c.toolCalls {
+		existing := &c.toolCalls[i]
+		if existing.Index == nil || *existing.Index != index {
+			continue
+		}
+		if delta.ID != "" {
+			existing.ID = delta.ID
+		}
+		if delta.Function.Name != "" {
+			existing.Function.Name = delta.Function.Name
+		}
+		existing.Function.Arguments += delta.Function.Arguments
+		return
+	}
+	delta.SetIndex(index)
+	if delta.Type == nil {
+		delta.Type = "function"
+	}
+	c.toolCalls = append(c.toolCalls, delta)
+}
+
+func (c *chatStreamAssembly) response() map[string]any {
+	indexes := make([]int, 0, len(c.choices))
+	for index := range c.choices {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	choices := make([]map[string]any, 0, len(indexes))
+	for _, index := range indexes {
+		assembly := c.choices[index]
+		message := map[string]any{
+			"role":    assembly.role,
+			"content": assembly.content.String(),
+		}
+		if assembly.reasoning.Len() > 0 {
+			message["reasoning_content"] = assembly.reasoning.String()
+		}
+		if len(assembly.toolCalls) > 0 {
+			toolCalls := make([]dto.ToolCallResponse, len(assembly.toolCalls))
+			for i, toolCall := range assembly.toolCalls {
+				toolCall.Index = nil
+				toolCalls[i] = toolCall
+			}
+			message["tool_calls"] = toolCalls
+		}
+		choices = append(choices, map[string]any{
+			"index":         index,
+			"message":       message,
+			"finish_reason": assembly.finishReason,
+		})
+	}
+	response := map[string]any{
+		"id":      c.id,
+		"object":  "chat.completion",
+		"created": c.created,
+		"model":   c.model,
+		"choices": choices,
+	}
+	if c.systemFingerprint != nil {
+		response["system_fingerprint"] = *c.systemFingerprint
+	}
+	if c.usage != nil {
+		response["usage"] = c.usage
+	}
+	return response
+}
+
+type claudeStreamAssembly struct {
+	message     dto.ClaudeResponse
+	partialJson map[int]*strings.Builder
+}
+
+func (a *sseResponseAssembler) feedClaude(eventType string, data []byte) {
+	var event dto.ClaudeResponse
+	if common.Unmarshal(data, &event) != nil {
+		return
+	}
+	if a.claude == nil {
+		a.format = sseFormatClaude
+		a.claude = &claudeStreamAssembly{
+			message:     dto.ClaudeResponse{Type: "message", Role: "assistant"},
+			partialJson: map[int]*strings.Builder{},
+		}
+	}
+	claude := a.claude
+	message := &claude.message
+	switch eventType {
+	case "message_start":
+		if event.Message != nil {
+			message.Id = event.Message.Id
+			message.Model = event.Message.Model
+			if event.Message.Role != "" {
+				message.Role = event.Message.Role
+			}
+			if event.Message.Usage != nil {
+				message.Usage = event.Message.Usage
+			}
+		}
+	case "content_block_start":
+		if event.ContentBlock == nil {
+			return
+		}
+		index := event.GetIndex()
+		for len(message.Content) <= index {
+			message.Content = append(message.Content, dto.ClaudeMediaMessage{})
+		}
+		message.Content[index] = *event.ContentBlock
+	case "content_block_delta":
+		index := event.GetIndex()
+		if event.Delta == nil || index >= len(message.Content) {
+			return
+		}
+		block := &message.Content[index]
+		switch event.Delta.Type {
+		case "text_delta":
+			if a.grow(len(event.Delta.GetText())) {
+				block.SetText(block.GetText() + event.Delta.GetText())
+			}
+		case "thinking_delta":
+			if event.Delta.Thinking == nil || !a.grow(len(*event.Delta.Thinking)) {
+				return
+			}
+			thinking := ""
+			if block.Thinking != nil {
+				thinking = *block.Thinking
+			}
+			thinking += *event.Delta.Thinking
+			block.Thinking = &thinking
+		case "signature_delta":
+			if a.grow(len(event.Delta.Signature)) {
+				block.Signature += event.Delta.Signature
+			}
+		case "input_json_delta":
+			if event.Delta.PartialJson == nil || !a.grow(len(*event.Delta.PartialJson)) {
+				return
+			}
+			builder := claude.partialJson[index]
+			if builder == nil {
+				builder = &strings.Builder{}
+				claude.partialJson[index] = builder
+			}
+			builder.WriteString(*event.Delta.PartialJson)
+		}
+	case "content_block_stop":
+		index := event.GetIndex()
+		builder := claude.partialJson[index]
+		if builder == nil || index >= len(message.Content) {
+			return
+		}
+		var input any
+		if common.UnmarshalJsonStr(builder.String(), &input) == nil {
+			message.Content[index].Input = input
+		}
+		delete(claude.partialJson, index)
+	case "message_delta":
+		if event.Delta != nil && event.Delta.StopReason != nil {
+			message.StopReason = *event.Delta.StopReason
+		}
+		if event.Usage != nil {
+			if message.Usage == nil {
+				message.Usage = event.Usage
+			} else {
+				message.Usage.OutputTokens = event.Usage.OutputTokens
+			}
+		}
+	}
+}
+
+func (c *claudeStreamAssembly) response() dto.ClaudeResponse {
+	return c.message
+}
+
+type geminiCandidateAssembly struct {
+	role              string
+	parts             []dto.GeminiPart
+	finishReason      *string
+	safetyRatings     []dto.GeminiChatSafetyRating
+	groundingMetadata *dto.GeminiGroundingMetadata
+}
+
+type geminiStreamAssembly struct {
+	candidates     map[int64]*geminiCandidateAssembly
+	promptFeedback json.RawMessage
+	usageMetadata  json.RawMessage
+	modelVersion   string
+	responseId     string
+}
+
+func (a *sseResponseAssembler) feedGemini(data []byte) {
+	var chunk struct {
+		Candidates     []dto.GeminiChatCandidate `json:"candidates"`
+		PromptFeedback json.RawMessage           `json:"promptFeedback"`
+		UsageMetadata  json.RawMessage           `json:"usageMetadata"`
+		ModelVersion   string                    `json:"modelVersion"`
+		ResponseId     string                    `json:"responseId"`
+	}
+	if common.Unmarshal(data, &chunk) != nil {
+		return
+	}
+	if a.gemini == nil {
+		a.format = sseFormatGemini
+		a.gemini = &geminiStreamAssembly{candidates: map[int64]*geminiCandidateAssembly{}}
+	}
+	gemini := a.gemini
+	if chunk.ModelVersion != "" {
+		gemini.modelVersion = chunk.ModelVersion
+	}
+	if chunk.ResponseId != "" {
+		gemini.responseId = chunk.ResponseId
+	}
+	if len(chunk.PromptFeedback) > 0 {
+		gemini.promptFeedback = bytes.Clone(chunk.PromptFeedback)
+	}
+	if len(chunk.UsageMetadata) > 0 {
+		gemini.usageMetadata = bytes.Clone(chunk.UsageMetadata)
+	}
+	for _, candidate := range chunk.Candidates {
+		assembly := gemini.candidates[candidate.Index]
+		if assembly == nil {
+			assembly = &geminiCandidateAssembly{role: "model"}
+			gemini.candidates[candidate.Index] = assembly
+		}
+		if candidate.Content.Role != "" {
+			assembly.role = candidate.Content.Role
+		}
+		for _, part := range candidate.Content.Parts {
+			if !a.grow(geminiPartSize(part)) {
+				continue
+			}
+			assembly.mergePart(part)
+		}
+		if candidate.FinishReason != nil && *candidate.FinishReason != "" {
+			assembly.finishReason = candidate.FinishReason
+		}
+		if len(candidate.SafetyRatings) > 0 {
+			assembly.safetyRatings = candidate.SafetyRatings
+		}
+		if candidate.GroundingMetadata != nil {
+			assembly.groundingMetadata = candidate.GroundingMetadata
+		}
+	}
+}
+
+// mergePart 相邻的纯文本片段（思考与正文分开）拼接为一个 part，其余 part 按顺序追加
+func (c *geminiCandidateAssembly) mergePart(part dto.GeminiPart) {
+	if last := len(c.parts) - 1; last >= 0 && isGeminiTextPart(c.parts[last]) && isGeminiTextPart(part) && c.parts[last].Thought == part.Thought {
+		c.parts[last].Text += part.Text
+		if len(part.ThoughtSignature) > 0 {
+			c.parts[last].ThoughtSignature = part.ThoughtSignature
+		}
+		return
+	}
+	c.parts = append(c.parts, part)
+}
+
+// geminiPartSize 估算 part 占用的字节数，内联数据按 base64 长度计算
+func geminiPartSize(part dto.GeminiPart) int {
+	size := len(part.Text) + len(part.ThoughtSignature)
+	if part.InlineData != nil {
+		size += len(part.InlineData.Data)
+	}
+	return size
+}
+
+func isGeminiTextPart(part dto.GeminiPart) bool {
+	return part.InlineData == nil && part.FunctionCall == nil && part.FunctionResponse == nil &&
+		part.FileData == nil && part.ExecutableCode == nil && part.CodeExecutionResult == nil
+}
+
+func (c *geminiStreamAssembly) response() map[string]any {
+	indexes := make([]int64, 0, len(c.candidates))
+	for index := range c.candidates {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	candidates := make([]map[string]any, 0, len(indexes))
+	for _, index := range indexes {
+		assembly := c.candidates[index]
+		parts := assembly.parts
+		if parts == nil {
+			parts = []dto.GeminiPart{}
+		}
+		candidate := map[string]any{
+			"index":        index,
+			"content":      dto.GeminiChatContent{Role: assembly.role, Parts: parts},
+			"finishReason": assembly.finishReason,
+		}
+		if len(assembly.safetyRatings) > 0 {
+			candidate["safetyRatings"] = assembly.safetyRatings
+		}
+		if assembly.groundingMetadata != nil {
+			candidate["groundingMetadata"] = assembly.groundingMetadata
+		}
+		candidates = append(candidates, candidate)
+	}
+	response := map[string]any{"candidates": candidates}
+	if len(c.promptFeedback) > 0 {
+		response["promptFeedback"] = c.promptFeedback
+	}
+	if len(c.usageMetadata) > 0 {
+		response["usageMetadata"] = c.usageMetadata
+	}
+	if c.modelVersion != "" {
+		response["modelVersion"] = c.modelVersion
+	}
+	if c.responseId != "" {
+		response["responseId"] = c.responseId
+	}
+	return response
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestPayloadCaptureReassemblesChatStream(t *testing.T) {
+	truncate(t)
+	setting := operation_setting.GetPayloadCaptureSetting()
+	previous := *setting
+	setting.Enabled = true
+	setting.UserIds = []int{7}
+	setting.SampleRate = 1
+	setting.Redact = true
+	t.Cleanup(func() { *setting = previous })
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"mail alice@example.com"}]}`))
+	c.Set(common.RequestIdKey, "req-capture")
+	c.Set("id", 8)
+	assert.Nil(t, StartPayloadCapture(c), "users outside the capture scope are skipped")
+	c.Set("id", 7)
+	capture := StartPayloadCapture(c)
+	require.NotNil(t, capture)
+
+	c.Header("Content-Type", "text/event-stream")
+	events := []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Sent to "}}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"alice@example.com"}}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"send","arguments":"{\"to\":"}}]}}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":4,"total_tokens":9}}`,
+	}
+	for _, event := range events {
+		// 一个事件拆成两次写入，模拟上游分片
+		line := "data: " + event + "\n\n"
+		_, _ = c.Writer.WriteString(line[:10])
+		_, _ = c.Writer.WriteString(line[10:])
+	}
+	_, _ = c.Writer.WriteString("data: [DONE]\n\n")
+	assert.Contains(t, recorder.Body.String(), "data: [DONE]", "the client still receives the raw stream")
+
+	body, truncated := capture.response()
+	assert.False(t, truncated)
+	assert.Equal(t, "chat.completion", gjson.GetBytes(body, "object").String())
+	assert.Equal(t, "Sent to alice@example.com", gjson.GetBytes(body, "choices.0.message.content").String())
+	assert.Equal(t, `{"to":1}`, gjson.GetBytes(body, "choices.0.message.tool_calls.0.function.arguments").String())
+	assert.Equal(t, "tool_calls", gjson.GetBytes(body, "choices.0.finish_reason").String())
+	assert.EqualValues(t, 9, gjson.GetBytes(body, "usage.total_tokens").Int())
+
+	// Finish 异步保存，这里同步走同一条保存路径
+	requestBody, requestBytes, requestTruncated := readCapturedRequestBody(c, capture.limit)
+	assert.False(t, requestTruncated)
+	record := &model.PayloadCapture{RequestId: "req-capture", UserId: 7, RequestBytes: requestBytes, IsStream: true}
+	require.NoError(t, savePayloadCapture(record, requestBody, body, true, true))
+
+	stored, exist, err := model.GetPayloadCaptureByRequestId("req-capture")
+	require.NoError(t, err)
+	require.True(t, exist)
+	assert.True(t, stored.Redacted)
+	assert.False(t, stored.Encrypted, "no master key is configured in tests")
+	storedRequest, err := DecodePayloadCaptureBody(stored.RequestBody)
+	require.NoError(t, err)
+	storedResponse, err := DecodePayloadCaptureBody(stored.ResponseBody)
+	require.NoError(t, err)
+	assert.NotContains(t, string(storedRequest), "alice@example.com")
+	assert.Contains(t, string(storedRequest), "[PII_EMAIL_1]")
+	assert.Equal(t, "Sent to [PII_EMAIL_1]", gjson.GetBytes(storedResponse, "choices.0.message.content").String())
+}
+
+func TestSSEResponseAssemblerClaude(t *testing.T) {
+	assembler := sseResponseAssembler{limit: 1 << 20}
+	for _, event := range []string{
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude","usage":{"input_tokens":3}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"there"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"x\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":6}}`,
+		`{"type":"message_stop"}`,
+	} {
+		assembler.feedLine([]byte("data: " + event))
+	}
+	body := assembler.result()
+	assert.Equal(t, "msg_1", gjson.GetBytes(body, "id").String())
+	assert.Equal(t, "Hi there", gjson.GetBytes(body, "content.0.text").String())
+	assert.Equal(t, "x", gjson.GetBytes(body, "content.1.input.q").String())
+	assert.Equal(t, "tool_use", gjson.GetBytes(body, "stop_reason").String())
+	assert.EqualValues(t, 6, gjson.GetBytes(body, "usage.output_tokens").Int())
+	assert.EqualValues(t, 3, gjson.GetBytes(body, "usage.input_tokens").Int())
+}
+
+func TestSSEResponseAssemblerGemini(t *testing.T) {
+	assembler := sseResponseAssembler{limit: 1 << 20}
+	for _, event := range []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Let me think","thought":true}]},"index":0}],"modelVersion":"gemini-2.5-flash","responseId":"resp_1"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello "}]},"index":0}],"modelVersion":"gemini-2.5-flash","responseId":"resp_1"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"world"}]},"index":0}],"modelVersion":"gemini-2.5-flash","responseId":"resp_1"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"lookup","args":{"q":"x"}}}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":5,"totalTokenCount":8},"modelVersion":"gemini-2.5-flash","responseId":"resp_1"}`,
+	} {
+		assembler.feedLine([]byte("data: " + event))
+	}
+	body := assembler.result()
+	assert.Equal(t, "resp_1", gjson.GetBytes(body, "responseId").String())
+	assert.Equal(t, "gemini-2.5-flash", gjson.GetBytes(body, "modelVersion").String())
+	assert.Equal(t, "model", gjson.GetBytes(body, "candidates.0.content.role").String())
+	assert.Equal(t, "Let me think", gjson.GetBytes(body, "candidates.0.content.parts.0.text").String())
+	assert.True(t, gjson.GetBytes(body, "candidates.0.content.parts.0.thought").Bool())
+	assert.Equal(t, "Hello world", gjson.GetBytes(body, "candidates.0.content.parts.1.text").String())
+	assert.Equal(t, "lookup", gjson.GetBytes(body, "candidates.0.content.parts.2.functionCall.name").String())
+	assert.Equal(t, "STOP", gjson.GetBytes(body, "candidates.0.finishReason").String())
+	assert.EqualValues(t, 8, gjson.GetBytes(body, "usageMetadata.totalTokenCount").Int())
+}
+
+func TestSSEResponseAssemblerStopsGrowingAtLimit(t *testing.T) {
+	chat := sseResponseAssembler{limit: 10}
+	for _, content := range []string{"12345", "67890", "overflow"} {
+		chat.feedLine([]byte(`data: {"id":"c","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"` + content + `"}}]}`))
+	}
+	chat.feedLine([]byte(`data: {"id":"c","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`))
+	body := chat.result()
+	assert.True(t, chat.full)
+	assert.Equal(t, "1234567890", gjson.GetBytes(body, "choices.0.message.content").String())
+	assert.Equal(t, "length", gjson.GetBytes(body, "choices.0.finish_reason").String(), "metadata is still recorded after the limit")
+
+	claude := sseResponseAssembler{limit: 4}
+	for _, event := range []string{
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"abcd"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"efgh"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":2}}`,
+	} {
+		claude.feedLine([]byte("data: " + event))
+	}
+	body = claude.result()
+	assert.True(t, claude.full)
+	assert.Equal(t, "abcd", gjson.GetBytes(body, "content.0.text").String())
+	assert.Equal(t, "max_tokens", gjson.GetBytes(body, "stop_reason").String())
+}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// piiPlaceholderPattern 匹配完整的占位符，例如 [PII_EMAIL_1]
+var piiPlaceholderPattern = regexp.MustCompile(`\[PII_[A-Z0-9_]+\]`)
+
+const (
+	piiPlaceholderPrefix = "[PII_"
+	// piiPlaceholderMaxLen 流式还原时最多暂存的占位符前缀长度
+	piiPlaceholderMaxLen = 64
+)
+
+type piiDetector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+// 内置检测器按顺序执行：密钥和信用卡号先于手机号，避免长数字被拆开替换
+var builtinPIIDetectors = []piiDetector{
+	{
+		name: operation_setting.PIIDetectorApiKey,
+		re:   regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_\-]{16,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_\-]{35}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9\-]{10,})`),
+	},
+	{
+		name: operation_setting.PIIDetectorEmail,
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	},
+	{
+		name:  operation_setting.PIIDetectorCreditCard,
+		re:    regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+		valid: luhnValid,
+	},
+	{
+		// 中国居民身份证号与美国 SSN
+		name: operation_setting.PIIDetectorNationalId,
+		re:   regexp.MustCompile(`\b(?:\d{17}[\dXx]|\d{3}-\d{2}-\d{4})\b`),
+	},
+	{
+		name: operation_setting.PIIDetectorPhone,
+		re:   regexp.MustCompile(`(?:\+\d{1,3}[ \-]?)?(?:\b1[3-9]\d{9}\b|\(?\b\d{3}\)?[ \-.]\d{3}[ \-.]\d{4}\b)`),
+	},
+}
+
+func luhnValid(match string) bool {
+	sum, digits := 0, 0
+	for i := len(match) - 1; i >= 0; i-- {
+		ch := match[i]
+		if ch < '0' || ch > '9' {
+			continue
+		}
+		d := int(ch - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+var piiDetectorNameReplacer = regexp.MustCompile(`[^A-Z0-9]+`)
+
+func activePIIDetectors() []piiDetector {
+	settings := operation_setting.GetPIIRedactionSetting()
+	detectors := make([]piiDetector, 0, len(builtinPIIDetectors)+len(settings.CustomDetectors))
+	for _, detector := range builtinPIIDetectors {
+		for _, name := range settings.Detectors {
+			if name == detector.name {
+				detectors = append(detectors, detector)
+				break
+			}
+		}
+	}
+	for _, custom := range settings.CustomDetectors {
+		name := strings.Trim(piiDetectorNameReplacer.ReplaceAllString(strings.ToUpper(custom.Name), "_"), "_")
+		re := compileSettingRegex(custom.Pattern)
+		if name == "" || re == nil {
+			continue
+		}
+		detectors = append(detectors, piiDetector{name: strings.ToLower(name), re: re})
+	}
+	return detectors
+}
+
+// PIISession 保存一次请求中占位符与原始内容的对应关系，同一内容始终使用同一个占位符
+type PIISession struct {
+	mu           sync.Mutex
+	detectors    []piiDetector
+	originals    map[string]string // 占位符 -> 原始内容
+	placeholders map[string]string // 原始内容 -> 占位符
+	sequence     map[string]int
+	counts       map[string]int // 检测器 -> 替换次数
+}
+
+func newPIISession() *PIISession {
+	return &PIISession{
+		detectors:    activePIIDetectors(),
+		originals:    map[string]string{},
+		placeholders: map[string]string{},
+		sequence:     map[string]int{},
+		counts:       map[string]int{},
+	}
+}
+
+func (s *PIISession) placeholderFor(detector string, original string) string {
+	s.counts[detector]++
+	if placeholder, ok := s.placeholders[original]; ok {
+		return placeholder
+	}
+	s.sequence[detector]++
+	placeholder := fmt.Sprintf("%s%s_%d]", piiPlaceholderPrefix, strings.ToUpper(detector), s.sequence[detector])
+	s.placeholders[original] = placeholder
+	s.originals[placeholder] = original
+	return placeholder
+}
+
+// Redact 将文本中的 PII 替换为占位符
+func (s *PIISession) Redact(text string) string {
+	if text == "" {
+		return text
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, detector := range s.detectors {
+		text = detector.re.ReplaceAllStringFunc(text, func(match string) string {
+			if detector.valid != nil && !detector.valid(match) {
+				return match
+			}
+			return s.placeholderFor(detector.name, match)
+		})
+	}
+	return text
+}
+
+// Rehydrate 将文本中的占位符还原为原始内容，escape 不为空时对原始内容转义（用于 JSON）
+func (s *PIISession) Rehydrate(text string, escape func(string) string) string {
+	if !strings.Contains(text, piiPlaceholderPrefix) {
+		return text
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return piiPlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		original, ok := s.originals[placeholder]
+		if !ok {
+			return placeholder
+		}
+		if escape != nil {
+			return escape(original)
+		}
+		return original
+	})
+}
+
+// Counts 返回各检测器的替换次数
+func (s *PIISession) Counts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int, len(s.counts))
+	for name, count := range s.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+func (s *PIISession) total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, count := range s.counts {
+		total += count
+	}
+	return total
+}
+
+// GetPIISession 返回当前请求的脱敏会话，未脱敏时返回 nil
+func GetPIISession(c *gin.Context) *PIISession {
+	session, _ := common.GetContextKeyType[*PIISession](c, constant.ContextKeyPIISession)
+	return session
+}
+
+// RedactRequestPII 在请求发往上游前替换其中的 PII。替换作用于解析后的请求，
+// 并用替换后的请求重写请求体，使透传模式同样生效。
+func RedactRequestPII(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) *types.NewAPIError {
+	if !operation_setting.IsPIIRedactionEnabledFor(info.UsingGroup) {
+		return nil
+	}
+	session := newPIISession()
+	if len(session.detectors) == 0 {
+		return nil
+	}
+	if err := redactRequestDTO(session, request); err != nil {
+		return types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+	if session.total() == 0 {
+		return nil
+	}
+	if newAPIError := replaceRequestBodyStorage(c, request); newAPIError != nil {
+		return newAPIError
+	}
+	common.SetContextKey(c, constant.ContextKeyPIISession, session)
+	recordPIIStats(info.UsingGroup, session.Counts())
+	return nil
+}
+
+// replaceRequestBodyStorage 用改写后的请求替换缓存的请求体
+func replaceRequestBodyStorage(c *gin.Context, request dto.Request) *types.NewAPIError {
+	body, err := common.Marshal(request)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	storage, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	common.CleanupBodyStorage(c)
+	c.Set(common.KeyBodyStorage, storage)
+	return nil
+}
+
+// textRedactor 替换请求文本字段中的内容，PII 脱敏与内容审核的命中替换共用同一套请求遍历
+type textRedactor interface {
+	Redact(text string) string
+	// total 返回已替换的次数，用于判断请求是否被改写
+	total() int
+}
+
+func redactRequestDTO(session textRedactor, request dto.Request) error {
+	var err error
+	switch req := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		for i := range req.Messages {
+			message := &req.Messages[i]
+			content := redactPIIValue(session, message.Content, true)
+			message.SetNullContent()
+			message.Content = content
+		}
+		req.Prompt = redactPIIValue(session, req.Prompt, true)
+		req.Input = redactPIIValue(session, req.Input, true)
+	case *dto.OpenAIResponsesRequest:
+		if req.Input, err = redactPIIRaw(session, req.Input); err != nil {
+			return err
+		}
+		if req.Instructions, err = redactPIIRaw(session, req.Instructions); err != nil {
+			return err
+		}
+	case *dto.ClaudeRequest:
+		req.Prompt = session.Redact(req.Prompt)
+		req.System = redactPIIValue(session, req.System, true)
+		for i := range req.Messages {
+			req.Messages[i].Content = redactPIIValue(session, req.Messages[i].Content, true)
+		}
+	case *dto.GeminiChatRequest:
+		redactGeminiContents(session, req.Contents)
+		if req.SystemInstructions != nil {
+			redactGeminiContents(session, []dto.GeminiChatContent{*req.SystemInstructions})
+		}
+	}
+	return nil
+}
+
+func redactGeminiContents(session textRedactor, contents []dto.GeminiChatContent) {
+	for i := range contents {
+		for j := range contents[i].Parts {
+			contents[i].Parts[j].Text = session.Redact(contents[i].Parts[j].Text)
+		}
+	}
+}
+
+// piiTextKeys 是消息结构中承载文本的字段，其余字段（图片、文件、工具定义等）不做替换
+var piiTextKeys = map[string]bool{
+	"text":         true,
+	"content":      true,
+	"input":        true,
+	"output":       true,
+	"instructions": true,
+	"system":       true,
+	"prompt":       true,
+}
+
+// redactPIIValue 递归替换 JSON 结构中文本字段的内容
+func redactPIIValue(session textRedactor, value any, isText bool) any {
+	switch v := value.(type) {
+	case string:
+		if isText {
+			return session.Redact(v)
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = redactPIIValue(session, v[i], isText)
+		}
+		return v
+	case map[string]any:
+		for key, item := range v {
+			v[key] = redactPIIValue(session, item, piiTextKeys[key])
+		}
+		return v
+	case []dto.MediaContent:
+		for i := range v {
+			v[i].Text = session.Redact(v[i].Text)
+		}
+		return v
+	}
+	return value
+}
+
+func redactPIIRaw(session textRedactor, raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+	before := session.total()
+	var value any
+	if err := common.Unmarshal(raw, &value); err != nil {
+		return raw, err
+	}
+	value = redactPIIValue(session, value, true)
+	if session.total() == before {
+		return raw, nil
+	}
+	return common.Marshal(value)
+}
+
+// PII 脱敏计数，按分组和检测器累计，重启后清零
+var (
+	piiStatsMu sync.Mutex
+	piiStats   = map[string]map[string]int64{}
+)
+
+func recordPIIStats(group string, counts map[string]int) {
+	piiStatsMu.Lock()
+	defer piiStatsMu.Unlock()
+	groupStats, ok := piiStats[group]
+	if !ok {
+		groupStats = map[string]int64{}
+		piiStats[group] = groupStats
+	}
+	for name, count := range counts {
+		groupStats[name] += int64(count)
+	}
+}
+
+// PIIStat 是一个分组内某个检测器的累计替换次数
+type PIIStat struct {
+	Group    string `json:"group"`
+	Detector string `json:"detector"`
+	Count    int64  `json:"count"`
+}
+
+// GetPIIStats 返回本实例启动以来的脱敏计数
+func GetPIIStats() []PIIStat {
+	piiStatsMu.Lock()
+	defer piiStatsMu.Unlock()
+	stats := make([]PIIStat, 0)
+	for group, groupStats := range piiStats {
+		for detector, count := range groupStats {
+			stats = append(stats, PIIStat{Group: group, Detector: detector, Count: count})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Group != stats[j].Group {
+			return stats[i].Group < stats[j].Group
+		}
+		return stats[i].Detector < stats[j].Detector
+	})
+	return stats
+}
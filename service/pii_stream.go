@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PIIRehydrator 在响应返回客户端前将占位符还原为原始内容：替换 c.Writer，
+// 流式响应逐个事件还原，并暂存可能被拆分到下一段文本中的占位符前缀；
+// 非流式响应缓冲完整响应体，还原后重新计算 Content-Length。
+type PIIRehydrator struct {
+	gin.ResponseWriter
+	c        *gin.Context
+	session  *PIISession
+	format   types.RelayFormat
+	isStream bool
+
+	mu          sync.Mutex
+	decided     bool
+	stream      bool
+	status      int
+	body        bytes.Buffer
+	pending     []byte
+	carry       string
+	lastTextRaw []byte
+	finished    bool
+	err         error
+}
+
+// StartPIIRehydration 为已脱敏的请求开启响应还原，未脱敏或关闭还原时返回 nil。
+// 须在响应缓存回放和捕获之前调用，使缓存中保存的是占位符而非原始内容。
+func StartPIIRehydration(c *gin.Context, info *relaycommon.RelayInfo) *PIIRehydrator {
+	session := GetPIISession(c)
+	if session == nil || !operation_setting.GetPIIRedactionSetting().Rehydrate {
+		return nil
+	}
+	rehydrator := &PIIRehydrator{
+		ResponseWriter: c.Writer,
+		c:              c,
+		session:        session,
+		format:         info.RelayFormat,
+		isStream:       info.IsStream,
+	}
+	c.Writer = rehydrator
+	return rehydrator
+}
+
+// decide 在写出响应头或首段数据时按 Content-Type 判断是否为流式响应
+func (r *PIIRehydrator) decide() {
+	if r.decided {
+		return
+	}
+	r.decided = true
+	contentType := r.ResponseWriter.Header().Get("Content-Type")
+	if contentType == "" {
+		r.stream = r.isStream
+		return
+	}
+	r.stream = strings.HasPrefix(contentType, "text/event-stream")
+}
+
+func (r *PIIRehydrator) buffering() bool {
+	return r.decided && !r.stream && !r.finished
+}
+
+func (r *PIIRehydrator) WriteHeader(code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decide()
+	if r.buffering() {
+		r.status = code
+		return
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *PIIRehydrator) WriteHeaderNow() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buffering() {
+		return
+	}
+	r.ResponseWriter.WriteHeaderNow()
+}
+
+func (r *PIIRehydrator) Status() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buffering() && r.status != 0 {
+		return r.status
+	}
+	return r.ResponseWriter.Status()
+}
+
+func (r *PIIRehydrator) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buffering() {
+		return
+	}
+	r.ResponseWriter.Flush()
+}
+
+func (r *PIIRehydrator) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished || (bytes.Equal(p, ssePing) && (!r.decided || r.stream)) {
+		return r.ResponseWriter.Write(p)
+	}
+	r.decide()
+	if !r.stream {
+		return r.body.Write(p)
+	}
+	r.pending = splitSSEEvents(append(r.pending, p...), r.handleEvent)
+	if r.err != nil {
+		return 0, r.err
+	}
+	return len(p), nil
+}
+
+func (r *PIIRehydrator) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
+
+func (r *PIIRehydrator) handleEvent(raw []byte) {
+	event := parseSSETextEvent(raw, r.format)
+	if !event.hasText {
+		r.flushCarry()
+		r.writeThrough(event.raw)
+		return
+	}
+	r.lastTextRaw = event.raw
+	text := r.carry + event.text
+	r.carry = piiPlaceholderSuffix(text)
+	if emit := text[:len(text)-len(r.carry)]; emit != event.text {
+		event.setText(emit)
+	}
+	r.writeThrough(event.raw)
+}
+
+// flushCarry 以最近一个文本事件为模板输出暂存的文本
+func (r *PIIRehydrator) flushCarry() {
+	if r.carry == "" || r.lastTextRaw == nil {
+		return
+	}
+	event := parseSSETextEvent(r.lastTextRaw, r.format)
+	event.setText(r.carry)
+	r.carry = ""
+	r.writeThrough(event.raw)
+}
+
+func (r *PIIRehydrator) writeThrough(raw []byte) {
+	if r.err != nil {
+		return
+	}
+	out := r.session.Rehydrate(string(raw), jsonEscapedString)
+	if _, err := r.ResponseWriter.WriteString(out); err != nil {
+		r.err = err
+	}
+}
+
+// piiPlaceholderSuffix 返回文本末尾可能是不完整占位符的部分
+func piiPlaceholderSuffix(text string) string {
+	idx := strings.LastIndexByte(text, '[')
+	if idx < 0 || len(text)-idx > piiPlaceholderMaxLen {
+		return ""
+	}
+	suffix := text[idx:]
+	if len(suffix) <= len(piiPlaceholderPrefix) {
+		if strings.HasPrefix(piiPlaceholderPrefix, suffix) {
+			return suffix
+		}
+		return ""
+	}
+	if !strings.HasPrefix(suffix, piiPlaceholderPrefix) {
+		return ""
+	}
+	for _, ch := range suffix[len(piiPlaceholderPrefix):] {
+		if !(ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_') {
+			return ""
+		}
+	}
+	return suffix
+}
+
+// Finish 输出剩余内容并恢复原始 Writer，可重复调用
+func (r *PIIRehydrator) Finish() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	r.finished = true
+	r.c.Writer = r.ResponseWriter
+	if r.stream {
+		r.flushCarry()
+		if len(r.pending) > 0 {
+			r.writeThrough(r.pending)
+		}
+		return
+	}
+	if !r.decided {
+		return
+	}
+	var escape func(string) string
+	if strings.Contains(r.ResponseWriter.Header().Get("Content-Type"), "json") {
+		escape = jsonEscapedString
+	}
+	out := r.session.Rehydrate(r.body.String(), escape)
+	if r.ResponseWriter.Header().Get("Content-Length") != "" {
+		r.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	}
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	r.ResponseWriter.WriteHeader(status)
+	_, _ = r.ResponseWriter.WriteString(out)
+}
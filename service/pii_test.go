@@ -0,0 +1,127 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withPIIRedactionSetting(t *testing.T, setting operation_setting.PIIRedactionSetting) {
+	t.Helper()
+	current := operation_setting.GetPIIRedactionSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func allPIIDetectorsSetting() operation_setting.PIIRedactionSetting {
+	return operation_setting.PIIRedactionSetting{
+		Enabled:        true,
+		DefaultEnabled: true,
+		Groups:         map[string]bool{"internal": false},
+		Detectors: []string{
+			operation_setting.PIIDetectorEmail, operation_setting.PIIDetectorPhone, operation_setting.PIIDetectorCreditCard,
+			operation_setting.PIIDetectorNationalId, operation_setting.PIIDetectorApiKey,
+		},
+		Rehydrate: true,
+	}
+}
+
+func TestPIISessionRedactsBuiltInDetectors(t *testing.T) {
+	withPIIRedactionSetting(t, allPIIDetectorsSetting())
+	session := newPIISession()
+
+	redacted := session.Redact("mail alice@example.com or alice@example.com, card 4111 1111 1111 1111, " +
+		"not a card 1234567890123, phone 13812345678, id 11010519491231002X, key sk-abcdefghijklmnopqrstuv")
+	assert.Equal(t, "mail [PII_EMAIL_1] or [PII_EMAIL_1], card [PII_CREDIT_CARD_1], not a card 1234567890123, "+
+		"phone [PII_PHONE_1], id [PII_NATIONAL_ID_1], key [PII_API_KEY_1]", redacted)
+	assert.Equal(t, map[string]int{"email": 2, "credit_card": 1, "phone": 1, "national_id": 1, "api_key": 1}, session.Counts())
+	assert.Equal(t, `say "alice@example.com" [PII_EMAIL_9]`, session.Rehydrate(`say "[PII_EMAIL_1]" [PII_EMAIL_9]`, nil))
+}
+
+func TestRedactRequestPIIRewritesRequestAndBody(t *testing.T) {
+	withPIIRedactionSetting(t, allPIIDetectorsSetting())
+	c, _ := newModerationTestContext(`{}`)
+	request := &dto.ClaudeRequest{
+		Model:  "claude",
+		System: "reply to bob@example.com",
+		Messages: []dto.ClaudeMessage{{Role: "user", Content: []any{
+			map[string]any{"type": "text", "text": "my card is 4111-1111-1111-1111"},
+			map[string]any{"type": "image", "source": map[string]any{"data": "bob@example.com"}},
+		}}},
+	}
+
+	require.Nil(t, RedactRequestPII(c, &relaycommon.RelayInfo{UsingGroup: "default"}, request))
+	assert.Equal(t, "reply to [PII_EMAIL_1]", request.System)
+	parts := request.Messages[0].Content.([]any)
+	assert.Equal(t, "my card is [PII_CREDIT_CARD_1]", parts[0].(map[string]any)["text"])
+	assert.Equal(t, "bob@example.com", parts[1].(map[string]any)["source"].(map[string]any)["data"], "non-text fields are kept")
+
+	storage, err := common.GetBodyStorage(c)
+	require.NoError(t, err)
+	body, _ := storage.Bytes()
+	assert.NotContains(t, string(body), "4111-1111")
+	require.NotNil(t, GetPIISession(c))
+
+	other, _ := newModerationTestContext(`{}`)
+	internal := &dto.ClaudeRequest{System: "reply to bob@example.com"}
+	require.Nil(t, RedactRequestPII(other, &relaycommon.RelayInfo{UsingGroup: "internal"}, internal))
+	assert.Equal(t, "reply to bob@example.com", internal.System, "disabled groups are not redacted")
+}
+
+func TestPIIRehydratorRestoresSplitPlaceholdersInStream(t *testing.T) {
+	withPIIRedactionSetting(t, allPIIDetectorsSetting())
+	c, recorder := newModerationTestContext(`{}`)
+	session := newPIISession()
+	session.Redact("alice@example.com")
+	common.SetContextKey(c, constant.ContextKeyPIISession, session)
+
+	rehydrator := StartPIIRehydration(c, &relaycommon.RelayInfo{IsStream: true, RelayFormat: types.RelayFormatOpenAI})
+	require.NotNil(t, rehydrator)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range []string{"write to [PII_EM", "AIL_1] now", " [PII_"} {
+		_, _ = c.Writer.WriteString(`data: {"choices":[{"index":0,"delta":{"content":"` + chunk + `"}}]}` + "\n\n")
+	}
+	_, _ = c.Writer.WriteString(`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n")
+	_, _ = c.Writer.WriteString("data: [DONE]\n\n")
+	rehydrator.Finish()
+
+	output := recorder.Body.String()
+	assert.NotContains(t, output, "[PII_EMAIL_1]")
+	assert.Contains(t, output, `"content":"write to "`)
+	assert.Contains(t, output, `"content":"alice@example.com now"`)
+	assert.Contains(t, output, `"content":"[PII_"`, "an unfinished prefix is emitted before the next non-text event")
+	assert.Less(t, strings.Index(output, `"[PII_"`), strings.Index(output, `"finish_reason"`))
+}
+
+func TestPIIRehydratorRestoresBufferedResponse(t *testing.T) {
+	withPIIRedactionSetting(t, allPIIDetectorsSetting())
+	c, recorder := newModerationTestContext(`{}`)
+	session := newPIISession()
+	session.Redact(`say "hi" to alice@example.com`)
+	common.SetContextKey(c, constant.ContextKeyPIISession, session)
+
+	rehydrator := StartPIIRehydration(c, &relaycommon.RelayInfo{RelayFormat: types.RelayFormatOpenAI})
+	require.NotNil(t, rehydrator)
+	body := `{"choices":[{"message":{"content":"mail [PII_EMAIL_1]"}}]}`
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.Header().Set("Content-Length", "56")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = c.Writer.Write([]byte(body))
+	assert.Empty(t, recorder.Body.String(), "non-stream responses are buffered until finish")
+	rehydrator.Finish()
+
+	expected := `{"choices":[{"message":{"content":"mail alice@example.com"}}]}`
+	assert.Equal(t, expected, recorder.Body.String())
+	assert.Equal(t, "62", recorder.Header().Get("Content-Length"))
+}
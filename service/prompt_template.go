@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// 服务端提示词模板：请求以 prompt: {id, version, variables} 引用模板（与 Responses API 的写法一致），
+// 网关在转换请求前展开为 system 消息 / instructions，因此对所有渠道类型生效。
+// 未使用 pt_ 前缀的 prompt id 视为上游原生的提示词，原样透传。
+
+// PromptTemplateUsage 本次请求使用的模板版本，写入消费日志并用于版本使用统计
+type PromptTemplateUsage struct {
+	TemplateId int    `json:"id"`
+	PromptId   string `json:"prompt_id"`
+	Version    int    `json:"version"`
+}
+
+// promptTemplateRef 请求中的模板引用
+type promptTemplateRef struct {
+	Id        string                     `json:"id"`
+	Version   json.RawMessage            `json:"version"`
+	Variables map[string]json.RawMessage `json:"variables"`
+}
+
+// parsePromptTemplateRef 解析 prompt 字段，不是模板引用时返回 nil
+func parsePromptTemplateRef(raw []byte) (*promptTemplateRef, error) {
+	if len(raw) == 0 || common.GetJsonType(raw) != "object" {
+		return nil, nil
+	}
+	var ref promptTemplateRef
+	if err := common.Unmarshal(raw, &ref); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(ref.Id, model.PromptTemplateIdPrefix) {
+		return nil, nil
+	}
+	return &ref, nil
+}
+
+// version 返回请求的版本号，未指定或为 latest 时返回 0
+func (ref *promptTemplateRef) version() (int, error) {
+	raw := strings.TrimSpace(string(ref.Version))
+	if raw == "" || raw == "null" {
+		return 0, nil
+	}
+	var text string
+	if err := common.Unmarshal(ref.Version, &text); err == nil {
+		raw = strings.TrimSpace(text)
+	}
+	if raw == "" || raw == "latest" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid prompt version %q", raw)
+	}
+	return version, nil
+}
+
+// values 将变量值统一为文本：字符串原样使用，input_text 对象取 text，其余值使用 JSON 文本
+func (ref *promptTemplateRef) values() map[string]string {
+	values := make(map[string]string, len(ref.Variables))
+	for name, raw := range ref.Variables {
+		var text string
+		if err := common.Unmarshal(raw, &text); err == nil {
+			values[name] = text
+			continue
+		}
+		var input struct {
+			Text *string `json:"text"`
+		}
+		if common.GetJsonType(raw) == "object" && common.Unmarshal(raw, &input) == nil && input.Text != nil {
+			values[name] = *input.Text
+			continue
+		}
+		values[name] = string(raw)
+	}
+	return values
+}
+
+// CanUsePromptTemplate 判断用户能否引用模板：个人模板仅创建者可用，组织模板所有成员可用
+func CanUsePromptTemplate(template *model.PromptTemplate, userId int) bool {
+	if template.OrganizationId == 0 {
+		return template.UserId == userId
+	}
+	_, err := model.GetOrganizationMember(template.OrganizationId, userId)
+	return err == nil
+}
+
+// resolvePromptTemplate 加载并渲染模板引用
+func resolvePromptTemplate(userId int, ref *promptTemplateRef) (string, *PromptTemplateUsage, error) {
+	version, err := ref.version()
+	if err != nil {
+		return "", nil, err
+	}
+	template, err := model.GetPromptTemplateByPromptId(ref.Id)
+	if err != nil {
+		if errors.Is(err, model.ErrPromptTemplateNotFound) {
+			return "", nil, fmt.Errorf("prompt template %s not found", ref.Id)
+		}
+		return "", nil, err
+	}
+	if !CanUsePromptTemplate(template, userId) {
+		return "", nil, fmt.Errorf("prompt template %s not found", ref.Id)
+	}
+	if version == 0 {
+		version = template.LatestVersion
+	}
+	templateVersion, err := model.GetPromptTemplateVersion(template.Id, version)
+	if err != nil {
+		if errors.Is(err, model.ErrPromptTemplateVersionNotFound) {
+			return "", nil, fmt.Errorf("prompt template %s has no version %d", ref.Id, version)
+		}
+		return "", nil, err
+	}
+	text, err := model.RenderPromptTemplate(templateVersion.Content, templateVersion.GetDefaults(), ref.values())
+	if err != nil {
+		return "", nil, err
+	}
+	return text, &PromptTemplateUsage{TemplateId: template.Id, PromptId: template.PromptId, Version: version}, nil
+}
+
+// ExpandPromptTemplate 展开请求中引用的提示词模板。Chat Completions 在消息最前面插入 system 消息，
+// Responses 将模板放在 instructions 之前。展开后的请求体写回 body storage，透传模式同样生效。
+func ExpandPromptTemplate(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) *types.NewAPIError {
+	var raw []byte
+	switch req := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		if req.Prompt == nil {
+			return nil
+		}
+		if _, ok := req.Prompt.(map[string]any); !ok {
+			return nil
+		}
+		raw, _ = common.Marshal(req.Prompt)
+	case *dto.OpenAIResponsesRequest:
+		raw = req.Prompt
+	default:
+		return nil
+	}
+	ref, err := parsePromptTemplateRef(raw)
+	if err != nil {
+		return types.NewErrorWithStatusCode(fmt.Errorf("invalid prompt: %w", err), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if ref == nil {
+		return nil
+	}
+	// 模板只能与字符串形式的 instructions 拼接
+	var instructions string
+	if req, ok := request.(*dto.OpenAIResponsesRequest); ok && len(req.Instructions) > 0 && string(req.Instructions) != "null" {
+		if err := common.Unmarshal(req.Instructions, &instructions); err != nil {
+			return types.NewErrorWithStatusCode(errors.New("instructions must be a string when prompt references a template"), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+	}
+	text, usage, err := resolvePromptTemplate(info.UserId, ref)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	switch req := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		req.Prompt = nil
+		req.Messages = append([]dto.Message{{Role: "system", Content: text}}, req.Messages...)
+	case *dto.OpenAIResponsesRequest:
+		req.Prompt = nil
+		if instructions != "" {
+			text = text + "\n\n" + instructions
+		}
+		if req.Instructions, err = common.Marshal(text); err != nil {
+			return types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+		}
+	}
+	if newAPIError := replaceRequestBodyStorage(c, request); newAPIError != nil {
+		return newAPIError
+	}
+	common.SetContextKey(c, constant.ContextKeyPromptTemplate, usage)
+	return nil
+}
+
+// GetPromptTemplateUsage 返回本次请求使用的模板版本
+func GetPromptTemplateUsage(c *gin.Context) *PromptTemplateUsage {
+	usage, ok := common.GetContextKeyType[*PromptTemplateUsage](c, constant.ContextKeyPromptTemplate)
+	if !ok {
+		return nil
+	}
+	return usage
+}
+
+// recordPromptTemplateUsage 异步累加模板版本的使用统计
+func recordPromptTemplateUsage(c *gin.Context, quota int) {
+	usage := GetPromptTemplateUsage(c)
+	if usage == nil {
+		return
+	}
+	gopool.Go(func() {
+		if err := model.RecordPromptTemplateUsage(usage.TemplateId, usage.Version, quota); err != nil {
+			logger.LogError(c, "failed to record prompt template usage: "+err.Error())
+		}
+	})
+}
+
+// DiffPromptTemplateVersions 以 unified diff 格式比较两个版本的内容
+func DiffPromptTemplateVersions(from *model.PromptTemplateVersion, to *model.PromptTemplateVersion) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from.Content),
+		B:        difflib.SplitLines(to.Content),
+		FromFile: fmt.Sprintf("v%d", from.Version),
+		ToFile:   fmt.Sprintf("v%d", to.Version),
+		Context:  3,
+	})
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePromptTemplateRef(t *testing.T) {
+	ref, err := parsePromptTemplateRef([]byte(`{"id":"pmpt_upstream","version":"2"}`))
+	require.NoError(t, err)
+	assert.Nil(t, ref)
+
+	ref, err = parsePromptTemplateRef([]byte(`{"id":"pt_abc","version":"3","variables":{"name":"Bo","doc":{"type":"input_text","text":"hello"},"n":2}}`))
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	version, err := ref.version()
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.Equal(t, map[string]string{"name": "Bo", "doc": "hello", "n": "2"}, ref.values())
+
+	ref, _ = parsePromptTemplateRef([]byte(`{"id":"pt_abc","version":"latest"}`))
+	version, err = ref.version()
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	ref, _ = parsePromptTemplateRef([]byte(`{"id":"pt_abc","version":"v1"}`))
+	_, err = ref.version()
+	assert.Error(t, err)
+}
+
+func TestDiffPromptTemplateVersions(t *testing.T) {
+	diff, err := DiffPromptTemplateVersions(
+		&model.PromptTemplateVersion{Version: 1, Content: "You are helpful.\nBe brief.\n"},
+		&model.PromptTemplateVersion{Version: 2, Content: "You are helpful.\nBe thorough.\n"},
+	)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "--- v1\n+++ v2\n")
+	assert.Contains(t, diff, "-Be brief.\n+Be thorough.\n")
+}
+
+func TestExpandPromptTemplateRejectsNonStringInstructions(t *testing.T) {
+	request := &dto.OpenAIResponsesRequest{
+		Prompt:       []byte(`{"id":"pt_abc"}`),
+		Instructions: []byte(`[{"type":"input_text","text":"be brief"}]`),
+	}
+	apiErr := ExpandPromptTemplate(nil, &relaycommon.RelayInfo{UserId: 1}, request)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.NotNil(t, request.Prompt, "the request is left untouched")
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const (
+	ResponseCacheHeader = "X-NewAPI-Cache"
+
+	responseCacheNamespace = "new-api:response_cache:v1"
+	responseCacheMemoryCap = 2000
+)
+
+// ResponseCacheEntry 是一次成功响应的完整快照。流式响应保存原始 SSE 字节，命中时按事件回放。
+type ResponseCacheEntry struct {
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Stream      bool      `json:"stream"`
+	Body        []byte    `json:"body"`
+	Usage       dto.Usage `json:"usage"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
+var (
+	responseCacheOnce sync.Once
+	responseCache     *cachex.HybridCache[ResponseCacheEntry]
+)
+
+func getResponseCache() *cachex.HybridCache[ResponseCacheEntry] {
+	responseCacheOnce.Do(func() {
+		responseCache = cachex.NewHybridCache[ResponseCacheEntry](cachex.HybridCacheConfig[ResponseCacheEntry]{
+			Namespace: cachex.Namespace(responseCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ResponseCacheEntry]{},
+			Memory: func() *hot.HotCache[string, ResponseCacheEntry] {
+				return hot.NewHotCache[string, ResponseCacheEntry](hot.LRU, responseCacheMemoryCap).
+					WithTTL(responseCacheTTL()).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return responseCache
+}
+
+func responseCacheTTL() time.Duration {
+	ttl := operation_setting.GetResponseCacheSetting().TTLSeconds
+	if ttl <= 0 {
+		ttl = 3600
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// ResponseCacheKey 计算请求的缓存键，返回空字符串表示该请求不参与缓存。
+// 请求需已完成模型映射；键按用户隔离，并忽略 user/metadata/store 等不影响输出的字段。
+func ResponseCacheKey(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) string {
+	tokenEnabled := common.GetContextKeyBool(c, constant.ContextKeyTokenResponseCache)
+	if !operation_setting.IsResponseCacheEnabledFor(tokenEnabled, info.UsingGroup) {
+		return ""
+	}
+	deterministicOnly := operation_setting.GetResponseCacheSetting().DeterministicOnly
+
+	var normalized any
+	switch req := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		if deterministicOnly && !isZeroTemperature(req.Temperature) {
+			return ""
+		}
+		copied := *req
+		copied.User = nil
+		copied.Metadata = nil
+		copied.Store = nil
+		normalized = &copied
+	case *dto.ClaudeRequest:
+		if deterministicOnly && !isZeroTemperature(req.Temperature) {
+			return ""
+		}
+		copied := *req
+		copied.Metadata = nil
+		normalized = &copied
+	default:
+		return ""
+	}
+
+	payload, err := common.Marshal(normalized)
+	if err != nil {
+		return ""
+	}
+	upstreamModel, systemPrompt := "", ""
+	if info.ChannelMeta != nil {
+		upstreamModel = info.UpstreamModelName
+		systemPrompt = info.ChannelSetting.SystemPrompt
+	}
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s|%d|%s|%s|", info.RelayFormat, info.UserId, upstreamModel, systemPrompt)
+	hash.Write(payload)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isZeroTemperature(temperature *float64) bool {
+	return temperature != nil && *temperature == 0
+}
+
+// GetResponseCache 读取缓存，未命中或出错均返回 false
+func GetResponseCache(key string) (*ResponseCacheEntry, bool) {
+	if key == "" {
+		return nil, false
+	}
+	entry, found, err := getResponseCache().Get(key)
+	if err != nil {
+		common.SysError("failed to read response cache: " + err.Error())
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// ResponseCapture 在转发响应的同时复制一份响应体，成功后写入响应缓存
+type ResponseCapture struct {
+	*captureWriter
+}
+
+// StartResponseCapture 替换 c.Writer 以捕获响应体；结束后须调用 Finish 恢复
+func StartResponseCapture(c *gin.Context) *ResponseCapture {
+	capture := &ResponseCapture{
+		captureWriter: newCaptureWriter(c.Writer, operation_setting.GetResponseCacheSetting().MaxEntryBytes, false, nil),
+	}
+	c.Writer = capture
+	return capture
+}
+
+// Finish 恢复原始 Writer；usage 不为空时表示请求成功，将捕获的响应写入缓存
+func (w *ResponseCapture) Finish(c *gin.Context, key string, info *relaycommon.RelayInfo, usage *dto.Usage) {
+	c.Writer = w.ResponseWriter
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if key == "" || usage == nil || w.truncated || w.body.Len() == 0 || w.Status() != http.StatusOK {
+		return
+	}
+	entry := ResponseCacheEntry{
+		StatusCode:  w.Status(),
+		ContentType: w.Header().Get("Content-Type"),
+		Stream:      info.IsStream,
+		Body:        bytes.Clone(w.body.Bytes()),
+		Usage:       *usage,
+		CreatedAt:   common.GetTimestamp(),
+	}
+	if err := getResponseCache().SetWithTTL(key, entry, responseCacheTTL()); err != nil {
+		common.SysError("failed to write response cache: " + err.Error())
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withResponseCacheSetting(t *testing.T, setting operation_setting.ResponseCacheSetting) {
+	t.Helper()
+	current := operation_setting.GetResponseCacheSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func newResponseCacheTestContext(tokenEnabled bool) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(c, constant.ContextKeyTokenResponseCache, tokenEnabled)
+	return c
+}
+
+func TestResponseCacheKeyNormalizesRequest(t *testing.T) {
+	withResponseCacheSetting(t, operation_setting.ResponseCacheSetting{Enabled: true, Groups: []string{"ci"}, DeterministicOnly: true})
+	info := &relaycommon.RelayInfo{
+		UserId:      1,
+		UsingGroup:  "default",
+		RelayFormat: types.RelayFormatOpenAI,
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gpt-4o"},
+	}
+	request := func(user string, temperature float64) *dto.GeneralOpenAIRequest {
+		return &dto.GeneralOpenAIRequest{
+			Model:       "gpt-4o",
+			Messages:    []dto.Message{{Role: "user", Content: "hi"}},
+			Temperature: common.GetPointer(temperature),
+			User:        []byte(`"` + user + `"`),
+		}
+	}
+
+	c := newResponseCacheTestContext(true)
+	key := ResponseCacheKey(c, info, request("alice", 0))
+	require.NotEmpty(t, key)
+	assert.Equal(t, key, ResponseCacheKey(c, info, request("bob", 0)), "user field is ignored")
+	assert.Empty(t, ResponseCacheKey(c, info, request("alice", 0.7)), "non-deterministic requests are skipped")
+
+	other := *info
+	other.UserId = 2
+	assert.NotEqual(t, key, ResponseCacheKey(c, &other, request("alice", 0)), "keys are scoped per user")
+
+	assert.Empty(t, ResponseCacheKey(newResponseCacheTestContext(false), info, request("alice", 0)), "token not opted in")
+	info.UsingGroup = "ci"
+	assert.Equal(t, key, ResponseCacheKey(newResponseCacheTestContext(false), info, request("alice", 0)), "group opt-in")
+}
+
+func TestResponseCaptureStoresSuccessfulResponse(t *testing.T) {
+	withResponseCacheSetting(t, operation_setting.ResponseCacheSetting{Enabled: true, TTLSeconds: 60, MaxEntryBytes: 1024})
+	c := newResponseCacheTestContext(true)
+	original := c.Writer
+	info := &relaycommon.RelayInfo{IsStream: true}
+
+	capture := StartResponseCapture(c)
+	c.Status(http.StatusOK)
+	_, _ = c.Writer.WriteString("data: {\"id\":1}\n\n")
+	_, _ = c.Writer.Write(ssePing)
+	_, _ = c.Writer.WriteString("data: [DONE]\n\n")
+	capture.Finish(c, "capture-test", info, &dto.Usage{PromptTokens: 3, CompletionTokens: 2})
+	assert.Equal(t, original, c.Writer)
+
+	entry, ok := GetResponseCache("capture-test")
+	require.True(t, ok)
+	assert.True(t, entry.Stream)
+	assert.Equal(t, "data: {\"id\":1}\n\ndata: [DONE]\n\n", string(entry.Body))
+	assert.Equal(t, 2, entry.Usage.CompletionTokens)
+
+	capture = StartResponseCapture(c)
+	_, _ = c.Writer.Write(make([]byte, 2048))
+	capture.Finish(c, "capture-overflow", info, &dto.Usage{})
+	_, ok = GetResponseCache("capture-overflow")
+	assert.False(t, ok, "oversized responses are not cached")
+}
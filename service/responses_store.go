@@ -0,0 +1,370 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Responses API 会话状态：上游不支持 Responses 状态的渠道由网关保存响应，
+// 请求携带 previous_response_id 时在转换前展开为完整的历史输入。
+
+// 历史中可回放给模型的输出项类型，推理、内置工具调用等其余输出项不参与回放
+var replayableResponsesOutputTypes = map[string]bool{
+	"message":          true,
+	"function_call":    true,
+	"custom_tool_call": true,
+}
+
+// ShouldManageResponsesState 判断本次 Responses 请求是否由网关管理会话状态
+func ShouldManageResponsesState(info *relaycommon.RelayInfo) bool {
+	return operation_setting.IsResponsesStoreEnabled() &&
+		info.RelayMode == relayconstant.RelayModeResponses &&
+		!common.IsNativeResponsesAPIType(info.ApiType)
+}
+
+// ResponsesStateTurn 本轮请求的状态，响应成功后据此保存
+type ResponsesStateTurn struct {
+	PreviousResponseId string
+	InputItems         []json.RawMessage
+	Store              bool
+
+	capture *responsesStateCapture
+}
+
+// PrepareResponsesState 记录本轮输入，并将 previous_response_id 展开为历史输入项
+func PrepareResponsesState(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) (*ResponsesStateTurn, *types.NewAPIError) {
+	items, err := normalizeResponsesInput(request.Input)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	turn := &ResponsesStateTurn{
+		PreviousResponseId: strings.TrimSpace(request.PreviousResponseID),
+		InputItems:         items,
+		Store:              isResponsesStoreRequested(request.Store),
+	}
+	if turn.PreviousResponseId == "" {
+		return turn, nil
+	}
+	history, err := loadResponsesHistory(info.UserId, turn.PreviousResponseId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, types.NewErrorWithStatusCode(
+				fmt.Errorf("previous response with id '%s' not found", turn.PreviousResponseId),
+				types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	input, err := common.Marshal(append(history, items...))
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	request.Input = input
+	request.PreviousResponseID = ""
+	return turn, nil
+}
+
+// isResponsesStoreRequested store 未指定时默认保存，与 OpenAI 一致
+func isResponsesStoreRequested(raw json.RawMessage) bool {
+	var store bool
+	if len(raw) == 0 || common.Unmarshal(raw, &store) != nil {
+		return true
+	}
+	return store
+}
+
+// normalizeResponsesInput 将 input 统一为输入项数组，字符串视为一条用户消息
+func normalizeResponsesInput(raw json.RawMessage) ([]json.RawMessage, error) {
+	switch common.GetJsonType(raw) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{
+			"type": "message",
+			"role": "user",
+			"content": []map[string]any{
+				{"type": "input_text", "text": text},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	case "array":
+		var items []json.RawMessage
+		if err := common.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+		return items, nil
+	case "null", "unknown":
+		return nil, nil
+	default:
+		return nil, errors.New("input must be a string or an array of input items")
+	}
+}
+
+// loadResponsesHistory 沿 previous_response_id 向前追溯，按时间顺序返回历史输入项和可回放的输出项
+func loadResponsesHistory(userId int, responseId string) ([]json.RawMessage, error) {
+	maxDepth := operation_setting.GetResponsesStoreSetting().GetMaxChainDepth()
+	var chain []*model.StoredResponse
+	for id := responseId; id != "" && len(chain) < maxDepth; {
+		stored, err := model.GetUserStoredResponse(userId, id)
+		if err != nil {
+			if len(chain) > 0 && errors.Is(err, gorm.ErrRecordNotFound) {
+				// 更早的响应已过期或被删除，从已有的部分开始
+				break
+			}
+			return nil, err
+		}
+		chain = append(chain, stored)
+		id = stored.PreviousResponseId
+	}
+
+	var history []json.RawMessage
+	for i := len(chain) - 1; i >= 0; i-- {
+		inputItems, err := chain[i].GetInputItems()
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, inputItems...)
+		outputItems, err := storedResponseOutputItems(chain[i])
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, outputItems...)
+	}
+	return history, nil
+}
+
+func storedResponseOutputItems(stored *model.StoredResponse) ([]json.RawMessage, error) {
+	var response struct {
+		Output []json.RawMessage `json:"output"`
+	}
+	if err := common.UnmarshalJsonStr(stored.Response, &response); err != nil {
+		return nil, err
+	}
+	items := make([]json.RawMessage, 0, len(response.Output))
+	for _, item := range response.Output {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		if common.Unmarshal(item, &typed) == nil && replayableResponsesOutputTypes[typed.Type] {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// responsesStateCapture 转发响应的同时提取最终的响应对象：
+// 非流式保存完整响应体，流式只保留 response.completed / response.incomplete 事件
+type responsesStateCapture struct {
+	*captureWriter
+	final []byte
+}
+
+func newResponsesStateCapture(w gin.ResponseWriter, stream bool, limit int) *responsesStateCapture {
+	capture := &responsesStateCapture{}
+	capture.captureWriter = newCaptureWriter(w, limit, stream, capture.inspectLine)
+	return capture
+}
+
+// StartCapture 替换 c.Writer 以捕获最终响应；结束后须调用 Finish 恢复
+func (turn *ResponsesStateTurn) StartCapture(c *gin.Context, info *relaycommon.RelayInfo) {
+	if !turn.Store {
+		return
+	}
+	turn.capture = newResponsesStateCapture(c.Writer, info.IsStream, operation_setting.GetResponsesStoreSetting().MaxResponseBytes)
+	c.Writer = turn.capture
+}
+
+func (w *responsesStateCapture) inspectLine(line []byte) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if !bytes.Contains(data, []byte(`"response.completed"`)) && !bytes.Contains(data, []byte(`"response.incomplete"`)) {
+		return
+	}
+	var event struct {
+		Type     string          `json:"type"`
+		Response json.RawMessage `json:"response"`
+	}
+	if common.Unmarshal(data, &event) != nil {
+		return
+	}
+	if event.Type == "response.completed" || event.Type == "response.incomplete" {
+		w.final = bytes.Clone(event.Response)
+	}
+}
+
+func (w *responsesStateCapture) response() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Status() != http.StatusOK {
+		return nil
+	}
+	if w.stream {
+		return w.final
+	}
+	if w.truncated {
+		return nil
+	}
+	return bytes.Clone(w.body.Bytes())
+}
+
+// Finish 恢复原始 Writer；success 为 true 时保存本轮响应，保存失败只记录日志
+func (turn *ResponsesStateTurn) Finish(c *gin.Context, info *relaycommon.RelayInfo, success bool) {
+	if turn == nil || turn.capture == nil {
+		return
+	}
+	c.Writer = turn.capture.ResponseWriter
+	body := turn.capture.response()
+	turn.capture = nil
+	if !success || len(body) == 0 {
+		return
+	}
+	if err := turn.save(c, info, body); err != nil {
+		logger.LogError(c, "failed to store response: "+err.Error())
+	}
+}
+
+func (turn *ResponsesStateTurn) save(c *gin.Context, info *relaycommon.RelayInfo, body []byte) error {
+	var response map[string]json.RawMessage
+	if err := common.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	var header struct {
+		Id     string `json:"id"`
+		Model  string `json:"model"`
+		Status string `json:"status"`
+	}
+	if err := common.Unmarshal(body, &header); err != nil {
+		return err
+	}
+	if header.Id == "" {
+		return errors.New("response has no id")
+	}
+	// 还原转换过程中丢失的会话字段
+	previous, _ := common.Marshal(turn.PreviousResponseId)
+	if turn.PreviousResponseId == "" {
+		previous = []byte("null")
+	}
+	response["previous_response_id"] = previous
+	response["store"] = []byte("true")
+	responseJSON, err := common.Marshal(response)
+	if err != nil {
+		return err
+	}
+	inputItems := turn.InputItems
+	if inputItems == nil {
+		inputItems = []json.RawMessage{}
+	}
+	inputJSON, err := common.Marshal(inputItems)
+	if err != nil {
+		return err
+	}
+	stored := &model.StoredResponse{
+		ResponseId:         header.Id,
+		UserId:             info.UserId,
+		TokenId:            info.TokenId,
+		PreviousResponseId: turn.PreviousResponseId,
+		Model:              header.Model,
+		Status:             header.Status,
+		InputItems:         string(inputJSON),
+		Response:           string(responseJSON),
+	}
+	if hours := operation_setting.GetResponsesStoreSetting().TTLHours; hours > 0 {
+		stored.ExpiresAt = common.GetTimestamp() + int64(hours)*3600
+	}
+	return stored.Insert()
+}
+
+// ListStoredResponseInputItems 按 OpenAI 的游标分页语义列出响应的输入项，
+// 没有 id 的输入项按位置补全 id，after 为上一页最后一项的 id
+func ListStoredResponseInputItems(stored *model.StoredResponse, after string, limit int, ascending bool) ([]map[string]any, bool, error) {
+	raws, err := stored.GetInputItems()
+	if err != nil {
+		return nil, false, err
+	}
+	items := make([]map[string]any, 0, len(raws))
+	for i, raw := range raws {
+		item := map[string]any{}
+		if err := common.Unmarshal(raw, &item); err != nil {
+			return nil, false, err
+		}
+		if id, _ := item["id"].(string); id == "" {
+			item["id"] = fmt.Sprintf("%s_input_%d", stored.ResponseId, i)
+		}
+		if _, ok := item["type"]; !ok {
+			item["type"] = "message"
+		}
+		items = append(items, item)
+	}
+	if !ascending {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if after != "" {
+		start := -1
+		for i, item := range items {
+			if item["id"] == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, false, gorm.ErrRecordNotFound
+		}
+		items = items[start:]
+	}
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	return items, hasMore, nil
+}
+
+const expiredResponseCleanupBatchSize = 500
+
+// ResponseCleanupSummary 过期响应清理结果
+type ResponseCleanupSummary struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// RunExpiredResponseCleanupOnce 分批删除已过期的响应
+func RunExpiredResponseCleanupOnce(ctx context.Context) (ResponseCleanupSummary, error) {
+	summary := ResponseCleanupSummary{}
+	for {
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+		deleted, err := model.DeleteExpiredStoredResponses(expiredResponseCleanupBatchSize)
+		if err != nil {
+			return summary, err
+		}
+		summary.Deleted += deleted
+		if deleted < expiredResponseCleanupBatchSize {
+			return summary, nil
+		}
+	}
+}
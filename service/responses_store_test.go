@@ -0,0 +1,66 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeResponsesInput(t *testing.T) {
+	items, err := normalizeResponsesInput([]byte(`"hi"`))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.JSONEq(t, `{"type":"message","role":"user","content":[{"type":"input_text","text":"hi"}]}`, string(items[0]))
+
+	items, err = normalizeResponsesInput([]byte(`[{"role":"user","content":"a"},{"type":"function_call_output","call_id":"c1","output":"x"}]`))
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	items, err = normalizeResponsesInput(nil)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	_, err = normalizeResponsesInput([]byte(`42`))
+	assert.Error(t, err)
+}
+
+func TestResponsesStateCaptureKeepsFinalStreamResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	capture := newResponsesStateCapture(c.Writer, true, 1<<20)
+
+	_, _ = capture.WriteString("event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"r1\",\"status\":\"in_progress\"}}\n\n")
+	_, _ = capture.WriteString("event: response.completed\ndata: {\"type\":\"response.comp")
+	_, _ = capture.WriteString("leted\",\"response\":{\"id\":\"r1\",\"status\":\"completed\"}}\n\n")
+
+	assert.JSONEq(t, `{"id":"r1","status":"completed"}`, string(capture.response()))
+}
+
+func TestListStoredResponseInputItems(t *testing.T) {
+	stored := &model.StoredResponse{
+		ResponseId: "resp_1",
+		InputItems: `[{"role":"user","content":"a"},{"id":"msg_b","type":"message","role":"user","content":"b"},{"role":"user","content":"c"}]`,
+	}
+
+	items, hasMore, err := ListStoredResponseInputItems(stored, "", 2, false)
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	require.Len(t, items, 2)
+	assert.Equal(t, "resp_1_input_2", items[0]["id"])
+	assert.Equal(t, "message", items[0]["type"])
+	assert.Equal(t, "msg_b", items[1]["id"])
+
+	items, hasMore, err = ListStoredResponseInputItems(stored, "msg_b", 2, false)
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	require.Len(t, items, 1)
+	assert.Equal(t, "resp_1_input_0", items[0]["id"])
+
+	_, _, err = ListStoredResponseInputItems(stored, "missing", 2, true)
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+const secretRotationBatchSize = 200
+
+// SecretRotationSummary 密钥轮换结果：Scanned 为扫描的记录数，Rotated 为加密或重新包装的记录数，
+// Failed 为无法解密的记录数（通常是旧主密钥在轮换完成前被移除）
+type SecretRotationSummary struct {
+	MasterKeyId string `json:"master_key_id"`
+	Scanned     int    `json:"scanned"`
+	Rotated     int    `json:"rotated"`
+	Failed      int    `json:"failed"`
+}
+
+func (s *SecretRotationSummary) add(batch model.SecretRotationBatch) {
+	s.Scanned += batch.Scanned
+	s.Rotated += batch.Rotated
+	s.Failed += batch.Failed
+}
+
+// RunSecretRotationOnce 分批把敏感字段迁移到当前主密钥：明文记录被加密，旧主密钥包装的数据密钥被重新包装。
+// 全部完成且 Failed 为 0 后即可从配置中移除旧主密钥
+func RunSecretRotationOnce(ctx context.Context, report func(processed, total int)) (SecretRotationSummary, error) {
+	summary := SecretRotationSummary{}
+	if !common.SecretEncryptionEnabled() {
+		return summary, fmt.Errorf("secret encryption is not configured")
+	}
+	summary.MasterKeyId = common.GetSecretPrimaryKeyId()
+	total, err := model.CountSecretRotationRows()
+	if err != nil {
+		return summary, err
+	}
+
+	for _, rotateBatch := range []func(afterId int, limit int) (model.SecretRotationBatch, error){
+		model.RotateChannelKeySecrets,
+		model.RotateCustomOAuthProviderSecrets,
+	} {
+		afterId := 0
+		for {
+			if ctx.Err() != nil {
+				return summary, ctx.Err()
+			}
+			batch, err := rotateBatch(afterId, secretRotationBatchSize)
+			summary.add(batch)
+			if err != nil {
+				return summary, err
+			}
+			if report != nil {
+				report(summary.Scanned, int(total))
+			}
+			if batch.Scanned < secretRotationBatchSize {
+				break
+			}
+			afterId = batch.LastId
+		}
+	}
+
+	batch, err := model.RotateOptionSecrets()
+	summary.add(batch)
+	if err != nil {
+		return summary, err
+	}
+	if report != nil {
+		report(int(total), int(total))
+	}
+	if summary.Failed > 0 {
+		return summary, fmt.Errorf("%d secrets could not be decrypted with the configured master keys", summary.Failed)
+	}
+	return summary, nil
+}
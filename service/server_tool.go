@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+)
+
+// 网关代执行的工具（远程 MCP 工具、模拟的内置工具）以函数工具的形式交给上游，
+// 上游返回对应的函数调用时由网关执行，结果以原生工具调用条目回显给客户端。
+
+// ServerTool 一个可由网关代执行的工具
+type ServerTool struct {
+	FunctionName string          // 暴露给上游的函数名
+	Description  string          // 函数描述
+	Parameters   json.RawMessage // 函数参数 JSON Schema
+	ItemType     string          // 回显条目类型：mcp_call / web_search_call / code_interpreter_call
+	ServerLabel  string          // MCP 服务标签，仅 mcp_call 使用
+	Name         string          // 回显的工具名
+	maxRounds    int
+	execute      func(ctx context.Context, info *relaycommon.RelayInfo, call *ServerToolCall)
+}
+
+// ServerToolCall 一次代执行的工具调用
+type ServerToolCall struct {
+	CallId      string
+	ItemType    string
+	ServerLabel string
+	Name        string
+	Arguments   string
+	Output      string
+	Error       string
+	done        bool
+}
+
+// NewCall 创建尚未执行的调用记录，用于在执行前向客户端推送进行中事件
+func (t *ServerTool) NewCall(callId string, arguments string) *ServerToolCall {
+	return &ServerToolCall{
+		CallId:      callId,
+		ItemType:    t.ItemType,
+		ServerLabel: t.ServerLabel,
+		Name:        t.Name,
+		Arguments:   arguments,
+	}
+}
+
+// Execute 执行工具调用。执行失败不会中断请求，错误信息作为工具输出交给模型处理。
+func (t *ServerTool) Execute(ctx context.Context, info *relaycommon.RelayInfo, call *ServerToolCall) {
+	t.execute(ctx, info, call)
+	call.done = true
+}
+
+func (c *ServerToolCall) fail(err error) {
+	c.Error = err.Error()
+	c.Output = "Error: " + c.Error
+}
+
+func (t *ServerTool) parameters() json.RawMessage {
+	if len(t.Parameters) == 0 {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return t.Parameters
+}
+
+// ServerToolset 一次请求中可由网关代执行的工具
+type ServerToolset struct {
+	tools []*ServerTool
+	index map[string]*ServerTool
+}
+
+// NewServerToolset 创建空工具集
+func NewServerToolset() *ServerToolset {
+	return &ServerToolset{index: make(map[string]*ServerTool)}
+}
+
+// Add 加入工具，同名函数只保留第一个
+func (t *ServerToolset) Add(tool *ServerTool) {
+	if _, exists := t.index[tool.FunctionName]; exists {
+		return
+	}
+	t.tools = append(t.tools, tool)
+	t.index[tool.FunctionName] = tool
+}
+
+// Len 返回工具数量
+func (t *ServerToolset) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.tools)
+}
+
+// Lookup 按函数名查找工具
+func (t *ServerToolset) Lookup(functionName string) *ServerTool {
+	if t == nil {
+		return nil
+	}
+	return t.index[functionName]
+}
+
+// MaxRounds 返回工具调用轮数上限，取各类工具配置中的最大值
+func (t *ServerToolset) MaxRounds() int {
+	rounds := 1
+	for _, tool := range t.tools {
+		if tool.maxRounds > rounds {
+			rounds = tool.maxRounds
+		}
+	}
+	return rounds
+}
+
+// ResponsesTools 返回 Responses API 格式的函数工具定义
+func (t *ServerToolset) ResponsesTools() []json.RawMessage {
+	tools := make([]json.RawMessage, 0, len(t.tools))
+	for _, tool := range t.tools {
+		data, err := common.Marshal(map[string]any{
+			"type":        "function",
+			"name":        tool.FunctionName,
+			"description": tool.Description,
+			"parameters":  tool.parameters(),
+		})
+		if err == nil {
+			tools = append(tools, data)
+		}
+	}
+	return tools
+}
+
+// ChatTools 返回 Chat Completions 格式的函数工具定义
+func (t *ServerToolset) ChatTools() []dto.ToolCallRequest {
+	tools := make([]dto.ToolCallRequest, 0, len(t.tools))
+	for _, tool := range t.tools {
+		tools = append(tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.FunctionName,
+				Description: tool.Description,
+				Parameters:  tool.parameters(),
+			},
+		})
+	}
+	return tools
+}
+
+// ItemId 返回回显条目的 id
+func (c *ServerToolCall) ItemId() string {
+	switch c.ItemType {
+	case dto.BuildInCallWebSearchCall:
+		return "ws_" + c.CallId
+	case dto.BuildInCallCodeInterpreterCall:
+		return "ci_" + c.CallId
+	default:
+		return "mcp_" + c.CallId
+	}
+}
+
+// Status 返回调用状态：in_progress / completed / failed
+func (c *ServerToolCall) Status() string {
+	if !c.done {
+		return "in_progress"
+	}
+	if c.Error != "" {
+		return "failed"
+	}
+	return "completed"
+}
+
+// ResponsesItem 以上游原生工具的输出条目格式回显本次调用
+func (c *ServerToolCall) ResponsesItem() map[string]any {
+	item := map[string]any{
+		"type": c.ItemType,
+		"id":   c.ItemId(),
+	}
+	var args map[string]any
+	_ = common.UnmarshalJsonStr(c.Arguments, &args)
+	switch c.ItemType {
+	case dto.BuildInCallWebSearchCall:
+		item["status"] = c.Status()
+		item["action"] = map[string]any{"type": "search", "query": common.Interface2String(args["query"])}
+	case dto.BuildInCallCodeInterpreterCall:
+		item["status"] = c.Status()
+		item["code"] = common.Interface2String(args["code"])
+		item["container_id"] = ""
+		outputs := []map[string]any{}
+		if c.done {
+			outputs = append(outputs, map[string]any{"type": "logs", "logs": c.Output})
+		}
+		item["outputs"] = outputs
+	default:
+		item["server_label"] = c.ServerLabel
+		item["name"] = c.Name
+		item["arguments"] = c.Arguments
+		if c.done {
+			item["output"] = c.Output
+		}
+		if c.Error != "" {
+			item["error"] = c.Error
+		}
+	}
+	return item
+}
+
+// ResolveResponsesServerTools 从 Responses 请求的 tools 中取出可由网关代执行的工具，其余工具原样返回。
+// 当前渠道未开启任何代执行能力时返回 nil 工具集。
+func ResolveResponsesServerTools(ctx context.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) (*ServerToolset, []json.RawMessage, error) {
+	executeMcp := ShouldExecuteMcpServerSide(info)
+	emulateBuiltin := ShouldEmulateBuiltinTools(info)
+	if len(request.Tools) == 0 || (!executeMcp && !emulateBuiltin) {
+		return nil, nil, nil
+	}
+	var rest []json.RawMessage
+	if err := common.Unmarshal(request.Tools, &rest); err != nil {
+		return nil, nil, nil
+	}
+	toolset := NewServerToolset()
+	if executeMcp {
+		var specs []McpToolSpec
+		specs, rest = SplitResponsesMcpTools(request.Tools)
+		if err := AddMcpTools(ctx, toolset, info.UsingGroup, specs); err != nil {
+			return nil, nil, err
+		}
+	}
+	if emulateBuiltin {
+		var kinds []string
+		kinds, rest = SplitResponsesBuiltinTools(rest)
+		AddEmulatedBuiltinTools(toolset, kinds)
+	}
+	if toolset.Len() > 0 && isServerToolChoice(request.ToolChoice) {
+		request.ToolChoice = json.RawMessage(`"required"`)
+	}
+	return toolset, rest, nil
+}
+
+// ResolveChatServerTools 从 Chat Completions 请求中取出可由网关代执行的工具，其余工具原样返回。
+// web_search_options 视为声明了 web_search_preview，模拟时从请求中移除。
+func ResolveChatServerTools(ctx context.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*ServerToolset, []dto.ToolCallRequest, error) {
+	executeMcp := ShouldExecuteMcpServerSide(info)
+	emulateBuiltin := ShouldEmulateBuiltinTools(info)
+	if !executeMcp && !emulateBuiltin {
+		return nil, nil, nil
+	}
+	rest := request.Tools
+	toolset := NewServerToolset()
+	if executeMcp {
+		var specs []McpToolSpec
+		specs, rest = SplitChatMcpTools(rest)
+		if err := AddMcpTools(ctx, toolset, info.UsingGroup, specs); err != nil {
+			return nil, nil, err
+		}
+	}
+	if emulateBuiltin {
+		var kinds []string
+		kinds, rest = SplitChatBuiltinTools(rest)
+		if request.WebSearchOptions != nil && isBuiltinToolEmulated(dto.BuildInToolWebSearchPreview) {
+			kinds = append(kinds, dto.BuildInToolWebSearchPreview)
+			request.WebSearchOptions = nil
+		}
+		for _, kind := range kinds {
+			info.DeclareBuiltInTool(kind)
+		}
+		AddEmulatedBuiltinTools(toolset, kinds)
+	}
+	if toolset.Len() > 0 && request.ToolChoice != nil {
+		if choice, err := common.Marshal(request.ToolChoice); err == nil && isServerToolChoice(choice) {
+			request.ToolChoice = "required"
+		}
+	}
+	return toolset, rest, nil
+}
+
+// isServerToolChoice 判断 tool_choice 是否指定了改由网关代执行的工具类型，
+// 这类工具在上游只存在对应的函数工具，改为 required 让模型自行选择
+func isServerToolChoice(raw []byte) bool {
+	var choice struct {
+		Type string `json:"type"`
+	}
+	if len(raw) == 0 || common.GetJsonType(raw) != "object" || common.Unmarshal(raw, &choice) != nil {
+		return false
+	}
+	return choice.Type == McpToolType || builtinToolKind(choice.Type) != ""
+}
+
+func truncateToolOutput(output string, limit int) string {
+	if limit <= 0 {
+		return output
+	}
+	runes := []rune(output)
+	if len(runes) <= limit {
+		return output
+	}
+	return string(runes[:limit]) + "\n[output truncated]"
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/relaykit/types"
+)
+
+// sseTextEvent 是一个完整的 SSE 事件，文本增量可以被改写后重新生成事件数据
+type sseTextEvent struct {
+	raw     []byte
+	payload map[string]any
+	text    string
+	hasText bool
+	setter  func(string)
+}
+
+// parseSSETextEvent 按下游格式提取事件中的输出文本：
+// OpenAI 为 choices[0].delta.content，Claude 为 text_delta 的 delta.text，
+// Responses 为 response.output_text.delta 的 delta，Gemini 为 candidates[0].content.parts 中的 text。
+func parseSSETextEvent(raw []byte, format types.RelayFormat) *sseTextEvent {
+	event := &sseTextEvent{raw: raw}
+	data, ok := sseEventData(raw)
+	if !ok || data == "[DONE]" {
+		return event
+	}
+	var payload map[string]any
+	if err := common.UnmarshalJsonStr(data, &payload); err != nil {
+		return event
+	}
+	event.payload = payload
+	event.text, event.setter = sseEventText(payload, format)
+	event.hasText = event.setter != nil
+	return event
+}
+
+func sseEventData(raw []byte) (string, bool) {
+	for _, line := range strings.Split(string(raw), "\n") {
+		if strings.HasPrefix(line, "data:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "data:")), true
+		}
+	}
+	return "", false
+}
+
+func sseEventText(payload map[string]any, format types.RelayFormat) (string, func(string)) {
+	switch format {
+	case types.RelayFormatClaude:
+		if payload["type"] != "content_block_delta" {
+			return "", nil
+		}
+		delta, _ := payload["delta"].(map[string]any)
+		if delta == nil || delta["type"] != "text_delta" {
+			return "", nil
+		}
+		return stringField(delta, "text")
+	case types.RelayFormatOpenAIResponses:
+		if payload["type"] != "response.output_text.delta" {
+			return "", nil
+		}
+		return stringField(payload, "delta")
+	case types.RelayFormatGemini:
+		candidates, _ := payload["candidates"].([]any)
+		if len(candidates) == 0 {
+			return "", nil
+		}
+		candidate, _ := candidates[0].(map[string]any)
+		content, _ := candidate["content"].(map[string]any)
+		parts, _ := content["parts"].([]any)
+		for _, part := range parts {
+			if partMap, ok := part.(map[string]any); ok && partMap["thought"] != true {
+				if text, setter := stringField(partMap, "text"); setter != nil {
+					return text, setter
+				}
+			}
+		}
+		return "", nil
+	default:
+		choices, _ := payload["choices"].([]any)
+		if len(choices) == 0 {
+			return "", nil
+		}
+		choice, _ := choices[0].(map[string]any)
+		delta, _ := choice["delta"].(map[string]any)
+		if delta == nil {
+			return "", nil
+		}
+		return stringField(delta, "content")
+	}
+}
+
+func stringField(object map[string]any, key string) (string, func(string)) {
+	text, ok := object[key].(string)
+	if !ok {
+		return "", nil
+	}
+	return text, func(value string) {
+		object[key] = value
+	}
+}
+
+// setText 改写事件中的输出文本并重新生成事件数据，data 之前的行（例如 event:）保持不变
+func (e *sseTextEvent) setText(text string) {
+	if !e.hasText {
+		return
+	}
+	e.setter(text)
+	e.text = text
+	data, err := common.Marshal(e.payload)
+	if err != nil {
+		return
+	}
+	var builder strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(string(e.raw), "\n"), "\n") {
+		if strings.HasPrefix(line, "data:") {
+			builder.WriteString("data: ")
+			builder.Write(data)
+		} else {
+			builder.WriteString(line)
+		}
+		builder.WriteString("\n")
+	}
+	builder.WriteString("\n")
+	e.raw = []byte(builder.String())
+}
+
+// splitSSEEvents 从缓冲区中取出完整的事件，返回剩余的不完整数据
+func splitSSEEvents(pending []byte, handle func(raw []byte)) []byte {
+	for {
+		idx := bytes.Index(pending, []byte("\n\n"))
+		if idx < 0 {
+			return pending
+		}
+		raw := bytes.Clone(pending[:idx+2])
+		pending = pending[idx+2:]
+		handle(raw)
+	}
+}
@@ -86,8 +86,16 @@ func taskIsSubscription(task *model.Task) bool {
 	return task.PrivateData.BillingSource == BillingSourceSubscription && task.PrivateData.SubscriptionId > 0
 }
 
-// taskAdjustFunding 调整任务的资金来源（钱包或订阅），delta > 0 表示扣费，delta < 0 表示退还。
+// taskIsOrganization 判断任务是否通过组织额度池计费。
+func taskIsOrganization(task *model.Task) bool {
+	return task.PrivateData.BillingSource == BillingSourceOrganization && task.PrivateData.OrganizationId > 0
+}
+
+// taskAdjustFunding 调整任务的资金来源（钱包、订阅或组织），delta > 0 表示扣费，delta < 0 表示退还。
 func taskAdjustFunding(task *model.Task, delta int) error {
+	if taskIsOrganization(task) {
+		return model.ConsumeOrganizationQuota(task.PrivateData.OrganizationId, task.UserId, delta, false)
+	}
 	if taskIsSubscription(task) {
 		return model.PostConsumeUserSubscriptionDelta(task.PrivateData.SubscriptionId, int64(delta))
 	}
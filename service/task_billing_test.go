@@ -38,6 +38,8 @@ func TestMain(m *testing.M) {
 	common.RedisEnabled = false
 	common.BatchUpdateEnabled = false
 	common.LogConsumeEnabled = true
+	// 未配置 LOG_SQL_DSN 时只初始化列名（key、group 等保留字的引用方式）
+	_ = model.InitLogDB()
 
 	if err := db.AutoMigrate(
 		&model.Task{},
@@ -49,6 +51,14 @@ func TestMain(m *testing.M) {
 		&model.UserSubscription{},
 		&model.SystemTask{},
 		&model.SystemTaskLock{},
+		&model.GeminiResource{},
+		&model.TaskCallback{},
+		&model.MediaAsset{},
+		&model.PayloadCapture{},
+		&model.Batch{},
+		&model.File{},
+		&model.Organization{},
+		&model.OrganizationMember{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -72,6 +82,13 @@ func truncate(t *testing.T) {
 		model.DB.Exec("DELETE FROM user_subscriptions")
 		model.DB.Exec("DELETE FROM system_task_locks")
 		model.DB.Exec("DELETE FROM system_tasks")
+		model.DB.Exec("DELETE FROM task_callbacks")
+		model.DB.Exec("DELETE FROM media_assets")
+		model.DB.Exec("DELETE FROM payload_captures")
+		model.DB.Exec("DELETE FROM batches")
+		model.DB.Exec("DELETE FROM files")
+		model.DB.Exec("DELETE FROM organizations")
+		model.DB.Exec("DELETE FROM organization_members")
 	})
 }
 
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaskCallbackFormatOpenAIVideo 通过 /v1/videos 提交的任务，回调负载与 /v1/videos/{id} 查询结果一致
+const TaskCallbackFormatOpenAIVideo = "openai_video"
+
+const (
+	taskCallbackURLMaxLength       = 512
+	taskCallbackDeliveryBatchSize  = 100
+	taskCallbackCleanupBatchSize   = 500
+	taskCallbackLastErrorMaxLength = 500
+)
+
+// TaskCallbackPayloadFunc 由 main 包注入，按任务查询接口的返回格式生成回调负载。
+// 打破 service -> relay 的循环依赖。
+var TaskCallbackPayloadFunc func(task *model.Task) ([]byte, error)
+
+// MidjourneyCallbackPayloadFunc 由 main 包注入，按 /mj/task/{id}/fetch 的返回格式生成回调负载
+var MidjourneyCallbackPayloadFunc func(task *model.Midjourney) ([]byte, error)
+
+// taskCallbackRequest 提交请求中可携带回调地址的字段，callback_url 通用，
+// notify_hook 与 notifyHook 分别兼容 Suno 与 Midjourney 客户端原有写法
+type taskCallbackRequest struct {
+	CallbackUrl    string `json:"callback_url"`
+	SunoNotifyHook string `json:"notify_hook"`
+	MjNotifyHook   string `json:"notifyHook"`
+}
+
+// ValidateTaskCallbackURL 校验回调地址：必须是 http(s) 且通过 SSRF 防护
+func ValidateTaskCallbackURL(callbackURL string) error {
+	if len(callbackURL) > taskCallbackURLMaxLength {
+		return fmt.Errorf("callback url exceeds %d characters", taskCallbackURLMaxLength)
+	}
+	parsed, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("callback url must be an http or https url")
+	}
+	return ValidateSSRFProtectedFetchURL(callbackURL)
+}
+
+// ResolveTaskCallbackURL 解析提交请求的回调地址：优先使用请求体中的地址，否则使用令牌配置的默认地址。
+// 未启用任务回调时返回空串；请求体中的地址不合法时返回错误，令牌地址已在保存时校验
+func ResolveTaskCallbackURL(c *gin.Context) (string, error) {
+	if !operation_setting.IsTaskCallbackEnabled() {
+		return "", nil
+	}
+	var req taskCallbackRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err == nil {
+		callbackURL := strings.TrimSpace(req.CallbackUrl)
+		if callbackURL == "" {
+			callbackURL = strings.TrimSpace(req.SunoNotifyHook)
+		}
+		if callbackURL == "" {
+			callbackURL = strings.TrimSpace(req.MjNotifyHook)
+		}
+		if callbackURL != "" {
+			if err := ValidateTaskCallbackURL(callbackURL); err != nil {
+				return "", fmt.Errorf("invalid callback_url: %w", err)
+			}
+			return callbackURL, nil
+		}
+	}
+	return common.GetContextKeyString(c, constant.ContextKeyTokenTaskCallbackUrl), nil
+}
+
+// parseTaskProgress 把 "45%" 形式的进度解析为整数，无法解析时返回 -1
+func parseTaskProgress(progress string) int {
+	value, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(progress), "%")))
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+// taskCallbackEvent 判断一次状态变化需要发送的事件，不需要通知时返回空串。
+// 进入终态发送 succeeded/failed；否则进度从低于某个里程碑变为不低于它时发送一次 progress
+func taskCallbackEvent(prevStatus, status, prevProgress, progress string, milestones []int) string {
+	if status != prevStatus {
+		switch status {
+		case model.TaskStatusSuccess:
+			return model.TaskCallbackEventSucceeded
+		case model.TaskStatusFailure:
+			return model.TaskCallbackEventFailed
+		}
+	}
+	if status == model.TaskStatusSuccess || status == model.TaskStatusFailure {
+		return ""
+	}
+	prev, current := parseTaskProgress(prevProgress), parseTaskProgress(progress)
+	if current < 0 || current <= prev {
+		return ""
+	}
+	for _, milestone := range milestones {
+		if milestone > 0 && milestone < 100 && prev < milestone && current >= milestone {
+			return model.TaskCallbackEventProgress
+		}
+	}
+	return ""
+}
+
+// NotifyTaskChanged 在任务状态持久化成功后调用，按需记录一条待投递的回调通知
+func NotifyTaskChanged(task *model.Task, prevStatus model.TaskStatus, prevProgress string) {
+	if task == nil || task.PrivateData.CallbackURL == "" || TaskCallbackPayloadFunc == nil {
+		return
+	}
+	event := taskCallbackEvent(string(prevStatus), string(task.Status), prevProgress, task.Progress, operation_setting.GetTaskCallbackSetting().ProgressMilestones)
+	if event == "" {
+		return
+	}
+	payload, err := TaskCallbackPayloadFunc(task)
+	if err != nil {
+		common.SysError(fmt.Sprintf("build callback payload for task %s failed: %v", task.TaskID, err))
+		return
+	}
+	enqueueTaskCallback(&model.TaskCallback{
+		UserId:      task.UserId,
+		TaskId:      task.TaskID,
+		Platform:    string(task.Platform),
+		Event:       event,
+		Progress:    task.Progress,
+		CallbackUrl: task.PrivateData.CallbackURL,
+		Payload:     string(payload),
+	})
+}
+
+// NotifyMidjourneyTaskChanged 与 NotifyTaskChanged 相同，用于 Midjourney 任务
+func NotifyMidjourneyTaskChanged(task *model.Midjourney, prevStatus string, prevProgress string) {
+	if task == nil || task.CallbackUrl == "" || task.MjId == "" || MidjourneyCallbackPayloadFunc == nil {
+		return
+	}
+	event := taskCallbackEvent(prevStatus, task.Status, prevProgress, task.Progress, operation_setting.GetTaskCallbackSetting().ProgressMilestones)
+	if event == "" {
+		return
+	}
+	payload, err := MidjourneyCallbackPayloadFunc(task)
+	if err != nil {
+		common.SysError(fmt.Sprintf("build callback payload for midjourney task %s failed: %v", task.MjId, err))
+		return
+	}
+	enqueueTaskCallback(&model.TaskCallback{
+		UserId:      task.UserId,
+		TaskId:      task.MjId,
+		Platform:    string(constant.TaskPlatformMidjourney),
+		Event:       event,
+		Progress:    task.Progress,
+		CallbackUrl: task.CallbackUrl,
+		Payload:     string(payload),
+	})
+}
+
+func enqueueTaskCallback(callback *model.TaskCallback) {
+	if !operation_setting.IsTaskCallbackEnabled() {
+		return
+	}
+	if callback.Event != model.TaskCallbackEventProgress {
+		if err := model.SupersedeTaskCallbacks(callback.TaskId); err != nil {
+			common.SysError(fmt.Sprintf("supersede callbacks of task %s failed: %v", callback.TaskId, err))
+		}
+	}
+	if err := callback.Insert(); err != nil {
+		common.SysError(fmt.Sprintf("insert callback of task %s failed: %v", callback.TaskId, err))
+		return
+	}
+	if _, _, err := EnqueueSystemTask(model.SystemTaskTypeTaskCallbackDelivery, nil); err != nil {
+		common.SysError("enqueue task callback delivery failed: " + err.Error())
+	}
+}
+
+// TaskCallbackDeliverySummary 一轮回调投递的结果
+type TaskCallbackDeliverySummary struct {
+	Attempted int   `json:"attempted"`
+	Delivered int   `json:"delivered"`
+	Retrying  int   `json:"retrying"`
+	Failed    int   `json:"failed"`
+	Deleted   int64 `json:"deleted"`
+}
+
+// RunTaskCallbackDeliveryOnce 投递所有到期的回调通知，并清理超过保留期的投递记录
+func RunTaskCallbackDeliveryOnce(ctx context.Context) (TaskCallbackDeliverySummary, error) {
+	summary := TaskCallbackDeliverySummary{}
+	setting := operation_setting.GetTaskCallbackSetting()
+	secrets := make(map[int]string)
+	for {
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+		callbacks, err := model.GetDueTaskCallbacks(common.GetTimestamp(), taskCallbackDeliveryBatchSize)
+		if err != nil {
+			return summary, err
+		}
+		for _, callback := range callbacks {
+			if ctx.Err() != nil {
+				return summary, ctx.Err()
+			}
+			secret, ok := secrets[callback.UserId]
+			if !ok {
+				if userSetting, err := model.GetUserSetting(callback.UserId, false); err == nil {
+					secret = userSetting.WebhookSecret
+				}
+				secrets[callback.UserId] = secret
+			}
+			deliverTaskCallback(ctx, setting, callback, secret)
+			if _, err := callback.UpdateDeliveryResult(); err != nil {
+				return summary, err
+			}
+			summary.Attempted++
+			switch callback.Status {
+			case model.TaskCallbackStatusSucceeded:
+				summary.Delivered++
+			case model.TaskCallbackStatusFailed:
+				summary.Failed++
+			default:
+				summary.Retrying++
+			}
+		}
+		if len(callbacks) < taskCallbackDeliveryBatchSize {
+			break
+		}
+	}
+
+	if setting.RetentionDays > 0 {
+		before := common.GetTimestamp() - int64(setting.RetentionDays)*24*3600
+		for {
+			deleted, err := model.DeleteTaskCallbacksBefore(before, taskCallbackCleanupBatchSize)
+			if err != nil {
+				return summary, err
+			}
+			summary.Deleted += deleted
+			if deleted < taskCallbackCleanupBatchSize {
+				break
+			}
+		}
+	}
+	return summary, nil
+}
+
+// deliverTaskCallback 发送一次回调并把结果写回 callback：2xx 视为成功，
+// 否则按 base * 2^(n-1) 退避重试，达到最大次数后标记为失败
+func deliverTaskCallback(ctx context.Context, setting *operation_setting.TaskCallbackSetting, callback *model.TaskCallback, secret string) {
+	requestCtx, cancel := context.WithTimeout(ctx, time.Duration(setting.GetTimeoutSeconds())*time.Second)
+	defer cancel()
+	headers := map[string]string{
+		"X-Webhook-Event":    callback.Event,
+		"X-Webhook-Delivery": strconv.Itoa(callback.Id),
+		"X-Task-Id":          callback.TaskId,
+	}
+	statusCode, err := postSignedWebhook(requestCtx, callback.CallbackUrl, secret, headers, []byte(callback.Payload))
+
+	now := common.GetTimestamp()
+	callback.Attempts++
+	callback.LastStatusCode = statusCode
+	if err == nil {
+		callback.Status = model.TaskCallbackStatusSucceeded
+		callback.LastError = ""
+		callback.DeliveredAt = now
+		return
+	}
+	callback.LastError = err.Error()
+	if len(callback.LastError) > taskCallbackLastErrorMaxLength {
+		callback.LastError = callback.LastError[:taskCallbackLastErrorMaxLength]
+	}
+	if callback.Attempts >= setting.GetMaxAttempts() {
+		callback.Status = model.TaskCallbackStatusFailed
+		return
+	}
+	backoff := int64(setting.GetRetryBaseSeconds()) << min(callback.Attempts-1, 16)
+	callback.NextAttemptAt = now + backoff
+}
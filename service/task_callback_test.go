@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskCallbackEvent(t *testing.T) {
+	milestones := []int{25, 50, 75}
+	cases := []struct {
+		name                   string
+		prevStatus, status     string
+		prevProgress, progress string
+		want                   string
+	}{
+		{"succeeded", model.TaskStatusInProgress, model.TaskStatusSuccess, "60%", "100%", model.TaskCallbackEventSucceeded},
+		{"failed", model.TaskStatusQueued, model.TaskStatusFailure, "0%", "100%", model.TaskCallbackEventFailed},
+		{"already terminal", model.TaskStatusSuccess, model.TaskStatusSuccess, "100%", "100%", ""},
+		{"crosses milestone", model.TaskStatusInProgress, model.TaskStatusInProgress, "20%", "30%", model.TaskCallbackEventProgress},
+		{"crosses several milestones once", model.TaskStatusQueued, model.TaskStatusInProgress, "10%", "80%", model.TaskCallbackEventProgress},
+		{"between milestones", model.TaskStatusInProgress, model.TaskStatusInProgress, "30%", "45%", ""},
+		{"unparsable progress", model.TaskStatusInProgress, model.TaskStatusInProgress, "", "processing", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, taskCallbackEvent(tc.prevStatus, tc.status, tc.prevProgress, tc.progress, milestones))
+		})
+	}
+}
+
+func TestTaskCallbackDelivery(t *testing.T) {
+	truncate(t)
+	InitHttpClient()
+	fetchSetting := system_setting.GetFetchSetting()
+	previousFetchSetting := *fetchSetting
+	fetchSetting.EnableSSRFProtection = false
+	t.Cleanup(func() { *fetchSetting = previousFetchSetting })
+	previousPayloadFunc := TaskCallbackPayloadFunc
+	TaskCallbackPayloadFunc = func(task *model.Task) ([]byte, error) {
+		return []byte(`{"task_id":"` + task.TaskID + `","status":"` + string(task.Status) + `"}`), nil
+	}
+	t.Cleanup(func() { TaskCallbackPayloadFunc = previousPayloadFunc })
+
+	seedUser(t, 1, 0)
+	require.NoError(t, model.DB.Model(&model.User{}).Where("id = ?", 1).Update("setting", `{"webhook_secret":"s3cret"}`).Error)
+
+	var gotBody []byte
+	var gotHeader http.Header
+	failFirst := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failFirst {
+			failFirst = false
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeader = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	task := &model.Task{TaskID: "task_cb", UserId: 1, Status: model.TaskStatusSuccess, Progress: "100%"}
+	task.PrivateData.CallbackURL = server.URL
+	NotifyTaskChanged(task, model.TaskStatusInProgress, "50%")
+
+	summary, err := RunTaskCallbackDeliveryOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Retrying)
+
+	var callback model.TaskCallback
+	require.NoError(t, model.DB.Where("task_id = ?", "task_cb").First(&callback).Error)
+	assert.Equal(t, model.TaskCallbackStatusPending, callback.Status)
+	assert.Equal(t, http.StatusBadGateway, callback.LastStatusCode)
+	assert.Greater(t, callback.NextAttemptAt, callback.CreatedAt)
+
+	// 跳过退避等待，直接让记录到期
+	require.NoError(t, model.DB.Model(&callback).Update("next_attempt_at", 0).Error)
+	summary, err = RunTaskCallbackDeliveryOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Delivered)
+
+	assert.JSONEq(t, `{"task_id":"task_cb","status":"SUCCESS"}`, string(gotBody))
+	assert.Equal(t, model.TaskCallbackEventSucceeded, gotHeader.Get("X-Webhook-Event"))
+	assert.Equal(t, generateSignature("s3cret", gotBody), gotHeader.Get("X-Webhook-Signature"))
+	require.NoError(t, model.DB.First(&callback, callback.Id).Error)
+	assert.Equal(t, model.TaskCallbackStatusSucceeded, callback.Status)
+	assert.Equal(t, 2, callback.Attempts)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"sync"
@@ -496,3 +497,66 @@ func TestSweepTimedOutTasksHonorsRefundRolloutBoundary(t *testing.T) {
 	assert.Equal(t, initialQuota+modernTaskQuota, getUserQuota(t, userID))
 	assert.Equal(t, int64(1), countLogs(t))
 }
+
+type upstreamCallbackAdaptor struct {
+	taskPollingFetchAdaptor
+}
+
+func (a *upstreamCallbackAdaptor) ParseTaskCallback(body []byte) (*relaycommon.TaskCallbackData, error) {
+	return &relaycommon.TaskCallbackData{UpstreamTaskID: "upstream_cb", ResultBody: body}, nil
+}
+
+func (a *upstreamCallbackAdaptor) ParseTaskResult([]byte) (*relaycommon.TaskInfo, error) {
+	return &relaycommon.TaskInfo{Status: model.TaskStatusSuccess, Url: "https://cdn.example.com/video.mp4"}, nil
+}
+
+// signedCallbackAdaptor 模拟对回调请求签名的上游，签名为 "signed" 时视为合法
+type signedCallbackAdaptor struct {
+	upstreamCallbackAdaptor
+}
+
+func (a *signedCallbackAdaptor) VerifyTaskCallback(header http.Header, body []byte, apiKey string) error {
+	if header.Get("X-Signature") != "signed" {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func TestHandleUpstreamTaskCallback(t *testing.T) {
+	truncate(t)
+
+	const channelID = 201
+	seedTaskPollingChannel(t, channelID, true)
+	task := seedPollingTask(t, channelID, "task_public_cb", "upstream_cb")
+	require.NoError(t, model.DB.Model(task).Update("poll_after", time.Now().Unix()+600).Error)
+	assert.Empty(t, model.GetAllUnFinishSyncTasks(10), "tasks waiting for a callback are not polled")
+
+	previousFactory := GetTaskAdaptorFunc
+	GetTaskAdaptorFunc = func(constant.TaskPlatform) TaskPollingAdaptor { return &upstreamCallbackAdaptor{} }
+	t.Cleanup(func() { GetTaskAdaptorFunc = previousFactory })
+
+	sign := upstreamTaskCallbackSign("kling", channelID, "task_public_cb")
+	assert.True(t, VerifyUpstreamTaskCallbackSign("kling", channelID, "task_public_cb", sign))
+	assert.False(t, VerifyUpstreamTaskCallbackSign("kling", channelID, "task_other", sign))
+	assert.False(t, VerifyUpstreamTaskCallbackSign("kling", channelID+1, "task_public_cb", sign))
+
+	_, err := HandleUpstreamTaskCallback(context.Background(), "kling", channelID+1, "task_public_cb", nil, []byte(`{}`))
+	require.Error(t, err, "callback for another channel must not touch the task")
+
+	GetTaskAdaptorFunc = func(constant.TaskPlatform) TaskPollingAdaptor { return &signedCallbackAdaptor{} }
+	_, err = HandleUpstreamTaskCallback(context.Background(), "kling", channelID, "task_public_cb", http.Header{"X-Signature": []string{"forged"}}, []byte(`{}`))
+	require.ErrorIs(t, err, ErrUpstreamTaskCallbackSignature)
+	var pending model.Task
+	require.NoError(t, model.DB.First(&pending, task.ID).Error)
+	assert.NotEqual(t, model.TaskStatus(model.TaskStatusSuccess), pending.Status, "a callback with a bad upstream signature must not touch the task")
+
+	reply, err := HandleUpstreamTaskCallback(context.Background(), "kling", channelID, "task_public_cb", http.Header{"X-Signature": []string{"signed"}}, []byte(`{}`))
+	require.NoError(t, err)
+	assert.Nil(t, reply)
+
+	var updated model.Task
+	require.NoError(t, model.DB.First(&updated, task.ID).Error)
+	assert.Equal(t, model.TaskStatus(model.TaskStatusSuccess), updated.Status)
+	assert.Equal(t, "100%", updated.Progress)
+	assert.Equal(t, "https://cdn.example.com/video.mp4", updated.PrivateData.ResultURL)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// TaskCallbackParser 支持上游推送的任务适配器实现该接口（与 relay/channel.TaskCallbackReceiver 一致），
+// 单独声明以避免 service -> relay 的循环依赖
+type TaskCallbackParser interface {
+	ParseTaskCallback(body []byte) (*relaycommon.TaskCallbackData, error)
+}
+
+// TaskCallbackSignatureVerifier 上游对回调请求签名的适配器实现该接口（与 relay/channel.TaskCallbackVerifier 一致），
+// 在回调地址签名之外再用渠道密钥校验上游自己的签名
+type TaskCallbackSignatureVerifier interface {
+	VerifyTaskCallback(header http.Header, body []byte, apiKey string) error
+}
+
+// ErrUpstreamTaskCallbackSignature 上游自带的回调签名校验失败
+var ErrUpstreamTaskCallbackSignature = errors.New("invalid upstream callback signature")
+
+// upstreamTaskCallbackSign 回调地址签名。由网关在提交时对平台、渠道和任务 ID 签名，回调时校验，防止伪造或篡改其他任务。
+// 目前支持回调的 Kling、Vidu、豆包、海螺均不对回调请求签名（海螺仅在首次回调时做 challenge 握手），
+// 只依赖该地址签名；上游自带签名的平台还需实现 TaskCallbackSignatureVerifier
+func upstreamTaskCallbackSign(platform string, channelId int, taskId string) string {
+	return common.GenerateHMAC(fmt.Sprintf("task_callback:%s:%d:%s", platform, channelId, taskId))
+}
+
+// BuildUpstreamTaskCallbackURL 生成提交给上游的回调地址，未启用上游回调或未配置 ServerAddress 时返回空串
+func BuildUpstreamTaskCallbackURL(platform constant.TaskPlatform, channelId int, taskId string) string {
+	serverAddress := strings.TrimRight(system_setting.ServerAddress, "/")
+	if !operation_setting.IsUpstreamTaskCallbackEnabled() || serverAddress == "" || taskId == "" {
+		return ""
+	}
+	query := url.Values{}
+	query.Set("task_id", taskId)
+	query.Set("sign", upstreamTaskCallbackSign(string(platform), channelId, taskId))
+	return fmt.Sprintf("%s/api/task/callback/%s/%d?%s", serverAddress, url.PathEscape(string(platform)), channelId, query.Encode())
+}
+
+// VerifyUpstreamTaskCallbackSign 校验回调地址中的签名
+func VerifyUpstreamTaskCallbackSign(platform string, channelId int, taskId string, sign string) bool {
+	if taskId == "" || sign == "" {
+		return false
+	}
+	expected := upstreamTaskCallbackSign(platform, channelId, taskId)
+	return hmac.Equal([]byte(expected), []byte(sign))
+}
+
+// UpstreamTaskPollAfter 附带回调地址提交的任务在此时间之前不参与轮询
+func UpstreamTaskPollAfter() int64 {
+	return common.GetTimestamp() + int64(operation_setting.GetTaskCallbackSetting().GetUpstreamFallbackSeconds())
+}
+
+// HandleUpstreamTaskCallback 处理上游推送的任务结果（回调地址签名已由调用方校验，上游自带签名在此校验）。
+// 结果经适配器转换后走与轮询相同的更新、结算与退款流程；返回非空 reply 时为握手请求，需原样响应给上游
+func HandleUpstreamTaskCallback(ctx context.Context, platform string, channelId int, taskId string, header http.Header, body []byte) ([]byte, error) {
+	if GetTaskAdaptorFunc == nil {
+		return nil, fmt.Errorf("task adaptor not initialized")
+	}
+	adaptor := GetTaskAdaptorFunc(constant.TaskPlatform(platform))
+	parser, ok := adaptor.(TaskCallbackParser)
+	if adaptor == nil || !ok {
+		return nil, fmt.Errorf("platform %s does not support task callbacks", platform)
+	}
+	ch, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		return nil, err
+	}
+	if verifier, ok := adaptor.(TaskCallbackSignatureVerifier); ok {
+		if err := verifier.VerifyTaskCallback(header, body, ch.Key); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUpstreamTaskCallbackSignature, err)
+		}
+	}
+	data, err := parser.ParseTaskCallback(body)
+	if err != nil {
+		return nil, err
+	}
+	if data.Reply != nil {
+		return data.Reply, nil
+	}
+
+	task, exist, err := model.GetTaskByChannelAndTaskId(channelId, taskId)
+	if err != nil {
+		return nil, err
+	}
+	// 上游可能在任务记录写入前就回调，返回错误让上游重试，最终由轮询兜底
+	if !exist || string(task.Platform) != platform {
+		return nil, fmt.Errorf("task %s not found", taskId)
+	}
+	if data.UpstreamTaskID != "" && data.UpstreamTaskID != task.GetUpstreamTaskID() {
+		return nil, fmt.Errorf("callback upstream task id mismatch for task %s", taskId)
+	}
+	if task.Status == model.TaskStatusSuccess || task.Status == model.TaskStatusFailure {
+		return nil, nil
+	}
+
+	info := &relaycommon.RelayInfo{}
+	info.ChannelMeta = &relaycommon.ChannelMeta{
+		ChannelBaseUrl: ch.GetBaseURL(),
+	}
+	info.ApiKey = ch.Key
+	adaptor.Init(info)
+	return nil, applyVideoTaskResult(ctx, adaptor, task, data.ResultBody)
+}
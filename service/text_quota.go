@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"math"
+	"net/http"
 	"sort"
 	"strings"
 	"time"
@@ -12,7 +13,9 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
+	keyusage "github.com/QuantumNous/new-api/pkg/key_usage"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relaykit/dto"
@@ -395,6 +398,11 @@ func usageSemanticFromUsage(relayInfo *relaycommon.RelayInfo, usage *dto.Usage)
 }
 
 func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent []string) {
+	if HedgeAttemptLost(ctx) {
+		// 对冲竞争中落败的尝试由获胜方结算，这里不计费也不记录日志
+		logger.LogInfo(ctx, fmt.Sprintf("skip billing of hedged request lost on channel #%d", common.GetContextKeyInt(ctx, constant.ContextKeyChannelId)))
+		return
+	}
 	originUsage := usage
 	billingUsage := effectiveBillingUsage(usage)
 	if usage == nil {
@@ -402,6 +410,11 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 	}
 	if originUsage != nil {
 		ObserveChannelAffinityUsageCacheByRelayFormat(ctx, billingUsage, relayInfo.GetFinalRequestRelayFormat())
+		RecordTokenRateUsage(ctx, relayInfo, billingUsage.TotalTokens)
+		if common.GetContextKeyBool(ctx, constant.ContextKeyChannelIsMultiKey) {
+			// 记录多key渠道中该key本分钟消耗的 tokens，供 weighted 模式按 TPM 加权
+			keyusage.RecordTokens(common.GetContextKeyInt(ctx, constant.ContextKeyChannelId), common.GetContextKeyInt(ctx, constant.ContextKeyChannelMultiKeyIndex), billingUsage.TotalTokens)
+		}
 	}
 
 	adminRejectReason := common.GetContextKeyString(ctx, constant.ContextKeyAdminRejectReason)
@@ -537,7 +550,15 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 		Group:            relayInfo.UsingGroup,
 		Other:            other,
 	})
+	recordPromptTemplateUsage(ctx, summary.Quota)
 	gopool.Go(func() {
 		perfmetrics.RecordRelaySample(relayInfo, true, int64(summary.CompletionTokens))
+		prommetrics.RecordRelay(relayInfo, prommetrics.RelayResult{
+			Success:      true,
+			StatusCode:   http.StatusOK,
+			InputTokens:  int64(summary.PromptTokens),
+			OutputTokens: int64(summary.CompletionTokens),
+			Quota:        summary.Quota,
+		})
 	})
 }
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/logger"
+	tokenlimiter "github.com/QuantumNous/new-api/pkg/token_limiter"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordTokenRateUsage 记录令牌本次请求消耗的 tokens（输入+输出），供令牌 TPM/TPD 限流使用
+func RecordTokenRateUsage(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, tokens int) {
+	if !operation_setting.GetTokenRateLimitSetting().Enabled || relayInfo.TokenId == 0 || tokens <= 0 {
+		return
+	}
+	// 请求结束时客户端可能已断开，不使用请求的 context
+	if err := tokenlimiter.AddTokens(context.Background(), relayInfo.TokenId, tokens); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to record token rate usage: %s", err.Error()))
+	}
+}
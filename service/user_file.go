@@ -0,0 +1,446 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const fileUpstreamTimeout = 5 * time.Minute
+
+// SupportedFilePurposes OpenAI Files API 支持的 purpose
+var SupportedFilePurposes = []string{"assistants", "batch", "fine-tune", "vision", "user_data", "evals"}
+
+// OpenAIFileObject 是 /v1/files 返回给客户端的文件对象
+type OpenAIFileObject struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt *int64 `json:"expires_at,omitempty"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"`
+}
+
+func ToOpenAIFileObject(file *model.File) OpenAIFileObject {
+	obj := OpenAIFileObject{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+	if file.ExpiresAt > 0 {
+		obj.ExpiresAt = common.GetPointer(file.ExpiresAt)
+	}
+	return obj
+}
+
+// NewFileId 生成网关本地文件 id
+func NewFileId() string {
+	return "file-" + common.GetRandomString(24)
+}
+
+func fileStorageKey(userId int, fileId string) string {
+	return path.Join("files", fmt.Sprintf("%d", userId), fileId)
+}
+
+// CalcFileStorageQuota 计算上传文件应扣除的额度：按 GB 单价 × 分组倍率，不足 1 的额度向上取整
+func CalcFileStorageQuota(size int64, group string) int {
+	price := operation_setting.GetFileSetting().PricePerGB
+	if price <= 0 || size <= 0 {
+		return 0
+	}
+	gb := float64(size) / float64(1<<30)
+	quota := gb * price * common.QuotaPerUnit * ratio_setting.GetGroupRatio(group)
+	return int(math.Ceil(quota))
+}
+
+// CheckUserFileStorageLimit 检查用户存储占用加上新文件后是否超出上限
+func CheckUserFileStorageLimit(userId int, size int64) error {
+	if size > operation_setting.GetMaxFileSizeBytes() {
+		return fmt.Errorf("file size %s exceeds limit %s", common.Bytes2Size(size), common.Bytes2Size(operation_setting.GetMaxFileSizeBytes()))
+	}
+	limit := operation_setting.GetUserStorageLimitBytes()
+	if limit <= 0 {
+		return nil
+	}
+	used, err := model.SumUserFileBytes(userId)
+	if err != nil {
+		return err
+	}
+	if used+size > limit {
+		return fmt.Errorf("file storage limit exceeded: used %s, limit %s", common.Bytes2Size(used), common.Bytes2Size(limit))
+	}
+	return nil
+}
+
+// StoreUserFile 将上传内容写入存储后端并落库
+func StoreUserFile(ctx context.Context, file *model.File, body io.Reader) error {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return err
+	}
+	if file.FileId == "" {
+		file.FileId = NewFileId()
+	}
+	file.StorageType = storage.Type()
+	file.StorageKey = fileStorageKey(file.UserId, file.FileId)
+	if err := storage.Put(ctx, file.StorageKey, body, file.Bytes, file.ContentType); err != nil {
+		return err
+	}
+	if file.Status == "" {
+		file.Status = model.FileStatusProcessed
+	}
+	if err := file.Insert(); err != nil {
+		_ = storage.Delete(ctx, file.StorageKey)
+		return err
+	}
+	return nil
+}
+
+// OpenUserFileContent 打开文件内容
+func OpenUserFileContent(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	storage, err := NewFileStorageByType(file.StorageType)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Get(ctx, file.StorageKey)
+}
+
+// ReadUserFileContent 读取完整文件内容，仅用于体积可控的场景（如 batch 输入）
+func ReadUserFileContent(ctx context.Context, file *model.File) ([]byte, error) {
+	reader, err := OpenUserFileContent(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// DeleteUserFile 删除文件记录、存储内容，以及透传到上游的副本
+func DeleteUserFile(ctx context.Context, file *model.File) error {
+	if err := model.DeleteFileById(file.Id); err != nil {
+		return err
+	}
+	storage, err := NewFileStorageByType(file.StorageType)
+	if err == nil {
+		err = storage.Delete(ctx, file.StorageKey)
+	}
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to delete stored file %s: %v", file.FileId, err))
+	}
+	if file.ChannelId > 0 && file.UpstreamFileId != "" {
+		if channel, chErr := model.CacheGetChannel(file.ChannelId); chErr == nil {
+			if delErr := deleteUpstreamFile(ctx, channel, file.UpstreamFileId); delErr != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("failed to delete upstream file %s on channel #%d: %v", file.UpstreamFileId, file.ChannelId, delErr))
+			}
+		}
+	}
+	return nil
+}
+
+// newFileStorageBillingSession 按当前令牌的资金来源（组织、订阅或钱包）为文件存储创建计费会话
+func newFileStorageBillingSession(c *gin.Context, file *model.File, group string, quota int) (*BillingSession, *types.NewAPIError) {
+	userSetting, _ := common.GetContextKeyType[dto.UserSetting](c, constant.ContextKeyUserSetting)
+	relayInfo := &relaycommon.RelayInfo{
+		TokenId:         file.TokenId,
+		TokenKey:        common.GetContextKeyString(c, constant.ContextKeyTokenKey),
+		TokenUnlimited:  common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		OrganizationId:  common.GetContextKeyInt(c, constant.ContextKeyTokenOrganizationId),
+		UserId:          file.UserId,
+		UsingGroup:      group,
+		OriginModelName: "files",
+		RequestId:       common.GetContextKeyString(c, common.RequestIdKey),
+		UserSetting:     userSetting,
+	}
+	return NewBillingSession(c, relayInfo, quota)
+}
+
+// PreConsumeFileStorageQuota 在写入存储之前按上传大小预扣存储费用；不产生费用时返回 nil 会话
+func PreConsumeFileStorageQuota(c *gin.Context, file *model.File, group string) (*BillingSession, *types.NewAPIError) {
+	quota := CalcFileStorageQuota(file.Bytes, group)
+	if quota <= 0 {
+		return nil, nil
+	}
+	return newFileStorageBillingSession(c, file, group, quota)
+}
+
+// RefundFileStorageQuota 文件未能保存时退还预扣的存储费用
+func RefundFileStorageQuota(c *gin.Context, session *BillingSession) {
+	if session != nil {
+		session.Refund(c)
+	}
+}
+
+// SettleFileStorageQuota 文件保存成功后结算存储费用，并记录消费日志
+func SettleFileStorageQuota(c *gin.Context, session *BillingSession, file *model.File, group string) error {
+	if session == nil {
+		return nil
+	}
+	quota := CalcFileStorageQuota(file.Bytes, group)
+	if err := session.Settle(quota); err != nil {
+		return err
+	}
+	file.Quota = quota
+	model.UpdateUserUsedQuotaAndRequestCount(file.UserId, quota)
+	model.RecordConsumeLog(c, file.UserId, model.RecordConsumeLogParams{
+		ChannelId: file.ChannelId,
+		ModelName: "files",
+		TokenName: c.GetString("token_name"),
+		Quota:     quota,
+		Content:   fmt.Sprintf("文件存储 %s（%s）", file.FileId, common.Bytes2Size(file.Bytes)),
+		TokenId:   file.TokenId,
+		Group:     group,
+		Other: map[string]interface{}{
+			"file_id":        file.FileId,
+			"file_bytes":     file.Bytes,
+			"file_purpose":   file.Purpose,
+			"price_per_gb":   operation_setting.GetFileSetting().PricePerGB,
+			"group_ratio":    ratio_setting.GetGroupRatio(group),
+			"billing_source": session.relayInfo.BillingSource,
+		},
+	})
+	return nil
+}
+
+const expiredFileCleanupBatchSize = 100
+
+// FileCleanupSummary 过期文件清理结果
+type FileCleanupSummary struct {
+	Deleted int `json:"deleted"`
+}
+
+// RunExpiredFileCleanupOnce 分批删除已过期的文件
+func RunExpiredFileCleanupOnce(ctx context.Context) (FileCleanupSummary, error) {
+	summary := FileCleanupSummary{}
+	for {
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+		files, err := model.GetExpiredFiles(expiredFileCleanupBatchSize)
+		if err != nil {
+			return summary, err
+		}
+		for _, file := range files {
+			if err := DeleteUserFile(ctx, file); err != nil {
+				return summary, err
+			}
+			summary.Deleted++
+		}
+		if len(files) < expiredFileCleanupBatchSize {
+			return summary, nil
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// 上游透传
+// ---------------------------------------------------------------------------
+
+// channelSupportsFileApi 目前仅 OpenAI 兼容渠道支持 /v1/files 透传
+func channelSupportsFileApi(channel *model.Channel) bool {
+	return channel != nil && channel.Type == constant.ChannelTypeOpenAI
+}
+
+// SelectFilePassThroughChannel 为将来消费该文件的模型选择一个支持 Files API 的渠道
+func SelectFilePassThroughChannel(c *gin.Context, modelName string, group string) (*model.Channel, error) {
+	channel, _, err := CacheGetRandomSatisfiedChannel(&RetryParam{
+		Ctx:         c,
+		TokenGroup:  group,
+		ModelName:   modelName,
+		RequestPath: "/v1/files",
+		Retry:       common.GetPointer(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !channelSupportsFileApi(channel) {
+		return nil, fmt.Errorf("no channel supporting files api for model %s", modelName)
+	}
+	return channel, nil
+}
+
+// PassThroughFileToChannel 把已存储的文件上传到上游渠道，返回上游文件 id
+func PassThroughFileToChannel(ctx context.Context, file *model.File, channel *model.Channel) (string, error) {
+	if !channelSupportsFileApi(channel) {
+		return "", fmt.Errorf("channel #%d does not support files api", channel.Id)
+	}
+	content, err := ReadUserFileContent(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	upstreamId, err := uploadUpstreamFile(ctx, channel, file.Filename, file.Purpose, content)
+	if err != nil {
+		return "", err
+	}
+	return upstreamId, nil
+}
+
+func upstreamFileRequest(ctx context.Context, channel *model.Channel, method string, endpoint string, body io.Reader, contentType string) (*http.Response, error) {
+	key, _, keyErr := channel.GetNextEnabledKey()
+	if keyErr != nil {
+		return nil, keyErr.Err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, common.BuildURL(channel.GetBaseURL(), endpoint), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	client := GetHttpClient()
+	if proxy := channel.GetSetting().Proxy; proxy != "" {
+		client, err = GetHttpClientWithProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client.Do(req)
+}
+
+func uploadUpstreamFile(ctx context.Context, channel *model.Channel, filename string, purpose string, content []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fileUpstreamTimeout)
+	defer cancel()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.WriteField("purpose", purpose); err != nil {
+		return "", err
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(content); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+	resp, err := upstreamFileRequest(ctx, channel, http.MethodPost, "/v1/files", &buf, writer.FormDataContentType())
+	if err != nil {
+		return "", err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("upstream file upload failed: status %d: %s", resp.StatusCode, common.LocalLogPreview(string(respBody)))
+	}
+	upstreamId := gjson.GetBytes(respBody, "id").String()
+	if upstreamId == "" {
+		return "", errors.New("upstream file upload response missing id")
+	}
+	return upstreamId, nil
+}
+
+func deleteUpstreamFile(ctx context.Context, channel *model.Channel, upstreamFileId string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	resp, err := upstreamFileRequest(ctx, channel, http.MethodDelete, "/v1/files/"+upstreamFileId, nil, "")
+	if err != nil {
+		return err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// 渠道固定
+// ---------------------------------------------------------------------------
+
+// fileReferencePaths 请求体中可能引用文件 id 的位置（chat / responses / batch）
+var fileReferencePaths = []string{
+	"input_file_id",
+	"file_id",
+	"messages.#.content.#.file.file_id",
+	"input.#.content.#.file_id",
+	"attachments.#.file_id",
+}
+
+// ExtractReferencedFileIds 从 JSON 请求体中提取引用的文件 id
+func ExtractReferencedFileIds(body []byte) []string {
+	if len(body) == 0 || !bytes.Contains(body, []byte("file")) {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	ids := make([]string, 0)
+	var collect func(result gjson.Result)
+	collect = func(result gjson.Result) {
+		if result.IsArray() {
+			for _, item := range result.Array() {
+				collect(item)
+			}
+			return
+		}
+		id := result.String()
+		if result.Type != gjson.String || id == "" {
+			return
+		}
+		if _, ok := seen[id]; ok {
+			return
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	for _, p := range fileReferencePaths {
+		collect(gjson.GetBytes(body, p))
+	}
+	return ids
+}
+
+// GetFilePinnedChannelId 若请求引用了透传到上游的文件，返回该文件所在的渠道 id。
+// 上游文件只在其所属渠道可见，因此引用它的后续请求必须固定到同一渠道。
+func GetFilePinnedChannelId(userId int, body []byte) (int, bool) {
+	ids := ExtractReferencedFileIds(body)
+	if len(ids) == 0 {
+		return 0, false
+	}
+	files, err := model.GetUserFilesByFileIds(userId, ids)
+	if err != nil {
+		return 0, false
+	}
+	for _, file := range files {
+		if file.ChannelId > 0 {
+			return file.ChannelId, true
+		}
+	}
+	return 0, false
+}
+
+// IsSupportedFilePurpose 校验 purpose
+func IsSupportedFilePurpose(purpose string) bool {
+	return common.StringsContains(SupportedFilePurposes, strings.TrimSpace(purpose))
+}
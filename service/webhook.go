@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -53,9 +54,15 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		return fmt.Errorf("failed to marshal webhook payload: %v", err)
 	}
 
-	// 创建 HTTP 请求
-	var req *http.Request
+	_, err = postSignedWebhook(context.Background(), webhookURL, secret, nil, payloadBytes)
+	return err
+}
+
+// postSignedWebhook 以 JSON POST 发送 webhook，secret 非空时附带 HMAC 签名。
+// 启用 Worker 时经 Worker 转发，否则直连并做 SSRF 校验；返回上游状态码，非 2xx 视为失败
+func postSignedWebhook(ctx context.Context, webhookURL string, secret string, headers map[string]string, payloadBytes []byte) (int, error) {
 	var resp *http.Response
+	var err error
 
 	if system_setting.EnableWorker() {
 		// 构建worker请求数据
@@ -68,6 +75,9 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 			},
 			Body: payloadBytes,
 		}
+		for key, value := range headers {
+			workerReq.Headers[key] = value
+		}
 
 		// 如果有secret，添加签名到headers
 		if secret != "" {
@@ -78,27 +88,24 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 
 		resp, err = DoWorkerRequest(workerReq)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request through worker: %v", err)
-		}
-		defer resp.Body.Close()
-
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+			return 0, fmt.Errorf("failed to send webhook request through worker: %v", err)
 		}
 	} else {
 		// SSRF防护：验证Webhook URL（非Worker模式）
 		if err := ValidateSSRFProtectedFetchURL(webhookURL); err != nil {
-			return fmt.Errorf("request reject: %v", err)
+			return 0, fmt.Errorf("request reject: %v", err)
 		}
 
-		req, err = http.NewRequest(http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
 		if err != nil {
-			return fmt.Errorf("failed to create webhook request: %v", err)
+			return 0, fmt.Errorf("failed to create webhook request: %v", err)
 		}
 
 		// 设置请求头
 		req.Header.Set("Content-Type", "application/json")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
 
 		// 如果有 secret，生成签名
 		if secret != "" {
@@ -110,15 +117,14 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		client := GetSSRFProtectedHTTPClient()
 		resp, err = client.Do(req)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request: %v", err)
-		}
-		defer resp.Body.Close()
-
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+			return 0, fmt.Errorf("failed to send webhook request: %v", err)
 		}
 	}
+	defer resp.Body.Close()
 
-	return nil
+	// 检查响应状态
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
 }
@@ -80,6 +80,7 @@ func smokeTestExpr(exprStr string) error {
 		{P: 1000, C: 1000, Len: 1000},
 		{P: 100000, C: 100000, Len: 100000},
 		{P: 1000000, C: 1000000, Len: 1000000},
+		{CSH: 1000000},
 	}
 	requests := []billingexpr.RequestInput{
 		{},
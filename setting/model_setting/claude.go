@@ -21,6 +21,7 @@ type ClaudeSettings struct {
 	DefaultMaxTokens                      map[string]int                 `json:"default_max_tokens"`
 	ThinkingAdapterEnabled                bool                           `json:"thinking_adapter_enabled"`
 	ThinkingAdapterBudgetTokensPercentage float64                        `json:"thinking_adapter_budget_tokens_percentage"`
+	CountTokensForwardEnabled             bool                           `json:"count_tokens_forward_enabled"` // count_tokens 选中 Anthropic 渠道时转发上游计数，否则本地估算
 }
 
 // 默认配置
@@ -31,6 +32,7 @@ var defaultClaudeSettings = ClaudeSettings{
 		"default": 8192,
 	},
 	ThinkingAdapterBudgetTokensPercentage: 0.8,
+	CountTokensForwardEnabled:             true,
 }
 
 // 全局实例
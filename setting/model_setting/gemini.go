@@ -27,6 +27,10 @@ type GeminiSettings struct {
 	ThinkingAdapterBudgetTokensPercentage float64           `json:"thinking_adapter_budget_tokens_percentage"`
 	FunctionCallThoughtSignatureEnabled   bool              `json:"function_call_thought_signature_enabled"`
 	RemoveFunctionResponseIdEnabled       bool              `json:"remove_function_response_id_enabled"`
+	// FilesApiEnabled 是否代理 Gemini Files API（/upload/v1beta/files、/v1beta/files）与 /v1beta/cachedContents
+	FilesApiEnabled bool `json:"files_api_enabled"`
+	// FilesUploadModel 上传文件时请求不带模型，按该模型选择 Gemini 渠道；请求可通过 ?model= 覆盖
+	FilesUploadModel string `json:"files_upload_model"`
 }
 
 // 默认配置
@@ -51,6 +55,8 @@ var defaultGeminiSettings = GeminiSettings{
 	ThinkingAdapterBudgetTokensPercentage: 0.6,
 	FunctionCallThoughtSignatureEnabled:   true,
 	RemoveFunctionResponseIdEnabled:       true,
+	FilesApiEnabled:                       true,
+	FilesUploadModel:                      "gemini-2.5-flash",
 }
 
 // 全局实例
@@ -0,0 +1,42 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchSetting /v1/batches 批处理配置，批处理依赖 Files API 存放输入与结果文件
+type BatchSetting struct {
+	Enabled             bool `json:"enabled"`                // 是否启用 Batch API
+	UpstreamEnabled     bool `json:"upstream_enabled"`       // 输入文件已透传到支持 Batch API 的上游渠道时，整批转交上游执行
+	Concurrency         int  `json:"concurrency"`            // 本地执行时单个批处理的并发请求数
+	MaxRequestsPerBatch int  `json:"max_requests_per_batch"` // 单个批处理最多包含的请求行数
+}
+
+// 默认配置
+var batchSetting = BatchSetting{
+	Enabled:             false,
+	UpstreamEnabled:     true,
+	Concurrency:         4,
+	MaxRequestsPerBatch: 50000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+// GetBatchSetting 获取批处理配置
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
+
+// IsBatchApiEnabled Batch API 需要同时启用 Files API
+func IsBatchApiEnabled() bool {
+	return batchSetting.Enabled && fileSetting.Enabled
+}
+
+// GetBatchConcurrency 本地执行并发数
+func GetBatchConcurrency() int {
+	if batchSetting.Concurrency <= 0 {
+		return 1
+	}
+	return batchSetting.Concurrency
+}
@@ -0,0 +1,88 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// BuiltinToolEmulationSetting 内置工具模拟配置。渠道开启内置工具模拟后，请求中的 web_search /
+// code_interpreter 工具由网关以函数工具的形式交给上游，并在网关侧执行。
+type BuiltinToolEmulationSetting struct {
+	WebSearchEnabled       bool              `json:"web_search_enabled"`       // 是否模拟 web_search
+	SearchURL              string            `json:"search_url"`               // 兼容 SearXNG 的搜索接口地址，以 GET ?q=<query>&format=json 调用
+	SearchHeaders          map[string]string `json:"search_headers"`           // 访问搜索接口时附加的请求头
+	SearchMaxResults       int               `json:"search_max_results"`       // 返回给模型的搜索结果条数
+	CodeInterpreterEnabled bool              `json:"code_interpreter_enabled"` // 是否模拟 code_interpreter
+	SandboxURL             string            `json:"sandbox_url"`              // 代码沙箱地址，POST {"language","code"}，返回 {"stdout","stderr","exit_code"}
+	SandboxHeaders         map[string]string `json:"sandbox_headers"`          // 访问代码沙箱时附加的请求头
+	SandboxLanguage        string            `json:"sandbox_language"`         // 代码语言
+	MaxToolRounds          int               `json:"max_tool_rounds"`          // 单次请求最多执行的工具调用轮数
+	ToolTimeoutSeconds     int               `json:"tool_timeout_seconds"`     // 单次工具调用超时
+	MaxToolOutputLength    int               `json:"max_tool_output_length"`   // 返回给模型的单次工具输出最大字符数，0 表示不限制
+}
+
+// 默认配置
+var builtinToolEmulationSetting = BuiltinToolEmulationSetting{
+	WebSearchEnabled:       false,
+	SearchHeaders:          map[string]string{},
+	SearchMaxResults:       5,
+	CodeInterpreterEnabled: false,
+	SandboxHeaders:         map[string]string{},
+	SandboxLanguage:        "python",
+	MaxToolRounds:          8,
+	ToolTimeoutSeconds:     30,
+	MaxToolOutputLength:    16000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("builtin_tool_emulation_setting", &builtinToolEmulationSetting)
+}
+
+// GetBuiltinToolEmulationSetting 获取内置工具模拟配置
+func GetBuiltinToolEmulationSetting() *BuiltinToolEmulationSetting {
+	return &builtinToolEmulationSetting
+}
+
+// IsWebSearchAvailable 是否已开启并配置搜索接口
+func (s *BuiltinToolEmulationSetting) IsWebSearchAvailable() bool {
+	return s.WebSearchEnabled && s.SearchURL != ""
+}
+
+// IsCodeInterpreterAvailable 是否已开启并配置代码沙箱
+func (s *BuiltinToolEmulationSetting) IsCodeInterpreterAvailable() bool {
+	return s.CodeInterpreterEnabled && s.SandboxURL != ""
+}
+
+// GetSearchMaxResults 获取搜索结果条数，未配置时使用默认值
+func (s *BuiltinToolEmulationSetting) GetSearchMaxResults() int {
+	if s.SearchMaxResults <= 0 {
+		return 5
+	}
+	return s.SearchMaxResults
+}
+
+// GetSandboxLanguage 获取代码语言，未配置时使用 python
+func (s *BuiltinToolEmulationSetting) GetSandboxLanguage() string {
+	if s.SandboxLanguage == "" {
+		return "python"
+	}
+	return s.SandboxLanguage
+}
+
+// GetMaxToolRounds 获取工具调用轮数上限，未配置时使用默认值
+func (s *BuiltinToolEmulationSetting) GetMaxToolRounds() int {
+	if s.MaxToolRounds <= 0 {
+		return 8
+	}
+	return s.MaxToolRounds
+}
+
+// GetToolTimeout 获取单次工具调用超时
+func (s *BuiltinToolEmulationSetting) GetToolTimeout() time.Duration {
+	if s.ToolTimeoutSeconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.ToolTimeoutSeconds) * time.Second
+}
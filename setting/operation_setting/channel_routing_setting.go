@@ -0,0 +1,53 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// 渠道路由策略，作用于同一优先级内的候选渠道
+const (
+	// ChannelRoutingWeightedRandom 按渠道权重随机（默认）
+	ChannelRoutingWeightedRandom = "weighted_random"
+	// ChannelRoutingLeastLatency 权重按实时延迟 EWMA 反比缩放，延迟越低流量越多
+	ChannelRoutingLeastLatency = "least_latency"
+	// ChannelRoutingLeastError 权重按实时成功率缩放，错误率越高流量越少
+	ChannelRoutingLeastError = "least_error"
+	// ChannelRoutingPowerOfTwo 按权重随机抽取两个渠道，选择在途请求更少的一个
+	ChannelRoutingPowerOfTwo = "power_of_two"
+)
+
+// ChannelRoutingSetting 渠道路由策略配置，实时统计仅保存在当前节点内存中
+type ChannelRoutingSetting struct {
+	DefaultStrategy string            `json:"default_strategy"`  // 未单独配置的分组使用的策略
+	GroupStrategies map[string]string `json:"group_strategies"`  // 分组 -> 策略
+	MinWeightFactor float64           `json:"min_weight_factor"` // 表现最差的渠道保留的最小权重系数，保证仍有少量流量用于探测恢复
+}
+
+// 默认配置
+var channelRoutingSetting = ChannelRoutingSetting{
+	DefaultStrategy: ChannelRoutingWeightedRandom,
+	GroupStrategies: map[string]string{},
+	MinWeightFactor: 0.05,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_routing_setting", &channelRoutingSetting)
+}
+
+// GetChannelRoutingSetting 获取渠道路由策略配置
+func GetChannelRoutingSetting() *ChannelRoutingSetting {
+	return &channelRoutingSetting
+}
+
+// GetChannelRoutingStrategy 获取分组使用的路由策略，未知策略回退为按权重随机
+func GetChannelRoutingStrategy(group string) string {
+	strategy, ok := channelRoutingSetting.GroupStrategies[group]
+	if !ok || strategy == "" {
+		strategy = channelRoutingSetting.DefaultStrategy
+	}
+	switch strategy {
+	case ChannelRoutingLeastLatency, ChannelRoutingLeastError, ChannelRoutingPowerOfTwo:
+		return strategy
+	default:
+		return ChannelRoutingWeightedRandom
+	}
+}
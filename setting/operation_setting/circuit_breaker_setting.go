@@ -0,0 +1,35 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// CircuitBreakerSetting 渠道及渠道 key 的熔断配置，启用 Redis 时熔断状态在多节点间共享
+type CircuitBreakerSetting struct {
+	Enabled             bool    `json:"enabled"`
+	ConsecutiveFailures int     `json:"consecutive_failures"` // 连续失败达到该次数后熔断，0 表示不按连续失败熔断
+	ErrorRateThreshold  float64 `json:"error_rate_threshold"` // 窗口内错误率达到该值后熔断，0 表示不按错误率熔断
+	MinRequests         int     `json:"min_requests"`         // 按错误率熔断时窗口内的最少请求数
+	WindowSeconds       int     `json:"window_seconds"`       // 错误率统计窗口
+	OpenSeconds         int     `json:"open_seconds"`         // 熔断持续时间，到期后进入半开状态
+	HalfOpenRequests    int     `json:"half_open_requests"`   // 半开状态放行的探测请求数，全部成功后恢复
+}
+
+// 默认配置
+var circuitBreakerSetting = CircuitBreakerSetting{
+	Enabled:             false,
+	ConsecutiveFailures: 5,
+	ErrorRateThreshold:  0.5,
+	MinRequests:         20,
+	WindowSeconds:       60,
+	OpenSeconds:         30,
+	HalfOpenRequests:    3,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("circuit_breaker_setting", &circuitBreakerSetting)
+}
+
+// GetCircuitBreakerSetting 获取熔断配置
+func GetCircuitBreakerSetting() *CircuitBreakerSetting {
+	return &circuitBreakerSetting
+}
@@ -0,0 +1,72 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	FileStorageTypeLocal = "local"
+	FileStorageTypeS3    = "s3"
+)
+
+// FileSetting /v1/files 文件存储配置
+type FileSetting struct {
+	Enabled     bool   `json:"enabled"`      // 是否启用 Files API
+	StorageType string `json:"storage_type"` // 存储后端：local / s3
+	LocalPath   string `json:"local_path"`   // 本地存储目录，空表示使用磁盘缓存目录下的 new-api-files
+
+	S3Endpoint     string `json:"s3_endpoint"`      // S3 兼容服务地址，如 http://127.0.0.1:9000
+	S3Region       string `json:"s3_region"`        // 区域，MinIO 可填 us-east-1
+	S3Bucket       string `json:"s3_bucket"`        // 存储桶
+	S3AccessKeyId  string `json:"s3_access_key_id"` // 访问密钥 ID
+	S3AccessSecret string `json:"s3_access_secret"` // 访问密钥
+	S3PathPrefix   string `json:"s3_path_prefix"`   // 对象路径前缀
+
+	MaxFileSizeMB      int     `json:"max_file_size_mb"`      // 单文件大小上限（MB）
+	UserStorageLimitMB int     `json:"user_storage_limit_mb"` // 每用户存储上限（MB），0 表示不限制
+	PricePerGB         float64 `json:"price_per_gb"`          // 上传计费（美元/GB），0 表示免费
+	DefaultExpireDays  int     `json:"default_expire_days"`   // 默认过期天数，0 表示不过期
+
+	PassThroughEnabled bool `json:"pass_through_enabled"` // 上传时携带 model 字段则同时上传到该模型的上游渠道
+}
+
+// 默认配置
+var fileSetting = FileSetting{
+	Enabled:            false,
+	StorageType:        FileStorageTypeLocal,
+	S3Region:           "us-east-1",
+	MaxFileSizeMB:      512,
+	UserStorageLimitMB: 1024,
+	PricePerGB:         0,
+	DefaultExpireDays:  0,
+	PassThroughEnabled: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+// GetFileSetting 获取文件存储配置
+func GetFileSetting() *FileSetting {
+	return &fileSetting
+}
+
+// IsFileApiEnabled 是否启用 Files API
+func IsFileApiEnabled() bool {
+	return fileSetting.Enabled
+}
+
+// GetMaxFileSizeBytes 单文件大小上限（字节）
+func GetMaxFileSizeBytes() int64 {
+	if fileSetting.MaxFileSizeMB <= 0 {
+		return 512 << 20
+	}
+	return int64(fileSetting.MaxFileSizeMB) << 20
+}
+
+// GetUserStorageLimitBytes 每用户存储上限（字节），0 表示不限制
+func GetUserStorageLimitBytes() int64 {
+	if fileSetting.UserStorageLimitMB <= 0 {
+		return 0
+	}
+	return int64(fileSetting.UserStorageLimitMB) << 20
+}
@@ -0,0 +1,51 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 对冲请求的计费方式
+const (
+	// HedgeBillingWinner 只对最先返回首字节的渠道计费
+	HedgeBillingWinner = "winner"
+	// HedgeBillingBoth 被取消的渠道按预估输入 tokens 额外计费
+	HedgeBillingBoth = "both"
+)
+
+// HedgeSetting 对冲（推测）请求配置。首个渠道在 DelayMs 内没有返回首字节时，
+// 向同优先级的另一个渠道发出相同请求，采用先返回首字节的一方并取消另一方。
+// 仅作用于首次尝试的流式请求；令牌开启 hedge 或分组在 Groups 中时才会启用。
+type HedgeSetting struct {
+	Enabled     bool     `json:"enabled"`      // 总开关
+	Groups      []string `json:"groups"`       // 对这些分组的全部令牌启用对冲
+	DelayMs     int      `json:"delay_ms"`     // 首字节等待时间（毫秒），超过后发出对冲请求
+	BillingMode string   `json:"billing_mode"` // winner 或 both
+}
+
+// 默认配置
+var hedgeSetting = HedgeSetting{
+	Enabled:     false,
+	Groups:      []string{},
+	DelayMs:     1500,
+	BillingMode: HedgeBillingWinner,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+// GetHedgeSetting 获取对冲请求配置
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+// IsHedgeEnabledFor 判断令牌或分组是否启用了对冲请求
+func IsHedgeEnabledFor(tokenEnabled bool, group string) bool {
+	if !hedgeSetting.Enabled || hedgeSetting.DelayMs <= 0 {
+		return false
+	}
+	return tokenEnabled || slices.Contains(hedgeSetting.Groups, group)
+}
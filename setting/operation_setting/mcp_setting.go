@@ -0,0 +1,61 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// McpSetting MCP 网关配置。服务本身在 MCP 服务管理中登记，这里只控制网关行为。
+type McpSetting struct {
+	GatewayEnabled      bool `json:"gateway_enabled"`        // 是否开放 /mcp/:name 代理端点
+	ServerSideEnabled   bool `json:"server_side_enabled"`    // 是否允许对开启了 MCP 代执行的渠道在网关侧执行 MCP 工具调用
+	MaxToolRounds       int  `json:"max_tool_rounds"`        // 单次请求最多执行的工具调用轮数
+	ToolTimeoutSeconds  int  `json:"tool_timeout_seconds"`   // 单次工具调用超时
+	ToolsCacheSeconds   int  `json:"tools_cache_seconds"`    // tools/list 结果缓存时长
+	MaxToolOutputLength int  `json:"max_tool_output_length"` // 返回给模型的单次工具输出最大字符数，0 表示不限制
+}
+
+// 默认配置
+var mcpSetting = McpSetting{
+	GatewayEnabled:      false,
+	ServerSideEnabled:   false,
+	MaxToolRounds:       8,
+	ToolTimeoutSeconds:  60,
+	ToolsCacheSeconds:   300,
+	MaxToolOutputLength: 32000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("mcp_setting", &mcpSetting)
+}
+
+// GetMcpSetting 获取 MCP 网关配置
+func GetMcpSetting() *McpSetting {
+	return &mcpSetting
+}
+
+// GetMaxToolRounds 获取工具调用轮数上限，未配置时使用默认值
+func (s *McpSetting) GetMaxToolRounds() int {
+	if s.MaxToolRounds <= 0 {
+		return 8
+	}
+	return s.MaxToolRounds
+}
+
+// GetToolTimeout 获取单次工具调用超时
+func (s *McpSetting) GetToolTimeout() time.Duration {
+	if s.ToolTimeoutSeconds <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(s.ToolTimeoutSeconds) * time.Second
+}
+
+// GetToolsCacheTTL 获取 tools/list 缓存时长
+func (s *McpSetting) GetToolsCacheTTL() time.Duration {
+	if s.ToolsCacheSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(s.ToolsCacheSeconds) * time.Second
+}
@@ -0,0 +1,73 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// MediaAssetSetting 生成结果（视频任务、图片生成）持久化配置。
+// 开启后结果会下载到网关自己的存储中（后端复用 file_setting 的本地 / S3 配置），
+// 对外返回带签名、会过期的网关地址，不再依赖上游几小时就失效的 CDN 链接。
+type MediaAssetSetting struct {
+	Enabled            bool    `json:"enabled"`               // 总开关
+	StoreVideos        bool    `json:"store_videos"`          // 异步任务成功后保存结果
+	StoreImages        bool    `json:"store_images"`          // 图片生成（url / b64_json）保存结果
+	MaxAssetSizeMB     int     `json:"max_asset_size_mb"`     // 单个资源大小上限（MB），超出则保留上游地址
+	URLExpireSeconds   int     `json:"url_expire_seconds"`    // 签名地址有效期（秒）
+	RetentionDays      int     `json:"retention_days"`        // 资源保存天数，0 表示不过期
+	UserStorageLimitMB int     `json:"user_storage_limit_mb"` // 每用户存储上限（MB），超出时淘汰最早的资源，0 表示不限制
+	PricePerGB         float64 `json:"price_per_gb"`          // 存储计费（美元/GB），0 表示免费
+}
+
+// 默认配置
+var mediaAssetSetting = MediaAssetSetting{
+	Enabled:            false,
+	StoreVideos:        true,
+	StoreImages:        true,
+	MaxAssetSizeMB:     512,
+	URLExpireSeconds:   3600,
+	RetentionDays:      30,
+	UserStorageLimitMB: 2048,
+	PricePerGB:         0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("media_asset_setting", &mediaAssetSetting)
+}
+
+// GetMediaAssetSetting 获取生成结果持久化配置
+func GetMediaAssetSetting() *MediaAssetSetting {
+	return &mediaAssetSetting
+}
+
+// IsVideoAssetStoreEnabled 是否保存异步任务结果
+func IsVideoAssetStoreEnabled() bool {
+	return mediaAssetSetting.Enabled && mediaAssetSetting.StoreVideos
+}
+
+// IsImageAssetStoreEnabled 是否保存图片生成结果
+func IsImageAssetStoreEnabled() bool {
+	return mediaAssetSetting.Enabled && mediaAssetSetting.StoreImages
+}
+
+// GetMaxAssetSizeBytes 单个资源大小上限（字节）
+func (s *MediaAssetSetting) GetMaxAssetSizeBytes() int64 {
+	if s.MaxAssetSizeMB <= 0 {
+		return 512 << 20
+	}
+	return int64(s.MaxAssetSizeMB) << 20
+}
+
+// GetURLExpireSeconds 签名地址有效期（秒）
+func (s *MediaAssetSetting) GetURLExpireSeconds() int {
+	if s.URLExpireSeconds <= 0 {
+		return 3600
+	}
+	return s.URLExpireSeconds
+}
+
+// GetUserStorageLimitBytes 每用户存储上限（字节），0 表示不限制
+func (s *MediaAssetSetting) GetUserStorageLimitBytes() int64 {
+	if s.UserStorageLimitMB <= 0 {
+		return 0
+	}
+	return int64(s.UserStorageLimitMB) << 20
+}
@@ -0,0 +1,118 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 审核命中后的处理方式，按严格程度从低到高排列
+const (
+	// ModerationActionFlag 只记录审核结果，不影响请求
+	ModerationActionFlag = "flag"
+	// ModerationActionRedact 将命中的内容替换为 RedactMask 后继续
+	ModerationActionRedact = "redact"
+	// ModerationActionBlock 直接拒绝请求或截断输出
+	ModerationActionBlock = "block"
+)
+
+// 审核提供者
+const (
+	// ModerationProviderKeyword 敏感词列表（setting.SensitiveWords）
+	ModerationProviderKeyword = "keyword"
+	// ModerationProviderRegex 正则规则（RegexRules）
+	ModerationProviderRegex = "regex"
+	// ModerationProviderLLM 通过 relay 调用配置的 /v1/moderations 渠道
+	ModerationProviderLLM = "llm"
+)
+
+// ModerationPolicy 一组审核策略
+type ModerationPolicy struct {
+	Action     string   `json:"action"`     // block、redact 或 flag
+	Prompt     bool     `json:"prompt"`     // 是否审核请求内容
+	Completion bool     `json:"completion"` // 是否审核流式输出内容
+	Providers  []string `json:"providers"`  // 使用的审核提供者
+}
+
+// ModerationRegexRule 正则审核规则
+type ModerationRegexRule struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`
+	Category string `json:"category"` // 命中后记录的分类，为空时使用 Name
+}
+
+// ModerationSetting 内容审核配置。关闭时退回旧的敏感词检查（仅检查请求并拒绝）。
+// 分组策略覆盖 Default，令牌只能选择比分组更严格的处理方式。
+type ModerationSetting struct {
+	Enabled    bool                        `json:"enabled"`     // 总开关
+	Default    ModerationPolicy            `json:"default"`     // 默认策略
+	Groups     map[string]ModerationPolicy `json:"groups"`      // 分组策略
+	RegexRules []ModerationRegexRule       `json:"regex_rules"` // 正则规则
+	RedactMask string                      `json:"redact_mask"` // 替换命中内容使用的文本
+	// 审核渠道：使用该令牌（需属于管理员）经 relay 调用指定渠道的 /v1/moderations
+	LLMTokenId        int    `json:"llm_token_id"`
+	LLMChannelId      int    `json:"llm_channel_id"`       // 为 0 时按令牌分组正常选择渠道
+	LLMModel          string `json:"llm_model"`            // 审核模型，例如 omni-moderation-latest
+	LLMTimeoutSeconds int    `json:"llm_timeout_seconds"`  // 审核请求超时时间
+	LLMFailOpen       bool   `json:"llm_fail_open"`        // 审核渠道出错时放行请求
+	LLMMaxInputLength int    `json:"llm_max_input_length"` // 发送给审核渠道的最大字符数，0 表示不限制
+}
+
+// 默认配置
+var moderationSetting = ModerationSetting{
+	Enabled: false,
+	Default: ModerationPolicy{
+		Action:    ModerationActionBlock,
+		Prompt:    true,
+		Providers: []string{ModerationProviderKeyword},
+	},
+	Groups:            map[string]ModerationPolicy{},
+	RegexRules:        []ModerationRegexRule{},
+	RedactMask:        "**###**",
+	LLMModel:          "omni-moderation-latest",
+	LLMTimeoutSeconds: 10,
+	LLMFailOpen:       true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("moderation_setting", &moderationSetting)
+}
+
+// GetModerationSetting 获取内容审核配置
+func GetModerationSetting() *ModerationSetting {
+	return &moderationSetting
+}
+
+// ModerationActionRank 返回处理方式的严格程度，未知方式返回 0
+func ModerationActionRank(action string) int {
+	switch action {
+	case ModerationActionFlag:
+		return 1
+	case ModerationActionRedact:
+		return 2
+	case ModerationActionBlock:
+		return 3
+	}
+	return 0
+}
+
+// ResolveModerationPolicy 解析分组和令牌对应的审核策略，未启用审核时返回 false。
+// 令牌的处理方式只有比分组更严格时才会生效。
+func ResolveModerationPolicy(group string, tokenAction string) (ModerationPolicy, bool) {
+	if !moderationSetting.Enabled {
+		return ModerationPolicy{}, false
+	}
+	policy := moderationSetting.Default
+	if groupPolicy, ok := moderationSetting.Groups[group]; ok {
+		policy = groupPolicy
+	}
+	if ModerationActionRank(policy.Action) == 0 {
+		policy.Action = ModerationActionBlock
+	}
+	if ModerationActionRank(tokenAction) > ModerationActionRank(policy.Action) {
+		policy.Action = tokenAction
+	}
+	if len(policy.Providers) == 0 || (!policy.Prompt && !policy.Completion) {
+		return policy, false
+	}
+	return policy, true
+}
@@ -0,0 +1,64 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// PayloadCaptureSetting 请求/响应原文采集配置，用于排查客户对回答的争议。
+// 采集是按需开启的：只有命中 Groups、TokenIds 或 UserIds 之一的请求才会按 SampleRate 抽样保存，
+// 原文压缩后写入日志库（LOG_SQL_DSN 配置时为独立日志库），通过 RequestId 与消费日志关联。
+type PayloadCaptureSetting struct {
+	Enabled       bool     `json:"enabled"`        // 总开关
+	Groups        []string `json:"groups"`         // 采集的分组
+	TokenIds      []int    `json:"token_ids"`      // 采集的令牌
+	UserIds       []int    `json:"user_ids"`       // 采集的用户
+	SampleRate    float64  `json:"sample_rate"`    // 命中范围内的抽样比例（0-1）
+	MaxBodyKB     int      `json:"max_body_kb"`    // 请求体、响应体各自的保存上限（KB），超出部分截断
+	Redact        bool     `json:"redact"`         // 保存前按 PII 脱敏配置的检测器替换敏感内容
+	Encrypt       bool     `json:"encrypt"`        // 使用主密钥加密保存，未配置主密钥时按明文保存
+	RetentionDays int      `json:"retention_days"` // 保留天数，0 表示不清理
+}
+
+// 默认配置
+var payloadCaptureSetting = PayloadCaptureSetting{
+	Enabled:       false,
+	Groups:        []string{},
+	TokenIds:      []int{},
+	UserIds:       []int{},
+	SampleRate:    1,
+	MaxBodyKB:     256,
+	Redact:        true,
+	Encrypt:       true,
+	RetentionDays: 7,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("payload_capture_setting", &payloadCaptureSetting)
+}
+
+// GetPayloadCaptureSetting 获取原文采集配置
+func GetPayloadCaptureSetting() *PayloadCaptureSetting {
+	return &payloadCaptureSetting
+}
+
+// IsPayloadCaptureTarget 请求是否在采集范围内（不含抽样）
+func IsPayloadCaptureTarget(userId int, tokenId int, group string) bool {
+	s := &payloadCaptureSetting
+	if !s.Enabled || s.SampleRate <= 0 {
+		return false
+	}
+	return slices.Contains(s.UserIds, userId) ||
+		slices.Contains(s.TokenIds, tokenId) ||
+		(group != "" && slices.Contains(s.Groups, group))
+}
+
+// GetMaxBodyBytes 请求体、响应体各自的保存上限（字节）
+func (s *PayloadCaptureSetting) GetMaxBodyBytes() int {
+	if s.MaxBodyKB <= 0 {
+		return 256 << 10
+	}
+	return s.MaxBodyKB << 10
+}
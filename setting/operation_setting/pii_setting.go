@@ -0,0 +1,62 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 内置的 PII 检测器
+const (
+	PIIDetectorEmail      = "email"
+	PIIDetectorPhone      = "phone"
+	PIIDetectorCreditCard = "credit_card"
+	PIIDetectorNationalId = "national_id"
+	PIIDetectorApiKey     = "api_key"
+)
+
+// PIICustomDetector 自定义 PII 检测规则
+type PIICustomDetector struct {
+	Name    string `json:"name"`    // 检测器名称，同时用于占位符，例如 employee_id -> [PII_EMPLOYEE_ID_1]
+	Pattern string `json:"pattern"` // 正则表达式
+}
+
+// PIIRedactionSetting PII 脱敏配置。请求发往上游前将命中的内容替换为占位符，
+// 开启 Rehydrate 时在返回给客户端的响应（包括流式响应）中还原原始内容。
+type PIIRedactionSetting struct {
+	Enabled         bool                `json:"enabled"`          // 总开关
+	DefaultEnabled  bool                `json:"default_enabled"`  // 未在 Groups 中配置的分组是否脱敏
+	Groups          map[string]bool     `json:"groups"`           // 按分组单独启用或关闭
+	Detectors       []string            `json:"detectors"`        // 启用的内置检测器
+	CustomDetectors []PIICustomDetector `json:"custom_detectors"` // 自定义检测器
+	Rehydrate       bool                `json:"rehydrate"`        // 在响应中还原占位符
+}
+
+// 默认配置
+var piiRedactionSetting = PIIRedactionSetting{
+	Enabled:         false,
+	DefaultEnabled:  true,
+	Groups:          map[string]bool{},
+	Detectors:       []string{PIIDetectorEmail, PIIDetectorPhone, PIIDetectorCreditCard, PIIDetectorNationalId, PIIDetectorApiKey},
+	CustomDetectors: []PIICustomDetector{},
+	Rehydrate:       true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("pii_redaction_setting", &piiRedactionSetting)
+}
+
+// GetPIIRedactionSetting 获取 PII 脱敏配置
+func GetPIIRedactionSetting() *PIIRedactionSetting {
+	return &piiRedactionSetting
+}
+
+// IsPIIRedactionEnabledFor 判断分组是否启用 PII 脱敏
+func IsPIIRedactionEnabledFor(group string) bool {
+	if !piiRedactionSetting.Enabled {
+		return false
+	}
+	if enabled, ok := piiRedactionSetting.Groups[group]; ok {
+		return enabled
+	}
+	return piiRedactionSetting.DefaultEnabled
+}
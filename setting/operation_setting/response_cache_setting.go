@@ -0,0 +1,46 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponseCacheSetting 对话补全响应缓存配置。命中时直接返回缓存的响应（流式请求回放缓存的 SSE 分片），
+// 并按 HitPriceRatio 折算计费。令牌开启 response_cache 或分组在 Groups 中时才会使用缓存。
+type ResponseCacheSetting struct {
+	Enabled           bool     `json:"enabled"`            // 总开关
+	Groups            []string `json:"groups"`             // 对这些分组的全部令牌启用缓存
+	TTLSeconds        int      `json:"ttl_seconds"`        // 缓存有效期（秒）
+	MaxEntryBytes     int      `json:"max_entry_bytes"`    // 单条缓存最大响应体积，超过则不缓存
+	HitPriceRatio     float64  `json:"hit_price_ratio"`    // 命中缓存时的计费倍率（须大于 0）
+	DeterministicOnly bool     `json:"deterministic_only"` // 仅缓存 temperature 显式为 0 的请求
+}
+
+// 默认配置
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:           false,
+	Groups:            []string{},
+	TTLSeconds:        3600,
+	MaxEntryBytes:     1 << 20,
+	HitPriceRatio:     0.1,
+	DeterministicOnly: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+// GetResponseCacheSetting 获取响应缓存配置
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// IsResponseCacheEnabledFor 判断令牌或分组是否启用了响应缓存
+func IsResponseCacheEnabledFor(tokenEnabled bool, group string) bool {
+	if !responseCacheSetting.Enabled {
+		return false
+	}
+	return tokenEnabled || slices.Contains(responseCacheSetting.Groups, group)
+}
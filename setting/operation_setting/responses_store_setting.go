@@ -0,0 +1,43 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ResponsesStoreSetting Responses API 会话状态存储配置。上游不原生支持 Responses 状态的渠道（Claude、Gemini 等）
+// 由网关保存响应和输入，解析 previous_response_id，并提供 GET/DELETE /v1/responses/{id}。
+type ResponsesStoreSetting struct {
+	Enabled          bool `json:"enabled"`            // 总开关
+	TTLHours         int  `json:"ttl_hours"`          // 保存时长（小时），过期后由清理任务删除，0 表示不过期
+	MaxChainDepth    int  `json:"max_chain_depth"`    // previous_response_id 最多向前追溯的响应数
+	MaxResponseBytes int  `json:"max_response_bytes"` // 单个响应最大保存体积，超过则不保存
+}
+
+// 默认配置
+var responsesStoreSetting = ResponsesStoreSetting{
+	Enabled:          false,
+	TTLHours:         720,
+	MaxChainDepth:    100,
+	MaxResponseBytes: 4 << 20,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("responses_store_setting", &responsesStoreSetting)
+}
+
+// GetResponsesStoreSetting 获取 Responses 状态存储配置
+func GetResponsesStoreSetting() *ResponsesStoreSetting {
+	return &responsesStoreSetting
+}
+
+// IsResponsesStoreEnabled 是否启用 Responses 状态存储
+func IsResponsesStoreEnabled() bool {
+	return responsesStoreSetting.Enabled
+}
+
+// GetMaxChainDepth previous_response_id 最多追溯的响应数
+func (s *ResponsesStoreSetting) GetMaxChainDepth() int {
+	if s.MaxChainDepth <= 0 {
+		return 100
+	}
+	return s.MaxChainDepth
+}
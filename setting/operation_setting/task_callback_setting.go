@@ -0,0 +1,83 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TaskCallbackSetting 异步任务（视频、Suno、Midjourney）完成回调配置。
+// 请求体中的 callback_url 或令牌配置的回调地址会在任务成功、失败或进度达到里程碑时收到 POST 通知。
+// Upstream* 字段控制反方向：让支持推送的上游（可灵、Vidu、豆包、海螺）把任务结果回调到网关，轮询仅作兜底。
+type TaskCallbackSetting struct {
+	Enabled            bool  `json:"enabled"`             // 总开关
+	ProgressMilestones []int `json:"progress_milestones"` // 进度达到这些百分比时发送进度通知，为空则只通知终态
+	MaxAttempts        int   `json:"max_attempts"`        // 单次通知最多投递次数（含首次）
+	RetryBaseSeconds   int   `json:"retry_base_seconds"`  // 重试间隔基数（秒），第 n 次重试等待 base * 2^(n-1)
+	TimeoutSeconds     int   `json:"timeout_seconds"`     // 单次投递超时（秒）
+	RetentionDays      int   `json:"retention_days"`      // 投递记录保留天数，0 表示不清理
+
+	UpstreamEnabled         bool `json:"upstream_enabled"`          // 提交任务时附带网关回调地址，需要 ServerAddress 可被上游访问
+	UpstreamFallbackSeconds int  `json:"upstream_fallback_seconds"` // 等待上游回调的时长（秒），超时仍未完成的任务恢复轮询
+}
+
+// 默认配置
+var taskCallbackSetting = TaskCallbackSetting{
+	Enabled:            true,
+	ProgressMilestones: []int{25, 50, 75},
+	MaxAttempts:        6,
+	RetryBaseSeconds:   30,
+	TimeoutSeconds:     10,
+	RetentionDays:      7,
+
+	UpstreamEnabled:         false,
+	UpstreamFallbackSeconds: 600,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_callback_setting", &taskCallbackSetting)
+}
+
+// GetTaskCallbackSetting 获取任务回调配置
+func GetTaskCallbackSetting() *TaskCallbackSetting {
+	return &taskCallbackSetting
+}
+
+// IsTaskCallbackEnabled 是否启用任务回调
+func IsTaskCallbackEnabled() bool {
+	return taskCallbackSetting.Enabled
+}
+
+// GetMaxAttempts 单次通知最多投递次数
+func (s *TaskCallbackSetting) GetMaxAttempts() int {
+	if s.MaxAttempts <= 0 {
+		return 6
+	}
+	return s.MaxAttempts
+}
+
+// GetRetryBaseSeconds 重试间隔基数（秒）
+func (s *TaskCallbackSetting) GetRetryBaseSeconds() int {
+	if s.RetryBaseSeconds <= 0 {
+		return 30
+	}
+	return s.RetryBaseSeconds
+}
+
+// GetTimeoutSeconds 单次投递超时（秒）
+func (s *TaskCallbackSetting) GetTimeoutSeconds() int {
+	if s.TimeoutSeconds <= 0 {
+		return 10
+	}
+	return s.TimeoutSeconds
+}
+
+// IsUpstreamTaskCallbackEnabled 是否让上游把任务结果推送到网关
+func IsUpstreamTaskCallbackEnabled() bool {
+	return taskCallbackSetting.UpstreamEnabled
+}
+
+// GetUpstreamFallbackSeconds 等待上游回调的时长（秒）
+func (s *TaskCallbackSetting) GetUpstreamFallbackSeconds() int {
+	if s.UpstreamFallbackSeconds <= 0 {
+		return 600
+	}
+	return s.UpstreamFallbackSeconds
+}
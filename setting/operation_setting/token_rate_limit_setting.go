@@ -0,0 +1,52 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TokenRateLimits 是一组令牌限额，0 表示不限
+type TokenRateLimits struct {
+	TPM         int   `json:"tpm"`         // 每分钟 tokens（输入+输出）
+	TPD         int64 `json:"tpd"`         // 每天 tokens（输入+输出）
+	Concurrency int   `json:"concurrency"` // 同时进行中的请求数
+}
+
+// TokenRateLimitSetting 令牌级 tokens 用量与并发限制。
+// 令牌自身配置的限额优先，未配置（为 0）的项使用分组默认值，分组未配置时使用 Default。
+type TokenRateLimitSetting struct {
+	Enabled bool                       `json:"enabled"`
+	Default TokenRateLimits            `json:"default"`
+	Groups  map[string]TokenRateLimits `json:"groups"`
+}
+
+// 默认配置
+var tokenRateLimitSetting = TokenRateLimitSetting{
+	Enabled: false,
+	Groups:  map[string]TokenRateLimits{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("token_rate_limit_setting", &tokenRateLimitSetting)
+}
+
+// GetTokenRateLimitSetting 获取令牌限流配置
+func GetTokenRateLimitSetting() *TokenRateLimitSetting {
+	return &tokenRateLimitSetting
+}
+
+// ResolveTokenRateLimits 合并令牌自身的限额与分组默认限额
+func ResolveTokenRateLimits(token TokenRateLimits, group string) TokenRateLimits {
+	defaults, ok := tokenRateLimitSetting.Groups[group]
+	if !ok {
+		defaults = tokenRateLimitSetting.Default
+	}
+	if token.TPM <= 0 {
+		token.TPM = defaults.TPM
+	}
+	if token.TPD <= 0 {
+		token.TPD = defaults.TPD
+	}
+	if token.Concurrency <= 0 {
+		token.Concurrency = defaults.Concurrency
+	}
+	return token
+}
@@ -33,6 +33,7 @@ const (
 	defaultFileSearchToolPrice       = 2.5
 	defaultGoogleSearchToolPrice     = 14.0
 	defaultImageGenerationToolPrice  = 150.0
+	defaultCodeInterpreterToolPrice  = 30.0
 	defaultSearchPreviewModelPrice   = 25.0
 )
 
@@ -45,6 +46,7 @@ func seedHardcodedToolPrices(prices map[string]float64) {
 	prices["file_search"] = defaultFileSearchToolPrice
 	prices["google_search"] = defaultGoogleSearchToolPrice
 	prices["image_generation"] = defaultImageGenerationToolPrice
+	prices["code_interpreter"] = defaultCodeInterpreterToolPrice
 	prices["web_search_preview:gpt-4o*"] = defaultSearchPreviewModelPrice
 	prices["web_search_preview:gpt-4.1*"] = defaultSearchPreviewModelPrice
 	prices["web_search_preview:gpt-4o-mini*"] = defaultSearchPreviewModelPrice
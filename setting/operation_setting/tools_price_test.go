@@ -31,6 +31,7 @@ func TestToolPriceHardcodedFallbacksSurviveMissingOperatorConfig(t *testing.T) {
 		"file_search":        2.5,
 		"google_search":      14,
 		"image_generation":   150,
+		"code_interpreter":   30,
 	}
 	for name, expected := range expectedDefaults {
 		assert.Equal(t, expected, GetToolPrice(name), name)
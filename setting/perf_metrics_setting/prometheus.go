@@ -0,0 +1,21 @@
+package perf_metrics_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// PrometheusSetting 控制 /metrics 暴露端点，BearerSecret 为空时不校验鉴权
+type PrometheusSetting struct {
+	Enabled      bool   `json:"enabled"`
+	BearerSecret string `json:"bearer_secret"`
+}
+
+var prometheusSetting = PrometheusSetting{
+	Enabled: false,
+}
+
+func init() {
+	config.GlobalConfig.Register("prometheus_setting", &prometheusSetting)
+}
+
+func GetPrometheusSetting() PrometheusSetting {
+	return prometheusSetting
+}
@@ -0,0 +1,39 @@
+package ratio_setting
+
+import (
+	"github.com/QuantumNous/new-api/types"
+)
+
+// BatchRatioWildcard 匹配所有未单独配置的模型
+const BatchRatioWildcard = "*"
+
+// defaultBatchRatio 为空表示批处理默认不打折，管理员可按模型配置，例如 {"gpt-4o": 0.5, "*": 0.8}
+var defaultBatchRatio = map[string]float64{}
+
+var batchRatioMap = types.NewRWMap[string, float64]()
+
+func BatchRatio2JSONString() string {
+	return batchRatioMap.MarshalJSONString()
+}
+
+func UpdateBatchRatioByJSONString(jsonStr string) error {
+	return types.LoadFromJsonString(batchRatioMap, jsonStr)
+}
+
+// GetBatchRatio 返回 /v1/batches 离线批处理请求的计费折扣倍率，未配置时为 1
+func GetBatchRatio(name string) float64 {
+	if ratio, ok := batchRatioMap.Get(name); ok {
+		return ratio
+	}
+	if ratio, ok := batchRatioMap.Get(FormatMatchingModelName(name)); ok {
+		return ratio
+	}
+	if ratio, ok := batchRatioMap.Get(BatchRatioWildcard); ok {
+		return ratio
+	}
+	return 1
+}
+
+func GetBatchRatioCopy() map[string]float64 {
+	return batchRatioMap.ReadAll()
+}